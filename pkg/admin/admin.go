@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package admin
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const MetricsPath = "/metrics"
+
+// Server is the admin http server of mosn, which exposes metrics for prometheus,
+// the health status of upstream clusters and the readiness of mosn, ejects hosts manually,
+// reloads tls certificates, dumps and updates route rules, and captures requests by tap filters at runtime
+type Server struct {
+	address   string
+	server    *http.Server
+	listener  net.Listener
+	readiness *Readiness
+}
+
+func NewServer(address string, clusterManager types.ClusterManager) *Server {
+	readiness := NewReadiness(clusterManager)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(MetricsPath, handleMetrics)
+	mux.HandleFunc(ClustersPath, handleClusters(clusterManager))
+	mux.HandleFunc(HostPath, handleHost(clusterManager))
+	mux.HandleFunc(ReadyPath, handleReady(readiness))
+	mux.HandleFunc(TLSReloadPath, handleTLSReload)
+	mux.HandleFunc(RoutesPath, handleRoutes)
+	mux.HandleFunc(RouteRulePath, handleRouteRule)
+	mux.HandleFunc(RoutesRevertPath, handleRoutesRevert)
+	mux.HandleFunc(RouteWeightsPath, handleRouteWeights)
+	mux.HandleFunc(TapPath, handleTap)
+
+	return &Server{
+		address:   address,
+		server:    &http.Server{Handler: mux},
+		readiness: readiness,
+	}
+}
+
+// Start listens on the admin address and serves in background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.DefaultLogger.Errorf("admin server on %s stopped: %v", s.address, err)
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the listening address, which is useful if port 0 is configured
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Addr()
+}
+
+// Readiness returns the readiness served on ready path, initial discoveries are registered on it
+func (s *Server) Readiness() *Readiness {
+	return s.readiness
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if err := stats.WritePrometheus(w); err != nil {
+		log.DefaultLogger.Errorf("write prometheus metrics failed: %v", err)
+	}
+}
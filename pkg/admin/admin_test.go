@@ -0,0 +1,606 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/tap"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/router"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/alipay/sofamosn/pkg/upstream/cluster"
+)
+
+func TestMetrics(t *testing.T) {
+	s := NewServer("127.0.0.1:0", nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	tags := stats.Tags{stats.TagCluster: "admin_cluster", stats.TagProtocol: "SofaRpc"}
+	sink := stats.GetSink()
+	sink.Count(stats.ClusterRequestsTotal, 1, tags)
+	sink.Histogram(stats.ClusterRequestDuration, time.Millisecond.Seconds(), tags)
+	sink.Count(stats.ClusterResponsesTotal, 1, tags.With(stats.TagStatus, "success"))
+
+	resp, err := http.Get("http://" + s.Addr().String() + MetricsPath)
+	if err != nil {
+		t.Fatalf("get metrics error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected response %d, content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, expected := range []string{
+		"# TYPE mosn_cluster_requests_total counter",
+		`mosn_cluster_requests_total{cluster="admin_cluster",protocol="SofaRpc"} 1`,
+		`mosn_cluster_responses_total{cluster="admin_cluster",protocol="SofaRpc",status="success"} 1`,
+		`mosn_cluster_request_duration_seconds_count{cluster="admin_cluster",protocol="SofaRpc"} 1`,
+	} {
+		if !strings.Contains(string(body), expected+"\n") {
+			t.Errorf("expected %s in metrics:\n%s", expected, body)
+		}
+	}
+}
+
+type mockHostMonitor struct {
+	time    time.Time
+	healthy bool
+}
+
+func (m *mockHostMonitor) LastCheckResult() (time.Time, bool) {
+	return m.time, m.healthy
+}
+
+func getClustersStatus(t *testing.T, s *Server) *ClustersStatus {
+	resp, err := http.Get("http://" + s.Addr().String() + ClustersPath)
+	if err != nil {
+		t.Fatalf("get clusters error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d, content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	status := &ClustersStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		t.Fatalf("decode clusters status error: %v", err)
+	}
+	return status
+}
+
+func TestClusters(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	clusterName := "admin_health_cluster"
+	cm := cluster.NewClusterManager(nil, []v2.Cluster{
+		{
+			Name:        clusterName,
+			ClusterType: v2.SIMPLE_CLUSTER,
+			LbType:      v2.LB_ROUNDROBIN,
+		},
+	}, map[string][]v2.Host{
+		clusterName: {
+			{Address: "127.0.0.1:8080", Weight: 100},
+			{Address: "127.0.0.2:8080", Weight: 50},
+		},
+	}, false, false)
+
+	s := NewServer("127.0.0.1:0", cm)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	status := getClustersStatus(t, s)
+	if len(status.Clusters) != 1 || status.Clusters[0].Name != clusterName {
+		t.Fatalf("unexpected clusters %+v", status.Clusters)
+	}
+	if c := status.Clusters[0]; c.TotalHosts != 2 || c.HealthyHosts != 2 {
+		t.Fatalf("expected 2 healthy hosts, got %d/%d", c.HealthyHosts, c.TotalHosts)
+	}
+
+	// mark a host failed in active health check, and another ejected as an outlier
+	checkTime := time.Now().Add(-time.Second)
+	for _, host := range cm.Clusters()[clusterName].PrioritySet().HostSetsByPriority()[0].Hosts() {
+		switch host.AddressString() {
+		case "127.0.0.1:8080":
+			host.SetHealthFlag(types.FAILED_ACTIVE_HC)
+			host.SetHealthChecker(&mockHostMonitor{time: checkTime, healthy: false})
+		case "127.0.0.2:8080":
+			host.SetHealthFlag(types.FAILED_OUTLIER_CHECK)
+		}
+	}
+
+	status = getClustersStatus(t, s)
+	c := status.Clusters[0]
+	if c.TotalHosts != 2 || c.HealthyHosts != 0 {
+		t.Fatalf("expected 0 healthy hosts, got %d/%d", c.HealthyHosts, c.TotalHosts)
+	}
+	for _, host := range c.Hosts {
+		switch host.Address {
+		case "127.0.0.1:8080":
+			if host.Healthy || !host.FailedHealthCheck || host.OutlierEjected || host.Weight != 100 {
+				t.Errorf("unexpected host status %+v", host)
+			}
+			if host.LastHealthCheck == nil || host.LastHealthCheck.Healthy || !host.LastHealthCheck.Time.Equal(checkTime) {
+				t.Errorf("unexpected last health check %+v", host.LastHealthCheck)
+			}
+		case "127.0.0.2:8080":
+			if host.Healthy || host.FailedHealthCheck || !host.OutlierEjected || host.Weight != 50 {
+				t.Errorf("unexpected host status %+v", host)
+			}
+			if host.LastHealthCheck != nil {
+				t.Errorf("expected no health check result, got %+v", host.LastHealthCheck)
+			}
+		default:
+			t.Errorf("unexpected host %s", host.Address)
+		}
+	}
+
+	// read only
+	resp, err := http.Post("http://"+s.Addr().String()+ClustersPath, "application/json", nil)
+	if err != nil {
+		t.Fatalf("post clusters error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func postHostAction(t *testing.T, s *Server, clusterName, address, action string) int {
+	resp, err := http.Post("http://"+s.Addr().String()+HostPath+"?cluster="+clusterName+"&address="+address+"&action="+action,
+		"text/plain", nil)
+	if err != nil {
+		t.Fatalf("post host error: %v", err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func getHost(t *testing.T, s *Server, clusterName, address string) *HostStatus {
+	resp, err := http.Get("http://" + s.Addr().String() + HostPath + "?cluster=" + clusterName + "&address=" + address)
+	if err != nil {
+		t.Fatalf("get host error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response %d", resp.StatusCode)
+	}
+	status := &HostStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		t.Fatalf("decode host status error: %v", err)
+	}
+	return status
+}
+
+func TestHost(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	clusterName := "admin_host_cluster"
+	hosts := []v2.Host{{Address: "127.0.0.1:8080"}, {Address: "127.0.0.2:8080"}}
+	cm := cluster.NewClusterManager(nil, []v2.Cluster{
+		{
+			Name:        clusterName,
+			ClusterType: v2.SIMPLE_CLUSTER,
+			LbType:      v2.LB_ROUNDROBIN,
+		},
+	}, map[string][]v2.Host{clusterName: hosts}, false, false)
+
+	s := NewServer("127.0.0.1:0", cm)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	if host := getHost(t, s, clusterName, "127.0.0.1:8080"); !host.Healthy || host.HealthOverride != "none" {
+		t.Fatalf("unexpected host status %+v", host)
+	}
+
+	// manual ejection survives discovery updates of the same host
+	if status := postHostAction(t, s, clusterName, "127.0.0.1:8080", "eject"); status != http.StatusOK {
+		t.Fatalf("eject host failed, status %d", status)
+	}
+	cm.UpdateClusterHosts(clusterName, 0, hosts[1:])
+	cm.UpdateClusterHosts(clusterName, 0, hosts)
+
+	if host := getHost(t, s, clusterName, "127.0.0.1:8080"); host.Healthy || host.HealthOverride != "ejected" {
+		t.Fatalf("expected host ejected manually, got %+v", host)
+	}
+	if c := getClustersStatus(t, s).Clusters[0]; c.HealthyHosts != 1 {
+		t.Errorf("expected 1 healthy host, got %d", c.HealthyHosts)
+	}
+
+	// un-eject takes precedence over outlier ejection
+	outlier := cm.Clusters()[clusterName].PrioritySet().HostSetsByPriority()[0].Hosts()[1]
+	outlier.SetHealthFlag(types.FAILED_OUTLIER_CHECK)
+	if status := postHostAction(t, s, clusterName, "127.0.0.2:8080", "uneject"); status != http.StatusOK {
+		t.Fatalf("uneject host failed, status %d", status)
+	}
+	if host := getHost(t, s, clusterName, "127.0.0.2:8080"); !host.Healthy || !host.OutlierEjected || host.HealthOverride != "admitted" {
+		t.Errorf("expected host admitted manually, got %+v", host)
+	}
+
+	// cleared overrides restore the automatic state
+	for _, address := range []string{"127.0.0.1:8080", "127.0.0.2:8080"} {
+		if status := postHostAction(t, s, clusterName, address, "clear"); status != http.StatusOK {
+			t.Fatalf("clear host failed, status %d", status)
+		}
+	}
+	if host := getHost(t, s, clusterName, "127.0.0.1:8080"); !host.Healthy || host.HealthOverride != "none" {
+		t.Errorf("expected host healthy once cleared, got %+v", host)
+	}
+	if host := getHost(t, s, clusterName, "127.0.0.2:8080"); host.Healthy {
+		t.Errorf("expected outlier host unhealthy once cleared, got %+v", host)
+	}
+
+	for _, c := range []struct {
+		cluster, address, action string
+		status                   int
+	}{
+		{clusterName, "127.0.0.1:8080", "drain", http.StatusBadRequest},
+		{clusterName, "127.0.0.3:8080", "eject", http.StatusNotFound},
+		{"unknown", "127.0.0.1:8080", "eject", http.StatusNotFound},
+	} {
+		if status := postHostAction(t, s, c.cluster, c.address, c.action); status != c.status {
+			t.Errorf("%s %s of cluster %s: expected status %d, got %d", c.action, c.address, c.cluster, c.status, status)
+		}
+	}
+}
+
+func getReady(t *testing.T, s *Server) (int, string) {
+	resp, err := http.Get("http://" + s.Addr().String() + ReadyPath)
+	if err != nil {
+		t.Fatalf("get ready error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestReady(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	clusterName := "admin_ready_cluster"
+	cm := cluster.NewClusterManager(nil, []v2.Cluster{
+		{
+			Name:        clusterName,
+			ClusterType: v2.SIMPLE_CLUSTER,
+			LbType:      v2.LB_ROUNDROBIN,
+		},
+	}, map[string][]v2.Host{}, false, false)
+
+	s := NewServer("127.0.0.1:0", cm)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	s.Readiness().AddDiscovery(clusterName)
+
+	// no host and discovery pending
+	if status, body := getReady(t, s); status != http.StatusServiceUnavailable || !strings.Contains(body, "discovery") {
+		t.Fatalf("expected not ready by pending discovery, got %d %s", status, body)
+	}
+
+	// discovery done, but no healthy host
+	if err := cm.UpdateClusterHosts(clusterName, 0, []v2.Host{{Address: "127.0.0.1:8080"}}); err != nil {
+		t.Fatalf("update cluster hosts error: %v", err)
+	}
+	s.Readiness().DiscoveryDone(clusterName)
+
+	host := cm.Clusters()[clusterName].PrioritySet().HostSetsByPriority()[0].Hosts()[0]
+	host.SetHealthFlag(types.FAILED_ACTIVE_HC)
+	if status, body := getReady(t, s); status != http.StatusServiceUnavailable || !strings.Contains(body, clusterName) {
+		t.Fatalf("expected not ready by no healthy host, got %d %s", status, body)
+	}
+
+	// the cluster gains a healthy host
+	host.ClearHealthFlag(types.FAILED_ACTIVE_HC)
+	if status, body := getReady(t, s); status != http.StatusOK {
+		t.Fatalf("expected ready, got %d %s", status, body)
+	}
+
+	// stays ready even if the host fails later
+	host.SetHealthFlag(types.FAILED_ACTIVE_HC)
+	s.Readiness().AddDiscovery("another")
+	if status, body := getReady(t, s); status != http.StatusOK {
+		t.Errorf("expected to stay ready, got %d %s", status, body)
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	s := NewServer("127.0.0.1:0", nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	resp, err := http.Get("http://" + s.Addr().String() + TLSReloadPath)
+	if err != nil {
+		t.Fatalf("get tls reload error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+
+	resp, err = http.Post("http://"+s.Addr().String()+TLSReloadPath, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("post tls reload error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func getRoutesStatus(t *testing.T, s *Server) *RoutesStatus {
+	resp, err := http.Get("http://" + s.Addr().String() + RoutesPath)
+	if err != nil {
+		t.Fatalf("get routes error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d, content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	status := &RoutesStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		t.Fatalf("decode routes status error: %v", err)
+	}
+	return status
+}
+
+func doRouteRequest(t *testing.T, method, url, body string) int {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error: %v", method, url, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRoutes(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	listenerName := "admin_routes_listener"
+	routers, _ := router.RouteTables.Routers(listenerName, protocol.SofaRpc, &v2.Proxy{
+		VirtualHosts: []*v2.VirtualHost{
+			{
+				Name:    "sofa",
+				Domains: []string{"*"},
+				Routers: []v2.Router{
+					{
+						Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{{Name: "service", Value: "com.alipay.test.HelloService:1.0"}}},
+						Route: v2.RouteAction{ClusterName: "hello_cluster"},
+					},
+				},
+			},
+		},
+	})
+	routedCluster := func() string {
+		route := routers.Route(map[string]string{"service": "com.alipay.test.HelloService:1.0"}, 1)
+		if route == nil {
+			return ""
+		}
+		return route.RouteRule().ClusterName()
+	}
+
+	s := NewServer("127.0.0.1:0", nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	// dump
+	var routes *ListenerRoutes
+	for _, l := range getRoutesStatus(t, s).Listeners {
+		if l.Name == listenerName {
+			routes = &l
+		}
+	}
+	if routes == nil || routes.Overridden || len(routes.VirtualHosts) != 1 || len(routes.VirtualHosts[0].Routers) != 1 ||
+		routes.VirtualHosts[0].Routers[0].Route.ClusterName != "hello_cluster" {
+		t.Fatalf("unexpected routes of listener %+v", routes)
+	}
+
+	ruleURL := "http://" + s.Addr().String() + RouteRulePath + "?listener=" + listenerName + "&virtual_host=sofa"
+	rule := `{"Match":{"Headers":[{"Name":"service","Value":"com.alipay.test.HelloService:1.0"}]},"Route":{"ClusterName":"hello_backup"}}`
+
+	// invalid rules are rejected
+	for _, invalid := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{http.MethodPut, ruleURL + "&index=0", `{"Route":{"ClusterName":"hello_backup"}}`, http.StatusBadRequest},
+		{http.MethodPut, ruleURL + "&index=0", `{"Match":{"Path":"/"},"Route":{"ClusterName":"hello_backup","mirror_percent":101}}`, http.StatusBadRequest},
+		{http.MethodPut, ruleURL, rule, http.StatusBadRequest},
+		{http.MethodPut, ruleURL + "&index=3", rule, http.StatusNotFound},
+		{http.MethodPut, "http://" + s.Addr().String() + RouteRulePath + "?listener=unknown&index=0", rule, http.StatusNotFound},
+		{http.MethodGet, ruleURL, "", http.StatusMethodNotAllowed},
+	} {
+		if status := doRouteRequest(t, invalid.method, invalid.url, invalid.body); status != invalid.status {
+			t.Errorf("%s %s %s expected status %d, got %d", invalid.method, invalid.url, invalid.body, invalid.status, status)
+		}
+	}
+	if cluster := routedCluster(); cluster != "hello_cluster" {
+		t.Fatalf("invalid rules should not be applied, routed to %s", cluster)
+	}
+
+	// override takes effect on the next request
+	if status := doRouteRequest(t, http.MethodPut, ruleURL+"&index=0", rule); status != http.StatusOK {
+		t.Fatalf("replace route rule expected status %d, got %d", http.StatusOK, status)
+	}
+	if cluster := routedCluster(); cluster != "hello_backup" {
+		t.Errorf("overridden rule should take effect, routed to %s", cluster)
+	}
+	for _, l := range getRoutesStatus(t, s).Listeners {
+		if l.Name == listenerName && (!l.Overridden || l.VirtualHosts[0].Routers[0].Route.ClusterName != "hello_backup") {
+			t.Errorf("dumped routes should be overridden, got %+v", l)
+		}
+	}
+
+	// revert
+	if status := doRouteRequest(t, http.MethodPost, "http://"+s.Addr().String()+RoutesRevertPath+"?listener="+listenerName, ""); status != http.StatusOK {
+		t.Fatalf("revert routes expected status %d, got %d", http.StatusOK, status)
+	}
+	if cluster := routedCluster(); cluster != "hello_cluster" {
+		t.Errorf("configured rule should be restored, routed to %s", cluster)
+	}
+}
+
+func TestRouteWeights(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	listenerName := "admin_route_weights_listener"
+	routers, _ := router.RouteTables.Routers(listenerName, protocol.SofaRpc, &v2.Proxy{
+		VirtualHosts: []*v2.VirtualHost{
+			{
+				Name:    "sofa",
+				Domains: []string{"*"},
+				Routers: []v2.Router{
+					{
+						Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{{Name: "service", Value: "com.alipay.test.HelloService:1.0"}}},
+						Route: v2.RouteAction{WeightedClusters: []v2.WeightedCluster{
+							{Clusters: v2.ClusterWeight{Name: "hello_stable", Weight: 100}},
+							{Clusters: v2.ClusterWeight{Name: "hello_canary", Weight: 0}},
+						}},
+					},
+				},
+			},
+		},
+	})
+	canaryRequests := func() int {
+		n := 0
+		for i := uint64(0); i < 100; i++ {
+			if routers.Route(map[string]string{"service": "com.alipay.test.HelloService:1.0"}, i).RouteRule().ClusterName() == "hello_canary" {
+				n++
+			}
+		}
+		return n
+	}
+
+	s := NewServer("127.0.0.1:0", nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	weightsURL := "http://" + s.Addr().String() + RouteWeightsPath + "?listener=" + listenerName + "&virtual_host=sofa"
+
+	// invalid weights are rejected
+	for _, invalid := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{http.MethodPut, weightsURL + "&index=0", `{"weights":[0,0]}`, http.StatusBadRequest},
+		{http.MethodPut, weightsURL + "&index=0", `{"weights":[80,10,10]}`, http.StatusBadRequest},
+		{http.MethodPut, weightsURL + "&index=0", `{"weights":[-1,10]}`, http.StatusBadRequest},
+		{http.MethodPut, weightsURL, `{"weights":[80,20]}`, http.StatusBadRequest},
+		{http.MethodPut, weightsURL + "&index=1", `{"weights":[80,20]}`, http.StatusNotFound},
+		{http.MethodPut, "http://" + s.Addr().String() + RouteWeightsPath + "?listener=unknown&index=0", `{"weights":[80,20]}`, http.StatusNotFound},
+		{http.MethodPost, weightsURL + "&index=0", `{"weights":[80,20]}`, http.StatusMethodNotAllowed},
+	} {
+		if status := doRouteRequest(t, invalid.method, invalid.url, invalid.body); status != invalid.status {
+			t.Errorf("%s %s %s expected status %d, got %d", invalid.method, invalid.url, invalid.body, invalid.status, status)
+		}
+	}
+	if n := canaryRequests(); n != 0 {
+		t.Fatalf("invalid weights should not be applied, %d requests routed to canary", n)
+	}
+
+	if status := doRouteRequest(t, http.MethodPut, weightsURL+"&index=0", `{"weights":[80,20]}`); status != http.StatusOK {
+		t.Fatalf("update route weights expected status %d, got %d", http.StatusOK, status)
+	}
+	if n := canaryRequests(); n != 20 {
+		t.Errorf("expect 20 of 100 requests routed to canary, got %d", n)
+	}
+	for _, l := range getRoutesStatus(t, s).Listeners {
+		if l.Name == listenerName && (!l.Overridden || l.VirtualHosts[0].Routers[0].Route.WeightedClusters[1].Clusters.Weight != 20) {
+			t.Errorf("dumped routes should be overridden with updated weights, got %+v", l)
+		}
+	}
+}
+
+func getTapStatus(t *testing.T, s *Server) *tap.Status {
+	resp, err := http.Get("http://" + s.Addr().String() + TapPath)
+	if err != nil {
+		t.Fatalf("get tap error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	status := &tap.Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		t.Fatalf("decode tap status error: %v", err)
+	}
+	return status
+}
+
+func TestTap(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	s := NewServer("127.0.0.1:0", nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start admin server error: %v", err)
+	}
+	defer s.Close()
+
+	tapURL := "http://" + s.Addr().String() + TapPath
+
+	if status := doRouteRequest(t, http.MethodPost, tapURL, `{"class_name": 1}`); status != http.StatusBadRequest {
+		t.Errorf("invalid tap config expected status %d, got %d", http.StatusBadRequest, status)
+	}
+	if status := doRouteRequest(t, http.MethodPut, tapURL, ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("PUT tap expected status %d, got %d", http.StatusMethodNotAllowed, status)
+	}
+
+	if status := doRouteRequest(t, http.MethodPost, tapURL, `{"class_name": "com.alipay.test.HelloService", "max_captures": 5}`); status != http.StatusOK {
+		t.Fatalf("enable tap expected status %d, got %d", http.StatusOK, status)
+	}
+	if status := getTapStatus(t, s); !status.Enabled || status.Config == nil ||
+		status.Config.ClassName != "com.alipay.test.HelloService" || status.Config.MaxCaptures != 5 {
+		t.Errorf("unexpected tap status %+v", status)
+	}
+
+	if status := doRouteRequest(t, http.MethodDelete, tapURL, ""); status != http.StatusOK {
+		t.Fatalf("disable tap expected status %d, got %d", http.StatusOK, status)
+	}
+	if status := getTapStatus(t, s); status.Enabled {
+		t.Errorf("tap should be disabled, got %+v", status)
+	}
+	if status := doRouteRequest(t, http.MethodDelete, tapURL, ""); status != http.StatusNotFound {
+		t.Errorf("disable tap not enabled expected status %d, got %d", http.StatusNotFound, status)
+	}
+}
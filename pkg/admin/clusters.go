@@ -0,0 +1,227 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const (
+	ClustersPath = "/clusters"
+	HostPath     = "/clusters/host"
+)
+
+// ClustersStatus is the response of clusters path
+type ClustersStatus struct {
+	Clusters []ClusterStatus `json:"clusters"`
+}
+
+// ClusterStatus is the health status of a cluster and its hosts
+type ClusterStatus struct {
+	Name             string       `json:"name"`
+	HealthCheck      bool         `json:"health_check"`      // active health check is configured
+	OutlierDetection bool         `json:"outlier_detection"` // outlier detection is configured
+	TotalHosts       int          `json:"total_hosts"`
+	HealthyHosts     int          `json:"healthy_hosts"`
+	Hosts            []HostStatus `json:"hosts"`
+}
+
+// HostStatus is the health status of an upstream host, a host is healthy if it neither
+// fails the active health check nor is ejected as an outlier
+type HostStatus struct {
+	Address           string             `json:"address"`
+	Hostname          string             `json:"hostname,omitempty"`
+	Priority          uint32             `json:"priority"`
+	Healthy           bool               `json:"healthy"`
+	FailedHealthCheck bool               `json:"failed_health_check"`
+	OutlierEjected    bool               `json:"outlier_ejected"`
+	Weight            uint32             `json:"weight"`
+	ActiveConnections int64              `json:"active_connections"`
+	ActiveRequests    int64              `json:"active_requests"`
+	LastHealthCheck   *HealthCheckResult `json:"last_health_check,omitempty"` // nil if never checked
+	// none, ejected or admitted, the manual override takes precedence over health check and outlier detection
+	HealthOverride   string     `json:"health_override"`
+	OutlierEjections uint32     `json:"outlier_ejections"`
+	LastEjectionTime *time.Time `json:"last_ejection_time,omitempty"` // nil if never ejected as an outlier
+}
+
+type HealthCheckResult struct {
+	Time    time.Time `json:"time"`
+	Healthy bool      `json:"healthy"`
+}
+
+// GetClustersStatus collects the status of all clusters, sorted by cluster name.
+// Hosts are read from the snapshot of host sets, no lock is held across clusters.
+func GetClustersStatus(clusterManager types.ClusterManager) *ClustersStatus {
+	status := &ClustersStatus{Clusters: []ClusterStatus{}}
+
+	if clusterManager == nil {
+		return status
+	}
+
+	for name, cluster := range clusterManager.Clusters() {
+		clusterStatus := ClusterStatus{
+			Name:             name,
+			HealthCheck:      cluster.HealthChecker() != nil,
+			OutlierDetection: cluster.OutlierDetector() != nil,
+			Hosts:            []HostStatus{},
+		}
+
+		for _, hostSet := range cluster.PrioritySet().HostSetsByPriority() {
+			for _, host := range hostSet.Hosts() {
+				hostStatus := getHostStatus(host)
+				hostStatus.Priority = hostSet.Priority()
+
+				clusterStatus.Hosts = append(clusterStatus.Hosts, hostStatus)
+				if hostStatus.Healthy {
+					clusterStatus.HealthyHosts++
+				}
+			}
+		}
+		clusterStatus.TotalHosts = len(clusterStatus.Hosts)
+
+		status.Clusters = append(status.Clusters, clusterStatus)
+	}
+
+	sort.Slice(status.Clusters, func(i, j int) bool {
+		return status.Clusters[i].Name < status.Clusters[j].Name
+	})
+
+	return status
+}
+
+func getHostStatus(host types.Host) HostStatus {
+	status := HostStatus{
+		Address:           host.AddressString(),
+		Hostname:          host.Hostname(),
+		Healthy:           host.Health(),
+		FailedHealthCheck: host.ContainHealthFlag(types.FAILED_ACTIVE_HC),
+		OutlierEjected:    host.ContainHealthFlag(types.FAILED_OUTLIER_CHECK),
+		Weight:            host.Weight(),
+		ActiveRequests:    host.ActiveRequests(),
+		HealthOverride:    host.HealthOverride().String(),
+	}
+
+	if active := host.HostStats().UpstreamConnectionActive; active != nil {
+		status.ActiveConnections = active.Count()
+	}
+
+	if monitor := host.HealthChecker(); monitor != nil {
+		if checkTime, healthy := monitor.LastCheckResult(); !checkTime.IsZero() {
+			status.LastHealthCheck = &HealthCheckResult{Time: checkTime, Healthy: healthy}
+		}
+	}
+
+	if monitor := host.OutlierDetector(); monitor != nil {
+		status.OutlierEjections = monitor.NumEjections()
+		if ejectionTime := monitor.LastEjectionTime(); !ejectionTime.IsZero() {
+			status.LastEjectionTime = &ejectionTime
+		}
+	}
+
+	return status
+}
+
+func handleClusters(clusterManager types.ClusterManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(GetClustersStatus(clusterManager)); err != nil {
+			log.DefaultLogger.Errorf("write clusters status failed: %v", err)
+		}
+	}
+}
+
+// health overrides set by the action of host path
+var hostActions = map[string]types.HealthOverride{
+	"eject":   types.HealthOverrideEjected,
+	"uneject": types.HealthOverrideAdmitted,
+	"clear":   types.HealthOverrideNone,
+}
+
+// handleHost serves the host identified by cluster and address in query. GET returns the status of
+// the host, and POST overrides its health by action: eject ejects the host, uneject admits it even if
+// it is ejected by outlier detection or fails health check, and clear restores the automatic detection
+func handleHost(clusterManager types.ClusterManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		clusterName, address := query.Get("cluster"), query.Get("address")
+
+		var cluster types.Cluster
+		if clusterManager != nil {
+			cluster = clusterManager.Clusters()[clusterName]
+		}
+		if cluster == nil {
+			http.Error(w, "cluster "+clusterName+" not found", http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			override, ok := hostActions[query.Get("action")]
+			if !ok {
+				http.Error(w, "invalid action "+query.Get("action")+", expect eject, uneject or clear", http.StatusBadRequest)
+				return
+			}
+
+			if !cluster.SetHostHealthOverride(address, override) {
+				http.Error(w, "host "+address+" not found in cluster "+clusterName, http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("OK\n"))
+			return
+		}
+
+		for _, hostSet := range cluster.PrioritySet().HostSetsByPriority() {
+			for _, host := range hostSet.Hosts() {
+				if host.AddressString() != address {
+					continue
+				}
+
+				status := getHostStatus(host)
+				status.Priority = hostSet.Priority()
+
+				w.Header().Set("Content-Type", "application/json")
+				if err := json.NewEncoder(w).Encode(status); err != nil {
+					log.DefaultLogger.Errorf("write host status failed: %v", err)
+				}
+				return
+			}
+		}
+
+		http.Error(w, "host "+address+" not found in cluster "+clusterName, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const ReadyPath = "/ready"
+
+// Readiness tells the orchestrator when to route traffic to mosn. Mosn is not ready until
+// the initial discoveries are done, every cluster has at least one healthy host and the connections
+// to the hosts are pre-warmed, pre-warming is bounded by its timeout.
+// Once ready it stays ready, hosts failing later are handled by the load balancers.
+type Readiness struct {
+	clusterManager types.ClusterManager
+
+	mux sync.Mutex
+	// initial discoveries not done yet
+	pending map[string]bool
+	ready   bool
+}
+
+func NewReadiness(clusterManager types.ClusterManager) *Readiness {
+	return &Readiness{
+		clusterManager: clusterManager,
+		pending:        make(map[string]bool),
+	}
+}
+
+// AddDiscovery registers an initial discovery, such as the first host list of a cluster
+// pushed by service discovery, mosn is not ready until it is done
+func (r *Readiness) AddDiscovery(name string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if !r.ready {
+		r.pending[name] = true
+	}
+}
+
+// DiscoveryDone marks the initial discovery done, it's ok to be called more than once
+func (r *Readiness) DiscoveryDone(name string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	delete(r.pending, name)
+}
+
+// Ready returns whether mosn is ready, and the reason if not
+func (r *Readiness) Ready() (bool, string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.ready {
+		return true, ""
+	}
+
+	if reason := r.check(); reason != "" {
+		return false, reason
+	}
+
+	r.ready = true
+	log.DefaultLogger.Infof("mosn is ready")
+
+	return true, ""
+}
+
+func (r *Readiness) check() string {
+	if len(r.pending) > 0 {
+		var names []string
+		for name := range r.pending {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return fmt.Sprintf("initial discovery of %v not done", names)
+	}
+
+	if r.clusterManager == nil {
+		return "no cluster manager"
+	}
+
+	clusters := r.clusterManager.Clusters()
+	if len(clusters) == 0 {
+		return "no cluster"
+	}
+
+	var unhealthy []string
+	for name, cluster := range clusters {
+		if !hasHealthyHost(cluster) {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		sort.Strings(unhealthy)
+		return fmt.Sprintf("no healthy host in clusters %v", unhealthy)
+	}
+
+	if prewarming := r.clusterManager.PrewarmingClusters(); len(prewarming) > 0 {
+		return fmt.Sprintf("connections of clusters %v are pre-warming", prewarming)
+	}
+
+	return ""
+}
+
+func hasHealthyHost(cluster types.Cluster) bool {
+	for _, hostSet := range cluster.PrioritySet().HostSetsByPriority() {
+		for _, host := range hostSet.Hosts() {
+			if host.Health() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// handleReady responds 200 if mosn is ready, or 503 with the reason if not
+func handleReady(readiness *Readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+
+		if ready, reason := readiness.Ready(); !ready {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("OK\n"))
+	}
+}
@@ -0,0 +1,230 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/router"
+)
+
+const (
+	RoutesPath       = "/routes"
+	RouteRulePath    = "/routes/rule"
+	RoutesRevertPath = "/routes/revert"
+	RouteWeightsPath = "/routes/weights"
+)
+
+// RoutesStatus is the response of routes path
+type RoutesStatus struct {
+	Listeners []ListenerRoutes `json:"listeners"`
+}
+
+// ListenerRoutes is the effective route rules of the proxy on a listener
+type ListenerRoutes struct {
+	Name         string            `json:"name"`
+	Overridden   bool              `json:"overridden"` // route rules are updated at runtime
+	VirtualHosts []*v2.VirtualHost `json:"virtual_hosts"`
+}
+
+// GetRoutesStatus collects the effective route rules of all listeners, sorted by listener name
+func GetRoutesStatus() *RoutesStatus {
+	status := &RoutesStatus{Listeners: []ListenerRoutes{}}
+
+	for _, table := range router.RouteTables.List() {
+		status.Listeners = append(status.Listeners, ListenerRoutes{
+			Name:         table.ListenerName(),
+			Overridden:   table.Overridden(),
+			VirtualHosts: table.VirtualHosts(),
+		})
+	}
+
+	return status
+}
+
+func handleRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(GetRoutesStatus()); err != nil {
+		log.DefaultLogger.Errorf("write routes status failed: %v", err)
+	}
+}
+
+// handleRouteRule updates a route rule of a virtual host on the listener, the rule is identified by
+// listener, virtual_host and index in query. POST inserts the rule in body at index, or appends it
+// if no index given, PUT replaces the rule at index, and DELETE deletes it
+func handleRouteRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "POST, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+
+	query := r.URL.Query()
+	table, err := router.RouteTables.Get(query.Get("listener"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	index := -1
+	if value := query.Get("index"); value != "" {
+		if index, err = strconv.Atoi(value); err != nil || index < 0 {
+			http.Error(w, "invalid index "+value, http.StatusBadRequest)
+			return
+		}
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "index is required", http.StatusBadRequest)
+		return
+	}
+
+	virtualHost := query.Get("virtual_host")
+
+	if r.Method == http.MethodDelete {
+		err = table.DeleteRouter(virtualHost, index)
+	} else {
+		rule := v2.Router{}
+		if err = json.NewDecoder(r.Body).Decode(&rule); err == nil {
+			err = validateRouter(&rule)
+		}
+		if err != nil {
+			http.Error(w, "invalid route rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			err = table.AddRouter(virtualHost, index, rule)
+		} else {
+			err = table.ReplaceRouter(virtualHost, index, rule)
+		}
+	}
+
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+
+	log.DefaultLogger.Infof("route rule of listener %s virtual host %s updated by %s, index %d",
+		table.ListenerName(), virtualHost, r.Method, index)
+	w.Write([]byte("OK\n"))
+}
+
+// handleRoutesRevert restores the configured route rules of the listener
+func handleRoutesRevert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+
+	table, err := router.RouteTables.Get(r.URL.Query().Get("listener"))
+	if err == nil {
+		err = table.Revert()
+	}
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+
+	log.DefaultLogger.Infof("route rules of listener %s reverted", table.ListenerName())
+	w.Write([]byte("OK\n"))
+}
+
+// RouteWeights is the request body of route weights path
+type RouteWeights struct {
+	Weights []uint32 `json:"weights"` // in the order of the weighted clusters of the rule
+}
+
+// handleRouteWeights updates the weights of the weighted clusters of a route rule together, the rule is
+// identified by listener, virtual_host and index in query
+func handleRouteWeights(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", "PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+
+	query := r.URL.Query()
+	table, err := router.RouteTables.Get(query.Get("listener"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	value := query.Get("index")
+	index, err := strconv.Atoi(value)
+	if err != nil || index < 0 {
+		http.Error(w, "invalid index "+value, http.StatusBadRequest)
+		return
+	}
+
+	weights := RouteWeights{}
+	if err := json.NewDecoder(r.Body).Decode(&weights); err != nil {
+		http.Error(w, "invalid route weights: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	virtualHost := query.Get("virtual_host")
+	if err := table.UpdateClusterWeights(virtualHost, index, weights.Weights); err != nil {
+		writeRouteError(w, err)
+		return
+	}
+
+	log.DefaultLogger.Infof("cluster weights of listener %s virtual host %s index %d updated to %v",
+		table.ListenerName(), virtualHost, index, weights.Weights)
+	w.Write([]byte("OK\n"))
+}
+
+// validateRouter checks a route rule updated at runtime, which should match requests and route them to a cluster
+func validateRouter(rule *v2.Router) error {
+	if rule.Match.Prefix == "" && rule.Match.Path == "" && rule.Match.Regex == "" && len(rule.Match.Headers) == 0 {
+		return errors.New("no match in route rule")
+	}
+
+	if rule.Route.ClusterName == "" && len(rule.Route.WeightedClusters) == 0 {
+		return errors.New("no cluster in route rule")
+	}
+
+	return config.ParseRouter(rule)
+}
+
+func writeRouteError(w http.ResponseWriter, err error) {
+	switch err {
+	case router.ErrRouteTableNotFound, router.ErrVirtualHostNotFound, router.ErrRouterNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alipay/sofamosn/pkg/filter/stream/tap"
+	"github.com/alipay/sofamosn/pkg/log"
+)
+
+const TapPath = "/tap"
+
+// handleTap manages the tap session of tap filters. GET returns the status and records captured,
+// POST enables a new session with the config in body, and DELETE disables the current session
+func handleTap(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(tap.GetStatus()); err != nil {
+			log.DefaultLogger.Errorf("write tap status failed: %v", err)
+		}
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "text/plain")
+
+		config := tap.Config{}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, "invalid tap config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := tap.Enable(config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.DefaultLogger.Infof("tap enabled, class name %s, headers %v, max captures %d, path %s",
+			config.ClassName, config.Headers, config.MaxCaptures, config.Path)
+		w.Write([]byte("OK\n"))
+	case http.MethodDelete:
+		w.Header().Set("Content-Type", "text/plain")
+
+		if err := tap.Disable(); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		log.DefaultLogger.Infof("tap disabled")
+		w.Write([]byte("OK\n"))
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
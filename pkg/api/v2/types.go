@@ -18,6 +18,7 @@ package v2
 
 import (
 	"net"
+	"os"
 	"time"
 )
 
@@ -27,6 +28,8 @@ const (
 	DEFAULT_NETWORK_FILTER = "proxy"
 	RPC_PROXY              = "rpc_proxy"
 	X_PROXY                = "x_proxy"
+	TCP_PROXY              = "tcp_proxy"
+	REDIS_PROXY            = "redis_proxy"
 )
 
 const (
@@ -34,19 +37,41 @@ const (
 	ConnBufferLimitByte uint32 = 16 * 1024
 )
 
+// default settings of the connection pool to each upstream host
+const (
+	DefaultMaxConnectionsPerHost  uint32        = 1
+	DefaultConnPoolMaxWaitTime    time.Duration = time.Second
+	DefaultConnPoolPrewarmTimeout time.Duration = 3 * time.Second
+	DefaultDnsRefreshRate         time.Duration = 5 * time.Second
+)
+
 type ClusterType string
 
 const (
 	STATIC_CLUSTER  ClusterType = "STATIC"
 	SIMPLE_CLUSTER  ClusterType = "SIMPLE"
 	DYNAMIC_CLUSTER ClusterType = "DYNAMIC"
+	// hosts of STRICT_DNS cluster are resolved by hostname periodically
+	STRICT_DNS_CLUSTER ClusterType = "STRICT_DNS"
 )
 
 type LbType string
 
 const (
-	LB_RANDOM     LbType = "LB_RANDOM"
-	LB_ROUNDROBIN LbType = "LB_ROUNDROBIN"
+	LB_RANDOM              LbType = "LB_RANDOM"
+	LB_ROUNDROBIN          LbType = "LB_ROUNDROBIN"
+	LB_WEIGHTED_ROUNDROBIN LbType = "LB_WEIGHTED_ROUNDROBIN"
+	LB_CONSISTENT_HASH     LbType = "LB_CONSISTENT_HASH"
+	LB_LEAST_REQUEST       LbType = "LB_LEAST_REQUEST"
+)
+
+// LbFilterType is the policy narrowing the candidate hosts in a load balancer chain
+type LbFilterType string
+
+const (
+	LB_FILTER_SUBSET        LbFilterType = "SUBSET"
+	LB_FILTER_ZONE          LbFilterType = "ZONE"
+	LB_FILTER_LEAST_REQUEST LbFilterType = "LEAST_REQUEST"
 )
 
 type Cluster struct {
@@ -57,11 +82,79 @@ type Cluster struct {
 	ConnBufferLimitBytes uint32
 	CirBreThresholds     CircuitBreakers
 	OutlierDetection     OutlierDetection
+	ConnectionPool       ConnectionPool
 	HealthCheck          HealthCheck
 	Spec                 ClusterSpecInfo
 	LBSubSetConfig       LBSubsetConfig
+	ConsistentHash       ConsistentHashConfig
 	TLS                  TLSConfig
 	Hosts                []Host
+	// upstream connections not established within ConnectTimeout are failed, zero means no timeout
+	ConnectTimeout time.Duration
+	// bolt v2 switch bits turned on for the requests sent to the cluster
+	BoltSwitch byte
+	// bolt v2 content compression of the requests sent to the cluster
+	BoltCompression BoltCompression
+	// frames sent to the cluster are bolt v2 carrying crc32, and the responses without valid crc32 are rejected
+	ForceCrc bool
+	// heartbeats are sent on the bolt connections to the cluster every HeartbeatInterval, zero means no heartbeat
+	HeartbeatInterval time.Duration
+	// responses from the cluster exceeding the limits are rejected without buffering the body
+	ResponseLimits ResponseLimits
+	// weight of a newly added or recovered host ramps up within SlowStartWindow, zero means no slow start
+	SlowStartWindow time.Duration
+	// requests are pinned to a host by the affinity token if the header is configured
+	SessionAffinity SessionAffinityConfig
+	// hosts in the local zone are preferred if LocalZone is set
+	ZoneAware ZoneAwareConfig
+	// hostnames of STRICT_DNS cluster are re-resolved every DnsRefreshRate, or every DNS TTL if RespectDnsTTL
+	// is set and the TTL is known
+	DnsRefreshRate time.Duration
+	RespectDnsTTL  bool
+	// the candidate hosts are narrowed by LbChain in order if set, then the host is chosen by LbType
+	LbChain []LbFilterType
+	// protocol of the requests sent to the cluster, the upstream protocol of proxy is used if empty
+	UpstreamProtocol string
+	// requests sent to the cluster are paced to the rate if configured
+	RateLimit ClusterRateLimit
+	// response statuses retried on for the requests sent to the cluster, overriding the RetryOnStatus
+	// of the route retry policy if set
+	RetryOnStatus []int
+}
+
+// ClusterRateLimit paces the requests sent to a cluster to MaxRequestsPerSecond, requests over the rate
+// wait up to MaxQueueDelay and are shed if the wait would be longer, zero rate means no limit
+type ClusterRateLimit struct {
+	MaxRequestsPerSecond float64
+	MaxQueueDelay        time.Duration
+}
+
+// BoltFrameLimits are the max declared lengths in bolt frames, frames exceeding the limits
+// are rejected and the connection is closed
+type BoltFrameLimits struct {
+	MaxClassLen   int
+	MaxHeaderLen  int
+	MaxContentLen int
+	// an incomplete frame should be received in ReceiveTimeout, and the incomplete frames buffered
+	// on a connection should not exceed MaxPendingBytes, zero means no limit
+	ReceiveTimeout  time.Duration
+	MaxPendingBytes int
+	// frame buffers of codecs are pooled, buffers larger than MaxRetainedBufferSize are not kept
+	MaxRetainedBufferSize int
+}
+
+// ResponseLimits are the max declared lengths of the bolt responses from a cluster, within the bolt
+// frame limits, zero means no limit other than the frame limits
+type ResponseLimits struct {
+	MaxHeaderLen  int
+	MaxContentLen int
+}
+
+// BoltCompression compresses bolt v2 content longer than Threshold, Algorithm is the switch bit
+// of the algorithm, zero means no compression
+type BoltCompression struct {
+	Algorithm byte
+	Threshold int
 }
 
 type CircuitBreakers struct {
@@ -74,6 +167,15 @@ type Thresholds struct {
 	MaxPendingRequests uint32
 	MaxRequests        uint32
 	MaxRetries         uint32
+	// retries in flight are limited by the budget instead of MaxRetries if set
+	RetryBudget *RetryBudget
+}
+
+// RetryBudget limits the retries in flight to BudgetPercent of the active requests of the cluster,
+// at least MinRetryConcurrency retries are allowed
+type RetryBudget struct {
+	BudgetPercent       float64
+	MinRetryConcurrency uint32
 }
 
 type OutlierDetection struct {
@@ -90,6 +192,22 @@ type OutlierDetection struct {
 	SuccessRateStdevFactor             uint32
 }
 
+// ConnectionPool limits the connections to each upstream host of a cluster.
+// Requests are multiplexed on a connection up to MaxRequestPerConn of the cluster,
+// a new connection is created only if all connections are busy.
+type ConnectionPool struct {
+	MaxConnectionsPerHost uint32
+	// idle connections are closed after IdleTimeout, zero means never
+	IdleTimeout time.Duration
+	// when all connections are busy, fail the request at once instead of waiting for MaxWaitTime
+	FailFast    bool
+	MaxWaitTime time.Duration
+	// connections opened to each healthy host added to the cluster before serving traffic,
+	// readiness waits for them up to PrewarmTimeout
+	PrewarmConnections uint32
+	PrewarmTimeout     time.Duration
+}
+
 type RoutingPriority string
 
 const (
@@ -112,18 +230,34 @@ type ListenerConfig struct {
 	BindToPort                            bool
 	PerConnBufferLimitBytes               uint32
 	HandOffRestoredDestinationConnections bool
-	InheritListener                       *net.TCPListener // used in inherit case
+	InheritListener                       net.Listener // used in inherit case, *net.TCPListener or *net.UnixListener
 	Remain                                bool
 	LogPath                               string // log
 	LogLevel                              uint8
 	AccessLogs                            []AccessLog
 	DisableConnIo                         bool          // only used in http2 case
 	FilterChains                          []FilterChain // FilterChains
+	DrainTimeout                          time.Duration // max time to wait connections drained on listener update
+	WriteBufferLowWatermark               uint32
+	WriteBufferHighWatermark              uint32        // zero disables the write buffer watermarks
+	TCPKeepAlive                          time.Duration // keepalive period of accepted connections, zero uses the system default
+	DisableTCPNoDelay                     bool          // TCP_NODELAY is set on accepted connections by default
+	ReusePort                             bool          // SO_REUSEPORT is set on the listening socket
+	ProxyProtocol                         bool          // the PROXY protocol header is read on accepted connections
+	SocketMode                            os.FileMode   // permission of the socket file of unix listeners
+	MaxConnections                        uint32        // max connections of the listener, zero means no limit
+	MaxConnectionsPerIP                   uint32        // max connections from a source ip, zero means no limit
+	IdleTimeout                           time.Duration // connections read nothing for IdleTimeout are closed, zero means never
 }
 
 type AccessLog struct {
 	Path   string
 	Format string
+	// successful requests are logged at SuccessSampleRate if SampleSuccess, the request is sampled
+	// by the value of SampleHeader, non-success responses are always logged
+	SampleSuccess     bool
+	SuccessSampleRate float64
+	SampleHeader      string
 	// todo: add log filters
 }
 
@@ -142,6 +276,30 @@ type TLSConfig struct {
 	MaxVersion   string
 	ALPN         string
 	Ticket       string
+	// max number of upstream hosts whose tls sessions are cached for resumption,
+	// zero means DefaultSessionCacheSize of tls package, negative disables resumption
+	SessionCacheSize int
+}
+
+type TracingConfig struct {
+	Reporter           string
+	TraceIdHeader      string
+	SpanIdHeader       string
+	ParentSpanIdHeader string
+}
+
+// MetricsConfig selects the sink metrics are recorded to
+type MetricsConfig struct {
+	Sink          string
+	StatsdAddress string
+	StatsdPrefix  string
+	// grpc address of the OTLP receiver, such as an opentelemetry collector
+	OtlpEndpoint       string
+	OtlpExportInterval time.Duration
+	// resource attributes of the exported metrics
+	OtlpServiceName        string
+	OtlpInstanceId         string
+	OtlpResourceAttributes map[string]string
 }
 
 type TcpRoute struct {
@@ -155,6 +313,11 @@ type TcpProxy struct {
 	AccessLogs []*AccessLog
 }
 
+// RedisProxy shards redis commands to hosts of the cluster by key
+type RedisProxy struct {
+	Cluster string
+}
+
 type RpcRoute struct {
 	Name    string
 	Service string
@@ -167,7 +330,104 @@ type RpcProxy struct {
 
 type FaultInject struct {
 	DelayPercent  uint32
-	DelayDuration uint64
+	DelayDuration uint64 // nanoseconds
+	AbortPercent  uint32
+	AbortStatus   int16 // response status of the aborted requests
+	// only requests matching the header are injected, all requests are injected if the name is empty
+	Header HeaderMatcher
+}
+
+type HeaderMutation struct {
+	RequestHeadersToAdd     map[string]string
+	RequestHeadersToRemove  []string
+	ResponseHeadersToAdd    map[string]string
+	ResponseHeadersToRemove []string
+}
+
+type RateLimitKeyType string
+
+const (
+	RateLimitKeyGlobal  RateLimitKeyType = "global"
+	RateLimitKeyCluster RateLimitKeyType = "cluster"
+	RateLimitKeyHeader  RateLimitKeyType = "header"
+	// verified identity of the mTLS client certificate, such as a SPIFFE id
+	RateLimitKeyPeerIdentity RateLimitKeyType = "peer_identity"
+)
+
+type RateLimit struct {
+	Rate      float64 // requests per second
+	Burst     uint32
+	KeyType   RateLimitKeyType
+	HeaderKey string // used when KeyType is header
+	// buckets of keys not requested for the duration are evicted
+	IdleTimeout time.Duration
+}
+
+type ExtProc struct {
+	Address  string        // address of the external processing grpc service
+	Timeout  time.Duration // timeout of a processing call
+	FailOpen bool          // forward requests unmodified if the processing call fails
+	// only requests routed to the clusters are processed, all requests are processed if empty
+	Clusters []string
+}
+
+type ResponseCache struct {
+	ClassNames []string      // only requests of the classes are cached
+	KeyHeaders []string      // request headers in the cache key besides the class name
+	TTL        time.Duration // responses are served from cache until the ttl expires
+	MaxEntries int           // least recently used entries are evicted beyond the limit
+}
+
+type AuthzAction string
+
+const (
+	AuthzAllow AuthzAction = "allow"
+	AuthzDeny  AuthzAction = "deny"
+)
+
+// AuthzRule matches requests by globs, '*' matches any characters, empty matches all
+type AuthzRule struct {
+	Identity  string // verified identity of the mTLS client certificate, such as a SPIFFE id
+	ClassName string
+	Method    string
+	Action    AuthzAction
+}
+
+type Authz struct {
+	Rules         []AuthzRule // the first matching rule decides the action
+	DefaultAction AuthzAction // action of requests matching no rule
+	DenyStatus    int16       // response status of the denied requests
+}
+
+type RequestSize struct {
+	MaxRequestBytes uint64 // requests with larger content are rejected, overridden by the route
+	RejectStatus    int16  // response status of the rejected requests
+}
+
+// the in-flight requests limit adapts to the latency, between MinLimit and MaxLimit
+type ConcurrencyLimit struct {
+	MinLimit     uint32
+	MaxLimit     uint32        // also the initial limit
+	SampleWindow time.Duration // the limit is recomputed by the latency of requests done in each window
+	// requests are mapped to the classes by the value of PriorityHeader, the ones not mapped are of
+	// DefaultPriorityClass. No priority if no classes configured
+	PriorityHeader       string
+	PriorityClasses      []ConcurrencyPriorityClass
+	DefaultPriorityClass string
+}
+
+// ConcurrencyPriorityClass is admitted only while the in-flight requests are under LimitPercent of the limit,
+// so that under pressure the classes of lower percent are shed first
+type ConcurrencyPriorityClass struct {
+	Name         string
+	Values       []string // values of the priority header mapped to the class
+	LimitPercent uint32
+}
+
+// Tap is the static config of the tap filter, captures are enabled at runtime by admin api
+type Tap struct {
+	MaskHeaders []string // values of the headers are masked in captured records
+	MaskContent bool     // only the length of content is captured
 }
 
 type Proxy struct {
@@ -177,6 +437,32 @@ type Proxy struct {
 	BasicRoutes         []*BasicServiceRoute
 	VirtualHosts        []*VirtualHost
 	ValidateClusters    bool
+	// default timeout of requests carrying no timeout, e.g. bolt requests with timeout -1 or 0,
+	// it is used only if the route has no timeout either. zero means no timeout
+	RequestTimeout time.Duration `json:"-"`
+	// downstream connections without active request are closed after IdleTimeout, zero means never
+	IdleTimeout time.Duration `json:"-"`
+	// header carrying the correlation id of requests, which is generated if the request has none,
+	// empty means requests are not tagged
+	CorrelationIdHeader string `json:"-"`
+	// how the connections beginning with bytes of no registered protocol are handled,
+	// only sniffed if the downstream protocol is SofaRpc or Auto
+	UnknownProtocol UnknownProtocolPolicy `json:"-"`
+}
+
+type UnknownProtocolAction string
+
+const (
+	UnknownProtocolClose         UnknownProtocolAction = "close"
+	UnknownProtocolCloseSilently UnknownProtocolAction = "close_silently"
+	UnknownProtocolForward       UnknownProtocolAction = "forward"
+)
+
+// UnknownProtocolPolicy closes the connections of unknown protocol by default, with an error log
+// unless closed silently. Connections are forwarded as raw tcp to Cluster if Action is forward
+type UnknownProtocolPolicy struct {
+	Action  UnknownProtocolAction
+	Cluster string
 }
 
 type BasicServiceRoute struct {
@@ -188,9 +474,19 @@ type BasicServiceRoute struct {
 }
 
 type RetryPolicy struct {
-	RetryOn      bool
-	RetryTimeout time.Duration
-	NumRetries   uint32
+	RetryOn       bool
+	RetryTimeout  time.Duration
+	NumRetries    uint32
+	RetryOnStatus []int // response status codes to retry on, retry on 5xx if empty
+	// requests are idempotent, which are retried if the upstream connection is reset before any response
+	Idempotent bool
+}
+
+// service discovery pushing cluster hosts, Type selects the implementation
+type ServiceDiscovery struct {
+	Type            string
+	Path            string // hosts file of the file discovery
+	RefreshInterval time.Duration
 }
 
 type HealthCheck struct {
@@ -203,8 +499,13 @@ type HealthCheck struct {
 	UnhealthyThreshold uint32
 	CheckPath          string
 	ServiceName        string
+	// type of the check, the check of the protocol is used if empty
+	Type string
 }
 
+// GrpcHealthCheck checks Http2 hosts by grpc.health.v1.Health/Check of ServiceName
+const GrpcHealthCheck = "grpc"
+
 type HealthCheckFilter struct {
 	PassThrough                 bool
 	CacheTime                   time.Duration
@@ -248,6 +549,21 @@ type LBSubsetConfig struct {
 	SubsetSelectors [][]string        // {{keys,},}, used to create subsets of hosts, pre-computing, sorted
 }
 
+type ConsistentHashConfig struct {
+	HeaderKey        string `json:"header_key"`         // request header used as hash key
+	VirtualNodeCount uint32 `json:"virtual_node_count"` // virtual nodes per host on the hash ring
+}
+
+type SessionAffinityConfig struct {
+	Header string `json:"header"`           // header carrying the affinity token in requests and responses
+	Secret string `json:"secret,omitempty"` // secret signing the affinity token, generated randomly if empty
+}
+
+type ZoneAwareConfig struct {
+	LocalZone         string `json:"local_zone"`          // zone of mosn, compared with the zone in host metadata
+	MinHealthyPercent uint32 `json:"min_healthy_percent"` // requests spill to other zones if healthy local hosts drop below
+}
+
 type FilterChain struct {
 	FilterChainMatch string
 	TLS              TLSConfig
@@ -290,6 +606,8 @@ type RouterMatch struct {
 	CaseSensitive bool
 	Runtime       RuntimeUInt32
 	Headers       []HeaderMatcher
+	// the downstream source ip should be in one of the CIDRs, the longest prefix matched wins
+	SourceCIDRs []string `json:"source_cidrs,omitempty"`
 }
 
 type RouteAction struct {
@@ -299,6 +617,53 @@ type RouteAction struct {
 	MetadataMatch    Metadata
 	Timeout          time.Duration
 	RetryPolicy      *RetryPolicy
+	BoltConvert      *BoltConvert // used for http2 downstream and sofarpc upstream only
+	MirrorCluster    string       `json:"mirror_cluster,omitempty"` // shadow cluster receiving a copy of requests
+	MirrorPercent    uint32       `json:"mirror_percent,omitempty"` // percent of requests mirrored, 0~100
+	HedgePolicy      *HedgePolicy `json:"hedge_policy,omitempty"`
+	FailoverCluster  string       `json:"failover_cluster,omitempty"`  // cluster used if ClusterName has no healthy host
+	MaxRequestBytes  uint64       `json:"max_request_bytes,omitempty"` // overrides the limit of request_size filter
+	// timeouts like '500ms' of bolt requests carrying no timeout, keyed by class name or class name prefix
+	ClassTimeouts map[string]string `json:"class_timeouts,omitempty"`
+	// parsed from ClassTimeouts, sorted by the prefix length in descending order
+	ClassTimeoutPrefixes []ClassTimeout `json:"-"`
+	// headers added to or removed from the bolt header map of requests and responses, removed before added
+	RequestHeadersToAdd     []HeaderValueOption `json:"request_headers_to_add,omitempty"`
+	RequestHeadersToRemove  []string            `json:"request_headers_to_remove,omitempty"`
+	ResponseHeadersToAdd    []HeaderValueOption `json:"response_headers_to_add,omitempty"`
+	ResponseHeadersToRemove []string            `json:"response_headers_to_remove,omitempty"`
+}
+
+// HeaderValueOption is a header added by the route, the value overwrites the existing one,
+// or is appended to it separated by comma if Append is set
+type HeaderValueOption struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Append bool   `json:"append,omitempty"`
+}
+
+// ClassTimeout is the timeout of bolt requests whose class name starts with the prefix
+type ClassTimeout struct {
+	Prefix  string
+	Timeout time.Duration
+}
+
+// HedgePolicy sends a duplicate of the request to another host if no response is received
+// within the hedge delay, the first response is used and the other requests are cancelled
+type HedgePolicy struct {
+	// a duration like '50ms', or a percentile of the cluster request latency like 'p95'
+	HedgeDelay string `json:"hedge_delay"`
+	MaxHedges  uint32 `json:"max_hedges"` // max duplicates sent for a request
+	// parsed from HedgeDelay, only one of them is set
+	Delay           time.Duration `json:"-"`
+	DelayPercentile float64       `json:"-"` // 0~1
+}
+
+// BoltConvert configures how http2 requests are converted to bolt requests
+type BoltConvert struct {
+	ClassName  string   // class name of bolt requests, derived from path if empty
+	PathPrefix string   // prefix trimmed from path before deriving class name
+	Headers    []string // http2 headers copied into bolt header map, all headers are copied if empty
 }
 
 type WeightedCluster struct {
@@ -18,6 +18,7 @@ package config
 
 import (
 	"errors"
+	"sync"
 
 	pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	"github.com/alipay/sofamosn/pkg/api/v2"
@@ -28,14 +29,26 @@ import (
 	clusterAdapter "github.com/alipay/sofamosn/pkg/upstream/cluster"
 )
 
-func SetGlobalStreamFilter(globalStreamFilters []types.StreamFilterChainFactory) {
-	if streamFilter == nil {
-		streamFilter = globalStreamFilters
-	}
+// stream filters of the listeners, keyed by listener name. Listeners updated by xds keep
+// the stream filters of the listener with the same name, and have none if not found
+var (
+	listenerStreamFilters    = make(map[string][]types.StreamFilterChainFactory)
+	listenerStreamFiltersMux sync.RWMutex
+)
+
+func SetListenerStreamFilters(listenerName string, streamFilters []types.StreamFilterChainFactory) {
+	listenerStreamFiltersMux.Lock()
+	defer listenerStreamFiltersMux.Unlock()
+
+	listenerStreamFilters[listenerName] = streamFilters
 }
 
-// todo , no hack
-var streamFilter []types.StreamFilterChainFactory
+func GetListenerStreamFilters(listenerName string) []types.StreamFilterChainFactory {
+	listenerStreamFiltersMux.RLock()
+	defer listenerStreamFiltersMux.RUnlock()
+
+	return listenerStreamFilters[listenerName]
+}
 
 func (config *MOSNConfig) OnUpdateListeners(listeners []*pb.Listener) error {
 	for _, listener := range listeners {
@@ -67,7 +80,7 @@ func (config *MOSNConfig) OnUpdateListeners(listeners []*pb.Listener) error {
 		if server := server.GetServer(); server == nil {
 			log.DefaultLogger.Fatal("Server is nil and hasn't been initiated at this time")
 		} else {
-			if err := server.AddListenerAndStart(mosnListener, networkFilter, streamFilter); err == nil {
+			if err := server.AddListenerAndStart(mosnListener, networkFilter, GetListenerStreamFilters(mosnListener.Name)); err == nil {
 				log.DefaultLogger.Debugf("xds client update listener success,listener = %+v\n", mosnListener)
 			} else {
 				log.DefaultLogger.Errorf("xds client update listener error,listener = %+v\n", mosnListener)
@@ -47,6 +47,10 @@ type FilterConfig struct {
 type AccessLogConfig struct {
 	LogPath   string `json:"log_path,omitempty"`
 	LogFormat string `json:"log_format,omitempty"`
+
+	// successful requests are logged at the rate if configured, non-success responses are always logged
+	SuccessSampleRate *float64 `json:"success_sample_rate,omitempty"`
+	SampleHeader      string   `json:"sample_header,omitempty"`
 }
 
 type ListenerConfig struct {
@@ -68,6 +72,34 @@ type ListenerConfig struct {
 
 	// only used in http2 case
 	DisableConnIo bool `json:"disable_conn_io"`
+
+	// max time to wait connections drained on listener update
+	DrainTimeout DurationConfig `json:"drain_timeout,omitempty"`
+
+	// bytes buffered to write on a downstream connection, reading the upstreams is paused above
+	// the high watermark and resumed below the low watermark
+	WriteBufferHighWatermark uint32 `json:"write_buffer_high_watermark,omitempty"`
+	WriteBufferLowWatermark  uint32 `json:"write_buffer_low_watermark,omitempty"`
+
+	// tcp options, keepalive period and TCP_NODELAY are set on the accepted connections,
+	// SO_REUSEPORT is set on the listening socket so that multiple processes can listen on the same port
+	TCPKeepAlive DurationConfig `json:"tcp_keepalive,omitempty"`
+	TCPNoDelay   *bool          `json:"tcp_nodelay,omitempty"`
+	ReusePort    bool           `json:"reuse_port,omitempty"`
+
+	// the client address is read from the PROXY protocol header sent by the L4 load balancer
+	// before any data, connections without the header are closed
+	ProxyProtocol bool `json:"proxy_protocol,omitempty"`
+
+	// permission of the socket file in octal, e.g. "0660", only used by listeners on unix:// addresses
+	SocketMode string `json:"socket_mode,omitempty"`
+
+	// new connections beyond the limits are closed on accepted, zero means no limit
+	MaxConnections      uint32 `json:"max_connections,omitempty"`
+	MaxConnectionsPerIP uint32 `json:"max_connections_per_ip,omitempty"`
+
+	// connections read nothing for the timeout are closed unless a request is in processing
+	IdleTimeout DurationConfig `json:"idle_timeout,omitempty"`
 }
 
 type TLSConfig struct {
@@ -85,6 +117,8 @@ type TLSConfig struct {
 	MaxVersion   string `json:"maxversion,omitempty"`
 	ALPN         string `json:"alpn,omitempty"`
 	Ticket       string `json:"ticket,omitempty"`
+	// sessions of upstream hosts kept for resumption, zero means the default size, negative disables it
+	SessionCacheSize int `json:"session_cache_size,omitempty"`
 }
 
 type ServerConfig struct {
@@ -116,6 +150,22 @@ type ClusterHealthCheckConfig struct {
 	UnhealthyThreshold uint32         `json:"unhealthy_threshold"`
 	CheckPath          string         `json:"check_path,omitempty"`
 	ServiceName        string         `json:"service_name,omitempty"`
+	Type               string         `json:"type,omitempty"`
+}
+
+type ClusterOutlierDetectionConfig struct {
+	ConsecutiveErrors  uint32         `json:"consecutive_errors"`
+	BaseEjectionTime   DurationConfig `json:"base_ejection_time"`
+	MaxEjectionPercent uint32         `json:"max_ejection_percent"`
+}
+
+type ClusterConnectionPoolConfig struct {
+	MaxConnectionsPerHost uint32         `json:"max_connections_per_host,omitempty"`
+	IdleTimeout           DurationConfig `json:"idle_timeout,omitempty"`
+	FailFast              bool           `json:"fail_fast,omitempty"`
+	MaxWaitTime           DurationConfig `json:"max_wait_time,omitempty"`
+	PrewarmConnections    uint32         `json:"prewarm_connections,omitempty"`
+	PrewarmTimeout        DurationConfig `json:"prewarm_timeout,omitempty"`
 }
 
 type ClusterSpecConfig struct {
@@ -135,10 +185,40 @@ type ClusterConfig struct {
 	ConnBufferLimitBytes uint32
 	CircuitBreakers      []*CircuitBreakerdConfig `json:"circuit_breakers"`
 	HealthCheck          ClusterHealthCheckConfig `json:"health_check,omitempty"` //v2.HealthCheck
+	OutlierDetection     ClusterOutlierDetectionConfig `json:"outlier_detection,omitempty"`
+	ConnectionPool       ClusterConnectionPoolConfig   `json:"connection_pool,omitempty"`
 	ClusterSpecConfig    ClusterSpecConfig        `json:"spec,omitempty"`         //	ClusterSpecConfig
 	Hosts                []v2.Host                `json:"hosts,omitempty"`        //v2.Host
 	LBSubsetConfig       v2.LBSubsetConfig
+	ConsistentHash       v2.ConsistentHashConfig `json:"consistent_hash,omitempty"`
 	TLS                  TLSConfig `json:"tls_context,omitempty"`
+	ConnectTimeout       DurationConfig `json:"connect_timeout,omitempty"`
+	BoltSwitch           []string       `json:"bolt_switch,omitempty"`
+	BoltCompression      BoltCompressionConfig `json:"bolt_compression,omitempty"`
+	ForceCrc             bool                  `json:"force_crc,omitempty"`
+	HeartbeatInterval    DurationConfig        `json:"heartbeat_interval,omitempty"`
+	MaxResponseHeaderLen  int                  `json:"max_response_header_len,omitempty"`
+	MaxResponseContentLen int                  `json:"max_response_content_len,omitempty"`
+	SlowStartWindow      DurationConfig        `json:"slow_start_window,omitempty"`
+	SessionAffinity      v2.SessionAffinityConfig `json:"session_affinity,omitempty"`
+	ZoneAware            *v2.ZoneAwareConfig      `json:"zone_aware,omitempty"`
+	DnsRefreshRate       DurationConfig           `json:"dns_refresh_rate,omitempty"`
+	RespectDnsTTL        bool                     `json:"respect_dns_ttl,omitempty"`
+	LbChain              []string                 `json:"lb_chain,omitempty"`
+	UpstreamProtocol     string                   `json:"upstream_protocol,omitempty"`
+	RateLimit            *ClusterRateLimitConfig  `json:"rate_limit,omitempty"`
+	RetryOnStatus        []int                    `json:"retry_on_status,omitempty"`
+}
+
+// ClusterRateLimitConfig paces the requests sent to the cluster, zero max_queue_delay means the default one
+type ClusterRateLimitConfig struct {
+	MaxRequestsPerSecond float64        `json:"max_requests_per_second"`
+	MaxQueueDelay        DurationConfig `json:"max_queue_delay,omitempty"`
+}
+
+type BoltCompressionConfig struct {
+	Algorithm string `json:"algorithm,omitempty"`
+	Threshold int    `json:"threshold,omitempty"`
 }
 
 type CircuitBreakerdConfig struct {
@@ -147,6 +227,15 @@ type CircuitBreakerdConfig struct {
 	MaxPendingRequests uint32 `json:"max_pending_requests"`
 	MaxRequests        uint32 `json:"max_requests"`
 	MaxRetries         uint32 `json:"max_retries"`
+
+	RetryBudget *RetryBudgetConfig `json:"retry_budget,omitempty"`
+}
+
+// RetryBudgetConfig limits the retries in flight to a percentage of the active requests,
+// zero values mean the default ones
+type RetryBudgetConfig struct {
+	BudgetPercent       float64 `json:"budget_percent"`
+	MinRetryConcurrency uint32  `json:"min_retry_concurrency"`
 }
 
 type ClusterManagerConfig struct {
@@ -155,6 +244,85 @@ type ClusterManagerConfig struct {
 	// Note: this is a hack method to realize cluster's  health check which push by registry
 	RegistryUseHealthCheck bool            `json:"registry_use_health_check"`
 	Clusters               []ClusterConfig `json:"clusters,omitempty"`
+	// hosts of the clusters are updated by the service discovery if configured
+	ServiceDiscovery *ServiceDiscoveryConfig `json:"service_discovery,omitempty"`
+}
+
+type ServiceDiscoveryConfig struct {
+	Type            string         `json:"type"`
+	Path            string         `json:"path,omitempty"`
+	RefreshInterval DurationConfig `json:"refresh_interval,omitempty"`
+}
+
+type AdminConfig struct {
+	// address of the admin http server, which serves prometheus metrics on /metrics
+	Address string `json:"address,omitempty"`
+}
+
+// default tracing reporter and bolt header names of trace context
+const (
+	DefaultTracingReporter    = "log"
+	DefaultTraceIdHeader      = "trace_id"
+	DefaultSpanIdHeader       = "span_id"
+	DefaultParentSpanIdHeader = "parent_span_id"
+)
+
+// DefaultRateLimitIdleTimeout is the idle time after which the token bucket of a rate limit key is evicted
+const DefaultRateLimitIdleTimeout = 10 * time.Minute
+
+// default limits and sample window of concurrency limit filter
+const (
+	DefaultConcurrencyMinLimit     = 10
+	DefaultConcurrencyMaxLimit     = 1000
+	DefaultConcurrencySampleWindow = time.Second
+)
+
+// DefaultExtProcTimeout is the timeout of the call to the external processing service
+const DefaultExtProcTimeout = 200 * time.Millisecond
+
+// DefaultResponseCacheMaxEntries is the max number of responses cached by a response cache filter
+const DefaultResponseCacheMaxEntries = 1024
+
+// DefaultMetricsSink is used if no metrics sink configured
+const DefaultMetricsSink = "prometheus"
+
+// DefaultOtlpExportInterval is the interval metrics are exported by the otlp metrics sink
+const DefaultOtlpExportInterval = 10 * time.Second
+
+// DefaultOtlpServiceName is the service name resource attribute of metrics exported by the otlp metrics sink
+const DefaultOtlpServiceName = "mosn"
+
+type TracingConfig struct {
+	Enable             bool   `json:"enable,omitempty"`
+	Reporter           string `json:"reporter,omitempty"`
+	TraceIdHeader      string `json:"trace_id_header,omitempty"`
+	SpanIdHeader       string `json:"span_id_header,omitempty"`
+	ParentSpanIdHeader string `json:"parent_span_id_header,omitempty"`
+}
+
+// MetricsConfig selects the metrics sink, prometheus if not configured
+type MetricsConfig struct {
+	Sink          string `json:"sink,omitempty"`
+	StatsdAddress string `json:"statsd_address,omitempty"`
+	StatsdPrefix  string `json:"statsd_prefix,omitempty"`
+
+	OtlpEndpoint           string            `json:"otlp_endpoint,omitempty"`
+	OtlpExportInterval     DurationConfig    `json:"otlp_export_interval,omitempty"`
+	OtlpServiceName        string            `json:"otlp_service_name,omitempty"`
+	OtlpInstanceId         string            `json:"otlp_instance_id,omitempty"`
+	OtlpResourceAttributes map[string]string `json:"otlp_resource_attributes,omitempty"`
+}
+
+// BoltFrameLimitsConfig limits the declared lengths in bolt frames, defaults are used if not configured
+type BoltFrameLimitsConfig struct {
+	MaxClassLen   int `json:"max_class_len,omitempty"`
+	MaxHeaderLen  int `json:"max_header_len,omitempty"`
+	MaxContentLen int `json:"max_content_len,omitempty"`
+
+	ReceiveTimeout  DurationConfig `json:"receive_timeout,omitempty"`
+	MaxPendingBytes int            `json:"max_pending_bytes,omitempty"`
+
+	MaxRetainedBufferSize int `json:"max_retained_buffer_size,omitempty"`
 }
 
 type ServiceRegistryConfig struct {
@@ -177,7 +345,10 @@ type MOSNConfig struct {
 	Servers         []ServerConfig        `json:"servers,omitempty"`         //server config
 	ClusterManager  ClusterManagerConfig  `json:"cluster_manager,omitempty"` //cluster config
 	ServiceRegistry ServiceRegistryConfig `json:"service_registry"`          //service registry config, used by service discovery module
-	//tracing config
+	Admin           AdminConfig           `json:"admin,omitempty"`           //admin config, disabled if no address configured
+	Tracing         TracingConfig         `json:"tracing,omitempty"`         //tracing config
+	BoltFrameLimits BoltFrameLimitsConfig `json:"bolt_frame_limits,omitempty"` //limits of declared lengths in bolt frames
+	Metrics         MetricsConfig         `json:"metrics,omitempty"`           //metrics sink config
 	RawDynamicResources json.RawMessage `json:"dynamic_resources,omitempty"` //dynamic_resources raw message
 	RawStaticResources  json.RawMessage `json:"static_resources,omitempty"`  //static_resources raw message
 }
@@ -141,10 +141,22 @@ func convertClusterConfig(cluster v2.Cluster) ClusterConfig {
 		MaxRequestPerConn:    cluster.MaxRequestPerConn,
 		ConnBufferLimitBytes: cluster.ConnBufferLimitBytes,
 		HealthCheck:          convertClusterHealthCheck(cluster.HealthCheck),
+		ConnectionPool:       convertClusterConnectionPool(cluster.ConnectionPool),
 		ClusterSpecConfig:    convertClusterSpec(cluster.Spec),
 	}
 }
 
+func convertClusterConnectionPool(pool v2.ConnectionPool) ClusterConnectionPoolConfig {
+	return ClusterConnectionPoolConfig{
+		MaxConnectionsPerHost: pool.MaxConnectionsPerHost,
+		IdleTimeout:           DurationConfig{pool.IdleTimeout},
+		FailFast:              pool.FailFast,
+		MaxWaitTime:           DurationConfig{pool.MaxWaitTime},
+		PrewarmConnections:    pool.PrewarmConnections,
+		PrewarmTimeout:        DurationConfig{pool.PrewarmTimeout},
+	}
+}
+
 func convertClusterSpec(clusterSpec v2.ClusterSpecInfo) ClusterSpecConfig {
 	var specs []SubscribeSpecConfig
 
@@ -171,6 +183,7 @@ func convertClusterHealthCheck(cchc v2.HealthCheck) ClusterHealthCheckConfig {
 		IntervalJitter:     DurationConfig{cchc.IntervalJitter},
 		CheckPath:          cchc.CheckPath,
 		ServiceName:        cchc.ServiceName,
+		Type:               cchc.Type,
 	}
 }
 
@@ -18,13 +18,20 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"net"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network"
 	"github.com/alipay/sofamosn/pkg/server"
 	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/tls"
 
 	"time"
 )
@@ -36,6 +43,7 @@ var ProtocolsSupported = map[string]bool {
 	string(protocol.Http2):true,
 	string(protocol.Http1):true,
 	string(protocol.Xprotocol):true,
+	string(protocol.Auto):true,
 }
 
 // callback when corresponding module parsed
@@ -70,13 +78,23 @@ var (
 	}
 
 	clusterTypeMap = map[string]v2.ClusterType{
-		"SIMPLE":  v2.SIMPLE_CLUSTER,
-		"DYNAMIC": v2.DYNAMIC_CLUSTER,
+		"SIMPLE":     v2.SIMPLE_CLUSTER,
+		"DYNAMIC":    v2.DYNAMIC_CLUSTER,
+		"STRICT_DNS": v2.STRICT_DNS_CLUSTER,
 	}
 
 	lbTypeMap = map[string]v2.LbType{
-		"LB_RANDOM":     v2.LB_RANDOM,
-		"LB_ROUNDROBIN": v2.LB_ROUNDROBIN,
+		"LB_RANDOM":              v2.LB_RANDOM,
+		"LB_ROUNDROBIN":          v2.LB_ROUNDROBIN,
+		"LB_WEIGHTED_ROUNDROBIN": v2.LB_WEIGHTED_ROUNDROBIN,
+		"LB_CONSISTENT_HASH":     v2.LB_CONSISTENT_HASH,
+		"LB_LEAST_REQUEST":       v2.LB_LEAST_REQUEST,
+	}
+
+	lbFilterTypeMap = map[string]v2.LbFilterType{
+		"SUBSET":        v2.LB_FILTER_SUBSET,
+		"ZONE":          v2.LB_FILTER_ZONE,
+		"LEAST_REQUEST": v2.LB_FILTER_LEAST_REQUEST,
 	}
 )
 
@@ -119,6 +137,8 @@ func ParseProxyFilterJson(c *v2.Filter) *v2.Proxy {
 		log.StartLogger.Fatal("Invalid Downstream Protocol = ",proxyConfig.DownstreamProtocol)
 	} else if  _,ok := ProtocolsSupported[proxyConfig.UpstreamProtocol];!ok {
 		log.StartLogger.Fatal("Invalid Upstream Protocol = ",proxyConfig.UpstreamProtocol)
+	} else if proxyConfig.UpstreamProtocol == string(protocol.Auto) {
+		log.StartLogger.Fatal("Auto Protocol is Only Supported in Downstream")
 	}
 	
 	if !proxyConfig.SupportDynamicRoute {
@@ -135,14 +155,194 @@ func ParseProxyFilterJson(c *v2.Filter) *v2.Proxy {
 			if len(vh.Routers) == 0 {
 				log.StartLogger.Warnf("No Router Founded in VirtualHosts")
 			}
+
+			for i := range vh.Routers {
+				if err := ParseRouter(&vh.Routers[i]); err != nil {
+					log.StartLogger.Fatalln(err)
+				}
+			}
 		}
 	}
 
 	proxyConfig.BasicRoutes = ParseBasicFilter(proxyConfig)
+	proxyConfig.RequestTimeout = parseProxyDuration(c.Config, "request_timeout")
+	proxyConfig.IdleTimeout = parseProxyDuration(c.Config, "idle_timeout")
+
+	if header, ok := c.Config["correlation_id_header"]; ok {
+		if header, ok := header.(string); ok {
+			proxyConfig.CorrelationIdHeader = header
+		} else {
+			log.StartLogger.Fatalln("[correlation_id_header] in proxy filter config is not a string")
+		}
+	}
+
+	proxyConfig.UnknownProtocol = parseUnknownProtocol(c.Config, proxyConfig.DownstreamProtocol)
 
 	return proxyConfig
 }
 
+// parseUnknownProtocol parses the policy of connections of unknown protocol in proxy filter config, like
+// {"action": "forward", "cluster": "raw_tcp"}, connections are closed if not configured
+func parseUnknownProtocol(config map[string]interface{}, downstreamProtocol string) v2.UnknownProtocolPolicy {
+	policy := v2.UnknownProtocolPolicy{Action: v2.UnknownProtocolClose}
+
+	value, ok := config["unknown_protocol"]
+	if !ok {
+		return policy
+	}
+
+	if downstreamProtocol != string(protocol.SofaRpc) && downstreamProtocol != string(protocol.Auto) {
+		log.StartLogger.Fatalln("[unknown_protocol] in proxy filter config requires SofaRpc or Auto downstream protocol")
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.StartLogger.Fatalln("[unknown_protocol] in proxy filter config is not valid ,", err)
+	}
+
+	var c struct {
+		Action  string `json:"action"`
+		Cluster string `json:"cluster"`
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		log.StartLogger.Fatalln("[unknown_protocol] in proxy filter config is not valid ,", err)
+	}
+
+	switch action := v2.UnknownProtocolAction(c.Action); action {
+	case v2.UnknownProtocolClose, v2.UnknownProtocolCloseSilently:
+		if c.Cluster != "" {
+			log.StartLogger.Fatalln("[unknown_protocol.cluster] in proxy filter config is only used by forward action")
+		}
+		policy.Action = action
+	case v2.UnknownProtocolForward:
+		if c.Cluster == "" {
+			log.StartLogger.Fatalln("[unknown_protocol.cluster] in proxy filter config is required by forward action")
+		}
+		policy.Action, policy.Cluster = action, c.Cluster
+	default:
+		log.StartLogger.Fatalln("[unknown_protocol.action] in proxy filter config should be close, close_silently or forward, got:", c.Action)
+	}
+
+	return policy
+}
+
+// parseProxyDuration parses an optional duration in proxy filter config, like '30s'
+func parseProxyDuration(config map[string]interface{}, key string) time.Duration {
+	value, ok := config[key]
+	if !ok {
+		return 0
+	}
+
+	if value, ok := value.(string); ok {
+		if duration, error := time.ParseDuration(strings.Trim(value, `"`)); error == nil {
+			return duration
+		} else {
+			log.StartLogger.Fatalln("["+key+"] in proxy filter config is not valid ,", error)
+		}
+	} else {
+		log.StartLogger.Fatalln("[" + key + "] in proxy filter config is not a numeric string, like '30s'")
+	}
+
+	return 0
+}
+
+// ParseRouter validates the route rule and parses the hedge policy of it,
+// it is also used by the route rules updated at runtime
+func ParseRouter(router *v2.Router) error {
+	if router.Route.MirrorPercent > 100 {
+		return fmt.Errorf("Invalid Mirror Percent = %d", router.Route.MirrorPercent)
+	}
+
+	if failover := router.Route.FailoverCluster; failover != "" && failover == router.Route.ClusterName {
+		return fmt.Errorf("Invalid Failover Cluster = %s, same as the route cluster", failover)
+	}
+
+	if len(router.Route.WeightedClusters) > 0 {
+		if err := parseWeightedClusters(router.Route.WeightedClusters); err != nil {
+			return err
+		}
+	}
+
+	for _, cidr := range router.Match.SourceCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("Invalid Source CIDR = %s", cidr)
+		}
+	}
+
+	if router.Route.HedgePolicy != nil {
+		if err := parseHedgePolicy(router.Route.HedgePolicy); err != nil {
+			return err
+		}
+	}
+
+	return parseClassTimeouts(&router.Route)
+}
+
+// parseWeightedClusters checks the weighted clusters of a route, weights are relative and
+// normalized by their sum, so only a positive sum is required
+func parseWeightedClusters(weightedClusters []v2.WeightedCluster) error {
+	var total uint64
+
+	for _, weightedCluster := range weightedClusters {
+		if weightedCluster.Clusters.Name == "" {
+			return fmt.Errorf("Invalid Weighted Cluster, empty cluster name with weight %d", weightedCluster.Clusters.Weight)
+		}
+		total += uint64(weightedCluster.Clusters.Weight)
+	}
+
+	if total == 0 {
+		return fmt.Errorf("Invalid Weighted Clusters, sum of weights should be positive")
+	}
+
+	return nil
+}
+
+// parseClassTimeouts parses timeouts keyed by class name prefix, the longest prefix is matched first
+func parseClassTimeouts(route *v2.RouteAction) error {
+	route.ClassTimeoutPrefixes = nil
+
+	for prefix, value := range route.ClassTimeouts {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("[class_timeouts] of %s is not a valid duration, like '500ms' : %s", prefix, value)
+		}
+		route.ClassTimeoutPrefixes = append(route.ClassTimeoutPrefixes, v2.ClassTimeout{Prefix: prefix, Timeout: timeout})
+	}
+
+	sort.Slice(route.ClassTimeoutPrefixes, func(i, j int) bool {
+		return len(route.ClassTimeoutPrefixes[i].Prefix) > len(route.ClassTimeoutPrefixes[j].Prefix)
+	})
+
+	return nil
+}
+
+// parseHedgePolicy parses the hedge delay, which is a duration like '50ms',
+// or a percentile of the cluster request latency like 'p95'
+func parseHedgePolicy(policy *v2.HedgePolicy) error {
+	delay := policy.HedgeDelay
+
+	if strings.HasPrefix(delay, "p") {
+		percentile, err := strconv.ParseFloat(delay[1:], 64)
+		if err != nil || percentile <= 0 || percentile >= 100 {
+			return fmt.Errorf("[hedge_delay] in hedge policy is not a valid percentile, like 'p95' : %s", delay)
+		}
+		policy.DelayPercentile = percentile / 100
+	} else {
+		duration, err := time.ParseDuration(delay)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("[hedge_delay] in hedge policy is not a valid duration, like '50ms' : %s", delay)
+		}
+		policy.Delay = duration
+	}
+
+	// send one duplicate by default
+	if policy.MaxHedges == 0 {
+		policy.MaxHedges = 1
+	}
+
+	return nil
+}
+
 func GetServiceFromHeader(router *v2.Router) *v2.BasicServiceRoute {
 
 	if router == nil {
@@ -239,10 +439,26 @@ func ParseAccessConfig(c []AccessLogConfig) []v2.AccessLog {
 	var logs []v2.AccessLog
 
 	for _, logConfig := range c {
-		logs = append(logs, v2.AccessLog{
+		accessLog := v2.AccessLog{
 			Path:   logConfig.LogPath,
 			Format: logConfig.LogFormat,
-		})
+		}
+
+		if rate := logConfig.SuccessSampleRate; rate != nil {
+			if *rate < 0 || *rate > 1 {
+				log.StartLogger.Fatalln("[success_sample_rate] should be in [0, 1] in access log config:", logConfig.LogPath)
+			}
+
+			accessLog.SampleSuccess = true
+			accessLog.SuccessSampleRate = *rate
+			accessLog.SampleHeader = logConfig.SampleHeader
+			if accessLog.SampleHeader == "" {
+				// bolt request id, which is consistent in access logs of the request on the same connection
+				accessLog.SampleHeader = sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)
+			}
+		}
+
+		logs = append(logs, accessLog)
 	}
 
 	return logs
@@ -296,6 +512,99 @@ func ParseTLSConfig(tlsconfig *TLSConfig) v2.TLSConfig {
 		MaxVersion:   tlsconfig.MaxVersion,
 		ALPN:         tlsconfig.ALPN,
 		Ticket:       tlsconfig.Ticket,
+
+		SessionCacheSize: tlsconfig.SessionCacheSize,
+	}
+}
+
+// ParseTracingConfig returns nil if tracing is disabled, header names are set to defaults if not configured
+func ParseTracingConfig(c *TracingConfig) *v2.TracingConfig {
+	if !c.Enable {
+		return nil
+	}
+
+	tracing := &v2.TracingConfig{
+		Reporter:           c.Reporter,
+		TraceIdHeader:      c.TraceIdHeader,
+		SpanIdHeader:       c.SpanIdHeader,
+		ParentSpanIdHeader: c.ParentSpanIdHeader,
+	}
+
+	if tracing.Reporter == "" {
+		tracing.Reporter = DefaultTracingReporter
+	}
+	if tracing.TraceIdHeader == "" {
+		tracing.TraceIdHeader = DefaultTraceIdHeader
+	}
+	if tracing.SpanIdHeader == "" {
+		tracing.SpanIdHeader = DefaultSpanIdHeader
+	}
+	if tracing.ParentSpanIdHeader == "" {
+		tracing.ParentSpanIdHeader = DefaultParentSpanIdHeader
+	}
+
+	return tracing
+}
+
+// ParseMetricsConfig returns the metrics sink config, prometheus is used if no sink configured
+func ParseMetricsConfig(c *MetricsConfig) *v2.MetricsConfig {
+	metrics := &v2.MetricsConfig{
+		Sink:          c.Sink,
+		StatsdAddress: c.StatsdAddress,
+		StatsdPrefix:  c.StatsdPrefix,
+	}
+
+	switch metrics.Sink {
+	case "":
+		metrics.Sink = DefaultMetricsSink
+	case DefaultMetricsSink:
+	case "statsd":
+		if metrics.StatsdAddress == "" {
+			log.StartLogger.Fatalln("statsd address is required by statsd metrics sink")
+		}
+	case "otlp":
+		if c.OtlpEndpoint == "" {
+			log.StartLogger.Fatalln("otlp endpoint is required by otlp metrics sink")
+		}
+		if c.OtlpExportInterval.Duration < 0 {
+			log.StartLogger.Fatalln("otlp export interval is negative:", c.OtlpExportInterval.Duration)
+		}
+		metrics.OtlpEndpoint = c.OtlpEndpoint
+		metrics.OtlpExportInterval = c.OtlpExportInterval.Duration
+		metrics.OtlpServiceName = c.OtlpServiceName
+		metrics.OtlpInstanceId = c.OtlpInstanceId
+		metrics.OtlpResourceAttributes = c.OtlpResourceAttributes
+
+		if metrics.OtlpExportInterval == 0 {
+			metrics.OtlpExportInterval = DefaultOtlpExportInterval
+		}
+		if metrics.OtlpServiceName == "" {
+			metrics.OtlpServiceName = DefaultOtlpServiceName
+		}
+		if metrics.OtlpInstanceId == "" {
+			metrics.OtlpInstanceId, _ = os.Hostname()
+		}
+	default:
+		log.StartLogger.Fatalln("unknown metrics sink:", metrics.Sink)
+	}
+
+	return metrics
+}
+
+// ParseBoltFrameLimits returns the bolt frame limits, zero values mean defaults
+func ParseBoltFrameLimits(c *BoltFrameLimitsConfig) v2.BoltFrameLimits {
+	if c.MaxClassLen < 0 || c.MaxHeaderLen < 0 || c.MaxContentLen < 0 ||
+		c.ReceiveTimeout.Duration < 0 || c.MaxPendingBytes < 0 || c.MaxRetainedBufferSize < 0 {
+		log.StartLogger.Fatalln("bolt frame limits should not be negative:", *c)
+	}
+
+	return v2.BoltFrameLimits{
+		MaxClassLen:           c.MaxClassLen,
+		MaxHeaderLen:          c.MaxHeaderLen,
+		MaxContentLen:         c.MaxContentLen,
+		ReceiveTimeout:        c.ReceiveTimeout.Duration,
+		MaxPendingBytes:       c.MaxPendingBytes,
+		MaxRetainedBufferSize: c.MaxRetainedBufferSize,
 	}
 }
 
@@ -342,176 +651,884 @@ func ParseFaultInjectFilter(config map[string]interface{}) *v2.FaultInject {
 
 	faultInject := &v2.FaultInject{}
 
-	//percent
+	_, hasDelay := config["delay_percent"]
+	_, hasAbort := config["abort_percent"]
+	if !hasDelay && !hasAbort {
+		log.StartLogger.Fatalln("[delay_percent] or [abort_percent] is required in fault inject filter config")
+	}
+
+	//delay
 	if percent, ok := config["delay_percent"]; ok {
-		if percent, ok := percent.(float64); ok {
-			faultInject.DelayPercent = uint32(percent)
+		faultInject.DelayPercent = parseFaultPercent("delay_percent", percent)
+
+		if duration, ok := config["delay_duration"]; ok {
+			if duration, ok := duration.(string); ok {
+				if duration, error := time.ParseDuration(strings.Trim(duration, `"`)); error == nil {
+					faultInject.DelayDuration = uint64(duration)
+				} else {
+					log.StartLogger.Fatalln("[delay_duration] in fault inject filter config is not valid ,", error)
+				}
+			} else {
+				log.StartLogger.Fatalln("[delay_duration] in fault inject filter config is not a numeric string, like '30s'")
+			}
 		} else {
-			log.StartLogger.Fatalln("[delay_percent] in fault inject filter config is not integer")
+			log.StartLogger.Fatalln("[delay_duration] is required in fault inject filter config")
 		}
-	} else {
-		log.StartLogger.Fatalln("[delay_percent] is required in fault inject filter config")
 	}
 
-	//duration
-	if duration, ok := config["delay_duration"]; ok {
-		if duration, ok := duration.(string); ok {
-			if duration, error := time.ParseDuration(strings.Trim(duration, `"`)); error == nil {
-				faultInject.DelayDuration = uint64(duration)
+	//abort
+	if percent, ok := config["abort_percent"]; ok {
+		faultInject.AbortPercent = parseFaultPercent("abort_percent", percent)
+
+		if status, ok := config["abort_status"]; ok {
+			if status, ok := status.(float64); ok && status > 0 {
+				faultInject.AbortStatus = int16(status)
 			} else {
-				log.StartLogger.Fatalln("[delay_duration] in fault inject filter config is not valid ,", error)
+				log.StartLogger.Fatalln("[abort_status] in fault inject filter config is not a positive integer")
 			}
 		} else {
-			log.StartLogger.Fatalln("[delay_duration] in fault inject filter config is not a numeric string, like '30s'")
+			log.StartLogger.Fatalln("[abort_status] is required in fault inject filter config")
+		}
+	}
+
+	//header
+	if header, ok := config["header"]; ok {
+		if header, ok := header.(map[string]interface{}); ok {
+			faultInject.Header = parseFaultHeader(header)
+		} else {
+			log.StartLogger.Fatalln("[header] in fault inject filter config is not an object")
 		}
-	} else {
-		log.StartLogger.Fatalln("[delay_duration] is required in fault inject filter config")
 	}
 
 	return faultInject
 }
 
-func ParseHealthcheckFilter(config map[string]interface{}) *v2.HealthCheckFilter {
-	healthcheck := &v2.HealthCheckFilter{}
+func parseFaultPercent(name string, percent interface{}) uint32 {
+	if percent, ok := percent.(float64); ok && percent >= 0 && percent <= 100 {
+		return uint32(percent)
+	}
 
-	//passthrough
-	if passthrough, ok := config["passthrough"]; ok {
-		if passthrough, ok := passthrough.(bool); ok {
-			healthcheck.PassThrough = passthrough
-		} else {
-			log.StartLogger.Fatalln("[passthrough] in health check filter config is not bool")
-		}
+	log.StartLogger.Fatalf("[%s] in fault inject filter config is not an integer in [0, 100]", name)
+
+	return 0
+}
+
+func parseFaultHeader(config map[string]interface{}) v2.HeaderMatcher {
+	header := v2.HeaderMatcher{}
+
+	if name, ok := config["name"].(string); ok && name != "" {
+		header.Name = name
 	} else {
-		log.StartLogger.Fatalln("[passthrough] is required in healthcheck filter config")
+		log.StartLogger.Fatalln("[header.name] is required in fault inject filter config")
 	}
 
-	//cache time
-	if cacheTime, ok := config["cache_time"]; ok {
-		if cacheTime, ok := cacheTime.(string); ok {
-			if duration, error := time.ParseDuration(strings.Trim(cacheTime, `"`)); error == nil {
-				healthcheck.CacheTime = duration
-			} else {
-				log.StartLogger.Fatalln("[cache_time] in health check filter is not valid ,", error)
-			}
+	if value, ok := config["value"]; ok {
+		if value, ok := value.(string); ok {
+			header.Value = value
 		} else {
-			log.StartLogger.Fatalln("[cache_time] in health check filter config is not a numeric string")
+			log.StartLogger.Fatalln("[header.value] in fault inject filter config is not a string")
 		}
-	} else {
-		log.StartLogger.Fatalln("[cache_time] is required in healthcheck filter config")
 	}
 
-	//cluster_min_healthy_percentagesp
-	if clusterMinHealthyPercentage, ok := config["cluster_min_healthy_percentages"]; ok {
-		if clusterMinHealthyPercentage, ok := clusterMinHealthyPercentage.(map[string]interface{}); ok {
-			healthcheck.ClusterMinHealthyPercentage = make(map[string]float32)
-			for cluster, percent := range clusterMinHealthyPercentage {
-				healthcheck.ClusterMinHealthyPercentage[cluster] = float32(percent.(float64))
-			}
+	if regex, ok := config["regex"]; ok {
+		if regex, ok := regex.(bool); ok {
+			header.Regex = regex
 		} else {
-			log.StartLogger.Fatalln("[passthrough] in health check filter config is not bool")
+			log.StartLogger.Fatalln("[header.regex] in fault inject filter config is not a bool")
 		}
-	} else {
-		log.StartLogger.Fatalln("[passthrough] is required in healthcheck filter config")
 	}
-	return healthcheck
+
+	return header
 }
 
-func ParseListenerConfig(c *ListenerConfig, inheritListeners []*v2.ListenerConfig) *v2.ListenerConfig {
-	if c.Name == "" {
-		log.StartLogger.Fatalln("[name] is required in listener config")
-	}
+func ParseRateLimitFilter(config map[string]interface{}) *v2.RateLimit {
+	rateLimit := &v2.RateLimit{}
 
-	if c.Address == "" {
-		log.StartLogger.Fatalln("[Address] is required in listener config")
+	//rate
+	if rate, ok := config["rate"]; ok {
+		if rate, ok := rate.(float64); ok && rate > 0 {
+			rateLimit.Rate = rate
+		} else {
+			log.StartLogger.Fatalln("[rate] in rate limit filter config is not a positive number")
+		}
+	} else {
+		log.StartLogger.Fatalln("[rate] is required in rate limit filter config")
 	}
-	addr, err := net.ResolveTCPAddr("tcp", c.Address)
 
-	if err != nil {
-		log.StartLogger.Fatalln("[Address] not valid:" + c.Address)
+	//burst
+	if burst, ok := config["burst"]; ok {
+		if burst, ok := burst.(float64); ok {
+			rateLimit.Burst = uint32(burst)
+		} else {
+			log.StartLogger.Fatalln("[burst] in rate limit filter config is not integer")
+		}
 	}
 
-	//try inherit legacy listener
-	var old *net.TCPListener = nil
+	//key type
+	rateLimit.KeyType = v2.RateLimitKeyGlobal
+	if keyType, ok := config["key_type"]; ok {
+		if keyType, ok := keyType.(string); ok {
+			rateLimit.KeyType = v2.RateLimitKeyType(strings.ToLower(keyType))
+		} else {
+			log.StartLogger.Fatalln("[key_type] in rate limit filter config is not string")
+		}
+	}
 
-	for _, il := range inheritListeners {
-		if il.Addr.String() == addr.String() {
-			log.StartLogger.Infof("inherit listener addr: %s", c.Address)
-			old = il.InheritListener
-			il.Remain = true
-			break
+	switch rateLimit.KeyType {
+	case v2.RateLimitKeyGlobal, v2.RateLimitKeyCluster, v2.RateLimitKeyPeerIdentity:
+	case v2.RateLimitKeyHeader:
+		if headerKey, ok := config["header_key"].(string); ok && headerKey != "" {
+			rateLimit.HeaderKey = headerKey
+		} else {
+			log.StartLogger.Fatalln("[header_key] is required in rate limit filter config for key type:", rateLimit.KeyType)
 		}
+	default:
+		log.StartLogger.Fatalln("unsupported [key_type] in rate limit filter config:", rateLimit.KeyType)
 	}
 
-	return &v2.ListenerConfig{
-		Name:                                  c.Name,
-		Addr:                                  addr,
-		BindToPort:                            c.BindToPort,
-		InheritListener:                       old,
-		PerConnBufferLimitBytes:               1 << 15,
-		LogPath:                               c.LogPath,
-		LogLevel:                              uint8(ParseLogLevel(c.LogLevel)),
-		AccessLogs:                            ParseAccessConfig(c.AccessLogs),
-		DisableConnIo:                         c.DisableConnIo,
-		HandOffRestoredDestinationConnections: c.HandOffRestoredDestinationConnections,
-		FilterChains:                          ParseFilterChains(c.FilterChains),
+	//idle timeout
+	rateLimit.IdleTimeout = DefaultRateLimitIdleTimeout
+	if idleTimeout, ok := config["idle_timeout"]; ok {
+		if idleTimeout, ok := idleTimeout.(string); ok {
+			if duration, err := time.ParseDuration(idleTimeout); err == nil && duration > 0 {
+				rateLimit.IdleTimeout = duration
+			} else {
+				log.StartLogger.Fatalln("[idle_timeout] in rate limit filter config is not a positive duration:", idleTimeout)
+			}
+		} else {
+			log.StartLogger.Fatalln("[idle_timeout] in rate limit filter config is not string")
+		}
 	}
-}
 
-func ParseClusterConfig(clusters []ClusterConfig) ([]v2.Cluster, map[string][]v2.Host) {
-	var clustersV2 []v2.Cluster
-	clusterV2Map := make(map[string][]v2.Host)
+	return rateLimit
+}
 
-	for _, c := range clusters {
-		// cluster name
-		if c.Name == "" {
-			log.StartLogger.Fatalln("[name] is required in cluster config")
-		}
+func ParseExtProcFilter(config map[string]interface{}) *v2.ExtProc {
+	extProc := &v2.ExtProc{}
 
-		var clusterType v2.ClusterType
+	//address
+	if address, ok := config["address"].(string); ok && address != "" {
+		extProc.Address = address
+	} else {
+		log.StartLogger.Fatalln("[address] is required in ext proc filter config")
+	}
 
-		//cluster type
-		if c.Type == "" {
-			log.StartLogger.Fatalln("[type] is required in cluster config")
-		} else {
-			if ct, ok := clusterTypeMap[c.Type]; ok {
-				clusterType = ct
+	//timeout
+	extProc.Timeout = DefaultExtProcTimeout
+	if timeout, ok := config["timeout"]; ok {
+		if timeout, ok := timeout.(string); ok {
+			if duration, err := time.ParseDuration(timeout); err == nil && duration > 0 {
+				extProc.Timeout = duration
 			} else {
-				log.StartLogger.Fatalln("unknown cluster type:", c.Type)
+				log.StartLogger.Fatalln("[timeout] in ext proc filter config is not a positive duration:", timeout)
 			}
+		} else {
+			log.StartLogger.Fatalln("[timeout] in ext proc filter config is not string")
 		}
+	}
 
-		var lbType v2.LbType
-
-		if c.LbType == "" {
-			log.StartLogger.Fatalln("[lb_type] is required in cluster config")
+	//fail open
+	if failOpen, ok := config["fail_open"]; ok {
+		if failOpen, ok := failOpen.(bool); ok {
+			extProc.FailOpen = failOpen
 		} else {
-			if lt, ok := lbTypeMap[c.LbType]; ok {
-				lbType = lt
-			} else {
-				log.StartLogger.Fatalln("unknown lb type:", c.LbType)
-			}
+			log.StartLogger.Fatalln("[fail_open] in ext proc filter config is not a bool")
 		}
+	}
 
-		if c.MaxRequestPerConn == 0 {
-			c.MaxRequestPerConn = 1024
-			log.StartLogger.Infof("[max_request_per_conn] is not specified, use default value %d", 1024)
+	//clusters
+	if clusters, ok := config["clusters"]; ok {
+		if clusters, ok := clusters.([]interface{}); ok {
+			for _, cluster := range clusters {
+				if cluster, ok := cluster.(string); ok && cluster != "" {
+					extProc.Clusters = append(extProc.Clusters, cluster)
+				} else {
+					log.StartLogger.Fatalln("[clusters] in ext proc filter config is not a list of cluster names")
+				}
+			}
+		} else {
+			log.StartLogger.Fatalln("[clusters] in ext proc filter config is not a list")
 		}
+	}
 
-		if c.ConnBufferLimitBytes == 0 {
-			c.ConnBufferLimitBytes = 16 * 1026
-			log.StartLogger.Infof("[conn_buffer_limit_bytes] is not specified, use default value %d", 1024*16)
-		}
+	return extProc
+}
 
-		//clusterSpec := c.ClusterSpecConfig.(ClusterSpecConfig)
-		clusterSpec := c.ClusterSpecConfig
+func ParseResponseCacheFilter(config map[string]interface{}) *v2.ResponseCache {
+	responseCache := &v2.ResponseCache{
+		ClassNames: parseStringList(config, "class_names", "response cache"),
+		KeyHeaders: parseStringList(config, "key_headers", "response cache"),
+	}
 
-		// checkout LBSubsetConfig
-		if c.LBSubsetConfig.FallBackPolicy > 2 {
-			log.StartLogger.Panic("lb subset config 's fall back policy set error. " +
-				"For 0, represent NO_FALLBACK" +
-				"For 1, reprenst ANY_ENDPOINT" +
-				"For 2, reprenst DEFAULT_SUBSET")
-		}
+	if len(responseCache.ClassNames) == 0 {
+		log.StartLogger.Fatalln("[class_names] is required in response cache filter config")
+	}
+
+	//ttl
+	if ttl, ok := config["ttl"].(string); ok {
+		if duration, err := time.ParseDuration(ttl); err == nil && duration > 0 {
+			responseCache.TTL = duration
+		} else {
+			log.StartLogger.Fatalln("[ttl] in response cache filter config is not a positive duration:", ttl)
+		}
+	} else {
+		log.StartLogger.Fatalln("[ttl] is required in response cache filter config")
+	}
+
+	//max entries
+	responseCache.MaxEntries = DefaultResponseCacheMaxEntries
+	if maxEntries, ok := config["max_entries"]; ok {
+		if maxEntries, ok := maxEntries.(float64); ok && maxEntries >= 1 {
+			responseCache.MaxEntries = int(maxEntries)
+		} else {
+			log.StartLogger.Fatalln("[max_entries] in response cache filter config is not a positive integer")
+		}
+	}
+
+	return responseCache
+}
+
+func ParseAuthzFilter(config map[string]interface{}) *v2.Authz {
+	authz := &v2.Authz{
+		DefaultAction: parseAuthzAction(config, "default_action", v2.AuthzDeny),
+		DenyStatus:    sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION,
+	}
+
+	//rules
+	if rules, ok := config["rules"]; ok {
+		if rules, ok := rules.([]interface{}); ok {
+			for _, rule := range rules {
+				if rule, ok := rule.(map[string]interface{}); ok {
+					authz.Rules = append(authz.Rules, parseAuthzRule(rule))
+				} else {
+					log.StartLogger.Fatalln("[rules] in authz filter config is not a list of objects")
+				}
+			}
+		} else {
+			log.StartLogger.Fatalln("[rules] in authz filter config is not a list")
+		}
+	}
+
+	//deny status
+	if status, ok := config["deny_status"]; ok {
+		if status, ok := status.(float64); ok && status > 0 {
+			authz.DenyStatus = int16(status)
+		} else {
+			log.StartLogger.Fatalln("[deny_status] in authz filter config is not a positive integer")
+		}
+	}
+
+	return authz
+}
+
+func ParseRequestSizeFilter(config map[string]interface{}) *v2.RequestSize {
+	requestSize := &v2.RequestSize{
+		RejectStatus: sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION,
+	}
+
+	//max request bytes, requests are only checked by the routes configuring it if not set
+	if maxBytes, ok := config["max_request_bytes"]; ok {
+		if maxBytes, ok := maxBytes.(float64); ok && maxBytes > 0 {
+			requestSize.MaxRequestBytes = uint64(maxBytes)
+		} else {
+			log.StartLogger.Fatalln("[max_request_bytes] in request size filter config is not a positive integer")
+		}
+	}
+
+	//reject status
+	if status, ok := config["reject_status"]; ok {
+		if status, ok := status.(float64); ok && status > 0 {
+			requestSize.RejectStatus = int16(status)
+		} else {
+			log.StartLogger.Fatalln("[reject_status] in request size filter config is not a positive integer")
+		}
+	}
+
+	return requestSize
+}
+
+func ParseConcurrencyLimitFilter(config map[string]interface{}) *v2.ConcurrencyLimit {
+	concurrencyLimit := &v2.ConcurrencyLimit{
+		MinLimit:     DefaultConcurrencyMinLimit,
+		MaxLimit:     DefaultConcurrencyMaxLimit,
+		SampleWindow: DefaultConcurrencySampleWindow,
+	}
+
+	//min and max limit
+	for key, value := range map[string]*uint32{
+		"min_limit": &concurrencyLimit.MinLimit,
+		"max_limit": &concurrencyLimit.MaxLimit,
+	} {
+		if limit, ok := config[key]; ok {
+			if limit, ok := limit.(float64); ok && limit >= 1 {
+				*value = uint32(limit)
+			} else {
+				log.StartLogger.Fatalf("[%s] in concurrency limit filter config is not a positive integer", key)
+			}
+		}
+	}
+
+	if concurrencyLimit.MinLimit > concurrencyLimit.MaxLimit {
+		log.StartLogger.Fatalln("[min_limit] in concurrency limit filter config is larger than [max_limit]")
+	}
+
+	//sample window
+	if window, ok := config["sample_window"]; ok {
+		if window, ok := window.(string); ok {
+			if duration, err := time.ParseDuration(window); err == nil && duration > 0 {
+				concurrencyLimit.SampleWindow = duration
+			} else {
+				log.StartLogger.Fatalln("[sample_window] in concurrency limit filter config is not a positive duration:", window)
+			}
+		} else {
+			log.StartLogger.Fatalln("[sample_window] in concurrency limit filter config is not string")
+		}
+	}
+
+	parseConcurrencyPriority(config, concurrencyLimit)
+
+	return concurrencyLimit
+}
+
+// parseConcurrencyPriority parses the priority classes of the concurrency limit filter, the default class
+// is the one of the lowest limit percent if not configured
+func parseConcurrencyPriority(config map[string]interface{}, concurrencyLimit *v2.ConcurrencyLimit) {
+	if classes, ok := config["priority_classes"]; ok {
+		if classes, ok := classes.([]interface{}); ok {
+			for _, class := range classes {
+				if class, ok := class.(map[string]interface{}); ok {
+					concurrencyLimit.PriorityClasses = append(concurrencyLimit.PriorityClasses, parseConcurrencyPriorityClass(class))
+				} else {
+					log.StartLogger.Fatalln("[priority_classes] in concurrency limit filter config is not a list of objects")
+				}
+			}
+		} else {
+			log.StartLogger.Fatalln("[priority_classes] in concurrency limit filter config is not a list")
+		}
+	}
+
+	for key, value := range map[string]*string{
+		"priority_header":        &concurrencyLimit.PriorityHeader,
+		"default_priority_class": &concurrencyLimit.DefaultPriorityClass,
+	} {
+		if v, ok := config[key]; ok {
+			if v, ok := v.(string); ok && v != "" {
+				*value = v
+			} else {
+				log.StartLogger.Fatalf("[%s] in concurrency limit filter config is not a string", key)
+			}
+		}
+	}
+
+	if len(concurrencyLimit.PriorityClasses) == 0 {
+		if concurrencyLimit.PriorityHeader != "" || concurrencyLimit.DefaultPriorityClass != "" {
+			log.StartLogger.Fatalln("[priority_classes] is required in concurrency limit filter config with priority")
+		}
+		return
+	}
+
+	if concurrencyLimit.PriorityHeader == "" {
+		log.StartLogger.Fatalln("[priority_header] is required in concurrency limit filter config with priority classes")
+	}
+
+	names := make(map[string]bool)
+	values := make(map[string]bool)
+	lowest := concurrencyLimit.PriorityClasses[0]
+	for _, class := range concurrencyLimit.PriorityClasses {
+		if names[class.Name] {
+			log.StartLogger.Fatalf("[priority_classes] in concurrency limit filter config has duplicate class %s", class.Name)
+		}
+		names[class.Name] = true
+
+		for _, value := range class.Values {
+			if values[value] {
+				log.StartLogger.Fatalf("[priority_classes] in concurrency limit filter config maps value %s to multiple classes", value)
+			}
+			values[value] = true
+		}
+
+		if class.LimitPercent < lowest.LimitPercent {
+			lowest = class
+		}
+	}
+
+	if concurrencyLimit.DefaultPriorityClass == "" {
+		concurrencyLimit.DefaultPriorityClass = lowest.Name
+	} else if !names[concurrencyLimit.DefaultPriorityClass] {
+		log.StartLogger.Fatalf("[default_priority_class] in concurrency limit filter config is not a class: %s", concurrencyLimit.DefaultPriorityClass)
+	}
+}
+
+func parseConcurrencyPriorityClass(config map[string]interface{}) v2.ConcurrencyPriorityClass {
+	class := v2.ConcurrencyPriorityClass{
+		Values: parseStringList(config, "values", "concurrency limit"),
+	}
+
+	if name, ok := config["name"].(string); ok && name != "" {
+		class.Name = name
+	} else {
+		log.StartLogger.Fatalln("[priority_classes.name] in concurrency limit filter config is not a string")
+	}
+
+	if percent, ok := config["limit_percent"].(float64); ok && percent >= 1 && percent <= 100 {
+		class.LimitPercent = uint32(percent)
+	} else {
+		log.StartLogger.Fatalf("[priority_classes.limit_percent] of class %s in concurrency limit filter config is not an integer in [1, 100]", class.Name)
+	}
+
+	return class
+}
+
+func ParseTapFilter(config map[string]interface{}) *v2.Tap {
+	tap := &v2.Tap{
+		MaskHeaders: parseStringList(config, "mask_headers", "tap"),
+	}
+
+	//mask content
+	if maskContent, ok := config["mask_content"]; ok {
+		if maskContent, ok := maskContent.(bool); ok {
+			tap.MaskContent = maskContent
+		} else {
+			log.StartLogger.Fatalln("[mask_content] in tap filter config is not bool")
+		}
+	}
+
+	return tap
+}
+
+func parseAuthzRule(config map[string]interface{}) v2.AuthzRule {
+	rule := v2.AuthzRule{}
+
+	for key, value := range map[string]*string{
+		"identity":   &rule.Identity,
+		"class_name": &rule.ClassName,
+		"method":     &rule.Method,
+	} {
+		if v, ok := config[key]; ok {
+			if v, ok := v.(string); ok {
+				*value = v
+			} else {
+				log.StartLogger.Fatalf("[rules.%s] in authz filter config is not a string", key)
+			}
+		}
+	}
+
+	if _, ok := config["action"]; !ok {
+		log.StartLogger.Fatalln("[rules.action] is required in authz filter config")
+	}
+	rule.Action = parseAuthzAction(config, "action", "")
+
+	return rule
+}
+
+func parseAuthzAction(config map[string]interface{}, key string, defaultAction v2.AuthzAction) v2.AuthzAction {
+	action, ok := config[key]
+	if !ok {
+		return defaultAction
+	}
+
+	if action, ok := action.(string); ok {
+		switch v2.AuthzAction(strings.ToLower(action)) {
+		case v2.AuthzAllow:
+			return v2.AuthzAllow
+		case v2.AuthzDeny:
+			return v2.AuthzDeny
+		}
+	}
+
+	log.StartLogger.Fatalf("[%s] in authz filter config is not allow or deny", key)
+
+	return defaultAction
+}
+
+// parseStringList parses an optional list of non-empty strings in the filter config
+func parseStringList(config map[string]interface{}, key string, filterName string) []string {
+	var list []string
+
+	if values, ok := config[key]; ok {
+		if values, ok := values.([]interface{}); ok {
+			for _, value := range values {
+				if value, ok := value.(string); ok && value != "" {
+					list = append(list, value)
+				} else {
+					log.StartLogger.Fatalf("[%s] in %s filter config is not a list of strings", key, filterName)
+				}
+			}
+		} else {
+			log.StartLogger.Fatalf("[%s] in %s filter config is not a list", key, filterName)
+		}
+	}
+
+	return list
+}
+
+func ParseHeaderMutationFilter(config map[string]interface{}) *v2.HeaderMutation {
+	headerMutation := &v2.HeaderMutation{
+		RequestHeadersToAdd:     parseHeadersToAdd(config, "request_headers_to_add"),
+		RequestHeadersToRemove:  parseHeadersToRemove(config, "request_headers_to_remove"),
+		ResponseHeadersToAdd:    parseHeadersToAdd(config, "response_headers_to_add"),
+		ResponseHeadersToRemove: parseHeadersToRemove(config, "response_headers_to_remove"),
+	}
+
+	return headerMutation
+}
+
+func parseHeadersToAdd(config map[string]interface{}, key string) map[string]string {
+	headers, ok := config[key]
+	if !ok {
+		return nil
+	}
+
+	headersMap, ok := headers.(map[string]interface{})
+	if !ok {
+		log.StartLogger.Fatalf("[%s] in header mutation filter config is not a map", key)
+	}
+
+	result := make(map[string]string, len(headersMap))
+	for name, value := range headersMap {
+		if value, ok := value.(string); ok {
+			result[name] = value
+		} else {
+			log.StartLogger.Fatalf("value of header [%s] in [%s] is not string", name, key)
+		}
+	}
+
+	return result
+}
+
+func parseHeadersToRemove(config map[string]interface{}, key string) []string {
+	headers, ok := config[key]
+	if !ok {
+		return nil
+	}
+
+	headersList, ok := headers.([]interface{})
+	if !ok {
+		log.StartLogger.Fatalf("[%s] in header mutation filter config is not a list", key)
+	}
+
+	var result []string
+	for _, name := range headersList {
+		if name, ok := name.(string); ok {
+			result = append(result, name)
+		} else {
+			log.StartLogger.Fatalf("header name in [%s] is not string", key)
+		}
+	}
+
+	return result
+}
+
+func ParseTcpProxy(config map[string]interface{}) *v2.TcpProxy {
+	tcpProxy := &v2.TcpProxy{}
+
+	routes, ok := config["routes"]
+	if !ok {
+		log.StartLogger.Fatalln("[routes] is required in tcp proxy filter config")
+	}
+
+	routeList, ok := routes.([]interface{})
+	if !ok {
+		log.StartLogger.Fatalln("[routes] in tcp proxy filter config is not list")
+	}
+
+	for _, r := range routeList {
+		routeConfig, ok := r.(map[string]interface{})
+		if !ok {
+			log.StartLogger.Fatalln("[route] in tcp proxy filter config is not object")
+		}
+
+		route := &v2.TcpRoute{}
+
+		if cluster, ok := routeConfig["cluster"].(string); ok && cluster != "" {
+			route.Cluster = cluster
+		} else {
+			log.StartLogger.Fatalln("[cluster] is required in tcp proxy route config")
+		}
+
+		route.SourceAddrs = parseTcpRouteAddrs(routeConfig, "source_addrs")
+		route.DestinationAddrs = parseTcpRouteAddrs(routeConfig, "destination_addrs")
+
+		tcpProxy.Routes = append(tcpProxy.Routes, route)
+	}
+
+	return tcpProxy
+}
+
+func ParseRedisProxy(config map[string]interface{}) *v2.RedisProxy {
+	redisProxy := &v2.RedisProxy{}
+
+	if cluster, ok := config["cluster"].(string); ok && cluster != "" {
+		redisProxy.Cluster = cluster
+	} else {
+		log.StartLogger.Fatalln("[cluster] is required in redis proxy filter config")
+	}
+
+	return redisProxy
+}
+
+func parseTcpRouteAddrs(routeConfig map[string]interface{}, key string) []net.Addr {
+	var addrs []net.Addr
+
+	values, ok := routeConfig[key]
+	if !ok {
+		return addrs
+	}
+
+	valueList, ok := values.([]interface{})
+	if !ok {
+		log.StartLogger.Fatalln("[", key, "] in tcp proxy route config is not list")
+	}
+
+	for _, v := range valueList {
+		address, ok := v.(string)
+		if !ok {
+			log.StartLogger.Fatalln("[", key, "] in tcp proxy route config is not string list")
+		}
+
+		addr, err := net.ResolveTCPAddr("tcp", address)
+		if err != nil {
+			log.StartLogger.Fatalln("[", key, "] in tcp proxy route config is not valid ,", err)
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	return addrs
+}
+
+func ParseHealthcheckFilter(config map[string]interface{}) *v2.HealthCheckFilter {
+	healthcheck := &v2.HealthCheckFilter{}
+
+	//passthrough
+	if passthrough, ok := config["passthrough"]; ok {
+		if passthrough, ok := passthrough.(bool); ok {
+			healthcheck.PassThrough = passthrough
+		} else {
+			log.StartLogger.Fatalln("[passthrough] in health check filter config is not bool")
+		}
+	} else {
+		log.StartLogger.Fatalln("[passthrough] is required in healthcheck filter config")
+	}
+
+	//cache time
+	if cacheTime, ok := config["cache_time"]; ok {
+		if cacheTime, ok := cacheTime.(string); ok {
+			if duration, error := time.ParseDuration(strings.Trim(cacheTime, `"`)); error == nil {
+				healthcheck.CacheTime = duration
+			} else {
+				log.StartLogger.Fatalln("[cache_time] in health check filter is not valid ,", error)
+			}
+		} else {
+			log.StartLogger.Fatalln("[cache_time] in health check filter config is not a numeric string")
+		}
+	} else {
+		log.StartLogger.Fatalln("[cache_time] is required in healthcheck filter config")
+	}
+
+	//cluster_min_healthy_percentagesp
+	if clusterMinHealthyPercentage, ok := config["cluster_min_healthy_percentages"]; ok {
+		if clusterMinHealthyPercentage, ok := clusterMinHealthyPercentage.(map[string]interface{}); ok {
+			healthcheck.ClusterMinHealthyPercentage = make(map[string]float32)
+			for cluster, percent := range clusterMinHealthyPercentage {
+				healthcheck.ClusterMinHealthyPercentage[cluster] = float32(percent.(float64))
+			}
+		} else {
+			log.StartLogger.Fatalln("[passthrough] in health check filter config is not bool")
+		}
+	} else {
+		log.StartLogger.Fatalln("[passthrough] is required in healthcheck filter config")
+	}
+	return healthcheck
+}
+
+func ParseListenerConfig(c *ListenerConfig, inheritListeners []*v2.ListenerConfig) *v2.ListenerConfig {
+	if c.Name == "" {
+		log.StartLogger.Fatalln("[name] is required in listener config")
+	}
+
+	if c.Address == "" {
+		log.StartLogger.Fatalln("[Address] is required in listener config")
+	}
+	addr, err := network.ResolveAddr(c.Address)
+
+	if err != nil {
+		log.StartLogger.Fatalln("[Address] not valid:" + c.Address)
+	}
+
+	//try inherit legacy listener
+	var old net.Listener = nil
+
+	for _, il := range inheritListeners {
+		if il.Addr.String() == addr.String() {
+			log.StartLogger.Infof("inherit listener addr: %s", c.Address)
+			old = il.InheritListener
+			il.Remain = true
+			break
+		}
+	}
+
+	lowWatermark := c.WriteBufferLowWatermark
+	if c.WriteBufferHighWatermark > 0 {
+		if lowWatermark == 0 {
+			lowWatermark = c.WriteBufferHighWatermark / 2
+		}
+
+		if lowWatermark >= c.WriteBufferHighWatermark {
+			log.StartLogger.Fatalln("[write_buffer_low_watermark] should be less than [write_buffer_high_watermark] in listener config")
+		}
+	}
+
+	if c.TCPKeepAlive.Duration < 0 {
+		log.StartLogger.Fatalln("[tcp_keepalive] should not be negative in listener config:", c.Name)
+	}
+
+	if c.TCPKeepAlive.Duration > 0 && c.TCPKeepAlive.Duration < time.Second {
+		log.StartLogger.Fatalln("[tcp_keepalive] should not be less than 1s in listener config:", c.Name)
+	}
+
+	// the options are set on the sockets accepted or listened by mosn
+	if !c.BindToPort && (c.TCPKeepAlive.Duration > 0 || c.TCPNoDelay != nil || c.ReusePort) {
+		log.StartLogger.Fatalln("tcp options require [bind_port] in listener config:", c.Name)
+	}
+
+	if !c.BindToPort && c.ProxyProtocol {
+		log.StartLogger.Fatalln("[proxy_protocol] requires [bind_port] in listener config:", c.Name)
+	}
+
+	if c.IdleTimeout.Duration < 0 {
+		log.StartLogger.Fatalln("[idle_timeout] should not be negative in listener config:", c.Name)
+	}
+
+	socketMode := parseSocketMode(c, network.IsUnixAddr(addr))
+
+	return &v2.ListenerConfig{
+		Name:                                  c.Name,
+		Addr:                                  addr,
+		BindToPort:                            c.BindToPort,
+		InheritListener:                       old,
+		PerConnBufferLimitBytes:               1 << 15,
+		LogPath:                               c.LogPath,
+		LogLevel:                              uint8(ParseLogLevel(c.LogLevel)),
+		AccessLogs:                            ParseAccessConfig(c.AccessLogs),
+		DisableConnIo:                         c.DisableConnIo,
+		HandOffRestoredDestinationConnections: c.HandOffRestoredDestinationConnections,
+		FilterChains:                          ParseFilterChains(c.FilterChains),
+		DrainTimeout:                          c.DrainTimeout.Duration,
+		WriteBufferLowWatermark:               lowWatermark,
+		WriteBufferHighWatermark:              c.WriteBufferHighWatermark,
+		TCPKeepAlive:                          c.TCPKeepAlive.Duration,
+		DisableTCPNoDelay:                     c.TCPNoDelay != nil && !*c.TCPNoDelay,
+		ReusePort:                             c.ReusePort,
+		ProxyProtocol:                         c.ProxyProtocol,
+		SocketMode:                            socketMode,
+		MaxConnections:                        c.MaxConnections,
+		MaxConnectionsPerIP:                   c.MaxConnectionsPerIP,
+		IdleTimeout:                           c.IdleTimeout.Duration,
+	}
+}
+
+// parseSocketMode parses the permission of the socket file of unix listeners, tcp options are
+// meaningless on unix sockets and rejected
+func parseSocketMode(c *ListenerConfig, unix bool) os.FileMode {
+	if !unix {
+		if c.SocketMode != "" {
+			log.StartLogger.Fatalln("[socket_mode] requires a unix:// address in listener config:", c.Name)
+		}
+		return 0
+	}
+
+	if c.TCPKeepAlive.Duration > 0 || c.TCPNoDelay != nil || c.ReusePort {
+		log.StartLogger.Fatalln("tcp options are not supported on unix address in listener config:", c.Name)
+	}
+
+	if c.SocketMode == "" {
+		return network.DefaultUnixSocketMode
+	}
+
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		log.StartLogger.Fatalln("[socket_mode] should be an octal permission like 0660 in listener config:", c.Name)
+	}
+
+	return os.FileMode(mode)
+}
+
+func ParseClusterConfig(clusters []ClusterConfig) ([]v2.Cluster, map[string][]v2.Host) {
+	var clustersV2 []v2.Cluster
+	clusterV2Map := make(map[string][]v2.Host)
+
+	for _, c := range clusters {
+		// cluster name
+		if c.Name == "" {
+			log.StartLogger.Fatalln("[name] is required in cluster config")
+		}
+
+		var clusterType v2.ClusterType
+
+		//cluster type
+		if c.Type == "" {
+			log.StartLogger.Fatalln("[type] is required in cluster config")
+		} else {
+			if ct, ok := clusterTypeMap[c.Type]; ok {
+				clusterType = ct
+			} else {
+				log.StartLogger.Fatalln("unknown cluster type:", c.Type)
+			}
+		}
+
+		var lbType v2.LbType
+
+		if c.LbType == "" {
+			log.StartLogger.Fatalln("[lb_type] is required in cluster config")
+		} else {
+			if lt, ok := lbTypeMap[c.LbType]; ok {
+				lbType = lt
+			} else {
+				log.StartLogger.Fatalln("unknown lb type:", c.LbType)
+			}
+		}
+
+		if c.MaxRequestPerConn == 0 {
+			c.MaxRequestPerConn = 1024
+			log.StartLogger.Infof("[max_request_per_conn] is not specified, use default value %d", 1024)
+		}
+
+		if c.ConnBufferLimitBytes == 0 {
+			c.ConnBufferLimitBytes = 16 * 1026
+			log.StartLogger.Infof("[conn_buffer_limit_bytes] is not specified, use default value %d", 1024*16)
+		}
+
+		//clusterSpec := c.ClusterSpecConfig.(ClusterSpecConfig)
+		clusterSpec := c.ClusterSpecConfig
+
+		// checkout LBSubsetConfig
+		if c.LBSubsetConfig.FallBackPolicy > 2 {
+			log.StartLogger.Panic("lb subset config 's fall back policy set error. " +
+				"For 0, represent NO_FALLBACK" +
+				"For 1, reprenst ANY_ENDPOINT" +
+				"For 2, reprenst DEFAULT_SUBSET")
+		}
+
+		if lbType == v2.LB_CONSISTENT_HASH && c.ConsistentHash.HeaderKey == "" {
+			log.StartLogger.Fatalln("[header_key] is required in consistent_hash config for lb type:", c.LbType)
+		}
+
+		if c.SlowStartWindow.Duration < 0 {
+			log.StartLogger.Fatalln("[slow_start_window] should not be negative in cluster:", c.Name)
+		}
+
+		if c.SlowStartWindow.Duration > 0 && lbType != v2.LB_WEIGHTED_ROUNDROBIN {
+			log.StartLogger.Fatalln("[slow_start_window] is only supported by LB_WEIGHTED_ROUNDROBIN, but got lb type:", c.LbType)
+		}
+
+		if c.DnsRefreshRate.Duration < 0 {
+			log.StartLogger.Fatalln("[dns_refresh_rate] should not be negative in cluster:", c.Name)
+		}
+
+		if (c.DnsRefreshRate.Duration > 0 || c.RespectDnsTTL) && clusterType != v2.STRICT_DNS_CLUSTER {
+			log.StartLogger.Fatalln("[dns_refresh_rate] and [respect_dns_ttl] are only supported by STRICT_DNS cluster, but got type:", c.Type)
+		}
 
 		//v2.Cluster
 		clusterV2 := v2.Cluster{
@@ -523,10 +1540,35 @@ func ParseClusterConfig(clusters []ClusterConfig) ([]v2.Cluster, map[string][]v2
 
 			HealthCheck:      ParseClusterHealthCheckConf(&c.HealthCheck),
 			CirBreThresholds: ParseCircuitBreakers(c.CircuitBreakers),
+			OutlierDetection: ParseClusterOutlierDetectionConf(&c.OutlierDetection),
+			ConnectionPool:   ParseClusterConnectionPoolConf(&c.ConnectionPool),
 
 			Spec:           ParseConfigSpecConfig(&clusterSpec),
 			LBSubSetConfig: c.LBSubsetConfig,
+			ConsistentHash: c.ConsistentHash,
 			TLS:            ParseTLSConfig(&c.TLS),
+			ConnectTimeout: c.ConnectTimeout.Duration,
+			BoltSwitch:     parseBoltSwitch(c.Name, c.BoltSwitch),
+
+			BoltCompression:   parseBoltCompression(c.Name, &c.BoltCompression),
+			ForceCrc:          c.ForceCrc,
+			HeartbeatInterval: c.HeartbeatInterval.Duration,
+			ResponseLimits:    parseResponseLimits(&c),
+			SlowStartWindow:   c.SlowStartWindow.Duration,
+			SessionAffinity:   c.SessionAffinity,
+			ZoneAware:         parseZoneAware(&c, lbType),
+			DnsRefreshRate:    c.DnsRefreshRate.Duration,
+			RespectDnsTTL:     c.RespectDnsTTL,
+			LbChain:           parseLbChain(&c, lbType),
+
+			UpstreamProtocol: parseClusterUpstreamProtocol(&c),
+			RateLimit:        parseClusterRateLimit(&c),
+			RetryOnStatus:    parseClusterRetryOnStatus(&c),
+		}
+
+		// load certificates on parse, so that a cluster never falls back to plaintext on invalid tls config
+		if err := tls.CheckClientConfig(&clusterV2.TLS); err != nil {
+			log.StartLogger.Fatalf("invalid tls config in cluster %s: %v", c.Name, err)
 		}
 
 		clustersV2 = append(clustersV2, clusterV2)
@@ -560,6 +1602,11 @@ func ParseClusterHealthCheckConf(c *ClusterHealthCheckConfig) v2.HealthCheck {
 			UnhealthyThreshold: c.UnhealthyThreshold,
 			CheckPath:          c.CheckPath,
 			ServiceName:        c.ServiceName,
+			Type:               c.Type,
+		}
+
+		if c.Type != "" && (c.Type != v2.GrpcHealthCheck || c.Protocol != string(protocol.Http2)) {
+			log.StartLogger.Fatalf("unsupported health check type %s of protocol %s", c.Type, c.Protocol)
 		}
 	}else{
 		log.StartLogger.Fatal("unsuppoted health check protocol:", c.Protocol)
@@ -568,6 +1615,230 @@ func ParseClusterHealthCheckConf(c *ClusterHealthCheckConfig) v2.HealthCheck {
 	return healthcheckInstance
 }
 
+func ParseClusterOutlierDetectionConf(c *ClusterOutlierDetectionConfig) v2.OutlierDetection {
+	if c.MaxEjectionPercent > 100 {
+		log.StartLogger.Fatalln("[max_ejection_percent] in outlier_detection config should not be greater than 100")
+	}
+
+	return v2.OutlierDetection{
+		Consecutive_5Xx:    c.ConsecutiveErrors,
+		BaseEjectionTime:   c.BaseEjectionTime.Duration,
+		MaxEjectionPercent: c.MaxEjectionPercent,
+	}
+}
+
+func ParseClusterConnectionPoolConf(c *ClusterConnectionPoolConfig) v2.ConnectionPool {
+	pool := v2.ConnectionPool{
+		MaxConnectionsPerHost: c.MaxConnectionsPerHost,
+		IdleTimeout:           c.IdleTimeout.Duration,
+		FailFast:              c.FailFast,
+		MaxWaitTime:           c.MaxWaitTime.Duration,
+		PrewarmConnections:    c.PrewarmConnections,
+		PrewarmTimeout:        c.PrewarmTimeout.Duration,
+	}
+
+	if pool.MaxConnectionsPerHost == 0 {
+		pool.MaxConnectionsPerHost = v2.DefaultMaxConnectionsPerHost
+	}
+
+	if pool.MaxWaitTime == 0 {
+		pool.MaxWaitTime = v2.DefaultConnPoolMaxWaitTime
+	}
+
+	if pool.PrewarmConnections > 0 && pool.PrewarmTimeout == 0 {
+		pool.PrewarmTimeout = v2.DefaultConnPoolPrewarmTimeout
+	}
+
+	return pool
+}
+
+// features of bolt v2 frames, which can be turned on in cluster config
+var boltSwitchBits = map[string]sofarpc.SwitchCode{
+	"crc": sofarpc.SWITCH_CRC_ON,
+}
+
+func parseBoltSwitch(clusterName string, features []string) byte {
+	var switchCode sofarpc.SwitchCode
+
+	for _, feature := range features {
+		bit, ok := boltSwitchBits[feature]
+		if !ok {
+			log.StartLogger.Fatalf("unknown bolt switch %s in cluster %s", feature, clusterName)
+		}
+		switchCode = switchCode.Set(bit)
+	}
+
+	return byte(switchCode)
+}
+
+// compression algorithms of bolt v2 content
+var boltCompressionAlgorithms = map[string]sofarpc.SwitchCode{
+	"gzip":    sofarpc.SWITCH_GZIP_ON,
+	"deflate": sofarpc.SWITCH_DEFLATE_ON,
+}
+
+func parseBoltCompression(clusterName string, c *BoltCompressionConfig) v2.BoltCompression {
+	if c.Algorithm == "" {
+		return v2.BoltCompression{}
+	}
+
+	algorithm, ok := boltCompressionAlgorithms[c.Algorithm]
+	if !ok {
+		log.StartLogger.Fatalf("unknown bolt compression algorithm %s in cluster %s", c.Algorithm, clusterName)
+	}
+
+	threshold := c.Threshold
+	if threshold <= 0 {
+		threshold = sofarpc.DefaultCompressionThreshold
+	}
+
+	return v2.BoltCompression{
+		Algorithm: byte(algorithm),
+		Threshold: threshold,
+	}
+}
+
+// parseResponseLimits returns the response limits of cluster, which should be within the bolt frame limits
+func parseResponseLimits(c *ClusterConfig) v2.ResponseLimits {
+	if c.MaxResponseHeaderLen < 0 || c.MaxResponseContentLen < 0 {
+		log.StartLogger.Fatalf("response limits of cluster %s should not be negative", c.Name)
+	}
+
+	return v2.ResponseLimits{
+		MaxHeaderLen:  c.MaxResponseHeaderLen,
+		MaxContentLen: c.MaxResponseContentLen,
+	}
+}
+
+// DefaultClusterRateLimitMaxQueueDelay is the default max_queue_delay of the rate limit of cluster
+const DefaultClusterRateLimitMaxQueueDelay = 500 * time.Millisecond
+
+// parseClusterRateLimit returns the rate limit of the requests sent to the cluster
+func parseClusterRateLimit(c *ClusterConfig) v2.ClusterRateLimit {
+	if c.RateLimit == nil {
+		return v2.ClusterRateLimit{}
+	}
+
+	if c.RateLimit.MaxRequestsPerSecond <= 0 {
+		log.StartLogger.Fatalf("[max_requests_per_second] should be positive in rate_limit config of cluster %s", c.Name)
+	}
+
+	maxQueueDelay := c.RateLimit.MaxQueueDelay.Duration
+	if maxQueueDelay < 0 {
+		log.StartLogger.Fatalf("[max_queue_delay] should not be negative in rate_limit config of cluster %s", c.Name)
+	} else if maxQueueDelay == 0 {
+		maxQueueDelay = DefaultClusterRateLimitMaxQueueDelay
+	}
+
+	return v2.ClusterRateLimit{
+		MaxRequestsPerSecond: c.RateLimit.MaxRequestsPerSecond,
+		MaxQueueDelay:        maxQueueDelay,
+	}
+}
+
+// parseClusterRetryOnStatus returns the response statuses retried on for the requests sent to the cluster
+func parseClusterRetryOnStatus(c *ClusterConfig) []int {
+	for _, status := range c.RetryOnStatus {
+		if status < 0 {
+			log.StartLogger.Fatalf("[retry_on_status] of cluster %s should not be negative: %d", c.Name, status)
+		}
+	}
+
+	return c.RetryOnStatus
+}
+
+// LocalZoneEnv is the environment variable of the local zone, used if local_zone is not configured
+const LocalZoneEnv = "MOSN_ZONE"
+
+// DefaultZoneMinHealthyPercent is the default min_healthy_percent of zone aware load balancing
+const DefaultZoneMinHealthyPercent = 70
+
+func parseZoneAware(c *ClusterConfig, lbType v2.LbType) v2.ZoneAwareConfig {
+	if c.ZoneAware == nil {
+		return v2.ZoneAwareConfig{}
+	}
+
+	zoneAware := *c.ZoneAware
+	if zoneAware.LocalZone == "" {
+		zoneAware.LocalZone = os.Getenv(LocalZoneEnv)
+	}
+	if zoneAware.LocalZone == "" {
+		log.StartLogger.Fatalf("[local_zone] or env %s is required in zone_aware config of cluster %s", LocalZoneEnv, c.Name)
+	}
+
+	if zoneAware.MinHealthyPercent == 0 {
+		zoneAware.MinHealthyPercent = DefaultZoneMinHealthyPercent
+	} else if zoneAware.MinHealthyPercent > 100 {
+		log.StartLogger.Fatalf("[min_healthy_percent] should not be greater than 100 in zone_aware config of cluster %s", c.Name)
+	}
+
+	// the local zone is preferred by the ZONE filter of lb chain
+	if len(c.LbChain) == 0 && (lbType == v2.LB_CONSISTENT_HASH || len(c.LBSubsetConfig.SubsetSelectors) > 0) {
+		log.StartLogger.Fatalf("[zone_aware] is not supported with consistent hash or subset load balancer in cluster %s", c.Name)
+	}
+
+	return zoneAware
+}
+
+// parseLbChain returns the filters of lb chain, the host is chosen from the hosts left by lbType
+func parseLbChain(c *ClusterConfig, lbType v2.LbType) []v2.LbFilterType {
+	if len(c.LbChain) == 0 {
+		return nil
+	}
+
+	if lbType == v2.LB_WEIGHTED_ROUNDROBIN {
+		log.StartLogger.Fatalf("[lb_chain] is not supported with LB_WEIGHTED_ROUNDROBIN in cluster %s", c.Name)
+	}
+
+	if len(c.LBSubsetConfig.SubsetSelectors) > 0 {
+		log.StartLogger.Fatalf("[lb_chain] is not supported with subset load balancer in cluster %s, use SUBSET filter instead", c.Name)
+	}
+
+	var chain []v2.LbFilterType
+	zone := false
+	for _, name := range c.LbChain {
+		filter, ok := lbFilterTypeMap[name]
+		if !ok {
+			log.StartLogger.Fatalf("unknown filter %s in [lb_chain] of cluster %s", name, c.Name)
+		}
+
+		zone = zone || filter == v2.LB_FILTER_ZONE
+		chain = append(chain, filter)
+	}
+
+	if zone != (c.ZoneAware != nil) {
+		log.StartLogger.Fatalf("[zone_aware] is required by and only used by ZONE filter in [lb_chain] of cluster %s", c.Name)
+	}
+
+	return chain
+}
+
+// parseClusterUpstreamProtocol returns the protocol of the requests sent to the cluster,
+// empty means the upstream protocol of proxy
+func parseClusterUpstreamProtocol(c *ClusterConfig) string {
+	if c.UpstreamProtocol == "" {
+		return ""
+	}
+
+	if _, ok := ProtocolsSupported[c.UpstreamProtocol]; !ok || c.UpstreamProtocol == string(protocol.Auto) {
+		log.StartLogger.Fatalf("invalid [upstream_protocol] %s in cluster %s", c.UpstreamProtocol, c.Name)
+	}
+
+	return c.UpstreamProtocol
+}
+
+func ParseServiceDiscovery(c *ServiceDiscoveryConfig) v2.ServiceDiscovery {
+	if c.Type == "" {
+		log.StartLogger.Fatalln("[type] is required in service discovery config")
+	}
+
+	return v2.ServiceDiscovery{
+		Type:            c.Type,
+		Path:            c.Path,
+		RefreshInterval: c.RefreshInterval.Duration,
+	}
+}
+
 func ParseCircuitBreakers(cbcs []*CircuitBreakerdConfig) v2.CircuitBreakers {
 	var cb v2.CircuitBreakers
 	var rp v2.RoutingPriority
@@ -581,7 +1852,7 @@ func ParseCircuitBreakers(cbcs []*CircuitBreakerdConfig) v2.CircuitBreakers {
 
 		if 0 == cbc.MaxConnections || 0 == cbc.MaxPendingRequests ||
 			0 == cbc.MaxRequests || 0 == cbc.MaxRetries {
-				log.StartLogger.Warnf("zero is set in circuitBreakers' config")
+				log.StartLogger.Warnf("zero is set in circuitBreakers' config, default value is used instead")
 		}
 
 		threshold := v2.Thresholds{
@@ -592,6 +1863,17 @@ func ParseCircuitBreakers(cbcs []*CircuitBreakerdConfig) v2.CircuitBreakers {
 			MaxRetries:         cbc.MaxRetries,
 		}
 
+		if cbc.RetryBudget != nil {
+			if cbc.RetryBudget.BudgetPercent < 0 || cbc.RetryBudget.BudgetPercent > 100 {
+				log.StartLogger.Fatalln("[budget_percent] should be in [0, 100] in retry budget config")
+			}
+
+			threshold.RetryBudget = &v2.RetryBudget{
+				BudgetPercent:       cbc.RetryBudget.BudgetPercent,
+				MinRetryConcurrency: cbc.RetryBudget.MinRetryConcurrency,
+			}
+		}
+
 		cb.Thresholds = append(cb.Thresholds, threshold)
 	}
 
@@ -17,6 +17,7 @@
 package config
 
 import (
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -24,6 +25,8 @@ import (
 	"encoding/json"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 )
 
 func TestParseClusterHealthCheckConf(t *testing.T) {
@@ -79,3 +82,699 @@ func TestParseClusterHealthCheckConf(t *testing.T) {
 		})
 	}
 }
+
+func TestParseClusterGrpcHealthCheck(t *testing.T) {
+	var c ClusterHealthCheckConfig
+	json.Unmarshal([]byte(`{
+		"protocol": "Http2",
+		"type": "grpc",
+		"service_name": "app.Service",
+		"timeout": "1s",
+		"interval": "5s",
+		"healthy_threshold": 2,
+		"unhealthy_threshold": 3
+	}`), &c)
+
+	want := v2.HealthCheck{
+		Protocol:           "Http2",
+		Type:               v2.GrpcHealthCheck,
+		ServiceName:        "app.Service",
+		Timeout:            time.Second,
+		Interval:           5 * time.Second,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+	}
+	if got := ParseClusterHealthCheckConf(&c); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseClusterHealthCheckConf() = %v, want %v", got, want)
+	}
+}
+
+func TestParseTracingConfig(t *testing.T) {
+	var c TracingConfig
+	json.Unmarshal([]byte(`{"enable": true, "trace_id_header": "sofaTraceId"}`), &c)
+
+	want := &v2.TracingConfig{
+		Reporter:           DefaultTracingReporter,
+		TraceIdHeader:      "sofaTraceId",
+		SpanIdHeader:       DefaultSpanIdHeader,
+		ParentSpanIdHeader: DefaultParentSpanIdHeader,
+	}
+	if got := ParseTracingConfig(&c); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTracingConfig() = %v, want %v", got, want)
+	}
+
+	if got := ParseTracingConfig(&TracingConfig{Reporter: "log"}); got != nil {
+		t.Errorf("ParseTracingConfig() of disabled tracing = %v, want nil", got)
+	}
+}
+
+func TestParseMetricsConfig(t *testing.T) {
+	if got := ParseMetricsConfig(&MetricsConfig{}); got.Sink != DefaultMetricsSink {
+		t.Errorf("ParseMetricsConfig() sink = %s, want %s", got.Sink, DefaultMetricsSink)
+	}
+
+	var c MetricsConfig
+	json.Unmarshal([]byte(`{"sink": "statsd", "statsd_address": "127.0.0.1:8125", "statsd_prefix": "mosn"}`), &c)
+
+	want := &v2.MetricsConfig{
+		Sink:          "statsd",
+		StatsdAddress: "127.0.0.1:8125",
+		StatsdPrefix:  "mosn",
+	}
+	if got := ParseMetricsConfig(&c); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMetricsConfig() = %v, want %v", got, want)
+	}
+
+	c = MetricsConfig{}
+	json.Unmarshal([]byte(`{
+		"sink": "otlp",
+		"otlp_endpoint": "127.0.0.1:4317",
+		"otlp_export_interval": "30s",
+		"otlp_instance_id": "mosn-1",
+		"otlp_resource_attributes": {"deployment.environment": "prod"}
+	}`), &c)
+
+	want = &v2.MetricsConfig{
+		Sink:                   "otlp",
+		OtlpEndpoint:           "127.0.0.1:4317",
+		OtlpExportInterval:     30 * time.Second,
+		OtlpServiceName:        DefaultOtlpServiceName,
+		OtlpInstanceId:         "mosn-1",
+		OtlpResourceAttributes: map[string]string{"deployment.environment": "prod"},
+	}
+	if got := ParseMetricsConfig(&c); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMetricsConfig() = %v, want %v", got, want)
+	}
+
+	// defaults
+	hostname, _ := os.Hostname()
+	got := ParseMetricsConfig(&MetricsConfig{Sink: "otlp", OtlpEndpoint: "127.0.0.1:4317"})
+	if got.OtlpExportInterval != DefaultOtlpExportInterval || got.OtlpInstanceId != hostname {
+		t.Errorf("ParseMetricsConfig() = %v, want default interval and hostname as instance id", got)
+	}
+}
+
+func TestParseClusterConnectionPoolConf(t *testing.T) {
+	var c ClusterConnectionPoolConfig
+	json.Unmarshal([]byte(`{"max_connections_per_host": 4, "idle_timeout": "60s", "fail_fast": true}`), &c)
+
+	want := v2.ConnectionPool{
+		MaxConnectionsPerHost: 4,
+		IdleTimeout:           60 * time.Second,
+		FailFast:              true,
+		MaxWaitTime:           v2.DefaultConnPoolMaxWaitTime,
+	}
+	if got := ParseClusterConnectionPoolConf(&c); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseClusterConnectionPoolConf() = %v, want %v", got, want)
+	}
+
+	if got := ParseClusterConnectionPoolConf(&ClusterConnectionPoolConfig{}); got.MaxConnectionsPerHost != v2.DefaultMaxConnectionsPerHost {
+		t.Errorf("ParseClusterConnectionPoolConf() of empty config = %v, want default max connections", got)
+	}
+
+	if got := ParseClusterConnectionPoolConf(&ClusterConnectionPoolConfig{PrewarmConnections: 2}); got.PrewarmTimeout != v2.DefaultConnPoolPrewarmTimeout {
+		t.Errorf("ParseClusterConnectionPoolConf() of pre-warming = %v, want default prewarm timeout", got)
+	}
+}
+
+func TestParseFaultInjectFilter(t *testing.T) {
+	var conf map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"delay_percent": 10,
+		"delay_duration": "100ms",
+		"abort_percent": 20,
+		"abort_status": 4,
+		"header": {"name": "fault", "value": "on"}
+	}`), &conf)
+
+	want := &v2.FaultInject{
+		DelayPercent:  10,
+		DelayDuration: uint64(100 * time.Millisecond),
+		AbortPercent:  20,
+		AbortStatus:   4,
+		Header:        v2.HeaderMatcher{Name: "fault", Value: "on"},
+	}
+	if got := ParseFaultInjectFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFaultInjectFilter() = %+v, want %+v", got, want)
+	}
+
+	// abort only
+	want = &v2.FaultInject{AbortPercent: 100, AbortStatus: 16}
+	if got := ParseFaultInjectFilter(map[string]interface{}{"abort_percent": 100.0, "abort_status": 16.0}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFaultInjectFilter() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseCircuitBreakersRetryBudget(t *testing.T) {
+	var cbcs []*CircuitBreakerdConfig
+	data := `[{"priority": "default", "max_requests": 100, "retry_budget": {"budget_percent": 25.5, "min_retry_concurrency": 2}}]`
+	if err := json.Unmarshal([]byte(data), &cbcs); err != nil {
+		t.Fatal(err)
+	}
+	cb := ParseCircuitBreakers(cbcs)
+	expected := &v2.RetryBudget{BudgetPercent: 25.5, MinRetryConcurrency: 2}
+	if len(cb.Thresholds) != 1 || !reflect.DeepEqual(cb.Thresholds[0].RetryBudget, expected) {
+		t.Errorf("unexpected retry budget: %+v", cb.Thresholds)
+	}
+}
+
+func TestParseListenerWriteBufferWatermarks(t *testing.T) {
+	var c ListenerConfig
+	if err := json.Unmarshal([]byte(`{"name": "test", "address": "127.0.0.1:2045", "write_buffer_high_watermark": 1024}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	lc := ParseListenerConfig(&c, nil)
+	if lc.WriteBufferHighWatermark != 1024 || lc.WriteBufferLowWatermark != 512 {
+		t.Errorf("expect low watermark defaults to half of high, got %d/%d", lc.WriteBufferLowWatermark, lc.WriteBufferHighWatermark)
+	}
+
+	c.WriteBufferLowWatermark = 256
+	lc = ParseListenerConfig(&c, nil)
+	if lc.WriteBufferLowWatermark != 256 {
+		t.Errorf("expect low watermark 256, got %d", lc.WriteBufferLowWatermark)
+	}
+
+	// disabled by default
+	lc = ParseListenerConfig(&ListenerConfig{Name: "test", Address: "127.0.0.1:2045"}, nil)
+	if lc.WriteBufferHighWatermark != 0 || lc.WriteBufferLowWatermark != 0 {
+		t.Errorf("expect watermarks disabled, got %d/%d", lc.WriteBufferLowWatermark, lc.WriteBufferHighWatermark)
+	}
+}
+
+func TestParseZoneAware(t *testing.T) {
+	var c ClusterConfig
+	if err := json.Unmarshal([]byte(`{"name": "test", "zone_aware": {"local_zone": "gz00a", "min_healthy_percent": 50}}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := v2.ZoneAwareConfig{LocalZone: "gz00a", MinHealthyPercent: 50}
+	if got := parseZoneAware(&c, v2.LB_ROUNDROBIN); got != want {
+		t.Errorf("parseZoneAware() = %+v, want %+v", got, want)
+	}
+
+	// local zone from env, and the default min healthy percent
+	os.Setenv(LocalZoneEnv, "gz00b")
+	defer os.Unsetenv(LocalZoneEnv)
+	c.ZoneAware = &v2.ZoneAwareConfig{}
+	want = v2.ZoneAwareConfig{LocalZone: "gz00b", MinHealthyPercent: DefaultZoneMinHealthyPercent}
+	if got := parseZoneAware(&c, v2.LB_ROUNDROBIN); got != want {
+		t.Errorf("parseZoneAware() = %+v, want %+v", got, want)
+	}
+
+	// disabled if not configured
+	c.ZoneAware = nil
+	if got := parseZoneAware(&c, v2.LB_ROUNDROBIN); got != (v2.ZoneAwareConfig{}) {
+		t.Errorf("parseZoneAware() = %+v, want disabled", got)
+	}
+}
+
+func TestParseResponseCacheFilter(t *testing.T) {
+	var conf map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"class_names": ["com.alipay.test.QueryService"],
+		"key_headers": ["user_id", "app"],
+		"ttl": "5s",
+		"max_entries": 100
+	}`), &conf)
+
+	want := &v2.ResponseCache{
+		ClassNames: []string{"com.alipay.test.QueryService"},
+		KeyHeaders: []string{"user_id", "app"},
+		TTL:        5 * time.Second,
+		MaxEntries: 100,
+	}
+	if got := ParseResponseCacheFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseResponseCacheFilter() = %+v, want %+v", got, want)
+	}
+
+	// defaults
+	delete(conf, "key_headers")
+	delete(conf, "max_entries")
+	want = &v2.ResponseCache{
+		ClassNames: []string{"com.alipay.test.QueryService"},
+		TTL:        5 * time.Second,
+		MaxEntries: DefaultResponseCacheMaxEntries,
+	}
+	if got := ParseResponseCacheFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseResponseCacheFilter() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseListenerTCPOptions(t *testing.T) {
+	var c ListenerConfig
+	if err := json.Unmarshal([]byte(`{"name": "test", "address": "127.0.0.1:2045", "bind_port": true,
+		"tcp_keepalive": "30s", "tcp_nodelay": false, "reuse_port": true}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	lc := ParseListenerConfig(&c, nil)
+	if lc.TCPKeepAlive != 30*time.Second || !lc.DisableTCPNoDelay || !lc.ReusePort {
+		t.Errorf("unexpected tcp options: keepalive %s, disable nodelay %v, reuse port %v", lc.TCPKeepAlive, lc.DisableTCPNoDelay, lc.ReusePort)
+	}
+
+	// TCP_NODELAY is kept by default
+	lc = ParseListenerConfig(&ListenerConfig{Name: "test", Address: "127.0.0.1:2045", BindToPort: true}, nil)
+	if lc.TCPKeepAlive != 0 || lc.DisableTCPNoDelay || lc.ReusePort {
+		t.Errorf("unexpected default tcp options: keepalive %s, disable nodelay %v, reuse port %v", lc.TCPKeepAlive, lc.DisableTCPNoDelay, lc.ReusePort)
+	}
+}
+
+func TestParseListenerUnixAddress(t *testing.T) {
+	var c ListenerConfig
+	if err := json.Unmarshal([]byte(`{"name": "test", "address": "unix:///var/run/mosn.sock", "bind_port": true,
+		"socket_mode": "0600"}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	lc := ParseListenerConfig(&c, nil)
+	if lc.Addr.Network() != "unix" || lc.Addr.String() != "/var/run/mosn.sock" || lc.SocketMode != 0600 {
+		t.Errorf("unexpected unix listener: %s %s, mode %o", lc.Addr.Network(), lc.Addr.String(), lc.SocketMode)
+	}
+
+	lc = ParseListenerConfig(&ListenerConfig{Name: "test", Address: "unix:///var/run/mosn.sock", BindToPort: true}, nil)
+	if lc.SocketMode != 0660 {
+		t.Errorf("expect socket mode defaults to 0660, got %o", lc.SocketMode)
+	}
+
+	lc = ParseListenerConfig(&ListenerConfig{Name: "test", Address: "127.0.0.1:2045", BindToPort: true}, nil)
+	if lc.Addr.Network() != "tcp" || lc.SocketMode != 0 {
+		t.Errorf("unexpected tcp listener: %s, mode %o", lc.Addr.Network(), lc.SocketMode)
+	}
+}
+
+func TestParseListenerConnectionLimits(t *testing.T) {
+	var c ListenerConfig
+	if err := json.Unmarshal([]byte(`{"name": "test", "address": "127.0.0.1:2045", "bind_port": true,
+		"max_connections": 100, "max_connections_per_ip": 10}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	lc := ParseListenerConfig(&c, nil)
+	if lc.MaxConnections != 100 || lc.MaxConnectionsPerIP != 10 {
+		t.Errorf("unexpected connection limits: max %d, max per ip %d", lc.MaxConnections, lc.MaxConnectionsPerIP)
+	}
+
+	// unlimited by default
+	lc = ParseListenerConfig(&ListenerConfig{Name: "test", Address: "127.0.0.1:2045", BindToPort: true}, nil)
+	if lc.MaxConnections != 0 || lc.MaxConnectionsPerIP != 0 {
+		t.Errorf("unexpected default connection limits: max %d, max per ip %d", lc.MaxConnections, lc.MaxConnectionsPerIP)
+	}
+}
+
+func TestParseListenerIdleTimeout(t *testing.T) {
+	var c ListenerConfig
+	if err := json.Unmarshal([]byte(`{"name": "test", "address": "127.0.0.1:2045", "bind_port": true,
+		"idle_timeout": "5m"}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if lc := ParseListenerConfig(&c, nil); lc.IdleTimeout != 5*time.Minute {
+		t.Errorf("unexpected idle timeout: %s", lc.IdleTimeout)
+	}
+
+	// never reaped by default
+	lc := ParseListenerConfig(&ListenerConfig{Name: "test", Address: "127.0.0.1:2045", BindToPort: true}, nil)
+	if lc.IdleTimeout != 0 {
+		t.Errorf("unexpected default idle timeout: %s", lc.IdleTimeout)
+	}
+}
+
+func TestParseAccessConfig(t *testing.T) {
+	var c []AccessLogConfig
+	if err := json.Unmarshal([]byte(`[{"log_path": "/tmp/access.log"},
+		{"log_path": "/tmp/sampled.log", "success_sample_rate": 0},
+		{"log_path": "/tmp/traced.log", "success_sample_rate": 0.1, "sample_header": "trace_id"}]`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := ParseAccessConfig(c)
+	if len(logs) != 3 {
+		t.Fatalf("expected 3 access logs, got %d", len(logs))
+	}
+	if logs[0].SampleSuccess {
+		t.Errorf("access log should not be sampled by default: %+v", logs[0])
+	}
+	if !logs[1].SampleSuccess || logs[1].SuccessSampleRate != 0 || logs[1].SampleHeader != sofarpc.HeaderReqID {
+		t.Errorf("unexpected sampled access log: %+v", logs[1])
+	}
+	if !logs[2].SampleSuccess || logs[2].SuccessSampleRate != 0.1 || logs[2].SampleHeader != "trace_id" {
+		t.Errorf("unexpected sampled access log: %+v", logs[2])
+	}
+}
+
+func TestParseExtProcFilter(t *testing.T) {
+	var conf map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"address": "127.0.0.1:9001",
+		"timeout": "50ms",
+		"fail_open": true,
+		"clusters": ["pay", "user"]
+	}`), &conf)
+
+	want := &v2.ExtProc{
+		Address:  "127.0.0.1:9001",
+		Timeout:  50 * time.Millisecond,
+		FailOpen: true,
+		Clusters: []string{"pay", "user"},
+	}
+	if got := ParseExtProcFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseExtProcFilter() = %+v, want %+v", got, want)
+	}
+
+	// defaults
+	want = &v2.ExtProc{Address: "127.0.0.1:9001", Timeout: DefaultExtProcTimeout}
+	if got := ParseExtProcFilter(map[string]interface{}{"address": "127.0.0.1:9001"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseExtProcFilter() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseHedgePolicy(t *testing.T) {
+	policy := &v2.HedgePolicy{HedgeDelay: "50ms"}
+	parseHedgePolicy(policy)
+	if policy.Delay != 50*time.Millisecond || policy.DelayPercentile != 0 || policy.MaxHedges != 1 {
+		t.Errorf("parse hedge policy with duration delay unexpected: %+v", policy)
+	}
+
+	policy = &v2.HedgePolicy{HedgeDelay: "p95", MaxHedges: 2}
+	parseHedgePolicy(policy)
+	if policy.Delay != 0 || policy.DelayPercentile != 0.95 || policy.MaxHedges != 2 {
+		t.Errorf("parse hedge policy with percentile delay unexpected: %+v", policy)
+	}
+}
+
+func TestParseRouter(t *testing.T) {
+	router := &v2.Router{Route: v2.RouteAction{ClusterName: "pay", HedgePolicy: &v2.HedgePolicy{HedgeDelay: "10ms"}}}
+	if err := ParseRouter(router); err != nil || router.Route.HedgePolicy.Delay != 10*time.Millisecond {
+		t.Errorf("parse valid router error: %v, hedge policy %+v", err, router.Route.HedgePolicy)
+	}
+
+	router = &v2.Router{Route: v2.RouteAction{ClusterName: "pay", FailoverCluster: "pay_backup"}}
+	if err := ParseRouter(router); err != nil {
+		t.Errorf("parse router with failover cluster error: %v", err)
+	}
+
+	router = &v2.Router{Route: v2.RouteAction{ClassTimeouts: map[string]string{
+		"com.alipay.":               "1s",
+		"com.alipay.pay.PayService": "200ms",
+		"com.alipay.pay.":           "500ms",
+	}}}
+	if err := ParseRouter(router); err != nil {
+		t.Fatalf("parse class timeouts error: %v", err)
+	}
+	want := []v2.ClassTimeout{
+		{Prefix: "com.alipay.pay.PayService", Timeout: 200 * time.Millisecond},
+		{Prefix: "com.alipay.pay.", Timeout: 500 * time.Millisecond},
+		{Prefix: "com.alipay.", Timeout: time.Second},
+	}
+	if !reflect.DeepEqual(router.Route.ClassTimeoutPrefixes, want) {
+		t.Errorf("class timeouts should be sorted by prefix length, got %+v", router.Route.ClassTimeoutPrefixes)
+	}
+
+	router = &v2.Router{Route: v2.RouteAction{WeightedClusters: []v2.WeightedCluster{
+		{Clusters: v2.ClusterWeight{Name: "pay", Weight: 0}},
+		{Clusters: v2.ClusterWeight{Name: "pay_canary", Weight: 3}},
+	}}}
+	if err := ParseRouter(router); err != nil {
+		t.Errorf("parse router with weighted clusters error: %v", err)
+	}
+
+	for _, invalid := range []*v2.Router{
+		{Route: v2.RouteAction{MirrorPercent: 101}},
+		{Route: v2.RouteAction{WeightedClusters: []v2.WeightedCluster{{Clusters: v2.ClusterWeight{Name: "pay"}}}}},
+		{Route: v2.RouteAction{WeightedClusters: []v2.WeightedCluster{{Clusters: v2.ClusterWeight{Weight: 10}}}}},
+		{Route: v2.RouteAction{ClusterName: "pay", FailoverCluster: "pay"}},
+		{Route: v2.RouteAction{ClassTimeouts: map[string]string{"com.alipay.": "-1s"}}},
+		{Route: v2.RouteAction{ClassTimeouts: map[string]string{"com.alipay.": "1000"}}},
+		{Route: v2.RouteAction{HedgePolicy: &v2.HedgePolicy{HedgeDelay: "p100"}}},
+		{Route: v2.RouteAction{HedgePolicy: &v2.HedgePolicy{HedgeDelay: "soon"}}},
+		{Match: v2.RouterMatch{SourceCIDRs: []string{"10.8.0.0"}}},
+	} {
+		if err := ParseRouter(invalid); err == nil {
+			t.Errorf("expected error for router %+v", invalid.Route)
+		}
+	}
+}
+
+func TestParseAuthzFilter(t *testing.T) {
+	var conf map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"default_action": "allow",
+		"deny_status": 6,
+		"rules": [
+			{"identity": "spiffe://cluster.local/ns/default/*", "class_name": "com.alipay.pay.*", "action": "allow"},
+			{"method": "refund", "action": "DENY"}
+		]
+	}`), &conf)
+
+	want := &v2.Authz{
+		Rules: []v2.AuthzRule{
+			{Identity: "spiffe://cluster.local/ns/default/*", ClassName: "com.alipay.pay.*", Action: v2.AuthzAllow},
+			{Method: "refund", Action: v2.AuthzDeny},
+		},
+		DefaultAction: v2.AuthzAllow,
+		DenyStatus:    6,
+	}
+	if got := ParseAuthzFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAuthzFilter() = %+v, want %+v", got, want)
+	}
+
+	// defaults
+	want = &v2.Authz{
+		DefaultAction: v2.AuthzDeny,
+		DenyStatus:    sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION,
+	}
+	if got := ParseAuthzFilter(map[string]interface{}{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAuthzFilter() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRequestSizeFilter(t *testing.T) {
+	var conf map[string]interface{}
+	json.Unmarshal([]byte(`{"max_request_bytes": 1048576, "reject_status": 6}`), &conf)
+
+	want := &v2.RequestSize{MaxRequestBytes: 1048576, RejectStatus: 6}
+	if got := ParseRequestSizeFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRequestSizeFilter() = %+v, want %+v", got, want)
+	}
+
+	// defaults
+	want = &v2.RequestSize{RejectStatus: sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION}
+	if got := ParseRequestSizeFilter(map[string]interface{}{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRequestSizeFilter() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseConcurrencyLimitFilter(t *testing.T) {
+	var conf map[string]interface{}
+	json.Unmarshal([]byte(`{"min_limit": 5, "max_limit": 200, "sample_window": "500ms"}`), &conf)
+
+	want := &v2.ConcurrencyLimit{MinLimit: 5, MaxLimit: 200, SampleWindow: 500 * time.Millisecond}
+	if got := ParseConcurrencyLimitFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseConcurrencyLimitFilter() = %+v, want %+v", got, want)
+	}
+
+	// defaults
+	want = &v2.ConcurrencyLimit{
+		MinLimit:     DefaultConcurrencyMinLimit,
+		MaxLimit:     DefaultConcurrencyMaxLimit,
+		SampleWindow: DefaultConcurrencySampleWindow,
+	}
+	if got := ParseConcurrencyLimitFilter(map[string]interface{}{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseConcurrencyLimitFilter() = %+v, want %+v", got, want)
+	}
+
+	// priority classes, the default class is the lowest one if not configured
+	json.Unmarshal([]byte(`{
+		"priority_header": "priority",
+		"priority_classes": [
+			{"name": "high", "values": ["high", "critical"], "limit_percent": 100},
+			{"name": "normal", "values": ["normal"], "limit_percent": 80},
+			{"name": "low", "values": ["low"], "limit_percent": 50}
+		]
+	}`), &conf)
+	got := ParseConcurrencyLimitFilter(conf)
+	if got.PriorityHeader != "priority" || got.DefaultPriorityClass != "low" || !reflect.DeepEqual(got.PriorityClasses, []v2.ConcurrencyPriorityClass{
+		{Name: "high", Values: []string{"high", "critical"}, LimitPercent: 100},
+		{Name: "normal", Values: []string{"normal"}, LimitPercent: 80},
+		{Name: "low", Values: []string{"low"}, LimitPercent: 50},
+	}) {
+		t.Errorf("ParseConcurrencyLimitFilter() priority = %+v", got)
+	}
+
+	conf["default_priority_class"] = "normal"
+	if got := ParseConcurrencyLimitFilter(conf); got.DefaultPriorityClass != "normal" {
+		t.Errorf("default priority class = %s, want normal", got.DefaultPriorityClass)
+	}
+}
+
+func TestParseTapFilter(t *testing.T) {
+	var conf map[string]interface{}
+	json.Unmarshal([]byte(`{"mask_headers": ["token", "password"], "mask_content": true}`), &conf)
+
+	want := &v2.Tap{MaskHeaders: []string{"token", "password"}, MaskContent: true}
+	if got := ParseTapFilter(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTapFilter() = %+v, want %+v", got, want)
+	}
+
+	if got := ParseTapFilter(map[string]interface{}{}); !reflect.DeepEqual(got, &v2.Tap{}) {
+		t.Errorf("ParseTapFilter() = %+v, want empty config", got)
+	}
+}
+
+func TestParseStrictDnsCluster(t *testing.T) {
+	var c ClusterConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "dns",
+		"type": "STRICT_DNS",
+		"lb_type": "LB_ROUNDROBIN",
+		"dns_refresh_rate": "10s",
+		"respect_dns_ttl": true,
+		"hosts": [{"address": "upstream.example.com:12200"}]
+	}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, hosts := ParseClusterConfig([]ClusterConfig{c})
+	if len(clusters) != 1 {
+		t.Fatalf("expect 1 cluster, got %d", len(clusters))
+	}
+	if cluster := clusters[0]; cluster.ClusterType != v2.STRICT_DNS_CLUSTER ||
+		cluster.DnsRefreshRate != 10*time.Second || !cluster.RespectDnsTTL {
+		t.Errorf("unexpected dns config of cluster: %+v", cluster)
+	}
+	if want := []v2.Host{{Address: "upstream.example.com:12200"}}; !reflect.DeepEqual(hosts["dns"], want) {
+		t.Errorf("hosts = %+v, want %+v", hosts["dns"], want)
+	}
+}
+
+func TestParseClusterRateLimit(t *testing.T) {
+	var c ClusterConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "legacy",
+		"type": "SIMPLE",
+		"lb_type": "LB_RANDOM",
+		"rate_limit": {"max_requests_per_second": 200, "max_queue_delay": "200ms"}
+	}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, _ := ParseClusterConfig([]ClusterConfig{c})
+	if want := (v2.ClusterRateLimit{MaxRequestsPerSecond: 200, MaxQueueDelay: 200 * time.Millisecond}); clusters[0].RateLimit != want {
+		t.Errorf("rate limit = %+v, want %+v", clusters[0].RateLimit, want)
+	}
+
+	// default max queue delay
+	c.RateLimit.MaxQueueDelay.Duration = 0
+	clusters, _ = ParseClusterConfig([]ClusterConfig{c})
+	if clusters[0].RateLimit.MaxQueueDelay != DefaultClusterRateLimitMaxQueueDelay {
+		t.Errorf("max queue delay = %v, want %v", clusters[0].RateLimit.MaxQueueDelay, DefaultClusterRateLimitMaxQueueDelay)
+	}
+
+	c.RateLimit = nil
+	clusters, _ = ParseClusterConfig([]ClusterConfig{c})
+	if clusters[0].RateLimit != (v2.ClusterRateLimit{}) {
+		t.Errorf("rate limit not configured, got %+v", clusters[0].RateLimit)
+	}
+}
+
+func TestParseClusterRetryOnStatus(t *testing.T) {
+	var c ClusterConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "busy_terminal",
+		"type": "SIMPLE",
+		"lb_type": "LB_RANDOM",
+		"retry_on_status": [2, 16]
+	}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, _ := ParseClusterConfig([]ClusterConfig{c})
+	if !reflect.DeepEqual(clusters[0].RetryOnStatus, []int{2, 16}) {
+		t.Errorf("retry on status = %v, want [2 16]", clusters[0].RetryOnStatus)
+	}
+
+	c.RetryOnStatus = nil
+	clusters, _ = ParseClusterConfig([]ClusterConfig{c})
+	if clusters[0].RetryOnStatus != nil {
+		t.Errorf("retry on status not configured, got %v", clusters[0].RetryOnStatus)
+	}
+}
+
+func TestParseClusterHeartbeatInterval(t *testing.T) {
+	var c ClusterConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "heartbeat",
+		"type": "SIMPLE",
+		"lb_type": "LB_RANDOM",
+		"heartbeat_interval": "15s"
+	}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, _ := ParseClusterConfig([]ClusterConfig{c})
+	if clusters[0].HeartbeatInterval != 15*time.Second {
+		t.Errorf("heartbeat interval = %v, want 15s", clusters[0].HeartbeatInterval)
+	}
+}
+
+func TestParseLbChain(t *testing.T) {
+	var c ClusterConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "chain",
+		"lb_chain": ["SUBSET", "ZONE", "LEAST_REQUEST"],
+		"zone_aware": {"local_zone": "gz00a"},
+		"consistent_hash": {"header_key": "uid"}
+	}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []v2.LbFilterType{v2.LB_FILTER_SUBSET, v2.LB_FILTER_ZONE, v2.LB_FILTER_LEAST_REQUEST}
+	if got := parseLbChain(&c, v2.LB_CONSISTENT_HASH); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLbChain() = %v, want %v", got, want)
+	}
+	// zone aware is used by ZONE filter with consistent hash
+	if got := parseZoneAware(&c, v2.LB_CONSISTENT_HASH); got.LocalZone != "gz00a" {
+		t.Errorf("parseZoneAware() = %+v, want local zone gz00a", got)
+	}
+
+	c.LbChain = nil
+	if got := parseLbChain(&c, v2.LB_CONSISTENT_HASH); got != nil {
+		t.Errorf("parseLbChain() = %v, want disabled", got)
+	}
+}
+
+func TestParseClusterUpstreamProtocol(t *testing.T) {
+	var c ClusterConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "h2",
+		"upstream_protocol": "Http2"
+	}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := parseClusterUpstreamProtocol(&c); got != string(protocol.Http2) {
+		t.Errorf("parseClusterUpstreamProtocol() = %s, want %s", got, protocol.Http2)
+	}
+
+	// the upstream protocol of proxy is used if not declared
+	c.UpstreamProtocol = ""
+	if got := parseClusterUpstreamProtocol(&c); got != "" {
+		t.Errorf("parseClusterUpstreamProtocol() = %s, want empty", got)
+	}
+}
+
+func TestParseUnknownProtocol(t *testing.T) {
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"unknown_protocol": {"action": "forward", "cluster": "raw_tcp"}}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	want := v2.UnknownProtocolPolicy{Action: v2.UnknownProtocolForward, Cluster: "raw_tcp"}
+	if got := parseUnknownProtocol(config, string(protocol.SofaRpc)); got != want {
+		t.Errorf("parseUnknownProtocol() = %+v, want %+v", got, want)
+	}
+
+	config = map[string]interface{}{"unknown_protocol": map[string]interface{}{"action": "close_silently"}}
+	if got := parseUnknownProtocol(config, string(protocol.Auto)); got.Action != v2.UnknownProtocolCloseSilently {
+		t.Errorf("expect close_silently, got %+v", got)
+	}
+
+	// closed by default
+	if got := parseUnknownProtocol(map[string]interface{}{}, string(protocol.Http2)); got.Action != v2.UnknownProtocolClose {
+		t.Errorf("expect close by default, got %+v", got)
+	}
+}
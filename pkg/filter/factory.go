@@ -17,8 +17,16 @@
 package filter
 
 import (
+	"github.com/alipay/sofamosn/pkg/filter/stream/authz"
+	"github.com/alipay/sofamosn/pkg/filter/stream/concurrencylimit"
+	"github.com/alipay/sofamosn/pkg/filter/stream/extproc"
 	"github.com/alipay/sofamosn/pkg/filter/stream/faultinject"
+	"github.com/alipay/sofamosn/pkg/filter/stream/headermutation"
 	"github.com/alipay/sofamosn/pkg/filter/stream/healthcheck/sofarpc"
+	"github.com/alipay/sofamosn/pkg/filter/stream/ratelimit"
+	"github.com/alipay/sofamosn/pkg/filter/stream/requestsize"
+	"github.com/alipay/sofamosn/pkg/filter/stream/responsecache"
+	"github.com/alipay/sofamosn/pkg/filter/stream/tap"
 	"github.com/alipay/sofamosn/pkg/log"
 	"github.com/alipay/sofamosn/pkg/types"
 )
@@ -30,12 +38,26 @@ func init() {
 	//reg
 	Register("fault_inject", faultinject.CreateFaultInjectFilterFactory)
 	Register("healthcheck", sofarpc.CreateHealthCheckFilterFactory)
+	Register("rate_limit", ratelimit.CreateRateLimitFilterFactory)
+	Register("header_mutation", headermutation.CreateHeaderMutationFilterFactory)
+	Register("ext_proc", extproc.CreateExtProcFilterFactory)
+	Register("response_cache", responsecache.CreateResponseCacheFilterFactory)
+	Register("authz", authz.CreateAuthzFilterFactory)
+	Register("request_size", requestsize.CreateRequestSizeFilterFactory)
+	Register("concurrency_limit", concurrencylimit.CreateConcurrencyLimitFilterFactory)
+	Register("tap", tap.CreateTapFilterFactory)
 }
 
 func Register(filterType string, creator StreamFilterFactoryCreator) {
 	creatorFactory[filterType] = creator
 }
 
+// IsRegistered returns true if the stream filter type is registered
+func IsRegistered(filterType string) bool {
+	_, ok := creatorFactory[filterType]
+	return ok
+}
+
 func CreateStreamFilterChainFactory(filterType string, config map[string]interface{}) types.StreamFilterChainFactory {
 
 	if cf, ok := creatorFactory[filterType]; ok {
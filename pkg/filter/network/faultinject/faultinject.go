@@ -68,7 +68,7 @@ func (fi *faultinjecter) tryInjectDelay() {
 		if atomic.CompareAndSwapUint32(&fi.delaying, 0, 1) {
 			go func() {
 				select {
-				case <-time.After(time.Duration(duration) * time.Millisecond):
+				case <-time.After(time.Duration(duration)):
 					atomic.StoreUint32(&fi.delaying, 0)
 					fi.readCallbacks.ContinueReading()
 				}
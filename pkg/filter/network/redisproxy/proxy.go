@@ -0,0 +1,399 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redisproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/redis"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// errors replied to the client, the first word is the error type
+var (
+	ErrNoCluster        = errors.New("ERR no cluster for redis proxy")
+	ErrNoHealthyHost    = errors.New("ERR no healthy upstream")
+	ErrCrossSlot        = errors.New("CROSSSLOT Keys in request don't hash to the same host")
+	ErrUpstreamConnect  = errors.New("ERR upstream connect failed")
+	ErrUpstreamClosed   = errors.New("ERR upstream connection closed")
+	ErrDownstreamFormat = errors.New("ERR Protocol error")
+)
+
+// ReadFilter
+// proxy parses commands of the downstream connection, sends each command to the host chosen by
+// hashing its keys, and writes the replies back in the order of commands
+type proxy struct {
+	config         *v2.RedisProxy
+	clusterManager types.ClusterManager
+	readCallbacks  types.ReadFilterCallbacks
+	stats          *proxyStats
+
+	mux sync.Mutex
+	// commands waiting for reply, in the order they are received
+	requests  []*request
+	upstreams map[string]*upstreamClient
+}
+
+type request struct {
+	stats *redisCommandStats
+	start time.Time
+	reply []byte
+}
+
+func NewProxy(config *v2.RedisProxy, clusterManager types.ClusterManager, ctx context.Context) types.ReadFilter {
+	return &proxy{
+		config:         config,
+		clusterManager: clusterManager,
+		stats:          globalStats,
+		upstreams:      make(map[string]*upstreamClient),
+	}
+}
+
+func (p *proxy) OnData(data types.IoBuffer) types.FilterStatus {
+	for data.Len() > 0 {
+		cmd, read, err := redis.DecodeCommand(data.Bytes())
+		if err != nil {
+			log.DefaultLogger.Errorf("redis proxy decode command failed: %v", err)
+
+			p.onReply(p.newRequest(unsupportedCommand), redis.ErrorReply(ErrDownstreamFormat.Error()))
+			p.readCallbacks.Connection().Close(types.FlushWrite, types.LocalClose)
+
+			return types.StopIteration
+		}
+
+		if read == 0 {
+			break
+		}
+
+		// args of the command refer to data, so it should be handled before drained
+		if cmd != nil {
+			p.onCommand(cmd)
+		}
+
+		data.Drain(read)
+	}
+
+	return types.StopIteration
+}
+
+func (p *proxy) OnNewConnection() types.FilterStatus {
+	return types.Continue
+}
+
+func (p *proxy) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {
+	p.readCallbacks = cb
+	p.readCallbacks.Connection().AddConnectionEventListener(&downstreamCallbacks{p})
+
+	p.stats.DownstreamConnectionTotal().Inc(1)
+	p.stats.DownstreamConnectionActive().Inc(1)
+}
+
+func (p *proxy) newRequest(name string) *request {
+	req := &request{
+		stats: getCommandStats(name),
+		start: time.Now(),
+	}
+	req.stats.Total().Inc(1)
+
+	p.mux.Lock()
+	p.requests = append(p.requests, req)
+	p.mux.Unlock()
+
+	return req
+}
+
+func (p *proxy) onCommand(cmd *redis.Command) {
+	name := cmd.Name()
+	req := p.newRequest(name)
+
+	if name == pingCommand {
+		p.onReply(req, redis.StatusReply("PONG"))
+		return
+	}
+
+	keys, err := cmd.Keys()
+	if err != nil {
+		p.onReply(req, redis.ErrorReply(err.Error()))
+		return
+	}
+
+	clusterSnapshot := p.clusterManager.Get(nil, p.config.Cluster)
+	if clusterSnapshot == nil || reflect.ValueOf(clusterSnapshot).IsNil() {
+		p.onReply(req, redis.ErrorReply(ErrNoCluster.Error()))
+		return
+	}
+
+	host, err := chooseHost(clusterSnapshot.LoadBalancer(), keys)
+	if err != nil {
+		p.onReply(req, redis.ErrorReply(err.Error()))
+		return
+	}
+
+	client := p.getUpstreamClient(host)
+	if client == nil {
+		p.onReply(req, redis.ErrorReply(ErrUpstreamConnect.Error()))
+		return
+	}
+
+	client.send(req, cmd.Encode())
+}
+
+// chooseHost chooses the host by each key of the command, keys of a multi-key command
+// must be on the same host
+func chooseHost(lb types.LoadBalancer, keys [][]byte) (types.Host, error) {
+	var host types.Host
+
+	for _, key := range keys {
+		h := lb.ChooseHost(&lbContext{key: string(key)})
+		if h == nil {
+			return nil, ErrNoHealthyHost
+		}
+
+		if host != nil && h != host {
+			return nil, ErrCrossSlot
+		}
+
+		host = h
+	}
+
+	return host, nil
+}
+
+// getUpstreamClient returns the connection to host, connects if not exists
+func (p *proxy) getUpstreamClient(host types.Host) *upstreamClient {
+	addr := host.AddressString()
+
+	p.mux.Lock()
+	client, ok := p.upstreams[addr]
+	p.mux.Unlock()
+
+	if ok {
+		return client
+	}
+
+	connectionData := host.CreateConnection(nil)
+	client = &upstreamClient{
+		proxy:      p,
+		addr:       addr,
+		connection: connectionData.Connection,
+	}
+
+	clusterStats := connectionData.HostInfo.ClusterInfo().Stats()
+	client.connection.SetStats(&types.ConnectionStats{
+		ReadTotal:    clusterStats.UpstreamBytesRead,
+		ReadCurrent:  clusterStats.UpstreamBytesReadCurrent,
+		WriteTotal:   clusterStats.UpstreamBytesWrite,
+		WriteCurrent: clusterStats.UpstreamBytesWriteCurrent,
+	})
+	client.connection.AddConnectionEventListener(client)
+	client.connection.FilterManager().AddReadFilter(client)
+
+	if err := client.connection.Connect(true); err != nil {
+		log.DefaultLogger.Errorf("redis proxy connect to %s failed: %v", addr, err)
+		return nil
+	}
+
+	client.connection.SetNoDelay(true)
+	clusterStats.UpstreamConnectionTotal.Inc(1)
+
+	p.mux.Lock()
+	p.upstreams[addr] = client
+	p.mux.Unlock()
+
+	return client
+}
+
+func (p *proxy) removeUpstreamClient(client *upstreamClient) {
+	p.mux.Lock()
+	if p.upstreams[client.addr] == client {
+		delete(p.upstreams, client.addr)
+	}
+	p.mux.Unlock()
+}
+
+// onReply sets the reply of the request, and writes replies of the finished requests in order
+func (p *proxy) onReply(req *request, reply []byte) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	req.reply = reply
+
+	for len(p.requests) > 0 && p.requests[0].reply != nil {
+		r := p.requests[0]
+		p.requests = p.requests[1:]
+
+		r.stats.Latency().Update(int64(time.Since(r.start) / time.Microsecond))
+		if r.reply[0] == '-' {
+			r.stats.Error().Inc(1)
+		}
+
+		p.readCallbacks.Connection().Write(buffer.NewIoBufferBytes(r.reply))
+	}
+}
+
+func (p *proxy) onDownstreamEvent(event types.ConnectionEvent) {
+	if !event.IsClose() {
+		return
+	}
+
+	p.stats.DownstreamConnectionActive().Dec(1)
+
+	p.mux.Lock()
+	clients := make([]*upstreamClient, 0, len(p.upstreams))
+	for _, client := range p.upstreams {
+		clients = append(clients, client)
+	}
+	p.mux.Unlock()
+
+	for _, client := range clients {
+		client.connection.Close(types.NoFlush, types.LocalClose)
+	}
+}
+
+// ConnectionEventListener
+// ReadFilter
+// upstreamClient is the connection to a host, replies are matched to commands in order
+type upstreamClient struct {
+	proxy      *proxy
+	addr       string
+	connection types.ClientConnection
+
+	mux     sync.Mutex
+	pending []*request
+	closed  bool
+}
+
+func (c *upstreamClient) send(req *request, data []byte) {
+	c.mux.Lock()
+
+	if c.closed {
+		c.mux.Unlock()
+		c.proxy.onReply(req, redis.ErrorReply(ErrUpstreamClosed.Error()))
+
+		return
+	}
+
+	c.pending = append(c.pending, req)
+	c.connection.Write(buffer.NewIoBufferBytes(data))
+	c.mux.Unlock()
+}
+
+func (c *upstreamClient) OnData(data types.IoBuffer) types.FilterStatus {
+	var broken bool
+
+	c.mux.Lock()
+	for data.Len() > 0 {
+		read, err := redis.ReplyLength(data.Bytes())
+		if err != nil || (read > 0 && len(c.pending) == 0) {
+			log.DefaultLogger.Errorf("redis proxy unexpected reply from %s, error = %v", c.addr, err)
+			broken = true
+			break
+		}
+
+		if read == 0 {
+			break
+		}
+
+		req := c.pending[0]
+		c.pending = c.pending[1:]
+
+		reply := make([]byte, read)
+		copy(reply, data.Bytes())
+		data.Drain(read)
+
+		c.proxy.onReply(req, reply)
+	}
+	c.mux.Unlock()
+
+	// pending commands are failed on close event
+	if broken {
+		c.connection.Close(types.NoFlush, types.LocalClose)
+	}
+
+	return types.StopIteration
+}
+
+func (c *upstreamClient) OnNewConnection() types.FilterStatus {
+	return types.Continue
+}
+
+func (c *upstreamClient) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {}
+
+func (c *upstreamClient) OnEvent(event types.ConnectionEvent) {
+	if !event.IsClose() && event != types.ConnectFailed && event != types.ConnectTimeout {
+		return
+	}
+
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return
+	}
+	c.closed = true
+	pending := c.pending
+	c.pending = nil
+	c.mux.Unlock()
+
+	c.proxy.removeUpstreamClient(c)
+
+	for _, req := range pending {
+		c.proxy.onReply(req, redis.ErrorReply(ErrUpstreamClosed.Error()))
+	}
+}
+
+// ConnectionEventListener
+type downstreamCallbacks struct {
+	proxy *proxy
+}
+
+func (dc *downstreamCallbacks) OnEvent(event types.ConnectionEvent) {
+	dc.proxy.onDownstreamEvent(event)
+}
+
+// LoadBalancerContext
+// lbContext exposes the key as header to the consistent hash load balancer
+type lbContext struct {
+	key string
+}
+
+func (ctx *lbContext) ComputeHashKey() types.HashedValue {
+	return ""
+}
+
+func (ctx *lbContext) MetadataMatchCriteria() types.MetadataMatchCriteria {
+	return nil
+}
+
+func (ctx *lbContext) DownstreamConnection() net.Conn {
+	return nil
+}
+
+func (ctx *lbContext) DownstreamHeaders() map[string]string {
+	return map[string]string{redis.HeaderKey: ctx.key}
+}
+
+func (ctx *lbContext) ShouldSelectAnotherHost(host types.Host) bool {
+	return false
+}
@@ -0,0 +1,117 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redisproxy
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/redis"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/alipay/sofamosn/pkg/upstream/cluster"
+)
+
+func newRedisCluster(addrs ...string) types.Cluster {
+	log.InitDefaultLogger("", log.INFO)
+
+	c := cluster.NewCluster(v2.Cluster{
+		Name:           "redis_cluster",
+		ClusterType:    v2.SIMPLE_CLUSTER,
+		LbType:         v2.LB_CONSISTENT_HASH,
+		ConsistentHash: v2.ConsistentHashConfig{HeaderKey: redis.HeaderKey},
+	}, nil, false)
+
+	var hosts []types.Host
+	for _, addr := range addrs {
+		hosts = append(hosts, cluster.NewHost(v2.Host{Address: addr}, c.Info()))
+	}
+	c.(types.SimpleCluster).UpdateHosts(hosts)
+
+	return c
+}
+
+func keysOf(keys ...string) [][]byte {
+	var result [][]byte
+	for _, key := range keys {
+		result = append(result, []byte(key))
+	}
+
+	return result
+}
+
+func TestChooseHostByKey(t *testing.T) {
+	c := newRedisCluster("127.0.0.1:6379", "127.0.0.1:6380", "127.0.0.1:6381")
+	lb := c.Info().LBInstance()
+
+	hits := make(map[string]int)
+	mapping := make(map[string]types.Host)
+
+	for i := 0; i < 300; i++ {
+		key := "user:" + strconv.Itoa(i)
+
+		host, err := chooseHost(lb, keysOf(key))
+		if err != nil || host == nil {
+			t.Fatalf("choose host for %s failed: %v", key, err)
+		}
+		mapping[key] = host
+		hits[host.AddressString()]++
+	}
+
+	// the same key is always sent to the same host
+	for key, host := range mapping {
+		if got, _ := chooseHost(lb, keysOf(key)); got != host {
+			t.Errorf("key %s should be sent to %s, got %s", key, host.AddressString(), got.AddressString())
+		}
+	}
+
+	if len(hits) != 3 {
+		t.Errorf("keys should be sharded to all hosts, got %v", hits)
+	}
+	for addr, n := range hits {
+		if n < 30 {
+			t.Errorf("too few keys are sharded to %s: %d", addr, n)
+		}
+	}
+}
+
+func TestChooseHostMultiKey(t *testing.T) {
+	c := newRedisCluster("127.0.0.1:6379", "127.0.0.1:6380")
+	lb := c.Info().LBInstance()
+
+	// find two keys on different hosts
+	first, _ := chooseHost(lb, keysOf("k0"))
+	var other string
+	for i := 1; other == ""; i++ {
+		if host, _ := chooseHost(lb, keysOf("k"+strconv.Itoa(i))); host != first {
+			other = "k" + strconv.Itoa(i)
+		}
+	}
+
+	if host, err := chooseHost(lb, keysOf("k0", "k0")); err != nil || host != first {
+		t.Errorf("keys on the same host should be passed through, got %v %v", host, err)
+	}
+
+	if _, err := chooseHost(lb, keysOf("k0", other)); err != ErrCrossSlot {
+		t.Errorf("keys on different hosts should be rejected, got %v", err)
+	}
+
+	if _, err := chooseHost(newRedisCluster().Info().LBInstance(), keysOf("k0")); err != ErrNoHealthyHost {
+		t.Errorf("cluster without host should fail, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redisproxy
+
+import (
+	"github.com/alipay/sofamosn/pkg/protocol/redis"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	RedisProxyStatsNamespace = "redis_proxy"
+
+	DownstreamConnectionTotal  = "downstream_connection_total"
+	DownstreamConnectionActive = "downstream_connection_active"
+
+	CommandTotal   = "total"
+	CommandError   = "error"
+	CommandLatency = "latency_us"
+
+	// commands not supported are counted together
+	unsupportedCommand = "unsupported"
+	pingCommand        = "ping"
+)
+
+var (
+	globalStats  *proxyStats
+	commandStats = make(map[string]*redisCommandStats)
+)
+
+func init() {
+	globalStats = newProxyStats(RedisProxyStatsNamespace)
+
+	for _, name := range append(redis.Commands(), pingCommand, unsupportedCommand) {
+		commandStats[name] = newRedisCommandStats(name)
+	}
+}
+
+type proxyStats struct {
+	stats *stats.Stats
+}
+
+func newProxyStats(namespace string) *proxyStats {
+	return &proxyStats{
+		stats: stats.NewStats(namespace).AddCounter(DownstreamConnectionTotal).AddCounter(DownstreamConnectionActive),
+	}
+}
+
+func (s *proxyStats) DownstreamConnectionTotal() metrics.Counter {
+	return s.stats.Counter(DownstreamConnectionTotal)
+}
+
+func (s *proxyStats) DownstreamConnectionActive() metrics.Counter {
+	return s.stats.Counter(DownstreamConnectionActive)
+}
+
+func (s *proxyStats) String() string {
+	return s.stats.String()
+}
+
+// redisCommandStats are the metrics of a command, registered as redis_proxy.command.<name>.<metric>
+type redisCommandStats struct {
+	stats *stats.Stats
+}
+
+func newRedisCommandStats(name string) *redisCommandStats {
+	namespace := RedisProxyStatsNamespace + ".command." + name
+
+	return &redisCommandStats{
+		stats: stats.NewStats(namespace).AddCounter(CommandTotal).AddCounter(CommandError).AddHistogram(CommandLatency),
+	}
+}
+
+// getCommandStats returns the metrics of command name
+func getCommandStats(name string) *redisCommandStats {
+	if s, ok := commandStats[name]; ok {
+		return s
+	}
+
+	return commandStats[unsupportedCommand]
+}
+
+func (s *redisCommandStats) Total() metrics.Counter {
+	return s.stats.Counter(CommandTotal)
+}
+
+func (s *redisCommandStats) Error() metrics.Counter {
+	return s.stats.Counter(CommandError)
+}
+
+func (s *redisCommandStats) Latency() metrics.Histogram {
+	return s.stats.Histogram(CommandLatency)
+}
+
+func (s *redisCommandStats) String() string {
+	return s.stats.String()
+}
@@ -25,6 +25,12 @@ import (
 	"reflect"
 )
 
+var globalStats *proxyStats
+
+func init() {
+	globalStats = newProxyStats(TcpProxyStatsNamespace)
+}
+
 // ReadFilter
 type proxy struct {
 	config              ProxyConfig
@@ -37,6 +43,9 @@ type proxy struct {
 
 	upstreamConnecting bool
 
+	// stats
+	stats *proxyStats
+
 	accessLogs []types.AccessLog
 }
 
@@ -45,7 +54,11 @@ func NewProxy(config *v2.TcpProxy, clusterManager types.ClusterManager, ctx cont
 		config:         NewProxyConfig(config),
 		clusterManager: clusterManager,
 		requestInfo:    network.NewRequestInfo(),
-		accessLogs:     ctx.Value(types.ContextKeyAccessLogs).([]types.AccessLog),
+		stats:          globalStats,
+	}
+
+	if accessLogs, ok := ctx.Value(types.ContextKeyAccessLogs).([]types.AccessLog); ok {
+		p.accessLogs = accessLogs
 	}
 
 	p.upstreamCallbacks = &upstreamCallbacks{
@@ -80,7 +93,15 @@ func (p *proxy) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {
 
 	p.readCallbacks.Connection().SetReadDisable(true)
 
-	// TODO: set downstream connection stats
+	p.readCallbacks.Connection().SetStats(&types.ConnectionStats{
+		ReadTotal:    p.stats.DownstreamBytesRead(),
+		ReadCurrent:  p.stats.DownstreamBytesReadCurrent(),
+		WriteTotal:   p.stats.DownstreamBytesWrite(),
+		WriteCurrent: p.stats.DownstreamBytesWriteCurrent(),
+	})
+
+	p.stats.DownstreamConnectionTotal().Inc(1)
+	p.stats.DownstreamConnectionActive().Inc(1)
 }
 
 func (p *proxy) initializeUpstreamConnection() types.FilterStatus {
@@ -118,6 +139,13 @@ func (p *proxy) initializeUpstreamConnection() types.FilterStatus {
 	clusterConnectionResource.Increase()
 
 	upstreamConnection := connectionData.Connection
+	upstreamClusterStats := connectionData.HostInfo.ClusterInfo().Stats()
+	upstreamConnection.SetStats(&types.ConnectionStats{
+		ReadTotal:    upstreamClusterStats.UpstreamBytesRead,
+		ReadCurrent:  upstreamClusterStats.UpstreamBytesReadCurrent,
+		WriteTotal:   upstreamClusterStats.UpstreamBytesWrite,
+		WriteCurrent: upstreamClusterStats.UpstreamBytesWriteCurrent,
+	})
 	upstreamConnection.AddConnectionEventListener(p.upstreamCallbacks)
 	upstreamConnection.FilterManager().AddReadFilter(p.upstreamCallbacks)
 	p.upstreamConnection = upstreamConnection
@@ -127,13 +155,13 @@ func (p *proxy) initializeUpstreamConnection() types.FilterStatus {
 	p.requestInfo.OnUpstreamHostSelected(connectionData.HostInfo)
 	p.requestInfo.SetUpstreamLocalAddress(upstreamConnection.LocalAddr())
 
-	// TODO: update upstream stats
+	upstreamClusterStats.UpstreamConnectionTotal.Inc(1)
+	upstreamClusterStats.UpstreamConnectionActive.Inc(1)
 
 	return types.Continue
 }
 
 func (p *proxy) closeUpstreamConnection() {
-	// TODO: finalize upstream connection stats
 	p.upstreamConnection.Close(types.NoFlush, types.LocalClose)
 }
 
@@ -174,13 +202,17 @@ func (p *proxy) onUpstreamEvent(event types.ConnectionEvent) {
 		p.closeUpstreamConnection()
 		p.initializeUpstreamConnection()
 	case types.ConnectFailed:
+		p.finalizeUpstreamConnectionStats()
+
 		p.requestInfo.SetResponseFlag(types.UpstreamConnectionFailure)
+		p.onInitFailure(ConnectFailed)
 	}
 }
 
 func (p *proxy) finalizeUpstreamConnectionStats() {
 	upstreamClusterInfo := p.readCallbacks.UpstreamHost().ClusterInfo()
 	upstreamClusterInfo.ResourceManager().Connections().Decrease()
+	upstreamClusterInfo.Stats().UpstreamConnectionActive.Dec(1)
 }
 
 func (p *proxy) onConnectionSuccess() {
@@ -197,6 +229,12 @@ func (p *proxy) onDownstreamEvent(event types.ConnectionEvent) {
 	}
 
 	if event.IsClose() {
+		p.stats.DownstreamConnectionDestroy().Inc(1)
+		p.stats.DownstreamConnectionActive().Dec(1)
+
+		log.DefaultLogger.Debugf("tcp proxy downstream connection %d closed, bytes received = %d, bytes sent = %d",
+			p.readCallbacks.Connection().Id(), p.requestInfo.BytesReceived(), p.requestInfo.BytesSent())
+
 		for _, al := range p.accessLogs {
 			al.Log(nil, nil, p.requestInfo)
 		}
@@ -245,7 +283,7 @@ func (pc *proxyConfig) GetRouteFromEntries(connection types.Connection) string {
 			continue
 		}
 
-		if len(r.destinationAddrs) != 0 && r.destinationAddrs.Contains(connection.LocalAddr()) {
+		if len(r.destinationAddrs) != 0 && !r.destinationAddrs.Contains(connection.LocalAddr()) {
 			continue
 		}
 
@@ -0,0 +1,167 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package authz
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// globMatch reports whether s matches the pattern, '*' matches any sequence of characters
+// including '/' and '.', so that one pattern covers a SPIFFE id path or a package
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	// position of the last '*' in pattern, and the position in s it is matched from
+	star, match := -1, 0
+	p, i := 0, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, i
+			p++
+		case p < len(pattern) && pattern[p] == s[i]:
+			p++
+			i++
+		case star >= 0:
+			// let the last '*' match one more character
+			match++
+			p, i = star+1, match
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+func ruleMatches(rule *v2.AuthzRule, identity, className, method string) bool {
+	return globMatch(rule.Identity, identity) &&
+		globMatch(rule.ClassName, className) &&
+		globMatch(rule.Method, method)
+}
+
+// types.StreamReceiverFilter
+// The rules are evaluated in order on headers, the first matching rule decides whether the request
+// is forwarded, denied requests are replied without forwarding.
+type authzFilter struct {
+	context context.Context
+
+	config *v2.Authz
+	denied bool
+	cb     types.StreamReceiverFilterCallbacks
+}
+
+func newAuthzFilter(context context.Context, config *v2.Authz) *authzFilter {
+	return &authzFilter{
+		context: context,
+		config:  config,
+	}
+}
+
+func (f *authzFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	// identity is empty for connections without verified client certificate
+	identity, _ := f.context.Value(types.ContextKeyPeerIdentity).(string)
+
+	var className, method string
+	if requestContext := f.cb.RequestContext(); requestContext != nil {
+		className = requestContext.ClassName()
+		method = requestContext.Method()
+	}
+
+	if f.action(identity, className, method) == v2.AuthzAllow {
+		filterStats.RequestAllowed().Inc(1)
+
+		return types.FilterHeadersStatusContinue
+	}
+
+	filterStats.RequestDenied().Inc(1)
+	log.ByContext(f.context).Debugf("[Authz] request denied, identity = %s, class name = %s, method = %s",
+		identity, className, method)
+
+	f.denied = true
+	f.cb.RequestInfo().SetResponseFlag(types.Unauthorized)
+
+	// the response status is replied as is by sofarpc, other protocols reply 403
+	headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] = strconv.Itoa(int(f.config.DenyStatus))
+	headers[types.HeaderStatus] = strconv.Itoa(types.PermissionDeniedCode)
+	f.cb.AppendHeaders(headers, true)
+
+	return types.FilterHeadersStatusStopIteration
+}
+
+// action returns the action of the first matching rule, or the default action if no rule matches
+func (f *authzFilter) action(identity, className, method string) v2.AuthzAction {
+	for i := range f.config.Rules {
+		if rule := &f.config.Rules[i]; ruleMatches(rule, identity, className, method) {
+			return rule.Action
+		}
+	}
+
+	return f.config.DefaultAction
+}
+
+func (f *authzFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.denied {
+		return types.FilterDataStatusStopIterationNoBuffer
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *authzFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.denied {
+		return types.FilterTrailersStatusStopIteration
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *authzFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.cb = cb
+}
+
+func (f *authzFilter) OnDestroy() {}
+
+// ~~ factory
+type AuthzFilterConfigFactory struct {
+	Authz *v2.Authz
+}
+
+func (f *AuthzFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newAuthzFilter(context, f.Authz)
+	callbacks.AddStreamReceiverFilter(filter)
+}
+
+func CreateAuthzFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	return &AuthzFilterConfigFactory{
+		Authz: config.ParseAuthzFilter(conf),
+	}, nil
+}
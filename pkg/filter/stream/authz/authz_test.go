@@ -0,0 +1,145 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// runRequest runs a bolt request of the class and method from the peer through the filter,
+// denied requests are checked to be replied with the deny status
+func runRequest(t *testing.T, config *v2.Authz, identity, className, method string) (*filtertest.ReceiverCallbacks, bool) {
+	headers := map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): className,
+		sofarpc.HeaderMethodName:                            method,
+	}
+	ctx := context.Background()
+	if identity != "" {
+		ctx = context.WithValue(ctx, types.ContextKeyPeerIdentity, identity)
+	}
+
+	cb := filtertest.NewReceiverCallbacks(nil, headers)
+	return cb, filtertest.RunRequest(t, newAuthzFilter(ctx, config), cb, headers, "request")
+}
+
+func expectDenied(t *testing.T, cb *filtertest.ReceiverCallbacks, status int16) {
+	filtertest.ExpectReply(t, cb, types.PermissionDeniedCode, status, types.Unauthorized)
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"", "anything", true},
+		{"*", "", true},
+		{"com.alipay.pay.PayService", "com.alipay.pay.PayService", true},
+		{"com.alipay.pay.*", "com.alipay.pay.PayService", true},
+		{"com.alipay.pay.*", "com.alipay.payment.PayService", false},
+		{"spiffe://cluster.local/ns/*/sa/client", "spiffe://cluster.local/ns/default/sa/client", true},
+		{"spiffe://cluster.local/ns/*/sa/client", "spiffe://cluster.local/ns/default/sa/server", false},
+		{"*Service", "com.alipay.pay.PayService", true},
+		{"*Pay*Service*", "com.alipay.pay.PayService", true},
+		{"query*", "refund", false},
+	}
+
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.s); got != c.match {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.s, got, c.match)
+		}
+	}
+}
+
+func TestAuthzAllowRule(t *testing.T) {
+	config := &v2.Authz{
+		Rules: []v2.AuthzRule{
+			{Identity: "spiffe://cluster.local/ns/default/*", ClassName: "com.alipay.pay.*", Action: v2.AuthzAllow},
+		},
+		DefaultAction: v2.AuthzDeny,
+		DenyStatus:    sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION,
+	}
+	allowed := filterStats.RequestAllowed().Count()
+
+	if cb, forwarded := runRequest(t, config, "spiffe://cluster.local/ns/default/sa/client", "com.alipay.pay.PayService", "pay"); !forwarded || cb.RespHeaders != nil {
+		t.Errorf("request matching the allow rule should be forwarded")
+	}
+	if got := filterStats.RequestAllowed().Count() - allowed; got != 1 {
+		t.Errorf("expect 1 request allowed, got %d", got)
+	}
+
+	// other namespace
+	cb, forwarded := runRequest(t, config, "spiffe://cluster.local/ns/test/sa/client", "com.alipay.pay.PayService", "pay")
+	if forwarded {
+		t.Fatalf("request of other identity should be denied")
+	}
+	expectDenied(t, cb, sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION)
+}
+
+func TestAuthzDenyRule(t *testing.T) {
+	config := &v2.Authz{
+		Rules: []v2.AuthzRule{
+			// rules are evaluated in order, the first matching one decides
+			{ClassName: "com.alipay.pay.*", Method: "refund", Action: v2.AuthzDeny},
+			{ClassName: "com.alipay.pay.*", Action: v2.AuthzAllow},
+		},
+		DefaultAction: v2.AuthzAllow,
+		DenyStatus:    sofarpc.RESPONSE_STATUS_NO_PROCESSOR,
+	}
+	denied := filterStats.RequestDenied().Count()
+
+	cb, forwarded := runRequest(t, config, "", "com.alipay.pay.PayService", "refund")
+	if forwarded {
+		t.Fatalf("request matching the deny rule should be denied")
+	}
+	expectDenied(t, cb, sofarpc.RESPONSE_STATUS_NO_PROCESSOR)
+	if got := filterStats.RequestDenied().Count() - denied; got != 1 {
+		t.Errorf("expect 1 request denied, got %d", got)
+	}
+
+	if _, forwarded := runRequest(t, config, "", "com.alipay.pay.PayService", "pay"); !forwarded {
+		t.Errorf("request matching the allow rule should be forwarded")
+	}
+}
+
+func TestAuthzDefaultDeny(t *testing.T) {
+	config := &v2.Authz{
+		Rules: []v2.AuthzRule{
+			{Identity: "spiffe://cluster.local/ns/default/sa/admin", Action: v2.AuthzAllow},
+		},
+		DefaultAction: v2.AuthzDeny,
+		DenyStatus:    sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION,
+	}
+
+	// no rule matches, including requests without peer identity
+	for _, identity := range []string{"spiffe://cluster.local/ns/default/sa/client", ""} {
+		cb, forwarded := runRequest(t, config, identity, "com.alipay.pay.PayService", "pay")
+		if forwarded {
+			t.Fatalf("request of %q matching no rule should be denied by default", identity)
+		}
+		expectDenied(t, cb, sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION)
+	}
+
+	if _, forwarded := runRequest(t, config, "spiffe://cluster.local/ns/default/sa/admin", "com.alipay.pay.PayService", "pay"); !forwarded {
+		t.Errorf("request matching the allow rule should be forwarded")
+	}
+}
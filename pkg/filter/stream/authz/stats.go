@@ -0,0 +1,51 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package authz
+
+import (
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	RequestAllowed = "request_allowed"
+	RequestDenied  = "request_denied"
+)
+
+var filterStats = newAuthzStats("authz")
+
+type authzStats struct {
+	stats *stats.Stats
+}
+
+func newAuthzStats(namespace string) *authzStats {
+	return &authzStats{
+		stats: stats.NewStats(namespace).AddCounter(RequestAllowed).AddCounter(RequestDenied),
+	}
+}
+
+func (s *authzStats) RequestAllowed() metrics.Counter {
+	return s.stats.Counter(RequestAllowed)
+}
+
+func (s *authzStats) RequestDenied() metrics.Counter {
+	return s.stats.Counter(RequestDenied)
+}
+
+func (s *authzStats) String() string {
+	return s.stats.String()
+}
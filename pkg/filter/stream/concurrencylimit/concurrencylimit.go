@@ -0,0 +1,153 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrencylimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// types.StreamReceiverFilter
+// Requests of all connections of the listener share the limiter, the latency of a request is
+// measured from being admitted to the end of the stream. Requests over the limit are replied
+// without forwarding. If priority classes are configured, a request is admitted only while the
+// in-flight requests are under the share of the limit of its class.
+type concurrencyLimitFilter struct {
+	context context.Context
+
+	limiter  *gradientLimiter
+	priority *priorityClasses
+	tags     stats.Tags
+	admitted time.Time
+	shed     bool
+	cb       types.StreamReceiverFilterCallbacks
+}
+
+func newConcurrencyLimitFilter(context context.Context, limiter *gradientLimiter, priority *priorityClasses) *concurrencyLimitFilter {
+	listenerName, _ := context.Value(types.ContextKeyListenerName).(string)
+
+	return &concurrencyLimitFilter{
+		context:  context,
+		limiter:  limiter,
+		priority: priority,
+		tags:     stats.Tags{TagListener: listenerName},
+	}
+}
+
+func (f *concurrencyLimitFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	filterStats.RequestTotal().Inc(1)
+
+	var class *priorityClass
+	limitPercent := uint32(100)
+	if f.priority != nil {
+		class = f.priority.classOf(headers)
+		limitPercent = class.limitPercent
+	}
+
+	if f.limiter.acquireShare(limitPercent) {
+		f.admitted = time.Now()
+		f.reportLimit()
+
+		return types.FilterHeadersStatusContinue
+	}
+
+	limit, _ := f.limiter.currentLimit()
+
+	filterStats.RequestShed().Inc(1)
+	if class != nil {
+		stats.GetSink().Count(RequestShedMetric, 1, stats.Tags{TagListener: f.tags[TagListener], TagPriorityClass: class.name})
+		log.ByContext(f.context).Debugf("[ConcurrencyLimit] request of priority class %s shed, limit = %d, percent = %d",
+			class.name, limit, limitPercent)
+	} else {
+		stats.GetSink().Count(RequestShedMetric, 1, f.tags)
+		log.ByContext(f.context).Debugf("[ConcurrencyLimit] request shed, limit = %d", limit)
+	}
+
+	f.shed = true
+	f.cb.RequestInfo().SetResponseFlag(types.ConcurrencyLimited)
+
+	headers[types.HeaderStatus] = strconv.Itoa(types.RateLimitedCode)
+	f.cb.AppendHeaders(headers, true)
+
+	return types.FilterHeadersStatusStopIteration
+}
+
+func (f *concurrencyLimitFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.shed {
+		return types.FilterDataStatusStopIterationNoBuffer
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *concurrencyLimitFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.shed {
+		return types.FilterTrailersStatusStopIteration
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+// reportLimit records the change of the limit to the metrics sink
+func (f *concurrencyLimitFilter) reportLimit() {
+	if _, delta := f.limiter.currentLimit(); delta != 0 {
+		stats.GetSink().Gauge(LimitMetric, delta, f.tags)
+	}
+}
+
+func (f *concurrencyLimitFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.cb = cb
+}
+
+func (f *concurrencyLimitFilter) OnDestroy() {
+	if f.admitted.IsZero() {
+		return
+	}
+
+	f.limiter.release(time.Since(f.admitted))
+	f.admitted = time.Time{}
+	f.reportLimit()
+}
+
+// ~~ factory
+type ConcurrencyLimitFilterConfigFactory struct {
+	ConcurrencyLimit *v2.ConcurrencyLimit
+	limiter          *gradientLimiter
+	priority         *priorityClasses
+}
+
+func (f *ConcurrencyLimitFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newConcurrencyLimitFilter(context, f.limiter, f.priority)
+	callbacks.AddStreamReceiverFilter(filter)
+}
+
+func CreateConcurrencyLimitFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	concurrencyLimit := config.ParseConcurrencyLimitFilter(conf)
+
+	return &ConcurrencyLimitFilterConfigFactory{
+		ConcurrencyLimit: concurrencyLimit,
+		limiter:          newGradientLimiter(concurrencyLimit),
+		priority:         newPriorityClasses(concurrencyLimit),
+	}, nil
+}
@@ -0,0 +1,289 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrencylimit
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func newTestLimiter(minLimit, maxLimit uint32) *gradientLimiter {
+	return newGradientLimiter(&v2.ConcurrencyLimit{
+		MinLimit:     minLimit,
+		MaxLimit:     maxLimit,
+		SampleWindow: time.Second,
+	})
+}
+
+// runWindow runs requests of the latency through the limiter for a sample window,
+// returns the limit after the window
+func runWindow(t *testing.T, l *gradientLimiter, latency time.Duration) float64 {
+	now := l.windowStart
+	for i := 0; i < 10; i++ {
+		if !l.acquire() {
+			t.Fatalf("request %d in window should be admitted, limit %f", i, l.limit)
+		}
+		now = now.Add(l.window / 10)
+		l.releaseAt(now, latency)
+	}
+
+	return l.limit
+}
+
+func TestGradientLimiterLatency(t *testing.T) {
+	l := newTestLimiter(10, 1000)
+
+	// stable latency keeps the limit at max
+	for i := 0; i < 5; i++ {
+		if limit := runWindow(t, l, 10*time.Millisecond); limit != 1000 {
+			t.Fatalf("window %d: limit should stay at max with stable latency, got %f", i, limit)
+		}
+	}
+
+	// jitter within tolerance doesn't lower the limit
+	if limit := runWindow(t, l, 14*time.Millisecond); limit != 1000 {
+		t.Fatalf("limit should not be lowered by latency within tolerance, got %f", limit)
+	}
+
+	// rising latency lowers the limit each window, by half at most
+	last := l.limit
+	for i := 0; i < 3; i++ {
+		limit := runWindow(t, l, 100*time.Millisecond)
+		if limit >= last || limit < last/2 {
+			t.Fatalf("window %d: limit should be lowered by half at most with rising latency, from %f to %f", i, last, limit)
+		}
+		last = limit
+	}
+	if last > 200 {
+		t.Errorf("limit should be lowered under 200, got %f", last)
+	}
+
+	// the limit recovers as latency drops
+	for i := 0; i < 5; i++ {
+		limit := runWindow(t, l, 10*time.Millisecond)
+		if limit <= last {
+			t.Fatalf("window %d: limit should grow with dropping latency, from %f to %f", i, last, limit)
+		}
+		last = limit
+	}
+	for i := 0; i < 100 && l.limit < 1000; i++ {
+		runWindow(t, l, 10*time.Millisecond)
+	}
+	if l.limit != 1000 {
+		t.Errorf("limit should recover to max, got %f", l.limit)
+	}
+}
+
+func TestGradientLimiterBounds(t *testing.T) {
+	l := newTestLimiter(50, 100)
+	runWindow(t, l, time.Millisecond)
+
+	// the limit is not lowered under min however latency rises
+	for i := 0; i < 3; i++ {
+		runWindow(t, l, time.Second)
+	}
+	if l.limit != 50 {
+		t.Errorf("limit should be lowered to min, got %f", l.limit)
+	}
+
+	// requests over the limit are not admitted until one is done
+	for i := 0; i < 50; i++ {
+		if !l.acquire() {
+			t.Fatalf("request %d under the limit should be admitted", i)
+		}
+	}
+	if l.acquire() {
+		t.Fatalf("request over the limit should not be admitted")
+	}
+	l.release(time.Second)
+	if !l.acquire() {
+		t.Errorf("request should be admitted after one is done")
+	}
+}
+
+type limitSink struct {
+	stats.MetricsSink
+	limit int64
+	shed  int64
+	// shed requests by priority class
+	classShed map[string]int64
+}
+
+func (s *limitSink) Count(name string, value int64, tags stats.Tags) {
+	if name == RequestShedMetric && tags[TagListener] == "test_listener" {
+		s.shed += value
+		if s.classShed != nil {
+			s.classShed[tags[TagPriorityClass]] += value
+		}
+	}
+}
+
+func (s *limitSink) Gauge(name string, delta int64, tags stats.Tags) {
+	if name == LimitMetric && tags[TagListener] == "test_listener" {
+		s.limit += delta
+	}
+}
+
+func TestConcurrencyLimitFilterShed(t *testing.T) {
+	factory, _ := CreateConcurrencyLimitFilterFactory(map[string]interface{}{
+		"min_limit": float64(1),
+		"max_limit": float64(2),
+	})
+	limiter := factory.(*ConcurrencyLimitFilterConfigFactory).limiter
+	sink := &limitSink{}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+	total, shed := filterStats.RequestTotal().Count(), filterStats.RequestShed().Count()
+
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "test_listener")
+	newFilter := func() (*concurrencyLimitFilter, *filtertest.ReceiverCallbacks) {
+		cb := filtertest.NewReceiverCallbacks(nil, nil)
+		f := newConcurrencyLimitFilter(ctx, limiter, nil)
+		f.SetDecoderFilterCallbacks(cb)
+		return f, cb
+	}
+
+	// requests in flight up to the limit are forwarded, the excess one is shed
+	var inFlight []*concurrencyLimitFilter
+	for i := 0; i < 2; i++ {
+		f, _ := newFilter()
+		if status := f.OnDecodeHeaders(map[string]string{}, true); status != types.FilterHeadersStatusContinue {
+			t.Fatalf("request %d under the limit should be forwarded", i)
+		}
+		inFlight = append(inFlight, f)
+	}
+
+	f, cb := newFilter()
+	if status := f.OnDecodeHeaders(map[string]string{}, false); status != types.FilterHeadersStatusStopIteration {
+		t.Fatalf("request over the limit should be shed")
+	}
+	if cb.ReplyHeaders()[types.HeaderStatus] != strconv.Itoa(types.RateLimitedCode) {
+		t.Errorf("shed request should be replied busy, got %v", cb.RespHeaders)
+	}
+	if !cb.RequestInfo().GetResponseFlag(types.ConcurrencyLimited) {
+		t.Errorf("shed request should be flagged concurrency limited")
+	}
+	if status := f.OnDecodeData(nil, true); status != types.FilterDataStatusStopIterationNoBuffer {
+		t.Errorf("shed request should not buffer data, got %v", status)
+	}
+	f.OnDestroy()
+
+	// a slot is returned once a request is done
+	inFlight[0].OnDestroy()
+	f, _ = newFilter()
+	if status := f.OnDecodeHeaders(map[string]string{}, true); status != types.FilterHeadersStatusContinue {
+		t.Errorf("request should be forwarded after one is done")
+	}
+	f.OnDestroy()
+	inFlight[1].OnDestroy()
+
+	if got := filterStats.RequestTotal().Count() - total; got != 4 {
+		t.Errorf("expect 4 requests checked, got %d", got)
+	}
+	if got := filterStats.RequestShed().Count() - shed; got != 1 {
+		t.Errorf("expect 1 request shed, got %d", got)
+	}
+	if sink.shed != 1 || sink.limit != 2 {
+		t.Errorf("expect limit 2 and 1 request shed recorded, got limit %d and %d shed", sink.limit, sink.shed)
+	}
+	if limiter.inFlight != 0 {
+		t.Errorf("expect no request in flight, got %d", limiter.inFlight)
+	}
+}
+
+func TestConcurrencyLimitFilterPriority(t *testing.T) {
+	factory, _ := CreateConcurrencyLimitFilterFactory(map[string]interface{}{
+		"min_limit":       float64(4),
+		"max_limit":       float64(4),
+		"priority_header": "priority",
+		"priority_classes": []interface{}{
+			map[string]interface{}{"name": "high", "values": []interface{}{"high"}, "limit_percent": float64(100)},
+			map[string]interface{}{"name": "low", "values": []interface{}{"low"}, "limit_percent": float64(50)},
+		},
+	})
+	f := factory.(*ConcurrencyLimitFilterConfigFactory)
+	sink := &limitSink{classShed: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "test_listener")
+	var inFlight []*concurrencyLimitFilter
+	admit := func(priority string) bool {
+		filter := newConcurrencyLimitFilter(ctx, f.limiter, f.priority)
+		filter.SetDecoderFilterCallbacks(filtertest.NewReceiverCallbacks(nil, nil))
+		headers := map[string]string{}
+		if priority != "" {
+			headers["priority"] = priority
+		}
+		if filter.OnDecodeHeaders(headers, true) != types.FilterHeadersStatusContinue {
+			filter.OnDestroy()
+			return false
+		}
+		inFlight = append(inFlight, filter)
+		return true
+	}
+
+	// low priority requests may use half of the limit
+	for i := 0; i < 2; i++ {
+		if !admit("low") {
+			t.Fatalf("low priority request %d under half of the limit should be admitted", i)
+		}
+	}
+	if admit("low") {
+		t.Errorf("low priority request over half of the limit should be shed")
+	}
+	// requests without the header or with unknown values are of the lowest class by default
+	if admit("") || admit("unknown") {
+		t.Errorf("request of the default class over half of the limit should be shed")
+	}
+
+	// high priority requests are admitted up to the limit
+	for i := 0; i < 2; i++ {
+		if !admit("high") {
+			t.Fatalf("high priority request %d under the limit should be admitted", i)
+		}
+	}
+	if admit("high") {
+		t.Errorf("high priority request over the limit should be shed")
+	}
+
+	// a slot returned by a low priority request is still not available to low priority requests
+	inFlight[0].OnDestroy()
+	if admit("low") {
+		t.Errorf("low priority request should be shed while high priority ones hold the limit")
+	}
+	if !admit("high") {
+		t.Errorf("high priority request should be admitted after one is done")
+	}
+
+	if sink.classShed["low"] != 4 || sink.classShed["high"] != 1 {
+		t.Errorf("expect 4 low and 1 high priority requests shed, got %v", sink.classShed)
+	}
+	for _, filter := range inFlight[1:] {
+		filter.OnDestroy()
+	}
+	if f.limiter.inFlight != 0 {
+		t.Errorf("expect no request in flight, got %d", f.limiter.inFlight)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrencylimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+)
+
+const (
+	// latency may rise to tolerance times of the long term latency before the limit is lowered
+	latencyTolerance = 1.5
+	// the limit is lowered by at most half in a window
+	minGradient = 0.5
+	// the long term latency follows the window latency by 1/longWindows each window,
+	// so that a lasting latency change becomes the new baseline
+	longWindows = 20
+)
+
+// gradientLimiter limits the in-flight requests, the limit is recomputed every sample window by the
+// gradient of the long term latency to the average latency of requests done in the window:
+// limit = limit * gradient + sqrt(limit). The limit is lowered as latency rises, and grows by
+// sqrt(limit), the queue allowed, each window while latency is stable or dropping
+type gradientLimiter struct {
+	mux      sync.Mutex
+	minLimit float64
+	maxLimit float64
+	window   time.Duration
+
+	limit    float64
+	inFlight uint32
+	longRTT  float64 // in nanoseconds
+
+	windowStart time.Time
+	windowSum   time.Duration
+	windowCount int64
+
+	// limit last reported to the metrics sink
+	reported int64
+}
+
+func newGradientLimiter(config *v2.ConcurrencyLimit) *gradientLimiter {
+	return &gradientLimiter{
+		minLimit:    float64(config.MinLimit),
+		maxLimit:    float64(config.MaxLimit),
+		window:      config.SampleWindow,
+		limit:       float64(config.MaxLimit),
+		windowStart: time.Now(),
+	}
+}
+
+// acquire takes an in-flight slot, returns false if the limit is reached
+func (l *gradientLimiter) acquire() bool {
+	return l.acquireShare(100)
+}
+
+// acquireShare takes an in-flight slot if the in-flight requests are under percent of the limit,
+// so that the requests allowed a smaller share are rejected first as the limit is approached
+func (l *gradientLimiter) acquireShare(percent uint32) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.inFlight >= uint32(l.limit*float64(percent)/100) {
+		return false
+	}
+
+	l.inFlight++
+	return true
+}
+
+// release returns the slot of a request done with the latency
+func (l *gradientLimiter) release(latency time.Duration) {
+	l.releaseAt(time.Now(), latency)
+}
+
+func (l *gradientLimiter) releaseAt(now time.Time, latency time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.inFlight--
+	l.windowSum += latency
+	l.windowCount++
+
+	if now.Sub(l.windowStart) < l.window {
+		return
+	}
+
+	l.update(float64(l.windowSum) / float64(l.windowCount))
+
+	l.windowStart = now
+	l.windowSum = 0
+	l.windowCount = 0
+}
+
+// update recomputes the limit with the average latency of a window, it is called with lock held
+func (l *gradientLimiter) update(rtt float64) {
+	if l.longRTT == 0 {
+		l.longRTT = rtt
+	}
+
+	gradient := math.Max(minGradient, math.Min(1, latencyTolerance*l.longRTT/rtt))
+	limit := l.limit*gradient + math.Sqrt(l.limit)
+
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, limit))
+	l.longRTT += (rtt - l.longRTT) / longWindows
+}
+
+// currentLimit returns the limit, and the change since the limit last reported
+func (l *gradientLimiter) currentLimit() (int64, int64) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	limit := int64(l.limit)
+	delta := limit - l.reported
+	l.reported = limit
+
+	return limit, delta
+}
@@ -0,0 +1,67 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrencylimit
+
+import (
+	"github.com/alipay/sofamosn/pkg/api/v2"
+)
+
+// priorityClass may use limitPercent of the limit
+type priorityClass struct {
+	name         string
+	limitPercent uint32
+}
+
+// priorityClasses maps requests to the priority classes by the value of the priority header
+type priorityClasses struct {
+	header       string
+	classes      map[string]*priorityClass // keyed by the header value
+	defaultClass *priorityClass
+}
+
+// newPriorityClasses returns nil if no priority classes configured
+func newPriorityClasses(config *v2.ConcurrencyLimit) *priorityClasses {
+	if len(config.PriorityClasses) == 0 {
+		return nil
+	}
+
+	p := &priorityClasses{
+		header:  config.PriorityHeader,
+		classes: make(map[string]*priorityClass),
+	}
+
+	for _, c := range config.PriorityClasses {
+		class := &priorityClass{name: c.Name, limitPercent: c.LimitPercent}
+		for _, value := range c.Values {
+			p.classes[value] = class
+		}
+		if c.Name == config.DefaultPriorityClass {
+			p.defaultClass = class
+		}
+	}
+
+	return p
+}
+
+// classOf returns the class of the request, the default class if the header is absent or not mapped
+func (p *priorityClasses) classOf(headers map[string]string) *priorityClass {
+	if class, ok := p.classes[headers[p.header]]; ok {
+		return class
+	}
+
+	return p.defaultClass
+}
@@ -0,0 +1,60 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrencylimit
+
+import (
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	RequestTotal = "request_total"
+	RequestShed  = "request_shed"
+)
+
+// the limit and the shed requests recorded to the metrics sink, tagged by the listener,
+// and the shed requests are also tagged by the priority class if priority classes configured
+const (
+	LimitMetric       = "mosn_concurrency_limit"
+	RequestShedMetric = "mosn_concurrency_limit_requests_shed_total"
+	TagListener       = "listener"
+	TagPriorityClass  = "priority_class"
+)
+
+var filterStats = newConcurrencyLimitStats("concurrency_limit")
+
+type concurrencyLimitStats struct {
+	stats *stats.Stats
+}
+
+func newConcurrencyLimitStats(namespace string) *concurrencyLimitStats {
+	return &concurrencyLimitStats{
+		stats: stats.NewStats(namespace).AddCounter(RequestTotal).AddCounter(RequestShed),
+	}
+}
+
+func (s *concurrencyLimitStats) RequestTotal() metrics.Counter {
+	return s.stats.Counter(RequestTotal)
+}
+
+func (s *concurrencyLimitStats) RequestShed() metrics.Counter {
+	return s.stats.Counter(RequestShed)
+}
+
+func (s *concurrencyLimitStats) String() string {
+	return s.stats.String()
+}
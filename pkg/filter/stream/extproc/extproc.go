@@ -0,0 +1,276 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extproc
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"google.golang.org/grpc"
+)
+
+// types.StreamReceiverFilter
+// Bolt requests are sent to the external processor once fully received, the request is stopped
+// until the returned mutations are applied, then it is forwarded or replied immediately.
+type extProcFilter struct {
+	context context.Context
+
+	config   *v2.ExtProc
+	clusters map[string]bool
+	client   ExternalProcessorClient
+
+	processing bool
+	replied    bool
+	headers    map[string]string
+	// cancels the processing call when the stream is destroyed
+	cancel context.CancelFunc
+	stop   chan struct{}
+	cb     types.StreamReceiverFilterCallbacks
+}
+
+func newExtProcFilter(context context.Context, config *v2.ExtProc, clusters map[string]bool, client ExternalProcessorClient) *extProcFilter {
+	return &extProcFilter{
+		context:  context,
+		config:   config,
+		clusters: clusters,
+		client:   client,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (f *extProcFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	if !sofarpc.IsSofaRequest(headers) || !f.matches() {
+		return types.FilterHeadersStatusContinue
+	}
+
+	f.processing = true
+	f.headers = headers
+	filterStats.RequestTotal().Inc(1)
+
+	if endStream {
+		f.process(nil)
+	}
+
+	return types.FilterHeadersStatusStopIteration
+}
+
+func (f *extProcFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if !f.processing {
+		return types.FilterDataStatusContinue
+	}
+
+	if f.replied {
+		return types.FilterDataStatusStopIterationNoBuffer
+	}
+
+	if endStream {
+		// buffer the content before processing starts, the request may be continued
+		// by the processing before this call returns
+		f.cb.AddDecodedData(buf, false)
+
+		var content []byte
+		if buffered := f.cb.DecodingBuffer(); buffered != nil {
+			content = append(content, buffered.Bytes()...)
+		}
+		f.process(content)
+	}
+
+	return types.FilterDataStatusStopIterationAndBuffer
+}
+
+func (f *extProcFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.processing {
+		return types.FilterTrailersStatusStopIteration
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *extProcFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.cb = cb
+}
+
+func (f *extProcFilter) OnDestroy() {
+	close(f.stop)
+
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// matches returns true if the request is routed to the configured clusters
+func (f *extProcFilter) matches() bool {
+	if len(f.clusters) == 0 {
+		return true
+	}
+
+	route := f.cb.Route()
+	if route == nil || route.RouteRule() == nil {
+		return false
+	}
+
+	return f.clusters[route.RouteRule().ClusterName()]
+}
+
+func (f *extProcFilter) process(content []byte) {
+	request := &ProcessingRequest{
+		ClassName: f.cb.RequestContext().ClassName(),
+		Headers:   make(map[string]string, len(f.headers)),
+		Content:   content,
+	}
+	for k, v := range f.headers {
+		// raw header entries are passed through unchanged, not processed
+		if k == sofarpc.HeaderRawHeaders {
+			continue
+		}
+		request.Headers[k] = v
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.config.Timeout)
+	f.cancel = cancel
+
+	go func() {
+		defer cancel()
+
+		response, err := f.client.Process(ctx, request)
+
+		select {
+		case <-f.stop:
+			// stream is destroyed during the processing
+			return
+		default:
+		}
+
+		if err != nil {
+			f.onProcessError(err)
+			return
+		}
+
+		f.onProcessed(response)
+	}()
+}
+
+func (f *extProcFilter) onProcessError(err error) {
+	filterStats.RequestFailed().Inc(1)
+	f.cb.RequestInfo().SetResponseFlag(types.ExtProcFailed)
+
+	if f.config.FailOpen {
+		log.ByContext(f.context).Warnf("[ExtProc] processing failed, forward request unmodified: %v", err)
+		f.cb.ContinueDecoding()
+		return
+	}
+
+	log.ByContext(f.context).Errorf("[ExtProc] processing failed, reject request: %v", err)
+	f.replied = true
+	f.headers[types.HeaderStatus] = strconv.Itoa(types.UpstreamOverFlowCode)
+	f.cb.AppendHeaders(f.headers, true)
+}
+
+func (f *extProcFilter) onProcessed(response *ProcessingResponse) {
+	if response.ImmediateResponse != nil {
+		f.replyImmediately(response.ImmediateResponse)
+		return
+	}
+
+	for _, name := range response.RemoveHeaders {
+		delete(f.headers, name)
+	}
+	for name, value := range response.SetHeaders {
+		f.headers[name] = value
+	}
+
+	if response.ReplaceContent {
+		if buf := f.cb.DecodingBuffer(); buf != nil {
+			buf.Reset()
+			buf.Write(response.Content)
+		} else if len(response.Content) > 0 {
+			f.cb.AddDecodedData(buffer.NewIoBufferBytes(response.Content), false)
+		}
+		f.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(len(response.Content))
+	}
+
+	f.cb.ContinueDecoding()
+}
+
+func (f *extProcFilter) replyImmediately(response *ImmediateResponse) {
+	log.ByContext(f.context).Debugf("[ExtProc] reply request immediately with status %d", response.Status)
+	f.replied = true
+
+	headers, err := sofarpc.BuildSofaRespMsg(f.context, f.headers, int16(response.Status))
+	if err != nil {
+		f.onProcessError(err)
+		return
+	}
+
+	switch cmd := headers.(type) {
+	case *sofarpc.BoltResponseCommand:
+		cmd.ContentLen = len(response.Content)
+	case *sofarpc.BoltV2ResponseCommand:
+		cmd.ContentLen = len(response.Content)
+	}
+
+	if len(response.Content) == 0 {
+		f.cb.AppendHeaders(headers, true)
+		return
+	}
+
+	f.cb.AppendHeaders(headers, false)
+	f.cb.AppendData(buffer.NewIoBufferBytes(response.Content), true)
+}
+
+// ~~ factory
+type ExtProcFilterConfigFactory struct {
+	ExtProc  *v2.ExtProc
+	clusters map[string]bool
+	client   ExternalProcessorClient
+}
+
+func (f *ExtProcFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newExtProcFilter(context, f.ExtProc, f.clusters, f.client)
+	callbacks.AddStreamReceiverFilter(filter)
+}
+
+func CreateExtProcFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	extProc := config.ParseExtProcFilter(conf)
+
+	// the connection is established in background and reconnected on failure
+	conn, err := grpc.Dial(extProc.Address, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	return newExtProcFilterFactory(extProc, NewExternalProcessorClient(conn)), nil
+}
+
+func newExtProcFilterFactory(extProc *v2.ExtProc, client ExternalProcessorClient) *ExtProcFilterConfigFactory {
+	clusters := make(map[string]bool, len(extProc.Clusters))
+	for _, cluster := range extProc.Clusters {
+		clusters[cluster] = true
+	}
+
+	return &ExtProcFilterConfigFactory{
+		ExtProc:  extProc,
+		clusters: clusters,
+		client:   client,
+	}
+}
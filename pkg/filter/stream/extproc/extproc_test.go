@@ -0,0 +1,229 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extproc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"google.golang.org/grpc"
+)
+
+// fakeProcessor is the external processor answering with the process func
+type fakeProcessor struct {
+	process  func(in *ProcessingRequest) *ProcessingResponse
+	requests chan *ProcessingRequest
+}
+
+func (p *fakeProcessor) Process(ctx context.Context, in *ProcessingRequest) (*ProcessingResponse, error) {
+	p.requests <- in
+	return p.process(in), nil
+}
+
+// startProcessor starts a fake external processor, returns its address and the stop function
+func startProcessor(t *testing.T, p *fakeProcessor) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	server := grpc.NewServer()
+	RegisterExternalProcessorServer(server, p)
+	go server.Serve(lis)
+
+	return lis.Addr().String(), server.Stop
+}
+
+func newBoltRequestHeaders() map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode):      strconv.Itoa(int(sofarpc.RPC_REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderVersion):      "1",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        "7",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec):        "1",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName):    "com.alipay.test.TestService",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen):   "5",
+		"token": "secret",
+	}
+}
+
+// runRequest runs a bolt request with content through the filter, waits until it is continued or replied,
+// returns the callbacks and whether the request is continued
+func runRequest(t *testing.T, factory *ExtProcFilterConfigFactory, cluster string, headers map[string]string) (*filtertest.ReceiverCallbacks, bool) {
+	cb := filtertest.NewReceiverCallbacks(filtertest.NewRoute(cluster), headers)
+	f := newExtProcFilter(context.Background(), factory.ExtProc, factory.clusters, factory.client)
+	f.SetDecoderFilterCallbacks(cb)
+	defer f.OnDestroy()
+
+	if status := f.OnDecodeHeaders(headers, false); status != types.FilterHeadersStatusStopIteration {
+		t.Fatalf("processed request should stop on headers, got %s", status)
+	}
+	if status := f.OnDecodeData(buffer.NewIoBufferString("hello"), true); status != types.FilterDataStatusStopIterationAndBuffer {
+		t.Fatalf("processed request should buffer data, got %s", status)
+	}
+
+	return cb, cb.Wait(t)
+}
+
+func newTestFactory(t *testing.T, config *v2.ExtProc) *ExtProcFilterConfigFactory {
+	conn, err := grpc.Dial(config.Address, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+
+	return newExtProcFilterFactory(config, NewExternalProcessorClient(conn))
+}
+
+func TestExtProcMutateRequest(t *testing.T) {
+	p := &fakeProcessor{
+		process: func(in *ProcessingRequest) *ProcessingResponse {
+			return &ProcessingResponse{
+				SetHeaders:     map[string]string{"zone": "gz00a"},
+				RemoveHeaders:  []string{"token"},
+				ReplaceContent: true,
+				Content:        []byte("hello, world"),
+			}
+		},
+		requests: make(chan *ProcessingRequest, 1),
+	}
+	address, stop := startProcessor(t, p)
+	defer stop()
+
+	factory := newTestFactory(t, &v2.ExtProc{Address: address, Timeout: time.Second})
+	headers := newBoltRequestHeaders()
+	cb, continued := runRequest(t, factory, "test", headers)
+
+	in := <-p.requests
+	if in.ClassName != "com.alipay.test.TestService" || in.Headers["token"] != "secret" || string(in.Content) != "hello" {
+		t.Errorf("unexpected processing request: %v", in)
+	}
+
+	if !continued || cb.RespHeaders != nil {
+		t.Fatalf("mutated request should be forwarded")
+	}
+	if headers["zone"] != "gz00a" {
+		t.Errorf("header should be set, got %v", headers)
+	}
+	if _, ok := headers["token"]; ok {
+		t.Errorf("header should be removed, got %v", headers)
+	}
+	if cb.DecodingBuffer().String() != "hello, world" || headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] != "12" {
+		t.Errorf("content should be replaced, got %s, content length %s",
+			cb.DecodingBuffer().String(), headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)])
+	}
+}
+
+func TestExtProcImmediateResponse(t *testing.T) {
+	p := &fakeProcessor{
+		process: func(in *ProcessingRequest) *ProcessingResponse {
+			return &ProcessingResponse{
+				ImmediateResponse: &ImmediateResponse{
+					Status:  int32(sofarpc.RESPONSE_STATUS_SUCCESS),
+					Content: []byte("cached"),
+				},
+			}
+		},
+		requests: make(chan *ProcessingRequest, 1),
+	}
+	address, stop := startProcessor(t, p)
+	defer stop()
+
+	factory := newTestFactory(t, &v2.ExtProc{Address: address, Timeout: time.Second})
+	cb, continued := runRequest(t, factory, "test", newBoltRequestHeaders())
+
+	if continued {
+		t.Fatalf("request replied immediately should not be forwarded")
+	}
+
+	resp, ok := cb.RespHeaders.(*sofarpc.BoltResponseCommand)
+	if !ok {
+		t.Fatalf("expect bolt response, got %v", cb.RespHeaders)
+	}
+	if resp.ReqId != 7 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS || resp.ContentLen != len("cached") {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if cb.RespData == nil || cb.RespData.String() != "cached" {
+		t.Errorf("unexpected response content: %v", cb.RespData)
+	}
+}
+
+func TestExtProcUnmatchedCluster(t *testing.T) {
+	factory := newExtProcFilterFactory(&v2.ExtProc{Address: "127.0.0.1:1", Clusters: []string{"pay"}}, nil)
+
+	f := newExtProcFilter(context.Background(), factory.ExtProc, factory.clusters, factory.client)
+	headers := newBoltRequestHeaders()
+	if !filtertest.RunRequest(t, f, filtertest.NewReceiverCallbacks(filtertest.NewRoute("user"), headers), headers, "hello") {
+		t.Errorf("request of unmatched cluster should not be processed")
+	}
+}
+
+// unavailableAddress returns an address nothing listens on
+func unavailableAddress(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	lis.Close()
+
+	return lis.Addr().String()
+}
+
+func TestExtProcFailOpen(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	factory := newTestFactory(t, &v2.ExtProc{Address: unavailableAddress(t), Timeout: 100 * time.Millisecond, FailOpen: true})
+	headers := newBoltRequestHeaders()
+	cb, continued := runRequest(t, factory, "test", headers)
+
+	if !continued || cb.RespHeaders != nil {
+		t.Errorf("request should be forwarded if processor is unavailable in fail open mode")
+	}
+	if headers["token"] != "secret" || cb.DecodingBuffer().String() != "hello" {
+		t.Errorf("request should be forwarded unmodified")
+	}
+	if !cb.RequestInfo().GetResponseFlag(types.ExtProcFailed) {
+		t.Errorf("request should be flagged")
+	}
+}
+
+func TestExtProcFailClosed(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	factory := newTestFactory(t, &v2.ExtProc{Address: unavailableAddress(t), Timeout: 100 * time.Millisecond})
+	cb, continued := runRequest(t, factory, "test", newBoltRequestHeaders())
+
+	if continued {
+		t.Fatalf("request should be rejected if processor is unavailable in fail closed mode")
+	}
+	headers, ok := cb.RespHeaders.(map[string]string)
+	if !ok || headers[types.HeaderStatus] != strconv.Itoa(types.UpstreamOverFlowCode) {
+		t.Errorf("unexpected reject response: %v", cb.RespHeaders)
+	}
+	if !cb.RequestInfo().GetResponseFlag(types.ExtProcFailed) {
+		t.Errorf("request should be flagged")
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extproc
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// Messages of the ExternalProcessor service defined in extproc.proto, the field tags
+// follow the proto definition so they are encoded in protobuf wire format.
+
+type ProcessingRequest struct {
+	ClassName string            `protobuf:"bytes,1,opt,name=class_name,json=className,proto3" json:"class_name,omitempty"`
+	Headers   map[string]string `protobuf:"bytes,2,rep,name=headers" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Content   []byte            `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+}
+
+func (m *ProcessingRequest) Reset()         { *m = ProcessingRequest{} }
+func (m *ProcessingRequest) String() string { return proto.CompactTextString(m) }
+func (*ProcessingRequest) ProtoMessage()    {}
+
+type ProcessingResponse struct {
+	SetHeaders        map[string]string  `protobuf:"bytes,1,rep,name=set_headers,json=setHeaders" json:"set_headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	RemoveHeaders     []string           `protobuf:"bytes,2,rep,name=remove_headers,json=removeHeaders" json:"remove_headers,omitempty"`
+	ReplaceContent    bool               `protobuf:"varint,3,opt,name=replace_content,json=replaceContent,proto3" json:"replace_content,omitempty"`
+	Content           []byte             `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	ImmediateResponse *ImmediateResponse `protobuf:"bytes,5,opt,name=immediate_response,json=immediateResponse" json:"immediate_response,omitempty"`
+}
+
+func (m *ProcessingResponse) Reset()         { *m = ProcessingResponse{} }
+func (m *ProcessingResponse) String() string { return proto.CompactTextString(m) }
+func (*ProcessingResponse) ProtoMessage()    {}
+
+type ImmediateResponse struct {
+	Status  int32  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	Content []byte `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+}
+
+func (m *ImmediateResponse) Reset()         { *m = ImmediateResponse{} }
+func (m *ImmediateResponse) String() string { return proto.CompactTextString(m) }
+func (*ImmediateResponse) ProtoMessage()    {}
@@ -0,0 +1,90 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extproc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+const processMethod = "/mosn.extproc.v1.ExternalProcessor/Process"
+
+// ExternalProcessorClient is the client of the ExternalProcessor service
+type ExternalProcessorClient interface {
+	Process(ctx context.Context, in *ProcessingRequest, opts ...grpc.CallOption) (*ProcessingResponse, error)
+}
+
+type externalProcessorClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewExternalProcessorClient(cc *grpc.ClientConn) ExternalProcessorClient {
+	return &externalProcessorClient{cc}
+}
+
+func (c *externalProcessorClient) Process(ctx context.Context, in *ProcessingRequest, opts ...grpc.CallOption) (*ProcessingResponse, error) {
+	out := new(ProcessingResponse)
+	if err := c.cc.Invoke(ctx, processMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ExternalProcessorServer is implemented by external processing services written in go
+type ExternalProcessorServer interface {
+	Process(ctx context.Context, in *ProcessingRequest) (*ProcessingResponse, error)
+}
+
+func RegisterExternalProcessorServer(s *grpc.Server, srv ExternalProcessorServer) {
+	s.RegisterService(&externalProcessorServiceDesc, srv)
+}
+
+func processHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProcessingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(ExternalProcessorServer).Process(ctx, in)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: processMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExternalProcessorServer).Process(ctx, req.(*ProcessingRequest))
+	}
+
+	return interceptor(ctx, in, info, handler)
+}
+
+var externalProcessorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mosn.extproc.v1.ExternalProcessor",
+	HandlerType: (*ExternalProcessorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Process",
+			Handler:    processHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "extproc.proto",
+}
@@ -0,0 +1,51 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extproc
+
+import (
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	RequestTotal  = "request_total"
+	RequestFailed = "request_failed"
+)
+
+var filterStats = newExtProcStats("extproc")
+
+type extProcStats struct {
+	stats *stats.Stats
+}
+
+func newExtProcStats(namespace string) *extProcStats {
+	return &extProcStats{
+		stats: stats.NewStats(namespace).AddCounter(RequestTotal).AddCounter(RequestFailed),
+	}
+}
+
+func (s *extProcStats) RequestTotal() metrics.Counter {
+	return s.stats.Counter(RequestTotal)
+}
+
+func (s *extProcStats) RequestFailed() metrics.Counter {
+	return s.stats.Counter(RequestFailed)
+}
+
+func (s *extProcStats) String() string {
+	return s.stats.String()
+}
@@ -19,115 +19,196 @@ package faultinject
 
 import (
 	"context"
-
 	"math/rand"
+	"regexp"
+	"strconv"
 	"sync/atomic"
 	"time"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/config"
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
+// headerMatcher limits the requests injected, all requests match if name is empty
+type headerMatcher struct {
+	name  string
+	value string
+	regex *regexp.Regexp
+}
+
+func newHeaderMatcher(header v2.HeaderMatcher) (*headerMatcher, error) {
+	matcher := &headerMatcher{
+		name:  header.Name,
+		value: header.Value,
+	}
+
+	if header.Regex {
+		regex, err := regexp.Compile(header.Value)
+		if err != nil {
+			return nil, err
+		}
+		matcher.regex = regex
+	}
+
+	return matcher, nil
+}
+
+func (m *headerMatcher) matches(headers map[string]string) bool {
+	if m.name == "" {
+		return true
+	}
+
+	value, ok := headers[m.name]
+	if !ok {
+		return false
+	}
+
+	switch {
+	case m.regex != nil:
+		return m.regex.MatchString(value)
+	case m.value != "":
+		return value == m.value
+	default:
+		// header presence only
+		return true
+	}
+}
+
+// types.StreamReceiverFilter
+// The decision to delay or abort is made once per request on headers, aborted requests are replied
+// without forwarding, delayed requests are forwarded after the delay.
 type faultInjectFilter struct {
 	context context.Context
 
 	delayPercent  uint32
-	delayDuration uint64
-	delaying      uint32
-	cb            types.StreamReceiverFilterCallbacks
+	delayDuration time.Duration
+	abortPercent  uint32
+	abortStatus   int16
+	matcher       *headerMatcher
+
+	delaying uint32
+	aborted  bool
+	stop     chan struct{}
+	cb       types.StreamReceiverFilterCallbacks
 }
 
-func NewFaultInjectFilter(context context.Context, config *v2.FaultInject) *faultInjectFilter {
+func newFaultInjectFilter(context context.Context, config *v2.FaultInject, matcher *headerMatcher) *faultInjectFilter {
 	return &faultInjectFilter{
 		context:       context,
 		delayPercent:  config.DelayPercent,
-		delayDuration: config.DelayDuration,
+		delayDuration: time.Duration(config.DelayDuration),
+		abortPercent:  config.AbortPercent,
+		abortStatus:   config.AbortStatus,
+		matcher:       matcher,
+		stop:          make(chan struct{}),
 	}
 }
 
 func (f *faultInjectFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
-	f.tryInjectDelay()
+	if f.matcher != nil && !f.matcher.matches(headers) {
+		return types.FilterHeadersStatusContinue
+	}
+
+	if hit(f.abortPercent) {
+		f.injectAbort(headers)
+
+		return types.FilterHeadersStatusStopIteration
+	}
+
+	if f.delayDuration > 0 && hit(f.delayPercent) {
+		f.injectDelay()
 
-	if atomic.LoadUint32(&f.delaying) > 0 {
 		return types.FilterHeadersStatusStopIteration
-	} else {
-		return types.FilterHeadersStatusContinue
 	}
+
+	return types.FilterHeadersStatusContinue
 }
 
 func (f *faultInjectFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
-	f.tryInjectDelay()
+	if f.aborted {
+		return types.FilterDataStatusStopIterationNoBuffer
+	}
 
 	if atomic.LoadUint32(&f.delaying) > 0 {
 		return types.FilterDataStatusStopIterationAndBuffer
-	} else {
-		return types.FilterDataStatusContinue
 	}
+
+	return types.FilterDataStatusContinue
 }
 
 func (f *faultInjectFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
-	f.tryInjectDelay()
-
-	if atomic.LoadUint32(&f.delaying) > 0 {
+	if f.aborted || atomic.LoadUint32(&f.delaying) > 0 {
 		return types.FilterTrailersStatusStopIteration
-	} else {
-		return types.FilterTrailersStatusContinue
 	}
+
+	return types.FilterTrailersStatusContinue
 }
 
 func (f *faultInjectFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
 	f.cb = cb
 }
 
-func (f *faultInjectFilter) OnDestroy() {}
+func (f *faultInjectFilter) OnDestroy() {
+	close(f.stop)
+}
 
-func (f *faultInjectFilter) tryInjectDelay() {
-	if atomic.LoadUint32(&f.delaying) > 0 {
-		return
-	}
+func (f *faultInjectFilter) injectAbort(headers map[string]string) {
+	log.ByContext(f.context).Debugf("[FaultInject] abort request with status %d", f.abortStatus)
 
-	duration := f.getDelayDuration()
-
-	if duration > 0 {
-		if atomic.CompareAndSwapUint32(&f.delaying, 0, 1) {
-			go func() {
-				select {
-				case <-time.After(time.Duration(duration) * time.Millisecond):
-					atomic.StoreUint32(&f.delaying, 0)
-					log.ByContext(f.context).Debugf("[FaultInject] Continue after delay")
-					f.cb.ContinueDecoding()
-				}
-			}()
-		}
-	}
-}
+	f.aborted = true
+	f.cb.RequestInfo().SetResponseFlag(types.FaultInjected)
 
-func (fi *faultInjectFilter) getDelayDuration() uint64 {
-	if fi.delayPercent == 0 {
-		return 0
-	}
+	// the response status is replied as is by sofarpc, other protocols reply the mapped http status
+	headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] = strconv.Itoa(int(f.abortStatus))
+	headers[types.HeaderStatus] = strconv.Itoa(sofarpc.ResponseStatusToHttpStatus(f.abortStatus))
+	f.cb.AppendHeaders(headers, true)
+}
 
-	if uint32(rand.Intn(100))+1 > fi.delayPercent {
-		return 0
-	}
+func (f *faultInjectFilter) injectDelay() {
+	atomic.StoreUint32(&f.delaying, 1)
+	f.cb.RequestInfo().SetResponseFlag(types.DelayInjected)
+
+	go func() {
+		select {
+		case <-time.After(f.delayDuration):
+			atomic.StoreUint32(&f.delaying, 0)
+			log.ByContext(f.context).Debugf("[FaultInject] Continue after delay")
+			f.cb.ContinueDecoding()
+		case <-f.stop:
+			// stream is destroyed during the delay
+		}
+	}()
+}
 
-	return fi.delayDuration
+// hit returns true for percent% of the calls
+func hit(percent uint32) bool {
+	return percent > 0 && uint32(rand.Intn(100)) < percent
 }
 
 // ~~ factory
 type FaultInjectFilterConfigFactory struct {
 	FaultInject *v2.FaultInject
+	matcher     *headerMatcher
 }
 
 func (f *FaultInjectFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
-	filter := NewFaultInjectFilter(context, f.FaultInject)
+	filter := newFaultInjectFilter(context, f.FaultInject, f.matcher)
 	callbacks.AddStreamReceiverFilter(filter)
 }
 
 func CreateFaultInjectFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	faultInject := config.ParseFaultInjectFilter(conf)
+
+	matcher, err := newHeaderMatcher(faultInject.Header)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FaultInjectFilterConfigFactory{
-		FaultInject: config.ParseFaultInjectFilter(conf),
+		FaultInject: faultInject,
+		matcher:     matcher,
 	}, nil
 }
@@ -0,0 +1,174 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package faultinject
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func newTestFilter(t *testing.T, config *v2.FaultInject) (*faultInjectFilter, *filtertest.ReceiverCallbacks) {
+	matcher, err := newHeaderMatcher(config.Header)
+	if err != nil {
+		t.Fatalf("invalid header matcher: %v", err)
+	}
+
+	cb := filtertest.NewReceiverCallbacks(nil, nil)
+	f := newFaultInjectFilter(context.Background(), config, matcher)
+	f.SetDecoderFilterCallbacks(cb)
+
+	return f, cb
+}
+
+// runs n requests, returns the number of requests stopped by the filter
+func runRequests(t *testing.T, config *v2.FaultInject, n int, headers map[string]string) int {
+	stopped := 0
+	for i := 0; i < n; i++ {
+		requestHeaders := make(map[string]string, len(headers))
+		for k, v := range headers {
+			requestHeaders[k] = v
+		}
+
+		f, _ := newTestFilter(t, config)
+		if f.OnDecodeHeaders(requestHeaders, false) == types.FilterHeadersStatusStopIteration {
+			stopped++
+		}
+		f.OnDestroy()
+	}
+
+	return stopped
+}
+
+func TestFaultInjectAbort(t *testing.T) {
+	f, cb := newTestFilter(t, &v2.FaultInject{AbortPercent: 100, AbortStatus: sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY})
+
+	if status := f.OnDecodeHeaders(map[string]string{}, false); status != types.FilterHeadersStatusStopIteration {
+		t.Fatalf("aborted request should stop iteration, got %s", status)
+	}
+	if headers := cb.ReplyHeaders(); headers == nil ||
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] != strconv.Itoa(int(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)) ||
+		headers[types.HeaderStatus] == strconv.Itoa(types.SuccessCode) {
+		t.Errorf("unexpected abort response: %v", cb.RespHeaders)
+	}
+	if !cb.RequestInfo().GetResponseFlag(types.FaultInjected) {
+		t.Errorf("aborted request should be flagged")
+	}
+
+	// body of the aborted request is dropped
+	if status := f.OnDecodeData(nil, true); status != types.FilterDataStatusStopIterationNoBuffer {
+		t.Errorf("data of aborted request should be dropped, got %s", status)
+	}
+}
+
+func TestFaultInjectDelay(t *testing.T) {
+	f, cb := newTestFilter(t, &v2.FaultInject{DelayPercent: 100, DelayDuration: uint64(20 * time.Millisecond)})
+
+	start := time.Now()
+	if status := f.OnDecodeHeaders(map[string]string{}, false); status != types.FilterHeadersStatusStopIteration {
+		t.Fatalf("delayed request should stop iteration, got %s", status)
+	}
+	if status := f.OnDecodeData(nil, true); status != types.FilterDataStatusStopIterationAndBuffer {
+		t.Errorf("data of delayed request should be buffered, got %s", status)
+	}
+	if !cb.RequestInfo().GetResponseFlag(types.DelayInjected) {
+		t.Errorf("delayed request should be flagged")
+	}
+
+	select {
+	case <-cb.Continued:
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("request continued after %v, expect at least 20ms", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("delayed request is not continued")
+	}
+
+	if cb.RespHeaders != nil {
+		t.Errorf("delayed request should not be replied")
+	}
+}
+
+func TestFaultInjectDelayDestroyed(t *testing.T) {
+	f, cb := newTestFilter(t, &v2.FaultInject{DelayPercent: 100, DelayDuration: uint64(20 * time.Millisecond)})
+
+	f.OnDecodeHeaders(map[string]string{}, false)
+	f.OnDestroy()
+
+	select {
+	case <-cb.Continued:
+		t.Errorf("destroyed stream should not be continued")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFaultInjectPercent(t *testing.T) {
+	const n = 10000
+
+	for _, percent := range []uint32{0, 30, 100} {
+		abort := &v2.FaultInject{AbortPercent: percent, AbortStatus: sofarpc.RESPONSE_STATUS_UNKNOWN}
+		delay := &v2.FaultInject{DelayPercent: percent, DelayDuration: uint64(time.Hour)}
+
+		for _, config := range []*v2.FaultInject{abort, delay} {
+			stopped := runRequests(t, config, n, map[string]string{})
+
+			// the rest requests pass through, 5% deviation is allowed for the random hit
+			expected := n * int(percent) / 100
+			if stopped < expected-n/20 || stopped > expected+n/20 ||
+				(percent == 0 || percent == 100) && stopped != expected {
+				t.Errorf("percent %d: %d of %d requests injected, config %+v", percent, stopped, n, config)
+			}
+		}
+	}
+}
+
+func TestFaultInjectHeaderMatch(t *testing.T) {
+	cases := []struct {
+		header  v2.HeaderMatcher
+		headers map[string]string
+		matched bool
+	}{
+		{v2.HeaderMatcher{}, map[string]string{}, true},
+		{v2.HeaderMatcher{Name: "fault"}, map[string]string{}, false},
+		{v2.HeaderMatcher{Name: "fault"}, map[string]string{"fault": "any"}, true},
+		{v2.HeaderMatcher{Name: "fault", Value: "on"}, map[string]string{"fault": "off"}, false},
+		{v2.HeaderMatcher{Name: "fault", Value: "on"}, map[string]string{"fault": "on"}, true},
+		{v2.HeaderMatcher{Name: "app", Value: "test-.*", Regex: true}, map[string]string{"app": "test-app"}, true},
+		{v2.HeaderMatcher{Name: "app", Value: "test-.*", Regex: true}, map[string]string{"app": "prod-app"}, false},
+	}
+
+	for i, c := range cases {
+		config := &v2.FaultInject{AbortPercent: 100, AbortStatus: sofarpc.RESPONSE_STATUS_UNKNOWN, Header: c.header}
+		if stopped := runRequests(t, config, 1, c.headers); (stopped == 1) != c.matched {
+			t.Errorf("case %d: expect matched %v, got stopped %d", i, c.matched, stopped)
+		}
+	}
+
+	if _, err := CreateFaultInjectFilterFactory(map[string]interface{}{
+		"abort_percent": 100.0,
+		"abort_status":  3.0,
+		"header":        map[string]interface{}{"name": "app", "value": "(", "regex": true},
+	}); err == nil {
+		t.Errorf("expect error on invalid regex")
+	}
+}
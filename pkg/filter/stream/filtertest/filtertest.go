@@ -0,0 +1,193 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package filtertest provides the mocks shared by the tests of stream filters
+package filtertest
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/network"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// RouteRule is the route rule to the cluster, with the max request bytes of the route
+type RouteRule struct {
+	types.RouteRule
+	Cluster  string
+	MaxBytes uint64
+}
+
+func (r *RouteRule) ClusterName() string {
+	return r.Cluster
+}
+
+func (r *RouteRule) MaxRequestBytes() uint64 {
+	return r.MaxBytes
+}
+
+type Route struct {
+	types.Route
+	Rule *RouteRule
+}
+
+func (r *Route) RouteRule() types.RouteRule {
+	return r.Rule
+}
+
+// NewRoute returns the route to the cluster
+func NewRoute(cluster string) *Route {
+	return &Route{Rule: &RouteRule{Cluster: cluster}}
+}
+
+// ReceiverCallbacks records the data buffered by the filter, and the reply of the filter
+type ReceiverCallbacks struct {
+	types.StreamReceiverFilterCallbacks
+	route          types.Route
+	requestInfo    types.RequestInfo
+	requestContext types.RequestContext
+	buf            types.IoBuffer
+
+	RespHeaders interface{}
+	RespData    types.IoBuffer
+	// signaled when the filter continues decoding or ends the reply
+	Continued chan struct{}
+	Replied   chan struct{}
+}
+
+// NewReceiverCallbacks returns the callbacks of a request on the route, the request context
+// is decoded from the headers as proxy does before filters run
+func NewReceiverCallbacks(route types.Route, headers map[string]string) *ReceiverCallbacks {
+	cb := &ReceiverCallbacks{
+		route:       route,
+		requestInfo: network.NewRequestInfo(),
+		Continued:   make(chan struct{}, 1),
+		Replied:     make(chan struct{}, 1),
+	}
+	if headers != nil {
+		cb.requestContext = sofarpc.NewRequestContext(headers)
+	}
+
+	return cb
+}
+
+func (cb *ReceiverCallbacks) Route() types.Route {
+	return cb.route
+}
+
+func (cb *ReceiverCallbacks) RequestInfo() types.RequestInfo {
+	return cb.requestInfo
+}
+
+func (cb *ReceiverCallbacks) RequestContext() types.RequestContext {
+	return cb.requestContext
+}
+
+func (cb *ReceiverCallbacks) DecodingBuffer() types.IoBuffer {
+	return cb.buf
+}
+
+func (cb *ReceiverCallbacks) AddDecodedData(buf types.IoBuffer, streamingFilter bool) {
+	if cb.buf == nil {
+		cb.buf = buffer.NewIoBuffer(buf.Len())
+	}
+	cb.buf.ReadFrom(buf)
+}
+
+func (cb *ReceiverCallbacks) ContinueDecoding() {
+	signal(cb.Continued)
+}
+
+func (cb *ReceiverCallbacks) AppendHeaders(headers interface{}, endStream bool) {
+	cb.RespHeaders = headers
+	if endStream {
+		signal(cb.Replied)
+	}
+}
+
+func (cb *ReceiverCallbacks) AppendData(buf types.IoBuffer, endStream bool) {
+	cb.RespData = buf
+	if endStream {
+		signal(cb.Replied)
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// ReplyHeaders returns the headers replied by the filter, nil if not replied with a headers map
+func (cb *ReceiverCallbacks) ReplyHeaders() map[string]string {
+	headers, _ := cb.RespHeaders.(map[string]string)
+	return headers
+}
+
+// Wait waits until the request is continued or replied, returns true if continued
+func (cb *ReceiverCallbacks) Wait(t *testing.T) bool {
+	select {
+	case <-cb.Continued:
+		return true
+	case <-cb.Replied:
+		return false
+	case <-time.After(2 * time.Second):
+		t.Fatalf("request is neither continued nor replied")
+	}
+
+	return false
+}
+
+// RunRequest runs the headers and content of a request through the filter, returns whether
+// the request is forwarded. The content of a request stopped on headers should not be buffered
+func RunRequest(t *testing.T, f types.StreamReceiverFilter, cb *ReceiverCallbacks, headers map[string]string, content string) bool {
+	f.SetDecoderFilterCallbacks(cb)
+	defer f.OnDestroy()
+
+	if f.OnDecodeHeaders(headers, false) == types.FilterHeadersStatusContinue {
+		if status := f.OnDecodeData(buffer.NewIoBufferString(content), true); status != types.FilterDataStatusContinue {
+			t.Fatalf("forwarded request should continue data, got %v", status)
+		}
+		return true
+	}
+
+	if status := f.OnDecodeData(buffer.NewIoBufferString(content), true); status != types.FilterDataStatusStopIterationNoBuffer {
+		t.Fatalf("stopped request should not buffer data, got %v", status)
+	}
+	return false
+}
+
+// ExpectReply checks the request is replied with the status code and bolt response status,
+// and flagged in request info
+func ExpectReply(t *testing.T, cb *ReceiverCallbacks, code int, status int16, flag types.ResponseFlag) {
+	headers := cb.ReplyHeaders()
+	if headers == nil {
+		t.Fatalf("request should be replied")
+	}
+	if headers[types.HeaderStatus] != strconv.Itoa(code) ||
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] != strconv.Itoa(int(status)) {
+		t.Errorf("unexpected reply of request: %v", headers)
+	}
+	if !cb.RequestInfo().GetResponseFlag(flag) {
+		t.Errorf("request should be flagged %v", flag)
+	}
+}
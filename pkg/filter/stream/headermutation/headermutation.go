@@ -0,0 +1,134 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package headermutation
+
+import (
+	"context"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// types.StreamReceiverFilter
+// types.StreamSenderFilter
+// headerMutationFilter runs a types.HeadersMutator on both request and response headers
+type headerMutationFilter struct {
+	context context.Context
+	mutator types.HeadersMutator
+
+	decoderCb types.StreamReceiverFilterCallbacks
+	encoderCb types.StreamSenderFilterCallbacks
+}
+
+func newHeaderMutationFilter(context context.Context, mutator types.HeadersMutator) *headerMutationFilter {
+	return &headerMutationFilter{
+		context: context,
+		mutator: mutator,
+	}
+}
+
+// request direction, called after decode and before upstream encode
+func (f *headerMutationFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	f.mutator.MutateRequestHeaders(headers)
+
+	return types.FilterHeadersStatusContinue
+}
+
+func (f *headerMutationFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	return types.FilterDataStatusContinue
+}
+
+func (f *headerMutationFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *headerMutationFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.decoderCb = cb
+}
+
+// response direction, called before downstream encode
+// responses built by mosn as protocol commands are not header maps, and are not mutated
+func (f *headerMutationFilter) AppendHeaders(headers interface{}, endStream bool) types.FilterHeadersStatus {
+	if headerMap, ok := headers.(map[string]string); ok {
+		f.mutator.MutateResponseHeaders(headerMap)
+	}
+
+	return types.FilterHeadersStatusContinue
+}
+
+func (f *headerMutationFilter) AppendData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	return types.FilterDataStatusContinue
+}
+
+func (f *headerMutationFilter) AppendTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *headerMutationFilter) SetEncoderFilterCallbacks(cb types.StreamSenderFilterCallbacks) {
+	f.encoderCb = cb
+}
+
+func (f *headerMutationFilter) OnDestroy() {}
+
+// types.HeadersMutator
+// configMutator adds and removes headers configured in header mutation filter
+type configMutator struct {
+	config *v2.HeaderMutation
+}
+
+func (m *configMutator) MutateRequestHeaders(headers map[string]string) {
+	mutate(headers, m.config.RequestHeadersToAdd, m.config.RequestHeadersToRemove)
+}
+
+func (m *configMutator) MutateResponseHeaders(headers map[string]string) {
+	mutate(headers, m.config.ResponseHeadersToAdd, m.config.ResponseHeadersToRemove)
+}
+
+func mutate(headers map[string]string, toAdd map[string]string, toRemove []string) {
+	for _, name := range toRemove {
+		delete(headers, name)
+	}
+
+	for name, value := range toAdd {
+		headers[name] = value
+	}
+}
+
+// ~~ factory
+type HeaderMutationFilterConfigFactory struct {
+	Mutator types.HeadersMutator
+}
+
+func (f *HeaderMutationFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newHeaderMutationFilter(context, f.Mutator)
+	callbacks.AddStreamReceiverFilter(filter)
+	callbacks.AddStreamSenderFilter(filter)
+}
+
+// NewHeadersMutatorFilterFactory creates a stream filter factory for a customized mutator, e.g. injecting tracing headers
+func NewHeadersMutatorFilterFactory(mutator types.HeadersMutator) types.StreamFilterChainFactory {
+	return &HeaderMutationFilterConfigFactory{
+		Mutator: mutator,
+	}
+}
+
+func CreateHeaderMutationFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	return NewHeadersMutatorFilterFactory(&configMutator{
+		config: config.ParseHeaderMutationFilter(conf),
+	}), nil
+}
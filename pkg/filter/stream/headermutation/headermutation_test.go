@@ -0,0 +1,120 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package headermutation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type mockFilterChainCallbacks struct {
+	types.FilterChainFactoryCallbacks
+	receivers []types.StreamReceiverFilter
+	senders   []types.StreamSenderFilter
+}
+
+func (cb *mockFilterChainCallbacks) AddStreamReceiverFilter(filter types.StreamReceiverFilter) {
+	cb.receivers = append(cb.receivers, filter)
+}
+
+func (cb *mockFilterChainCallbacks) AddStreamSenderFilter(filter types.StreamSenderFilter) {
+	cb.senders = append(cb.senders, filter)
+}
+
+func createFilters(t *testing.T, factory types.StreamFilterChainFactory) (types.StreamReceiverFilter, types.StreamSenderFilter) {
+	cb := &mockFilterChainCallbacks{}
+	factory.CreateFilterChain(context.Background(), cb)
+	if len(cb.receivers) != 1 || len(cb.senders) != 1 {
+		t.Fatalf("expect one receiver filter and one sender filter, but got %d, %d", len(cb.receivers), len(cb.senders))
+	}
+	return cb.receivers[0], cb.senders[0]
+}
+
+func TestHeaderMutationFilter(t *testing.T) {
+	factory, _ := CreateHeaderMutationFilterFactory(map[string]interface{}{
+		"request_headers_to_add":     map[string]interface{}{"injected": "mosn"},
+		"request_headers_to_remove":  []interface{}{"internal"},
+		"response_headers_to_add":    map[string]interface{}{"service": "overwritten"},
+		"response_headers_to_remove": []interface{}{"injected"},
+	})
+	receiver, sender := createFilters(t, factory)
+
+	reqHeaders := map[string]string{"service": "testSofa", "internal": "secret"}
+	if status := receiver.OnDecodeHeaders(reqHeaders, true); status != types.FilterHeadersStatusContinue {
+		t.Errorf("header mutation filter should not stop iteration")
+	}
+	if reqHeaders["injected"] != "mosn" {
+		t.Errorf("request header is not injected: %v", reqHeaders)
+	}
+	if _, ok := reqHeaders["internal"]; ok {
+		t.Errorf("request header is not stripped: %v", reqHeaders)
+	}
+	if reqHeaders["service"] != "testSofa" {
+		t.Errorf("unrelated request header changed: %v", reqHeaders)
+	}
+
+	respHeaders := map[string]string{"service": "testSofa", "injected": "mosn"}
+	if status := sender.AppendHeaders(respHeaders, true); status != types.FilterHeadersStatusContinue {
+		t.Errorf("header mutation filter should not stop iteration")
+	}
+	if _, ok := respHeaders["injected"]; ok {
+		t.Errorf("response header is not stripped: %v", respHeaders)
+	}
+	if respHeaders["service"] != "overwritten" {
+		t.Errorf("response header is not overwritten: %v", respHeaders)
+	}
+
+	// headers which are not header map are passed through
+	if status := sender.AppendHeaders(struct{}{}, true); status != types.FilterHeadersStatusContinue {
+		t.Errorf("header mutation filter should not stop iteration")
+	}
+}
+
+type recordMutator struct {
+	requests  int
+	responses int
+}
+
+func (m *recordMutator) MutateRequestHeaders(headers map[string]string) {
+	m.requests++
+	headers["trace-id"] = "1"
+}
+
+func (m *recordMutator) MutateResponseHeaders(headers map[string]string) {
+	m.responses++
+	delete(headers, "trace-id")
+}
+
+func TestCustomizedHeadersMutator(t *testing.T) {
+	mutator := &recordMutator{}
+	receiver, sender := createFilters(t, NewHeadersMutatorFilterFactory(mutator))
+
+	headers := map[string]string{}
+	receiver.OnDecodeHeaders(headers, true)
+	if headers["trace-id"] != "1" {
+		t.Errorf("customized mutator is not called on request: %v", headers)
+	}
+	sender.AppendHeaders(headers, true)
+	if _, ok := headers["trace-id"]; ok {
+		t.Errorf("customized mutator is not called on response: %v", headers)
+	}
+	if mutator.requests != 1 || mutator.responses != 1 {
+		t.Errorf("expect mutator called once each direction, but got %d, %d", mutator.requests, mutator.responses)
+	}
+}
@@ -42,6 +42,7 @@ type healthCheckFilter struct {
 	intercept      bool
 	protocol       byte
 	requestId      uint32
+	codec          byte
 	healthCheckReq bool
 	// callbacks
 	cb types.StreamReceiverFilterCallbacks
@@ -66,6 +67,10 @@ func (f *healthCheckFilter) OnDecodeHeaders(headers map[string]string, endStream
 			f.protocol = sofarpc.ConvertPropertyValue(protocolStr, reflect.Uint8).(byte)
 			requestIdStr := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)]
 			f.requestId = sofarpc.ConvertPropertyValue(requestIdStr, reflect.Uint32).(uint32)
+			f.codec = sofarpc.DefaultHeartbeatCodec()
+			if codecStr, ok := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec)]; ok {
+				f.codec = sofarpc.ConvertPropertyValue(codecStr, reflect.Uint8).(byte)
+			}
 			f.healthCheckReq = true
 			f.cb.RequestInfo().SetHealthCheck(true)
 
@@ -123,7 +128,7 @@ func (f *healthCheckFilter) handleIntercept() {
 	//resp = codec.NewTrHeartbeatAck( f.requestId)
 	case sofarpc.PROTOCOL_CODE_V1, sofarpc.PROTOCOL_CODE_V2:
 		//boltv1 and boltv2 use same heartbeat struct as BoltV1
-		resp = codec.NewBoltHeartbeatAck(f.requestId)
+		resp = codec.NewBoltHeartbeatAck(f.requestId, f.codec)
 	default:
 		log.ByContext(f.context).Errorf("Unknown protocol code: [%x] while intercept healthcheck.", f.protocol)
 		//TODO: set hijack reply - codec error, actually this would happen at codec stage which is before this
@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// limiters holds token buckets shared by all streams of a filter chain, keyed by limit key.
+// Buckets of keys that stop calling are evicted after the idle timeout
+type limiters struct {
+	rate        float64
+	burst       uint32
+	idleTimeout time.Duration
+	mux         sync.RWMutex
+	buckets     map[string]*tokenBucket
+	lastSweep   time.Time
+}
+
+func newLimiters(config *v2.RateLimit) *limiters {
+	burst := config.Burst
+	// at least one second's worth of requests can pass in a burst
+	if burst == 0 {
+		burst = uint32(config.Rate)
+		if float64(burst) < config.Rate {
+			burst++
+		}
+	}
+
+	return &limiters{
+		rate:        config.Rate,
+		burst:       burst,
+		idleTimeout: config.IdleTimeout,
+		buckets:     make(map[string]*tokenBucket),
+		lastSweep:   time.Now(),
+	}
+}
+
+func (l *limiters) get(key string) *tokenBucket {
+	l.mux.RLock()
+	bucket, ok := l.buckets[key]
+	l.mux.RUnlock()
+
+	if ok {
+		return bucket
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if bucket, ok = l.buckets[key]; !ok {
+		l.sweepAt(time.Now())
+
+		bucket = newTokenBucket(l.rate, l.burst)
+		l.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+// sweepAt evicts idle buckets at most once per idle timeout, it is called with lock held
+// when a bucket is created, so buckets don't grow without new keys
+func (l *limiters) sweepAt(now time.Time) {
+	if l.idleTimeout <= 0 || now.Sub(l.lastSweep) < l.idleTimeout {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if bucket.idleAt(now, l.idleTimeout) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// types.StreamReceiverFilter
+type rateLimitFilter struct {
+	context context.Context
+
+	keyType   v2.RateLimitKeyType
+	headerKey string
+	limiters  *limiters
+	throttled bool
+	cb        types.StreamReceiverFilterCallbacks
+}
+
+func newRateLimitFilter(context context.Context, config *v2.RateLimit, limiters *limiters) *rateLimitFilter {
+	return &rateLimitFilter{
+		context:   context,
+		keyType:   config.KeyType,
+		headerKey: config.HeaderKey,
+		limiters:  limiters,
+	}
+}
+
+func (f *rateLimitFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	key, ok := f.limitKey(headers)
+
+	// requests without limit key are not limited
+	if !ok {
+		return types.FilterHeadersStatusContinue
+	}
+
+	filterStats.RequestTotal().Inc(1)
+
+	if f.limiters.get(key).allow() {
+		return types.FilterHeadersStatusContinue
+	}
+
+	filterStats.RequestThrottled().Inc(1)
+	stats.GetSink().Count(RequestThrottledMetric, 1, stats.Tags{TagKeyType: string(f.keyType), TagKey: key})
+	log.ByContext(f.context).Debugf("[RateLimit] request throttled, key type = %s, key = %s", f.keyType, key)
+
+	f.throttled = true
+	f.cb.RequestInfo().SetResponseFlag(types.RateLimited)
+
+	headers[types.HeaderStatus] = strconv.Itoa(types.RateLimitedCode)
+	f.cb.AppendHeaders(headers, true)
+
+	return types.FilterHeadersStatusStopIteration
+}
+
+func (f *rateLimitFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.throttled {
+		return types.FilterDataStatusStopIterationNoBuffer
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *rateLimitFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.throttled {
+		return types.FilterTrailersStatusStopIteration
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *rateLimitFilter) limitKey(headers map[string]string) (string, bool) {
+	switch f.keyType {
+	case v2.RateLimitKeyCluster:
+		route := f.cb.Route()
+		if route == nil || route.RouteRule() == nil {
+			return "", false
+		}
+
+		return route.RouteRule().ClusterName(), true
+
+	case v2.RateLimitKeyHeader:
+		value, ok := headers[f.headerKey]
+		return value, ok
+
+	case v2.RateLimitKeyPeerIdentity:
+		// requests from connections without verified client certificate are not limited
+		identity, ok := f.context.Value(types.ContextKeyPeerIdentity).(string)
+		return identity, ok && identity != ""
+
+	default:
+		return "", true
+	}
+}
+
+func (f *rateLimitFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.cb = cb
+}
+
+func (f *rateLimitFilter) OnDestroy() {}
+
+// ~~ factory
+type RateLimitFilterConfigFactory struct {
+	RateLimit *v2.RateLimit
+	limiters  *limiters
+}
+
+func (f *RateLimitFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newRateLimitFilter(context, f.RateLimit, f.limiters)
+	callbacks.AddStreamReceiverFilter(filter)
+}
+
+func CreateRateLimitFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	rateLimit := config.ParseRateLimitFilter(conf)
+
+	return &RateLimitFilterConfigFactory{
+		RateLimit: rateLimit,
+		limiters:  newLimiters(rateLimit),
+	}, nil
+}
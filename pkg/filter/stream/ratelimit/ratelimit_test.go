@@ -0,0 +1,248 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func TestTokenBucketSteadyRate(t *testing.T) {
+	b := newTokenBucket(10, 1)
+	now := b.last
+
+	// one request every 100ms matches the rate, all should pass
+	for i := 0; i < 50; i++ {
+		now = now.Add(100 * time.Millisecond)
+		if !b.allowAt(now) {
+			t.Fatalf("request %d should pass at steady rate", i)
+		}
+	}
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	b := newTokenBucket(10, 5)
+	now := b.last
+
+	for i := 0; i < 5; i++ {
+		if !b.allowAt(now) {
+			t.Fatalf("request %d should pass within burst", i)
+		}
+	}
+	if b.allowAt(now) {
+		t.Errorf("request exceeds burst should be rejected")
+	}
+
+	// tokens refill at rate, but never exceed burst
+	if !b.allowAt(now.Add(100 * time.Millisecond)) {
+		t.Errorf("request should pass after refill")
+	}
+	now = now.Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		b.allowAt(now)
+	}
+	if b.allowAt(now) {
+		t.Errorf("tokens should not exceed burst after long idle")
+	}
+}
+
+func runRequest(factory *RateLimitFilterConfigFactory, route types.Route, headers map[string]string) (*filtertest.ReceiverCallbacks, types.FilterHeadersStatus) {
+	return runRequestWithContext(context.Background(), factory, route, headers)
+}
+
+func runRequestWithContext(ctx context.Context, factory *RateLimitFilterConfigFactory, route types.Route,
+	headers map[string]string) (*filtertest.ReceiverCallbacks, types.FilterHeadersStatus) {
+	cb := filtertest.NewReceiverCallbacks(route, nil)
+
+	f := newRateLimitFilter(ctx, factory.RateLimit, factory.limiters)
+	f.SetDecoderFilterCallbacks(cb)
+
+	return cb, f.OnDecodeHeaders(headers, true)
+}
+
+func newTestFactory(config *v2.RateLimit) *RateLimitFilterConfigFactory {
+	return &RateLimitFilterConfigFactory{
+		RateLimit: config,
+		limiters:  newLimiters(config),
+	}
+}
+
+func TestRateLimitFilterBurstRejection(t *testing.T) {
+	factory := newTestFactory(&v2.RateLimit{
+		Rate:    1,
+		Burst:   3,
+		KeyType: v2.RateLimitKeyGlobal,
+	})
+	throttled := filterStats.RequestThrottled().Count()
+
+	for i := 0; i < 3; i++ {
+		if _, status := runRequest(factory, nil, map[string]string{}); status != types.FilterHeadersStatusContinue {
+			t.Fatalf("request %d should pass within burst", i)
+		}
+	}
+
+	cb, status := runRequest(factory, nil, map[string]string{})
+	if status != types.FilterHeadersStatusStopIteration {
+		t.Fatalf("request over limit should be stopped")
+	}
+	if cb.ReplyHeaders()[types.HeaderStatus] != strconv.Itoa(types.RateLimitedCode) {
+		t.Errorf("request over limit should be replied with rate limited status, got %v", cb.RespHeaders)
+	}
+	if cb.RequestInfo().GetResponseFlag(types.RateLimited) == false {
+		t.Errorf("request over limit should be flagged as rate limited")
+	}
+	if got := filterStats.RequestThrottled().Count() - throttled; got != 1 {
+		t.Errorf("want 1 throttled request, got %d", got)
+	}
+}
+
+func TestRateLimitFilterKeys(t *testing.T) {
+	// per cluster
+	factory := newTestFactory(&v2.RateLimit{
+		Rate:    1,
+		Burst:   1,
+		KeyType: v2.RateLimitKeyCluster,
+	})
+	routeA := filtertest.NewRoute("a")
+	routeB := filtertest.NewRoute("b")
+
+	if _, status := runRequest(factory, routeA, map[string]string{}); status != types.FilterHeadersStatusContinue {
+		t.Errorf("first request of cluster a should pass")
+	}
+	if _, status := runRequest(factory, routeB, map[string]string{}); status != types.FilterHeadersStatusContinue {
+		t.Errorf("first request of cluster b should pass")
+	}
+	if _, status := runRequest(factory, routeA, map[string]string{}); status != types.FilterHeadersStatusStopIteration {
+		t.Errorf("second request of cluster a should be rejected")
+	}
+	if _, status := runRequest(factory, nil, map[string]string{}); status != types.FilterHeadersStatusContinue {
+		t.Errorf("request without route should not be limited")
+	}
+
+	// per header value
+	factory = newTestFactory(&v2.RateLimit{
+		Rate:      1,
+		Burst:     1,
+		KeyType:   v2.RateLimitKeyHeader,
+		HeaderKey: "caller",
+	})
+
+	if _, status := runRequest(factory, nil, map[string]string{"caller": "app1"}); status != types.FilterHeadersStatusContinue {
+		t.Errorf("first request of app1 should pass")
+	}
+	if _, status := runRequest(factory, nil, map[string]string{"caller": "app2"}); status != types.FilterHeadersStatusContinue {
+		t.Errorf("first request of app2 should pass")
+	}
+	if _, status := runRequest(factory, nil, map[string]string{"caller": "app1"}); status != types.FilterHeadersStatusStopIteration {
+		t.Errorf("second request of app1 should be rejected")
+	}
+	if _, status := runRequest(factory, nil, map[string]string{}); status != types.FilterHeadersStatusContinue {
+		t.Errorf("request without limit header should not be limited")
+	}
+}
+
+type throttledSink struct {
+	stats.MetricsSink
+	throttled map[string]int64
+}
+
+func (s *throttledSink) Count(name string, value int64, tags stats.Tags) {
+	if name == RequestThrottledMetric {
+		s.throttled[tags[TagKeyType]+":"+tags[TagKey]] += value
+	}
+}
+
+func TestRateLimitFilterPeerIdentity(t *testing.T) {
+	factory := newTestFactory(&v2.RateLimit{
+		Rate:    1,
+		Burst:   2,
+		KeyType: v2.RateLimitKeyPeerIdentity,
+	})
+	sink := &throttledSink{throttled: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	noisy := "spiffe://cluster.local/ns/default/sa/noisy"
+	quiet := "spiffe://cluster.local/ns/default/sa/quiet"
+	request := func(identity string) types.FilterHeadersStatus {
+		ctx := context.Background()
+		if identity != "" {
+			ctx = context.WithValue(ctx, types.ContextKeyPeerIdentity, identity)
+		}
+		_, status := runRequestWithContext(ctx, factory, nil, map[string]string{})
+		return status
+	}
+
+	// the noisy caller exhausts its own bucket only
+	for i := 0; i < 5; i++ {
+		want := types.FilterHeadersStatusContinue
+		if i >= 2 {
+			want = types.FilterHeadersStatusStopIteration
+		}
+		if status := request(noisy); status != want {
+			t.Fatalf("request %d of noisy identity: want status %v, got %v", i, want, status)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if status := request(quiet); status != types.FilterHeadersStatusContinue {
+			t.Errorf("request %d of quiet identity should pass", i)
+		}
+	}
+	if status := request(""); status != types.FilterHeadersStatusContinue {
+		t.Errorf("request without peer identity should not be limited")
+	}
+
+	if sink.throttled["peer_identity:"+noisy] != 3 || len(sink.throttled) != 1 {
+		t.Errorf("want 3 throttled requests of noisy identity, got %v", sink.throttled)
+	}
+}
+
+func TestLimitersIdleEviction(t *testing.T) {
+	l := newLimiters(&v2.RateLimit{
+		Rate:        1,
+		Burst:       2,
+		IdleTimeout: time.Minute,
+	})
+	now := l.lastSweep
+
+	l.get("idle").allowAt(now)
+	drained := l.get("drained")
+	drained.rate = 0.001
+	drained.allowAt(now)
+
+	// not swept before idle timeout
+	l.sweepAt(now.Add(30 * time.Second))
+	if len(l.buckets) != 2 {
+		t.Fatalf("buckets should not be evicted before idle timeout, got %d", len(l.buckets))
+	}
+
+	// the idle bucket is full again and evicted, the slowly refilled one is kept to hold its limit
+	l.sweepAt(now.Add(2 * time.Minute))
+	if _, ok := l.buckets["idle"]; ok || len(l.buckets) != 1 {
+		t.Errorf("idle bucket should be evicted, got %v", l.buckets)
+	}
+	if l.get("drained") != drained {
+		t.Errorf("bucket not refilled should be kept")
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package ratelimit
+
+import (
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	RequestTotal     = "request_total"
+	RequestThrottled = "request_throttled"
+)
+
+// throttled requests recorded to the metrics sink, tagged by the limit key
+const (
+	RequestThrottledMetric = "mosn_ratelimit_requests_throttled_total"
+	TagKeyType             = "key_type"
+	TagKey                 = "key"
+)
+
+var filterStats = newRateLimitStats("ratelimit")
+
+type rateLimitStats struct {
+	stats *stats.Stats
+}
+
+func newRateLimitStats(namespace string) *rateLimitStats {
+	return &rateLimitStats{
+		stats: stats.NewStats(namespace).AddCounter(RequestTotal).AddCounter(RequestThrottled),
+	}
+}
+
+func (s *rateLimitStats) RequestTotal() metrics.Counter {
+	return s.stats.Counter(RequestTotal)
+}
+
+func (s *rateLimitStats) RequestThrottled() metrics.Counter {
+	return s.stats.Counter(RequestThrottled)
+}
+
+func (s *rateLimitStats) String() string {
+	return s.stats.String()
+}
@@ -0,0 +1,76 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket allows requests at a steady rate, with bursts up to its capacity
+type tokenBucket struct {
+	mux    sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // capacity of the bucket
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst uint32) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token from the bucket, returns false if the bucket is empty
+func (b *tokenBucket) allow() bool {
+	return b.allowAt(time.Now())
+}
+
+func (b *tokenBucket) allowAt(now time.Time) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// idleAt returns true if the bucket is not used for the timeout and is full again,
+// evicting such a bucket doesn't change the limit of its key
+func (b *tokenBucket) idleAt(now time.Time, timeout time.Duration) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	elapsed := now.Sub(b.last)
+
+	return elapsed >= timeout && b.tokens+elapsed.Seconds()*b.rate >= b.burst
+}
@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package requestsize
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// types.StreamReceiverFilter
+// The content length decoded in headers is checked against the max request bytes of the route,
+// or of the filter if the route has none, so that the body is not buffered to be measured.
+// Requests exceeding the limit are replied without forwarding.
+type requestSizeFilter struct {
+	context context.Context
+
+	config   *v2.RequestSize
+	rejected bool
+	cb       types.StreamReceiverFilterCallbacks
+}
+
+func newRequestSizeFilter(context context.Context, config *v2.RequestSize) *requestSizeFilter {
+	return &requestSizeFilter{
+		context: context,
+		config:  config,
+	}
+}
+
+func (f *requestSizeFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	limit, cluster := f.limit()
+	if limit == 0 {
+		return types.FilterHeadersStatusContinue
+	}
+
+	// requests without decoded content length, e.g. of other protocols, are not checked
+	contentLen, err := strconv.ParseUint(headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)], 10, 64)
+	if err != nil {
+		return types.FilterHeadersStatusContinue
+	}
+
+	filterStats.RequestTotal().Inc(1)
+
+	if contentLen <= limit {
+		return types.FilterHeadersStatusContinue
+	}
+
+	filterStats.RequestRejected().Inc(1)
+	stats.GetSink().Count(RequestRejectedMetric, 1, stats.Tags{TagCluster: cluster})
+	log.ByContext(f.context).Debugf("[RequestSize] request rejected, content length = %d, max request bytes = %d, cluster = %s",
+		contentLen, limit, cluster)
+
+	f.rejected = true
+	f.cb.RequestInfo().SetResponseFlag(types.RequestTooLarge)
+
+	// the response status is replied as is by sofarpc, other protocols reply 413
+	headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] = strconv.Itoa(int(f.config.RejectStatus))
+	headers[types.HeaderStatus] = strconv.Itoa(types.PayloadTooLargeCode)
+	f.cb.AppendHeaders(headers, true)
+
+	return types.FilterHeadersStatusStopIteration
+}
+
+// limit returns the max request bytes of the route if configured, or of the filter,
+// and the cluster the request is routed to
+func (f *requestSizeFilter) limit() (uint64, string) {
+	limit := f.config.MaxRequestBytes
+
+	route := f.cb.Route()
+	if route == nil || route.RouteRule() == nil {
+		return limit, ""
+	}
+
+	rule := route.RouteRule()
+	if routeLimit := rule.MaxRequestBytes(); routeLimit > 0 {
+		limit = routeLimit
+	}
+
+	return limit, rule.ClusterName()
+}
+
+func (f *requestSizeFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.rejected {
+		return types.FilterDataStatusStopIterationNoBuffer
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *requestSizeFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.rejected {
+		return types.FilterTrailersStatusStopIteration
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *requestSizeFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.cb = cb
+}
+
+func (f *requestSizeFilter) OnDestroy() {}
+
+// ~~ factory
+type RequestSizeFilterConfigFactory struct {
+	RequestSize *v2.RequestSize
+}
+
+func (f *RequestSizeFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newRequestSizeFilter(context, f.RequestSize)
+	callbacks.AddStreamReceiverFilter(filter)
+}
+
+func CreateRequestSizeFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	return &RequestSizeFilterConfigFactory{
+		RequestSize: config.ParseRequestSizeFilter(conf),
+	}, nil
+}
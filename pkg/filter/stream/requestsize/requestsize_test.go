@@ -0,0 +1,154 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package requestsize
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// sendRequest sends a bolt request declaring the content length on the route, the length
+// is not declared if negative. Returns the callbacks and whether the request is forwarded
+func sendRequest(t *testing.T, config *v2.RequestSize, route types.Route, contentLen int) (*filtertest.ReceiverCallbacks, bool) {
+	headers := map[string]string{}
+	if contentLen >= 0 {
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(contentLen)
+	}
+
+	cb := filtertest.NewReceiverCallbacks(route, nil)
+	return cb, filtertest.RunRequest(t, newRequestSizeFilter(context.Background(), config), cb, headers, "request")
+}
+
+func routeWithLimit(cluster string, maxRequestBytes uint64) types.Route {
+	route := filtertest.NewRoute(cluster)
+	route.Rule.MaxBytes = maxRequestBytes
+	return route
+}
+
+func expectRejected(t *testing.T, cb *filtertest.ReceiverCallbacks, status int16) {
+	filtertest.ExpectReply(t, cb, types.PayloadTooLargeCode, status, types.RequestTooLarge)
+}
+
+func TestRequestSizeLimit(t *testing.T) {
+	config := &v2.RequestSize{
+		MaxRequestBytes: 1024,
+		RejectStatus:    sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION,
+	}
+	route := filtertest.NewRoute("pay")
+	total, rejected := filterStats.RequestTotal().Count(), filterStats.RequestRejected().Count()
+
+	// just under and at the limit
+	for _, contentLen := range []int{1023, 1024} {
+		if cb, forwarded := sendRequest(t, config, route, contentLen); !forwarded || cb.RespHeaders != nil {
+			t.Errorf("request of %d bytes should be forwarded", contentLen)
+		}
+	}
+
+	// just over the limit
+	cb, forwarded := sendRequest(t, config, route, 1025)
+	if forwarded {
+		t.Fatalf("request of 1025 bytes should be rejected")
+	}
+	expectRejected(t, cb, sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION)
+
+	if got := filterStats.RequestTotal().Count() - total; got != 3 {
+		t.Errorf("expect 3 requests checked, got %d", got)
+	}
+	if got := filterStats.RequestRejected().Count() - rejected; got != 1 {
+		t.Errorf("expect 1 request rejected, got %d", got)
+	}
+
+	// requests without content length are not checked
+	if _, forwarded := sendRequest(t, config, route, -1); !forwarded {
+		t.Errorf("request without content length should be forwarded")
+	}
+}
+
+func TestRequestSizeRouteLimit(t *testing.T) {
+	config := &v2.RequestSize{
+		MaxRequestBytes: 1024,
+		RejectStatus:    sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION,
+	}
+
+	// the route limit overrides the filter limit
+	route := routeWithLimit("upload", 4096)
+	if _, forwarded := sendRequest(t, config, route, 4096); !forwarded {
+		t.Errorf("request under the route limit should be forwarded")
+	}
+	cb, forwarded := sendRequest(t, config, route, 4097)
+	if forwarded {
+		t.Fatalf("request over the route limit should be rejected")
+	}
+	expectRejected(t, cb, sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION)
+
+	// only the routes configuring the limit are checked if the filter has none
+	config = &v2.RequestSize{RejectStatus: sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION}
+	if _, forwarded := sendRequest(t, config, filtertest.NewRoute("pay"), 1<<20); !forwarded {
+		t.Errorf("request of route without limit should be forwarded")
+	}
+	if _, forwarded := sendRequest(t, config, nil, 1<<20); !forwarded {
+		t.Errorf("request without route should be forwarded")
+	}
+	if _, forwarded := sendRequest(t, config, route, 4097); forwarded {
+		t.Errorf("request over the route limit should be rejected")
+	}
+}
+
+type rejectedSink struct {
+	stats.MetricsSink
+	rejected map[string]int64
+}
+
+func (s *rejectedSink) Count(name string, value int64, tags stats.Tags) {
+	if name == RequestRejectedMetric {
+		s.rejected[tags[TagCluster]] += value
+	}
+}
+
+func TestRequestSizeRejectedByCluster(t *testing.T) {
+	sink := &rejectedSink{rejected: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	config := &v2.RequestSize{
+		MaxRequestBytes: 1024,
+		RejectStatus:    sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION,
+	}
+	for _, contentLen := range []int{1024, 2048, 4096} {
+		sendRequest(t, config, filtertest.NewRoute("pay"), contentLen)
+		sendRequest(t, config, routeWithLimit("upload", 2048), contentLen)
+	}
+
+	if sink.rejected["pay"] != 2 || sink.rejected["upload"] != 1 {
+		t.Errorf("unexpected rejected requests by cluster: %v", sink.rejected)
+	}
+
+	// trailers of the rejected request are not forwarded either
+	f := newRequestSizeFilter(context.Background(), config)
+	f.SetDecoderFilterCallbacks(filtertest.NewReceiverCallbacks(nil, nil))
+	f.OnDecodeHeaders(map[string]string{sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen): "1025"}, false)
+	if status := f.OnDecodeTrailers(map[string]string{}); status != types.FilterTrailersStatusStopIteration {
+		t.Errorf("trailers of rejected request should stop iteration, got %v", status)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package requestsize
+
+import (
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	RequestTotal    = "request_total"
+	RequestRejected = "request_rejected"
+)
+
+// rejected requests recorded to the metrics sink, tagged by the routed cluster
+const (
+	RequestRejectedMetric = "mosn_request_size_rejected_total"
+	TagCluster            = "cluster"
+)
+
+var filterStats = newRequestSizeStats("request_size")
+
+type requestSizeStats struct {
+	stats *stats.Stats
+}
+
+func newRequestSizeStats(namespace string) *requestSizeStats {
+	return &requestSizeStats{
+		stats: stats.NewStats(namespace).AddCounter(RequestTotal).AddCounter(RequestRejected),
+	}
+}
+
+func (s *requestSizeStats) RequestTotal() metrics.Counter {
+	return s.stats.Counter(RequestTotal)
+}
+
+func (s *requestSizeStats) RequestRejected() metrics.Counter {
+	return s.stats.Counter(RequestRejected)
+}
+
+func (s *requestSizeStats) String() string {
+	return s.stats.String()
+}
@@ -0,0 +1,116 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package responsecache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// cachedResponse is the response headers and content of a request
+type cachedResponse struct {
+	headers map[string]string
+	content []byte
+}
+
+type cacheEntry struct {
+	key      string
+	response *cachedResponse
+	expireAt time.Time
+}
+
+// responseCache is a LRU cache of responses, entries expire after ttl
+type responseCache struct {
+	mux        sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	// front is the most recently used
+	lru     *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// get returns the response cached by key, expired entry is removed
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expireAt) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return entry.response, true
+}
+
+// set caches the response by key, the least recently used entry is evicted if the cache is full
+func (c *responseCache) set(key string, response *cachedResponse) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	expireAt := c.now().Add(c.ttl)
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.response = response
+		entry.expireAt = expireAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:      key,
+		response: response,
+		expireAt: expireAt,
+	})
+
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		filterStats.Evicted().Inc(1)
+	}
+}
+
+func (c *responseCache) len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *responseCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,236 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package responsecache
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// types.StreamReceiverFilter
+// types.StreamSenderFilter
+// Bolt requests of the configured classes are replied from the cache if a response is cached
+// by the class name and key headers, otherwise the successful response is cached for ttl.
+type responseCacheFilter struct {
+	context context.Context
+
+	classNames map[string]bool
+	keyHeaders []string
+	cache      *responseCache
+
+	replied bool
+	// cache key of the request forwarded to upstream, empty if the response is not to be cached
+	key      string
+	response *cachedResponse
+
+	decoderCb types.StreamReceiverFilterCallbacks
+	encoderCb types.StreamSenderFilterCallbacks
+}
+
+func newResponseCacheFilter(context context.Context, classNames map[string]bool, keyHeaders []string, cache *responseCache) *responseCacheFilter {
+	return &responseCacheFilter{
+		context:    context,
+		classNames: classNames,
+		keyHeaders: keyHeaders,
+		cache:      cache,
+	}
+}
+
+func (f *responseCacheFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	if !sofarpc.IsSofaRequest(headers) {
+		return types.FilterHeadersStatusContinue
+	}
+
+	className := f.decoderCb.RequestContext().ClassName()
+	if !f.classNames[className] {
+		return types.FilterHeadersStatusContinue
+	}
+
+	key := f.cacheKey(className, headers)
+	if response, ok := f.cache.get(key); ok {
+		filterStats.Hit().Inc(1)
+		f.reply(response)
+
+		return types.FilterHeadersStatusStopIteration
+	}
+
+	filterStats.Miss().Inc(1)
+	f.key = key
+
+	return types.FilterHeadersStatusContinue
+}
+
+func (f *responseCacheFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.replied {
+		return types.FilterDataStatusStopIterationNoBuffer
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *responseCacheFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.replied {
+		return types.FilterTrailersStatusStopIteration
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *responseCacheFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.decoderCb = cb
+}
+
+// only successful responses from upstream are cached, responses built by mosn
+// as protocol commands are not header maps, and are not cached
+func (f *responseCacheFilter) AppendHeaders(headers interface{}, endStream bool) types.FilterHeadersStatus {
+	if f.key == "" {
+		return types.FilterHeadersStatusContinue
+	}
+
+	headerMap, ok := headers.(map[string]string)
+	if !ok || !isSuccess(headerMap) {
+		f.key = ""
+		return types.FilterHeadersStatusContinue
+	}
+
+	// headers are modified by the encoder, the cached ones are copied
+	f.response = &cachedResponse{headers: copyHeaders(headerMap)}
+	if endStream {
+		f.store()
+	}
+
+	return types.FilterHeadersStatusContinue
+}
+
+func (f *responseCacheFilter) AppendData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.response != nil {
+		f.response.content = append(f.response.content, buf.Bytes()...)
+		if endStream {
+			f.store()
+		}
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *responseCacheFilter) AppendTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.response != nil {
+		f.store()
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *responseCacheFilter) SetEncoderFilterCallbacks(cb types.StreamSenderFilterCallbacks) {
+	f.encoderCb = cb
+}
+
+func (f *responseCacheFilter) OnDestroy() {}
+
+// cacheKey is the class name followed by the key headers, missing headers are empty
+func (f *responseCacheFilter) cacheKey(className string, headers map[string]string) string {
+	key := className
+	for _, name := range f.keyHeaders {
+		key += "\n" + name + "=" + headers[name]
+	}
+
+	return key
+}
+
+func (f *responseCacheFilter) reply(response *cachedResponse) {
+	log.ByContext(f.context).Debugf("[ResponseCache] reply request from cache")
+	f.replied = true
+
+	headers := copyHeaders(response.headers)
+	if len(response.content) == 0 {
+		f.decoderCb.AppendHeaders(headers, true)
+		return
+	}
+
+	f.decoderCb.AppendHeaders(headers, false)
+	f.decoderCb.AppendData(buffer.NewIoBufferBytes(append([]byte(nil), response.content...)), true)
+}
+
+func (f *responseCacheFilter) store() {
+	f.cache.set(f.key, f.response)
+	f.key = ""
+	f.response = nil
+}
+
+func isSuccess(headers map[string]string) bool {
+	if _, ok := headers[types.HeaderStatus]; ok {
+		return false
+	}
+
+	status, ok := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)]
+
+	return ok && status == strconv.Itoa(int(sofarpc.RESPONSE_STATUS_SUCCESS))
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+
+	return copied
+}
+
+// ~~ factory
+type ResponseCacheFilterConfigFactory struct {
+	ResponseCache *v2.ResponseCache
+	classNames    map[string]bool
+	keyHeaders    []string
+	// shared by all streams
+	cache *responseCache
+}
+
+func (f *ResponseCacheFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newResponseCacheFilter(context, f.classNames, f.keyHeaders, f.cache)
+	callbacks.AddStreamReceiverFilter(filter)
+	callbacks.AddStreamSenderFilter(filter)
+}
+
+func CreateResponseCacheFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	return newResponseCacheFilterFactory(config.ParseResponseCacheFilter(conf)), nil
+}
+
+func newResponseCacheFilterFactory(responseCache *v2.ResponseCache) *ResponseCacheFilterConfigFactory {
+	classNames := make(map[string]bool, len(responseCache.ClassNames))
+	for _, className := range responseCache.ClassNames {
+		classNames[className] = true
+	}
+
+	// key headers are sorted, so that the key does not depend on the configured order
+	keyHeaders := append([]string{}, responseCache.KeyHeaders...)
+	sort.Strings(keyHeaders)
+
+	return &ResponseCacheFilterConfigFactory{
+		ResponseCache: responseCache,
+		classNames:    classNames,
+		keyHeaders:    keyHeaders,
+		cache:         newResponseCache(responseCache.TTL, responseCache.MaxEntries),
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package responsecache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func newBoltRequestHeaders(className string, reqId string) map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode):      strconv.Itoa(int(sofarpc.RPC_REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        reqId,
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName):    className,
+		"user": "alice",
+	}
+}
+
+func newBoltResponseHeaders(status int16) map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.RESPONSE)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        "100",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus):   strconv.Itoa(int(status)),
+	}
+}
+
+// runRequest runs a bolt request through the filter, the response is sent by upstream with the status
+// if the request is not replied from cache. Returns the callbacks and whether the request is forwarded.
+func runRequest(t *testing.T, factory *ResponseCacheFilterConfigFactory, headers map[string]string, status int16, content string) (*filtertest.ReceiverCallbacks, bool) {
+	cb := filtertest.NewReceiverCallbacks(nil, headers)
+	f := newResponseCacheFilter(context.Background(), factory.classNames, factory.keyHeaders, factory.cache)
+	f.SetDecoderFilterCallbacks(cb)
+	defer f.OnDestroy()
+
+	if f.OnDecodeHeaders(headers, false) == types.FilterHeadersStatusStopIteration {
+		if status := f.OnDecodeData(buffer.NewIoBufferString("request"), true); status != types.FilterDataStatusStopIterationNoBuffer {
+			t.Fatalf("request replied from cache should not buffer data, got %s", status)
+		}
+		return cb, false
+	}
+
+	f.AppendHeaders(newBoltResponseHeaders(status), false)
+	f.AppendData(buffer.NewIoBufferString(content), true)
+
+	return cb, true
+}
+
+func newTestFactory(ttl time.Duration, maxEntries int) *ResponseCacheFilterConfigFactory {
+	return newResponseCacheFilterFactory(&v2.ResponseCache{
+		ClassNames: []string{"com.alipay.test.QueryService"},
+		KeyHeaders: []string{"user"},
+		TTL:        ttl,
+		MaxEntries: maxEntries,
+	})
+}
+
+func TestResponseCacheHit(t *testing.T) {
+	factory := newTestFactory(time.Minute, 10)
+
+	if _, forwarded := runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "1"), sofarpc.RESPONSE_STATUS_SUCCESS, "result"); !forwarded {
+		t.Fatal("first request should be forwarded")
+	}
+
+	cb, forwarded := runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "2"), sofarpc.RESPONSE_STATUS_SUCCESS, "result")
+	if forwarded {
+		t.Fatal("request should be replied from cache")
+	}
+	headers, ok := cb.RespHeaders.(map[string]string)
+	if !ok || headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] != strconv.Itoa(int(sofarpc.RESPONSE_STATUS_SUCCESS)) {
+		t.Errorf("unexpected cached response headers: %v", cb.RespHeaders)
+	}
+	if cb.RespData == nil || cb.RespData.String() != "result" {
+		t.Errorf("unexpected cached response content: %v", cb.RespData)
+	}
+
+	// different key header value
+	headers = newBoltRequestHeaders("com.alipay.test.QueryService", "3")
+	headers["user"] = "bob"
+	if _, forwarded := runRequest(t, factory, headers, sofarpc.RESPONSE_STATUS_SUCCESS, "result"); !forwarded {
+		t.Error("request with different key header should be forwarded")
+	}
+
+	// class not configured
+	for i := 0; i < 2; i++ {
+		if _, forwarded := runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.PayService", "4"), sofarpc.RESPONSE_STATUS_SUCCESS, "result"); !forwarded {
+			t.Error("request of class not configured should be forwarded")
+		}
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	factory := newTestFactory(time.Second, 10)
+	now := time.Now()
+	factory.cache.now = func() time.Time {
+		return now
+	}
+
+	runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "1"), sofarpc.RESPONSE_STATUS_SUCCESS, "result")
+
+	now = now.Add(999 * time.Millisecond)
+	if _, forwarded := runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "2"), sofarpc.RESPONSE_STATUS_SUCCESS, "result"); forwarded {
+		t.Error("request should be replied from cache before ttl expires")
+	}
+
+	now = now.Add(time.Millisecond)
+	if _, forwarded := runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "3"), sofarpc.RESPONSE_STATUS_SUCCESS, "result"); !forwarded {
+		t.Error("request should be forwarded after ttl expires")
+	}
+	if _, forwarded := runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "4"), sofarpc.RESPONSE_STATUS_SUCCESS, "result"); forwarded {
+		t.Error("request should be replied from the refreshed cache")
+	}
+}
+
+func TestResponseCacheNonSuccess(t *testing.T) {
+	factory := newTestFactory(time.Minute, 10)
+
+	for _, status := range []int16{sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION, sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY} {
+		runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "1"), status, "error")
+		if _, forwarded := runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "2"), status, "error"); !forwarded {
+			t.Errorf("response with status %d should not be cached", status)
+		}
+	}
+
+	if n := factory.cache.len(); n != 0 {
+		t.Errorf("expect empty cache, got %d entries", n)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	factory := newTestFactory(time.Minute, 2)
+
+	users := []string{"alice", "bob", "carol"}
+	for _, user := range users[:2] {
+		headers := newBoltRequestHeaders("com.alipay.test.QueryService", "1")
+		headers["user"] = user
+		runRequest(t, factory, headers, sofarpc.RESPONSE_STATUS_SUCCESS, user)
+	}
+
+	// alice is used recently, bob is evicted by carol
+	runRequest(t, factory, newBoltRequestHeaders("com.alipay.test.QueryService", "2"), sofarpc.RESPONSE_STATUS_SUCCESS, "alice")
+	headers := newBoltRequestHeaders("com.alipay.test.QueryService", "3")
+	headers["user"] = "carol"
+	runRequest(t, factory, headers, sofarpc.RESPONSE_STATUS_SUCCESS, "carol")
+
+	f := newResponseCacheFilter(context.Background(), factory.classNames, factory.keyHeaders, factory.cache)
+	for user, cached := range map[string]bool{"alice": true, "bob": false, "carol": true} {
+		key := f.cacheKey("com.alipay.test.QueryService", map[string]string{"user": user})
+		if _, ok := factory.cache.get(key); ok != cached {
+			t.Errorf("response for %s expect cached %v, got %v", user, cached, ok)
+		}
+	}
+}
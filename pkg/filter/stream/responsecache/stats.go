@@ -0,0 +1,56 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package responsecache
+
+import (
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	Hit     = "hit"
+	Miss    = "miss"
+	Evicted = "evicted"
+)
+
+var filterStats = newResponseCacheStats("response_cache")
+
+type responseCacheStats struct {
+	stats *stats.Stats
+}
+
+func newResponseCacheStats(namespace string) *responseCacheStats {
+	return &responseCacheStats{
+		stats: stats.NewStats(namespace).AddCounter(Hit).AddCounter(Miss).AddCounter(Evicted),
+	}
+}
+
+func (s *responseCacheStats) Hit() metrics.Counter {
+	return s.stats.Counter(Hit)
+}
+
+func (s *responseCacheStats) Miss() metrics.Counter {
+	return s.stats.Counter(Miss)
+}
+
+func (s *responseCacheStats) Evicted() metrics.Counter {
+	return s.stats.Counter(Evicted)
+}
+
+func (s *responseCacheStats) String() string {
+	return s.stats.String()
+}
@@ -0,0 +1,209 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tap
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+)
+
+// DefaultMaxCaptures is the number of requests captured if max_captures is not given
+const DefaultMaxCaptures uint32 = 10
+
+var ErrTapNotEnabled = errors.New("tap is not enabled")
+
+// Config of a tap session enabled at runtime. Requests of the class name carrying all the header values
+// are captured, an empty class name matches all classes. The session is disabled after max captures,
+// records are kept in memory, and are also appended to the file at path as json lines if given.
+type Config struct {
+	ClassName   string            `json:"class_name,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	MaxCaptures uint32            `json:"max_captures"`
+	Path        string            `json:"path,omitempty"`
+}
+
+// Record is a captured bolt request and its response, content is encoded in base64 by json
+type Record struct {
+	Time               time.Time         `json:"time"`
+	ClassName          string            `json:"class_name"`
+	RequestHeaders     map[string]string `json:"request_headers"`
+	RequestContent     []byte            `json:"request_content,omitempty"`
+	RequestContentLen  int               `json:"request_content_len"`
+	ResponseHeaders    map[string]string `json:"response_headers,omitempty"`
+	ResponseContent    []byte            `json:"response_content,omitempty"`
+	ResponseContentLen int               `json:"response_content_len"`
+}
+
+// Status of the last tap session
+type Status struct {
+	Enabled  bool      `json:"enabled"`
+	Config   *Config   `json:"config,omitempty"`
+	Captured uint32    `json:"captured"`
+	Records  []*Record `json:"records"`
+}
+
+type session struct {
+	config  Config
+	enabled bool
+	// requests matched, the session is disabled when it reaches max captures
+	captured uint32
+	// records of matched requests not finished yet, the file is closed when all are finished after disabled
+	pending int
+	records []*Record
+	file    *os.File
+}
+
+var (
+	sessionMux sync.Mutex
+	current    *session
+)
+
+// Enable starts a new tap session, the records of the last session are dropped
+func Enable(config Config) error {
+	if config.MaxCaptures == 0 {
+		config.MaxCaptures = DefaultMaxCaptures
+	}
+
+	var file *os.File
+	if config.Path != "" {
+		var err error
+		if file, err = os.OpenFile(config.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return err
+		}
+	}
+
+	sessionMux.Lock()
+	defer sessionMux.Unlock()
+
+	if current != nil {
+		current.disable()
+	}
+	current = &session{
+		config:  config,
+		enabled: true,
+		records: []*Record{},
+		file:    file,
+	}
+
+	return nil
+}
+
+// Disable stops capturing of the current tap session, records captured are still kept
+func Disable() error {
+	sessionMux.Lock()
+	defer sessionMux.Unlock()
+
+	if current == nil || !current.enabled {
+		return ErrTapNotEnabled
+	}
+	current.disable()
+
+	return nil
+}
+
+// GetStatus returns the status and records of the current tap session
+func GetStatus() *Status {
+	sessionMux.Lock()
+	defer sessionMux.Unlock()
+
+	if current == nil {
+		return &Status{Records: []*Record{}}
+	}
+
+	config := current.config
+
+	return &Status{
+		Enabled:  current.enabled,
+		Config:   &config,
+		Captured: current.captured,
+		Records:  append([]*Record{}, current.records...),
+	}
+}
+
+// reserve returns the current session if the request matches it, the session is disabled
+// when the request takes the last capture
+func reserve(className string, headers map[string]string) *session {
+	sessionMux.Lock()
+	defer sessionMux.Unlock()
+
+	s := current
+	if s == nil || !s.enabled || !s.match(className, headers) {
+		return nil
+	}
+
+	s.captured++
+	s.pending++
+	if s.captured >= s.config.MaxCaptures {
+		log.DefaultLogger.Infof("[Tap] %d requests captured, tap disabled", s.captured)
+		s.disable()
+	}
+
+	return s
+}
+
+func (s *session) match(className string, headers map[string]string) bool {
+	if s.config.ClassName != "" && s.config.ClassName != className {
+		return false
+	}
+
+	for name, value := range s.config.Headers {
+		if v, ok := headers[name]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// finish adds the record of a request reserved in the session
+func (s *session) finish(record *Record) {
+	sessionMux.Lock()
+	defer sessionMux.Unlock()
+
+	s.pending--
+	s.records = append(s.records, record)
+
+	if s.file != nil {
+		if line, err := json.Marshal(record); err == nil {
+			if _, err := s.file.Write(append(line, '\n')); err != nil {
+				log.DefaultLogger.Errorf("[Tap] write record to %s failed: %v", s.config.Path, err)
+			}
+		}
+	}
+
+	if !s.enabled {
+		s.closeFile()
+	}
+}
+
+func (s *session) disable() {
+	s.enabled = false
+	s.closeFile()
+}
+
+// closeFile closes the file after all records are written
+func (s *session) closeFile() {
+	if s.file != nil && s.pending == 0 {
+		s.file.Close()
+		s.file = nil
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tap
+
+import (
+	"context"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// MaskedValue replaces the values of masked headers in records
+const MaskedValue = "******"
+
+// types.StreamReceiverFilter
+// types.StreamSenderFilter
+// Bolt requests matching the tap session enabled by admin api are captured with their responses
+type tapFilter struct {
+	context context.Context
+
+	maskHeaders map[string]bool
+	maskContent bool
+
+	// session and record of the captured request, nil if the request is not captured
+	session *session
+	record  *Record
+
+	decoderCb types.StreamReceiverFilterCallbacks
+	encoderCb types.StreamSenderFilterCallbacks
+}
+
+func newTapFilter(context context.Context, maskHeaders map[string]bool, maskContent bool) *tapFilter {
+	return &tapFilter{
+		context:     context,
+		maskHeaders: maskHeaders,
+		maskContent: maskContent,
+	}
+}
+
+func (f *tapFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	if !sofarpc.IsSofaRequest(headers) {
+		return types.FilterHeadersStatusContinue
+	}
+
+	className := f.decoderCb.RequestContext().ClassName()
+	if f.session = reserve(className, headers); f.session != nil {
+		log.ByContext(f.context).Debugf("[Tap] capture request of class %s", className)
+		f.record = &Record{
+			Time:           time.Now(),
+			ClassName:      className,
+			RequestHeaders: f.copyHeaders(headers),
+		}
+	}
+
+	return types.FilterHeadersStatusContinue
+}
+
+func (f *tapFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.record != nil {
+		f.record.RequestContentLen += buf.Len()
+		if !f.maskContent {
+			f.record.RequestContent = append(f.record.RequestContent, buf.Bytes()...)
+		}
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *tapFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *tapFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.decoderCb = cb
+}
+
+// responses built by mosn as protocol commands are not header maps, only the content is captured
+func (f *tapFilter) AppendHeaders(headers interface{}, endStream bool) types.FilterHeadersStatus {
+	if f.record != nil {
+		if headerMap, ok := headers.(map[string]string); ok {
+			f.record.ResponseHeaders = f.copyHeaders(headerMap)
+		}
+		if endStream {
+			f.finish()
+		}
+	}
+
+	return types.FilterHeadersStatusContinue
+}
+
+func (f *tapFilter) AppendData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.record != nil {
+		f.record.ResponseContentLen += buf.Len()
+		if !f.maskContent {
+			f.record.ResponseContent = append(f.record.ResponseContent, buf.Bytes()...)
+		}
+		if endStream {
+			f.finish()
+		}
+	}
+
+	return types.FilterDataStatusContinue
+}
+
+func (f *tapFilter) AppendTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	if f.record != nil {
+		f.finish()
+	}
+
+	return types.FilterTrailersStatusContinue
+}
+
+func (f *tapFilter) SetEncoderFilterCallbacks(cb types.StreamSenderFilterCallbacks) {
+	f.encoderCb = cb
+}
+
+// request reset before the response is done is still recorded
+func (f *tapFilter) OnDestroy() {
+	if f.record != nil {
+		f.finish()
+	}
+}
+
+func (f *tapFilter) finish() {
+	f.session.finish(f.record)
+	f.session = nil
+	f.record = nil
+}
+
+// headers are modified by the encoder, the captured ones are copied with sensitive values masked
+func (f *tapFilter) copyHeaders(headers map[string]string) map[string]string {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if f.maskHeaders[k] {
+			v = MaskedValue
+		}
+		copied[k] = v
+	}
+
+	return copied
+}
+
+// ~~ factory
+type TapFilterConfigFactory struct {
+	Tap         *v2.Tap
+	maskHeaders map[string]bool
+}
+
+func (f *TapFilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	filter := newTapFilter(context, f.maskHeaders, f.Tap.MaskContent)
+	callbacks.AddStreamReceiverFilter(filter)
+	callbacks.AddStreamSenderFilter(filter)
+}
+
+func CreateTapFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	return newTapFilterFactory(config.ParseTapFilter(conf)), nil
+}
+
+func newTapFilterFactory(tap *v2.Tap) *TapFilterConfigFactory {
+	maskHeaders := make(map[string]bool, len(tap.MaskHeaders))
+	for _, name := range tap.MaskHeaders {
+		maskHeaders[name] = true
+	}
+
+	return &TapFilterConfigFactory{
+		Tap:         tap,
+		maskHeaders: maskHeaders,
+	}
+}
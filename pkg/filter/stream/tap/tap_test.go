@@ -0,0 +1,188 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/filter/stream/filtertest"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+)
+
+func newBoltRequestHeaders(className string, reqId string) map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode):      strconv.Itoa(int(sofarpc.RPC_REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        reqId,
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName):    className,
+		"user":  "alice",
+		"token": "secret",
+	}
+}
+
+func newBoltResponseHeaders() map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.RESPONSE)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        "100",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus):   strconv.Itoa(int(sofarpc.RESPONSE_STATUS_SUCCESS)),
+	}
+}
+
+// runRequest runs a bolt request and its response through a tap filter created by the factory
+func runRequest(factory *TapFilterConfigFactory, headers map[string]string, request, response string) {
+	f := newTapFilter(context.Background(), factory.maskHeaders, factory.Tap.MaskContent)
+	f.SetDecoderFilterCallbacks(filtertest.NewReceiverCallbacks(nil, headers))
+	defer f.OnDestroy()
+
+	f.OnDecodeHeaders(headers, false)
+	f.OnDecodeData(buffer.NewIoBufferString(request), true)
+	f.AppendHeaders(newBoltResponseHeaders(), false)
+	f.AppendData(buffer.NewIoBufferString(response), true)
+}
+
+func TestTapCaptureLimit(t *testing.T) {
+	factory := newTapFilterFactory(&v2.Tap{})
+	if err := Enable(Config{
+		ClassName:   "com.alipay.test.QueryService",
+		Headers:     map[string]string{"user": "alice"},
+		MaxCaptures: 3,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer Disable()
+
+	// not matched
+	runRequest(factory, newBoltRequestHeaders("com.alipay.test.PayService", "1"), "request", "response")
+	headers := newBoltRequestHeaders("com.alipay.test.QueryService", "2")
+	headers["user"] = "bob"
+	runRequest(factory, headers, "request", "response")
+	if status := GetStatus(); !status.Enabled || status.Captured != 0 || len(status.Records) != 0 {
+		t.Fatalf("requests not matched should not be captured, got %+v", status)
+	}
+
+	for i := 0; i < 5; i++ {
+		runRequest(factory, newBoltRequestHeaders("com.alipay.test.QueryService", strconv.Itoa(i)), "request"+strconv.Itoa(i), "response")
+	}
+
+	status := GetStatus()
+	if status.Enabled {
+		t.Error("tap should be disabled after max captures")
+	}
+	if status.Captured != 3 || len(status.Records) != 3 {
+		t.Fatalf("expect 3 requests captured, got %d, records %d", status.Captured, len(status.Records))
+	}
+	for i, record := range status.Records {
+		if record.ClassName != "com.alipay.test.QueryService" ||
+			record.RequestHeaders[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] != strconv.Itoa(i) ||
+			record.RequestHeaders["token"] != "secret" ||
+			string(record.RequestContent) != "request"+strconv.Itoa(i) || record.RequestContentLen != len("request0") ||
+			record.ResponseHeaders[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] != strconv.Itoa(int(sofarpc.RESPONSE_STATUS_SUCCESS)) ||
+			string(record.ResponseContent) != "response" || record.ResponseContentLen != len("response") {
+			t.Errorf("unexpected record %d: %+v", i, record)
+		}
+	}
+
+	// captured again after re-enabled
+	if err := Enable(Config{MaxCaptures: 1}); err != nil {
+		t.Fatal(err)
+	}
+	runRequest(factory, newBoltRequestHeaders("com.alipay.test.PayService", "6"), "request", "response")
+	if status := GetStatus(); status.Enabled || len(status.Records) != 1 || status.Records[0].ClassName != "com.alipay.test.PayService" {
+		t.Errorf("unexpected status after re-enabled: %+v", status)
+	}
+}
+
+func TestTapMask(t *testing.T) {
+	factory := newTapFilterFactory(&v2.Tap{MaskHeaders: []string{"token"}, MaskContent: true})
+	if err := Enable(Config{MaxCaptures: 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer Disable()
+
+	runRequest(factory, newBoltRequestHeaders("com.alipay.test.QueryService", "1"), "request", "response")
+
+	status := GetStatus()
+	if len(status.Records) != 1 {
+		t.Fatalf("expect 1 record, got %d", len(status.Records))
+	}
+	record := status.Records[0]
+	if record.RequestHeaders["token"] != MaskedValue || record.RequestHeaders["user"] != "alice" {
+		t.Errorf("unexpected request headers %v", record.RequestHeaders)
+	}
+	if record.RequestContent != nil || record.RequestContentLen != len("request") ||
+		record.ResponseContent != nil || record.ResponseContentLen != len("response") {
+		t.Errorf("content should be masked with length kept, got %+v", record)
+	}
+}
+
+func TestTapFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tap.log")
+	factory := newTapFilterFactory(&v2.Tap{})
+	if err := Enable(Config{MaxCaptures: 2, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer Disable()
+
+	// the file is still written after disabled by the last capture, until the request is done
+	f := newTapFilter(context.Background(), factory.maskHeaders, false)
+	headers := newBoltRequestHeaders("com.alipay.test.QueryService", "1")
+	f.SetDecoderFilterCallbacks(filtertest.NewReceiverCallbacks(nil, headers))
+	f.OnDecodeHeaders(headers, true)
+	runRequest(factory, newBoltRequestHeaders("com.alipay.test.QueryService", "2"), "request", "response")
+	// reset before the response
+	f.OnDestroy()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var reqIds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatalf("invalid record %s: %v", scanner.Text(), err)
+		}
+		reqIds = append(reqIds, record.RequestHeaders[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)])
+	}
+	if len(reqIds) != 2 || reqIds[0] != "2" || reqIds[1] != "1" {
+		t.Errorf("unexpected records in file, request ids %v", reqIds)
+	}
+
+	if err := Enable(Config{Path: filepath.Join(dir, "not_exist", "tap.log")}); err == nil {
+		t.Error("enable tap with invalid path should fail")
+	}
+}
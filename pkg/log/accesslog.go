@@ -45,6 +45,7 @@ func init() {
 		types.LogDownstreamLocalAddress:     DownstreamLocalAddressGetter,
 		types.LogDownstreamRemoteAddress:    DownstreamRemoteAddressGetter,
 		types.LogUpstreamHostSelectedGetter: UpstreamHostSelectedGetter,
+		types.LogCorrelationId:              CorrelationIdGetter,
 	}
 }
 
@@ -99,142 +100,109 @@ func NewAccessLogFormatter(format string) types.AccessLogFormatter {
 }
 
 func (f *accesslogformatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
-	var log string
+	buffer := accessLogPool.Get()
+	defer accessLogPool.Put(buffer)
 
 	for _, formatter := range f.formatters {
-		log += formatter.Format(reqHeaders, respHeaders, requestInfo)
+		buffer.WriteString(formatter.Format(reqHeaders, respHeaders, requestInfo))
 	}
 
-	//delete the final " "
-	if len(log) > 0 {
-		log = log[:len(log)-1]
-	}
+	return buffer.String()
+}
 
-	return log
+// types.AccessLogFormatter
+// literal text between placeholders, written as is
+type textFormatter struct {
+	text string
+}
+
+func (f *textFormatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
+	return f.text
 }
 
 // types.AccessLogFormatter
-type simpleRequestInfoFormatter struct {
-	reqInfoFormat []string
+type requestInfoFormatter struct {
+	getter func(info types.RequestInfo) string
 }
 
-func (f *simpleRequestInfoFormatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
-	// todo: map fieldName to field vale string
-	if f.reqInfoFormat == nil {
-		DefaultLogger.Debugf("No ReqInfo Format Keys Input")
-		return ""
+func (f *requestInfoFormatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
+	if requestInfo == nil {
+		return types.AccessLogEmptyValue
 	}
 
-	buffer := accessLogPool.Get()
-	defer  accessLogPool.Put(buffer)
-	for _, key := range f.reqInfoFormat {
-
-		if vFunc, ok := RequestInfoFuncMap[key]; ok {
-			buffer.WriteString(vFunc(requestInfo))
-			buffer.WriteString(" ")
-		} else {
-			DefaultLogger.Debugf("Invalid ReqInfo Format Keys: %s", key)
-		}
-	}
-	return buffer.String()
+	return f.getter(requestInfo)
 }
 
 // types.AccessLogFormatter
-type simpleReqHeadersFormatter struct {
-	reqHeaderFormat []string
+type reqHeaderFormatter struct {
+	key string
 }
 
-func (f *simpleReqHeadersFormatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
-
-	if f.reqHeaderFormat == nil {
-		DefaultLogger.Debugf("No ReqHeaders Format Keys Input")
-		return ""
-	}
-
-	buffer := accessLogPool.Get()
-	defer  accessLogPool.Put(buffer)
-	for _, key := range f.reqHeaderFormat {
-		if v, ok := reqHeaders[key]; ok {
-			buffer.WriteString(types.ReqHeaderPrefix)
-			buffer.WriteString(v)
-			buffer.WriteString(" ")
-		} else {
-			//DefaultLogger.Debugf("Invalid reqHeaders format keys when print access log: %s", key)
-		}
+func (f *reqHeaderFormatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
+	if v, ok := reqHeaders[f.key]; ok && v != "" {
+		return v
 	}
 
-	return buffer.String()
+	return types.AccessLogEmptyValue
 }
 
 // types.AccessLogFormatter
-type simpleRespHeadersFormatter struct {
-	respHeaderFormat []string
+type respHeaderFormatter struct {
+	key string
 }
 
-func (f *simpleRespHeadersFormatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
-	if f.respHeaderFormat == nil {
-		DefaultLogger.Debugf("No RespHeaders Format Keys Input")
-		return ""
+func (f *respHeaderFormatter) Format(reqHeaders map[string]string, respHeaders map[string]string, requestInfo types.RequestInfo) string {
+	if v, ok := respHeaders[f.key]; ok && v != "" {
+		return v
 	}
 
-	buffer := accessLogPool.Get()
-	defer  accessLogPool.Put(buffer)
-	for _, key := range f.respHeaderFormat {
-
-		if v, ok := respHeaders[key]; ok {
-			buffer.WriteString(types.RespHeaderPrefix)
-			buffer.WriteString(v)
-			buffer.WriteString(" ")
-		} else {
-			//DefaultLogger.Debugf("Invalid RespHeaders Format Keys:%s", key)
-		}
-	}
-
-	return buffer.String()
+	return types.AccessLogEmptyValue
 }
 
 // format to formatter by parsing format
+// the keys quoted by "%" are replaced with their values, and the text between them is kept in order
 func formatToFormatter(format string) []types.AccessLogFormatter {
+	var formatters []types.AccessLogFormatter
 
-	strArray := strings.Split(format, " ")
-
-	// delete %
-	for i := 0; i < len(strArray); i++ {
-		strArray[i] = strArray[i][1 : len(strArray[i])-1]
-	}
-
-	// classify keys
-	var reqInfoArray, reqHeaderArray, respHeaderArray []string
-	for _, s := range strArray {
-		if strings.HasPrefix(s, types.ReqHeaderPrefix) {
-			reqHeaderArray = append(reqHeaderArray, s)
+	for len(format) > 0 {
+		start := strings.IndexByte(format, '%')
+		if start < 0 {
+			formatters = append(formatters, &textFormatter{text: format})
+			break
+		}
 
-		} else if strings.HasPrefix(s, types.RespHeaderPrefix) {
-			respHeaderArray = append(respHeaderArray, s)
-		} else {
-			reqInfoArray = append(reqInfoArray, s)
+		end := strings.IndexByte(format[start+1:], '%')
+		if end < 0 {
+			// unpaired "%", keep the rest as text
+			formatters = append(formatters, &textFormatter{text: format})
+			break
 		}
-	}
+		end += start + 1
 
-	// delete REQ.
-	if reqHeaderArray != nil {
-		for i := 0; i < len(reqHeaderArray); i++ {
-			reqHeaderArray[i] = reqHeaderArray[i][len(types.ReqHeaderPrefix):]
+		if start > 0 {
+			formatters = append(formatters, &textFormatter{text: format[:start]})
 		}
-	}
 
-	// delete RESP.
-	if respHeaderArray != nil {
-		for i := 0; i < len(respHeaderArray); i++ {
-			respHeaderArray[i] = respHeaderArray[i][len(types.RespHeaderPrefix):]
+		key := format[start+1 : end]
+
+		switch {
+		case strings.HasPrefix(key, types.ReqHeaderPrefix):
+			formatters = append(formatters, &reqHeaderFormatter{key: key[len(types.ReqHeaderPrefix):]})
+		case strings.HasPrefix(key, types.RespHeaderPrefix):
+			formatters = append(formatters, &respHeaderFormatter{key: key[len(types.RespHeaderPrefix):]})
+		default:
+			if getter, ok := RequestInfoFuncMap[key]; ok {
+				formatters = append(formatters, &requestInfoFormatter{getter: getter})
+			} else {
+				StartLogger.Warnf("Invalid access log format key: %s", key)
+				formatters = append(formatters, &textFormatter{text: format[start : end+1]})
+			}
 		}
-	}
 
-	return []types.AccessLogFormatter{
-		&simpleRequestInfoFormatter{reqInfoFormat: reqInfoArray},
-		&simpleReqHeadersFormatter{reqHeaderFormat: reqHeaderArray},
-		&simpleRespHeadersFormatter{respHeaderFormat: respHeaderArray},
+		format = format[end+1:]
 	}
+
+	return formatters
 }
 
 // get request's arriving time
@@ -308,8 +276,19 @@ func DownstreamRemoteAddressGetter(info types.RequestInfo) string {
 
 // get upstream's selected host address
 func UpstreamHostSelectedGetter(info types.RequestInfo) string {
-	if info.UpstreamHost() != nil {
-		return info.UpstreamHost().Hostname()
+	if host := info.UpstreamHost(); host != nil {
+		if host.Hostname() != "" {
+			return host.Hostname()
+		}
+		return host.AddressString()
 	}
 	return "nil"
 }
+
+// CorrelationIdGetter returns the correlation id of the request, or the empty value if not tagged
+func CorrelationIdGetter(info types.RequestInfo) string {
+	if id := info.CorrelationId(); id != "" {
+		return id
+	}
+	return types.AccessLogEmptyValue
+}
@@ -1,4 +1,237 @@
 package log
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type mockHost struct {
+	types.HostInfo
+	hostname string
+	address  string
+}
+
+func (h *mockHost) Hostname() string {
+	return h.hostname
+}
+
+func (h *mockHost) AddressString() string {
+	return h.address
+}
+
+// mockRequestInfo implements the getters used by the access log formatters
+type mockRequestInfo struct {
+	types.RequestInfo
+	startTime    time.Time
+	host         types.HostInfo
+	responseCode uint32
+	responseFlag types.ResponseFlag
+}
+
+func (r *mockRequestInfo) StartTime() time.Time                      { return r.startTime }
+func (r *mockRequestInfo) RequestReceivedDuration() time.Duration    { return time.Millisecond }
+func (r *mockRequestInfo) ResponseReceivedDuration() time.Duration   { return 2 * time.Millisecond }
+func (r *mockRequestInfo) BytesSent() uint64                         { return 128 }
+func (r *mockRequestInfo) BytesReceived() uint64                     { return 256 }
+func (r *mockRequestInfo) Protocol() types.Protocol                  { return "SofaRpc" }
+func (r *mockRequestInfo) ResponseCode() uint32                      { return r.responseCode }
+func (r *mockRequestInfo) Duration() time.Duration                   { return 3 * time.Millisecond }
+func (r *mockRequestInfo) GetResponseFlag(f types.ResponseFlag) bool { return r.responseFlag&f != 0 }
+func (r *mockRequestInfo) UpstreamHost() types.HostInfo              { return r.host }
+func (r *mockRequestInfo) UpstreamLocalAddress() net.Addr            { return mockAddr("127.0.0.1:50000") }
+func (r *mockRequestInfo) DownstreamLocalAddress() net.Addr          { return mockAddr("127.0.0.1:2045") }
+func (r *mockRequestInfo) DownstreamRemoteAddress() net.Addr         { return mockAddr("127.0.0.1:40000") }
+func (r *mockRequestInfo) CorrelationId() string                     { return "0af7651916cd43dd" }
+
+type mockAddr string
+
+func (a mockAddr) Network() string { return "tcp" }
+func (a mockAddr) String() string  { return string(a) }
+
+func newMockRequestInfo() *mockRequestInfo {
+	return &mockRequestInfo{
+		startTime: time.Date(2018, 7, 1, 10, 20, 30, 0, time.Local),
+		host:      &mockHost{address: "127.0.0.1:8080"},
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	format := "[%StartTime%] %DownstreamRemoteAddress% -> %UpstreamHostSelected% " +
+		"class=%REQ.classname% status=%RESP.status% code=%ResponseCode% cost=%Duration% %REQ.missing% 100%"
+	formatter := NewAccessLogFormatter(format)
+
+	reqHeaders := map[string]string{"classname": "com.alipay.test.TestService"}
+	respHeaders := map[string]string{"status": "0"}
+
+	expected := "[2018-07-01 10:20:30 +800] 127.0.0.1:40000 -> 127.0.0.1:8080 " +
+		"class=com.alipay.test.TestService status=0 code=0 cost=3ms - 100%"
+	if log := formatter.Format(reqHeaders, respHeaders, newMockRequestInfo()); log != expected {
+		t.Errorf("unexpected access log\n got: %s\nwant: %s", log, expected)
+	}
+}
+
+func TestAccessLogFormatUnknownKey(t *testing.T) {
+	formatter := NewAccessLogFormatter("%Protocol% %Unknown%")
+
+	if log := formatter.Format(nil, nil, newMockRequestInfo()); log != "SofaRpc %Unknown%" {
+		t.Errorf("unknown keys should be kept as text, got: %s", log)
+	}
+}
+
+func TestAccessLogAllFields(t *testing.T) {
+	var keys []string
+	for key := range RequestInfoFuncMap {
+		keys = append(keys, "%"+key+"%")
+	}
+	keys = append(keys, "%REQ.classname%", "%RESP.status%")
+
+	formatter := NewAccessLogFormatter(strings.Join(keys, "|"))
+	log := formatter.Format(map[string]string{"classname": "TestService"},
+		map[string]string{"status": "0"}, newMockRequestInfo())
+
+	fields := strings.Split(log, "|")
+	if len(fields) != len(keys) {
+		t.Fatalf("expected %d fields, got %d: %s", len(keys), len(fields), log)
+	}
+
+	for i, field := range fields {
+		if field == "" || field == "nil" || field == types.AccessLogEmptyValue {
+			t.Errorf("field %s is not populated: %q", keys[i], field)
+		}
+	}
+}
+
+func TestAccessLogReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "access.log")
+	accessLog, err := NewAccessLog(output, nil, "%REQ.classname%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessLog.Log(map[string]string{"classname": "before"}, nil, newMockRequestInfo())
+
+	// rotate the file, as logrotate does before signaling mosn
+	rotated := output + ".1"
+	if err := os.Rename(output, rotated); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	accessLog.Log(map[string]string{"classname": "after"}, nil, newMockRequestInfo())
+
+	if b, _ := ioutil.ReadFile(rotated); !strings.Contains(string(b), "before") || strings.Contains(string(b), "after") {
+		t.Errorf("unexpected rotated file content: %s", b)
+	}
+
+	if b, _ := ioutil.ReadFile(output); !strings.Contains(string(b), "after") || strings.Contains(string(b), "before") {
+		t.Errorf("unexpected reopened file content: %s", b)
+	}
+}
+
+func TestSuccessSampleFilterLogsFailures(t *testing.T) {
+	filter := NewSuccessSampleFilter(0, "requestid")
+
+	for _, info := range []*mockRequestInfo{
+		{responseCode: 17},
+		{responseCode: 503},
+		{responseFlag: types.UpstreamRequestTimeout},
+		{responseFlag: types.NoHealthyUpstream | types.DelayInjected},
+	} {
+		if !filter.Decide(map[string]string{"requestid": "1"}, info) {
+			t.Errorf("failed request %+v should be logged", info)
+		}
+	}
+
+	for _, info := range []*mockRequestInfo{
+		{},
+		{responseCode: 200},
+		{responseFlag: types.DelayInjected},
+	} {
+		if filter.Decide(map[string]string{"requestid": "1"}, info) {
+			t.Errorf("successful request %+v should not be logged at rate 0", info)
+		}
+	}
+}
+
+func TestSuccessSampleFilterRate(t *testing.T) {
+	filter := NewSuccessSampleFilter(0.1, "requestid")
+	info := newMockRequestInfo()
+
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		headers := map[string]string{"requestid": strconv.Itoa(i)}
+		decision := filter.Decide(headers, info)
+		if decision {
+			sampled++
+		}
+
+		// the request is sampled in the same way by the request id
+		if filter.Decide(headers, info) != decision {
+			t.Fatalf("request %d is not sampled consistently", i)
+		}
+	}
+	if sampled < 800 || sampled > 1200 {
+		t.Errorf("expected about 1000 of 10000 successful requests sampled, got %d", sampled)
+	}
+
+	// requests without the header are sampled randomly
+	sampled = 0
+	for i := 0; i < 10000; i++ {
+		if filter.Decide(nil, info) {
+			sampled++
+		}
+	}
+	if sampled < 800 || sampled > 1200 {
+		t.Errorf("expected about 1000 of 10000 requests without request id sampled, got %d", sampled)
+	}
+
+	if all := NewSuccessSampleFilter(1, "requestid"); !all.Decide(map[string]string{"requestid": "1"}, info) {
+		t.Error("all successful requests should be logged at rate 1")
+	}
+}
+
+func TestAccessLogSuccessSample(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "access.log")
+	accessLog, err := NewAccessLog(output, NewSuccessSampleFilter(0, "requestid"), "%REQ.requestid%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	success := newMockRequestInfo()
+	failure := newMockRequestInfo()
+	failure.responseFlag = types.NoRouteFound
+
+	accessLog.Log(map[string]string{"requestid": "success"}, nil, success)
+	accessLog.Log(map[string]string{"requestid": "failure"}, nil, failure)
+
+	if b, _ := ioutil.ReadFile(output); !strings.Contains(string(b), "failure") || strings.Contains(string(b), "success") {
+		t.Errorf("only failed request should be logged, got: %s", b)
+	}
+}
+
 //
 //import (
 //	"testing"
@@ -39,4 +272,4 @@ package log
 //	for n := 0; n < b.N; n++ {
 //		accessLog.Log(reqHeaders, respHeaders, requestInfo)
 //	}
-//}
\ No newline at end of file
+//}
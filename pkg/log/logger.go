@@ -148,9 +148,9 @@ selectwriter:
 		var file *os.File
 
 		//create parent dir if not exists
-		err := os.MkdirAll(filepath.Dir(l.Output), 0755)
-
-		fmt.Println(err)
+		if err = os.MkdirAll(filepath.Dir(l.Output), 0755); err != nil {
+			return err
+		}
 
 		file, err = os.OpenFile(l.Output, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 		if err != nil {
@@ -241,14 +241,13 @@ func (l *logger) Reopen() error {
 
 	if closer, ok := l.writer.(io.WriteCloser); ok {
 		l.fileMux.Lock()
-		err := closer.Close()
+		defer l.fileMux.Unlock()
 
-		if err := l.Start(); err != nil {
+		if err := closer.Close(); err != nil {
 			return err
 		}
 
-		l.fileMux.Unlock()
-		return err
+		return l.Start()
 	}
 
 	return nil
@@ -291,3 +290,50 @@ func CloseAll() error {
 
 	return nil
 }
+
+// prefixLogger writes logs with a prefix to the underlying logger, e.g. the correlation id of a request
+type prefixLogger struct {
+	Logger
+	// escaped to be used in the format
+	prefix string
+}
+
+// WithPrefix returns a logger writing the prefix ahead of each log
+func WithPrefix(logger Logger, prefix string) Logger {
+	return &prefixLogger{
+		Logger: logger,
+		prefix: strings.Replace(prefix, "%", "%%", -1) + " ",
+	}
+}
+
+func (l *prefixLogger) Println(args ...interface{}) {
+	l.Logger.Printf(l.prefix+"%s", fmt.Sprintln(args...))
+}
+
+func (l *prefixLogger) Printf(format string, args ...interface{}) {
+	l.Logger.Printf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Infof(format string, args ...interface{}) {
+	l.Logger.Infof(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Debugf(format string, args ...interface{}) {
+	l.Logger.Debugf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Warnf(format string, args ...interface{}) {
+	l.Logger.Warnf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Errorf(format string, args ...interface{}) {
+	l.Logger.Errorf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Tracef(format string, args ...interface{}) {
+	l.Logger.Tracef(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Fatalf(format string, args ...interface{}) {
+	l.Logger.Fatalf(l.prefix+format, args...)
+}
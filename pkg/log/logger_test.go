@@ -0,0 +1,60 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrefixLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mosn_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "default.log")
+	logger, err := NewLogger(output, INFO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	prefixed := WithPrefix(logger, "[correlation_id=100%]")
+	prefixed.Errorf("upstream reset, reason: %s", "connection failed")
+	prefixed.Debugf("debug logs are filtered by the level")
+	prefixed.Println("request", 1)
+
+	b, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 logs, but got: %s", b)
+	}
+	if !strings.HasSuffix(lines[0], ErrorPre+"[correlation_id=100%] upstream reset, reason: connection failed") {
+		t.Errorf("unexpected error log: %s", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "[correlation_id=100%] request 1") {
+		t.Errorf("unexpected log: %s", lines[1])
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package log
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// sampleBuckets is the precision of the success sample rate
+const sampleBuckets = 10000
+
+// response flags of failed requests, injected delay is not a failure
+const failureResponseFlags = types.NoHealthyUpstream | types.UpstreamRequestTimeout | types.UpstreamLocalReset |
+	types.UpstreamRemoteReset | types.UpstreamConnectionFailure | types.UpstreamConnectionTermination |
+	types.UpstreamOverflow | types.NoRouteFound | types.FaultInjected | types.RateLimited | types.ExtProcFailed |
+	types.Unauthorized | types.RequestTooLarge | types.ConcurrencyLimited | types.UpstreamResponseTooLarge
+
+// types.AccessLogFilter
+// successSampleFilter logs all non-success responses and a fraction of successes
+type successSampleFilter struct {
+	threshold uint32
+	header    string
+}
+
+// NewSuccessSampleFilter creates the filter logging successful requests at the rate, the request is sampled
+// by the hash of the header value so that access logs of the request are consistent, or randomly if the
+// request has no such header
+func NewSuccessSampleFilter(rate float64, header string) types.AccessLogFilter {
+	return &successSampleFilter{
+		threshold: uint32(rate * sampleBuckets),
+		header:    header,
+	}
+}
+
+func (f *successSampleFilter) Decide(reqHeaders map[string]string, requestInfo types.RequestInfo) bool {
+	if requestInfo == nil || !isSuccess(requestInfo) {
+		return true
+	}
+
+	if value, ok := reqHeaders[f.header]; ok && value != "" {
+		h := fnv.New32a()
+		h.Write([]byte(value))
+
+		return h.Sum32()%sampleBuckets < f.threshold
+	}
+
+	return uint32(rand.Intn(sampleBuckets)) < f.threshold
+}
+
+// isSuccess tells whether the request succeeds, the response code is sofarpc response status
+// or http status code
+func isSuccess(requestInfo types.RequestInfo) bool {
+	if requestInfo.GetResponseFlag(failureResponseFlags) {
+		return false
+	}
+
+	code := requestInfo.ResponseCode()
+
+	return code == 0 || (code >= 200 && code < 300)
+}
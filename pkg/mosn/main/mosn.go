@@ -26,6 +26,8 @@ import (
 	_ "github.com/alipay/sofamosn/pkg/network"
 	_ "github.com/alipay/sofamosn/pkg/network/buffer"
 	_ "github.com/alipay/sofamosn/pkg/protocol"
+	_ "github.com/alipay/sofamosn/pkg/protocol/dubbo"
+	_ "github.com/alipay/sofamosn/pkg/protocol/thrift"
 	_ "github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
 	_ "github.com/alipay/sofamosn/pkg/upstream/healthcheck"
 	_ "github.com/alipay/sofamosn/pkg/xds"
@@ -17,26 +17,35 @@
 package mosn
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/alipay/sofamosn/pkg/admin"
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/config"
 	"github.com/alipay/sofamosn/pkg/filter"
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
 	"github.com/alipay/sofamosn/pkg/server"
 	"github.com/alipay/sofamosn/pkg/server/config/proxy"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/trace"
 	"github.com/alipay/sofamosn/pkg/types"
 	"github.com/alipay/sofamosn/pkg/upstream/cluster"
+	"github.com/alipay/sofamosn/pkg/upstream/discovery"
 	"github.com/alipay/sofamosn/pkg/xds"
 )
 
 type Mosn struct {
-	servers []server.Server
+	servers   []server.Server
+	admin     *admin.Server
+	discovery types.ServiceDiscovery
 }
 
 func NewMosn(c *config.MOSNConfig) *Mosn {
@@ -67,6 +76,10 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 	//get inherit fds
 	inheritListeners := getInheritListeners()
 
+	//cluster manager whose hosts status is reported by admin server
+	var clusterManager types.ClusterManager
+	var discoveryClusters []v2.Cluster
+
 	for _, serverConfig := range c.Servers {
 
 		//1. server config prepare
@@ -80,6 +93,7 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 		if mode == config.Xds {
 			cmf := &clusterManagerFilter{}
 			cm := cluster.NewClusterManager(nil, nil, nil, true, false)
+			clusterManager = cm
 			srv = server.NewServer(sc, cmf, cm)
 
 		} else {
@@ -94,6 +108,10 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 
 			//create cluster manager
 			cm := cluster.NewClusterManager(nil, clusters, clusterMap, c.ClusterManager.AutoDiscovery, c.ClusterManager.RegistryUseHealthCheck)
+			clusterManager = cm
+
+			//hosts of the clusters are pushed by service discovery, subscribed after admin is created
+			discoveryClusters = clusters
 			//initialize server instance
 			srv = server.NewServer(sc, cmf, cm)
 
@@ -102,6 +120,13 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 				log.StartLogger.Fatalln("no listener found")
 			}
 
+			//stream filters of all listeners are checked before any listener is added
+			for _, listenerConfig := range serverConfig.Listeners {
+				if err := checkStreamFilters(&listenerConfig); err != nil {
+					log.StartLogger.Fatalln(err)
+				}
+			}
+
 			for _, listenerConfig := range serverConfig.Listeners {
 				// parse ListenerConfig
 				lc := config.ParseListenerConfig(&listenerConfig, inheritListeners)
@@ -113,10 +138,10 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 				}
 				nfcf := GetNetworkFilter(&lc.FilterChains[0])
 
-				//stream filters
+				//stream filters, each listener has its own filter chain and filter state
 				sfcf := getStreamFilters(listenerConfig.StreamFilters)
 
-				config.SetGlobalStreamFilter(sfcf)
+				config.SetListenerStreamFilters(lc.Name, sfcf)
 				srv.AddListener(lc, nfcf, sfcf)
 			}
 		}
@@ -125,6 +150,38 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 	//parse service registry info
 	config.ParseServiceRegistry(c.ServiceRegistry)
 
+	//tracing is disabled if not configured
+	if tracing := config.ParseTracingConfig(&c.Tracing); tracing != nil {
+		reporter := trace.GetReporter(tracing.Reporter)
+		if reporter == nil {
+			log.StartLogger.Fatalln("unknown tracing reporter:", tracing.Reporter)
+		}
+		trace.SetDriver(trace.NewTracer(tracing, reporter))
+	} else {
+		trace.SetDriver(nil)
+	}
+
+	//metrics are recorded to prometheus and served by admin if no sink configured
+	sink, err := stats.NewSink(config.ParseMetricsConfig(&c.Metrics))
+	if err != nil {
+		log.StartLogger.Fatalln("create metrics sink failed:", err)
+	}
+	stats.SetSink(sink)
+
+	//frames declaring larger lengths than the limits are rejected
+	codec.SetFrameLimits(config.ParseBoltFrameLimits(&c.BoltFrameLimits))
+
+	var readiness *admin.Readiness
+	if c.Admin.Address != "" {
+		m.admin = admin.NewServer(c.Admin.Address, clusterManager)
+		readiness = m.admin.Readiness()
+	}
+
+	//mosn is not ready until the first host lists of the clusters are pushed
+	if c.ClusterManager.ServiceDiscovery != nil && mode != config.Xds {
+		m.discovery = subscribeServiceDiscovery(c.ClusterManager.ServiceDiscovery, discoveryClusters, readiness)
+	}
+
 	//close legacy listeners
 	for _, ln := range inheritListeners {
 		if !ln.Remain {
@@ -136,16 +193,114 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 }
 
 func (m *Mosn) Start() {
+	if m.admin != nil {
+		if err := m.admin.Start(); err != nil {
+			log.StartLogger.Fatalln("start admin server failed:", err)
+		}
+	}
+
 	for _, srv := range m.servers {
 		go srv.Start()
 	}
 }
 func (m *Mosn) Close() {
+	if m.discovery != nil {
+		m.discovery.Close()
+	}
+
+	if m.admin != nil {
+		m.admin.Close()
+	}
+
 	for _, srv := range m.servers {
 		srv.Close()
 	}
 }
 
+// GracefulStop stops accepting new connections, and waits in-flight requests to be done
+// up to the timeout before the remaining connections are closed forcibly, returns num of them
+func (m *Mosn) GracefulStop(timeout time.Duration) int {
+	forceClosed := 0
+	for _, srv := range m.servers {
+		forceClosed += srv.GracefulStop(timeout)
+	}
+	return forceClosed
+}
+
+func subscribeServiceDiscovery(sdConfig *config.ServiceDiscoveryConfig, clusters []v2.Cluster, readiness *admin.Readiness) types.ServiceDiscovery {
+	sd, err := discovery.New(config.ParseServiceDiscovery(sdConfig))
+	if err != nil {
+		log.StartLogger.Fatalln("create service discovery failed:", err)
+	}
+
+	var subscriber types.ServiceDiscovery = sd
+	if readiness != nil {
+		subscriber = &readinessDiscovery{ServiceDiscovery: sd, readiness: readiness}
+	}
+
+	for _, c := range clusters {
+		if err := cluster.ClusterAdap.SubscribeServiceDiscovery(subscriber, c.Name); err != nil {
+			log.StartLogger.Fatalln("subscribe service discovery failed, cluster:", c.Name, err)
+		}
+	}
+
+	return sd
+}
+
+// readinessDiscovery marks the initial discovery of a cluster done once its first host list is delivered
+type readinessDiscovery struct {
+	types.ServiceDiscovery
+	readiness *admin.Readiness
+}
+
+func (d *readinessDiscovery) Subscribe(clusterName string) (<-chan []v2.Host, error) {
+	updates, err := d.ServiceDiscovery.Subscribe(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	d.readiness.AddDiscovery(clusterName)
+
+	delivered := make(chan []v2.Host)
+	go func() {
+		defer close(delivered)
+
+		for hosts := range updates {
+			delivered <- hosts
+			d.readiness.DiscoveryDone(clusterName)
+		}
+	}()
+
+	return delivered, nil
+}
+
+// UpdateListener reloads a running listener with a new config,
+// connections accepted by the old config are drained before closed
+func (m *Mosn) UpdateListener(listenerConfig *config.ListenerConfig) error {
+	lc := config.ParseListenerConfig(listenerConfig, nil)
+
+	var nfcf types.NetworkFilterChainFactory
+	var sfcf []types.StreamFilterChainFactory
+
+	if !lc.HandOffRestoredDestinationConnections {
+		if err := checkStreamFilters(listenerConfig); err != nil {
+			return err
+		}
+
+		nfcf = GetNetworkFilter(&lc.FilterChains[0])
+		sfcf = getStreamFilters(listenerConfig.StreamFilters)
+		config.SetListenerStreamFilters(lc.Name, sfcf)
+	}
+
+	for _, srv := range m.servers {
+		if err := srv.AddListenerAndStart(lc, nfcf, sfcf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func Start(c *config.MOSNConfig, serviceCluster string, serviceNode string) {
 	log.StartLogger.Infof("start by config : %+v", c)
 
@@ -158,10 +313,17 @@ func Start(c *config.MOSNConfig, serviceCluster string, serviceNode string) {
 	}()
 
 	Mosn := NewMosn(c)
+	//mosn is not ready until the initial xds config is got
+	if Mosn.admin != nil {
+		Mosn.admin.Readiness().AddDiscovery("xds")
+	}
 	Mosn.Start()
 	////get xds config
 	xdsClient := xds.XdsClient{}
 	xdsClient.Start(c, serviceCluster, serviceNode)
+	if Mosn.admin != nil {
+		Mosn.admin.Readiness().DiscoveryDone("xds")
+	}
 	//
 	////todo: daemon running
 	wg.Wait()
@@ -171,13 +333,39 @@ func Start(c *config.MOSNConfig, serviceCluster string, serviceNode string) {
 // maybe used in proxy rewrite
 func GetNetworkFilter(c *v2.FilterChain) types.NetworkFilterChainFactory {
 
-	if len(c.Filters) != 1 || c.Filters[0].Name != v2.DEFAULT_NETWORK_FILTER {
-		log.StartLogger.Fatalln("Currently, only Proxy Network Filter Needed!")
+	if len(c.Filters) != 1 {
+		log.StartLogger.Fatalln("Currently, only one Proxy Network Filter Needed!")
+	}
+
+	switch c.Filters[0].Name {
+	case v2.DEFAULT_NETWORK_FILTER:
+		return &proxy.GenericProxyFilterConfigFactory{
+			Proxy: config.ParseProxyFilterJson(&c.Filters[0]),
+		}
+	case v2.TCP_PROXY:
+		return &proxy.TcpProxyFilterConfigFactory{
+			Proxy: config.ParseTcpProxy(c.Filters[0].Config),
+		}
+	case v2.REDIS_PROXY:
+		return &proxy.RedisProxyFilterConfigFactory{
+			Proxy: config.ParseRedisProxy(c.Filters[0].Config),
+		}
+	default:
+		log.StartLogger.Fatalln("Unsupported Network Filter: ", c.Filters[0].Name)
 	}
 
-	return &proxy.GenericProxyFilterConfigFactory{
-		Proxy: config.ParseProxyFilterJson(&c.Filters[0]),
+	return nil
+}
+
+// checkStreamFilters returns error if any stream filter of the listener is not registered
+func checkStreamFilters(listenerConfig *config.ListenerConfig) error {
+	for _, c := range listenerConfig.StreamFilters {
+		if !filter.IsRegistered(c.Type) {
+			return fmt.Errorf("unknown stream filter %s in listener %s", c.Type, listenerConfig.Name)
+		}
 	}
+
+	return nil
 }
 
 func getStreamFilters(configs []config.FilterConfig) []types.StreamFilterChainFactory {
@@ -215,10 +403,11 @@ func getInheritListeners() []*v2.ListenerConfig {
 				log.StartLogger.Errorf("recover listener from fd %d failed: %s", fd, err)
 				continue
 			}
-			if listener, ok := fileListener.(*net.TCPListener); ok {
+			switch listener := fileListener.(type) {
+			case *net.TCPListener, *net.UnixListener:
 				listeners[idx] = &v2.ListenerConfig{Addr: listener.Addr(), InheritListener: listener}
-			} else {
-				log.StartLogger.Errorf("listener recovered from fd %d is not a tcp listener", fd)
+			default:
+				log.StartLogger.Errorf("listener recovered from fd %d is not a tcp or unix listener", fd)
 			}
 		}
 		return listeners
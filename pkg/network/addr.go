@@ -0,0 +1,69 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package network
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// UnixAddressPrefix marks an address as the path of a unix domain socket, e.g. unix:///var/run/mosn.sock
+const UnixAddressPrefix = "unix://"
+
+// DefaultUnixSocketMode is the permission of the socket files created by unix listeners
+const DefaultUnixSocketMode os.FileMode = 0660
+
+// ResolveAddr resolves the listener or host address, addresses with the UnixAddressPrefix are
+// resolved as unix domain sockets, others as tcp addresses
+func ResolveAddr(address string) (net.Addr, error) {
+	if strings.HasPrefix(address, UnixAddressPrefix) {
+		return net.ResolveUnixAddr("unix", strings.TrimPrefix(address, UnixAddressPrefix))
+	}
+
+	return net.ResolveTCPAddr("tcp", address)
+}
+
+// IsUnixAddr returns true if the address is a unix domain socket
+func IsUnixAddr(addr net.Addr) bool {
+	_, ok := addr.(*net.UnixAddr)
+	return ok
+}
+
+// removeStaleSocket removes the socket file left by a process not exited normally, so that
+// the path can be listened again, files other than sockets and sockets still being listened are never removed
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.New(path + " exists and is not a unix socket")
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return errors.New(path + " is in use by another process")
+	}
+
+	return os.Remove(path)
+}
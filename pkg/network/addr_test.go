@@ -0,0 +1,54 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestResolveAddr(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		network string
+		str     string
+	}{
+		{"127.0.0.1:2045", "tcp", "127.0.0.1:2045"},
+		{"unix:///var/run/mosn.sock", "unix", "/var/run/mosn.sock"},
+		{"unix://mosn.sock", "unix", "mosn.sock"},
+	} {
+		addr, err := ResolveAddr(tc.address)
+		if err != nil {
+			t.Errorf("resolve %s failed: %v", tc.address, err)
+			continue
+		}
+		if addr.Network() != tc.network || addr.String() != tc.str {
+			t.Errorf("resolve %s expect %s %s, got %s %s", tc.address, tc.network, tc.str, addr.Network(), addr.String())
+		}
+		if IsUnixAddr(addr) != (tc.network == "unix") {
+			t.Errorf("resolve %s expect unix %v", tc.address, tc.network == "unix")
+		}
+	}
+
+	if _, err := ResolveAddr("127.0.0.1"); err == nil {
+		t.Errorf("expect address without port failed")
+	}
+
+	if IsUnixAddr(&net.TCPAddr{}) {
+		t.Errorf("tcp address is not unix")
+	}
+}
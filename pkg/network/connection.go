@@ -18,6 +18,7 @@ package network
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"net"
 	"runtime"
@@ -35,6 +36,7 @@ import (
 const (
 	ConnectionCloseDebugMsg = "Close connection %d, event %s, type %s, data read %d, data write %d"
 	DefaultBufferCapacity   = 1 << 17
+	TLSHandshakeTimeout     = 10 * time.Second
 )
 
 var idCounter uint64
@@ -54,6 +56,9 @@ type connection struct {
 	localAddressRestored bool
 	aboveHighWatermark   bool
 	bufferLimit          uint32
+	lowWatermark         uint32
+	highWatermark        uint32
+	watermarkMux         sync.Mutex
 	rawConnection        net.Conn
 	tlsMng               types.TLSContextManager
 	closeWithFlush       bool
@@ -66,7 +71,10 @@ type connection struct {
 	curWriteBufferData  []types.IoBuffer
 	readBuffer          *buffer.IoBufferPoolEntry
 	writeBuffer         *buffer.IoBufferPoolEntry
+	spareWriteBuffer    *buffer.IoBufferPoolEntry
+	bufferedBytes       int64
 	writeBufferMux      sync.RWMutex
+	writeMux            sync.Mutex
 	writeBufferChan     chan bool
 	internalLoopStarted bool
 	internalStopChan    chan struct{}
@@ -116,10 +124,41 @@ func NewServerConnection(rawc net.Conn, stopChan chan struct{}, logger log.Logge
 // watermark listener
 func (c *connection) OnHighWatermark() {
 	c.aboveHighWatermark = true
+
+	for _, cb := range c.connCallbacks {
+		if listener, ok := cb.(types.WriteBufferWatermarkListener); ok {
+			listener.OnAboveWriteBufferHighWatermark()
+		}
+	}
 }
 
 func (c *connection) OnLowWatermark() {
 	c.aboveHighWatermark = false
+
+	for _, cb := range c.connCallbacks {
+		if listener, ok := cb.(types.WriteBufferWatermarkListener); ok {
+			listener.OnBelowWriteBufferLowWatermark()
+		}
+	}
+}
+
+// checkWriteBufferWatermarks notifies the listeners when the bytes buffered to write go above
+// the high watermark, and when they drain to the low watermark after that
+func (c *connection) checkWriteBufferWatermarks() {
+	if c.highWatermark == 0 {
+		return
+	}
+
+	c.watermarkMux.Lock()
+	defer c.watermarkMux.Unlock()
+
+	buffered := atomic.LoadInt64(&c.bufferedBytes)
+
+	if !c.aboveHighWatermark && buffered > int64(c.highWatermark) {
+		c.OnHighWatermark()
+	} else if c.aboveHighWatermark && buffered <= int64(c.lowWatermark) {
+		c.OnLowWatermark()
+	}
 }
 
 // basic
@@ -177,6 +216,7 @@ func (c *connection) startReadLoop() {
 		case <-c.internalStopChan:
 			return
 		case <-c.readEnabledChan:
+			c.onReadEnabled()
 		default:
 			if c.readEnabled {
 				err := c.doRead()
@@ -197,6 +237,7 @@ func (c *connection) startReadLoop() {
 			} else {
 				select {
 				case <-c.readEnabledChan:
+					c.onReadEnabled()
 				case <-time.After(100 * time.Millisecond):
 				}
 			}
@@ -236,6 +277,14 @@ func (c *connection) doRead() (err error) {
 	return
 }
 
+// onReadEnabled dispatches the data read while reading was disabled, as no more data
+// may arrive to trigger it
+func (c *connection) onReadEnabled() {
+	if c.readEnabled && c.readBuffer != nil && c.readBuffer.Br.Len() > 0 {
+		c.filterManager.OnRead()
+	}
+}
+
 func (c *connection) updateReadBufStats(bytesRead int64, bytesBufSize int64) {
 	if c.stats == nil {
 		return
@@ -281,7 +330,8 @@ func (c *connection) Write(buffers ...types.IoBuffer) error {
 
 	for _, buf := range buffers {
 		if buf != nil {
-			buf.WriteTo(c.writeBuffer.Br)
+			n, _ := buf.WriteTo(c.writeBuffer.Br)
+			atomic.AddInt64(&c.bufferedBytes, n)
 		}
 	}
 
@@ -291,6 +341,8 @@ func (c *connection) Write(buffers ...types.IoBuffer) error {
 
 	c.writeBufferMux.Unlock()
 
+	c.checkWriteBufferWatermarks()
+
 	return nil
 }
 
@@ -346,25 +398,56 @@ func (c *connection) doWrite() (int64, error) {
 }
 
 func (c *connection) doWriteIo() (bytesSent int64, err error) {
+	// the write loop and the flush on close may write at the same time
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
 	var m int64
 
-	for c.writeBufLen() > 0 {
+	for {
 		c.writeBufferMux.Lock()
-		m, err = c.writeBuffer.Write()
+
+		if c.writeBuffer == nil || c.writeBuffer.Br.Len() == 0 {
+			c.writeBufferMux.Unlock()
+
+			return bytesSent, err
+		}
+
+		// swap out the buffered data, so that Write is not blocked while a slow peer is written
+		writing := c.writeBuffer
+		c.writeBuffer = c.spareWriteBuffer
+		c.spareWriteBuffer = nil
+
 		c.writeBufferMux.Unlock()
 
-		bytesSent += m
+		for writing.Br.Len() > 0 {
+			m, err = writing.Write()
 
-		if err != nil {
-			if te, ok := err.(net.Error); ok && te.Timeout() {
-				continue
+			bytesSent += m
+			atomic.AddInt64(&c.bufferedBytes, -m)
+			c.checkWriteBufferWatermarks()
+
+			if err != nil {
+				if te, ok := err.(net.Error); ok && te.Timeout() {
+					continue
+				}
+
+				break
 			}
+		}
+
+		// data not written on error is dropped, the connection is closed then
+		atomic.AddInt64(&c.bufferedBytes, -int64(writing.Br.Len()))
+		writing.Br.Reset()
 
-			break
+		c.writeBufferMux.Lock()
+		c.spareWriteBuffer = writing
+		c.writeBufferMux.Unlock()
+
+		if err != nil {
+			return bytesSent, err
 		}
 	}
-
-	return bytesSent, err
 }
 
 func (c *connection) updateWriteBuffStats(bytesWrite int64, bytesBufSize int64) {
@@ -382,17 +465,9 @@ func (c *connection) updateWriteBuffStats(bytesWrite int64, bytesBufSize int64)
 	}
 }
 
+// writeBufLen returns the bytes buffered to write, including the ones being written
 func (c *connection) writeBufLen() int {
-	c.writeBufferMux.RLock()
-	defer c.writeBufferMux.RUnlock()
-
-	if c.writeBuffer == nil {
-		return 0
-	}
-
-	wbLen := c.writeBuffer.Br.Len()
-
-	return wbLen
+	return int(atomic.LoadInt64(&c.bufferedBytes))
 }
 
 func (c *connection) Close(ccType types.ConnectionCloseType, eventType types.ConnectionEvent) error {
@@ -539,7 +614,10 @@ func (c *connection) SetReadDisable(disable bool) {
 
 		c.readEnabled = true
 		// only on read disable status, we need to trigger chan to wake read loop up
-		c.readEnabledChan <- true
+		select {
+		case c.readEnabledChan <- true:
+		default:
+		}
 	}
 }
 
@@ -559,6 +637,11 @@ func (c *connection) SetBufferLimit(limit uint32) {
 	}
 }
 
+func (c *connection) SetWriteBufferWatermarks(low, high uint32) {
+	c.lowWatermark = low
+	c.highWatermark = high
+}
+
 func (c *connection) BufferLimit() uint32 {
 	return c.bufferLimit
 }
@@ -600,7 +683,8 @@ func (c *connection) RawConn() net.Conn {
 type clientConnection struct {
 	connection
 
-	connectOnce sync.Once
+	connectOnce    sync.Once
+	connectTimeout time.Duration
 }
 
 func NewClientConnection(sourceAddr net.Addr, tlsMng types.TLSContextManager, remoteAddr net.Addr, stopChan chan struct{}, logger log.Logger) types.ClientConnection {
@@ -634,18 +718,26 @@ func NewClientConnection(sourceAddr net.Addr, tlsMng types.TLSContextManager, re
 	return conn
 }
 
+func (cc *clientConnection) SetConnectTimeout(timeout time.Duration) {
+	cc.connectTimeout = timeout
+}
+
 func (cc *clientConnection) Connect(ioEnabled bool) (err error) {
 	cc.connectOnce.Do(func() {
 		var localTcpAddr *net.TCPAddr
 
-		if cc.localAddr != nil {
+		// the local address is only bound on tcp connections
+		if cc.localAddr != nil && !IsUnixAddr(cc.remoteAddr) {
 			localTcpAddr, err = net.ResolveTCPAddr("tcp", cc.localAddr.String())
 		}
 
-		var remoteTcpAddr *net.TCPAddr
-		remoteTcpAddr, err = net.ResolveTCPAddr("tcp", cc.remoteAddr.String())
+		dialer := &net.Dialer{Timeout: cc.connectTimeout}
+		if localTcpAddr != nil {
+			dialer.LocalAddr = localTcpAddr
+		}
 
-		cc.rawConnection, err = net.DialTCP("tcp", localTcpAddr, remoteTcpAddr)
+		// tcp or unix, by the address resolved from the host config
+		cc.rawConnection, err = dialer.Dial(cc.remoteAddr.Network(), cc.remoteAddr.String())
 		var event types.ConnectionEvent
 
 		if err != nil {
@@ -662,9 +754,20 @@ func (cc *clientConnection) Connect(ioEnabled bool) (err error) {
 
 			if cc.tlsMng != nil && cc.tlsMng.Enabled() {
 				cc.rawConnection = cc.tlsMng.Conn(cc.rawConnection)
+
+				// handshake on connect, so that certificate verify failure is reported as connect failure
+				if tlsConn, ok := cc.rawConnection.(*tls.Conn); ok {
+					tlsConn.SetDeadline(time.Now().Add(TLSHandshakeTimeout))
+					if err = tlsConn.Handshake(); err != nil {
+						event = types.ConnectFailed
+						tlsConn.Close()
+					} else {
+						tlsConn.SetDeadline(time.Time{})
+					}
+				}
 			}
 
-			if ioEnabled {
+			if ioEnabled && event == types.Connected {
 				cc.Start(nil)
 			}
 		}
@@ -0,0 +1,128 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package network
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func init() {
+	log.InitDefaultLogger("", log.INFO)
+}
+
+type mockWatermarkListener struct {
+	above chan struct{}
+	below chan struct{}
+}
+
+func (l *mockWatermarkListener) OnEvent(event types.ConnectionEvent) {}
+
+func (l *mockWatermarkListener) OnAboveWriteBufferHighWatermark() {
+	l.above <- struct{}{}
+}
+
+func (l *mockWatermarkListener) OnBelowWriteBufferLowWatermark() {
+	l.below <- struct{}{}
+}
+
+func TestWriteBufferWatermarks(t *testing.T) {
+	rawc, peer := net.Pipe()
+	defer peer.Close()
+
+	conn := NewServerConnection(rawc, nil, log.DefaultLogger)
+	defer conn.Close(types.NoFlush, types.LocalClose)
+
+	listener := &mockWatermarkListener{
+		above: make(chan struct{}, 1),
+		below: make(chan struct{}, 1),
+	}
+	conn.SetWriteBufferWatermarks(64, 128)
+	conn.AddConnectionEventListener(listener)
+	conn.Start(context.Background())
+
+	// the peer does not read, writes are buffered without blocking
+	for i := 0; i < 4; i++ {
+		if err := conn.Write(buffer.NewIoBufferBytes(make([]byte, 64))); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	select {
+	case <-listener.above:
+	case <-time.After(time.Second):
+		t.Fatalf("high watermark not notified with %d bytes buffered", conn.(*connection).writeBufLen())
+	}
+
+	// the peer starts reading slowly
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := io.ReadFull(peer, buf); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-listener.below:
+	case <-time.After(time.Second):
+		t.Fatalf("low watermark not notified with %d bytes buffered", conn.(*connection).writeBufLen())
+	}
+
+	select {
+	case <-listener.above:
+		t.Errorf("high watermark should not be notified again")
+	default:
+	}
+}
+
+func TestWriteBufferWatermarksDisabled(t *testing.T) {
+	rawc, peer := net.Pipe()
+	defer peer.Close()
+	go io.Copy(ioutil.Discard, peer)
+
+	conn := NewServerConnection(rawc, nil, log.DefaultLogger)
+	defer conn.Close(types.NoFlush, types.LocalClose)
+
+	listener := &mockWatermarkListener{
+		above: make(chan struct{}, 1),
+		below: make(chan struct{}, 1),
+	}
+	conn.AddConnectionEventListener(listener)
+	conn.Start(context.Background())
+
+	for i := 0; i < 4; i++ {
+		conn.Write(buffer.NewIoBufferBytes(make([]byte, 64)))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case <-listener.above:
+		t.Errorf("watermarks are not checked if not set")
+	default:
+	}
+}
@@ -19,7 +19,9 @@ package network
 import (
 	"context"
 	"net"
+	"os"
 	"runtime/debug"
+	"syscall"
 	"time"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
@@ -28,6 +30,17 @@ import (
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
+// SO_REUSEPORT on linux, not defined in syscall package
+const SO_REUSEPORT = 0xf
+
+// rawListener is implemented by both *net.TCPListener and *net.UnixListener
+type rawListener interface {
+	net.Listener
+	syscall.Conn
+	SetDeadline(t time.Time) error
+	File() (*os.File, error)
+}
+
 // listener impl based on golang net package
 type listener struct {
 	name                                  string
@@ -35,9 +48,16 @@ type listener struct {
 	bindToPort                            bool
 	listenerTag                           uint64
 	perConnBufferLimitBytes               uint32
+	writeBufferLowWatermark               uint32
+	writeBufferHighWatermark              uint32
 	handOffRestoredDestinationConnections bool
+	tcpKeepAlive                          time.Duration
+	disableTCPNoDelay                     bool
+	reusePort                             bool
+	proxyProtocol                         bool
+	socketMode                            os.FileMode
 	cb                                    types.ListenerEventListener
-	rawl                                  *net.TCPListener
+	rawl                                  rawListener
 	logger                                log.Logger
 	tlsMng                                types.TLSContextManager
 }
@@ -50,13 +70,24 @@ func NewListener(lc *v2.ListenerConfig, logger log.Logger) types.Listener {
 		bindToPort:                            lc.BindToPort,
 		listenerTag:                           lc.ListenerTag,
 		perConnBufferLimitBytes:               lc.PerConnBufferLimitBytes,
+		writeBufferLowWatermark:               lc.WriteBufferLowWatermark,
+		writeBufferHighWatermark:              lc.WriteBufferHighWatermark,
 		handOffRestoredDestinationConnections: lc.HandOffRestoredDestinationConnections,
+		tcpKeepAlive:                          lc.TCPKeepAlive,
+		disableTCPNoDelay:                     lc.DisableTCPNoDelay,
+		reusePort:                             lc.ReusePort,
+		proxyProtocol:                         lc.ProxyProtocol,
+		socketMode:                            lc.SocketMode,
 		logger: logger,
 	}
 
+	if l.socketMode == 0 {
+		l.socketMode = DefaultUnixSocketMode
+	}
+
 	if lc.InheritListener != nil {
 		//inherit old process's listener
-		l.rawl = lc.InheritListener
+		l.rawl = lc.InheritListener.(rawListener)
 	}
 
 	l.tlsMng = tls.NewTLSServerContextManager(lc.FilterChains, l, logger)
@@ -131,20 +162,65 @@ func (l *listener) PerConnBufferLimitBytes() uint32 {
 	return l.perConnBufferLimitBytes
 }
 
+func (l *listener) WriteBufferWatermarks() (low, high uint32) {
+	return l.writeBufferLowWatermark, l.writeBufferHighWatermark
+}
+
 func (l *listener) SetListenerCallbacks(cb types.ListenerEventListener) {
 	l.cb = cb
 }
 
 func (l *listener) Close(lctx context.Context) error {
 	l.cb.OnClose()
+
+	// listeners inherited from the old process do not remove the socket file by default
+	if ul, ok := l.rawl.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(true)
+	}
+
 	return l.rawl.Close()
 }
 
 func (l *listener) listen(lctx context.Context) error {
+	if addr, ok := l.localAddress.(*net.UnixAddr); ok {
+		return l.listenUnix(addr)
+	}
+
 	var err error
 
 	var rawl *net.TCPListener
-	if rawl, err = net.ListenTCP("tcp", l.localAddress.(*net.TCPAddr)); err != nil {
+	if l.reusePort {
+		// SO_REUSEPORT must be set before bind
+		lc := net.ListenConfig{Control: setReusePort}
+
+		var ln net.Listener
+		if ln, err = lc.Listen(lctx, "tcp", l.localAddress.String()); err != nil {
+			return err
+		}
+		rawl = ln.(*net.TCPListener)
+	} else if rawl, err = net.ListenTCP("tcp", l.localAddress.(*net.TCPAddr)); err != nil {
+		return err
+	}
+
+	l.rawl = rawl
+
+	return nil
+}
+
+// listenUnix creates the socket file with the configured permission, the file is removed
+// when the listener is closed
+func (l *listener) listenUnix(addr *net.UnixAddr) error {
+	if err := removeStaleSocket(addr.Name); err != nil {
+		return err
+	}
+
+	rawl, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(addr.Name, l.socketMode); err != nil {
+		rawl.Close()
 		return err
 	}
 
@@ -160,6 +236,10 @@ func (l *listener) accept(lctx context.Context) error {
 		return err
 	}
 
+	if tcpConn, ok := rawc.(*net.TCPConn); ok {
+		l.setTCPOptions(tcpConn)
+	}
+
 	// TODO: use thread pool
 	go func() {
 		defer func() {
@@ -170,12 +250,61 @@ func (l *listener) accept(lctx context.Context) error {
 			}
 		}()
 
+		// the PROXY protocol header is sent before any data, including the tls handshake
+		var remoteAddr net.Addr
+		if l.proxyProtocol {
+			addr, err := ReadProxyProtocolHeader(rawc, ProxyProtocolTimeout)
+			if err != nil {
+				l.logger.Errorf("listener %s read PROXY protocol header from %s failed: %v", l.name, rawc.RemoteAddr().String(), err)
+				rawc.Close()
+				return
+			}
+			remoteAddr = addr
+		}
+
 		if l.tlsMng != nil && l.tlsMng.Enabled() {
 			rawc = l.tlsMng.Conn(rawc)
+
+			// handshake before any decode, connections failed in client certificate verify are rejected
+			if err := tls.Handshake(rawc, TLSHandshakeTimeout); err != nil {
+				l.logger.Errorf("tls handshake with %s failed: %v", rawc.RemoteAddr().String(), err)
+				rawc.Close()
+				return
+			}
 		}
 
-		l.cb.OnAccept(rawc, l.handOffRestoredDestinationConnections, nil)
+		l.cb.OnAccept(rawc, l.handOffRestoredDestinationConnections, remoteAddr)
 	}()
 
 	return nil
 }
+
+// setTCPOptions sets the configured tcp options on the accepted connection, the connection
+// is still served if an option fails to set
+func (l *listener) setTCPOptions(conn *net.TCPConn) {
+	if l.tcpKeepAlive > 0 {
+		if err := conn.SetKeepAlive(true); err != nil {
+			l.logger.Errorf("listener %s set keepalive failed: %v", l.name, err)
+		} else if err := conn.SetKeepAlivePeriod(l.tcpKeepAlive); err != nil {
+			l.logger.Errorf("listener %s set keepalive period failed: %v", l.name, err)
+		}
+	}
+
+	if l.disableTCPNoDelay {
+		if err := conn.SetNoDelay(false); err != nil {
+			l.logger.Errorf("listener %s disable tcp nodelay failed: %v", l.name, err)
+		}
+	}
+}
+
+func setReusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
@@ -0,0 +1,211 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package network
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type mockListenerEventListener struct {
+	accepted    chan net.Conn
+	remoteAddrs chan net.Addr
+}
+
+func (l *mockListenerEventListener) OnAccept(rawc net.Conn, handOffRestoredDestinationConnections bool, oriRemoteAddr net.Addr) {
+	l.accepted <- rawc
+	l.remoteAddrs <- oriRemoteAddr
+}
+
+func (l *mockListenerEventListener) OnNewConnection(conn types.Connection, ctx context.Context) {}
+
+func (l *mockListenerEventListener) OnClose() {}
+
+// startListener listens on addr, returns the listener and the callbacks receiving the accepted connections
+func startListener(t *testing.T, lc *v2.ListenerConfig) (*listener, *mockListenerEventListener) {
+	l := NewListener(lc, log.DefaultLogger).(*listener)
+	if err := l.listen(context.Background()); err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	cb := &mockListenerEventListener{accepted: make(chan net.Conn, 1), remoteAddrs: make(chan net.Addr, 1)}
+	l.SetListenerCallbacks(cb)
+	go l.Start(context.Background())
+
+	return l, cb
+}
+
+func getsockopt(t *testing.T, conn syscall.Conn, level, opt int) int {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("get raw conn failed: %v", err)
+	}
+
+	var value int
+	var sockErr error
+	rawConn.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+	})
+	if sockErr != nil {
+		t.Fatalf("getsockopt failed: %v", sockErr)
+	}
+
+	return value
+}
+
+func TestListenerTCPOptions(t *testing.T) {
+	addr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+
+	for _, lc := range []*v2.ListenerConfig{
+		{Name: "default", Addr: addr, BindToPort: true},
+		{Name: "options", Addr: addr, BindToPort: true, TCPKeepAlive: 3 * time.Second, DisableTCPNoDelay: true},
+	} {
+		l, cb := startListener(t, lc)
+
+		client, err := net.Dial("tcp", l.rawl.Addr().String())
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+
+		var conn net.Conn
+		select {
+		case conn = <-cb.accepted:
+		case <-time.After(time.Second):
+			t.Fatalf("listener %s accept timeout", lc.Name)
+		}
+
+		tcpConn := conn.(*net.TCPConn)
+		noDelay := getsockopt(t, tcpConn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY) != 0
+		if noDelay == lc.DisableTCPNoDelay {
+			t.Errorf("listener %s expect tcp nodelay %v", lc.Name, !lc.DisableTCPNoDelay)
+		}
+
+		if lc.TCPKeepAlive > 0 {
+			if getsockopt(t, tcpConn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE) == 0 {
+				t.Errorf("listener %s expect keepalive enabled", lc.Name)
+			}
+			if idle := getsockopt(t, tcpConn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); idle != 3 {
+				t.Errorf("listener %s expect keepalive idle 3s, got %ds", lc.Name, idle)
+			}
+		}
+
+		client.Close()
+		conn.Close()
+		l.rawl.Close()
+	}
+}
+
+func TestListenerReusePort(t *testing.T) {
+	addr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	first, _ := startListener(t, &v2.ListenerConfig{Name: "first", Addr: addr, BindToPort: true, ReusePort: true})
+	defer first.rawl.Close()
+
+	if getsockopt(t, first.rawl, syscall.SOL_SOCKET, SO_REUSEPORT) == 0 {
+		t.Errorf("expect SO_REUSEPORT set on the listening socket")
+	}
+
+	// another listener with SO_REUSEPORT listens on the same port
+	addr = first.rawl.Addr().(*net.TCPAddr)
+	second, _ := startListener(t, &v2.ListenerConfig{Name: "second", Addr: addr, BindToPort: true, ReusePort: true})
+	defer second.rawl.Close()
+
+	// listener without SO_REUSEPORT fails
+	third := NewListener(&v2.ListenerConfig{Name: "third", Addr: addr, BindToPort: true}, log.DefaultLogger).(*listener)
+	if err := third.listen(context.Background()); err == nil {
+		third.rawl.Close()
+		t.Errorf("expect listen on the same port failed without SO_REUSEPORT")
+	}
+}
+
+func TestListenerUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mosn_listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mosn.sock")
+
+	// the socket file left by a killed process is removed before listening
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	addr, _ := ResolveAddr(UnixAddressPrefix + path)
+	l, cb := startListener(t, &v2.ListenerConfig{Name: "unix", Addr: addr, BindToPort: true, SocketMode: 0600})
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expect socket file with mode 0600, got %v, %v", fi, err)
+	}
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case conn := <-cb.accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("unix listener accept timeout")
+	}
+
+	// listening on a path in use fails, the socket file is kept
+	busy := NewListener(&v2.ListenerConfig{Name: "busy", Addr: addr, BindToPort: true}, log.DefaultLogger).(*listener)
+	if err := busy.listen(context.Background()); err == nil {
+		t.Errorf("expect listen on the socket in use failed")
+	}
+
+	l.Close(context.Background())
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expect socket file removed after listener closed, got %v", err)
+	}
+}
+
+func TestListenerUnixPathNotSocket(t *testing.T) {
+	f, err := ioutil.TempFile("", "mosn_listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	addr, _ := ResolveAddr(UnixAddressPrefix + f.Name())
+	l := NewListener(&v2.ListenerConfig{Name: "unix", Addr: addr, BindToPort: true}, log.DefaultLogger).(*listener)
+	if err := l.listen(context.Background()); err == nil {
+		l.rawl.Close()
+		t.Fatalf("expect listen on a regular file failed")
+	}
+
+	if _, err := os.Stat(f.Name()); err != nil {
+		t.Errorf("regular file should not be removed: %v", err)
+	}
+}
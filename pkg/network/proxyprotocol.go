@@ -0,0 +1,174 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProxyProtocolTimeout is the max time to wait the PROXY protocol header after accepted
+const ProxyProtocolTimeout = 10 * time.Second
+
+const (
+	// "PROXY TCP6 " + 2 * 39 bytes ipv6 + 2 * 5 bytes port + 3 spaces + "\r\n"
+	proxyProtocolV1MaxLen = 107
+	proxyProtocolV2HdrLen = 16
+
+	proxyProtocolV2CmdLocal = 0x0
+	proxyProtocolV2CmdProxy = 0x1
+
+	proxyProtocolV2FamInet  = 0x1
+	proxyProtocolV2FamInet6 = 0x2
+)
+
+var (
+	proxyProtocolV1Sig = []byte("PROXY ")
+	proxyProtocolV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	ErrProxyProtocolSignature = errors.New("PROXY protocol signature not found")
+)
+
+// ReadProxyProtocolHeader reads the PROXY protocol header, v1 text or v2 binary, at the start of
+// the connection, and returns the source address of the client. Only the header is read, so the
+// data following the header is left in the connection. A nil address is returned for the
+// LOCAL command or the UNKNOWN protocol, e.g. the health checks of the load balancer, and the
+// address of the connection should be used.
+func ReadProxyProtocolHeader(conn net.Conn, timeout time.Duration) (net.Addr, error) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	// both signatures are distinguishable by the first 6 bytes
+	sig := make([]byte, len(proxyProtocolV1Sig))
+	if _, err := io.ReadFull(conn, sig); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(sig, proxyProtocolV1Sig):
+		return readProxyProtocolV1(conn)
+	case bytes.Equal(sig, proxyProtocolV2Sig[:len(sig)]):
+		return readProxyProtocolV2(conn, sig)
+	}
+
+	return nil, ErrProxyProtocolSignature
+}
+
+// readProxyProtocolV1 reads the rest of "PROXY TCP4 <src ip> <dst ip> <src port> <dst port>\r\n"
+func readProxyProtocolV1(conn net.Conn) (net.Addr, error) {
+	// read byte by byte, no data following the header is consumed
+	line := make([]byte, 0, proxyProtocolV1MaxLen)
+	b := make([]byte, 1)
+
+	for len(line) < proxyProtocolV1MaxLen-len(proxyProtocolV1Sig) {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+
+		line = append(line, b[0])
+		if b[0] == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY protocol v1 header not terminated by CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if fields[0] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 header: %q", line)
+	}
+
+	ip := net.ParseIP(fields[1])
+	if ip == nil || (fields[0] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid source address in PROXY protocol v1 header: %s", fields[1])
+	}
+
+	port, err := strconv.ParseUint(fields[3], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port in PROXY protocol v1 header: %s", fields[3])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyProtocolV2 reads the rest of the 16 bytes header and the addresses following it
+func readProxyProtocolV2(conn net.Conn, sig []byte) (net.Addr, error) {
+	hdr := make([]byte, proxyProtocolV2HdrLen)
+	copy(hdr, sig)
+	if _, err := io.ReadFull(conn, hdr[len(sig):]); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(hdr[:len(proxyProtocolV2Sig)], proxyProtocolV2Sig) {
+		return nil, ErrProxyProtocolSignature
+	}
+
+	if version := hdr[12] >> 4; version != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version: %d", version)
+	}
+
+	// the addresses and TLVs are read even if unused, so that the data starts right after them
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, err
+	}
+
+	switch hdr[12] & 0xf {
+	case proxyProtocolV2CmdLocal:
+		return nil, nil
+	case proxyProtocolV2CmdProxy:
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol v2 command: %d", hdr[12]&0xf)
+	}
+
+	// source address, destination address, source port, destination port
+	var ipLen int
+	switch hdr[13] >> 4 {
+	case proxyProtocolV2FamInet:
+		ipLen = net.IPv4len
+	case proxyProtocolV2FamInet6:
+		ipLen = net.IPv6len
+	default:
+		// unix socket or unspecified
+		return nil, nil
+	}
+
+	if len(payload) < 2*ipLen+4 {
+		return nil, fmt.Errorf("PROXY protocol v2 addresses truncated, length %d", len(payload))
+	}
+
+	ip := make(net.IP, ipLen)
+	copy(ip, payload[:ipLen])
+	port := binary.BigEndian.Uint16(payload[2*ipLen:])
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
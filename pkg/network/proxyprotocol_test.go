@@ -0,0 +1,187 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package network
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+)
+
+// proxyProtocolV2Header builds a v2 header of the command with the tcp addresses of src and dst
+func proxyProtocolV2Header(cmd byte, src, dst *net.TCPAddr) []byte {
+	var fam byte
+	var addrs []byte
+
+	if src != nil {
+		srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+		fam = proxyProtocolV2FamInet<<4 | 0x1
+		if srcIP == nil {
+			srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+			fam = proxyProtocolV2FamInet6<<4 | 0x1
+		}
+
+		addrs = append(addrs, srcIP...)
+		addrs = append(addrs, dstIP...)
+		addrs = append(addrs, byte(src.Port>>8), byte(src.Port), byte(dst.Port>>8), byte(dst.Port))
+	}
+
+	// a NOOP TLV is appended, which should be skipped
+	addrs = append(addrs, 0x04, 0x00, 0x01, 0x00)
+
+	hdr := append([]byte{}, proxyProtocolV2Sig...)
+	hdr = append(hdr, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(hdr[14:], uint16(len(addrs)))
+
+	return append(hdr, addrs...)
+}
+
+// readHeader writes the header followed by the payload, returns the address read and
+// checks the payload is left in the connection
+func readHeader(t *testing.T, header []byte) (net.Addr, error) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	payload := []byte("payload")
+	go client.Write(append(header, payload...))
+
+	addr, err := ReadProxyProtocolHeader(server, time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, len(payload))
+	if _, err := io.ReadFull(server, data); err != nil || string(data) != string(payload) {
+		t.Errorf("payload following the header expected, got %q, %v", data, err)
+	}
+
+	return addr, nil
+}
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	src4 := &net.TCPAddr{IP: net.ParseIP("192.168.1.10").To4(), Port: 56324}
+	dst4 := &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 2045}
+	src6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	dst6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2045}
+
+	for _, tc := range []struct {
+		name   string
+		header []byte
+		addr   string
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 2045\r\n"), "192.168.1.10:56324"},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 2045\r\n"), "[2001:db8::1]:56324"},
+		{"v1 unknown", []byte("PROXY UNKNOWN 192.168.1.10 10.0.0.1 56324 2045\r\n"), ""},
+		{"v2 tcp4", proxyProtocolV2Header(proxyProtocolV2CmdProxy, src4, dst4), "192.168.1.10:56324"},
+		{"v2 tcp6", proxyProtocolV2Header(proxyProtocolV2CmdProxy, src6, dst6), "[2001:db8::1]:56324"},
+		{"v2 local", proxyProtocolV2Header(proxyProtocolV2CmdLocal, nil, nil), ""},
+	} {
+		addr, err := readHeader(t, tc.header)
+		if err != nil {
+			t.Errorf("%s: read header failed: %v", tc.name, err)
+			continue
+		}
+
+		if tc.addr == "" {
+			if addr != nil {
+				t.Errorf("%s: no address expected, got %s", tc.name, addr)
+			}
+		} else if addr == nil || addr.String() != tc.addr {
+			t.Errorf("%s: address %s expected, got %v", tc.name, tc.addr, addr)
+		}
+	}
+}
+
+func TestReadProxyProtocolHeaderInvalid(t *testing.T) {
+	v2Header := proxyProtocolV2Header(proxyProtocolV2CmdProxy,
+		&net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1})
+	v2Header[12] = 0x11
+
+	for _, tc := range []struct {
+		name   string
+		header []byte
+	}{
+		{"no header", []byte("GET / HTTP/1.1\r\n")},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::1 10.0.0.1 56324 2045\r\n")},
+		{"v1 invalid port", []byte("PROXY TCP4 192.168.1.10 10.0.0.1 port 2045\r\n")},
+		{"v1 no crlf", []byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 2045\n")},
+		{"v2 version", v2Header},
+	} {
+		if addr, err := readHeader(t, tc.header); err == nil {
+			t.Errorf("%s: error expected, got address %v", tc.name, addr)
+		}
+	}
+
+	// header not sent in time
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	if _, err := ReadProxyProtocolHeader(server, 10*time.Millisecond); err == nil {
+		t.Errorf("timeout error expected if no header sent")
+	}
+}
+
+func TestListenerProxyProtocol(t *testing.T) {
+	addr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	l, cb := startListener(t, &v2.ListenerConfig{Name: "proxy", Addr: addr, BindToPort: true, ProxyProtocol: true})
+	defer l.rawl.Close()
+
+	// the client address in the header is passed to the callbacks
+	client, err := net.Dial("tcp", l.rawl.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	client.Write([]byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 2045\r\n"))
+
+	select {
+	case conn := <-cb.accepted:
+		defer conn.Close()
+		if remote := <-cb.remoteAddrs; remote == nil || remote.String() != "192.168.1.10:56324" {
+			t.Errorf("client address in PROXY protocol header expected, got %v", remote)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("listener accept timeout")
+	}
+
+	// connections without the header are closed
+	client, err = net.Dial("tcp", l.rawl.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	client.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	// closed with unread data, either EOF or reset is read
+	_, err = client.Read(make([]byte, 1))
+	if nerr, ok := err.(net.Error); err == nil || (ok && nerr.Timeout()) {
+		t.Errorf("connection without PROXY protocol header expected closed, got %v", err)
+	}
+
+	select {
+	case <-cb.accepted:
+		t.Errorf("connection without PROXY protocol header should not be accepted")
+	default:
+	}
+}
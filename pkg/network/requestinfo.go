@@ -39,6 +39,7 @@ type requestInfo struct {
 	downstreamRemoteAddress  net.Addr
 	isHealthCheckRequest     bool
 	routerRule               types.RouteRule
+	correlationId            string
 }
 
 func NewRequestInfoWithPort(protocol types.Protocol) types.RequestInfo {
@@ -98,6 +99,10 @@ func (r *requestInfo) ResponseCode() uint32 {
 	return r.responseCode
 }
 
+func (r *requestInfo) SetResponseCode(code uint32) {
+	r.responseCode = code
+}
+
 func (r *requestInfo) Duration() time.Duration {
 	return time.Now().Sub(r.startTime)
 }
@@ -157,3 +162,11 @@ func (r *requestInfo) RouteEntry() types.RouteRule {
 func (r *requestInfo) SetRouteEntry(routerRule types.RouteRule) {
 	r.routerRule = routerRule
 }
+
+func (r *requestInfo) CorrelationId() string {
+	return r.correlationId
+}
+
+func (r *requestInfo) SetCorrelationId(id string) {
+	r.correlationId = id
+}
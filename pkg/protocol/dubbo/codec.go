@@ -0,0 +1,205 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+var (
+	DubboPropertyHeaders = make(map[string]reflect.Kind, 7)
+)
+
+func init() {
+	DubboPropertyHeaders[sofarpc.HeaderProtocolCode] = reflect.Uint8
+	DubboPropertyHeaders[sofarpc.HeaderCmdType] = reflect.Uint8
+	DubboPropertyHeaders[sofarpc.HeaderCmdCode] = reflect.Int16
+	DubboPropertyHeaders[sofarpc.HeaderReqID] = reflect.Uint64
+	DubboPropertyHeaders[sofarpc.HeaderCodec] = reflect.Uint8
+	DubboPropertyHeaders[sofarpc.HeaderContentLen] = reflect.Int
+	DubboPropertyHeaders[HeaderStatus] = reflect.Uint8
+}
+
+// types.Encoder & types.Decoder
+type dubboCodec struct{}
+
+func (c *dubboCodec) EncodeHeaders(context context.Context, headers interface{}) (error, types.IoBuffer) {
+	if headerMap, ok := headers.(map[string]string); ok {
+		cmd := c.mapToCmd(headerMap)
+		return c.encodeHeaders(context, cmd)
+	}
+
+	return c.encodeHeaders(context, headers)
+}
+
+func (c *dubboCodec) encodeHeaders(context context.Context, headers interface{}) (error, types.IoBuffer) {
+	switch cmd := headers.(type) {
+	case *DubboRequestCommand:
+		return nil, buffer.NewIoBufferBytes(c.doEncode(cmd.Flag, 0, cmd.RequestId, cmd.BodyLen, cmd.Body))
+	case *DubboResponseCommand:
+		return nil, buffer.NewIoBufferBytes(c.doEncode(cmd.Flag, cmd.Status, cmd.RequestId, cmd.BodyLen, cmd.Body))
+	default:
+		errMsg := sofarpc.InvalidCommandType
+		err := errors.New(errMsg)
+		log.ByContext(context).Errorf("dubbo " + errMsg)
+
+		return err, nil
+	}
+}
+
+// doEncode encodes the frame header, body is appended if it is carried by the command,
+// otherwise it is sent as data of the stream
+func (c *dubboCodec) doEncode(flag, status byte, requestId uint64, bodyLen int, body []byte) []byte {
+	if body != nil {
+		bodyLen = len(body)
+	}
+
+	data := make([]byte, HEADER_LENGTH, HEADER_LENGTH+len(body))
+	data[0] = MAGIC_HIGH
+	data[1] = MAGIC_LOW
+	data[2] = flag
+	data[3] = status
+	binary.BigEndian.PutUint64(data[4:], requestId)
+	binary.BigEndian.PutUint32(data[12:], uint32(bodyLen))
+
+	return append(data, body...)
+}
+
+func (c *dubboCodec) EncodeData(context context.Context, data types.IoBuffer) types.IoBuffer {
+	return data
+}
+
+func (c *dubboCodec) EncodeTrailers(context context.Context, trailers map[string]string) types.IoBuffer {
+	return nil
+}
+
+func (c *dubboCodec) mapToCmd(headers map[string]string) interface{} {
+	cmdType, ok := sofarpc.GetPropertyValue(DubboPropertyHeaders, headers, sofarpc.HeaderCmdType).(byte)
+	if !ok {
+		return nil
+	}
+
+	cmdCode, _ := sofarpc.GetPropertyValue(DubboPropertyHeaders, headers, sofarpc.HeaderCmdCode).(int16)
+	requestId, _ := sofarpc.GetPropertyValue(DubboPropertyHeaders, headers, sofarpc.HeaderReqID).(uint64)
+	codec, _ := sofarpc.GetPropertyValue(DubboPropertyHeaders, headers, sofarpc.HeaderCodec).(byte)
+	bodyLen, _ := sofarpc.GetPropertyValue(DubboPropertyHeaders, headers, sofarpc.HeaderContentLen).(int)
+
+	flag := codec & SERIALIZATION_MASK
+	var body []byte
+
+	// heartbeat ends on headers, so the body is encoded with the header
+	if cmdCode == sofarpc.HEARTBEAT {
+		flag |= FLAG_EVENT
+		body = heartbeatBody
+	}
+
+	switch cmdType {
+	case sofarpc.REQUEST, sofarpc.REQUEST_ONEWAY:
+		flag |= FLAG_REQUEST
+		if cmdType == sofarpc.REQUEST {
+			flag |= FLAG_TWOWAY
+		}
+
+		return &DubboRequestCommand{
+			Flag:      flag,
+			RequestId: requestId,
+			BodyLen:   bodyLen,
+			Body:      body,
+		}
+	case sofarpc.RESPONSE:
+		status, _ := sofarpc.GetPropertyValue(DubboPropertyHeaders, headers, HeaderStatus).(byte)
+
+		return &DubboResponseCommand{
+			Flag:      flag,
+			Status:    status,
+			RequestId: requestId,
+			BodyLen:   bodyLen,
+			Body:      body,
+		}
+	}
+
+	return nil
+}
+
+func (c *dubboCodec) Decode(context context.Context, data types.IoBuffer) (int, interface{}) {
+	readableBytes := data.Len()
+	logger := log.ByContext(context)
+
+	if readableBytes < HEADER_LENGTH {
+		if readableBytes > 1 && data.Bytes()[1] != MAGIC_LOW {
+			return 0, nil
+		}
+
+		// not enough data for the header
+		return readableBytes, nil
+	}
+
+	bytes := data.Bytes()
+	if bytes[0] != MAGIC_HIGH || bytes[1] != MAGIC_LOW {
+		return 0, nil
+	}
+
+	flag := bytes[2]
+	status := bytes[3]
+	requestId := binary.BigEndian.Uint64(bytes[4:12])
+	bodyLen := int(binary.BigEndian.Uint32(bytes[12:16]))
+
+	read := HEADER_LENGTH + bodyLen
+	if readableBytes < read {
+		logger.Debugf("Dubbo DECODE, no enough data for fully decode")
+		return read, nil
+	}
+
+	var body []byte
+	if bodyLen > 0 {
+		body = make([]byte, bodyLen)
+		copy(body, bytes[HEADER_LENGTH:read])
+	}
+
+	data.Drain(read)
+
+	if flag&FLAG_REQUEST != 0 {
+		request := &DubboRequestCommand{
+			Flag:      flag,
+			RequestId: requestId,
+			BodyLen:   bodyLen,
+			Body:      body,
+		}
+		logger.Debugf("Dubbo DECODE REQUEST, Flag = %x, ReqID = %d", request.Flag, request.RequestId)
+
+		return read, request
+	}
+
+	response := &DubboResponseCommand{
+		Flag:      flag,
+		Status:    status,
+		RequestId: requestId,
+		BodyLen:   bodyLen,
+		Body:      body,
+	}
+	logger.Debugf("Dubbo DECODE RESPONSE, Flag = %x, Status = %d, ReqID = %d", response.Flag, response.Status, response.RequestId)
+
+	return read, response
+}
@@ -0,0 +1,227 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbo
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const testService = "com.alipay.test.DemoService"
+
+// mockDecodeFilter records decoded headers and data
+type mockDecodeFilter struct {
+	streamId string
+	headers  map[string]string
+	data     []byte
+}
+
+func (f *mockDecodeFilter) OnDecodeHeader(streamId string, headers map[string]string) types.FilterStatus {
+	f.streamId = streamId
+	f.headers = headers
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeData(streamId string, data types.IoBuffer) types.FilterStatus {
+	f.data = data.Bytes()
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeTrailer(streamId string, trailers map[string]string) types.FilterStatus {
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeError(err error, headers map[string]string) {}
+
+// buildRequestBody builds the hessian2 invocation: dubbo version, service path, service version,
+// method, parameter types, arguments and attachments
+func buildRequestBody(service, method string) []byte {
+	var body []byte
+	for _, s := range []string{"2.0.2", service, "1.0.0", method, "Ljava/lang/String;", "world"} {
+		body = append(body, encodeString(s)...)
+	}
+
+	// empty untyped map of attachments
+	return append(body, 'H', 'Z')
+}
+
+func buildFrame(flag, status byte, requestId uint64, body []byte) []byte {
+	return (&dubboCodec{}).doEncode(flag, status, requestId, 0, body)
+}
+
+func decodeAndHandle(t *testing.T, frame []byte) (interface{}, *mockDecodeFilter) {
+	read, cmd := Dubbo.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	if cmd == nil || read != len(frame) {
+		t.Fatalf("decode failed, read %d of %d", read, len(frame))
+	}
+
+	filter := &mockDecodeFilter{}
+	if err := Dubbo.GetCommandHandler().HandleCommand(nil, cmd, filter); err != nil {
+		t.Fatalf("handle command failed: %v", err)
+	}
+
+	return cmd, filter
+}
+
+// encode the decoded headers and data as the stream layer does
+func encodeFrame(t *testing.T, headers map[string]string, data []byte) []byte {
+	err, buf := Dubbo.GetEncoder().EncodeHeaders(nil, headers)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	return append(buf.Bytes(), data...)
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	body := buildRequestBody(testService, "sayHello")
+	frame := buildFrame(FLAG_REQUEST|FLAG_TWOWAY|HESSIAN2_SERIALIZATION, 0, 1<<40+7, body)
+
+	cmd, filter := decodeAndHandle(t, frame)
+	if request, ok := cmd.(*DubboRequestCommand); !ok || request.RequestId != 1<<40+7 || !request.IsTwoWay() {
+		t.Fatalf("unexpected request %+v", cmd)
+	}
+
+	for k, v := range map[string]string{
+		types.DubboRouteServiceKey: testService,
+		types.DubboRouteMethodKey:  "sayHello",
+		HeaderServiceVersion:       "1.0.0",
+		HeaderDubboVersion:         "2.0.2",
+	} {
+		if filter.headers[k] != v {
+			t.Errorf("header %s expected %s, got %s", k, v, filter.headers[k])
+		}
+	}
+	if !sofarpc.IsSofaRequest(filter.headers) {
+		t.Error("dubbo request should be recognized as request by stream layer")
+	}
+	if _, ok := filter.headers[types.HeaderOneway]; ok {
+		t.Error("twoway request should not be oneway")
+	}
+	if !bytes.Equal(filter.data, body) {
+		t.Error("body should be passed as data")
+	}
+
+	if encoded := encodeFrame(t, filter.headers, filter.data); !bytes.Equal(encoded, frame) {
+		t.Errorf("round trip mismatch\n%x\n%x", encoded, frame)
+	}
+}
+
+func TestOnewayRequest(t *testing.T) {
+	frame := buildFrame(FLAG_REQUEST|HESSIAN2_SERIALIZATION, 0, 9, buildRequestBody(testService, "notify"))
+
+	_, filter := decodeAndHandle(t, frame)
+	if _, ok := filter.headers[types.HeaderOneway]; !ok {
+		t.Error("request without twoway flag should be oneway")
+	}
+
+	if encoded := encodeFrame(t, filter.headers, filter.data); !bytes.Equal(encoded, frame) {
+		t.Errorf("round trip mismatch\n%x\n%x", encoded, frame)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	// response with value: type flag 1, then the string
+	body := append([]byte{0x91}, encodeString("hello world")...)
+	frame := buildFrame(HESSIAN2_SERIALIZATION, RESPONSE_OK, 1<<40+7, body)
+
+	_, filter := decodeAndHandle(t, frame)
+	if filter.streamId != strconv.FormatUint(1<<40+7, 10) {
+		t.Errorf("response should be decoded on stream of the request id, got %s", filter.streamId)
+	}
+	if sofarpc.IsSofaRequest(filter.headers) {
+		t.Error("dubbo response should not be recognized as request")
+	}
+	if filter.headers[HeaderStatus] != strconv.Itoa(int(RESPONSE_OK)) {
+		t.Errorf("unexpected status %s", filter.headers[HeaderStatus])
+	}
+
+	if encoded := encodeFrame(t, filter.headers, filter.data); !bytes.Equal(encoded, frame) {
+		t.Errorf("round trip mismatch\n%x\n%x", encoded, frame)
+	}
+}
+
+func TestHeartbeatRoundTrip(t *testing.T) {
+	for _, hb := range []sofarpc.ProtoBasicCmd{NewHeartbeat(3), NewHeartbeatAck(3)} {
+		err, buf := Dubbo.GetEncoder().EncodeHeaders(nil, hb)
+		if err != nil {
+			t.Fatalf("encode heartbeat failed: %v", err)
+		}
+		frame := buf.Bytes()
+		if len(frame) != HEADER_LENGTH+len(heartbeatBody) || frame[2]&FLAG_EVENT == 0 {
+			t.Fatalf("unexpected heartbeat frame %x", frame)
+		}
+
+		cmd, filter := decodeAndHandle(t, frame)
+		if cmd.(sofarpc.ProtoBasicCmd).GetCmdCode() != sofarpc.HEARTBEAT {
+			t.Errorf("event frame should be decoded as heartbeat")
+		}
+		if _, ok := filter.headers[types.HeaderStremEnd]; !ok || filter.data != nil {
+			t.Errorf("heartbeat should end on headers")
+		}
+
+		if encoded := encodeFrame(t, filter.headers, nil); !bytes.Equal(encoded, frame) {
+			t.Errorf("round trip mismatch\n%x\n%x", encoded, frame)
+		}
+	}
+}
+
+func TestDecodePartialFrame(t *testing.T) {
+	frame := buildFrame(FLAG_REQUEST|FLAG_TWOWAY|HESSIAN2_SERIALIZATION, 0, 1, buildRequestBody(testService, "sayHello"))
+
+	for _, n := range []int{2, HEADER_LENGTH, len(frame) - 1} {
+		data := buffer.NewIoBufferBytes(frame[:n])
+		if read, cmd := Dubbo.GetDecoder().Decode(nil, data); read == 0 || cmd != nil || data.Len() != n {
+			t.Errorf("partial frame of %d bytes should wait for more data, read %d, cmd %v", n, read, cmd)
+		}
+	}
+
+	if read, cmd := Dubbo.GetDecoder().Decode(nil, buffer.NewIoBufferBytes([]byte{MAGIC_HIGH, 0x00, 0x00})); read != 0 || cmd != nil {
+		t.Errorf("bad magic should not be decoded, read %d, cmd %v", read, cmd)
+	}
+}
+
+func TestBuildResponse(t *testing.T) {
+	headers := map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(PROTOCOL_CODE_DUBBO)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        "5",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec):        strconv.Itoa(int(HESSIAN2_SERIALIZATION)),
+	}
+
+	resp, err := sofarpc.BuildSofaRespMsg(nil, headers, sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR)
+	if err != nil {
+		t.Fatalf("build response failed: %v", err)
+	}
+	err, buf := sofarpc.DefaultProtocols().EncodeHeaders(nil, resp)
+	if err != nil {
+		t.Fatalf("encode response failed: %v", err)
+	}
+
+	_, cmd := Dubbo.GetDecoder().Decode(nil, buf)
+	response, ok := cmd.(*DubboResponseCommand)
+	if !ok || response.RequestId != 5 || response.Status != RESPONSE_SERVICE_NOT_FOUND {
+		t.Fatalf("unexpected response %+v", cmd)
+	}
+	if fields := decodeStrings(nil, response.Body, 1); len(fields) != 1 || fields[0] != "mosn: client_error" {
+		t.Errorf("unexpected error message %v", fields)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize/hessian"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+var streamIdCounter uint32
+
+type DubboCommandHandler struct {
+	processors map[int16]sofarpc.RemotingProcessor
+}
+
+func NewDubboCommandHandler() *DubboCommandHandler {
+	return &DubboCommandHandler{
+		processors: map[int16]sofarpc.RemotingProcessor{
+			sofarpc.RPC_REQUEST:  &DubboRequestProcessor{},
+			sofarpc.RPC_RESPONSE: &DubboResponseProcessor{},
+			sofarpc.HEARTBEAT:    &DubboHbProcessor{},
+		},
+	}
+}
+
+func (h *DubboCommandHandler) HandleCommand(context context.Context, msg interface{}, filter interface{}) error {
+	logger := log.ByContext(context)
+
+	if cmd, ok := msg.(sofarpc.ProtoBasicCmd); ok {
+		cmdCode := cmd.GetCmdCode()
+
+		if processor, ok := h.processors[cmdCode]; ok {
+			processor.Process(context, cmd, filter)
+		} else {
+			errMsg := sofarpc.UnKnownCmdcode
+			logger.Errorf(errMsg+"when decoding dubbo %d", cmdCode)
+			return errors.New(errMsg)
+		}
+	} else {
+		errMsg := sofarpc.UnKnownCmd
+		logger.Errorf(errMsg+"when decoding dubbo %v", msg)
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
+
+func (h *DubboCommandHandler) RegisterProcessor(cmdCode int16, processor *sofarpc.RemotingProcessor) {
+	if _, exists := h.processors[cmdCode]; exists {
+		log.DefaultLogger.Warnf("dubbo cmd handler [%x] alreay exist:", cmdCode)
+	} else {
+		h.processors[cmdCode] = *processor
+	}
+}
+
+type DubboRequestProcessor struct{}
+
+// CALLBACK STREAM LEVEL'S OnReceiveHeaders
+func (p *DubboRequestProcessor) Process(context context.Context, msg interface{}, filter interface{}) {
+	if cmd, ok := msg.(*DubboRequestCommand); ok {
+		deserializeRequestAllFields(context, cmd)
+		streamId := atomic.AddUint32(&streamIdCounter, 1)
+		streamIdStr := sofarpc.StreamIDConvert(streamId)
+
+		// body of heartbeat is encoded with the header, so it is not passed as data
+		var content []byte
+		if cmd.GetCmdCode() != sofarpc.HEARTBEAT {
+			content = cmd.Body
+		}
+
+		if filter, ok := filter.(types.DecodeFilter); ok {
+			if content == nil {
+				cmd.RequestHeader[types.HeaderStremEnd] = "yes"
+			}
+			// oneway request expects no response
+			if !cmd.IsTwoWay() {
+				cmd.RequestHeader[types.HeaderOneway] = "yes"
+			}
+
+			if status := filter.OnDecodeHeader(streamIdStr, cmd.RequestHeader); status == types.StopIteration {
+				return
+			}
+
+			if content != nil {
+				filter.OnDecodeData(streamIdStr, buffer.NewIoBufferBytes(content))
+			}
+		}
+	}
+}
+
+type DubboResponseProcessor struct{}
+
+func (p *DubboResponseProcessor) Process(context context.Context, msg interface{}, filter interface{}) {
+	if cmd, ok := msg.(*DubboResponseCommand); ok {
+		deserializeResponseAllFields(context, cmd)
+		reqID := strconv.FormatUint(cmd.RequestId, 10)
+
+		var content []byte
+		if cmd.GetCmdCode() != sofarpc.HEARTBEAT {
+			content = cmd.Body
+		}
+
+		if filter, ok := filter.(types.DecodeFilter); ok {
+			if content == nil {
+				cmd.ResponseHeader[types.HeaderStremEnd] = "yes"
+			}
+
+			if status := filter.OnDecodeHeader(reqID, cmd.ResponseHeader); status == types.StopIteration {
+				return
+			}
+
+			if content != nil {
+				filter.OnDecodeData(reqID, buffer.NewIoBufferBytes(content))
+			}
+		}
+	}
+}
+
+// DubboHbProcessor handles the event frames, which are proxied as bolt heartbeat
+type DubboHbProcessor struct {
+	request  DubboRequestProcessor
+	response DubboResponseProcessor
+}
+
+func (p *DubboHbProcessor) Process(context context.Context, msg interface{}, filter interface{}) {
+	switch msg.(type) {
+	case *DubboRequestCommand:
+		p.request.Process(context, msg, filter)
+	case *DubboResponseCommand:
+		p.response.Process(context, msg, filter)
+	default:
+		log.ByContext(context).Errorf("decode dubbo heart beat error")
+	}
+}
+
+// Convert dubbo's frame header and the invocation in body to Map[string]string
+func deserializeRequestAllFields(context context.Context, cmd *DubboRequestCommand) {
+	cmdType := sofarpc.REQUEST_ONEWAY
+	if cmd.IsTwoWay() {
+		cmdType = sofarpc.REQUEST
+	}
+
+	allField := sofarpc.GetMap(context, 16)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode)] = strconv.FormatUint(uint64(PROTOCOL_CODE_DUBBO), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.FormatUint(uint64(cmdType), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode)] = strconv.FormatInt(int64(cmd.GetCmdCode()), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = strconv.FormatUint(cmd.RequestId, 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec)] = strconv.FormatUint(uint64(cmd.Flag&SERIALIZATION_MASK), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(cmd.BodyLen)
+
+	if cmd.GetCmdCode() == sofarpc.RPC_REQUEST && cmd.Flag&SERIALIZATION_MASK == HESSIAN2_SERIALIZATION {
+		// dubbo version, service path, service version and method lead the invocation
+		if fields := decodeStrings(context, cmd.Body, 4); len(fields) == 4 {
+			allField[HeaderDubboVersion] = fields[0]
+			allField[types.DubboRouteServiceKey] = fields[1]
+			allField[HeaderServiceVersion] = fields[2]
+			allField[types.DubboRouteMethodKey] = fields[3]
+		}
+	}
+
+	cmd.RequestHeader = allField
+}
+
+func deserializeResponseAllFields(context context.Context, cmd *DubboResponseCommand) {
+	allField := sofarpc.GetMap(context, 8)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode)] = strconv.FormatUint(uint64(PROTOCOL_CODE_DUBBO), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.FormatUint(uint64(sofarpc.RESPONSE), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode)] = strconv.FormatInt(int64(cmd.GetCmdCode()), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = strconv.FormatUint(cmd.RequestId, 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec)] = strconv.FormatUint(uint64(cmd.Flag&SERIALIZATION_MASK), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(cmd.BodyLen)
+	allField[sofarpc.SofaPropertyHeader(HeaderStatus)] = strconv.FormatUint(uint64(cmd.Status), 10)
+
+	cmd.ResponseHeader = allField
+}
+
+// decodeStrings reads the leading n hessian2 strings of the body, returns nil if the body is malformed
+func decodeStrings(context context.Context, body []byte, n int) (fields []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.ByContext(context).Errorf("dubbo decode invocation failed: %v", r)
+			fields = nil
+		}
+	}()
+
+	decoder := hessian.NewDecoder(*bytes.NewReader(body), nil)
+	for i := 0; i < n; i++ {
+		obj, err := decoder.ReadObject()
+		if err != nil {
+			log.ByContext(context).Errorf("dubbo decode invocation failed: %v", err)
+			return nil
+		}
+
+		// null service version is allowed
+		str, _ := obj.(string)
+		fields = append(fields, str)
+	}
+
+	return fields
+}
@@ -0,0 +1,112 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func init() {
+	sofarpc.MustRegisterProtocol(PROTOCOL_CODE_DUBBO, Dubbo)
+}
+
+var Dubbo = &DubboProtocol{
+	PROTOCOL_CODE_DUBBO,
+	&dubboCodec{},
+	&dubboCodec{},
+	NewDubboCommandHandler(),
+}
+
+type DubboProtocol struct {
+	protocolCode   byte
+	encoder        types.Encoder
+	decoder        types.Decoder
+	commandHandler sofarpc.CommandHandler
+}
+
+func (d *DubboProtocol) GetEncoder() types.Encoder {
+	return d.encoder
+}
+
+func (d *DubboProtocol) GetDecoder() types.Decoder {
+	return d.decoder
+}
+
+func (d *DubboProtocol) GetCommandHandler() sofarpc.CommandHandler {
+	return d.commandHandler
+}
+
+// BuildResponse builds the dubbo response with the error message in body, the response
+// status of sofarpc is mapped to dubbo's
+func (d *DubboProtocol) BuildResponse(context context.Context, headers map[string]string, respStatus int16) (interface{}, error) {
+	requestId, ok := sofarpc.GetPropertyValue(DubboPropertyHeaders, headers, sofarpc.HeaderReqID).(uint64)
+	if !ok {
+		errMsg := sofarpc.NoReqIdFound
+		log.ByContext(context).Errorf(errMsg)
+		return headers, errors.New(errMsg)
+	}
+
+	codec := HESSIAN2_SERIALIZATION
+	if c, ok := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec)]; ok {
+		codec = sofarpc.ConvertPropertyValue(c, reflect.Uint8).(byte)
+	}
+
+	message := "mosn: " + sofarpc.ResponseStatusToError(respStatus).Type.String()
+
+	return &DubboResponseCommand{
+		Flag:      codec & SERIALIZATION_MASK,
+		Status:    responseStatus(respStatus),
+		RequestId: requestId,
+		Body:      encodeString(message),
+	}, nil
+}
+
+func responseStatus(respStatus int16) byte {
+	switch respStatus {
+	case sofarpc.RESPONSE_STATUS_SUCCESS:
+		return RESPONSE_OK
+	case sofarpc.RESPONSE_STATUS_TIMEOUT:
+		return RESPONSE_SERVER_TIMEOUT
+	case sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY:
+		return RESPONSE_THREADPOOL_EXHAUSTED
+	case sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION, sofarpc.RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION:
+		return RESPONSE_BAD_REQUEST
+	case sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR:
+		return RESPONSE_SERVICE_NOT_FOUND
+	default:
+		return RESPONSE_SERVER_ERROR
+	}
+}
+
+// encodeString encodes the ascii string in hessian2, which is the body of the error response
+func encodeString(s string) []byte {
+	if len(s) > 1023 {
+		s = s[:1023]
+	}
+
+	if len(s) < 32 {
+		return append([]byte{byte(len(s))}, s...)
+	}
+
+	return append([]byte{byte(0x30 + len(s)>>8), byte(len(s))}, s...)
+}
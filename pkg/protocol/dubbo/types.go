@@ -0,0 +1,143 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbo
+
+import (
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+)
+
+/**
+ *   Header(2B): magic, 0xdabb
+ *   Header(1B): flag, request(0x80) | twoway(0x40) | event(0x20) | serialization id(0x1f)
+ *   Header(1B): status, only used in response
+ *   Header(8B): request id
+ *   Header(4B): body length
+ *   Body:       dubbo version, service path, service version, method, ... (request)
+ *   Body:       response type, value or exception (response)
+ */
+const (
+	PROTOCOL_CODE_DUBBO = sofarpc.PROTOCOL_CODE_DUBBO
+
+	MAGIC_HIGH    byte = 0xda
+	MAGIC_LOW     byte = 0xbb
+	HEADER_LENGTH int  = 16
+
+	FLAG_REQUEST       byte = 0x80
+	FLAG_TWOWAY        byte = 0x40
+	FLAG_EVENT         byte = 0x20
+	SERIALIZATION_MASK byte = 0x1f
+
+	HESSIAN2_SERIALIZATION byte = 2
+
+	//response status
+	RESPONSE_OK                   byte = 20
+	RESPONSE_CLIENT_TIMEOUT       byte = 30
+	RESPONSE_SERVER_TIMEOUT       byte = 31
+	RESPONSE_BAD_REQUEST          byte = 40
+	RESPONSE_BAD_RESPONSE         byte = 50
+	RESPONSE_SERVICE_NOT_FOUND    byte = 60
+	RESPONSE_SERVICE_ERROR        byte = 70
+	RESPONSE_SERVER_ERROR         byte = 80
+	RESPONSE_CLIENT_ERROR         byte = 90
+	RESPONSE_THREADPOOL_EXHAUSTED byte = 100
+)
+
+// dubbo headers exposed to the stream layer, service and method are used for routing
+const (
+	HeaderStatus         string = "dubbostatus"
+	HeaderDubboVersion   string = "dubboversion"
+	HeaderServiceVersion string = "serviceversion"
+)
+
+// hessian2 serialized null, body of the heartbeat frame
+var heartbeatBody = []byte{'N'}
+
+type DubboRequestCommand struct {
+	Flag          byte
+	RequestId     uint64
+	BodyLen       int
+	Body          []byte
+	RequestHeader map[string]string
+}
+
+type DubboResponseCommand struct {
+	Flag           byte
+	Status         byte
+	RequestId      uint64
+	BodyLen        int
+	Body           []byte
+	ResponseHeader map[string]string
+}
+
+func (c *DubboRequestCommand) GetProtocol() byte {
+	return PROTOCOL_CODE_DUBBO
+}
+
+func (c *DubboRequestCommand) GetCmdCode() int16 {
+	if c.Flag&FLAG_EVENT != 0 {
+		return sofarpc.HEARTBEAT
+	}
+
+	return sofarpc.RPC_REQUEST
+}
+
+// GetReqId returns the low 32 bits of the request id
+func (c *DubboRequestCommand) GetReqId() uint32 {
+	return uint32(c.RequestId)
+}
+
+func (c *DubboRequestCommand) IsTwoWay() bool {
+	return c.Flag&FLAG_TWOWAY != 0
+}
+
+func (c *DubboResponseCommand) GetProtocol() byte {
+	return PROTOCOL_CODE_DUBBO
+}
+
+func (c *DubboResponseCommand) GetCmdCode() int16 {
+	if c.Flag&FLAG_EVENT != 0 {
+		return sofarpc.HEARTBEAT
+	}
+
+	return sofarpc.RPC_RESPONSE
+}
+
+// GetReqId returns the low 32 bits of the request id
+func (c *DubboResponseCommand) GetReqId() uint32 {
+	return uint32(c.RequestId)
+}
+
+// NewHeartbeat creates a dubbo heartbeat request, which is an event frame with null body
+func NewHeartbeat(requestId uint64) *DubboRequestCommand {
+	return &DubboRequestCommand{
+		Flag:      FLAG_REQUEST | FLAG_TWOWAY | FLAG_EVENT | HESSIAN2_SERIALIZATION,
+		RequestId: requestId,
+		BodyLen:   len(heartbeatBody),
+		Body:      heartbeatBody,
+	}
+}
+
+// NewHeartbeatAck creates the response of the dubbo heartbeat request
+func NewHeartbeatAck(requestId uint64) *DubboResponseCommand {
+	return &DubboResponseCommand{
+		Flag:      FLAG_EVENT | HESSIAN2_SERIALIZATION,
+		Status:    RESPONSE_OK,
+		RequestId: requestId,
+		BodyLen:   len(heartbeatBody),
+		Body:      heartbeatBody,
+	}
+}
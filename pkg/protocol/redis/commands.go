@@ -0,0 +1,117 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redis
+
+import (
+	"fmt"
+)
+
+// HeaderKey is the header of the load balancer context holding the key of a command,
+// the consistent hash load balancer of the redis cluster should be configured with it
+const HeaderKey = "redis_key"
+
+// keySpec describes the positions of keys in the arguments of a command,
+// lastKey is negative if it is counted from the end of arguments
+type keySpec struct {
+	firstKey int
+	lastKey  int
+	step     int
+}
+
+var (
+	singleKey = keySpec{1, 1, 1}
+	allKeys   = keySpec{1, -1, 1}
+	keyValues = keySpec{1, -1, 2}
+	twoKeys   = keySpec{1, 2, 1}
+)
+
+// commands supported by the proxy, commands without key (e.g. KEYS, FLUSHALL) and
+// transactions can not be sharded, so they are not supported
+var commands = map[string]keySpec{
+	// strings
+	"get": singleKey, "set": singleKey, "setnx": singleKey, "setex": singleKey, "psetex": singleKey,
+	"getset": singleKey, "append": singleKey, "strlen": singleKey, "incr": singleKey, "decr": singleKey,
+	"incrby": singleKey, "decrby": singleKey, "incrbyfloat": singleKey, "getrange": singleKey,
+	"setrange": singleKey, "getbit": singleKey, "setbit": singleKey, "bitcount": singleKey, "bitpos": singleKey,
+	"mget": allKeys, "mset": keyValues, "msetnx": keyValues,
+	// keys
+	"del": allKeys, "unlink": allKeys, "exists": allKeys, "touch": allKeys, "type": singleKey,
+	"expire": singleKey, "pexpire": singleKey, "expireat": singleKey, "pexpireat": singleKey,
+	"ttl": singleKey, "pttl": singleKey, "persist": singleKey, "dump": singleKey, "restore": singleKey,
+	// hashes
+	"hget": singleKey, "hset": singleKey, "hsetnx": singleKey, "hmget": singleKey, "hmset": singleKey,
+	"hdel": singleKey, "hlen": singleKey, "hkeys": singleKey, "hvals": singleKey, "hgetall": singleKey,
+	"hexists": singleKey, "hincrby": singleKey, "hincrbyfloat": singleKey, "hstrlen": singleKey, "hscan": singleKey,
+	// lists
+	"lpush": singleKey, "rpush": singleKey, "lpushx": singleKey, "rpushx": singleKey, "lpop": singleKey,
+	"rpop": singleKey, "llen": singleKey, "lindex": singleKey, "lrange": singleKey, "lset": singleKey,
+	"lrem": singleKey, "ltrim": singleKey, "linsert": singleKey, "rpoplpush": twoKeys,
+	// sets
+	"sadd": singleKey, "srem": singleKey, "scard": singleKey, "smembers": singleKey, "sismember": singleKey,
+	"spop": singleKey, "srandmember": singleKey, "sscan": singleKey, "smove": twoKeys,
+	"sinter": allKeys, "sunion": allKeys, "sdiff": allKeys,
+	// sorted sets
+	"zadd": singleKey, "zrem": singleKey, "zcard": singleKey, "zscore": singleKey, "zrank": singleKey,
+	"zrevrank": singleKey, "zrange": singleKey, "zrevrange": singleKey, "zrangebyscore": singleKey,
+	"zrevrangebyscore": singleKey, "zcount": singleKey, "zincrby": singleKey, "zremrangebyrank": singleKey,
+	"zremrangebyscore": singleKey, "zscan": singleKey,
+	// hyperloglog
+	"pfadd": singleKey, "pfcount": allKeys,
+}
+
+// Commands returns names of the supported commands
+func Commands() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// IsSupported returns true if the command can be routed by its keys
+func IsSupported(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Keys returns the keys of the command, error is returned if the command is not supported
+// or the number of arguments is wrong
+func (c *Command) Keys() ([][]byte, error) {
+	name := c.Name()
+
+	spec, ok := commands[name]
+	if !ok {
+		return nil, fmt.Errorf("ERR unsupported command '%s'", name)
+	}
+
+	lastKey := spec.lastKey
+	if lastKey < 0 {
+		lastKey += len(c.Args)
+	}
+
+	if len(c.Args) <= spec.firstKey || lastKey >= len(c.Args) || (len(c.Args)-1)%spec.step != 0 {
+		return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+
+	keys := make([][]byte, 0, (lastKey-spec.firstKey)/spec.step+1)
+	for i := spec.firstKey; i <= lastKey; i += spec.step {
+		keys = append(keys, c.Args[i])
+	}
+
+	return keys, nil
+}
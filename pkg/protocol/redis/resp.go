@@ -0,0 +1,229 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// RESP(REdis Serialization Protocol) limits
+const (
+	MaxInlineLength   = 64 * 1024
+	MaxBulkLength     = 512 * 1024 * 1024
+	MaxMultiBulkCount = 1024 * 1024
+)
+
+var (
+	ErrProtocol = errors.New("Protocol error")
+	crlf        = []byte("\r\n")
+)
+
+// Command is a redis request, the first argument is the command name
+type Command struct {
+	Args [][]byte
+}
+
+// Name returns the lower case command name
+func (c *Command) Name() string {
+	if len(c.Args) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(string(c.Args[0]))
+}
+
+// Encode encodes the command in multibulk format, inline commands are forwarded in multibulk too
+func (c *Command) Encode() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte('*')
+	buf.WriteString(strconv.Itoa(len(c.Args)))
+	buf.Write(crlf)
+
+	for _, arg := range c.Args {
+		buf.WriteByte('$')
+		buf.WriteString(strconv.Itoa(len(arg)))
+		buf.Write(crlf)
+		buf.Write(arg)
+		buf.Write(crlf)
+	}
+
+	return buf.Bytes()
+}
+
+// DecodeCommand decodes a command in multibulk or inline format from data, returns the bytes read.
+// read is 0 if data is not enough for a command, and cmd is nil for an empty inline line.
+// Args of the command refer to data, copy them before data is reused
+func DecodeCommand(data []byte) (cmd *Command, read int, err error) {
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+
+	if data[0] != '*' {
+		return decodeInline(data)
+	}
+
+	line, n, err := readLine(data, 0)
+	if err != nil || n == 0 {
+		return nil, 0, err
+	}
+
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count > MaxMultiBulkCount {
+		return nil, 0, ErrProtocol
+	}
+
+	if count <= 0 {
+		return nil, n, nil
+	}
+
+	args := make([][]byte, 0, count)
+	offset := n
+
+	for i := 0; i < count; i++ {
+		line, n, err := readLine(data, offset)
+		if err != nil || n == 0 {
+			return nil, 0, err
+		}
+
+		if line[0] != '$' {
+			return nil, 0, ErrProtocol
+		}
+
+		length, err := strconv.Atoi(string(line[1:]))
+		if err != nil || length < 0 || length > MaxBulkLength {
+			return nil, 0, ErrProtocol
+		}
+
+		offset += n
+		if len(data) < offset+length+len(crlf) {
+			return nil, 0, nil
+		}
+
+		if !bytes.Equal(data[offset+length:offset+length+len(crlf)], crlf) {
+			return nil, 0, ErrProtocol
+		}
+
+		args = append(args, data[offset:offset+length])
+		offset += length + len(crlf)
+	}
+
+	return &Command{Args: args}, offset, nil
+}
+
+// decodeInline decodes the command separated by spaces in a line, e.g. telnet input
+func decodeInline(data []byte) (*Command, int, error) {
+	idx := bytes.IndexByte(data, '\n')
+	if idx < 0 {
+		if len(data) > MaxInlineLength {
+			return nil, 0, ErrProtocol
+		}
+
+		return nil, 0, nil
+	}
+
+	fields := bytes.Fields(data[:idx])
+	if len(fields) == 0 {
+		return nil, idx + 1, nil
+	}
+
+	return &Command{Args: fields}, idx + 1, nil
+}
+
+// readLine reads the line terminated by crlf starting at offset, returns the line without crlf
+// and the bytes read, which is 0 if the line is not complete
+func readLine(data []byte, offset int) ([]byte, int, error) {
+	idx := bytes.Index(data[offset:], crlf)
+	if idx < 0 {
+		if len(data)-offset > MaxInlineLength {
+			return nil, 0, ErrProtocol
+		}
+
+		return nil, 0, nil
+	}
+
+	if idx == 0 {
+		return nil, 0, ErrProtocol
+	}
+
+	return data[offset : offset+idx], idx + len(crlf), nil
+}
+
+// ReplyLength returns the length of the first complete reply in data, 0 if data is not enough
+func ReplyLength(data []byte) (int, error) {
+	return replyLength(data, 0)
+}
+
+func replyLength(data []byte, offset int) (int, error) {
+	line, n, err := readLine(data, offset)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	switch line[0] {
+	case '+', '-', ':':
+		return n, nil
+	case '$':
+		length, err := strconv.Atoi(string(line[1:]))
+		if err != nil || length > MaxBulkLength {
+			return 0, ErrProtocol
+		}
+
+		// null bulk string
+		if length < 0 {
+			return n, nil
+		}
+
+		if len(data) < offset+n+length+len(crlf) {
+			return 0, nil
+		}
+
+		return n + length + len(crlf), nil
+	case '*':
+		count, err := strconv.Atoi(string(line[1:]))
+		if err != nil || count > MaxMultiBulkCount {
+			return 0, ErrProtocol
+		}
+
+		read := n
+		for i := 0; i < count; i++ {
+			n, err := replyLength(data, offset+read)
+			if err != nil || n == 0 {
+				return 0, err
+			}
+
+			read += n
+		}
+
+		return read, nil
+	default:
+		return 0, ErrProtocol
+	}
+}
+
+// ErrorReply encodes the error reply, msg starts with the error type, e.g. "ERR unknown command"
+func ErrorReply(msg string) []byte {
+	return []byte("-" + msg + "\r\n")
+}
+
+// StatusReply encodes the simple string reply, e.g. "OK"
+func StatusReply(msg string) []byte {
+	return []byte("+" + msg + "\r\n")
+}
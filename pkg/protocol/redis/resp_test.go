@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func argsOf(cmd *Command) []string {
+	var args []string
+	for _, arg := range cmd.Args {
+		args = append(args, string(arg))
+	}
+
+	return args
+}
+
+func TestDecodeCommand(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		args []string
+		read int
+	}{
+		{"*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n", []string{"GET", "foo"}, 22},
+		{"*3\r\n$3\r\nset\r\n$3\r\nfoo\r\n$0\r\n\r\n", []string{"set", "foo", ""}, 28},
+		{"*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n*1\r\n", []string{"MGET", "a", "b"}, 28},
+		{"SET foo  bar\r\n", []string{"SET", "foo", "bar"}, 14},
+		{"ping\n", []string{"ping"}, 5},
+	} {
+		cmd, read, err := DecodeCommand([]byte(tc.data))
+		if err != nil || cmd == nil {
+			t.Errorf("decode %q failed: %v", tc.data, err)
+			continue
+		}
+		if args := argsOf(cmd); !reflect.DeepEqual(args, tc.args) || read != tc.read {
+			t.Errorf("decode %q expected %v read %d, got %v read %d", tc.data, tc.args, tc.read, args, read)
+		}
+		if encoded, _, _ := DecodeCommand(cmd.Encode()); !reflect.DeepEqual(argsOf(encoded), tc.args) {
+			t.Errorf("encoded %q is not decoded to %v", cmd.Encode(), tc.args)
+		}
+	}
+}
+
+func TestDecodeCommandPartial(t *testing.T) {
+	data := "*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"
+	for i := 1; i < len(data); i++ {
+		if cmd, read, err := DecodeCommand([]byte(data[:i])); cmd != nil || read != 0 || err != nil {
+			t.Errorf("partial command %q should wait for more data, got %v %d %v", data[:i], cmd, read, err)
+		}
+	}
+
+	if cmd, read, err := DecodeCommand([]byte("GET fo")); cmd != nil || read != 0 || err != nil {
+		t.Errorf("partial inline command should wait for more data, got %v %d %v", cmd, read, err)
+	}
+
+	// empty inline line is skipped
+	if cmd, read, err := DecodeCommand([]byte("\r\nGET foo\r\n")); cmd != nil || read != 2 || err != nil {
+		t.Errorf("empty line should be skipped, got %v %d %v", cmd, read, err)
+	}
+}
+
+func TestDecodeCommandError(t *testing.T) {
+	for _, data := range []string{
+		"*x\r\n",
+		"*1\r\n:1\r\n",
+		"*1\r\n$-1\r\n",
+		"*1\r\n$3\r\nGETX\r\n",
+	} {
+		if _, _, err := DecodeCommand([]byte(data)); err != ErrProtocol {
+			t.Errorf("decode %q expected protocol error, got %v", data, err)
+		}
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		keys []string
+	}{
+		{[]string{"GET", "foo"}, []string{"foo"}},
+		{[]string{"set", "foo", "bar", "EX", "10"}, []string{"foo"}},
+		{[]string{"MGET", "a", "b", "c"}, []string{"a", "b", "c"}},
+		{[]string{"mset", "a", "1", "b", "2"}, []string{"a", "b"}},
+		{[]string{"del", "a"}, []string{"a"}},
+		{[]string{"rpoplpush", "src", "dst"}, []string{"src", "dst"}},
+	} {
+		cmd := &Command{}
+		for _, arg := range tc.args {
+			cmd.Args = append(cmd.Args, []byte(arg))
+		}
+
+		keys, err := cmd.Keys()
+		if err != nil {
+			t.Errorf("keys of %v failed: %v", tc.args, err)
+			continue
+		}
+		if got := argsOf(&Command{Args: keys}); !reflect.DeepEqual(got, tc.keys) {
+			t.Errorf("keys of %v expected %v, got %v", tc.args, tc.keys, got)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"get"},
+		{"mset", "a", "1", "b"},
+		{"rpoplpush", "src"},
+		{"keys", "*"},
+		{"multi"},
+	} {
+		cmd := &Command{}
+		for _, arg := range args {
+			cmd.Args = append(cmd.Args, []byte(arg))
+		}
+
+		if keys, err := cmd.Keys(); err == nil {
+			t.Errorf("keys of %v should fail, got %v", args, keys)
+		}
+	}
+}
+
+func TestReplyLength(t *testing.T) {
+	for _, reply := range []string{
+		"+OK\r\n",
+		"-ERR unknown command\r\n",
+		":1000\r\n",
+		"$3\r\nbar\r\n",
+		"$-1\r\n",
+		"*-1\r\n",
+		"*3\r\n$1\r\na\r\n$-1\r\n*2\r\n:1\r\n+b\r\n",
+	} {
+		if n, err := ReplyLength([]byte(reply + "+next\r\n")); n != len(reply) || err != nil {
+			t.Errorf("reply %q expected length %d, got %d %v", reply, len(reply), n, err)
+		}
+
+		for i := 1; i < len(reply); i++ {
+			if n, err := ReplyLength([]byte(reply[:i])); n != 0 || err != nil {
+				t.Errorf("partial reply %q should wait for more data, got %d %v", reply[:i], n, err)
+			}
+		}
+	}
+
+	if _, err := ReplyLength([]byte("?\r\n")); err != ErrProtocol {
+		t.Errorf("unknown reply type expected protocol error, got %v", err)
+	}
+}
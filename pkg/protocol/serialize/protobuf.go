@@ -0,0 +1,186 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package serialize
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+//singleton
+var ProtobufInstance = ProtobufSerialization{}
+
+const (
+	protobufWireTypeVarint  = 0
+	protobufWireTypeFixed64 = 1
+	protobufWireTypeBytes   = 2
+	protobufWireTypeFixed32 = 5
+	// field number of header entries, key and value, same as `map<string, string> headers = 1`
+	protobufFieldEntry = 1
+	protobufFieldKey   = 1
+	protobufFieldValue = 2
+)
+
+// ProtobufSerialization serializes header map in protobuf wire format of map<string, string>,
+// class name is serialized as raw bytes
+type ProtobufSerialization struct {
+}
+
+func (s *ProtobufSerialization) GetSerialNum() int {
+	return 11
+}
+
+func (s *ProtobufSerialization) Serialize(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v.(string)), nil
+	case []uint8:
+		return v.([]uint8), nil
+	case map[string]string:
+		var buf []byte
+
+		for key, value := range v.(map[string]string) {
+			entry := appendProtobufBytes(nil, protobufFieldKey, []byte(key))
+			entry = appendProtobufBytes(entry, protobufFieldValue, []byte(value))
+			buf = appendProtobufBytes(buf, protobufFieldEntry, entry)
+		}
+
+		return buf, nil
+	}
+
+	return nil, errors.New("unsupported type in ProtobufSerialization")
+}
+
+func (s *ProtobufSerialization) DeSerialize(b []byte, v interface{}) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	if sv, ok := v.(*string); ok {
+		*sv = string(b)
+
+		return sv, nil
+	}
+
+	if mv, ok := v.(*map[string]string); ok {
+		if _, err := s.DeSerializeHeaders(b, *mv, nil); err != nil {
+			return nil, err
+		}
+
+		return mv, nil
+	}
+
+	return nil, nil
+}
+
+// DeSerializeHeaders decodes the header entries, unknown fields, e.g. added by newer peers, are skipped
+// and returned along with the entries not accepted by keep. keep can be nil to accept all entries
+func (s *ProtobufSerialization) DeSerializeHeaders(b []byte, headers map[string]string, keep func(key string) bool) ([]byte, error) {
+	var raw []byte
+
+	for len(b) > 0 {
+		number, wireType, entry, n, err := readProtobufField(b)
+		if err != nil {
+			return raw, err
+		}
+		field := b[:n]
+		b = b[n:]
+
+		if number != protobufFieldEntry || wireType != protobufWireTypeBytes {
+			raw = append(raw, field...)
+			continue
+		}
+
+		var key, value []byte
+		for len(entry) > 0 {
+			field, wireType, data, n, err := readProtobufField(entry)
+			if err != nil {
+				return raw, err
+			}
+			entry = entry[n:]
+
+			if wireType != protobufWireTypeBytes {
+				continue
+			}
+
+			switch field {
+			case protobufFieldKey:
+				key = data
+			case protobufFieldValue:
+				value = data
+			}
+		}
+
+		if keep != nil && !keep(string(key)) {
+			raw = append(raw, field...)
+			continue
+		}
+
+		headers[string(key)] = string(value)
+	}
+
+	return raw, nil
+}
+
+func appendProtobufBytes(buf []byte, field uint64, data []byte) []byte {
+	var varint [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(varint[:], field<<3|protobufWireTypeBytes)
+	buf = append(buf, varint[:n]...)
+	n = binary.PutUvarint(varint[:], uint64(len(data)))
+	buf = append(buf, varint[:n]...)
+
+	return append(buf, data...)
+}
+
+// readProtobufField reads a field of wire type varint, 64-bit, length-delimited or 32-bit, returns field number,
+// wire type, data of length-delimited field and bytes read
+func readProtobufField(b []byte) (uint64, uint64, []byte, int, error) {
+	tag, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, nil, 0, errors.New("invalid protobuf field")
+	}
+
+	wireType := tag & 0x7
+	switch wireType {
+	case protobufWireTypeVarint:
+		if _, m := binary.Uvarint(b[n:]); m > 0 {
+			return tag >> 3, wireType, nil, n + m, nil
+		}
+	case protobufWireTypeFixed64, protobufWireTypeFixed32:
+		size := 8
+		if wireType == protobufWireTypeFixed32 {
+			size = 4
+		}
+
+		if len(b)-n >= size {
+			return tag >> 3, wireType, nil, n + size, nil
+		}
+	case protobufWireTypeBytes:
+		length, m := binary.Uvarint(b[n:])
+		if m > 0 && uint64(len(b)-n-m) >= length {
+			read := n + m + int(length)
+			return tag >> 3, wireType, b[n+m : read], read, nil
+		}
+	default:
+		return 0, 0, nil, 0, errors.New("invalid protobuf field")
+	}
+
+	return 0, 0, nil, 0, errors.New("no enough bytes")
+}
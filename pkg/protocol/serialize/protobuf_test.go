@@ -0,0 +1,78 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package serialize
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestProtobufSerializeMap(t *testing.T) {
+	headers := map[string]string{
+		"service": "com.alipay.test.TestService:1.0",
+		"empty":   "",
+	}
+
+	buf, err := ProtobufInstance.Serialize(headers)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+
+	result := make(map[string]string)
+	if _, err := ProtobufInstance.DeSerialize(buf, &result); err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(headers, result) {
+		t.Errorf("expect %v, got %v", headers, result)
+	}
+
+	if _, err := ProtobufInstance.DeSerialize(buf[:len(buf)-1], &result); err == nil {
+		t.Errorf("expect error on truncated bytes")
+	}
+}
+
+func TestProtobufDeSerializeHeaders(t *testing.T) {
+	buf, _ := ProtobufInstance.Serialize(map[string]string{
+		"service": "com.alipay.test.TestService:1.0",
+		"timeout": "3000",
+	})
+	// unknown fields of varint, 64-bit, bytes and 32-bit
+	unknown := []byte{0x10, 0x96, 0x01, 0x19, 1, 2, 3, 4, 5, 6, 7, 8, 0x22, 0x01, 'a', 0x2d, 1, 2, 3, 4}
+	buf = append(buf, unknown...)
+
+	headers := make(map[string]string)
+	raw, err := ProtobufInstance.DeSerializeHeaders(buf, headers, func(key string) bool {
+		return key != "timeout"
+	})
+	if err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(headers, map[string]string{"service": "com.alipay.test.TestService:1.0"}) {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	rest := make(map[string]string)
+	if _, err := ProtobufInstance.DeSerialize(raw, &rest); err != nil || rest["timeout"] != "3000" || len(rest) != 1 {
+		t.Errorf("expect rejected entry kept, got %v, err %v", rest, err)
+	}
+	if !bytes.HasSuffix(raw, unknown) {
+		t.Errorf("expect unknown fields kept")
+	}
+}
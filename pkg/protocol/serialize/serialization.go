@@ -0,0 +1,65 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package serialize
+
+import (
+	"sync"
+)
+
+// Serialization serializes class name and header map of rpc commands
+type Serialization interface {
+	GetSerialNum() int
+
+	Serialize(v interface{}) ([]byte, error)
+
+	DeSerialize(b []byte, v interface{}) (interface{}, error)
+}
+
+// HeaderPreserver is implemented by serializations able to keep the header entries not decoded into
+// the header map in their serialized form, so that they are re-emitted unchanged on encode
+type HeaderPreserver interface {
+	// DeSerializeHeaders decodes the entries with keys accepted by keep into headers, keep can be nil to accept all.
+	// The other entries, and the unknown fields if any, are returned as serialized, valid to be appended to
+	// a serialized header map
+	DeSerializeHeaders(b []byte, headers map[string]string, keep func(key string) bool) ([]byte, error)
+}
+
+var (
+	serializations    = make(map[byte]Serialization)
+	serializationsMux sync.RWMutex
+)
+
+// RegisterSerialization registers serialization for the codec byte in rpc commands
+func RegisterSerialization(codec byte, serialization Serialization) {
+	serializationsMux.Lock()
+	defer serializationsMux.Unlock()
+
+	serializations[codec] = serialization
+}
+
+// GetSerialization returns serialization registered for codec, SimpleSerialization
+// is returned if codec is not registered
+func GetSerialization(codec byte) Serialization {
+	serializationsMux.RLock()
+	defer serializationsMux.RUnlock()
+
+	if serialization, ok := serializations[codec]; ok {
+		return serialization
+	}
+
+	return &Instance
+}
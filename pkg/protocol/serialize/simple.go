@@ -71,7 +71,7 @@ func (s *SimpleSerialization) DeSerialize(b []byte, v interface{}) (interface{},
 	}
 
 	if mv, ok := v.(*map[string]string); ok {
-		err := decodeMap(b, mv)
+		err := decodeMap(b, *mv, nil)
 
 		if err != nil {
 			return nil, err
@@ -83,6 +83,21 @@ func (s *SimpleSerialization) DeSerialize(b []byte, v interface{}) (interface{},
 	return nil, nil
 }
 
+func (s *SimpleSerialization) DeSerializeHeaders(b []byte, headers map[string]string, keep func(key string) bool) ([]byte, error) {
+	var raw []byte
+
+	err := decodeMap(b, headers, func(key string, entry []byte) bool {
+		if keep == nil || keep(key) {
+			return true
+		}
+
+		raw = append(raw, entry...)
+		return false
+	})
+
+	return raw, err
+}
+
 func (s *SimpleSerialization) SerializeMulti(v []interface{}) ([]byte, error) {
 	// TODO support multi value
 	if len(v) == 0 {
@@ -127,36 +142,48 @@ func decodeString(b []byte, result *string) (int, error) {
 
 /**
 这个map是参考com.alipay.sofa.rpc.remoting.codec.SimpleMapSerializer进行实现的.
+entries are put into result if entry is nil or returns true for the key and the serialized bytes of the entry
 */
-func decodeMap(b []byte, result *map[string]string) error {
+func decodeMap(b []byte, result map[string]string, entry func(key string, raw []byte) bool) error {
 	totalLen := len(b)
 	index := 0
 
 	for index < totalLen {
+		start := index
 
-		length, err := readInt32(b[index:])
+		key, n, err := readSized(b[index:])
 		if err != nil {
 			return err
 		}
-		index += 4
+		index += n
 
-		key := b[index : index+length]
-		index += length
-
-		length, err = readInt32(b[index:])
+		value, n, err := readSized(b[index:])
 		if err != nil {
 			return err
 		}
-		index += 4
-
-		value := b[index : index+length]
-		index += length
+		index += n
 
-		(*result)[string(key)] = string(value)
+		if entry == nil || entry(string(key), b[start:index]) {
+			result[string(key)] = string(value)
+		}
 	}
 	return nil
 }
 
+// readSized reads a field prefixed by its int32 length, returns the field and bytes read
+func readSized(b []byte) ([]byte, int, error) {
+	length, err := readInt32(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if length > len(b)-4 {
+		return nil, 0, errors.New("no enough bytes")
+	}
+
+	return b[4 : 4+length], 4 + length, nil
+}
+
 func encodeString(v string, buf *bytes.Buffer) (int, error) {
 	b := unsafeStrToByte(v)
 
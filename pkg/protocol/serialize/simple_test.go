@@ -1,6 +1,7 @@
 package serialize
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -45,3 +46,31 @@ func BenchmarkDeSerializeString(b *testing.B) {
 		Instance.DeSerialize(buf, &class)
 	}
 }
+
+func TestSimpleDeSerializeHeaders(t *testing.T) {
+	buf, _ := Instance.Serialize(map[string]string{
+		"service": "com.alipay.test.TestService:1.0",
+		"timeout": "3000",
+	})
+
+	headers := make(map[string]string)
+	raw, err := Instance.DeSerializeHeaders(buf, headers, func(key string) bool {
+		return key != "timeout"
+	})
+	if err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(headers, map[string]string{"service": "com.alipay.test.TestService:1.0"}) {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	rest := make(map[string]string)
+	if _, err := Instance.DeSerialize(raw, &rest); err != nil || !reflect.DeepEqual(rest, map[string]string{"timeout": "3000"}) {
+		t.Errorf("expect rejected entry kept, got %v, err %v", rest, err)
+	}
+
+	if _, err := Instance.DeSerializeHeaders(buf[:len(buf)-1], headers, nil); err == nil {
+		t.Errorf("expect error on truncated bytes")
+	}
+}
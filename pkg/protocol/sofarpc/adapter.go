@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"strconv"
 
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
@@ -45,6 +46,67 @@ func GetPropertyValue(properHeaders map[string]reflect.Kind, headers map[string]
 	return nil
 }
 
+// proxy headers set and consumed by mosn itself, which are never sent in bolt header map.
+// The mirror tag is not included, it's sent to the upstream to stop mirroring in the next hop
+var proxyHeaderSet = map[string]bool{
+	types.HeaderStatus:         true,
+	types.HeaderMethod:         true,
+	types.HeaderHost:           true,
+	types.HeaderPath:           true,
+	types.HeaderQueryString:    true,
+	types.HeaderStreamID:       true,
+	types.HeaderGlobalTimeout:  true,
+	types.HeaderTryTimeout:     true,
+	types.HeaderException:      true,
+	types.HeaderStremEnd:       true,
+	types.HeaderOneway:         true,
+	types.HeaderPeerIdentity:   true,
+	types.HeaderSourceIP:       true,
+	types.HeaderCompression:    true,
+	types.HeaderWireContentLen: true,
+	HeaderRawHeaders:           true,
+}
+
+var boltProtocolHeaderSet = make(map[string]bool, len(boltProtocolHeaders))
+
+func init() {
+	for _, name := range boltProtocolHeaders {
+		boltProtocolHeaderSet[SofaPropertyHeader(name)] = true
+	}
+}
+
+// IsHeaderMapKey tells whether the bolt header entry of the key can be decoded into the header map,
+// keys colliding with the property headers or the proxy headers would be mistaken for them
+func IsHeaderMapKey(key string) bool {
+	return !boltProtocolHeaderSet[key] && !proxyHeaderSet[key]
+}
+
+// DeserializeHeaderMap decodes the serialized bolt header map into headers, returns the entries can't be
+// decoded into headers in serialized form, which is set as HeaderRawHeaders and re-emitted unchanged
+// by SerializeHeaderMap. Unknown fields of the serialization are kept in the same way if supported
+func DeserializeHeaderMap(serialization serialize.Serialization, b []byte, headers map[string]string) string {
+	preserver, ok := serialization.(serialize.HeaderPreserver)
+	if !ok {
+		serialization.DeSerialize(b, &headers)
+		return ""
+	}
+
+	raw, _ := preserver.DeSerializeHeaders(b, headers, IsHeaderMapKey)
+
+	return string(raw)
+}
+
+// SerializeHeaderMap serializes the rest headers after the property headers are removed,
+// the raw entries kept on decoding are appended unchanged
+func SerializeHeaderMap(serialization serialize.Serialization, headers map[string]string) []byte {
+	raw := headers[HeaderRawHeaders]
+	delete(headers, HeaderRawHeaders)
+
+	header, _ := serialization.Serialize(headers)
+
+	return append(header, raw...)
+}
+
 func ConvertPropertyValue(strValue string, kind reflect.Kind) interface{} {
 	switch kind {
 	case reflect.Uint8:
@@ -79,10 +141,11 @@ func ConvertPropertyValue(strValue string, kind reflect.Kind) interface{} {
 func IsSofaRequest(headers map[string]string) bool {
 	procode := ConvertPropertyValue(headers[SofaPropertyHeader(HeaderProtocolCode)], reflect.Uint8)
 
-	if procode == PROTOCOL_CODE_V1 || procode == PROTOCOL_CODE_V2 {
+	if procode == PROTOCOL_CODE_V1 || procode == PROTOCOL_CODE_V2 || procode == PROTOCOL_CODE_DUBBO ||
+		procode == PROTOCOL_CODE_THRIFT {
 		cmdtype := ConvertPropertyValue(headers[SofaPropertyHeader(HeaderCmdType)], reflect.Uint8)
 
-		if cmdtype == REQUEST {
+		if cmdtype == REQUEST || cmdtype == REQUEST_ONEWAY {
 			return true
 		}
 	} else if procode == PROTOCOL_CODE_TR {
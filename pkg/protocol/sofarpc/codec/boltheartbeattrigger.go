@@ -0,0 +1,176 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// sofarpc.HeartbeatTrigger
+// types.ConnectionEventListener
+type boltHeartbeatTrigger struct {
+	context    context.Context
+	protocol   *BoltProtocol
+	connection types.Connection
+	interval   time.Duration
+	maxMissed  int
+	// request ids of heartbeats are taken from the stream id counter of the connection
+	nextRequestId func() uint32
+	// unix nano of the last read or write on the connection, accessed atomically
+	lastActive int64
+
+	mux         sync.Mutex
+	outstanding map[uint32]bool
+	missed      int
+	stopped     bool
+	stopChan    chan struct{}
+}
+
+func newBoltHeartbeatTrigger(context context.Context, protocol *BoltProtocol, connection types.Connection,
+	interval time.Duration, nextRequestId func() uint32) *boltHeartbeatTrigger {
+	return &boltHeartbeatTrigger{
+		context:       context,
+		protocol:      protocol,
+		connection:    connection,
+		interval:      interval,
+		maxMissed:     protocol.maxMissedHeartbeats,
+		nextRequestId: nextRequestId,
+		outstanding:   make(map[uint32]bool),
+		stopChan:      make(chan struct{}),
+	}
+}
+
+func (t *boltHeartbeatTrigger) Start() {
+	t.connection.AddConnectionEventListener(t)
+	t.OnActive()
+
+	go func() {
+		timer := time.NewTimer(t.interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				// the connection is read or written since the timer is set, wait for the rest of the interval
+				if idle := time.Since(time.Unix(0, atomic.LoadInt64(&t.lastActive))); idle < t.interval {
+					timer.Reset(t.interval - idle)
+					continue
+				}
+
+				t.onInterval()
+				timer.Reset(t.interval)
+			case <-t.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (t *boltHeartbeatTrigger) Stop() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if !t.stopped {
+		t.stopped = true
+		close(t.stopChan)
+	}
+}
+
+func (t *boltHeartbeatTrigger) Trigger(requestId uint32) {
+	t.mux.Lock()
+	if t.stopped {
+		t.mux.Unlock()
+		return
+	}
+	t.outstanding[requestId] = true
+	t.mux.Unlock()
+
+	hb := NewBoltHeartbeat(requestId)
+	var cmd interface{} = hb
+
+	if t.protocol.protocolCode == sofarpc.PROTOCOL_CODE_V2 {
+		hb.Protocol = sofarpc.PROTOCOL_CODE_V2
+		cmd = &sofarpc.BoltV2RequestCommand{
+			BoltRequestCommand: *hb,
+			Version1:           sofarpc.PROTOCOL_VERSION_1,
+		}
+	}
+
+	err, buf := t.protocol.encoder.EncodeHeaders(t.context, cmd)
+	if err != nil {
+		log.ByContext(t.context).Errorf("encode heartbeat failed, request id = %d, err = %v", requestId, err)
+		return
+	}
+
+	if err := t.connection.Write(buf); err != nil {
+		log.ByContext(t.context).Errorf("write heartbeat failed, request id = %d, err = %v", requestId, err)
+	}
+}
+
+func (t *boltHeartbeatTrigger) OnHeartbeatAck(requestId uint32) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.outstanding[requestId] {
+		delete(t.outstanding, requestId)
+		t.missed = 0
+	}
+}
+
+func (t *boltHeartbeatTrigger) OnActive() {
+	atomic.StoreInt64(&t.lastActive, time.Now().UnixNano())
+}
+
+// types.ConnectionEventListener
+func (t *boltHeartbeatTrigger) OnEvent(event types.ConnectionEvent) {
+	if event.IsClose() {
+		t.Stop()
+	}
+}
+
+func (t *boltHeartbeatTrigger) onInterval() {
+	t.mux.Lock()
+	if t.stopped {
+		t.mux.Unlock()
+		return
+	}
+
+	// heartbeats sent in last interval are still not acked
+	if len(t.outstanding) > 0 {
+		t.missed++
+		t.outstanding = make(map[uint32]bool)
+	}
+	dead := t.missed >= t.maxMissed
+	t.mux.Unlock()
+
+	if dead {
+		log.ByContext(t.context).Errorf("%d heartbeats not acked, close connection to %s", t.maxMissed, t.connection.RemoteAddr())
+		t.Stop()
+		t.connection.Close(types.NoFlush, types.LocalClose)
+
+		return
+	}
+
+	t.Trigger(t.nextRequestId())
+}
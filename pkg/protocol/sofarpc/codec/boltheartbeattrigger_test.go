@@ -0,0 +1,194 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/handler"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// mockConnection records heartbeats written, and acks them if autoAck is set
+type mockConnection struct {
+	types.Connection
+
+	mux        sync.Mutex
+	trigger    sofarpc.HeartbeatTrigger
+	autoAck    bool
+	heartbeats int
+	closed     bool
+	requestIds []uint32
+	nextId     uint32
+}
+
+func (c *mockConnection) nextRequestId() uint32 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.nextId++
+
+	return c.nextId
+}
+
+func (c *mockConnection) Write(buf ...types.IoBuffer) error {
+	// request id of bolt v1 request is at [5:9]
+	requestId := binary.BigEndian.Uint32(buf[0].Bytes()[5:9])
+
+	c.mux.Lock()
+	c.heartbeats++
+	c.requestIds = append(c.requestIds, requestId)
+	autoAck := c.autoAck
+	c.mux.Unlock()
+
+	if autoAck {
+		c.trigger.OnHeartbeatAck(requestId)
+	}
+
+	return nil
+}
+
+func (c *mockConnection) Close(ccType types.ConnectionCloseType, eventType types.ConnectionEvent) error {
+	c.mux.Lock()
+	c.closed = true
+	c.mux.Unlock()
+
+	c.trigger.(types.ConnectionEventListener).OnEvent(eventType)
+
+	return nil
+}
+
+func (c *mockConnection) AddConnectionEventListener(cb types.ConnectionEventListener) {}
+
+func (c *mockConnection) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12200}
+}
+
+func (c *mockConnection) status() (int, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.heartbeats, c.closed
+}
+
+func newTestTrigger(autoAck bool) *mockConnection {
+	protocol := NewBoltProtocol(sofarpc.PROTOCOL_CODE_V1, sofarpc.REQUEST_HEADER_LEN_V1, sofarpc.RESPONSE_HEADER_LEN_V1,
+		&boltV1Codec{}, &boltV1Codec{}, handler.NewBoltCommandHandler(), 10*time.Millisecond, 2)
+
+	conn := &mockConnection{autoAck: autoAck}
+	conn.trigger = protocol.CreateHeartbeatTrigger(nil, conn, conn.nextRequestId)
+
+	return conn
+}
+
+func Test_HeartbeatTriggerDisabled(t *testing.T) {
+	conn := &mockConnection{}
+	if trigger := BoltV1.CreateHeartbeatTrigger(nil, conn, conn.nextRequestId); trigger != nil {
+		t.Errorf("heartbeat trigger should be disabled by default")
+	}
+}
+
+func Test_HeartbeatTriggerClusterInterval(t *testing.T) {
+	conn := &mockConnection{autoAck: true}
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltHeartbeatInterval, 10*time.Millisecond)
+
+	conn.trigger = BoltV1.CreateHeartbeatTrigger(ctx, conn, conn.nextRequestId)
+	if conn.trigger == nil {
+		t.Fatalf("heartbeat trigger should be enabled by the interval of cluster")
+	}
+	conn.trigger.Start()
+	defer conn.trigger.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	heartbeats, closed := conn.status()
+	if heartbeats < 3 || closed {
+		t.Errorf("expect heartbeats sent on interval and connection alive, heartbeats = %d, closed = %v", heartbeats, closed)
+	}
+
+	// request ids are taken from the connection in order
+	conn.mux.Lock()
+	defer conn.mux.Unlock()
+	for i, requestId := range conn.requestIds {
+		if requestId != uint32(i+1) {
+			t.Errorf("expect request id %d of heartbeat %d, got %d", i+1, i, requestId)
+		}
+	}
+}
+
+func Test_HeartbeatTriggerInterval(t *testing.T) {
+	conn := newTestTrigger(true)
+	conn.trigger.Start()
+	defer conn.trigger.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if heartbeats, closed := conn.status(); heartbeats < 3 || closed {
+		t.Errorf("expect heartbeats sent on interval and connection alive, heartbeats = %d, closed = %v", heartbeats, closed)
+	}
+}
+
+func Test_HeartbeatTriggerDeadPeer(t *testing.T) {
+	conn := newTestTrigger(false)
+	conn.trigger.Start()
+
+	time.Sleep(100 * time.Millisecond)
+
+	heartbeats, closed := conn.status()
+	if !closed {
+		t.Fatalf("connection should be closed after heartbeats missed")
+	}
+	if heartbeats != 2 {
+		t.Errorf("expect 2 heartbeats sent before closed, got %d", heartbeats)
+	}
+
+	// trigger is stopped after connection closed
+	time.Sleep(30 * time.Millisecond)
+	if after, _ := conn.status(); after != heartbeats {
+		t.Errorf("heartbeat should stop after connection closed, got %d more", after-heartbeats)
+	}
+}
+
+func Test_HeartbeatTriggerBusyConnection(t *testing.T) {
+	conn := &mockConnection{}
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltHeartbeatInterval, 50*time.Millisecond)
+	conn.trigger = BoltV1.CreateHeartbeatTrigger(ctx, conn, conn.nextRequestId)
+	conn.trigger.Start()
+	defer conn.trigger.Stop()
+
+	// reads and writes more often than the interval postpone the heartbeats
+	for i := 0; i < 40; i++ {
+		conn.trigger.OnActive()
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if heartbeats, closed := conn.status(); heartbeats != 0 || closed {
+		t.Fatalf("expect no heartbeat sent on busy connection, heartbeats = %d, closed = %v", heartbeats, closed)
+	}
+
+	// heartbeats are sent once the connection is idle
+	time.Sleep(80 * time.Millisecond)
+	if heartbeats, _ := conn.status(); heartbeats == 0 {
+		t.Errorf("expect heartbeat sent after the connection is idle for the interval")
+	}
+}
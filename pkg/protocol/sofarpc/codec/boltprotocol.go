@@ -17,14 +17,21 @@
 package codec
 
 import (
+	"context"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
 	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/handler"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
 func init() {
-	sofarpc.RegisterProtocol(sofarpc.PROTOCOL_CODE_V1, BoltV1)
-	sofarpc.RegisterProtocol(sofarpc.PROTOCOL_CODE_V2, BoltV2)
+	sofarpc.MustRegisterProtocol(sofarpc.PROTOCOL_CODE_V1, BoltV1)
+	sofarpc.MustRegisterProtocol(sofarpc.PROTOCOL_CODE_V2, BoltV2)
+
+	serialize.RegisterSerialization(sofarpc.HESSIAN_SERIALIZE, &serialize.Instance)
+	serialize.RegisterSerialization(sofarpc.PROTOBUF_SERIALIZE, &serialize.ProtobufInstance)
 }
 
 /**
@@ -62,14 +69,16 @@ func init() {
  * +-----------------------------------------------------------------------------------------------+
  * respstatus: response status
  */
-var BoltV1 = &BoltProtocol{
+var BoltV1 = NewBoltProtocol(
 	sofarpc.PROTOCOL_CODE_V1,
 	sofarpc.REQUEST_HEADER_LEN_V1,
 	sofarpc.RESPONSE_HEADER_LEN_V1,
 	&boltV1Codec{},
 	&boltV1Codec{},
 	handler.NewBoltCommandHandler(),
-}
+	0,
+	DefaultMaxMissedHeartbeats,
+)
 
 /**
  * Request command protocol for v2
@@ -109,24 +118,46 @@ var BoltV1 = &BoltProtocol{
  * +------------------------------------------------------------------------------------------------+
  * respstatus: response status
  */
-var BoltV2 = &BoltProtocol{
+var BoltV2 = NewBoltProtocol(
 	sofarpc.PROTOCOL_CODE_V2,
 	sofarpc.REQUEST_HEADER_LEN_V2,
 	sofarpc.RESPONSE_HEADER_LEN_V2,
 	&boltV2Codec{},
 	&boltV2Codec{},
 	handler.NewBoltCommandHandlerV2(),
-}
+	0,
+	DefaultMaxMissedHeartbeats,
+)
+
+// max heartbeats not acked before the peer is considered dead
+const DefaultMaxMissedHeartbeats = 3
 
 type BoltProtocol struct {
 	protocolCode      byte
 	requestHeaderLen  int
 	responseHeaderLen int
 
-	encoder types.Encoder
-	decoder types.Decoder
-	//heartbeatTrigger			protocol.HeartbeatTrigger todo
+	encoder        types.Encoder
+	decoder        types.Decoder
 	commandHandler sofarpc.CommandHandler
+
+	// heartbeat is disabled if heartbeatInterval is 0, unless the interval is set by the cluster
+	heartbeatInterval   time.Duration
+	maxMissedHeartbeats int
+}
+
+func NewBoltProtocol(protocolCode byte, requestHeaderLen int, responseHeaderLen int, encoder types.Encoder,
+	decoder types.Decoder, commandHandler sofarpc.CommandHandler, heartbeatInterval time.Duration, maxMissedHeartbeats int) *BoltProtocol {
+	return &BoltProtocol{
+		protocolCode:        protocolCode,
+		requestHeaderLen:    requestHeaderLen,
+		responseHeaderLen:   responseHeaderLen,
+		encoder:             encoder,
+		decoder:             decoder,
+		commandHandler:      commandHandler,
+		heartbeatInterval:   heartbeatInterval,
+		maxMissedHeartbeats: maxMissedHeartbeats,
+	}
 }
 
 func (b *BoltProtocol) GetRequestHeaderLength() int {
@@ -149,6 +180,23 @@ func (b *BoltProtocol) GetCommandHandler() sofarpc.CommandHandler {
 	return b.commandHandler
 }
 
+// sofarpc.HeartbeatTriggerFactory
+// the interval set by the connection pool of the cluster takes precedence over the one of protocol
+func (b *BoltProtocol) CreateHeartbeatTrigger(context context.Context, connection types.Connection, nextRequestId func() uint32) sofarpc.HeartbeatTrigger {
+	interval := b.heartbeatInterval
+	if context != nil {
+		if clusterInterval, ok := context.Value(types.ContextKeyBoltHeartbeatInterval).(time.Duration); ok {
+			interval = clusterInterval
+		}
+	}
+
+	if interval <= 0 {
+		return nil
+	}
+
+	return newBoltHeartbeatTrigger(context, b, connection, interval, nextRequestId)
+}
+
 func NewBoltHeartbeat(requestId uint32) *sofarpc.BoltRequestCommand {
 	return &sofarpc.BoltRequestCommand{
 		Protocol: sofarpc.PROTOCOL_CODE_V1,
@@ -156,19 +204,20 @@ func NewBoltHeartbeat(requestId uint32) *sofarpc.BoltRequestCommand {
 		CmdCode:  sofarpc.HEARTBEAT,
 		Version:  1,
 		ReqId:    requestId,
-		CodecPro: sofarpc.HESSIAN_SERIALIZE, //todo: read default codec from config
+		CodecPro: sofarpc.DefaultHeartbeatCodec(),
 		Timeout:  -1,
 	}
 }
 
-func NewBoltHeartbeatAck(requestId uint32) *sofarpc.BoltResponseCommand {
+// heartbeat ack should use the same codec as the heartbeat it replies to
+func NewBoltHeartbeatAck(requestId uint32, codec byte) *sofarpc.BoltResponseCommand {
 	return &sofarpc.BoltResponseCommand{
 		Protocol:       sofarpc.PROTOCOL_CODE_V1,
 		CmdType:        sofarpc.RESPONSE,
 		CmdCode:        sofarpc.HEARTBEAT,
 		Version:        1,
 		ReqId:          requestId,
-		CodecPro:       sofarpc.HESSIAN_SERIALIZE, //todo: read default codec from config
+		CodecPro:       codec,
 		ResponseStatus: sofarpc.RESPONSE_STATUS_SUCCESS,
 	}
 }
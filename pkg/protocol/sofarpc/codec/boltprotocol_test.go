@@ -0,0 +1,42 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+)
+
+func Test_BoltHeartbeatCodec(t *testing.T) {
+	if hb := NewBoltHeartbeat(1); hb.CodecPro != sofarpc.HESSIAN_SERIALIZE {
+		t.Errorf("default heartbeat codec should be hessian, got %d", hb.CodecPro)
+	}
+
+	sofarpc.SetDefaultHeartbeatCodec(sofarpc.HESSIAN2_SERIALIZE)
+	defer sofarpc.SetDefaultHeartbeatCodec(sofarpc.HESSIAN_SERIALIZE)
+
+	hb := NewBoltHeartbeat(2)
+	if hb.CodecPro != sofarpc.HESSIAN2_SERIALIZE {
+		t.Errorf("heartbeat codec should be %d, got %d", sofarpc.HESSIAN2_SERIALIZE, hb.CodecPro)
+	}
+
+	ack := NewBoltHeartbeatAck(hb.ReqId, hb.CodecPro)
+	if ack.CodecPro != hb.CodecPro || ack.ReqId != hb.ReqId {
+		t.Errorf("heartbeat ack %+v should mirror heartbeat %+v", ack, hb)
+	}
+}
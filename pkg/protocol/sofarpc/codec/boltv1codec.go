@@ -22,17 +22,16 @@ import (
 	"reflect"
 	"time"
 
-	"errors"
 	"github.com/alipay/sofamosn/pkg/log"
-	"github.com/alipay/sofamosn/pkg/network/buffer"
 	"github.com/alipay/sofamosn/pkg/protocol/serialize"
 	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
+var boltV1Name = sofarpc.CodecName(sofarpc.PROTOCOL_CODE_V1)
+
 var (
 	BoltV1PropertyHeaders = make(map[string]reflect.Kind, 11)
-	defaultTmpBufferSize  = 1 << 6
 )
 
 func init() {
@@ -72,7 +71,7 @@ func (c *boltV1Codec) encodeHeaders(context context.Context, headers interface{}
 	default:
 
 		errMsg := sofarpc.InvalidCommandType
-		err := errors.New(errMsg)
+		err := sofarpc.NewEncodeError(boltV1Name, sofarpc.ReasonInvalidCommand, errMsg)
 		log.ByContext(context).Errorf("boltV1" + errMsg)
 		return err, nil
 	}
@@ -87,19 +86,41 @@ func (c *boltV1Codec) EncodeTrailers(context context.Context, trailers map[strin
 }
 
 func (c *boltV1Codec) encodeRequestCommand(context context.Context, cmd *sofarpc.BoltRequestCommand) (error, types.IoBuffer) {
-	result := c.doEncodeRequestCommand(context, cmd)
-	return nil, buffer.NewIoBufferBytes(result)
+	if err := checkEncodeCodec(context, boltV1Name, cmd.CodecPro); err != nil {
+		return err, nil
+	}
+
+	buf := takeHeadersBuffer(sofarpc.REQUEST_HEADER_LEN_V1 + len(cmd.ClassName) + len(cmd.HeaderMap))
+	// encoded in the storage of the empty buffer, which is large enough, so the write copies nothing
+	buf.Write(c.doEncodeRequestCommand(context, cmd, buf.Bytes()))
+	return nil, buf
 }
 
 func (c *boltV1Codec) encodeResponseCommand(context context.Context, cmd *sofarpc.BoltResponseCommand) (error, types.IoBuffer) {
-	result := c.doEncodeResponseCommand(context, cmd)
-	return nil, buffer.NewIoBufferBytes(result)
+	if err := checkEncodeCodec(context, boltV1Name, cmd.CodecPro); err != nil {
+		return err, nil
+	}
+
+	buf := takeHeadersBuffer(sofarpc.RESPONSE_HEADER_LEN_V1 + len(cmd.ClassName) + len(cmd.HeaderMap))
+	buf.Write(c.doEncodeResponseCommand(context, cmd, buf.Bytes()))
+	return nil, buf
 }
 
-func (c *boltV1Codec) doEncodeRequestCommand(context context.Context, cmd *sofarpc.BoltRequestCommand) []byte {
+// checkEncodeCodec returns encode error if the codec of the frame is unknown, as the frame
+// would be rejected by the peer
+func checkEncodeCodec(context context.Context, codecName string, codec byte) error {
+	if !sofarpc.IsKnownCodec(codec) {
+		log.ByContext(context).Errorf("%s encode: unknown codec %d", codecName, codec)
+		return sofarpc.NewEncodeError(codecName, sofarpc.ReasonUnknownCodec, sofarpc.UnKnownCodec)
+	}
+
+	return nil
+}
+
+// doEncodeRequestCommand appends the encoded request to data, the storage of a pooled buffer
+func (c *boltV1Codec) doEncodeRequestCommand(context context.Context, cmd *sofarpc.BoltRequestCommand, data []byte) []byte {
 	offset := 0
-	// todo: reuse bytes @boqin
-	data := make([]byte, 22, defaultTmpBufferSize)
+	data = data[:sofarpc.REQUEST_HEADER_LEN_V1]
 
 	data[offset] = cmd.Protocol
 	offset++
@@ -142,10 +163,10 @@ func (c *boltV1Codec) doEncodeRequestCommand(context context.Context, cmd *sofar
 	return data
 }
 
-func (c *boltV1Codec) doEncodeResponseCommand(context context.Context, cmd *sofarpc.BoltResponseCommand) []byte {
+// doEncodeResponseCommand appends the encoded response to data, the storage of a pooled buffer
+func (c *boltV1Codec) doEncodeResponseCommand(context context.Context, cmd *sofarpc.BoltResponseCommand, data []byte) []byte {
 	offset := 0
-	// todo: reuse bytes @boqin
-	data := make([]byte, 20, defaultTmpBufferSize)
+	data = data[:sofarpc.RESPONSE_HEADER_LEN_V1]
 
 	data[offset] = cmd.Protocol
 	offset++
@@ -209,14 +230,15 @@ func (c *boltV1Codec) mapToCmd(headers map[string]string) interface{} {
 
 	//class
 	className := sofarpc.GetPropertyValue(BoltV1PropertyHeaders, headers, "classname")
-	class, _ := serialize.Instance.Serialize(className)
+	serializeIns := serialize.GetSerialization(codec.(byte))
+	class, _ := serializeIns.Serialize(className)
 
 	//RPC Request
 	if cmdCode == sofarpc.RPC_REQUEST {
 		timeout := sofarpc.GetPropertyValue(BoltV1PropertyHeaders, headers, sofarpc.HeaderTimeout)
 
 		//serialize header
-		header, _ := serialize.Instance.Serialize(headers)
+		header := sofarpc.SerializeHeaderMap(serializeIns, headers)
 
 		request := sofarpc.BoltRequestCommand{
 			protocolCode.(byte),
@@ -245,7 +267,7 @@ func (c *boltV1Codec) mapToCmd(headers map[string]string) interface{} {
 		responseTime := sofarpc.GetPropertyValue(BoltV1PropertyHeaders, headers, sofarpc.HeaderRespTimeMills)
 
 		//serialize header
-		header, _ := serialize.Instance.Serialize(headers)
+		header := sofarpc.SerializeHeaderMap(serializeIns, headers)
 		response := sofarpc.BoltResponseCommand{
 			protocolCode.(byte),
 			cmdType.(byte),
@@ -301,19 +323,21 @@ func (c *boltV1Codec) Decode(context context.Context, data types.IoBuffer) (int,
 				read = sofarpc.REQUEST_HEADER_LEN_V1
 				var class, header, content []byte
 
+				if !sofarpc.IsKnownCodec(codec) {
+					logger.Errorf("BoltV1 DECODE Request: unknown codec, requestId = %d, codec = %d", requestId, codec)
+					return read, sofarpc.NewDecodeError(boltV1Name, sofarpc.ReasonUnknownCodec, sofarpc.UnKnownCodec)
+				}
+
+				// reject before buffering the body of an oversized frame
+				if err := checkFrameLimits(classLen, headerLen, contentLen); err != nil {
+					logger.Errorf("BoltV1 DECODE Request: frame too large, requestId = %d, classLen = %d, headerLen = %d, contentLen = %d",
+						requestId, classLen, headerLen, contentLen)
+					return read, sofarpc.NewDecodeError(boltV1Name, sofarpc.ReasonOversized, err.Error())
+				}
+
 				if readableBytes >= read+int(classLen)+int(headerLen)+int(contentLen) {
-					if classLen > 0 {
-						class = bytes[read : read+int(classLen)]
-						read += int(classLen)
-					}
-					if headerLen > 0 {
-						header = bytes[read : read+int(headerLen)]
-						read += int(headerLen)
-					}
-					if contentLen > 0 {
-						content = bytes[read : read+int(contentLen)]
-						read += int(contentLen)
-					}
+					class, header, content = copyFrameFields(bytes, read, classLen, headerLen, contentLen)
+					read += int(classLen) + int(headerLen) + int(contentLen)
 
 					data.Drain(read)
 
@@ -331,7 +355,7 @@ func (c *boltV1Codec) Decode(context context.Context, data types.IoBuffer) (int,
 					ver2,
 					requestId,
 					codec,
-					int(timeout),
+					int(int32(timeout)), // timeout is signed, -1 means no timeout
 					int16(classLen),
 					int16(headerLen),
 					int(contentLen),
@@ -344,6 +368,10 @@ func (c *boltV1Codec) Decode(context context.Context, data types.IoBuffer) (int,
 				logger.Debugf("BoltV1 DECODE REQUEST, Protocol = %d, CmdType = %d, CmdCode = %d, ReqID = %d",
 					request.Protocol, request.CmdType, request.CmdCode, request.ReqId)
 				cmd = &request
+			} else {
+				// not enough data for the request header
+				logger.Debugf("BoltV1 DECODE Request, no enough data for header")
+				return sofarpc.REQUEST_HEADER_LEN_V1, nil
 			}
 		} else {
 			//2. response
@@ -361,19 +389,37 @@ func (c *boltV1Codec) Decode(context context.Context, data types.IoBuffer) (int,
 				read = sofarpc.RESPONSE_HEADER_LEN_V1
 				var class, header, content []byte
 
+				if !sofarpc.IsKnownCodec(codec) {
+					logger.Errorf("BoltV1 DECODE RESPONSE: unknown codec, requestId = %d, codec = %d", requestId, codec)
+					return read, sofarpc.NewDecodeError(boltV1Name, sofarpc.ReasonUnknownCodec, sofarpc.UnKnownCodec)
+				}
+
+				// bolt v1 frames carry no crc32, which is required by the cluster forcing crc
+				if sofarpc.ForceCrc(context) {
+					logger.Errorf("BoltV1 DECODE RESPONSE: no crc32 on connection forcing crc, requestId = %d", requestId)
+					return read, sofarpc.NewDecodeError(boltV1Name, sofarpc.ReasonBadCrc, sofarpc.InvalidCrc32)
+				}
+
+				// reject before buffering the body of an oversized frame
+				if err := checkFrameLimits(classLen, headerLen, contentLen); err != nil {
+					logger.Errorf("BoltV1 DECODE RESPONSE: frame too large, requestId = %d, classLen = %d, headerLen = %d, contentLen = %d",
+						requestId, classLen, headerLen, contentLen)
+					return read, sofarpc.NewDecodeError(boltV1Name, sofarpc.ReasonOversized, err.Error())
+				}
+
+				// the response exceeding the limits of cluster is skipped rather than buffered
+				if err := sofarpc.CheckResponseLimits(context, boltV1Name, requestId, headerLen, contentLen,
+					int(classLen)+int(headerLen)+int(contentLen)); err != nil {
+					logger.Errorf("BoltV1 DECODE RESPONSE: response exceeds the limits of cluster, requestId = %d, headerLen = %d, contentLen = %d",
+						requestId, headerLen, contentLen)
+					data.Drain(read)
+
+					return read, err
+				}
+
 				if readableBytes >= read+int(classLen)+int(headerLen)+int(contentLen) {
-					if classLen > 0 {
-						class = bytes[read : read+int(classLen)]
-						read += int(classLen)
-					}
-					if headerLen > 0 {
-						header = bytes[read : read+int(headerLen)]
-						read += int(headerLen)
-					}
-					if contentLen > 0 {
-						content = bytes[read : read+int(contentLen)]
-						read += int(contentLen)
-					}
+					class, header, content = copyFrameFields(bytes, read, classLen, headerLen, contentLen)
+					read += int(classLen) + int(headerLen) + int(contentLen)
 
 					data.Drain(read)
 				} else {
@@ -410,6 +456,10 @@ func (c *boltV1Codec) Decode(context context.Context, data types.IoBuffer) (int,
 				cmd = &response
 			}
 		}
+	} else {
+		// not enough data to tell request from response, wait for the smaller header
+		logger.Debugf("BoltV1 DECODE: no enough data for header")
+		return sofarpc.LESS_LEN_V1, nil
 	}
 
 	return read, cmd
@@ -0,0 +1,379 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const testClassName = "com.alipay.sofa.rpc.core.request.SofaRequest"
+
+// mockDecodeFilter records decoded headers
+type mockDecodeFilter struct {
+	headers map[string]string
+	decoded int
+	err     error
+}
+
+func (f *mockDecodeFilter) OnDecodeHeader(streamId string, headers map[string]string) types.FilterStatus {
+	f.headers = headers
+	f.decoded++
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeData(streamId string, data types.IoBuffer) types.FilterStatus {
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeTrailer(streamId string, trailers map[string]string) types.FilterStatus {
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeError(err error, headers map[string]string) {
+	f.err = err
+}
+
+func newBoltV1RequestHeaders(codec byte) map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode):      strconv.Itoa(int(sofarpc.RPC_REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderVersion):      "1",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        "1",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec):        strconv.Itoa(int(codec)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderTimeout):      "3000",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassLen):     strconv.Itoa(len(testClassName)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderHeaderLen):    "0",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen):   "0",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName):    testClassName,
+		"service": "com.alipay.test.TestService:1.0",
+	}
+}
+
+func Test_BoltV1SerializationRoundTrip(t *testing.T) {
+	for _, codec := range []byte{sofarpc.HESSIAN_SERIALIZE, sofarpc.PROTOBUF_SERIALIZE} {
+		err, buf := BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1RequestHeaders(codec))
+		if err != nil {
+			t.Fatalf("codec %d: encode failed: %v", codec, err)
+		}
+
+		_, cmd := BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(buf.Bytes()))
+		if cmd == nil {
+			t.Fatalf("codec %d: decode failed", codec)
+		}
+
+		filter := &mockDecodeFilter{}
+		if err := BoltV1.GetCommandHandler().HandleCommand(nil, cmd, filter); err != nil {
+			t.Fatalf("codec %d: handle command failed: %v", codec, err)
+		}
+
+		if filter.headers["service"] != "com.alipay.test.TestService:1.0" {
+			t.Errorf("codec %d: unexpected service header: %s", codec, filter.headers["service"])
+		}
+		if filter.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)] != testClassName {
+			t.Errorf("codec %d: unexpected class name: %s", codec, filter.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)])
+		}
+	}
+}
+
+// header entries unknown to mosn, or colliding with property headers, are passed through unchanged
+func Test_BoltV1UnknownHeadersRoundTrip(t *testing.T) {
+	for _, codec := range []byte{sofarpc.HESSIAN_SERIALIZE, sofarpc.PROTOBUF_SERIALIZE} {
+		serializeIns := serialize.GetSerialization(codec)
+		headerMap, _ := serializeIns.Serialize(map[string]string{
+			"service":          "com.alipay.test.TestService:1.0",
+			"new_feature":      "on",
+			"timeout":          "from-newer-peer",
+			types.HeaderStatus: "500",
+			types.HeaderMirror: "true",
+		})
+		// unknown varint field 2 of a newer protobuf schema
+		unknownField := []byte{0x10, 0x01}
+		if codec == sofarpc.PROTOBUF_SERIALIZE {
+			headerMap = append(headerMap, unknownField...)
+		}
+
+		cmd := newBoltV1Request(nil)
+		cmd.CodecPro = codec
+		cmd.HeaderLen = int16(len(headerMap))
+		cmd.HeaderMap = headerMap
+
+		err, buf := BoltV1.GetEncoder().EncodeHeaders(nil, cmd)
+		if err != nil {
+			t.Fatalf("codec %d: encode failed: %v", codec, err)
+		}
+		_, decoded := BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(buf.Bytes()))
+		filter := &mockDecodeFilter{}
+		if err := BoltV1.GetCommandHandler().HandleCommand(nil, decoded, filter); err != nil {
+			t.Fatalf("codec %d: handle command failed: %v", codec, err)
+		}
+
+		if filter.headers["new_feature"] != "on" {
+			t.Errorf("codec %d: unknown header expect decoded, got %s", codec, filter.headers["new_feature"])
+		}
+		if filter.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderTimeout)] != "3000" {
+			t.Errorf("codec %d: timeout expect from frame, got %s", codec, filter.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderTimeout)])
+		}
+		if _, ok := filter.headers[types.HeaderStatus]; ok {
+			t.Errorf("codec %d: proxy header expect not decoded", codec)
+		}
+		if filter.headers[types.HeaderMirror] != "true" {
+			t.Errorf("codec %d: mirror tag expect decoded, got %s", codec, filter.headers[types.HeaderMirror])
+		}
+
+		// a filter modifies the known header, end stream mark of the request without content is not relevant
+		delete(filter.headers, types.HeaderStremEnd)
+		filter.headers["service"] = "com.alipay.test.TestService:2.0"
+		err, buf = BoltV1.GetEncoder().EncodeHeaders(nil, filter.headers)
+		if err != nil {
+			t.Fatalf("codec %d: re-encode failed: %v", codec, err)
+		}
+		_, decoded = BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(buf.Bytes()))
+		reencoded := decoded.(*sofarpc.BoltRequestCommand).HeaderMap
+
+		result := make(map[string]string)
+		if _, err := serializeIns.DeSerialize(reencoded, &result); err != nil {
+			t.Fatalf("codec %d: deserialize re-encoded header map failed: %v", codec, err)
+		}
+		expected := map[string]string{
+			"service":          "com.alipay.test.TestService:2.0",
+			"new_feature":      "on",
+			"timeout":          "from-newer-peer",
+			types.HeaderStatus: "500",
+			types.HeaderMirror: "true",
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("codec %d: expect header map %v, got %v", codec, expected, result)
+		}
+		if codec == sofarpc.PROTOBUF_SERIALIZE && !bytes.HasSuffix(reencoded, unknownField) {
+			t.Errorf("codec %d: unknown field expect kept", codec)
+		}
+	}
+}
+
+func newBoltV1Request(content []byte) *sofarpc.BoltRequestCommand {
+	return &sofarpc.BoltRequestCommand{
+		Protocol:   sofarpc.PROTOCOL_CODE_V1,
+		CmdType:    sofarpc.REQUEST,
+		CmdCode:    sofarpc.RPC_REQUEST,
+		Version:    1,
+		ReqId:      1,
+		CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+		Timeout:    3000,
+		ClassLen:   int16(len(testClassName)),
+		ClassName:  []byte(testClassName),
+		ContentLen: len(content),
+	}
+}
+
+// decodeByteByByte feeds the frame to the decoder one byte at a time,
+// nothing should be consumed until the last byte arrives
+func decodeByteByByte(t *testing.T, decoder types.Decoder, frame []byte) interface{} {
+	data := buffer.NewIoBuffer(len(frame))
+
+	for i, b := range frame {
+		data.Write([]byte{b})
+		read, cmd := decoder.Decode(nil, data)
+
+		if i < len(frame)-1 {
+			if cmd != nil || read == 0 || data.Len() != i+1 {
+				t.Fatalf("decode %d of %d bytes: expect waiting for more data, got read %d, cmd %+v, remain %d",
+					i+1, len(frame), read, cmd, data.Len())
+			}
+			continue
+		}
+
+		if read != len(frame) || data.Len() != 0 {
+			t.Fatalf("expect read %d bytes, got %d, remain %d", len(frame), read, data.Len())
+		}
+
+		return cmd
+	}
+
+	return nil
+}
+
+func Test_BoltV1DecodeFragmented(t *testing.T) {
+	content := []byte("hello bolt v1")
+	_, buf := BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1Request(content))
+	frame := append(buf.Bytes(), content...)
+
+	req, ok := decodeByteByByte(t, BoltV1.GetDecoder(), frame).(*sofarpc.BoltRequestCommand)
+	if !ok {
+		t.Fatalf("expect bolt v1 request")
+	}
+	if string(req.ClassName) != testClassName || !bytes.Equal(req.Content, content) {
+		t.Errorf("unexpected decoded request: %+v", req)
+	}
+
+	_, buf = BoltV1.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltResponseCommand{
+		Protocol:   sofarpc.PROTOCOL_CODE_V1,
+		CmdType:    sofarpc.RESPONSE,
+		CmdCode:    sofarpc.RPC_RESPONSE,
+		Version:    1,
+		ReqId:      1,
+		CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+		ContentLen: len(content),
+	})
+	frame = append(buf.Bytes(), content...)
+
+	resp, ok := decodeByteByByte(t, BoltV1.GetDecoder(), frame).(*sofarpc.BoltResponseCommand)
+	if !ok {
+		t.Fatalf("expect bolt v1 response")
+	}
+	if !bytes.Equal(resp.Content, content) {
+		t.Errorf("unexpected decoded response: %+v", resp)
+	}
+}
+
+func Test_BoltV1DispatchFragmented(t *testing.T) {
+	content := []byte("hello bolt v1")
+	_, buf := BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1Request(content))
+	frame := append(buf.Bytes(), content...)
+	// two frames in a row, the second one starts in the same read as the first ends
+	frames := append(append([]byte{}, frame...), frame...)
+
+	filter := &mockDecodeFilter{}
+	data := buffer.NewIoBuffer(len(frames))
+	for _, b := range frames {
+		data.Write([]byte{b})
+		sofarpc.DefaultProtocols().Decode(nil, data, filter)
+
+		if filter.err != nil {
+			t.Fatalf("unexpected decode error: %v", filter.err)
+		}
+	}
+
+	if filter.decoded != 2 || data.Len() != 0 {
+		t.Errorf("expect 2 requests decoded, got %d, remain %d", filter.decoded, data.Len())
+	}
+	if filter.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)] != testClassName {
+		t.Errorf("unexpected class name: %s", filter.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)])
+	}
+}
+
+func Test_BoltV1FrameTooLarge(t *testing.T) {
+	SetFrameLimits(v2.BoltFrameLimits{MaxClassLen: len(testClassName), MaxHeaderLen: 16, MaxContentLen: 1024})
+	defer SetFrameLimits(v2.BoltFrameLimits{})
+
+	for _, contentLen := range []int{1024, 1025} {
+		//only the fixed header is received, the body never comes
+		_, buf := BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1Request(make([]byte, contentLen)))
+		header := buf.Bytes()[:sofarpc.REQUEST_HEADER_LEN_V1]
+
+		_, cmd := BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(header))
+		err, ok := cmd.(error)
+		if tooLarge := contentLen > 1024; tooLarge != (ok && err.Error() == sofarpc.FrameTooLarge) {
+			t.Errorf("content length %d: unexpected decoded %+v", contentLen, cmd)
+		}
+	}
+
+	_, buf := BoltV1.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltResponseCommand{
+		Protocol:   sofarpc.PROTOCOL_CODE_V1,
+		CmdType:    sofarpc.RESPONSE,
+		CmdCode:    sofarpc.RPC_RESPONSE,
+		Version:    1,
+		ReqId:      1,
+		CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+		ContentLen: sofarpc.DefaultMaxContentLen,
+	})
+	header := buf.Bytes()[:sofarpc.RESPONSE_HEADER_LEN_V1]
+
+	_, cmd := BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(header))
+	if err, ok := cmd.(error); !ok || err.Error() != sofarpc.FrameTooLarge {
+		t.Errorf("expect frame too large error, got %+v", cmd)
+	}
+}
+
+// codecErrorSink counts codec errors by metric, codec and reason
+type codecErrorSink struct {
+	stats.MetricsSink
+	counts map[string]int64
+}
+
+func newCodecErrorSink() *codecErrorSink {
+	sink := &codecErrorSink{counts: make(map[string]int64)}
+	stats.SetSink(sink)
+
+	return sink
+}
+
+func (s *codecErrorSink) Count(name string, value int64, tags stats.Tags) {
+	s.counts[name+":"+tags[sofarpc.TagCodec]+":"+tags[sofarpc.TagReason]] += value
+}
+
+func (s *codecErrorSink) count(name, codec, reason string) int64 {
+	return s.counts[name+":"+codec+":"+reason]
+}
+
+func Test_BoltV1CodecErrorMetrics(t *testing.T) {
+	sink := newCodecErrorSink()
+	defer stats.SetSink(nil)
+
+	//unknown codec byte
+	_, buf := BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1Request(nil))
+	frame := buf.Bytes()
+	frame[9] = 0xff
+	_, cmd := BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	if err, ok := cmd.(error); !ok || err.Error() != sofarpc.UnKnownCodec {
+		t.Errorf("expect unknown codec error, got %+v", cmd)
+	}
+	if got := sink.count(sofarpc.CodecDecodeErrorsMetric, "boltv1", sofarpc.ReasonUnknownCodec); got != 1 {
+		t.Errorf("expect 1 unknown codec decode error, got %d", got)
+	}
+
+	//oversized length
+	SetFrameLimits(v2.BoltFrameLimits{MaxContentLen: 16})
+	defer SetFrameLimits(v2.BoltFrameLimits{})
+	_, buf = BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1Request(make([]byte, 17)))
+	BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(buf.Bytes()[:sofarpc.REQUEST_HEADER_LEN_V1]))
+	if got := sink.count(sofarpc.CodecDecodeErrorsMetric, "boltv1", sofarpc.ReasonOversized); got != 1 {
+		t.Errorf("expect 1 oversized decode error, got %d", got)
+	}
+
+	//encode with unknown codec byte, or a command of other protocol
+	req := newBoltV1Request(nil)
+	req.CodecPro = 0xff
+	if err, _ := BoltV1.GetEncoder().EncodeHeaders(nil, req); err == nil {
+		t.Errorf("expect encode error of unknown codec")
+	}
+	if err, _ := BoltV1.GetEncoder().EncodeHeaders(nil, &sofarpc.TrRequestCommand{}); err == nil {
+		t.Errorf("expect encode error of invalid command")
+	}
+	if got := sink.count(sofarpc.CodecEncodeErrorsMetric, "boltv1", sofarpc.ReasonUnknownCodec); got != 1 {
+		t.Errorf("expect 1 unknown codec encode error, got %d", got)
+	}
+	if got := sink.count(sofarpc.CodecEncodeErrorsMetric, "boltv1", sofarpc.ReasonInvalidCommand); got != 1 {
+		t.Errorf("expect 1 invalid command encode error, got %d", got)
+	}
+
+	//unknown protocol code
+	sofarpc.DefaultProtocols().Decode(nil, buffer.NewIoBufferBytes([]byte{0x7f, 0x01, 0x00}), &mockDecodeFilter{})
+	if got := sink.count(sofarpc.CodecDecodeErrorsMetric, "127", sofarpc.ReasonUnknownProtocol); got != 1 {
+		t.Errorf("expect 1 unknown protocol decode error, got %d", got)
+	}
+}
@@ -19,10 +19,10 @@ package codec
 import (
 	"context"
 	"encoding/binary"
+	"hash/crc32"
 	"reflect"
 	"time"
 
-	"errors"
 	"github.com/alipay/sofamosn/pkg/log"
 	"github.com/alipay/sofamosn/pkg/network/buffer"
 	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
@@ -37,6 +37,8 @@ var (
 
 var boltV1 = &boltV1Codec{}
 
+var boltV2Name = sofarpc.CodecName(sofarpc.PROTOCOL_CODE_V2)
+
 func init() {
 	BoltV2PropertyHeaders[sofarpc.HeaderProtocolCode] = reflect.Uint8
 	BoltV2PropertyHeaders[sofarpc.HeaderCmdType] = reflect.Uint8
@@ -74,7 +76,7 @@ func (c *boltV2Codec) encodeHeaders(context context.Context, headers interface{}
 		return c.encodeResponseCommand(context, headers.(*sofarpc.BoltV2ResponseCommand))
 	default:
 		errMsg := sofarpc.InvalidCommandType
-		err := errors.New(errMsg)
+		err := sofarpc.NewEncodeError(boltV2Name, sofarpc.ReasonInvalidCommand, errMsg)
 		log.ByContext(context).Errorf("boltV2" + errMsg)
 		return err, nil
 	}
@@ -89,23 +91,221 @@ func (c *boltV2Codec) EncodeTrailers(context context.Context, trailers map[strin
 }
 
 func (c *boltV2Codec) encodeRequestCommand(context context.Context, cmd *sofarpc.BoltV2RequestCommand) (error, types.IoBuffer) {
-	result := boltV1.doEncodeRequestCommand(context, &cmd.BoltRequestCommand)
-
-	c.insertToBytes(result, 1, cmd.Version1)
-	c.insertToBytes(result, 11, cmd.SwitchCode)
+	if err := checkEncodeCodec(context, boltV2Name, cmd.CodecPro); err != nil {
+		return err, nil
+	}
 
-	return nil, buffer.NewIoBufferBytes(result)
+	buf := takeHeadersBuffer(sofarpc.REQUEST_HEADER_LEN_V2 + len(cmd.ClassName) + len(cmd.HeaderMap) +
+		len(cmd.Content) + sofarpc.CRC32_LEN)
+	result := boltV1.doEncodeRequestCommand(context, &cmd.BoltRequestCommand, buf.Bytes())
+	// features enabled on the connection are turned on for the requests sent, other bits are kept
+	switchCode := cmd.SwitchCode.Set(connectionSwitch(context))
+	// the compression algorithm accepted is always advertised, the content is flagged by EncodeContent if compressed
+	switchCode = switchCode.Set(connectionCompression(context).Algorithm)
+	ver1, switchCode := forceCrc(context, cmd.Version1, switchCode)
+
+	result = c.insertToBytes(result, 1, ver1)
+	result = c.insertToBytes(result, 11, byte(switchCode))
+	result = c.appendCrc32(context, result, ver1, switchCode, cmd.Content, cmd.ContentLen)
+
+	buf.Write(result)
+	return nil, buf
 }
 
 func (c *boltV2Codec) encodeResponseCommand(context context.Context, cmd *sofarpc.BoltV2ResponseCommand) (error, types.IoBuffer) {
-	result := boltV1.doEncodeResponseCommand(context, &cmd.BoltResponseCommand)
+	if err := checkEncodeCodec(context, boltV2Name, cmd.CodecPro); err != nil {
+		return err, nil
+	}
+
+	buf := takeHeadersBuffer(sofarpc.RESPONSE_HEADER_LEN_V2 + len(cmd.ClassName) + len(cmd.HeaderMap) +
+		len(cmd.Content) + sofarpc.CRC32_LEN)
+	result := boltV1.doEncodeResponseCommand(context, &cmd.BoltResponseCommand, buf.Bytes())
+	ver1, switchCode := forceCrc(context, cmd.Version1, cmd.SwitchCode)
 
-	c.insertToBytes(result, 1, cmd.Version1)
-	c.insertToBytes(result, 11, cmd.SwitchCode)
+	result = c.insertToBytes(result, 1, ver1)
+	result = c.insertToBytes(result, 11, byte(switchCode))
+	result = c.appendCrc32(context, result, ver1, switchCode, cmd.Content, cmd.ContentLen)
 
 	log.ByContext(context).Debugf("rpc headers encode finished,bytes=%d", result)
 
-	return nil, buffer.NewIoBufferBytes(result)
+	buf.Write(result)
+	return nil, buf
+}
+
+// appendCrc32 appends content and the CRC32 of the whole frame when crc is required by ver1 and switch code
+// Note: crc32 covers the content, so the content is written together with headers in this case.
+// If the content is not in the command, e.g. encoded from a header map, it is written by stream
+// and the crc32 is appended by EncodeFrameTrailer.
+func (c *boltV2Codec) appendCrc32(context context.Context, frame []byte, ver1 byte, switchCode sofarpc.SwitchCode,
+	content []byte, contentLen int) []byte {
+	if !c.crcEnabled(ver1, switchCode) || len(content) != contentLen {
+		return frame
+	}
+
+	if len(content) > 0 {
+		frame = append(frame, content...)
+	}
+
+	var crc [sofarpc.CRC32_LEN]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(frame))
+	log.ByContext(context).Debugf("[BOLTV2 Encoder]append crc32 to frame, crc = %x", crc)
+
+	return append(frame, crc[:]...)
+}
+
+// forceCrc turns on crc32 of the frames sent on the connection forcing crc, which requires ver1 > 1
+func forceCrc(context context.Context, ver1 byte, switchCode sofarpc.SwitchCode) (byte, sofarpc.SwitchCode) {
+	if !sofarpc.ForceCrc(context) {
+		return ver1, switchCode
+	}
+
+	if ver1 < sofarpc.PROTOCOL_VERSION_2 {
+		ver1 = sofarpc.PROTOCOL_VERSION_2
+	}
+
+	return ver1, switchCode.Set(sofarpc.SWITCH_CRC_ON)
+}
+
+// crc32 exists when ver1 > 1 and the crc switch is on
+func (c *boltV2Codec) crcEnabled(ver1 byte, switchCode sofarpc.SwitchCode) bool {
+	return ver1 > sofarpc.PROTOCOL_VERSION_1 && switchCode.Has(sofarpc.SWITCH_CRC_ON)
+}
+
+// EncodeFrameTrailer returns the crc32 of the frame whose content is written by stream after the headers
+func (c *boltV2Codec) EncodeFrameTrailer(context context.Context, headers types.IoBuffer, data types.IoBuffer) types.IoBuffer {
+	frame := headers.Bytes()
+	if len(frame) < sofarpc.LESS_LEN_V2 || !c.crcEnabled(frame[1], sofarpc.SwitchCode(frame[11])) {
+		return nil
+	}
+
+	fixedLen, classLen, headerLen, contentLen, ok := c.frameLengths(frame)
+	// content and crc32 are encoded with the headers
+	if !ok || contentLen == 0 || len(frame) != fixedLen+classLen+headerLen {
+		return nil
+	}
+
+	crc := crc32.ChecksumIEEE(frame)
+	if data != nil {
+		crc = crc32.Update(crc, crc32.IEEETable, data.Bytes())
+	}
+
+	trailer := make([]byte, sofarpc.CRC32_LEN)
+	binary.BigEndian.PutUint32(trailer, crc)
+	log.ByContext(context).Debugf("[BOLTV2 Encoder]append crc32 to frame content, crc = %x", trailer)
+
+	return buffer.NewIoBufferBytes(trailer)
+}
+
+// EncodeContent compresses the content written by stream if compression is enabled on the stream and the
+// content is longer than the threshold. The switch code and content length of the headers are updated in place,
+// class and header length are not changed as only the content is compressed.
+func (c *boltV2Codec) EncodeContent(context context.Context, headers types.IoBuffer, data types.IoBuffer) types.IoBuffer {
+	compression := connectionCompression(context)
+	if compression.Algorithm == 0 || data.Len() <= compression.Threshold {
+		return data
+	}
+
+	frame := headers.Bytes()
+	fixedLen, classLen, headerLen, contentLen, ok := c.frameLengths(frame)
+	// content is encoded with the headers, or compressed already
+	if !ok || contentLen != data.Len() || len(frame) != fixedLen+classLen+headerLen ||
+		sofarpc.SwitchCode(frame[11]).Has(sofarpc.SWITCH_COMPRESSED) {
+		return data
+	}
+
+	compressed, err := compress(compression.Algorithm, data.Bytes())
+	if err != nil {
+		log.ByContext(context).Errorf("[BOLTV2 Encoder]compress content failed, err = %v", err)
+		return data
+	}
+
+	// not worth compressing
+	if len(compressed) >= data.Len() {
+		return data
+	}
+
+	switchCode := sofarpc.SwitchCode(frame[11]).Clear(sofarpc.SWITCH_COMPRESSION_MASK)
+	frame[11] = byte(switchCode.Set(compression.Algorithm | sofarpc.SWITCH_COMPRESSED))
+	// content length is the last field of the fixed header
+	binary.BigEndian.PutUint32(frame[fixedLen-4:fixedLen], uint32(len(compressed)))
+	log.ByContext(context).Debugf("[BOLTV2 Encoder]content compressed from %d to %d bytes", data.Len(), len(compressed))
+
+	return buffer.NewIoBufferBytes(compressed)
+}
+
+// frameLengths returns the fixed header length and the class, header, content length of the encoded frame
+func (c *boltV2Codec) frameLengths(frame []byte) (fixedLen, classLen, headerLen, contentLen int, ok bool) {
+	if len(frame) < sofarpc.LESS_LEN_V2 {
+		return
+	}
+
+	if frame[2] == sofarpc.RESPONSE {
+		fixedLen = sofarpc.RESPONSE_HEADER_LEN_V2
+		classLen = int(binary.BigEndian.Uint16(frame[14:16]))
+		headerLen = int(binary.BigEndian.Uint16(frame[16:18]))
+		contentLen = int(binary.BigEndian.Uint32(frame[18:22]))
+	} else {
+		if len(frame) < sofarpc.REQUEST_HEADER_LEN_V2 {
+			return
+		}
+		fixedLen = sofarpc.REQUEST_HEADER_LEN_V2
+		classLen = int(binary.BigEndian.Uint16(frame[16:18]))
+		headerLen = int(binary.BigEndian.Uint16(frame[18:20]))
+		contentLen = int(binary.BigEndian.Uint32(frame[20:24]))
+	}
+
+	return fixedLen, classLen, headerLen, contentLen, true
+}
+
+// compression enabled on the stream, set by the connection pool for requests,
+// and by the stream for responses with the compression accepted by the peer
+func connectionCompression(context context.Context) sofarpc.Compression {
+	if context == nil {
+		return sofarpc.Compression{}
+	}
+
+	if compression, ok := context.Value(types.ContextKeyBoltCompression).(sofarpc.Compression); ok {
+		return compression
+	}
+
+	return sofarpc.Compression{}
+}
+
+// decodeCompression decompresses the content flagged by the switch code. Compression bits are consumed
+// by the decoder, the algorithm accepted by the peer is returned.
+func (c *boltV2Codec) decodeCompression(switchCode sofarpc.SwitchCode, content []byte) (sofarpc.SwitchCode,
+	sofarpc.SwitchCode, []byte, error) {
+	algorithm := compressionAlgorithm(switchCode)
+
+	if switchCode.Has(sofarpc.SWITCH_COMPRESSED) && len(content) > 0 {
+		decompressed, err := decompress(algorithm, content)
+		if err != nil {
+			return switchCode, algorithm, nil, err
+		}
+		content = decompressed
+	}
+
+	return switchCode.Clear(sofarpc.SWITCH_COMPRESSION_MASK), algorithm, content, nil
+}
+
+// switch bits enabled on the connection, which are set on the requests sent
+func connectionSwitch(context context.Context) sofarpc.SwitchCode {
+	if context == nil {
+		return 0
+	}
+
+	if switchCode, ok := context.Value(types.ContextKeyBoltSwitch).(sofarpc.SwitchCode); ok {
+		return switchCode
+	}
+
+	return 0
+}
+
+// checkCrc32 compares the crc32 of frame[:frameLen] with the trailing 4 bytes
+func (c *boltV2Codec) checkCrc32(frame []byte, frameLen int) bool {
+	expected := binary.BigEndian.Uint32(frame[frameLen : frameLen+sofarpc.CRC32_LEN])
+
+	return crc32.ChecksumIEEE(frame[:frameLen]) == expected
 }
 
 func (c *boltV2Codec) mapToCmd(headers map[string]string) interface{} {
@@ -113,24 +313,30 @@ func (c *boltV2Codec) mapToCmd(headers map[string]string) interface{} {
 		return nil
 	}
 
-	cmdV1 := boltV1.mapToCmd(headers)
+	// removed before the rest headers are serialized into the header map by v1 codec
+	var ver1, switchCode byte
+	if v, ok := sofarpc.GetPropertyValue(BoltV2PropertyHeaders, headers, sofarpc.HeaderVersion1).(byte); ok {
+		ver1 = v
+	}
+	if v, ok := sofarpc.GetPropertyValue(BoltV2PropertyHeaders, headers, sofarpc.HeaderSwitchCode).(byte); ok {
+		switchCode = v
+	}
 
-	ver1 := sofarpc.GetPropertyValue(BoltV2PropertyHeaders, headers, "ver1")
-	switchcode := sofarpc.GetPropertyValue(BoltV2PropertyHeaders, headers, "switchcode")
+	cmdV1 := boltV1.mapToCmd(headers)
 
-	if cmdV2req, ok := cmdV1.(sofarpc.BoltRequestCommand); ok {
+	if cmdV2req, ok := cmdV1.(*sofarpc.BoltRequestCommand); ok {
 		request := &sofarpc.BoltV2RequestCommand{
-			BoltRequestCommand: cmdV2req,
-			Version1:           ver1.(byte),
-			SwitchCode:         switchcode.(byte),
+			BoltRequestCommand: *cmdV2req,
+			Version1:           ver1,
+			SwitchCode:         sofarpc.SwitchCode(switchCode),
 		}
 
 		return request
-	} else if cmdV2res, ok := cmdV1.(sofarpc.BoltResponseCommand); ok {
+	} else if cmdV2res, ok := cmdV1.(*sofarpc.BoltResponseCommand); ok {
 		response := &sofarpc.BoltV2ResponseCommand{
-			BoltResponseCommand: cmdV2res,
-			Version1:            ver1.(byte),
-			SwitchCode:          switchcode.(byte),
+			BoltResponseCommand: *cmdV2res,
+			Version1:            ver1,
+			SwitchCode:          sofarpc.SwitchCode(switchCode),
 		}
 
 		return response
@@ -163,7 +369,7 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 				requestId := binary.BigEndian.Uint32(bytes[6:10])
 				codec := bytes[10]
 
-				switchCode := bytes[11]
+				switchCode := sofarpc.SwitchCode(bytes[11])
 
 				timeout := binary.BigEndian.Uint32(bytes[12:16])
 				classLen := binary.BigEndian.Uint16(bytes[16:18])
@@ -172,21 +378,46 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 
 				read = sofarpc.REQUEST_HEADER_LEN_V2
 				var class, header, content []byte
+				var compression sofarpc.SwitchCode
 
-				if readableBytes >= read+int(classLen)+int(headerLen)+int(contentLen) {
-					if classLen > 0 {
-						class = bytes[read : read+int(classLen)]
-						read += int(classLen)
-					}
-					if headerLen > 0 {
-						header = bytes[read : read+int(headerLen)]
-						read += int(headerLen)
-					}
-					if contentLen > 0 {
-						content = bytes[read : read+int(contentLen)]
-						read += int(contentLen)
+				if !sofarpc.IsKnownCodec(codec) {
+					logger.Errorf("[BOLTV2 Decoder]request unknown codec, requestId = %d, codec = %d", requestId, codec)
+					return read, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonUnknownCodec, sofarpc.UnKnownCodec)
+				}
+
+				// reject before buffering the body of an oversized frame
+				if err := checkFrameLimits(classLen, headerLen, contentLen); err != nil {
+					logger.Errorf("[BOLTV2 Decoder]request frame too large, requestId = %d, classLen = %d, headerLen = %d, contentLen = %d",
+						requestId, classLen, headerLen, contentLen)
+					return read, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonOversized, err.Error())
+				}
+
+				frameLen := read + int(classLen) + int(headerLen) + int(contentLen)
+				crcLen := 0
+				if c.crcEnabled(ver1, switchCode) {
+					crcLen = sofarpc.CRC32_LEN
+				}
+
+				if readableBytes >= frameLen+crcLen {
+					if crcLen > 0 && !c.checkCrc32(bytes, frameLen) {
+						logger.Errorf("[BOLTV2 Decoder]crc32 check failed, requestId = %d", requestId)
+						data.Drain(frameLen + crcLen)
+
+						return frameLen + crcLen, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonBadCrc, sofarpc.InvalidCrc32)
 					}
+
+					class, header, content = copyFrameFields(bytes, read, classLen, headerLen, contentLen)
+					read += int(classLen) + int(headerLen) + int(contentLen)
+					read += crcLen
 					data.Drain(read)
+
+					var err error
+					if switchCode, compression, content, err = c.decodeCompression(switchCode, content); err != nil {
+						logger.Errorf("[BOLTV2 Decoder]decompress content failed, requestId = %d, err = %v", requestId, err)
+
+						return read, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonBadCompression, sofarpc.InvalidCompression)
+					}
+					contentLen = uint32(len(content))
 				} else { // not enough data
 					logger.Debugf("[BOLTV2 Decoder]no enough data for fully decode")
 					return read, nil
@@ -194,13 +425,13 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 
 				request := &sofarpc.BoltV2RequestCommand{
 					sofarpc.BoltRequestCommand{
-						sofarpc.PROTOCOL_CODE_V1,
+						sofarpc.PROTOCOL_CODE_V2,
 						dataType,
 						int16(cmdCode),
 						ver2,
 						requestId,
 						codec,
-						int(timeout),
+						int(int32(timeout)), // timeout is signed, -1 means no timeout
 						int16(classLen),
 						int16(headerLen),
 						int(contentLen),
@@ -212,11 +443,16 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 					},
 					ver1,
 					switchCode,
+					compression,
 				}
 
 				logger.Debugf("[Decoder]bolt v2 decode request:%+v", request)
 
 				cmd = request
+			} else {
+				// not enough data for the request header
+				logger.Debugf("[BOLTV2 Decoder]no enough data for request header")
+				return sofarpc.REQUEST_HEADER_LEN_V2, nil
 			}
 		} else {
 			//2. resposne
@@ -226,7 +462,7 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 				ver2 := bytes[5]
 				requestId := binary.BigEndian.Uint32(bytes[6:10])
 				codec := bytes[10]
-				switchCode := bytes[11]
+				switchCode := sofarpc.SwitchCode(bytes[11])
 
 				status := binary.BigEndian.Uint16(bytes[12:14])
 				classLen := binary.BigEndian.Uint16(bytes[14:16])
@@ -235,20 +471,61 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 
 				read = sofarpc.RESPONSE_HEADER_LEN_V2
 				var class, header, content []byte
+				var compression sofarpc.SwitchCode
+				var wireContentLen uint32
 
-				if readableBytes >= read+int(classLen)+int(headerLen)+int(contentLen) {
-					if classLen > 0 {
-						class = bytes[read : read+int(classLen)]
-						read += int(classLen)
-					}
-					if headerLen > 0 {
-						header = bytes[read : read+int(headerLen)]
-						read += int(headerLen)
+				if !sofarpc.IsKnownCodec(codec) {
+					logger.Errorf("[BOLTV2 Decoder]response unknown codec, requestId = %d, codec = %d", requestId, codec)
+					return read, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonUnknownCodec, sofarpc.UnKnownCodec)
+				}
+
+				// reject before buffering the body of an oversized frame
+				if err := checkFrameLimits(classLen, headerLen, contentLen); err != nil {
+					logger.Errorf("[BOLTV2 Decoder]response frame too large, requestId = %d, classLen = %d, headerLen = %d, contentLen = %d",
+						requestId, classLen, headerLen, contentLen)
+					return read, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonOversized, err.Error())
+				}
+
+				frameLen := read + int(classLen) + int(headerLen) + int(contentLen)
+				crcLen := 0
+				if c.crcEnabled(ver1, switchCode) {
+					crcLen = sofarpc.CRC32_LEN
+				} else if sofarpc.ForceCrc(context) {
+					// responses of the cluster forcing crc are accepted with crc32 only
+					logger.Errorf("[BOLTV2 Decoder]response without crc32 on connection forcing crc, requestId = %d", requestId)
+					return read, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonBadCrc, sofarpc.InvalidCrc32)
+				}
+
+				// the response exceeding the limits of cluster is skipped rather than buffered
+				if err := sofarpc.CheckResponseLimits(context, boltV2Name, requestId, headerLen, contentLen, frameLen+crcLen-read); err != nil {
+					logger.Errorf("[BOLTV2 Decoder]response exceeds the limits of cluster, requestId = %d, headerLen = %d, contentLen = %d",
+						requestId, headerLen, contentLen)
+					data.Drain(read)
+
+					return read, err
+				}
+
+				if readableBytes >= frameLen+crcLen {
+					if crcLen > 0 && !c.checkCrc32(bytes, frameLen) {
+						logger.Errorf("[BOLTV2 Decoder]crc32 check failed, requestId = %d", requestId)
+						data.Drain(frameLen + crcLen)
+
+						return frameLen + crcLen, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonBadCrc, sofarpc.InvalidCrc32)
 					}
-					if contentLen > 0 {
-						content = bytes[read : read+int(contentLen)]
-						read += int(contentLen)
+
+					class, header, content = copyFrameFields(bytes, read, classLen, headerLen, contentLen)
+					read += int(classLen) + int(headerLen) + int(contentLen)
+					read += crcLen
+					data.Drain(read)
+
+					var err error
+					wireContentLen = contentLen
+					if switchCode, compression, content, err = c.decodeCompression(switchCode, content); err != nil {
+						logger.Errorf("[BOLTV2 Decoder]decompress content failed, requestId = %d, err = %v", requestId, err)
+
+						return read, sofarpc.NewDecodeError(boltV2Name, sofarpc.ReasonBadCompression, sofarpc.InvalidCompression)
 					}
+					contentLen = uint32(len(content))
 				} else { // not enough data
 					logger.Debugf("[BOLTBV2 Decoder]no enough data for fully decode")
 					return read, nil
@@ -257,7 +534,7 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 				response := &sofarpc.BoltV2ResponseCommand{
 					sofarpc.BoltResponseCommand{
 
-						sofarpc.PROTOCOL_CODE_V1,
+						sofarpc.PROTOCOL_CODE_V2,
 						dataType,
 						int16(cmdCode),
 						ver2,
@@ -276,19 +553,27 @@ func (c *boltV2Codec) Decode(context context.Context, data types.IoBuffer) (int,
 					},
 					ver1,
 					switchCode,
+					compression,
+					int(wireContentLen),
 				}
 
 				logger.Debugf("[Decoder]bolt v2 decode response:%+v\n", response)
 				cmd = response
 			}
 		}
+	} else {
+		// not enough data to tell request from response, wait for the smaller header
+		logger.Debugf("[BOLTV2 Decoder]no enough data for header")
+		return sofarpc.LESS_LEN_V2, nil
 	}
 
 	return read, cmd
 }
 
-func (c *boltV2Codec) insertToBytes(slice []byte, idx int, b byte) {
+func (c *boltV2Codec) insertToBytes(slice []byte, idx int, b byte) []byte {
 	slice = append(slice, 0)
 	copy(slice[idx+1:], slice[idx:])
 	slice[idx] = b
+
+	return slice
 }
@@ -0,0 +1,435 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func newBoltV2Request(ver1 byte, switchCode sofarpc.SwitchCode) *sofarpc.BoltV2RequestCommand {
+	content := []byte("hello bolt v2")
+
+	return &sofarpc.BoltV2RequestCommand{
+		BoltRequestCommand: sofarpc.BoltRequestCommand{
+			Protocol:   sofarpc.PROTOCOL_CODE_V2,
+			CmdType:    sofarpc.REQUEST,
+			CmdCode:    sofarpc.RPC_REQUEST,
+			Version:    1,
+			ReqId:      1,
+			CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+			Timeout:    3000,
+			ContentLen: len(content),
+			Content:    content,
+		},
+		Version1:   ver1,
+		SwitchCode: switchCode,
+	}
+}
+
+func encodeBoltV2(t *testing.T, cmd *sofarpc.BoltV2RequestCommand) []byte {
+	err, buf := BoltV2.GetEncoder().EncodeHeaders(nil, cmd)
+	if err != nil {
+		t.Fatalf("encode bolt v2 request failed: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func Test_BoltV2Crc32(t *testing.T) {
+	frame := encodeBoltV2(t, newBoltV2Request(2, sofarpc.SWITCH_CRC_ON))
+
+	data := buffer.NewIoBufferBytes(frame)
+	read, cmd := BoltV2.GetDecoder().Decode(nil, data)
+	if read != len(frame) || data.Len() != 0 {
+		t.Errorf("expect read %d bytes, got %d, remain %d", len(frame), read, data.Len())
+	}
+
+	req, ok := cmd.(*sofarpc.BoltV2RequestCommand)
+	if !ok {
+		t.Fatalf("expect bolt v2 request, got %+v", cmd)
+	}
+	if !bytes.Equal(req.Content, []byte("hello bolt v2")) || req.SwitchCode != sofarpc.SWITCH_CRC_ON {
+		t.Errorf("unexpected decoded request: %+v", req)
+	}
+}
+
+func Test_BoltV2Crc32Mismatch(t *testing.T) {
+	frame := encodeBoltV2(t, newBoltV2Request(2, sofarpc.SWITCH_CRC_ON))
+	// corrupt the last byte of content
+	frame[len(frame)-sofarpc.CRC32_LEN-1] ^= 0xff
+
+	data := buffer.NewIoBufferBytes(frame)
+	_, cmd := BoltV2.GetDecoder().Decode(nil, data)
+
+	err, ok := cmd.(error)
+	if !ok || err.Error() != sofarpc.InvalidCrc32 {
+		t.Errorf("expect crc32 check error, got %+v", cmd)
+	}
+	if data.Len() != 0 {
+		t.Errorf("broken frame should be drained, remain %d", data.Len())
+	}
+}
+
+func Test_BoltV2WithoutCrc32(t *testing.T) {
+	// ver1 = 1 means no crc32 even if switch is on
+	frame := encodeBoltV2(t, newBoltV2Request(1, sofarpc.SWITCH_CRC_ON))
+	frame = append(frame, []byte("hello bolt v2")...)
+
+	data := buffer.NewIoBufferBytes(frame)
+	read, cmd := BoltV2.GetDecoder().Decode(nil, data)
+	if _, ok := cmd.(*sofarpc.BoltV2RequestCommand); !ok || read != len(frame) {
+		t.Errorf("expect bolt v2 request of %d bytes, got %+v, read %d", len(frame), cmd, read)
+	}
+}
+
+func Test_BoltV2DecodeFragmented(t *testing.T) {
+	for _, switchCode := range []sofarpc.SwitchCode{0, sofarpc.SWITCH_CRC_ON} {
+		frame := encodeBoltV2(t, newBoltV2Request(2, switchCode))
+		if switchCode != sofarpc.SWITCH_CRC_ON {
+			// content is only encoded with the headers when crc32 is on
+			frame = append(frame, []byte("hello bolt v2")...)
+		}
+
+		req, ok := decodeByteByByte(t, BoltV2.GetDecoder(), frame).(*sofarpc.BoltV2RequestCommand)
+		if !ok {
+			t.Fatalf("switch %d: expect bolt v2 request", switchCode)
+		}
+		if !bytes.Equal(req.Content, []byte("hello bolt v2")) || req.SwitchCode != switchCode {
+			t.Errorf("switch %d: unexpected decoded request: %+v", switchCode, req)
+		}
+	}
+}
+
+func Test_BoltV2SwitchRoundTrip(t *testing.T) {
+	content := []byte("hello bolt v2")
+	// crc switch with an unknown bit
+	switchCode := sofarpc.SWITCH_CRC_ON.Set(0x80)
+	frame := encodeBoltV2(t, newBoltV2Request(2, switchCode))
+
+	_, cmd := BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	req, ok := cmd.(*sofarpc.BoltV2RequestCommand)
+	if !ok || req.GetProtocol() != sofarpc.PROTOCOL_CODE_V2 || !req.SwitchCode.Has(sofarpc.SWITCH_CRC_ON) {
+		t.Fatalf("expect bolt v2 request with crc switch, got %+v", cmd)
+	}
+
+	// headers are encoded from the map, and content is written after them by stream
+	filter := &mockDecodeFilter{}
+	if err := BoltV2.GetCommandHandler().HandleCommand(nil, req, filter); err != nil {
+		t.Fatalf("handle command failed: %v", err)
+	}
+	err, headers := sofarpc.DefaultProtocols().EncodeHeaders(nil, filter.headers)
+	if err != nil {
+		t.Fatalf("encode headers failed: %v", err)
+	}
+	data := buffer.NewIoBufferBytes(content)
+	trailer := sofarpc.EncodeFrameTrailer(nil, headers, data)
+	if trailer == nil || trailer.Len() != sofarpc.CRC32_LEN {
+		t.Fatalf("expect crc32 trailer, got %v", trailer)
+	}
+
+	reencoded := append(append(headers.Bytes(), content...), trailer.Bytes()...)
+	read, cmd := BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(reencoded))
+	req, ok = cmd.(*sofarpc.BoltV2RequestCommand)
+	if !ok || read != len(reencoded) {
+		t.Fatalf("expect bolt v2 request of %d bytes, got %+v, read %d", len(reencoded), cmd, read)
+	}
+	if req.SwitchCode != switchCode || req.Version1 != 2 || !bytes.Equal(req.Content, content) {
+		t.Errorf("unexpected round trip request: %+v", req)
+	}
+
+	// no trailer if crc is off
+	_, headers = BoltV2.GetEncoder().EncodeHeaders(nil, newBoltV2Request(2, switchCode.Clear(sofarpc.SWITCH_CRC_ON)))
+	if trailer := sofarpc.EncodeFrameTrailer(nil, headers, data); trailer != nil {
+		t.Errorf("expect no trailer without crc switch, got %v", trailer.Bytes())
+	}
+}
+
+const testServiceName = "com.alipay.test.TestService:1.0"
+
+// encodes the request with its content written apart from the headers, as stream does
+func encodeBoltV2Content(t *testing.T, ctx context.Context, switchCode sofarpc.SwitchCode, content []byte) []byte {
+	cmd := newBoltV2Request(2, switchCode)
+	cmd.ClassName = []byte(testServiceName)
+	cmd.ClassLen = int16(len(testServiceName))
+	cmd.Content = nil
+	cmd.ContentLen = len(content)
+
+	err, headers := BoltV2.GetEncoder().EncodeHeaders(ctx, cmd)
+	if err != nil {
+		t.Fatalf("encode bolt v2 request failed: %v", err)
+	}
+
+	data := sofarpc.EncodeContent(ctx, headers, buffer.NewIoBufferBytes(content))
+	frame := append(headers.Bytes(), data.Bytes()...)
+	if trailer := sofarpc.EncodeFrameTrailer(ctx, headers, data); trailer != nil {
+		frame = append(frame, trailer.Bytes()...)
+	}
+
+	return frame
+}
+
+func Test_BoltV2Compression(t *testing.T) {
+	content := bytes.Repeat([]byte("hello bolt v2 "), 100)
+
+	for _, algorithm := range []sofarpc.SwitchCode{sofarpc.SWITCH_GZIP_ON, sofarpc.SWITCH_DEFLATE_ON} {
+		for _, threshold := range []int{len(content) - 1, len(content)} {
+			for _, switchCode := range []sofarpc.SwitchCode{0, sofarpc.SWITCH_CRC_ON} {
+				ctx := context.WithValue(context.Background(), types.ContextKeyBoltCompression, sofarpc.Compression{
+					Algorithm: algorithm,
+					Threshold: threshold,
+				})
+				frame := encodeBoltV2Content(t, ctx, switchCode, content)
+
+				// only the content longer than threshold is compressed, the algorithm is always advertised
+				compressed := threshold < len(content)
+				if sofarpc.SwitchCode(frame[11]).Has(sofarpc.SWITCH_COMPRESSED) != compressed ||
+					!sofarpc.SwitchCode(frame[11]).Has(algorithm) {
+					t.Errorf("algorithm %x, threshold %d: unexpected switch %x", algorithm, threshold, frame[11])
+				}
+				if compressed == (len(frame) >= len(content)) {
+					t.Errorf("algorithm %x, threshold %d: unexpected frame length %d", algorithm, threshold, len(frame))
+				}
+
+				data := buffer.NewIoBufferBytes(frame)
+				read, cmd := BoltV2.GetDecoder().Decode(nil, data)
+				req, ok := cmd.(*sofarpc.BoltV2RequestCommand)
+				if !ok || read != len(frame) || data.Len() != 0 {
+					t.Fatalf("algorithm %x, threshold %d: expect bolt v2 request, got %+v", algorithm, threshold, cmd)
+				}
+
+				// compression bits are consumed by decoder, class and header are not changed
+				if !bytes.Equal(req.Content, content) || req.ContentLen != len(content) ||
+					req.SwitchCode != switchCode || req.Compression != algorithm ||
+					req.GetServiceName() != testServiceName || req.HeaderLen != 0 {
+					t.Errorf("algorithm %x, threshold %d: unexpected decoded request: %+v", algorithm, threshold, req)
+				}
+			}
+		}
+	}
+}
+
+func Test_BoltV2DecompressFailed(t *testing.T) {
+	// content flagged as compressed is not
+	frame := encodeBoltV2(t, newBoltV2Request(2, sofarpc.SWITCH_GZIP_ON|sofarpc.SWITCH_COMPRESSED))
+	frame = append(frame, []byte("hello bolt v2")...)
+
+	data := buffer.NewIoBufferBytes(frame)
+	_, cmd := BoltV2.GetDecoder().Decode(nil, data)
+
+	err, ok := cmd.(error)
+	if !ok || err.Error() != sofarpc.InvalidCompression {
+		t.Errorf("expect decompress error, got %+v", cmd)
+	}
+	if data.Len() != 0 {
+		t.Errorf("broken frame should be drained, remain %d", data.Len())
+	}
+}
+
+func Test_BoltV2FrameTooLarge(t *testing.T) {
+	//a declared length of 4GB is rejected by default limits
+	cmd := newBoltV2Request(2, 0)
+	cmd.Content = nil
+	cmd.ContentLen = -1
+	header := encodeBoltV2(t, cmd)
+
+	_, decoded := BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(header))
+	if err, ok := decoded.(error); !ok || err.Error() != sofarpc.FrameTooLarge {
+		t.Errorf("expect frame too large error, got %+v", decoded)
+	}
+
+	SetFrameLimits(v2.BoltFrameLimits{MaxHeaderLen: 8})
+	defer SetFrameLimits(v2.BoltFrameLimits{})
+
+	cmd = newBoltV2Request(2, 0)
+	cmd.HeaderMap = make([]byte, 9)
+	header = encodeBoltV2(t, cmd)[:sofarpc.REQUEST_HEADER_LEN_V2]
+
+	_, decoded = BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(header))
+	if err, ok := decoded.(error); !ok || err.Error() != sofarpc.FrameTooLarge {
+		t.Errorf("expect frame too large error, got %+v", decoded)
+	}
+}
+
+func Test_BoltV2DecompressTooLarge(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 4096)
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltCompression, sofarpc.Compression{
+		Algorithm: sofarpc.SWITCH_GZIP_ON,
+	})
+	frame := encodeBoltV2Content(t, ctx, 0, content)
+
+	//the compressed frame is small enough, but its content expands beyond the limit
+	SetFrameLimits(v2.BoltFrameLimits{MaxContentLen: len(content) - 1})
+	defer SetFrameLimits(v2.BoltFrameLimits{})
+
+	_, cmd := BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	if err, ok := cmd.(error); !ok || err.Error() != sofarpc.InvalidCompression {
+		t.Errorf("expect decompress error, got %+v", cmd)
+	}
+}
+
+func Test_BoltV2CodecErrorMetrics(t *testing.T) {
+	sink := newCodecErrorSink()
+	defer stats.SetSink(nil)
+
+	//bad crc
+	frame := encodeBoltV2(t, newBoltV2Request(2, sofarpc.SWITCH_CRC_ON))
+	frame[len(frame)-sofarpc.CRC32_LEN-1] ^= 0xff
+	BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	if got := sink.count(sofarpc.CodecDecodeErrorsMetric, "boltv2", sofarpc.ReasonBadCrc); got != 1 {
+		t.Errorf("expect 1 bad crc decode error, got %d", got)
+	}
+
+	//unknown codec byte
+	frame = encodeBoltV2(t, newBoltV2Request(2, 0))
+	frame[10] = 0xff
+	_, cmd := BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	if err, ok := cmd.(error); !ok || err.Error() != sofarpc.UnKnownCodec {
+		t.Errorf("expect unknown codec error, got %+v", cmd)
+	}
+	if got := sink.count(sofarpc.CodecDecodeErrorsMetric, "boltv2", sofarpc.ReasonUnknownCodec); got != 1 {
+		t.Errorf("expect 1 unknown codec decode error, got %d", got)
+	}
+
+	//oversized length
+	SetFrameLimits(v2.BoltFrameLimits{MaxHeaderLen: 8})
+	defer SetFrameLimits(v2.BoltFrameLimits{})
+	req := newBoltV2Request(2, 0)
+	req.HeaderMap = make([]byte, 9)
+	BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(encodeBoltV2(t, req)[:sofarpc.REQUEST_HEADER_LEN_V2]))
+	if got := sink.count(sofarpc.CodecDecodeErrorsMetric, "boltv2", sofarpc.ReasonOversized); got != 1 {
+		t.Errorf("expect 1 oversized decode error, got %d", got)
+	}
+}
+
+func Test_BoltV2ForceCrc(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltForceCrc, true)
+
+	// crc32 is turned on with ver1 raised, e.g. heartbeats of ver1 1
+	err, buf := BoltV2.GetEncoder().EncodeHeaders(ctx, newBoltV2Request(1, 0x80))
+	if err != nil {
+		t.Fatalf("encode bolt v2 request failed: %v", err)
+	}
+	frame := buf.Bytes()
+	if frame[1] != sofarpc.PROTOCOL_VERSION_2 || sofarpc.SwitchCode(frame[11]) != sofarpc.SWITCH_CRC_ON|0x80 {
+		t.Fatalf("expect ver1 2 and crc switch on, got ver1 %d switch %x", frame[1], frame[11])
+	}
+
+	read, cmd := BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	if req, ok := cmd.(*sofarpc.BoltV2RequestCommand); !ok || read != len(frame) || !bytes.Equal(req.Content, []byte("hello bolt v2")) {
+		t.Errorf("expect bolt v2 request with crc32 of %d bytes, got %+v, read %d", len(frame), cmd, read)
+	}
+}
+
+func Test_ForceCrcRejectsResponseWithoutCrc(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltForceCrc, true)
+	content := []byte("hello bolt")
+
+	_, v2Headers := BoltV2.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltV2ResponseCommand{
+		BoltResponseCommand: sofarpc.BoltResponseCommand{
+			Protocol:   sofarpc.PROTOCOL_CODE_V2,
+			CmdType:    sofarpc.RESPONSE,
+			CmdCode:    sofarpc.RPC_RESPONSE,
+			Version:    1,
+			ReqId:      1,
+			CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+			ContentLen: len(content),
+		},
+		Version1: 2,
+	})
+	_, v1Headers := BoltV1.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltResponseCommand{
+		Protocol:   sofarpc.PROTOCOL_CODE_V1,
+		CmdType:    sofarpc.RESPONSE,
+		CmdCode:    sofarpc.RPC_RESPONSE,
+		Version:    1,
+		ReqId:      1,
+		CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+		ContentLen: len(content),
+	})
+
+	for name, protocol := range map[string]*BoltProtocol{"boltv2": BoltV2, "boltv1": BoltV1} {
+		headers := v2Headers
+		if protocol == BoltV1 {
+			headers = v1Headers
+		}
+		frame := append(append([]byte(nil), headers.Bytes()...), content...)
+
+		// accepted on the connections not forcing crc
+		if _, cmd := protocol.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame)); cmd == nil {
+			t.Fatalf("expect %s response decoded", name)
+		} else if err, ok := cmd.(error); ok {
+			t.Fatalf("expect %s response decoded, got %v", name, err)
+		}
+
+		_, cmd := protocol.GetDecoder().Decode(ctx, buffer.NewIoBufferBytes(frame))
+		if err, ok := cmd.(error); !ok || err.Error() != sofarpc.InvalidCrc32 {
+			t.Errorf("expect %s response without crc32 rejected, got %+v", name, cmd)
+		}
+	}
+}
+
+func Test_ResponseLimits(t *testing.T) {
+	sink := newCodecErrorSink()
+	defer stats.SetSink(nil)
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltResponseLimits, v2.ResponseLimits{MaxContentLen: 16})
+
+	for name, protocol := range map[string]*BoltProtocol{"boltv2": BoltV2, "boltv1": BoltV1} {
+		for _, contentLen := range []int{16, 17} {
+			response := sofarpc.BoltResponseCommand{
+				Protocol:   sofarpc.PROTOCOL_CODE_V1,
+				CmdType:    sofarpc.RESPONSE,
+				CmdCode:    sofarpc.RPC_RESPONSE,
+				Version:    1,
+				ReqId:      1,
+				CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+				ContentLen: contentLen,
+			}
+			var cmd interface{} = &response
+			if protocol == BoltV2 {
+				response.Protocol = sofarpc.PROTOCOL_CODE_V2
+				cmd = &sofarpc.BoltV2ResponseCommand{BoltResponseCommand: response, Version1: 1}
+			}
+			_, headers := protocol.GetEncoder().EncodeHeaders(nil, cmd)
+			data := buffer.NewIoBufferBytes(append(append([]byte(nil), headers.Bytes()...), make([]byte, contentLen)...))
+
+			_, decoded := protocol.GetDecoder().Decode(ctx, data)
+			if contentLen <= 16 {
+				if _, ok := decoded.(error); ok || decoded == nil || data.Len() != 0 {
+					t.Errorf("expect %s response of %d bytes decoded, got %+v", name, contentLen, decoded)
+				}
+				continue
+			}
+
+			// only the header is read, the content is left to be skipped
+			err, ok := decoded.(*sofarpc.ResponseTooLargeError)
+			if !ok || err.RequestId != 1 || err.FrameLen != contentLen || data.Len() != contentLen {
+				t.Errorf("expect %s response of %d bytes rejected, got %+v, %d bytes left", name, contentLen, decoded, data.Len())
+			}
+		}
+
+		if got := sink.count(sofarpc.CodecDecodeErrorsMetric, name, sofarpc.ReasonLargeResponse); got != 1 {
+			t.Errorf("expect 1 %s large response decode error, got %d", name, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"sync"
+
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// frame buffers smaller than this are not worth pooling
+const minFrameBufferSize = 1 << 6
+
+// Buffers of frames are pooled so that they are not allocated for each frame. Contents of decoded frames
+// are not pooled, as they are held by the streams after the frame, e.g. kept for retries.
+var (
+	// buffers of the encoded headers, given back once written to the connection
+	headersBufferPool sync.Pool
+	// buffers of the class and header fields of decoded frames, given back once the command is handled
+	fieldsBufferPool sync.Pool
+)
+
+// retained tells whether a buffer of the capacity is kept in the pool, buffers larger than the max
+// retained size are dropped, so that a few large frames don't pin memory in the pool
+func retained(capacity int) bool {
+	return capacity >= minFrameBufferSize && capacity <= GetFrameLimits().MaxRetainedBufferSize
+}
+
+// takeHeadersBuffer returns an empty buffer able to hold size bytes without growing
+func takeHeadersBuffer(size int) types.IoBuffer {
+	if v := headersBufferPool.Get(); v != nil {
+		if buf := v.(types.IoBuffer); buf.Cap() >= size {
+			return buf
+		}
+	}
+
+	if size < minFrameBufferSize {
+		size = minFrameBufferSize
+	}
+
+	return buffer.NewIoBuffer(size)
+}
+
+func giveHeadersBuffer(buf types.IoBuffer) {
+	if !retained(buf.Cap()) {
+		return
+	}
+
+	buf.Reset()
+	headersBufferPool.Put(buf)
+}
+
+// takeFieldsBuffer returns an empty byte slice able to hold size bytes without growing
+func takeFieldsBuffer(size int) []byte {
+	if v := fieldsBufferPool.Get(); v != nil {
+		if b := v.([]byte); cap(b) >= size {
+			return b
+		}
+	}
+
+	if size < minFrameBufferSize {
+		size = minFrameBufferSize
+	}
+
+	return make([]byte, 0, size)
+}
+
+func giveFieldsBuffer(b []byte) {
+	if !retained(cap(b)) {
+		return
+	}
+
+	fieldsBufferPool.Put(b[:0])
+}
+
+// releaseFrameFields gives back the buffer holding the class and header fields, they share one buffer
+// taken by copyFrameFields. The fields are cleared so that the command doesn't refer to the buffer any more
+func releaseFrameFields(class, header *[]byte) {
+	fields := *class
+	if len(fields) == 0 {
+		fields = *header
+	}
+
+	*class, *header = nil, nil
+
+	if len(fields) > 0 {
+		giveFieldsBuffer(fields)
+	}
+}
+
+// ReleaseCommand gives back the buffers of the command decoded by bolt codecs, called once the command is handled
+func (c *boltV1Codec) ReleaseCommand(cmd interface{}) {
+	releaseCommand(cmd)
+}
+
+// ReleaseHeaders gives back the buffer of the headers encoded by bolt codecs, called once they are written
+func (c *boltV1Codec) ReleaseHeaders(headers types.IoBuffer) {
+	giveHeadersBuffer(headers)
+}
+
+func (c *boltV2Codec) ReleaseCommand(cmd interface{}) {
+	releaseCommand(cmd)
+}
+
+func (c *boltV2Codec) ReleaseHeaders(headers types.IoBuffer) {
+	giveHeadersBuffer(headers)
+}
+
+func releaseCommand(cmd interface{}) {
+	switch cmd := cmd.(type) {
+	case *sofarpc.BoltRequestCommand:
+		releaseFrameFields(&cmd.ClassName, &cmd.HeaderMap)
+	case *sofarpc.BoltResponseCommand:
+		releaseFrameFields(&cmd.ClassName, &cmd.HeaderMap)
+	case *sofarpc.BoltV2RequestCommand:
+		releaseFrameFields(&cmd.ClassName, &cmd.HeaderMap)
+	case *sofarpc.BoltV2ResponseCommand:
+		releaseFrameFields(&cmd.ClassName, &cmd.HeaderMap)
+	}
+}
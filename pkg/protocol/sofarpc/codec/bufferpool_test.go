@@ -0,0 +1,187 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// contentRecorder keeps the decoded headers and contents, as a stream does
+type contentRecorder struct {
+	mockDecodeFilter
+	contents []types.IoBuffer
+	services []string
+}
+
+func (f *contentRecorder) OnDecodeHeader(streamId string, headers map[string]string) types.FilterStatus {
+	f.services = append(f.services, headers["service"])
+	return f.mockDecodeFilter.OnDecodeHeader(streamId, headers)
+}
+
+func (f *contentRecorder) OnDecodeData(streamId string, data types.IoBuffer) types.FilterStatus {
+	f.contents = append(f.contents, data)
+	return types.Continue
+}
+
+func newBoltV1RequestWithHeaders(service string, content []byte) *sofarpc.BoltRequestCommand {
+	req := newBoltV1Request(content)
+	req.HeaderMap = sofarpc.SerializeHeaderMap(serialize.GetSerialization(req.CodecPro), map[string]string{"service": service})
+	req.HeaderLen = int16(len(req.HeaderMap))
+
+	return req
+}
+
+func encodeBoltV1Frame(t testing.TB, req *sofarpc.BoltRequestCommand, content []byte) []byte {
+	err, buf := BoltV1.GetEncoder().EncodeHeaders(nil, req)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	frame := append(append([]byte{}, buf.Bytes()...), content...)
+	sofarpc.ReleaseEncodedHeaders(sofarpc.PROTOCOL_CODE_V1, buf)
+
+	return frame
+}
+
+func Test_EncodedHeadersNotReusedBeforeRelease(t *testing.T) {
+	_, first := BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1RequestWithHeaders("first", nil))
+	expected := append([]byte{}, first.Bytes()...)
+
+	// more frames are encoded and released while the first one is still being written
+	for i := 0; i < 10; i++ {
+		_, buf := BoltV1.GetEncoder().EncodeHeaders(nil, newBoltV1RequestWithHeaders("second", nil))
+		if &buf.Bytes()[0] == &first.Bytes()[0] {
+			t.Fatalf("buffer of the headers not released is reused")
+		}
+		sofarpc.ReleaseEncodedHeaders(sofarpc.PROTOCOL_CODE_V1, buf)
+	}
+
+	if !bytes.Equal(first.Bytes(), expected) {
+		t.Errorf("encoded headers changed before released")
+	}
+}
+
+func Test_DecodedContentNotPooled(t *testing.T) {
+	var frames []byte
+	for _, service := range []string{"first", "second"} {
+		content := []byte("content of " + service)
+		frames = append(frames, encodeBoltV1Frame(t, newBoltV1RequestWithHeaders(service, content), content)...)
+	}
+
+	filter := &contentRecorder{}
+	sofarpc.DefaultProtocols().Decode(nil, buffer.NewIoBufferBytes(frames), filter)
+	if filter.err != nil || len(filter.contents) != 2 {
+		t.Fatalf("expect 2 requests decoded, got %d, err = %v", len(filter.contents), filter.err)
+	}
+
+	// buffers of the handled frames are reused by the following frames
+	for i := 0; i < 10; i++ {
+		content := []byte("content overwritten")
+		frame := encodeBoltV1Frame(t, newBoltV1RequestWithHeaders("overwritten", content), content)
+		sofarpc.DefaultProtocols().Decode(nil, buffer.NewIoBufferBytes(frame), &mockDecodeFilter{})
+	}
+
+	for i, service := range []string{"first", "second"} {
+		if filter.services[i] != service {
+			t.Errorf("expect decoded service %s, got %s", service, filter.services[i])
+		}
+		if content := filter.contents[i].String(); content != "content of "+service {
+			t.Errorf("decoded content changed after the frame is handled: %s", content)
+		}
+	}
+}
+
+func Test_ReleaseCommand(t *testing.T) {
+	content := []byte("hello")
+	frame := encodeBoltV1Frame(t, newBoltV1RequestWithHeaders("service", content), content)
+
+	_, cmd := BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	req, ok := cmd.(*sofarpc.BoltRequestCommand)
+	if !ok {
+		t.Fatalf("expect bolt v1 request, got %+v", cmd)
+	}
+	if string(req.ClassName) != testClassName || len(req.HeaderMap) == 0 {
+		t.Fatalf("unexpected decoded request: %+v", req)
+	}
+
+	BoltV1.GetDecoder().(sofarpc.FrameBufferReleaser).ReleaseCommand(req)
+	if req.ClassName != nil || req.HeaderMap != nil {
+		t.Errorf("released command still refers to the pooled buffer")
+	}
+	if !bytes.Equal(req.Content, content) {
+		t.Errorf("content released with the command: %s", req.Content)
+	}
+}
+
+func Test_FrameBufferMaxRetained(t *testing.T) {
+	SetFrameLimits(v2.BoltFrameLimits{MaxRetainedBufferSize: 256})
+	defer SetFrameLimits(v2.BoltFrameLimits{})
+
+	giveFieldsBuffer(make([]byte, 1024, 1024))
+	if b := takeFieldsBuffer(16); cap(b) == 1024 {
+		t.Errorf("buffer larger than the max retained size is kept in the pool")
+	}
+	if b := takeFieldsBuffer(16); len(b) != 0 || cap(b) < 16 {
+		t.Errorf("expect empty buffer able to hold 16 bytes, got len %d cap %d", len(b), cap(b))
+	}
+}
+
+func BenchmarkBoltV1EncodeHeaders(b *testing.B) {
+	req := newBoltV1RequestWithHeaders("com.alipay.test.TestService:1.0", nil)
+
+	b.Run("released", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, buf := BoltV1.GetEncoder().EncodeHeaders(nil, req)
+			sofarpc.ReleaseEncodedHeaders(sofarpc.PROTOCOL_CODE_V1, buf)
+		}
+	})
+
+	// buffers are never given back to the pool, as before pooling
+	b.Run("not released", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			BoltV1.GetEncoder().EncodeHeaders(nil, req)
+		}
+	})
+}
+
+func BenchmarkBoltV1Decode(b *testing.B) {
+	content := []byte("hello bolt v1")
+	frame := encodeBoltV1Frame(b, newBoltV1RequestWithHeaders("com.alipay.test.TestService:1.0", content), content)
+
+	b.Run("released", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, cmd := BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+			releaseCommand(cmd)
+		}
+	})
+
+	b.Run("not released", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+		}
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+)
+
+var (
+	errUnknownCompression = errors.New("unknown compression algorithm")
+	errContentTooLarge    = errors.New("decompressed content exceeds the limit")
+)
+
+// compressionAlgorithm picks the algorithm from the switch code, gzip is preferred
+// if both are accepted
+func compressionAlgorithm(switchCode sofarpc.SwitchCode) sofarpc.SwitchCode {
+	if switchCode.Has(sofarpc.SWITCH_GZIP_ON) {
+		return sofarpc.SWITCH_GZIP_ON
+	}
+
+	if switchCode.Has(sofarpc.SWITCH_DEFLATE_ON) {
+		return sofarpc.SWITCH_DEFLATE_ON
+	}
+
+	return 0
+}
+
+func compress(algorithm sofarpc.SwitchCode, content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+
+	switch algorithm {
+	case sofarpc.SWITCH_GZIP_ON:
+		writer = gzip.NewWriter(&buf)
+	case sofarpc.SWITCH_DEFLATE_ON:
+		writer, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return nil, errUnknownCompression
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decompress(algorithm sofarpc.SwitchCode, content []byte) ([]byte, error) {
+	var reader io.ReadCloser
+
+	switch algorithm {
+	case sofarpc.SWITCH_GZIP_ON:
+		r, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		reader = r
+	case sofarpc.SWITCH_DEFLATE_ON:
+		reader = flate.NewReader(bytes.NewReader(content))
+	default:
+		return nil, errUnknownCompression
+	}
+	defer reader.Close()
+
+	// bound the output so that a small compressed body cannot expand without limit
+	limit := int64(GetFrameLimits().MaxContentLen)
+	decompressed, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(decompressed)) > limit {
+		return nil, errContentTooLarge
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,106 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package codec
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+)
+
+// DefaultFrameLimits are generous limits of the declared lengths in bolt frames
+var DefaultFrameLimits = v2.BoltFrameLimits{
+	MaxClassLen:           sofarpc.DefaultMaxClassLen,
+	MaxHeaderLen:          sofarpc.DefaultMaxHeaderLen,
+	MaxContentLen:         sofarpc.DefaultMaxContentLen,
+	MaxRetainedBufferSize: sofarpc.DefaultMaxRetainedBufferSize,
+}
+
+var errFrameTooLarge = errors.New(sofarpc.FrameTooLarge)
+
+// v2.BoltFrameLimits, the limits are shared by all bolt connections
+var frameLimits atomic.Value
+
+func init() {
+	frameLimits.Store(DefaultFrameLimits)
+}
+
+// SetFrameLimits sets the max declared lengths of bolt frames, zero values are replaced by defaults.
+// Frames exceeding the limits are rejected before the body is buffered. Zero ReceiveTimeout and
+// MaxPendingBytes mean no limit.
+func SetFrameLimits(limits v2.BoltFrameLimits) {
+	if limits.MaxClassLen <= 0 {
+		limits.MaxClassLen = DefaultFrameLimits.MaxClassLen
+	}
+	if limits.MaxHeaderLen <= 0 {
+		limits.MaxHeaderLen = DefaultFrameLimits.MaxHeaderLen
+	}
+	if limits.MaxContentLen <= 0 {
+		limits.MaxContentLen = DefaultFrameLimits.MaxContentLen
+	}
+	if limits.MaxRetainedBufferSize <= 0 {
+		limits.MaxRetainedBufferSize = DefaultFrameLimits.MaxRetainedBufferSize
+	}
+
+	frameLimits.Store(limits)
+}
+
+// GetFrameLimits returns the limits of bolt frames
+func GetFrameLimits() v2.BoltFrameLimits {
+	return frameLimits.Load().(v2.BoltFrameLimits)
+}
+
+// checkFrameLimits returns error if any declared length exceeds the limit
+func checkFrameLimits(classLen uint16, headerLen uint16, contentLen uint32) error {
+	limits := GetFrameLimits()
+
+	if int(classLen) > limits.MaxClassLen || int(headerLen) > limits.MaxHeaderLen ||
+		int64(contentLen) > int64(limits.MaxContentLen) {
+		return errFrameTooLarge
+	}
+
+	return nil
+}
+
+// copyFrameFields copies class, header and content of the frame starting at offset out of the read
+// buffer. The buffer is drained and overwritten by the following reads on the connection, while the
+// fields of the decoded command are still in use, e.g. the content is being written to the downstream.
+// Class and header are only used to handle the command, they share a buffer of the pool, which is given
+// back by releaseFrameFields. Content is held by the stream after that, so it is allocated on its own.
+func copyFrameFields(bytes []byte, offset int, classLen uint16, headerLen uint16, contentLen uint32) (class, header, content []byte) {
+	if n := int(classLen) + int(headerLen); n > 0 {
+		fields := append(takeFieldsBuffer(n), bytes[offset:offset+n]...)
+
+		if classLen > 0 {
+			class = fields[:classLen]
+		}
+		if headerLen > 0 {
+			header = fields[classLen:n]
+		}
+
+		offset += n
+	}
+
+	if contentLen > 0 {
+		content = make([]byte, contentLen)
+		copy(content, bytes[offset:offset+int(contentLen)])
+	}
+
+	return
+}
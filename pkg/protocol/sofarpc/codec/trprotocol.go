@@ -24,7 +24,7 @@ import (
 )
 
 func init() {
-	sofarpc.RegisterProtocol(sofarpc.PROTOCOL_CODE_TR, Tr)
+	sofarpc.MustRegisterProtocol(sofarpc.PROTOCOL_CODE_TR, Tr)
 }
 
 var Tr = &TrProtocol{
@@ -0,0 +1,110 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"strconv"
+
+	"github.com/alipay/sofamosn/pkg/stats"
+)
+
+// codec errors recorded to the metrics sink, tagged by codec and reason
+const (
+	CodecDecodeErrorsMetric     = "mosn_codec_decode_errors_total"
+	CodecEncodeErrorsMetric     = "mosn_codec_encode_errors_total"
+	CodecConnectionClosesMetric = "mosn_codec_connection_closes_total"
+	TagCodec                    = "codec"
+	TagReason                   = "reason"
+)
+
+// reasons of codec errors
+const (
+	ReasonShortFrame      = "short_frame"
+	ReasonSlowFrame       = "slow_frame"
+	ReasonPendingOverflow = "pending_overflow"
+	ReasonBadCrc          = "bad_crc"
+	ReasonOversized       = "oversized_length"
+	ReasonLargeResponse   = "large_response"
+	ReasonUnknownCodec    = "unknown_codec"
+	ReasonBadCompression  = "bad_compression"
+	ReasonUnknownProtocol = "unknown_protocol"
+	ReasonInvalidCommand  = "invalid_command"
+	ReasonOther           = "other"
+)
+
+// CodecError is a decode or encode error of codec, the message is kept as the error
+// so that it is still told by Error()
+type CodecError struct {
+	Codec  string
+	Reason string
+	Msg    string
+}
+
+func (e *CodecError) Error() string {
+	return e.Msg
+}
+
+// NewDecodeError records the decode error to the metrics sink, and returns it
+func NewDecodeError(codec, reason, msg string) error {
+	stats.GetSink().Count(CodecDecodeErrorsMetric, 1, stats.Tags{TagCodec: codec, TagReason: reason})
+
+	return &CodecError{Codec: codec, Reason: reason, Msg: msg}
+}
+
+// NewEncodeError records the encode error to the metrics sink, and returns it
+func NewEncodeError(codec, reason, msg string) error {
+	stats.GetSink().Count(CodecEncodeErrorsMetric, 1, stats.Tags{TagCodec: codec, TagReason: reason})
+
+	return &CodecError{Codec: codec, Reason: reason, Msg: msg}
+}
+
+// RecordConnectionClose records the connection closed on codec error, returns the reason of err,
+// ReasonOther if err is not a CodecError
+func RecordConnectionClose(err error) string {
+	codec, reason := "", ReasonOther
+	if codecErr, ok := err.(*CodecError); ok {
+		codec, reason = codecErr.Codec, codecErr.Reason
+	}
+
+	stats.GetSink().Count(CodecConnectionClosesMetric, 1, stats.Tags{TagCodec: codec, TagReason: reason})
+
+	return reason
+}
+
+// CodecName returns the name of protocol code, used as codec tag
+func CodecName(protocolCode byte) string {
+	switch protocolCode {
+	case PROTOCOL_CODE_V1:
+		return "boltv1"
+	case PROTOCOL_CODE_V2:
+		return "boltv2"
+	case PROTOCOL_CODE_TR:
+		return "tr"
+	default:
+		return strconv.Itoa(int(protocolCode))
+	}
+}
+
+// IsKnownCodec returns whether the codec byte of frame is a known serialization
+func IsKnownCodec(codec byte) bool {
+	switch codec {
+	case HESSIAN_SERIALIZE, JAVA_SERIALIZE, TOP_SERIALIZE, HESSIAN2_SERIALIZE, PROTOBUF_SERIALIZE:
+		return true
+	default:
+		return false
+	}
+}
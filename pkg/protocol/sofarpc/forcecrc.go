@@ -0,0 +1,90 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// ForceCrc returns whether the frames of the connection are forced to be bolt v2 with crc32,
+// it is set by the connection pool of the cluster forcing crc
+func ForceCrc(context context.Context) bool {
+	if context == nil {
+		return false
+	}
+
+	forceCrc, _ := context.Value(types.ContextKeyBoltForceCrc).(bool)
+
+	return forceCrc
+}
+
+// upgradeToBoltV2 converts the bolt v1 headers to bolt v2 with ver1 2, so that the frame can carry crc32,
+// the switch code is set by the encoder. The header map is copied, as it may be sent to the clusters
+// not forcing crc as well, e.g. on retry or mirror.
+func upgradeToBoltV2(headers interface{}) interface{} {
+	switch h := headers.(type) {
+	case map[string]string:
+		upgraded := make(map[string]string, len(h)+2)
+		for k, v := range h {
+			upgraded[k] = v
+		}
+		upgraded[SofaPropertyHeader(HeaderProtocolCode)] = strconv.Itoa(int(PROTOCOL_CODE_V2))
+		upgraded[SofaPropertyHeader(HeaderVersion1)] = strconv.Itoa(int(PROTOCOL_VERSION_2))
+
+		if _, ok := upgraded[SofaPropertyHeader(HeaderSwitchCode)]; !ok {
+			upgraded[SofaPropertyHeader(HeaderSwitchCode)] = "0"
+		}
+
+		return upgraded
+	case *BoltRequestCommand:
+		cmd := *h
+		cmd.Protocol = PROTOCOL_CODE_V2
+
+		return &BoltV2RequestCommand{
+			BoltRequestCommand: cmd,
+			Version1:           PROTOCOL_VERSION_2,
+		}
+	case *BoltResponseCommand:
+		cmd := *h
+		cmd.Protocol = PROTOCOL_CODE_V2
+
+		return &BoltV2ResponseCommand{
+			BoltResponseCommand: cmd,
+			Version1:            PROTOCOL_VERSION_2,
+		}
+	}
+
+	return headers
+}
+
+// DowngradeToRequestFrame replies the bolt v2 response in bolt v1 if the request is bolt v1,
+// e.g. the request is upgraded to bolt v2 for the cluster forcing crc
+func DowngradeToRequestFrame(headers map[string]string, requestFrame map[string]string) {
+	protocolCode := SofaPropertyHeader(HeaderProtocolCode)
+
+	if requestFrame[protocolCode] != strconv.Itoa(int(PROTOCOL_CODE_V1)) ||
+		headers[protocolCode] != strconv.Itoa(int(PROTOCOL_CODE_V2)) {
+		return
+	}
+
+	headers[protocolCode] = requestFrame[protocolCode]
+	delete(headers, SofaPropertyHeader(HeaderVersion1))
+	delete(headers, SofaPropertyHeader(HeaderSwitchCode))
+}
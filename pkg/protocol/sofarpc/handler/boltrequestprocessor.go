@@ -56,6 +56,10 @@ func (b *BoltRequestProcessor) Process(context context.Context, msg interface{},
 				if cmd.Content == nil {
 					cmd.RequestHeader[types.HeaderStremEnd] = "yes"
 				}
+				// oneway request expects no response
+				if cmd.CmdType == sofarpc.REQUEST_ONEWAY {
+					cmd.RequestHeader[types.HeaderOneway] = "yes"
+				}
 				
 				status := filter.OnDecodeHeader(streamIdStr, cmd.RequestHeader)
 				
@@ -89,6 +93,10 @@ func (b *BoltRequestProcessorV2) Process(context context.Context, msg interface{
 				if cmd.Content == nil {
 					cmd.RequestHeader["x-mosn-endstream"] = "yes"
 				}
+				// oneway request expects no response
+				if cmd.CmdType == sofarpc.REQUEST_ONEWAY {
+					cmd.RequestHeader[types.HeaderOneway] = "yes"
+				}
 				
 				status := filter.OnDecodeHeader(streamIdStr, cmd.RequestHeader)
 
@@ -111,7 +119,7 @@ func (b *BoltRequestProcessorV2) Process(context context.Context, msg interface{
 //Convert BoltV1's Protocol Header  and Content Header to Map[string]string
 func deserializeRequestAllFields(context context.Context, requestCommand *sofarpc.BoltRequestCommand) {
 	//get instance
-	serializeIns := serialize.Instance
+	serializeIns := serialize.GetSerialization(requestCommand.CodecPro)
 
 	//serialize header
 	headerMap := sofarpc.GetMap(context, defaultTmpBufferSize)
@@ -119,7 +127,7 @@ func deserializeRequestAllFields(context context.Context, requestCommand *sofarp
 	//logger
 	logger := log.ByContext(context)
 
-	serializeIns.DeSerialize(requestCommand.HeaderMap, &headerMap)
+	rawHeaders := sofarpc.DeserializeHeaderMap(serializeIns, requestCommand.HeaderMap, headerMap)
 	logger.Debugf("deserialize header map:%v", headerMap)
 
 	allField := sofarpc.GetMap(context, 20+len(headerMap))
@@ -135,8 +143,7 @@ func deserializeRequestAllFields(context context.Context, requestCommand *sofarp
 	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.FormatUint(uint64(requestCommand.ContentLen), 10)
 
 	//serialize class name
-	var className string
-	serializeIns.DeSerialize(requestCommand.ClassName, &className)
+	className := requestCommand.GetServiceName()
 	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)] = className
 	logger.Debugf("request class name is:%s", className)
 
@@ -144,6 +151,11 @@ func deserializeRequestAllFields(context context.Context, requestCommand *sofarp
 		allField[k] = v
 	}
 
+	// passed through to the upstream unchanged
+	if rawHeaders != "" {
+		allField[sofarpc.HeaderRawHeaders] = rawHeaders
+	}
+
 	sofarpc.ReleaseMap(context, headerMap)
 
 	requestCommand.RequestHeader = allField
@@ -153,4 +165,9 @@ func deserializeRequestAllFieldsV2(requestCommandV2 *sofarpc.BoltV2RequestComman
 	deserializeRequestAllFields(context, &requestCommandV2.BoltRequestCommand)
 	requestCommandV2.RequestHeader[sofarpc.SofaPropertyHeader(sofarpc.HeaderVersion1)] = strconv.FormatUint(uint64(requestCommandV2.Version1), 10)
 	requestCommandV2.RequestHeader[sofarpc.SofaPropertyHeader(sofarpc.HeaderSwitchCode)] = strconv.FormatUint(uint64(requestCommandV2.SwitchCode), 10)
+
+	// compression accepted by the peer, used by the response stream
+	if requestCommandV2.Compression != 0 {
+		requestCommandV2.RequestHeader[types.HeaderCompression] = strconv.FormatUint(uint64(requestCommandV2.Compression), 10)
+	}
 }
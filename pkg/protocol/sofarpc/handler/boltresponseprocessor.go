@@ -34,6 +34,7 @@ func (b *BoltResponseProcessor) Process(context context.Context, msg interface{}
 	if cmd, ok := msg.(*sofarpc.BoltResponseCommand); ok {
 		deserializeResponseAllFields(cmd, context)
 		reqID := sofarpc.StreamIDConvert(cmd.ReqId)
+		recordResponseStatus(context, reqID, cmd.ResponseStatus)
 
 		//print tracer log
 		log.DefaultLogger.Infof("streamId=%s,protocol=%s", reqID, "bolt")
@@ -69,6 +70,7 @@ func (b *BoltResponseProcessorV2) Process(context context.Context, msg interface
 	if cmd, ok := msg.(*sofarpc.BoltV2ResponseCommand); ok {
 		deserializeResponseAllFieldsV2(cmd, context)
 		reqID := sofarpc.StreamIDConvert(cmd.ReqId)
+		recordResponseStatus(context, reqID, cmd.ResponseStatus)
 
 		//for demo, invoke ctx as callback
 		if filter, ok := filter.(types.DecodeFilter); ok {
@@ -95,16 +97,28 @@ func (b *BoltResponseProcessorV2) Process(context context.Context, msg interface
 		}
 	}
 }
+func recordResponseStatus(context context.Context, reqID string, status int16) {
+	respErr := sofarpc.ResponseStatusToError(status)
+
+	boltStats.ResponseTotal().Inc(1)
+
+	if respErr.Type != sofarpc.ResponseErrorNone {
+		boltStats.ResponseError(respErr.Type).Inc(1)
+		log.ByContext(context).Debugf("bolt response error, streamId = %s, status = %d, type = %s, retriable = %v",
+			reqID, status, respErr.Type, respErr.Retriable)
+	}
+}
+
 func deserializeResponseAllFields(responseCommand *sofarpc.BoltResponseCommand, context context.Context) {
 	//get instance
-	serializeIns := serialize.Instance
+	serializeIns := serialize.GetSerialization(responseCommand.CodecPro)
 
 	//logger
 	logger := log.ByContext(context)
 
 	//serialize header
 	headerMap := sofarpc.GetMap(context, defaultTmpBufferSize)
-	serializeIns.DeSerialize(responseCommand.HeaderMap, &headerMap)
+	rawHeaders := sofarpc.DeserializeHeaderMap(serializeIns, responseCommand.HeaderMap, headerMap)
 	logger.Debugf("deserialize header map: %+v", headerMap)
 
 	allField := sofarpc.GetMap(context, 20+len(headerMap))
@@ -132,6 +146,11 @@ func deserializeResponseAllFields(responseCommand *sofarpc.BoltResponseCommand,
 		allField[k] = v
 	}
 
+	// passed through to the downstream unchanged
+	if rawHeaders != "" {
+		allField[sofarpc.HeaderRawHeaders] = rawHeaders
+	}
+
 	sofarpc.ReleaseMap(context, headerMap)
 
 	responseCommand.ResponseHeader = allField
@@ -141,4 +160,9 @@ func deserializeResponseAllFieldsV2(responseCommandV2 *sofarpc.BoltV2ResponseCom
 	deserializeResponseAllFields(&responseCommandV2.BoltResponseCommand, context)
 	responseCommandV2.ResponseHeader[sofarpc.SofaPropertyHeader(sofarpc.HeaderVersion1)] = strconv.FormatUint(uint64(responseCommandV2.Version1), 10)
 	responseCommandV2.ResponseHeader[sofarpc.SofaPropertyHeader(sofarpc.HeaderSwitchCode)] = strconv.FormatUint(uint64(responseCommandV2.SwitchCode), 10)
+
+	// content length on the wire differs from contentlen if the content is decompressed
+	if responseCommandV2.WireContentLen != responseCommandV2.ContentLen {
+		responseCommandV2.ResponseHeader[types.HeaderWireContentLen] = strconv.Itoa(responseCommandV2.WireContentLen)
+	}
 }
@@ -0,0 +1,62 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	BoltResponseTotal = "response_total"
+	BoltResponseError = "response_error"
+)
+
+var boltStats = newBoltResponseStats("sofarpc.bolt")
+
+type boltResponseStats struct {
+	stats *stats.Stats
+}
+
+func newBoltResponseStats(namespace string) *boltResponseStats {
+	s := stats.NewStats(namespace).AddCounter(BoltResponseTotal)
+
+	for _, errType := range sofarpc.ResponseErrorTypes {
+		s.AddCounter(responseErrorName(errType))
+	}
+
+	return &boltResponseStats{
+		stats: s,
+	}
+}
+
+func responseErrorName(errType sofarpc.ResponseErrorType) string {
+	return BoltResponseError + "." + errType.String()
+}
+
+func (s *boltResponseStats) ResponseTotal() metrics.Counter {
+	return s.stats.Counter(BoltResponseTotal)
+}
+
+func (s *boltResponseStats) ResponseError(errType sofarpc.ResponseErrorType) metrics.Counter {
+	return s.stats.Counter(responseErrorName(errType))
+}
+
+func (s *boltResponseStats) String() string {
+	return s.stats.String()
+}
@@ -0,0 +1,233 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// bolt request id of converted requests
+var convertReqID uint32
+
+// http headers which are not copied into bolt header map
+var http2SkippedHeaders = map[string]bool{
+	protocol.MosnHeaderPathKey:          true,
+	protocol.MosnHeaderContentLengthKey: true,
+	types.HeaderMethod:                  true,
+	types.HeaderHost:                    true,
+	types.HeaderPath:                    true,
+	types.HeaderQueryString:             true,
+	types.HeaderStreamID:                true,
+}
+
+// proxy headers copied into bolt header map even if not selected
+var http2KeptHeaders = []string{
+	types.HeaderGlobalTimeout,
+	types.HeaderTryTimeout,
+	types.HeaderOneway,
+}
+
+// bolt protocol headers which are not copied into http2 response headers
+var boltProtocolHeaders = []string{
+	HeaderProtocolCode,
+	HeaderCmdType,
+	HeaderCmdCode,
+	HeaderVersion,
+	HeaderReqID,
+	HeaderCodec,
+	HeaderTimeout,
+	HeaderClassLen,
+	HeaderHeaderLen,
+	HeaderContentLen,
+	HeaderClassName,
+	HeaderVersion1,
+	HeaderSwitchCode,
+	HeaderRespStatus,
+	HeaderRespTimeMills,
+}
+
+// Http2ToBoltRequest converts decoded http2 request headers to bolt request headers, which are encoded
+// as a BoltRequestCommand by bolt codec, the request body is sent as content.
+// conf can be nil, class name is derived from path then, and all headers are copied.
+func Http2ToBoltRequest(headers map[string]string, conf *v2.BoltConvert) map[string]string {
+	if conf == nil {
+		conf = &v2.BoltConvert{}
+	}
+
+	className := conf.ClassName
+	if className == "" {
+		className = PathToClassName(headers[protocol.MosnHeaderPathKey], conf.PathPrefix)
+	}
+
+	boltHeaders := make(map[string]string, len(headers)+12)
+
+	if len(conf.Headers) > 0 {
+		for _, name := range conf.Headers {
+			if value, ok := headers[strings.ToLower(name)]; ok {
+				boltHeaders[strings.ToLower(name)] = value
+			}
+		}
+		// proxy headers are always kept
+		for _, name := range http2KeptHeaders {
+			if value, ok := headers[name]; ok {
+				boltHeaders[name] = value
+			}
+		}
+	} else {
+		for name, value := range headers {
+			if !http2SkippedHeaders[name] {
+				boltHeaders[name] = value
+			}
+		}
+	}
+
+	contentLen := headers[protocol.MosnHeaderContentLengthKey]
+	if contentLen == "" {
+		contentLen = "0"
+	}
+
+	timeout := "-1"
+	if v, ok := headers[types.HeaderTryTimeout]; ok {
+		timeout = v
+	}
+
+	class, _ := serialize.GetSerialization(HESSIAN_SERIALIZE).Serialize(className)
+	reqID := StreamIDConvert(atomic.AddUint32(&convertReqID, 1))
+
+	boltHeaders[SofaPropertyHeader(HeaderProtocolCode)] = strconv.Itoa(int(PROTOCOL_CODE_V1))
+	boltHeaders[SofaPropertyHeader(HeaderCmdType)] = strconv.Itoa(int(REQUEST))
+	boltHeaders[SofaPropertyHeader(HeaderCmdCode)] = strconv.Itoa(int(RPC_REQUEST))
+	boltHeaders[SofaPropertyHeader(HeaderVersion)] = "1"
+	boltHeaders[SofaPropertyHeader(HeaderReqID)] = reqID
+	boltHeaders[SofaPropertyHeader(HeaderCodec)] = strconv.Itoa(int(HESSIAN_SERIALIZE))
+	boltHeaders[SofaPropertyHeader(HeaderTimeout)] = timeout
+	boltHeaders[SofaPropertyHeader(HeaderClassLen)] = strconv.Itoa(len(class))
+	// header length is calculated on encode
+	boltHeaders[SofaPropertyHeader(HeaderHeaderLen)] = "0"
+	boltHeaders[SofaPropertyHeader(HeaderContentLen)] = contentLen
+	boltHeaders[SofaPropertyHeader(HeaderClassName)] = className
+	if _, ok := boltHeaders[types.SofaRouteMatchKey]; !ok {
+		boltHeaders[types.SofaRouteMatchKey] = className
+	}
+
+	// upstream stream is identified by request id
+	boltHeaders[types.HeaderStreamID] = reqID
+
+	return boltHeaders
+}
+
+// PathToClassName derives bolt class name from http2 path, the first segment after prefix is used,
+// e.g. com.alipay.test.TestService is derived from grpc path /com.alipay.test.TestService/echo
+func PathToClassName(path, prefix string) string {
+	path = strings.TrimPrefix(path, prefix)
+	path = strings.TrimPrefix(path, "/")
+
+	if idx := strings.Index(path, "/"); idx >= 0 {
+		path = path[:idx]
+	}
+
+	return path
+}
+
+// BoltToHttp2Response converts decoded bolt response headers to http2 response headers,
+// bolt response status is mapped to http status
+func BoltToHttp2Response(headers map[string]string) map[string]string {
+	status := RESPONSE_STATUS_UNKNOWN
+	if v, ok := headers[SofaPropertyHeader(HeaderRespStatus)]; ok {
+		if s, err := strconv.Atoi(v); err == nil {
+			status = int16(s)
+		}
+	}
+
+	for _, name := range boltProtocolHeaders {
+		delete(headers, SofaPropertyHeader(name))
+	}
+	delete(headers, types.HeaderStreamID)
+	delete(headers, HeaderRawHeaders)
+
+	headers[types.HeaderStatus] = strconv.Itoa(ResponseStatusToHttpStatus(status))
+
+	return headers
+}
+
+// BoltToHttp2Request converts decoded bolt request headers to http2 request headers, the request content
+// is sent as body. The request is posted to the path derived from class name, which is the inverse of PathToClassName
+func BoltToHttp2Request(headers map[string]string) map[string]string {
+	httpHeaders := make(map[string]string, len(headers))
+
+	for name, value := range headers {
+		httpHeaders[name] = value
+	}
+
+	for _, name := range boltProtocolHeaders {
+		delete(httpHeaders, SofaPropertyHeader(name))
+	}
+	delete(httpHeaders, types.HeaderStreamID)
+	delete(httpHeaders, HeaderRawHeaders)
+
+	httpHeaders[types.HeaderMethod] = http.MethodPost
+	httpHeaders[protocol.MosnHeaderPathKey] = "/" + headers[SofaPropertyHeader(HeaderClassName)]
+
+	return httpHeaders
+}
+
+// Http2ToBoltResponse converts decoded http2 response headers to bolt response headers of the request,
+// which are encoded as a BoltResponseCommand by bolt codec, the response body is sent as content.
+// http status is mapped to bolt response status
+func Http2ToBoltResponse(headers map[string]string, requestHeaders map[string]string) map[string]string {
+	boltHeaders := RequestFrameHeaders(requestHeaders)
+
+	for name, value := range headers {
+		if !http2SkippedHeaders[name] && name != types.HeaderStatus {
+			boltHeaders[name] = value
+		}
+	}
+
+	status := http.StatusOK
+	if v, ok := headers[types.HeaderStatus]; ok {
+		if s, err := strconv.Atoi(v); err == nil {
+			status = s
+		}
+	}
+
+	contentLen := headers[protocol.MosnHeaderContentLengthKey]
+	if contentLen == "" {
+		contentLen = "0"
+	}
+
+	boltHeaders[SofaPropertyHeader(HeaderCmdType)] = strconv.Itoa(int(RESPONSE))
+	boltHeaders[SofaPropertyHeader(HeaderCmdCode)] = strconv.Itoa(int(RPC_RESPONSE))
+	boltHeaders[SofaPropertyHeader(HeaderReqID)] = requestHeaders[SofaPropertyHeader(HeaderReqID)]
+	boltHeaders[SofaPropertyHeader(HeaderRespStatus)] = strconv.Itoa(int(HttpStatusToResponseStatus(status)))
+	// responses carry no class
+	boltHeaders[SofaPropertyHeader(HeaderClassLen)] = "0"
+	boltHeaders[SofaPropertyHeader(HeaderClassName)] = ""
+	// header length is calculated on encode
+	boltHeaders[SofaPropertyHeader(HeaderHeaderLen)] = "0"
+	boltHeaders[SofaPropertyHeader(HeaderContentLen)] = contentLen
+	boltHeaders[SofaPropertyHeader(HeaderRespTimeMills)] = "0"
+
+	return boltHeaders
+}
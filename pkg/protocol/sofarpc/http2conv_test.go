@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func TestPathToClassName(t *testing.T) {
+	cases := []struct {
+		path      string
+		prefix    string
+		className string
+	}{
+		{"/com.alipay.test.TestService/echo", "", "com.alipay.test.TestService"},
+		{"/rpc/com.alipay.test.TestService/echo", "/rpc", "com.alipay.test.TestService"},
+		{"/com.alipay.test.TestService", "", "com.alipay.test.TestService"},
+		{"/", "", ""},
+	}
+
+	for _, c := range cases {
+		if className := PathToClassName(c.path, c.prefix); className != c.className {
+			t.Errorf("path %s with prefix %s expected class name %s, but got %s", c.path, c.prefix, c.className, className)
+		}
+	}
+}
+
+func TestHttp2ToBoltRequest(t *testing.T) {
+	headers := map[string]string{
+		protocol.MosnHeaderPathKey:          "/com.alipay.test.TestService/echo",
+		protocol.MosnHeaderContentLengthKey: "5",
+		types.HeaderTryTimeout:              "1000",
+		"app":                               "test",
+		"internal":                          "secret",
+	}
+
+	boltHeaders := Http2ToBoltRequest(headers, &v2.BoltConvert{Headers: []string{"App"}})
+
+	if boltHeaders[HeaderClassName] != "com.alipay.test.TestService" {
+		t.Errorf("unexpected class name %s", boltHeaders[HeaderClassName])
+	}
+	if boltHeaders[HeaderClassLen] != strconv.Itoa(len("com.alipay.test.TestService")) {
+		t.Errorf("unexpected class length %s", boltHeaders[HeaderClassLen])
+	}
+	if boltHeaders[HeaderContentLen] != "5" || boltHeaders[HeaderTimeout] != "1000" {
+		t.Errorf("unexpected content length %s or timeout %s", boltHeaders[HeaderContentLen], boltHeaders[HeaderTimeout])
+	}
+	if !IsSofaRequest(boltHeaders) {
+		t.Errorf("converted headers should be a sofa request")
+	}
+	if boltHeaders[types.HeaderStreamID] != boltHeaders[HeaderReqID] {
+		t.Errorf("stream id %s should be request id %s", boltHeaders[types.HeaderStreamID], boltHeaders[HeaderReqID])
+	}
+	if boltHeaders["app"] != "test" || boltHeaders[types.HeaderTryTimeout] != "1000" {
+		t.Errorf("selected headers and proxy headers should be copied: %v", boltHeaders)
+	}
+	if _, ok := boltHeaders["internal"]; ok {
+		t.Errorf("headers not selected should not be copied")
+	}
+	if _, ok := boltHeaders[protocol.MosnHeaderPathKey]; ok {
+		t.Errorf("path header should not be copied")
+	}
+
+	// class name configured, all headers copied
+	boltHeaders = Http2ToBoltRequest(headers, &v2.BoltConvert{ClassName: "com.alipay.test.Configured"})
+	if boltHeaders[HeaderClassName] != "com.alipay.test.Configured" {
+		t.Errorf("unexpected class name %s", boltHeaders[HeaderClassName])
+	}
+	if boltHeaders["internal"] != "secret" {
+		t.Errorf("all headers should be copied if not selected")
+	}
+
+	// request id increases
+	id1, _ := strconv.Atoi(Http2ToBoltRequest(headers, nil)[HeaderReqID])
+	id2, _ := strconv.Atoi(Http2ToBoltRequest(headers, nil)[HeaderReqID])
+	if id2 != id1+1 {
+		t.Errorf("request id should increase, got %d, %d", id1, id2)
+	}
+}
+
+func TestBoltToHttp2Response(t *testing.T) {
+	cases := []struct {
+		status     int16
+		httpStatus int
+	}{
+		{RESPONSE_STATUS_SUCCESS, http.StatusOK},
+		{RESPONSE_STATUS_SERVER_EXCEPTION, http.StatusInternalServerError},
+		{RESPONSE_STATUS_NO_PROCESSOR, http.StatusNotFound},
+		{RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, http.StatusServiceUnavailable},
+		{RESPONSE_STATUS_TIMEOUT, http.StatusGatewayTimeout},
+		{RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION, http.StatusBadRequest},
+		{RESPONSE_STATUS_CONNECTION_CLOSED, http.StatusBadGateway},
+	}
+
+	for _, c := range cases {
+		headers := map[string]string{
+			HeaderProtocolCode:   "1",
+			HeaderReqID:          "1",
+			HeaderRespStatus:     strconv.Itoa(int(c.status)),
+			types.HeaderStreamID: "1",
+			"app":                "test",
+		}
+
+		headers = BoltToHttp2Response(headers)
+
+		if headers[types.HeaderStatus] != strconv.Itoa(c.httpStatus) {
+			t.Errorf("bolt status %d expected http status %d, but got %s", c.status, c.httpStatus, headers[types.HeaderStatus])
+		}
+		if len(headers) != 2 || headers["app"] != "test" {
+			t.Errorf("bolt protocol headers should be removed: %v", headers)
+		}
+	}
+}
+
+func TestBoltToHttp2Request(t *testing.T) {
+	headers := map[string]string{
+		HeaderProtocolCode:   "1",
+		HeaderCmdCode:        "1",
+		HeaderReqID:          "1",
+		HeaderClassName:      "com.alipay.test.TestService",
+		HeaderRawHeaders:     "raw",
+		types.HeaderStreamID: "1",
+		"service":            "com.alipay.test.TestService:1.0",
+	}
+
+	httpHeaders := BoltToHttp2Request(headers)
+
+	if httpHeaders[types.HeaderMethod] != http.MethodPost {
+		t.Errorf("unexpected method %s", httpHeaders[types.HeaderMethod])
+	}
+	if path := httpHeaders[protocol.MosnHeaderPathKey]; PathToClassName(path, "") != "com.alipay.test.TestService" {
+		t.Errorf("class name should be derived from path %s", path)
+	}
+	if len(httpHeaders) != 3 || httpHeaders["service"] != "com.alipay.test.TestService:1.0" {
+		t.Errorf("bolt protocol headers should be removed: %v", httpHeaders)
+	}
+	// origin request is kept for the response
+	if headers[HeaderReqID] != "1" {
+		t.Errorf("bolt request headers should not be changed: %v", headers)
+	}
+}
+
+func TestHttp2ToBoltResponse(t *testing.T) {
+	requestHeaders := map[string]string{
+		HeaderProtocolCode: "1",
+		HeaderCmdType:      "1",
+		HeaderCmdCode:      "1",
+		HeaderVersion:      "1",
+		HeaderReqID:        "7",
+		HeaderCodec:        "1",
+		HeaderClassName:    "com.alipay.test.TestService",
+	}
+	cases := []struct {
+		httpStatus int
+		status     int16
+	}{
+		{http.StatusOK, RESPONSE_STATUS_SUCCESS},
+		{http.StatusNotFound, RESPONSE_STATUS_NO_PROCESSOR},
+		{http.StatusServiceUnavailable, RESPONSE_STATUS_SERVER_THREADPOOL_BUSY},
+		{http.StatusGatewayTimeout, RESPONSE_STATUS_TIMEOUT},
+		{http.StatusBadGateway, RESPONSE_STATUS_ERROR_COMM},
+		{http.StatusInternalServerError, RESPONSE_STATUS_SERVER_EXCEPTION},
+	}
+
+	for _, c := range cases {
+		headers := map[string]string{
+			types.HeaderStatus:                  strconv.Itoa(c.httpStatus),
+			protocol.MosnHeaderContentLengthKey: "5",
+			"app":                               "test",
+		}
+
+		boltHeaders := Http2ToBoltResponse(headers, requestHeaders)
+
+		if boltHeaders[HeaderRespStatus] != strconv.Itoa(int(c.status)) {
+			t.Errorf("http status %d expected bolt status %d, but got %s", c.httpStatus, c.status, boltHeaders[HeaderRespStatus])
+		}
+		if boltHeaders[HeaderCmdType] != strconv.Itoa(int(RESPONSE)) || boltHeaders[HeaderCmdCode] != strconv.Itoa(int(RPC_RESPONSE)) {
+			t.Errorf("converted headers should be a bolt response: %v", boltHeaders)
+		}
+		if boltHeaders[HeaderReqID] != "7" || boltHeaders[HeaderProtocolCode] != "1" || boltHeaders[HeaderCodec] != "1" {
+			t.Errorf("request frame should be kept in response: %v", boltHeaders)
+		}
+		if boltHeaders[HeaderContentLen] != "5" || boltHeaders["app"] != "test" {
+			t.Errorf("unexpected content length or headers: %v", boltHeaders)
+		}
+		if _, ok := boltHeaders[types.HeaderStatus]; ok {
+			t.Errorf("http status should not be copied: %v", boltHeaders)
+		}
+	}
+}
@@ -19,7 +19,9 @@ package sofarpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/alipay/sofamosn/pkg/log"
 	"github.com/alipay/sofamosn/pkg/types"
@@ -71,6 +73,11 @@ func (p *protocols) EncodeHeaders(context context.Context, headers interface{})
 		return err, nil
 	}
 
+	// bolt v1 frames can't carry crc32, they're sent in bolt v2 to the clusters forcing crc
+	if protocolCode == PROTOCOL_CODE_V1 && ForceCrc(context) {
+		headers, protocolCode = upgradeToBoltV2(headers), PROTOCOL_CODE_V2
+	}
+
 	if proto, exists := p.protocolMaps[protocolCode]; exists {
 		//Return encoded data in map[string]string to stream layer
 		return proto.GetEncoder().EncodeHeaders(context, headers)
@@ -101,7 +108,19 @@ func (p *protocols) Decode(context context.Context, data types.IoBuffer, filter
 
 		if proto, exists := p.protocolMaps[protocolCode]; exists {
 			if read, cmd := proto.GetDecoder().Decode(context, data); cmd != nil {
-				if err := proto.GetCommandHandler().HandleCommand(context, cmd, filter); err != nil {
+				// decoder reports a broken frame, e.g. crc32 check failed
+				if err, ok := cmd.(error); ok {
+					filter.OnDecodeError(err, nil)
+					break
+				}
+
+				err := proto.GetCommandHandler().HandleCommand(context, cmd, filter)
+				// the command is handled, nothing refers to the buffers of the frame any more
+				if releaser, ok := proto.GetDecoder().(FrameBufferReleaser); ok {
+					releaser.ReleaseCommand(cmd)
+				}
+
+				if err != nil {
 					filter.OnDecodeError(err, nil)
 					break
 				}
@@ -112,24 +131,64 @@ func (p *protocols) Decode(context context.Context, data types.IoBuffer, filter
 				filter.OnDecodeError(errors.New(errMsg), nil)
 				break
 			} else {
+				// frame is incomplete, keep the buffer and wait for more data
 				break
 			}
 		} else {
 			errMsg := types.UnSupportedProCode
 			logger.Errorf(errMsg+"protocolCode = %s", protocolCode)
-			filter.OnDecodeError(errors.New(errMsg), nil)
+			filter.OnDecodeError(NewDecodeError(CodecName(protocolCode), ReasonUnknownProtocol, errMsg), nil)
 			break
 		}
 	}
 }
 
-func (p *protocols) RegisterProtocol(protocolCode byte, protocol Protocol) {
-	if _, exists := p.protocolMaps[protocolCode]; exists {
-		log.DefaultLogger.Warnf("protocol alreay Exist:", protocolCode)
-	} else {
-		p.protocolMaps[protocolCode] = protocol
-		log.StartLogger.Debugf("register protocol:%x", protocolCode)
+// DuplicateProtocolError is returned when registering a protocol on a code taken by another protocol
+type DuplicateProtocolError struct {
+	ProtocolCode byte
+	Registered   Protocol
+}
+
+func (e *DuplicateProtocolError) Error() string {
+	return fmt.Sprintf("protocol code %x is already registered by %T", e.ProtocolCode, e.Registered)
+}
+
+// RegisterProtocol registers the protocol on the code, the registered protocol is never replaced.
+// Registering the same protocol again is ignored, while another protocol on the code
+// gets a DuplicateProtocolError
+func (p *protocols) RegisterProtocol(protocolCode byte, protocol Protocol) error {
+	if registered, exists := p.protocolMaps[protocolCode]; exists {
+		if registered == protocol {
+			return nil
+		}
+
+		return &DuplicateProtocolError{ProtocolCode: protocolCode, Registered: registered}
 	}
+
+	p.protocolMaps[protocolCode] = protocol
+	log.StartLogger.Debugf("register protocol:%x", protocolCode)
+
+	return nil
+}
+
+// GetProtocol returns the protocol registered on the code, nil if not registered
+func (p *protocols) GetProtocol(protocolCode byte) Protocol {
+	return p.protocolMaps[protocolCode]
+}
+
+// ProtocolCodes returns the registered protocol codes in ascending order
+func (p *protocols) ProtocolCodes() []byte {
+	codes := make([]byte, 0, len(p.protocolMaps))
+
+	for code := range p.protocolMaps {
+		codes = append(codes, code)
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i] < codes[j]
+	})
+
+	return codes
 }
 
 func (p *protocols) UnRegisterProtocol(protocolCode byte) {
@@ -139,8 +198,86 @@ func (p *protocols) UnRegisterProtocol(protocolCode byte) {
 	}
 }
 
-func RegisterProtocol(protocolCode byte, protocol Protocol) {
-	defaultProtocols.RegisterProtocol(protocolCode, protocol)
+// CreateHeartbeatTrigger creates heartbeat trigger on the connection for protocol,
+// returns nil if the protocol does not support heartbeat trigger
+func CreateHeartbeatTrigger(context context.Context, protocolCode byte, connection types.Connection, nextRequestId func() uint32) HeartbeatTrigger {
+	if proto, exists := defaultProtocols.protocolMaps[protocolCode]; exists {
+		if factory, ok := proto.(HeartbeatTriggerFactory); ok {
+			return factory.CreateHeartbeatTrigger(context, connection, nextRequestId)
+		}
+	}
+
+	return nil
+}
+
+// EncodeFrameTrailer returns the trailer written after the encoded headers and data,
+// returns nil if the protocol of the headers has no frame trailer
+func EncodeFrameTrailer(context context.Context, headers types.IoBuffer, data types.IoBuffer) types.IoBuffer {
+	if headers == nil || headers.Len() == 0 {
+		return nil
+	}
+
+	if proto, exists := defaultProtocols.protocolMaps[headers.Bytes()[0]]; exists {
+		if encoder, ok := proto.GetEncoder().(FrameTrailerEncoder); ok {
+			return encoder.EncodeFrameTrailer(context, headers, data)
+		}
+	}
+
+	return nil
+}
+
+// EncodeContent returns the content written after the encoded headers, which may be changed by
+// the protocol of the headers, e.g. compressed
+func EncodeContent(context context.Context, headers types.IoBuffer, data types.IoBuffer) types.IoBuffer {
+	if headers == nil || headers.Len() == 0 || data == nil || data.Len() == 0 {
+		return data
+	}
+
+	if proto, exists := defaultProtocols.protocolMaps[headers.Bytes()[0]]; exists {
+		if encoder, ok := proto.GetEncoder().(ContentEncoder); ok {
+			return encoder.EncodeContent(context, headers, data)
+		}
+	}
+
+	return data
+}
+
+// ReleaseEncodedHeaders gives the encoded headers back to the protocol of the code once they are written,
+// the headers must not be used after that. The protocol code is passed as the headers are drained by the write
+func ReleaseEncodedHeaders(protocolCode byte, headers types.IoBuffer) {
+	if headers == nil {
+		return
+	}
+
+	if proto, exists := defaultProtocols.protocolMaps[protocolCode]; exists {
+		if releaser, ok := proto.GetEncoder().(FrameBufferReleaser); ok {
+			releaser.ReleaseHeaders(headers)
+		}
+	}
+}
+
+// RegisterProtocol registers the protocol on the code of the default protocols, see protocols.RegisterProtocol.
+// Protocols are expected to be registered in init()
+func RegisterProtocol(protocolCode byte, protocol Protocol) error {
+	return defaultProtocols.RegisterProtocol(protocolCode, protocol)
+}
+
+// MustRegisterProtocol is like RegisterProtocol but panics if the code is taken by another protocol,
+// so that colliding protocols are found on startup rather than decoding with the wrong codec
+func MustRegisterProtocol(protocolCode byte, protocol Protocol) {
+	if err := RegisterProtocol(protocolCode, protocol); err != nil {
+		panic(err)
+	}
+}
+
+// GetProtocol returns the protocol registered on the code of the default protocols, nil if not registered
+func GetProtocol(protocolCode byte) Protocol {
+	return defaultProtocols.GetProtocol(protocolCode)
+}
+
+// ProtocolCodes returns the protocol codes registered in the default protocols in ascending order
+func ProtocolCodes() []byte {
+	return defaultProtocols.ProtocolCodes()
 }
 
 func UnRegisterProtocol(protocolCode byte) {
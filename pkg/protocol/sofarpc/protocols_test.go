@@ -0,0 +1,110 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type testProtocol struct {
+	name string
+}
+
+func (p *testProtocol) GetEncoder() types.Encoder {
+	return nil
+}
+
+func (p *testProtocol) GetDecoder() types.Decoder {
+	return nil
+}
+
+func (p *testProtocol) GetCommandHandler() CommandHandler {
+	return nil
+}
+
+func TestRegisterProtocol(t *testing.T) {
+	p := NewProtocols(make(map[byte]Protocol)).(*protocols)
+	first := &testProtocol{name: "first"}
+	second := &testProtocol{name: "second"}
+
+	if err := p.RegisterProtocol(0x7e, first); err != nil {
+		t.Fatalf("register protocol failed: %v", err)
+	}
+	// registering the same protocol again is ignored
+	if err := p.RegisterProtocol(0x7e, first); err != nil {
+		t.Errorf("register the same protocol again expect no error, but got %v", err)
+	}
+
+	err := p.RegisterProtocol(0x7e, second)
+	dupErr, ok := err.(*DuplicateProtocolError)
+	if !ok {
+		t.Fatalf("register another protocol on the code expect DuplicateProtocolError, but got %v", err)
+	}
+	if dupErr.ProtocolCode != 0x7e || dupErr.Registered != first {
+		t.Errorf("unexpected duplicate protocol error: %+v", dupErr)
+	}
+	// the registered protocol is not replaced
+	if registered := p.GetProtocol(0x7e); registered != first {
+		t.Errorf("expect the first protocol kept, but got %+v", registered)
+	}
+}
+
+func TestGetProtocol(t *testing.T) {
+	p := NewProtocols(make(map[byte]Protocol)).(*protocols)
+	bolt := &testProtocol{name: "bolt"}
+	tr := &testProtocol{name: "tr"}
+	p.RegisterProtocol(PROTOCOL_CODE_TR, tr)
+	p.RegisterProtocol(PROTOCOL_CODE_V1, bolt)
+
+	if p.GetProtocol(PROTOCOL_CODE_V1) != bolt || p.GetProtocol(PROTOCOL_CODE_TR) != tr {
+		t.Errorf("get protocol returns unexpected protocols")
+	}
+	if p.GetProtocol(PROTOCOL_CODE_V2) != nil {
+		t.Errorf("get protocol not registered expect nil")
+	}
+	if codes := p.ProtocolCodes(); !bytes.Equal(codes, []byte{PROTOCOL_CODE_V1, PROTOCOL_CODE_TR}) {
+		t.Errorf("expect protocol codes in order, but got %v", codes)
+	}
+
+	p.UnRegisterProtocol(PROTOCOL_CODE_TR)
+	if codes := p.ProtocolCodes(); !bytes.Equal(codes, []byte{PROTOCOL_CODE_V1}) {
+		t.Errorf("expect protocol code unregistered, but got %v", codes)
+	}
+}
+
+func TestMustRegisterProtocol(t *testing.T) {
+	code := byte(0x7d)
+	protocol := &testProtocol{name: "must"}
+	MustRegisterProtocol(code, protocol)
+	defer UnRegisterProtocol(code)
+
+	// init() run again registers the same protocol
+	MustRegisterProtocol(code, protocol)
+	if GetProtocol(code) != protocol {
+		t.Errorf("expect protocol registered in default protocols")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("register another protocol on the code expect panic")
+		}
+	}()
+	MustRegisterProtocol(code, &testProtocol{name: "another"})
+}
@@ -0,0 +1,134 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"strings"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// well-known headers of sofa request, decoded into RequestContext
+const (
+	HeaderService        string = types.SofaRouteMatchKey
+	HeaderTargetService  string = "sofa_head_target_service"
+	HeaderMethodName     string = "sofa_head_method_name"
+	HeaderAppName        string = "app"
+	HeaderTargetApp      string = "sofa_head_target_app"
+	HeaderTargetInstance string = "sofa_head_target_instance"
+	HeaderTraceId        string = "rpc_trace_context.sofaTraceId"
+	HeaderRpcId          string = "rpc_trace_context.sofaRpcId"
+	HeaderCallerIp       string = "rpc_trace_context.sofaCallerIp"
+)
+
+// RequestContext is the sofa request headers decoded once when the request is received,
+// the headers not known are kept in the raw header map
+type RequestContext struct {
+	service          string
+	serviceInterface string
+	serviceVersion   string
+	method           string
+	className        string
+	appName          string
+	targetApp        string
+	targetInstance   string
+	traceId          string
+	rpcId            string
+	callerIp         string
+
+	headers map[string]string
+}
+
+// NewRequestContext decodes the well-known headers, the header map is referenced rather than copied
+func NewRequestContext(headers map[string]string) *RequestContext {
+	ctx := &RequestContext{
+		service:        headers[HeaderService],
+		method:         headers[HeaderMethodName],
+		className:      headers[SofaPropertyHeader(HeaderClassName)],
+		appName:        headers[HeaderAppName],
+		targetApp:      headers[HeaderTargetApp],
+		targetInstance: headers[HeaderTargetInstance],
+		traceId:        headers[HeaderTraceId],
+		rpcId:          headers[HeaderRpcId],
+		callerIp:       headers[HeaderCallerIp],
+		headers:        headers,
+	}
+
+	// service is set in the old key by the legacy clients
+	if ctx.service == "" {
+		ctx.service = headers[HeaderTargetService]
+	}
+
+	// unique name of the service is formatted as interface:version[:uniqueId]
+	parts := strings.SplitN(ctx.service, ":", 3)
+	ctx.serviceInterface = parts[0]
+	if len(parts) > 1 {
+		ctx.serviceVersion = parts[1]
+	}
+
+	return ctx
+}
+
+// Service returns the unique name of the service
+func (ctx *RequestContext) Service() string {
+	return ctx.service
+}
+
+func (ctx *RequestContext) ServiceInterface() string {
+	return ctx.serviceInterface
+}
+
+func (ctx *RequestContext) ServiceVersion() string {
+	return ctx.serviceVersion
+}
+
+func (ctx *RequestContext) Method() string {
+	return ctx.method
+}
+
+func (ctx *RequestContext) ClassName() string {
+	return ctx.className
+}
+
+func (ctx *RequestContext) AppName() string {
+	return ctx.appName
+}
+
+func (ctx *RequestContext) TargetApp() string {
+	return ctx.targetApp
+}
+
+func (ctx *RequestContext) TargetInstance() string {
+	return ctx.targetInstance
+}
+
+func (ctx *RequestContext) TraceId() string {
+	return ctx.traceId
+}
+
+func (ctx *RequestContext) RpcId() string {
+	return ctx.rpcId
+}
+
+func (ctx *RequestContext) CallerIp() string {
+	return ctx.callerIp
+}
+
+// Headers returns the raw header map, including the headers not known
+func (ctx *RequestContext) Headers() map[string]string {
+	return ctx.headers
+}
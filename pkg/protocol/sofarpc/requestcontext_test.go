@@ -0,0 +1,85 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import "testing"
+
+func TestRequestContextKnownHeaders(t *testing.T) {
+	headers := map[string]string{
+		HeaderService:                       "com.alipay.test.TestService:1.0:unique",
+		HeaderMethodName:                    "echo",
+		SofaPropertyHeader(HeaderClassName): "com.alipay.sofa.rpc.core.request.SofaRequest",
+		HeaderAppName:                       "caller",
+		HeaderTargetApp:                     "callee",
+		HeaderTargetInstance:                "10.1.1.1:12200",
+		HeaderTraceId:                       "0a0fe8ec1537171223051100196",
+		HeaderRpcId:                         "0.1",
+		HeaderCallerIp:                      "10.1.1.2",
+		"zone":                              "gz00a",
+	}
+
+	ctx := NewRequestContext(headers)
+
+	cases := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"Service", ctx.Service(), "com.alipay.test.TestService:1.0:unique"},
+		{"ServiceInterface", ctx.ServiceInterface(), "com.alipay.test.TestService"},
+		{"ServiceVersion", ctx.ServiceVersion(), "1.0"},
+		{"Method", ctx.Method(), "echo"},
+		{"ClassName", ctx.ClassName(), "com.alipay.sofa.rpc.core.request.SofaRequest"},
+		{"AppName", ctx.AppName(), "caller"},
+		{"TargetApp", ctx.TargetApp(), "callee"},
+		{"TargetInstance", ctx.TargetInstance(), "10.1.1.1:12200"},
+		{"TraceId", ctx.TraceId(), "0a0fe8ec1537171223051100196"},
+		{"RpcId", ctx.RpcId(), "0.1"},
+		{"CallerIp", ctx.CallerIp(), "10.1.1.2"},
+	}
+	for _, c := range cases {
+		if c.got != c.expected {
+			t.Errorf("%s expected %q, got %q", c.name, c.expected, c.got)
+		}
+	}
+
+	if v, ok := ctx.Headers()["zone"]; !ok || v != "gz00a" {
+		t.Errorf("unknown header should be kept in raw headers, got %q", v)
+	}
+	if len(ctx.Headers()) != len(headers) {
+		t.Errorf("raw headers expected %d entries, got %d", len(headers), len(ctx.Headers()))
+	}
+}
+
+func TestRequestContextLegacyService(t *testing.T) {
+	ctx := NewRequestContext(map[string]string{
+		HeaderTargetService: "com.alipay.test.TestService:2.0",
+	})
+
+	if ctx.Service() != "com.alipay.test.TestService:2.0" {
+		t.Errorf("service should be read from the old key, got %q", ctx.Service())
+	}
+	if ctx.ServiceVersion() != "2.0" {
+		t.Errorf("expected version 2.0, got %q", ctx.ServiceVersion())
+	}
+
+	// no version in the unique name
+	ctx = NewRequestContext(map[string]string{HeaderService: "com.alipay.test.TestService"})
+	if ctx.ServiceInterface() != "com.alipay.test.TestService" || ctx.ServiceVersion() != "" {
+		t.Errorf("unexpected interface %q version %q", ctx.ServiceInterface(), ctx.ServiceVersion())
+	}
+}
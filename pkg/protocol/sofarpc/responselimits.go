@@ -0,0 +1,60 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"context"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// ResponseTooLargeError is returned by the decoder on a response exceeding the response limits of the
+// cluster. Only the header of the frame is read, the rest FrameLen bytes of the frame are skipped
+// by the connection rather than buffered, and the request of the response is failed.
+type ResponseTooLargeError struct {
+	CodecError
+	RequestId uint32
+	// length of the frame excluding the header read
+	FrameLen int
+}
+
+// CheckResponseLimits returns a ResponseTooLargeError if the response exceeds the limits of the connection,
+// which are set by the connection pool of the cluster limiting response size
+func CheckResponseLimits(context context.Context, codec string, requestId uint32, headerLen uint16, contentLen uint32, frameLen int) error {
+	if context == nil {
+		return nil
+	}
+
+	limits, ok := context.Value(types.ContextKeyBoltResponseLimits).(v2.ResponseLimits)
+	if !ok {
+		return nil
+	}
+
+	if (limits.MaxHeaderLen > 0 && int(headerLen) > limits.MaxHeaderLen) ||
+		(limits.MaxContentLen > 0 && int64(contentLen) > int64(limits.MaxContentLen)) {
+		err := NewDecodeError(codec, ReasonLargeResponse, ResponseTooLarge).(*CodecError)
+
+		return &ResponseTooLargeError{
+			CodecError: *err,
+			RequestId:  requestId,
+			FrameLen:   frameLen,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"net/http"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// ResponseErrorType is the normalized category of a bolt response status
+type ResponseErrorType int
+
+const (
+	ResponseErrorNone ResponseErrorType = iota
+	ResponseErrorServer
+	ResponseErrorServerBusy
+	ResponseErrorTimeout
+	ResponseErrorCodec
+	ResponseErrorSerialize
+	ResponseErrorConnection
+	ResponseErrorClient
+	ResponseErrorUnknown
+)
+
+// ResponseErrorTypes lists all categories, used to register metrics
+var ResponseErrorTypes = []ResponseErrorType{
+	ResponseErrorNone,
+	ResponseErrorServer,
+	ResponseErrorServerBusy,
+	ResponseErrorTimeout,
+	ResponseErrorCodec,
+	ResponseErrorSerialize,
+	ResponseErrorConnection,
+	ResponseErrorClient,
+	ResponseErrorUnknown,
+}
+
+func (t ResponseErrorType) String() string {
+	switch t {
+	case ResponseErrorNone:
+		return "none"
+	case ResponseErrorServer:
+		return "server_error"
+	case ResponseErrorServerBusy:
+		return "server_busy"
+	case ResponseErrorTimeout:
+		return "timeout"
+	case ResponseErrorCodec:
+		return "codec_error"
+	case ResponseErrorSerialize:
+		return "serialize_error"
+	case ResponseErrorConnection:
+		return "connection_error"
+	case ResponseErrorClient:
+		return "client_error"
+	default:
+		return "unknown"
+	}
+}
+
+// ResponseError is the classified result of a bolt response status
+type ResponseError struct {
+	Type ResponseErrorType
+	// Retriable means the request is safe to be sent to another host
+	Retriable bool
+}
+
+// ResponseStatusToError classifies a bolt response status
+func ResponseStatusToError(status int16) ResponseError {
+	switch status {
+	case RESPONSE_STATUS_SUCCESS:
+		return ResponseError{Type: ResponseErrorNone}
+	case RESPONSE_STATUS_ERROR, RESPONSE_STATUS_SERVER_EXCEPTION:
+		return ResponseError{Type: ResponseErrorServer}
+	case RESPONSE_STATUS_NO_PROCESSOR:
+		// request is not processed by server, safe to retry
+		return ResponseError{Type: ResponseErrorServer, Retriable: true}
+	case RESPONSE_STATUS_SERVER_THREADPOOL_BUSY:
+		return ResponseError{Type: ResponseErrorServerBusy, Retriable: true}
+	case RESPONSE_STATUS_TIMEOUT:
+		return ResponseError{Type: ResponseErrorTimeout}
+	case RESPONSE_STATUS_CODEC_EXCEPTION:
+		return ResponseError{Type: ResponseErrorCodec}
+	case RESPONSE_STATUS_SERVER_SERIAL_EXCEPTION, RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION:
+		return ResponseError{Type: ResponseErrorSerialize}
+	case RESPONSE_STATUS_ERROR_COMM, RESPONSE_STATUS_CONNECTION_CLOSED:
+		return ResponseError{Type: ResponseErrorConnection, Retriable: true}
+	case RESPONSE_STATUS_CLIENT_SEND_ERROR:
+		return ResponseError{Type: ResponseErrorClient, Retriable: true}
+	case RESPONSE_STATUS_UNKNOWN:
+		return ResponseError{Type: ResponseErrorUnknown}
+	default:
+		return ResponseError{Type: ResponseErrorUnknown}
+	}
+}
+
+// ResponseStatusToHttpStatus maps a bolt response status to http status, used in protocol conversion
+func ResponseStatusToHttpStatus(status int16) int {
+	switch status {
+	case RESPONSE_STATUS_SUCCESS:
+		return http.StatusOK
+	case RESPONSE_STATUS_NO_PROCESSOR:
+		return http.StatusNotFound
+	case RESPONSE_STATUS_SERVER_THREADPOOL_BUSY:
+		return http.StatusServiceUnavailable
+	case RESPONSE_STATUS_TIMEOUT:
+		return http.StatusGatewayTimeout
+	case RESPONSE_STATUS_CODEC_EXCEPTION, RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION:
+		return http.StatusBadRequest
+	case RESPONSE_STATUS_ERROR_COMM, RESPONSE_STATUS_CONNECTION_CLOSED, RESPONSE_STATUS_CLIENT_SEND_ERROR:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HttpStatusToResponseStatus maps a http status to bolt response status, used in protocol conversion
+func HttpStatusToResponseStatus(status int) int16 {
+	switch {
+	case status >= http.StatusOK && status < http.StatusMultipleChoices:
+		return RESPONSE_STATUS_SUCCESS
+	case status == http.StatusNotFound:
+		return RESPONSE_STATUS_NO_PROCESSOR
+	case status == http.StatusServiceUnavailable, status == http.StatusTooManyRequests:
+		return RESPONSE_STATUS_SERVER_THREADPOOL_BUSY
+	case status == http.StatusGatewayTimeout, status == http.StatusRequestTimeout:
+		return RESPONSE_STATUS_TIMEOUT
+	case status == http.StatusBadRequest:
+		return RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION
+	case status == http.StatusBadGateway:
+		return RESPONSE_STATUS_ERROR_COMM
+	default:
+		return RESPONSE_STATUS_SERVER_EXCEPTION
+	}
+}
+
+// HijackResponseStatus maps the status code of the response replied by mosn itself, e.g. on no route
+// or rejected by filter, to a bolt response status
+func HijackResponseStatus(code int) int16 {
+	switch code {
+	case types.RouterUnavailableCode:
+		return RESPONSE_STATUS_NO_PROCESSOR
+	case types.NoHealthUpstreamCode, types.UpstreamOverFlowCode:
+		return RESPONSE_STATUS_CLIENT_SEND_ERROR
+	case types.RateLimitedCode:
+		return RESPONSE_STATUS_SERVER_THREADPOOL_BUSY
+	case types.PermissionDeniedCode, types.PayloadTooLargeCode:
+		return RESPONSE_STATUS_SERVER_EXCEPTION
+	case types.TimeoutExceptionCode:
+		return RESPONSE_STATUS_TIMEOUT
+	case types.CodecExceptionCode:
+		return RESPONSE_STATUS_CODEC_EXCEPTION
+	case types.DeserialExceptionCode:
+		return RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION
+	default:
+		return RESPONSE_STATUS_UNKNOWN
+	}
+}
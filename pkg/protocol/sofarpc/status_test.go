@@ -0,0 +1,149 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func TestResponseStatusToError(t *testing.T) {
+	cases := []struct {
+		status    int16
+		errType   ResponseErrorType
+		retriable bool
+	}{
+		{RESPONSE_STATUS_SUCCESS, ResponseErrorNone, false},
+		{RESPONSE_STATUS_ERROR, ResponseErrorServer, false},
+		{RESPONSE_STATUS_SERVER_EXCEPTION, ResponseErrorServer, false},
+		{RESPONSE_STATUS_UNKNOWN, ResponseErrorUnknown, false},
+		{RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, ResponseErrorServerBusy, true},
+		{RESPONSE_STATUS_ERROR_COMM, ResponseErrorConnection, true},
+		{RESPONSE_STATUS_NO_PROCESSOR, ResponseErrorServer, true},
+		{RESPONSE_STATUS_TIMEOUT, ResponseErrorTimeout, false},
+		{RESPONSE_STATUS_CLIENT_SEND_ERROR, ResponseErrorClient, true},
+		{RESPONSE_STATUS_CODEC_EXCEPTION, ResponseErrorCodec, false},
+		{RESPONSE_STATUS_CONNECTION_CLOSED, ResponseErrorConnection, true},
+		{RESPONSE_STATUS_SERVER_SERIAL_EXCEPTION, ResponseErrorSerialize, false},
+		{RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION, ResponseErrorSerialize, false},
+		// not defined by bolt
+		{100, ResponseErrorUnknown, false},
+	}
+
+	for _, c := range cases {
+		respErr := ResponseStatusToError(c.status)
+
+		if respErr.Type != c.errType {
+			t.Errorf("status %d expected type %s, but got %s", c.status, c.errType, respErr.Type)
+		}
+
+		if respErr.Retriable != c.retriable {
+			t.Errorf("status %d expected retriable %v, but got %v", c.status, c.retriable, respErr.Retriable)
+		}
+	}
+}
+
+func TestResponseErrorTypeString(t *testing.T) {
+	names := make(map[string]bool)
+
+	for _, errType := range ResponseErrorTypes {
+		name := errType.String()
+
+		if names[name] {
+			t.Errorf("duplicated name %s", name)
+		}
+
+		names[name] = true
+	}
+}
+
+func TestHijackResponseStatus(t *testing.T) {
+	cases := []struct {
+		code   int
+		status int16
+	}{
+		{types.RouterUnavailableCode, RESPONSE_STATUS_NO_PROCESSOR},
+		{types.NoHealthUpstreamCode, RESPONSE_STATUS_CLIENT_SEND_ERROR},
+		{types.UpstreamOverFlowCode, RESPONSE_STATUS_CLIENT_SEND_ERROR},
+		{types.RateLimitedCode, RESPONSE_STATUS_SERVER_THREADPOOL_BUSY},
+		{types.PermissionDeniedCode, RESPONSE_STATUS_SERVER_EXCEPTION},
+		{types.TimeoutExceptionCode, RESPONSE_STATUS_TIMEOUT},
+		{types.CodecExceptionCode, RESPONSE_STATUS_CODEC_EXCEPTION},
+		{types.DeserialExceptionCode, RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION},
+		{types.UnknownCode, RESPONSE_STATUS_UNKNOWN},
+	}
+
+	for _, c := range cases {
+		if status := HijackResponseStatus(c.code); status != c.status {
+			t.Errorf("code %d expected status %d, but got %d", c.code, c.status, status)
+		}
+	}
+}
+
+func TestBuildErrorResponse(t *testing.T) {
+	headers := map[string]string{
+		SofaPropertyHeader(HeaderProtocolCode): strconv.Itoa(int(PROTOCOL_CODE_V2)),
+		SofaPropertyHeader(HeaderReqID):        "11",
+		SofaPropertyHeader(HeaderVersion):      "1",
+		SofaPropertyHeader(HeaderCodec):        strconv.Itoa(int(PROTOBUF_SERIALIZE)),
+		SofaPropertyHeader(HeaderVersion1):     "2",
+		SofaPropertyHeader(HeaderSwitchCode):   strconv.Itoa(int(SWITCH_CRC_ON)),
+	}
+
+	resp, err := BuildErrorResponse(nil, headers, types.RateLimitedCode)
+	v2, ok := resp.(*BoltV2ResponseCommand)
+	if err != nil || !ok {
+		t.Fatalf("expect bolt v2 response, got %+v, error %v", resp, err)
+	}
+	if v2.ReqId != 11 || v2.Version != 1 || v2.CodecPro != PROTOBUF_SERIALIZE ||
+		v2.Version1 != 2 || v2.SwitchCode != SWITCH_CRC_ON {
+		t.Errorf("response should keep the frame of request, got %+v", v2)
+	}
+	if v2.ResponseStatus != RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("expect status %d, but got %d", RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, v2.ResponseStatus)
+	}
+
+	// status set by filter takes precedence
+	headers[SofaPropertyHeader(HeaderProtocolCode)] = strconv.Itoa(int(PROTOCOL_CODE_V1))
+	headers[SofaPropertyHeader(HeaderRespStatus)] = strconv.Itoa(int(RESPONSE_STATUS_SERVER_EXCEPTION))
+	resp, _ = BuildErrorResponse(nil, headers, types.RateLimitedCode)
+	if v1, ok := resp.(*BoltResponseCommand); !ok || v1.ResponseStatus != RESPONSE_STATUS_SERVER_EXCEPTION || v1.ReqId != 11 {
+		t.Errorf("unexpected bolt v1 response: %+v", resp)
+	}
+
+	// request id is required
+	delete(headers, SofaPropertyHeader(HeaderReqID))
+	if _, err := BuildErrorResponse(nil, headers, types.RateLimitedCode); err == nil {
+		t.Errorf("expect error without request id")
+	}
+}
+
+func TestRequestFrameHeaders(t *testing.T) {
+	headers := map[string]string{
+		SofaPropertyHeader(HeaderProtocolCode): "1",
+		SofaPropertyHeader(HeaderCodec):        "1",
+		SofaPropertyHeader(HeaderReqID):        "1",
+		SofaPropertyHeader(HeaderClassName):    "com.alipay.test.TestService",
+	}
+
+	frame := RequestFrameHeaders(headers)
+	if len(frame) != 2 || frame[SofaPropertyHeader(HeaderProtocolCode)] != "1" || frame[SofaPropertyHeader(HeaderCodec)] != "1" {
+		t.Errorf("unexpected frame headers: %v", frame)
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
@@ -62,6 +63,14 @@ const (
 	UnKnownCmdcode     string = "Unknown cmd code"
 	NoReqIdFound       string = "No request Id found in header"
 	UnKnownCmd         string = "Unknown Command"
+	InvalidCrc32       string = "CRC32 check failed for the frame"
+	InvalidCompression string = "Decompress content failed"
+	FrameTooLarge      string = "Declared length of the frame exceeds the limit"
+	UnKnownCodec       string = "Unknown codec of the frame"
+	ShortFrame         string = "Connection closed before the frame is complete"
+	SlowFrame          string = "Frame is not complete within the receive timeout"
+	PendingOverflow    string = "Incomplete frames exceed the pending bytes limit"
+	ResponseTooLarge   string = "Declared length of the response exceeds the limit of the cluster"
 )
 
 type ProtocolType byte
@@ -89,6 +98,29 @@ const (
 	LESS_LEN_V1 int = RESPONSE_HEADER_LEN_V1
 	LESS_LEN_V2 int = RESPONSE_HEADER_LEN_V2
 
+	//crc32 appended to the frame, exists when ver1 > 1 and crc switch is on
+	CRC32_LEN     int        = 4
+	SWITCH_CRC_ON SwitchCode = 0x01
+
+	// compression algorithm accepted by the sender, content compressed by the algorithm
+	// is flagged with SWITCH_COMPRESSED
+	SWITCH_GZIP_ON    SwitchCode = 0x02
+	SWITCH_DEFLATE_ON SwitchCode = 0x04
+	SWITCH_COMPRESSED SwitchCode = 0x08
+
+	SWITCH_COMPRESSION_MASK = SWITCH_GZIP_ON | SWITCH_DEFLATE_ON | SWITCH_COMPRESSED
+
+	// content not longer than the threshold is not compressed
+	DefaultCompressionThreshold int = 4 * 1024
+
+	// default limits of the declared lengths in frames
+	DefaultMaxClassLen   int = 4 * 1024
+	DefaultMaxHeaderLen  int = 32 * 1024
+	DefaultMaxContentLen int = 64 * 1024 * 1024
+
+	// frame buffers larger than this are not kept in the pool
+	DefaultMaxRetainedBufferSize int = 64 * 1024
+
 	RESPONSE       byte = 0
 	REQUEST        byte = 1
 	REQUEST_ONEWAY byte = 2
@@ -129,14 +161,6 @@ type Protocol interface {
 	 */
 	GetDecoder() types.Decoder
 
-	/**
-	 * Get the heartbeat trigger for the protocol.
-	 *
-	 * @return
-	 */
-	//TODO
-	//GetHeartbeatTrigger() HeartbeatTrigger
-
 	/**
 	 * Get the command handler for the protocol.
 	 *
@@ -157,14 +181,63 @@ type Protocols interface {
 
 	GetProtocol(protocolCode byte) Protocol
 
-	RegisterProtocol(protocolCode byte, protocol Protocol)
+	RegisterProtocol(protocolCode byte, protocol Protocol) error
 
 	UnRegisterProtocol(protocolCode byte)
 }
 
-//TODO
+// HeartbeatTrigger sends heartbeats on an idle connection periodically, and closes
+// the connection if too many heartbeats are not acked
 type HeartbeatTrigger interface {
-	HeartbeatTriggered()
+	// Trigger sends a heartbeat with the request id
+	Trigger(requestId uint32)
+
+	// OnHeartbeatAck is called when ack of the heartbeat with the request id is received
+	OnHeartbeatAck(requestId uint32)
+
+	// OnActive is called on reads and writes of the connection other than heartbeats,
+	// heartbeats are only sent after the connection is idle for the interval
+	OnActive()
+
+	Start()
+
+	Stop()
+}
+
+// HeartbeatTriggerFactory is implemented by protocols that support heartbeat trigger,
+// returns nil if heartbeat is disabled. Request ids of heartbeats are taken from nextRequestId,
+// so that they don't collide with the streams on the connection
+type HeartbeatTriggerFactory interface {
+	CreateHeartbeatTrigger(context context.Context, connection types.Connection, nextRequestId func() uint32) HeartbeatTrigger
+}
+
+// FrameTrailerEncoder is implemented by encoders whose frame ends with a trailer covering the content,
+// e.g. the crc32 of bolt v2, as the content is encoded apart from the headers by stream
+type FrameTrailerEncoder interface {
+	// returns nil if the frame has no trailer, or the trailer is encoded with the headers
+	EncodeFrameTrailer(context context.Context, headers types.IoBuffer, data types.IoBuffer) types.IoBuffer
+}
+
+// ContentEncoder is implemented by encoders that transform the content written by stream, e.g. compression,
+// the encoded headers are updated in place to describe the encoded content
+type ContentEncoder interface {
+	// returns the data itself if the content is not changed
+	EncodeContent(context context.Context, headers types.IoBuffer, data types.IoBuffer) types.IoBuffer
+}
+
+// FrameBufferReleaser is implemented by codecs taking frame buffers from a pool, the buffers are
+// given back once the frame is done with, and must not be referenced after that
+type FrameBufferReleaser interface {
+	// releases the buffers of the decoded command, called once the command is handled
+	ReleaseCommand(cmd interface{})
+	// releases the encoded headers, called once they are written to the connection
+	ReleaseHeaders(headers types.IoBuffer)
+}
+
+// ResponseBuilder is implemented by protocols registered outside this package,
+// builds the response sent by mosn itself, e.g. no upstream available
+type ResponseBuilder interface {
+	BuildResponse(context context.Context, headers map[string]string, respStatus int16) (interface{}, error)
 }
 
 //TODO
@@ -229,16 +302,44 @@ type BoltResponseCommand struct {
 	ResponseHeader     map[string]string
 }
 
+// SwitchCode is the function switch of bolt v2, each bit enables a feature of the frame,
+// unknown bits are kept as is
+type SwitchCode byte
+
+func (s SwitchCode) Has(flags SwitchCode) bool {
+	return s&flags == flags
+}
+
+func (s SwitchCode) Set(flags SwitchCode) SwitchCode {
+	return s | flags
+}
+
+func (s SwitchCode) Clear(flags SwitchCode) SwitchCode {
+	return s &^ flags
+}
+
+// Compression of the content negotiated by switch code
+type Compression struct {
+	Algorithm SwitchCode // SWITCH_GZIP_ON or SWITCH_DEFLATE_ON
+	Threshold int
+}
+
 type BoltV2RequestCommand struct {
 	BoltRequestCommand
 	Version1   byte //00
-	SwitchCode byte
+	SwitchCode SwitchCode
+	// compression accepted by the peer, compression bits are removed from switch code on decode,
+	// and the content is decompressed
+	Compression SwitchCode
 }
 
 type BoltV2ResponseCommand struct {
 	BoltResponseCommand
-	Version1   byte //00
-	SwitchCode byte
+	Version1    byte //00
+	SwitchCode  SwitchCode
+	Compression SwitchCode
+	// content length on the wire, ContentLen is the length after decompressed
+	WireContentLen int
 }
 
 func (b *BoltRequestCommand) GetProtocol() byte {
@@ -253,6 +354,18 @@ func (b *BoltRequestCommand) GetReqId() uint32 {
 	return b.ReqId
 }
 
+// GetServiceName returns the decoded className, which is the interface name of the service
+func (b *BoltRequestCommand) GetServiceName() string {
+	if len(b.ClassName) == 0 {
+		return ""
+	}
+
+	var className string
+	serialize.GetSerialization(b.CodecPro).DeSerialize(b.ClassName, &className)
+
+	return className
+}
+
 func (b *BoltResponseCommand) GetProtocol() byte {
 	return b.Protocol
 }
@@ -267,6 +380,9 @@ func (b *BoltResponseCommand) GetReqId() uint32 {
 
 const (
 	SofaRpcPropertyHeaderPrefix = "x-mosn-sofarpc-headers-property-"
+	// bolt header entries not fit for the header map, e.g. keys colliding with the property headers,
+	// kept serialized and re-emitted unchanged on encode
+	HeaderRawHeaders = "x-mosn-sofarpc-raw-headers"
 )
 
 //tr constants
@@ -278,6 +394,7 @@ const (
 	JAVA_SERIALIZE         byte   = 2
 	TOP_SERIALIZE          byte   = 3
 	HESSIAN2_SERIALIZE     byte   = 4
+	PROTOBUF_SERIALIZE     byte   = 11
 	HEADER_ONEWAY          byte   = 1
 	HEADER_TWOWAY          byte   = 2
 	TR_REQUEST             int16  = 13
@@ -288,6 +405,18 @@ const (
 	TR_HEARTBEART_CLASS    string = "com.taobao.remoting.impl.ConnectionHeartBeat"
 )
 
+//dubbo constants, the codec is registered by protocol/dubbo
+const (
+	PROTOCOL_CODE_DUBBO byte = 0xda
+)
+
+//thrift constants, the codec is registered by protocol/thrift
+const (
+	// thrift framed transport leads with the frame length in big endian, the first byte is 0
+	// for frames smaller than 16MB
+	PROTOCOL_CODE_THRIFT byte = 0
+)
+
 /**
  *   Header(1B): 报文版本
  *   Header(1B): 请求/响应
@@ -394,21 +523,22 @@ func BuildSofaRespMsg(context context.Context, headers map[string]string, respSt
 			ResponseStatus: respStatus,
 		}, nil
 	} else if pro == PROTOCOL_CODE_V2 {
-		var ver1, switchCode byte
+		var ver1 byte
+		var switchCode SwitchCode
 
-		if v, ok := headers[SofaPropertyHeader("ver1")]; ok {
+		if v, ok := headers[SofaPropertyHeader(HeaderVersion1)]; ok {
 			ver, _ := strconv.Atoi(v)
 			ver1 = byte(ver)
 		}
 
-		if s, ok := headers[SofaPropertyHeader("switchcode")]; ok {
+		if s, ok := headers[SofaPropertyHeader(HeaderSwitchCode)]; ok {
 			sw, _ := strconv.Atoi(s)
-			switchCode = byte(sw)
+			switchCode = SwitchCode(sw)
 		}
 
 		return &BoltV2ResponseCommand{
 			BoltResponseCommand: BoltResponseCommand{
-				Protocol:       PROTOCOL_CODE_V1,
+				Protocol:       PROTOCOL_CODE_V2,
 				CmdType:        RESPONSE,
 				CmdCode:        RPC_RESPONSE,
 				Version:        version,
@@ -421,12 +551,44 @@ func BuildSofaRespMsg(context context.Context, headers map[string]string, respSt
 		}, nil
 	} else if pro == PROTOCOL_CODE_TR {
 		return headers, nil
+	} else if builder, ok := defaultProtocols.protocolMaps[pro].(ResponseBuilder); ok {
+		return builder.BuildResponse(context, headers, respStatus)
 	} else {
 		log.ByContext(context).Errorf("[BuildSofaRespMsg Error]Unknown Protocol Code")
 		return headers, errors.New(types.UnSupportedProCode)
 	}
 }
 
+// requestFrameHeaders are the headers describing the frame of request, kept by the response
+var requestFrameHeaders = []string{HeaderProtocolCode, HeaderVersion, HeaderCodec, HeaderVersion1, HeaderSwitchCode}
+
+// RequestFrameHeaders returns the protocol, version and codec headers of request
+func RequestFrameHeaders(headers map[string]string) map[string]string {
+	frame := make(map[string]string, len(requestFrameHeaders))
+
+	for _, name := range requestFrameHeaders {
+		if v, ok := headers[SofaPropertyHeader(name)]; ok {
+			frame[SofaPropertyHeader(name)] = v
+		}
+	}
+
+	return frame
+}
+
+// BuildErrorResponse builds the response replied by mosn itself with the status code, e.g. on no healthy
+// upstream or rejected by filter, the bolt response status in headers set by filter takes precedence.
+// The response keeps the request id, protocol, version and codec of the request in headers
+func BuildErrorResponse(context context.Context, headers map[string]string, code int) (interface{}, error) {
+	respStatus := HijackResponseStatus(code)
+	if v, ok := headers[SofaPropertyHeader(HeaderRespStatus)]; ok {
+		if status, err := strconv.Atoi(v); err == nil {
+			respStatus = int16(status)
+		}
+	}
+
+	return BuildSofaRespMsg(context, headers, respStatus)
+}
+
 // Sofa Rpc Default HC Parameters
 const (
 	SofaRpc                             = "SofaRpc"
@@ -21,6 +21,18 @@ import (
 	"time"
 )
 
+// codec used by heartbeats mosn sends, hessian by default
+var defaultHeartbeatCodec = HESSIAN_SERIALIZE
+
+// SetDefaultHeartbeatCodec sets the codec of heartbeats mosn sends, should be called before mosn starts
+func SetDefaultHeartbeatCodec(codec byte) {
+	defaultHeartbeatCodec = codec
+}
+
+func DefaultHeartbeatCodec() byte {
+	return defaultHeartbeatCodec
+}
+
 func GenerateExceptionStreamID(reason string) string {
 	return "exception-" + reason + "-" + time.Now().String()
 }
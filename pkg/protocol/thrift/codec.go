@@ -0,0 +1,328 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package thrift
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+var (
+	ThriftPropertyHeaders = make(map[string]reflect.Kind, 7)
+
+	errMalformedMessage = errors.New("malformed thrift message header")
+)
+
+func init() {
+	ThriftPropertyHeaders[sofarpc.HeaderProtocolCode] = reflect.Uint8
+	ThriftPropertyHeaders[sofarpc.HeaderCmdType] = reflect.Uint8
+	ThriftPropertyHeaders[sofarpc.HeaderCmdCode] = reflect.Int16
+	ThriftPropertyHeaders[sofarpc.HeaderReqID] = reflect.Uint32
+	ThriftPropertyHeaders[sofarpc.HeaderCodec] = reflect.Uint8
+	ThriftPropertyHeaders[sofarpc.HeaderContentLen] = reflect.Int
+	ThriftPropertyHeaders[HeaderMessageType] = reflect.Uint8
+}
+
+// types.Encoder & types.Decoder
+type thriftCodec struct{}
+
+func (c *thriftCodec) EncodeHeaders(context context.Context, headers interface{}) (error, types.IoBuffer) {
+	if headerMap, ok := headers.(map[string]string); ok {
+		cmd := c.mapToCmd(headerMap)
+		return c.encodeHeaders(context, cmd)
+	}
+
+	return c.encodeHeaders(context, headers)
+}
+
+func (c *thriftCodec) encodeHeaders(context context.Context, headers interface{}) (error, types.IoBuffer) {
+	var data []byte
+	var err error
+
+	switch cmd := headers.(type) {
+	case *ThriftRequestCommand:
+		data, err = c.doEncode(cmd.Protocol, cmd.MessageType, cmd.Name, cmd.SeqId, cmd.BodyLen, cmd.Body)
+	case *ThriftResponseCommand:
+		data, err = c.doEncode(cmd.Protocol, cmd.MessageType, cmd.Name, cmd.SeqId, cmd.BodyLen, cmd.Body)
+	default:
+		err = errors.New(sofarpc.InvalidCommandType)
+	}
+
+	if err != nil {
+		log.ByContext(context).Errorf("thrift encode failed: %v", err)
+		return err, nil
+	}
+
+	return nil, buffer.NewIoBufferBytes(data)
+}
+
+// doEncode encodes the frame length and the message header, body is appended if it is carried
+// by the command, otherwise it is sent as data of the stream
+func (c *thriftCodec) doEncode(protocol, messageType byte, name string, seqId int32, bodyLen int, body []byte) ([]byte, error) {
+	if body != nil {
+		bodyLen = len(body)
+	}
+
+	var header []byte
+	switch protocol {
+	case BINARY_PROTOCOL_ID:
+		header = encodeBinaryMessageHeader(messageType, name, seqId)
+	case COMPACT_PROTOCOL_ID:
+		header = encodeCompactMessageHeader(messageType, name, seqId)
+	default:
+		return nil, errors.New(sofarpc.UnKnownCodec)
+	}
+
+	frameLen := len(header) + bodyLen
+	if frameLen > MAX_FRAME_LENGTH {
+		return nil, errors.New(sofarpc.FrameTooLarge)
+	}
+
+	data := make([]byte, FRAME_HEADER_LENGTH, FRAME_HEADER_LENGTH+len(header)+len(body))
+	binary.BigEndian.PutUint32(data, uint32(frameLen))
+	data = append(data, header...)
+
+	return append(data, body...), nil
+}
+
+func (c *thriftCodec) EncodeData(context context.Context, data types.IoBuffer) types.IoBuffer {
+	return data
+}
+
+func (c *thriftCodec) EncodeTrailers(context context.Context, trailers map[string]string) types.IoBuffer {
+	return nil
+}
+
+func (c *thriftCodec) mapToCmd(headers map[string]string) interface{} {
+	cmdType, ok := sofarpc.GetPropertyValue(ThriftPropertyHeaders, headers, sofarpc.HeaderCmdType).(byte)
+	if !ok {
+		return nil
+	}
+
+	requestId, _ := sofarpc.GetPropertyValue(ThriftPropertyHeaders, headers, sofarpc.HeaderReqID).(uint32)
+	protocol, _ := sofarpc.GetPropertyValue(ThriftPropertyHeaders, headers, sofarpc.HeaderCodec).(byte)
+	bodyLen, _ := sofarpc.GetPropertyValue(ThriftPropertyHeaders, headers, sofarpc.HeaderContentLen).(int)
+	messageType, _ := sofarpc.GetPropertyValue(ThriftPropertyHeaders, headers, HeaderMessageType).(byte)
+	name := joinName(headers[types.ThriftRouteServiceKey], headers[types.ThriftRouteMethodKey])
+
+	switch cmdType {
+	case sofarpc.REQUEST, sofarpc.REQUEST_ONEWAY:
+		if messageType == 0 {
+			messageType = CALL
+			if cmdType == sofarpc.REQUEST_ONEWAY {
+				messageType = ONEWAY
+			}
+		}
+
+		return &ThriftRequestCommand{
+			Protocol:    protocol,
+			MessageType: messageType,
+			Name:        name,
+			SeqId:       int32(requestId),
+			BodyLen:     bodyLen,
+		}
+	case sofarpc.RESPONSE:
+		if messageType == 0 {
+			messageType = REPLY
+		}
+
+		return &ThriftResponseCommand{
+			Protocol:    protocol,
+			MessageType: messageType,
+			Name:        name,
+			SeqId:       int32(requestId),
+			BodyLen:     bodyLen,
+		}
+	}
+
+	return nil
+}
+
+func (c *thriftCodec) Decode(context context.Context, data types.IoBuffer) (int, interface{}) {
+	readableBytes := data.Len()
+	logger := log.ByContext(context)
+
+	if readableBytes <= FRAME_HEADER_LENGTH {
+		// not enough data for the protocol id
+		return readableBytes, nil
+	}
+
+	bytes := data.Bytes()
+	if protocol := bytes[FRAME_HEADER_LENGTH]; protocol != BINARY_PROTOCOL_ID && protocol != COMPACT_PROTOCOL_ID {
+		return 0, nil
+	}
+
+	frameLen := int(binary.BigEndian.Uint32(bytes[:FRAME_HEADER_LENGTH]))
+	read := FRAME_HEADER_LENGTH + frameLen
+	if readableBytes < read {
+		logger.Debugf("Thrift DECODE, no enough data for fully decode")
+		return read, nil
+	}
+
+	protocol, messageType, name, seqId, headerLen, err := decodeMessageHeader(bytes[FRAME_HEADER_LENGTH:read])
+	if err != nil {
+		logger.Errorf("Thrift DECODE failed: %v", err)
+		return 0, nil
+	}
+
+	bodyLen := frameLen - headerLen
+	var body []byte
+	if bodyLen > 0 {
+		body = make([]byte, bodyLen)
+		copy(body, bytes[FRAME_HEADER_LENGTH+headerLen:read])
+	}
+
+	data.Drain(read)
+
+	switch messageType {
+	case CALL, ONEWAY:
+		request := &ThriftRequestCommand{
+			Protocol:    protocol,
+			MessageType: messageType,
+			Name:        name,
+			SeqId:       seqId,
+			BodyLen:     bodyLen,
+			Body:        body,
+		}
+		logger.Debugf("Thrift DECODE REQUEST, Type = %d, Name = %s, SeqId = %d", messageType, name, seqId)
+
+		return read, request
+	case REPLY, EXCEPTION:
+		response := &ThriftResponseCommand{
+			Protocol:    protocol,
+			MessageType: messageType,
+			Name:        name,
+			SeqId:       seqId,
+			BodyLen:     bodyLen,
+			Body:        body,
+		}
+		logger.Debugf("Thrift DECODE RESPONSE, Type = %d, Name = %s, SeqId = %d", messageType, name, seqId)
+
+		return read, response
+	default:
+		logger.Errorf("Thrift DECODE, unknown message type %d", messageType)
+		return 0, nil
+	}
+}
+
+// decodeMessageHeader decodes the message header of binary or compact protocol in the frame,
+// returns the length of the header
+func decodeMessageHeader(frame []byte) (protocol, messageType byte, name string, seqId int32, headerLen int, err error) {
+	if len(frame) < 2 {
+		return 0, 0, "", 0, 0, errMalformedMessage
+	}
+
+	protocol = frame[0]
+	switch protocol {
+	case BINARY_PROTOCOL_ID:
+		// strict binary protocol: version(2B), unused(1B), type(1B), name, seqid
+		if len(frame) < 8 || frame[1] != BINARY_VERSION {
+			return 0, 0, "", 0, 0, errMalformedMessage
+		}
+		messageType = frame[3]
+
+		nameLen := int(binary.BigEndian.Uint32(frame[4:8]))
+		if nameLen < 0 || len(frame) < 8+nameLen+4 {
+			return 0, 0, "", 0, 0, errMalformedMessage
+		}
+		name = string(frame[8 : 8+nameLen])
+		seqId = int32(binary.BigEndian.Uint32(frame[8+nameLen:]))
+
+		return protocol, messageType, name, seqId, 8 + nameLen + 4, nil
+	case COMPACT_PROTOCOL_ID:
+		if frame[1]&COMPACT_VERSION_MASK != COMPACT_VERSION {
+			return 0, 0, "", 0, 0, errMalformedMessage
+		}
+		messageType = frame[1] >> COMPACT_TYPE_SHIFT
+
+		pos := 2
+		seq, n := readVarint32(frame[pos:])
+		if n <= 0 {
+			return 0, 0, "", 0, 0, errMalformedMessage
+		}
+		seqId = int32(seq)
+		pos += n
+
+		nameLen, n := readVarint32(frame[pos:])
+		if n <= 0 || len(frame) < pos+n+int(nameLen) {
+			return 0, 0, "", 0, 0, errMalformedMessage
+		}
+		pos += n
+		name = string(frame[pos : pos+int(nameLen)])
+
+		return protocol, messageType, name, seqId, pos + int(nameLen), nil
+	default:
+		return 0, 0, "", 0, 0, errMalformedMessage
+	}
+}
+
+func encodeBinaryMessageHeader(messageType byte, name string, seqId int32) []byte {
+	header := make([]byte, 8, 12+len(name))
+	header[0] = BINARY_PROTOCOL_ID
+	header[1] = BINARY_VERSION
+	header[3] = messageType
+	binary.BigEndian.PutUint32(header[4:], uint32(len(name)))
+	header = append(header, name...)
+
+	return appendInt32(header, seqId)
+}
+
+func encodeCompactMessageHeader(messageType byte, name string, seqId int32) []byte {
+	header := make([]byte, 2, 12+len(name))
+	header[0] = COMPACT_PROTOCOL_ID
+	header[1] = messageType<<COMPACT_TYPE_SHIFT | COMPACT_VERSION
+	header = appendVarint32(header, uint32(seqId))
+	header = appendVarint32(header, uint32(len(name)))
+
+	return append(header, name...)
+}
+
+func appendInt32(b []byte, v int32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendVarint32 appends the unsigned varint of compact protocol, which is at most 5 bytes
+func appendVarint32(b []byte, v uint32) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+
+	return append(b, byte(v))
+}
+
+// readVarint32 reads the unsigned varint of compact protocol, returns the bytes read,
+// which is 0 if the varint is incomplete or overflows
+func readVarint32(b []byte) (uint32, int) {
+	var v uint32
+
+	for i := 0; i < len(b) && i < 5; i++ {
+		v |= uint32(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+
+	return 0, 0
+}
@@ -0,0 +1,242 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package thrift
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// mockDecodeFilter records decoded headers and data
+type mockDecodeFilter struct {
+	streamId string
+	headers  map[string]string
+	data     []byte
+}
+
+func (f *mockDecodeFilter) OnDecodeHeader(streamId string, headers map[string]string) types.FilterStatus {
+	f.streamId = streamId
+	f.headers = headers
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeData(streamId string, data types.IoBuffer) types.FilterStatus {
+	f.data = data.Bytes()
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeTrailer(streamId string, trailers map[string]string) types.FilterStatus {
+	return types.Continue
+}
+
+func (f *mockDecodeFilter) OnDecodeError(err error, headers map[string]string) {}
+
+var (
+	// Calculator:add(1) of seqid 7 in binary protocol
+	binaryCall = []byte{
+		0x00, 0x00, 0x00, 0x22,
+		0x80, 0x01, 0x00, CALL,
+		0x00, 0x00, 0x00, 0x0e, 'C', 'a', 'l', 'c', 'u', 'l', 'a', 't', 'o', 'r', ':', 'a', 'd', 'd',
+		0x00, 0x00, 0x00, 0x07,
+		// field i32 1: 1, stop
+		0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00,
+	}
+
+	// Calculator:add(1) of seqid 7 in compact protocol
+	compactCall = []byte{
+		0x00, 0x00, 0x00, 0x15,
+		0x82, CALL<<5 | 0x01,
+		0x07,
+		0x0e, 'C', 'a', 'l', 'c', 'u', 'l', 'a', 't', 'o', 'r', ':', 'a', 'd', 'd',
+		// field i32 1: 1, stop
+		0x15, 0x02, 0x00,
+	}
+)
+
+func decodeAndHandle(t *testing.T, frame []byte) (interface{}, *mockDecodeFilter) {
+	read, cmd := Thrift.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame))
+	if cmd == nil || read != len(frame) {
+		t.Fatalf("decode failed, read %d of %d", read, len(frame))
+	}
+
+	filter := &mockDecodeFilter{}
+	if err := Thrift.GetCommandHandler().HandleCommand(nil, cmd, filter); err != nil {
+		t.Fatalf("handle command failed: %v", err)
+	}
+
+	return cmd, filter
+}
+
+// encode the decoded headers and data as the stream layer does
+func encodeFrame(t *testing.T, headers map[string]string, data []byte) []byte {
+	err, buf := Thrift.GetEncoder().EncodeHeaders(nil, headers)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	return append(buf.Bytes(), data...)
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	for protocol, frame := range map[byte][]byte{
+		BINARY_PROTOCOL_ID:  binaryCall,
+		COMPACT_PROTOCOL_ID: compactCall,
+	} {
+		cmd, filter := decodeAndHandle(t, frame)
+		request, ok := cmd.(*ThriftRequestCommand)
+		if !ok || request.Protocol != protocol || request.SeqId != 7 || request.Name != "Calculator:add" {
+			t.Fatalf("unexpected request %+v", cmd)
+		}
+
+		for k, v := range map[string]string{
+			types.ThriftRouteServiceKey:                     "Calculator",
+			types.ThriftRouteMethodKey:                      "add",
+			sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID): "7",
+			sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec): strconv.Itoa(int(protocol)),
+		} {
+			if filter.headers[k] != v {
+				t.Errorf("header %s expected %s, got %s", k, v, filter.headers[k])
+			}
+		}
+		if !sofarpc.IsSofaRequest(filter.headers) {
+			t.Error("thrift call should be recognized as request by stream layer")
+		}
+		if _, ok := filter.headers[types.HeaderOneway]; ok {
+			t.Error("call should not be oneway")
+		}
+		if !bytes.Equal(filter.data, request.Body) || len(filter.data) == 0 {
+			t.Error("arguments should be passed as data")
+		}
+
+		if encoded := encodeFrame(t, filter.headers, filter.data); !bytes.Equal(encoded, frame) {
+			t.Errorf("round trip mismatch\n%x\n%x", encoded, frame)
+		}
+	}
+}
+
+func TestOnewayRequest(t *testing.T) {
+	for _, protocol := range []byte{BINARY_PROTOCOL_ID, COMPACT_PROTOCOL_ID} {
+		frame, _ := (&thriftCodec{}).doEncode(protocol, ONEWAY, "ping", 3, 0, []byte{0x00})
+
+		_, filter := decodeAndHandle(t, frame)
+		if _, ok := filter.headers[types.HeaderOneway]; !ok {
+			t.Error("oneway message should be oneway request")
+		}
+		if _, ok := filter.headers[types.ThriftRouteServiceKey]; ok {
+			t.Error("name not multiplexed should have no service")
+		}
+		if filter.headers[types.ThriftRouteMethodKey] != "ping" {
+			t.Errorf("unexpected method %s", filter.headers[types.ThriftRouteMethodKey])
+		}
+
+		if encoded := encodeFrame(t, filter.headers, filter.data); !bytes.Equal(encoded, frame) {
+			t.Errorf("round trip mismatch\n%x\n%x", encoded, frame)
+		}
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	// result struct: field i32 0: 2, stop
+	for protocol, body := range map[byte][]byte{
+		BINARY_PROTOCOL_ID:  {0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00},
+		COMPACT_PROTOCOL_ID: {0x05, 0x00, 0x04, 0x00},
+	} {
+		// seqid is the remapped stream id of upstream connection, which may overflow int32
+		frame, _ := (&thriftCodec{}).doEncode(protocol, REPLY, "Calculator:add", -2, 0, body)
+
+		_, filter := decodeAndHandle(t, frame)
+		if filter.streamId != strconv.FormatUint(1<<32-2, 10) {
+			t.Errorf("response should be decoded on stream of the seqid, got %s", filter.streamId)
+		}
+		if sofarpc.IsSofaRequest(filter.headers) {
+			t.Error("thrift reply should not be recognized as request")
+		}
+		if !bytes.Equal(filter.data, body) {
+			t.Error("result should be passed as data")
+		}
+
+		if encoded := encodeFrame(t, filter.headers, filter.data); !bytes.Equal(encoded, frame) {
+			t.Errorf("round trip mismatch\n%x\n%x", encoded, frame)
+		}
+	}
+}
+
+func TestDecodePartialFrame(t *testing.T) {
+	for _, frame := range [][]byte{binaryCall, compactCall} {
+		for _, n := range []int{2, FRAME_HEADER_LENGTH + 1, len(frame) - 1} {
+			data := buffer.NewIoBufferBytes(frame[:n])
+			if read, cmd := Thrift.GetDecoder().Decode(nil, data); read == 0 || cmd != nil || data.Len() != n {
+				t.Errorf("partial frame of %d bytes should wait for more data, read %d, cmd %v", n, read, cmd)
+			}
+		}
+	}
+}
+
+func TestDecodeMalformedFrame(t *testing.T) {
+	for _, frame := range [][]byte{
+		// unknown protocol id
+		{0x00, 0x00, 0x00, 0x04, 0x81, 0x01, 0x00, 0x01},
+		// bad binary version
+		{0x00, 0x00, 0x00, 0x0c, 0x80, 0x02, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		// name exceeds the frame
+		{0x00, 0x00, 0x00, 0x0c, 0x80, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x01},
+		// bad compact version
+		{0x00, 0x00, 0x00, 0x04, 0x82, 0x22, 0x01, 0x00},
+		// unknown message type
+		{0x00, 0x00, 0x00, 0x04, 0x82, 0xa1, 0x01, 0x00},
+	} {
+		if read, cmd := Thrift.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(frame)); read != 0 || cmd != nil {
+			t.Errorf("malformed frame %x should not be decoded, read %d, cmd %v", frame, read, cmd)
+		}
+	}
+}
+
+func TestBuildResponse(t *testing.T) {
+	for _, protocol := range []byte{BINARY_PROTOCOL_ID, COMPACT_PROTOCOL_ID} {
+		headers := map[string]string{
+			sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(PROTOCOL_CODE_THRIFT)),
+			sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        "5",
+			sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec):        strconv.Itoa(int(protocol)),
+			types.ThriftRouteServiceKey:                            "Calculator",
+			types.ThriftRouteMethodKey:                             "add",
+		}
+
+		resp, err := sofarpc.BuildSofaRespMsg(nil, headers, sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR)
+		if err != nil {
+			t.Fatalf("build response failed: %v", err)
+		}
+		err, buf := sofarpc.DefaultProtocols().EncodeHeaders(nil, resp)
+		if err != nil {
+			t.Fatalf("encode response failed: %v", err)
+		}
+
+		_, cmd := Thrift.GetDecoder().Decode(nil, buf)
+		response, ok := cmd.(*ThriftResponseCommand)
+		if !ok || response.Protocol != protocol || response.SeqId != 5 || response.MessageType != EXCEPTION ||
+			response.Name != "Calculator:add" {
+			t.Fatalf("unexpected response %+v", cmd)
+		}
+		if !bytes.Contains(response.Body, []byte("mosn: client_error")) {
+			t.Errorf("unexpected exception %x", response.Body)
+		}
+	}
+}
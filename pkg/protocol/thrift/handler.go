@@ -0,0 +1,163 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package thrift
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+var streamIdCounter uint32
+
+type ThriftCommandHandler struct {
+	processors map[int16]sofarpc.RemotingProcessor
+}
+
+func NewThriftCommandHandler() *ThriftCommandHandler {
+	return &ThriftCommandHandler{
+		processors: map[int16]sofarpc.RemotingProcessor{
+			sofarpc.RPC_REQUEST:  &ThriftRequestProcessor{},
+			sofarpc.RPC_RESPONSE: &ThriftResponseProcessor{},
+		},
+	}
+}
+
+func (h *ThriftCommandHandler) HandleCommand(context context.Context, msg interface{}, filter interface{}) error {
+	logger := log.ByContext(context)
+
+	if cmd, ok := msg.(sofarpc.ProtoBasicCmd); ok {
+		cmdCode := cmd.GetCmdCode()
+
+		if processor, ok := h.processors[cmdCode]; ok {
+			processor.Process(context, cmd, filter)
+		} else {
+			errMsg := sofarpc.UnKnownCmdcode
+			logger.Errorf(errMsg+"when decoding thrift %d", cmdCode)
+			return errors.New(errMsg)
+		}
+	} else {
+		errMsg := sofarpc.UnKnownCmd
+		logger.Errorf(errMsg+"when decoding thrift %v", msg)
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
+
+func (h *ThriftCommandHandler) RegisterProcessor(cmdCode int16, processor *sofarpc.RemotingProcessor) {
+	if _, exists := h.processors[cmdCode]; exists {
+		log.DefaultLogger.Warnf("thrift cmd handler [%x] alreay exist:", cmdCode)
+	} else {
+		h.processors[cmdCode] = *processor
+	}
+}
+
+type ThriftRequestProcessor struct{}
+
+// CALLBACK STREAM LEVEL'S OnReceiveHeaders
+func (p *ThriftRequestProcessor) Process(context context.Context, msg interface{}, filter interface{}) {
+	if cmd, ok := msg.(*ThriftRequestCommand); ok {
+		deserializeRequestAllFields(context, cmd)
+		streamId := atomic.AddUint32(&streamIdCounter, 1)
+		streamIdStr := sofarpc.StreamIDConvert(streamId)
+
+		if filter, ok := filter.(types.DecodeFilter); ok {
+			if cmd.Body == nil {
+				cmd.RequestHeader[types.HeaderStremEnd] = "yes"
+			}
+			// oneway request expects no response
+			if cmd.IsOneway() {
+				cmd.RequestHeader[types.HeaderOneway] = "yes"
+			}
+
+			if status := filter.OnDecodeHeader(streamIdStr, cmd.RequestHeader); status == types.StopIteration {
+				return
+			}
+
+			if cmd.Body != nil {
+				filter.OnDecodeData(streamIdStr, buffer.NewIoBufferBytes(cmd.Body))
+			}
+		}
+	}
+}
+
+type ThriftResponseProcessor struct{}
+
+func (p *ThriftResponseProcessor) Process(context context.Context, msg interface{}, filter interface{}) {
+	if cmd, ok := msg.(*ThriftResponseCommand); ok {
+		deserializeResponseAllFields(context, cmd)
+		reqID := strconv.FormatUint(uint64(cmd.GetReqId()), 10)
+
+		if filter, ok := filter.(types.DecodeFilter); ok {
+			if cmd.Body == nil {
+				cmd.ResponseHeader[types.HeaderStremEnd] = "yes"
+			}
+
+			if status := filter.OnDecodeHeader(reqID, cmd.ResponseHeader); status == types.StopIteration {
+				return
+			}
+
+			if cmd.Body != nil {
+				filter.OnDecodeData(reqID, buffer.NewIoBufferBytes(cmd.Body))
+			}
+		}
+	}
+}
+
+// Convert thrift's frame and message header to Map[string]string, the message name is split
+// into service and method for routing
+func deserializeRequestAllFields(context context.Context, cmd *ThriftRequestCommand) {
+	cmdType := sofarpc.REQUEST
+	if cmd.IsOneway() {
+		cmdType = sofarpc.REQUEST_ONEWAY
+	}
+
+	cmd.RequestHeader = deserializeAllFields(context, cmdType, cmd.GetCmdCode(), cmd.Protocol, cmd.MessageType,
+		cmd.Name, cmd.GetReqId(), cmd.BodyLen)
+}
+
+func deserializeResponseAllFields(context context.Context, cmd *ThriftResponseCommand) {
+	cmd.ResponseHeader = deserializeAllFields(context, sofarpc.RESPONSE, cmd.GetCmdCode(), cmd.Protocol, cmd.MessageType,
+		cmd.Name, cmd.GetReqId(), cmd.BodyLen)
+}
+
+func deserializeAllFields(context context.Context, cmdType byte, cmdCode int16, protocol, messageType byte,
+	name string, requestId uint32, bodyLen int) map[string]string {
+	allField := sofarpc.GetMap(context, 16)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode)] = strconv.FormatUint(uint64(PROTOCOL_CODE_THRIFT), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.FormatUint(uint64(cmdType), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode)] = strconv.FormatInt(int64(cmdCode), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = strconv.FormatUint(uint64(requestId), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec)] = strconv.FormatUint(uint64(protocol), 10)
+	allField[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(bodyLen)
+	allField[sofarpc.SofaPropertyHeader(HeaderMessageType)] = strconv.FormatUint(uint64(messageType), 10)
+
+	service, method := splitName(name)
+	if service != "" {
+		allField[types.ThriftRouteServiceKey] = service
+	}
+	allField[types.ThriftRouteMethodKey] = method
+
+	return allField
+}
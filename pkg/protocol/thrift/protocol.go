@@ -0,0 +1,118 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package thrift
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func init() {
+	sofarpc.MustRegisterProtocol(PROTOCOL_CODE_THRIFT, Thrift)
+}
+
+var Thrift = &ThriftProtocol{
+	PROTOCOL_CODE_THRIFT,
+	&thriftCodec{},
+	&thriftCodec{},
+	NewThriftCommandHandler(),
+}
+
+type ThriftProtocol struct {
+	protocolCode   byte
+	encoder        types.Encoder
+	decoder        types.Decoder
+	commandHandler sofarpc.CommandHandler
+}
+
+func (t *ThriftProtocol) GetEncoder() types.Encoder {
+	return t.encoder
+}
+
+func (t *ThriftProtocol) GetDecoder() types.Decoder {
+	return t.decoder
+}
+
+func (t *ThriftProtocol) GetCommandHandler() sofarpc.CommandHandler {
+	return t.commandHandler
+}
+
+// BuildResponse builds the exception reply of the request, which carries the TApplicationException
+// with the error message in the protocol of the request
+func (t *ThriftProtocol) BuildResponse(context context.Context, headers map[string]string, respStatus int16) (interface{}, error) {
+	requestId, ok := sofarpc.GetPropertyValue(ThriftPropertyHeaders, headers, sofarpc.HeaderReqID).(uint32)
+	if !ok {
+		errMsg := sofarpc.NoReqIdFound
+		log.ByContext(context).Errorf(errMsg)
+		return headers, errors.New(errMsg)
+	}
+
+	protocol := BINARY_PROTOCOL_ID
+	if c, ok := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec)]; ok {
+		protocol = sofarpc.ConvertPropertyValue(c, reflect.Uint8).(byte)
+	}
+
+	message := "mosn: " + sofarpc.ResponseStatusToError(respStatus).Type.String()
+
+	var body []byte
+	if protocol == COMPACT_PROTOCOL_ID {
+		body = encodeCompactApplicationException(message, APPLICATION_EXCEPTION_INTERNAL_ERROR)
+	} else {
+		protocol = BINARY_PROTOCOL_ID
+		body = encodeBinaryApplicationException(message, APPLICATION_EXCEPTION_INTERNAL_ERROR)
+	}
+
+	return &ThriftResponseCommand{
+		Protocol:    protocol,
+		MessageType: EXCEPTION,
+		Name:        joinName(headers[types.ThriftRouteServiceKey], headers[types.ThriftRouteMethodKey]),
+		SeqId:       int32(requestId),
+		Body:        body,
+	}, nil
+}
+
+// TApplicationException struct: 1: string message, 2: i32 type
+func encodeBinaryApplicationException(message string, exceptionType int32) []byte {
+	// field type string(11), id 1
+	body := []byte{11, 0, 1}
+	body = appendInt32(body, int32(len(message)))
+	body = append(body, message...)
+	// field type i32(8), id 2
+	body = append(body, 8, 0, 2)
+	body = appendInt32(body, exceptionType)
+
+	// field stop
+	return append(body, 0)
+}
+
+func encodeCompactApplicationException(message string, exceptionType int32) []byte {
+	// field delta 1, type binary(8)
+	body := []byte{0x18}
+	body = appendVarint32(body, uint32(len(message)))
+	body = append(body, message...)
+	// field delta 1, type i32(5), zigzag encoded
+	body = append(body, 0x15)
+	body = appendVarint32(body, uint32((exceptionType<<1)^(exceptionType>>31)))
+
+	// field stop
+	return append(body, 0)
+}
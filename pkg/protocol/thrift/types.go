@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package thrift
+
+import (
+	"strings"
+
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+)
+
+/**
+ *   Frame(4B):  frame length, not including itself
+ *   Message:    message header and the struct of arguments (call) or result (reply)
+ *
+ *   Binary protocol message header:
+ *     version(4B): 0x8001 | 0x00 | message type
+ *     name:        length(4B) and bytes
+ *     seqid(4B)
+ *
+ *   Compact protocol message header:
+ *     protocol id(1B): 0x82
+ *     version and type(1B): message type << 5 | version(0x01)
+ *     seqid:       varint
+ *     name:        length(varint) and bytes
+ */
+const (
+	PROTOCOL_CODE_THRIFT = sofarpc.PROTOCOL_CODE_THRIFT
+
+	FRAME_HEADER_LENGTH int = 4
+	// frame length is limited by the protocol code, which is the first byte of frame
+	MAX_FRAME_LENGTH int = 1<<24 - 1
+
+	// the first byte of message, which is kept as codec in headers
+	BINARY_PROTOCOL_ID  byte = 0x80
+	COMPACT_PROTOCOL_ID byte = 0x82
+
+	BINARY_VERSION       byte = 0x01
+	COMPACT_VERSION      byte = 0x01
+	COMPACT_VERSION_MASK byte = 0x1f
+	COMPACT_TYPE_SHIFT   uint = 5
+
+	// message type
+	CALL      byte = 1
+	REPLY     byte = 2
+	EXCEPTION byte = 3
+	ONEWAY    byte = 4
+
+	// type of TApplicationException
+	APPLICATION_EXCEPTION_INTERNAL_ERROR int32 = 6
+
+	// message name of multiplexed protocol is service name and method name joined by the separator
+	MULTIPLEXED_SEPARATOR = ":"
+)
+
+// thrift headers exposed to the stream layer, service and method are used for routing
+const (
+	HeaderMessageType string = "thriftmessagetype"
+)
+
+type ThriftRequestCommand struct {
+	Protocol      byte
+	MessageType   byte
+	Name          string
+	SeqId         int32
+	BodyLen       int
+	Body          []byte
+	RequestHeader map[string]string
+}
+
+type ThriftResponseCommand struct {
+	Protocol       byte
+	MessageType    byte
+	Name           string
+	SeqId          int32
+	BodyLen        int
+	Body           []byte
+	ResponseHeader map[string]string
+}
+
+func (c *ThriftRequestCommand) GetProtocol() byte {
+	return PROTOCOL_CODE_THRIFT
+}
+
+func (c *ThriftRequestCommand) GetCmdCode() int16 {
+	return sofarpc.RPC_REQUEST
+}
+
+func (c *ThriftRequestCommand) GetReqId() uint32 {
+	return uint32(c.SeqId)
+}
+
+func (c *ThriftRequestCommand) IsOneway() bool {
+	return c.MessageType == ONEWAY
+}
+
+func (c *ThriftResponseCommand) GetProtocol() byte {
+	return PROTOCOL_CODE_THRIFT
+}
+
+func (c *ThriftResponseCommand) GetCmdCode() int16 {
+	return sofarpc.RPC_RESPONSE
+}
+
+func (c *ThriftResponseCommand) GetReqId() uint32 {
+	return uint32(c.SeqId)
+}
+
+// splitName splits the message name of multiplexed protocol into service and method,
+// service is empty if the name is not multiplexed
+func splitName(name string) (service, method string) {
+	if i := strings.Index(name, MULTIPLEXED_SEPARATOR); i >= 0 {
+		return name[:i], name[i+len(MULTIPLEXED_SEPARATOR):]
+	}
+
+	return "", name
+}
+
+func joinName(service, method string) string {
+	if service == "" {
+		return method
+	}
+
+	return service + MULTIPLEXED_SEPARATOR + method
+}
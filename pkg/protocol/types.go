@@ -23,10 +23,12 @@ const (
 	Http1     types.Protocol = "Http1"
 	Http2     types.Protocol = "Http2"
 	Xprotocol types.Protocol = "X"
+	Auto      types.Protocol = "Auto" // Http1 or SofaRpc, detected on the first bytes of connection
 )
 
 const (
-	MosnHeaderHostKey        = "host"
-	MosnHeaderPathKey        = "path"
-	MosnHeaderQueryStringKey = "querystring"
+	MosnHeaderHostKey          = "host"
+	MosnHeaderPathKey          = "path"
+	MosnHeaderQueryStringKey   = "querystring"
+	MosnHeaderContentLengthKey = "content-length"
 )
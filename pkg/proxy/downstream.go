@@ -20,6 +20,7 @@ import (
 	"container/list"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"reflect"
 	"strconv"
@@ -30,6 +31,9 @@ import (
 	"github.com/alipay/sofamosn/pkg/network"
 	"github.com/alipay/sofamosn/pkg/network/buffer"
 	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/trace"
 	"github.com/alipay/sofamosn/pkg/types"
 	"sync/atomic"
 )
@@ -52,12 +56,37 @@ type downStream struct {
 	// ~~~ control args
 	timeout    *ProxyTimeout
 	retryState *retryState
+	// upstream hosts tried by the request, skipped when retry
+	triedHosts []types.Host
+	// upstream requests sent, including retries and hedges
+	attempts uint32
 
 	requestInfo     types.RequestInfo
+	requestContext  types.RequestContext
 	responseSender  types.StreamSender
 	upstreamRequest *upstreamRequest
 	perRetryTimer   *timer
 	responseTimer   *timer
+	// request waiting for the rate limiter of the cluster, set while waiting
+	paceTimer *timer
+	// guards the pacing state, the data and trailers passed the filters while waiting are buffered,
+	// and sent after the headers
+	paceMux       sync.Mutex
+	pacing        bool
+	pacedData     types.IoBuffer
+	pacedDataEnd  bool
+	pacedTrailers map[string]string
+
+	// metric tags and request latency of the routed cluster, and the classified status of upstream response
+	clusterTags    stats.Tags
+	clusterLatency *stats.LatencyHistogram
+	upstreamStatus string
+	// tracing span of bolt request
+	span types.Span
+	// copy of the request sent to the shadow cluster, nil if not mirrored
+	mirror *mirror
+	// duplicates of the request sent to other hosts if upstream responds slowly, nil if not hedged
+	hedge *hedgeState
 
 	// ~~~ downstream request buf
 	downstreamReqHeaders  map[string]string
@@ -76,6 +105,8 @@ type downStream struct {
 	downstreamRecvDone bool
 	// upstream req sent
 	upstreamRequestSent bool
+	// oneway request expects no upstream response
+	oneway bool
 	// 1. at the end of upstream response 2. by a upstream reset due to exceptions, such as no healthy upstream, connection close, etc.
 	upstreamProcessDone      bool
 	senderFiltersStreaming   bool
@@ -149,6 +180,7 @@ func (s *downStream) cleanStream() {
 	}
 
 	// reset corresponding upstream stream
+	s.cancelHedges()
 	if s.upstreamRequest != nil {
 		s.upstreamRequest.resetStream()
 	}
@@ -169,6 +201,21 @@ func (s *downStream) cleanStream() {
 	s.proxy.stats.DownstreamRequestActive().Dec(1)
 	s.proxy.listenerStats.DownstreamRequestActive().Dec(1)
 
+	if s.clusterTags != nil {
+		sink := stats.GetSink()
+		duration := time.Now().Sub(s.requestInfo.StartTime())
+
+		sink.Gauge(stats.ClusterRequestsActive, -1, s.clusterTags)
+		sink.Histogram(stats.ClusterRequestDuration, duration.Seconds(), s.clusterTags)
+		s.clusterLatency.Update(duration)
+
+		if s.upstreamStatus != "" {
+			sink.Count(stats.ClusterResponsesTotal, 1, s.clusterTags.With(stats.TagStatus, s.upstreamStatus))
+		}
+	}
+
+	s.finishSpan()
+
 	// access log
 	if s.proxy != nil && s.proxy.accessLogs != nil {
 		var downstreamRespHeadersMap map[string]string
@@ -209,10 +256,44 @@ func (s *downStream) OnResetStream(reason types.StreamResetReason) {
 func (s *downStream) OnReceiveHeaders(headers map[string]string, endStream bool) {
 	s.downstreamRecvDone = endStream
 	s.downstreamReqHeaders = headers
+	s.requestContext = sofarpc.NewRequestContext(headers)
+	_, s.oneway = headers[types.HeaderOneway]
+
+	// peer identity is only trusted from verified client certificate, never from the request
+	delete(headers, types.HeaderPeerIdentity)
+	if identity, ok := s.proxy.context.Value(types.ContextKeyPeerIdentity).(string); ok {
+		headers[types.HeaderPeerIdentity] = identity
+	}
+
+	// source ip of the connection, which is the client address in PROXY protocol header if any
+	delete(headers, types.HeaderSourceIP)
+	if addr := s.proxy.readCallbacks.Connection().RemoteAddr(); addr != nil {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			headers[types.HeaderSourceIP] = host
+		}
+	}
+
+	if header := s.proxy.config.CorrelationIdHeader; header != "" {
+		s.tagCorrelationId(header, headers)
+	}
 
 	s.doReceiveHeaders(nil, headers, endStream)
 }
 
+// tagCorrelationId reads the correlation id of the request, or generates one if absent. The id is kept
+// in the request headers, so that all upstream attempts of the request, including retries and hedges,
+// carry the same id
+func (s *downStream) tagCorrelationId(header string, headers map[string]string) {
+	id := headers[header]
+	if id == "" {
+		id = newCorrelationId()
+		headers[header] = id
+	}
+
+	s.requestInfo.SetCorrelationId(id)
+	s.logger = log.WithPrefix(s.logger, "[correlation_id="+id+"]")
+}
+
 func (s *downStream) doReceiveHeaders(filter *activeStreamReceiverFilter, headers map[string]string, endStream bool) {
 	if s.runReceiveHeadersFilters(filter, headers, endStream) {
 		return
@@ -220,7 +301,8 @@ func (s *downStream) doReceiveHeaders(filter *activeStreamReceiverFilter, header
 
 	//Get some route by service name
 	log.StartLogger.Tracef("before active stream route")
-	route := s.proxy.routers.Route(headers, 1)
+	// random value is used to pick a cluster from weighted clusters
+	route := s.proxy.routers.Route(headers, rand.Uint64())
 
 	if route == nil || route.RouteRule() == nil {
 		// no route
@@ -242,17 +324,52 @@ func (s *downStream) doReceiveHeaders(filter *activeStreamReceiverFilter, header
 
 	// active realize loadbalancer ctx
 	log.StartLogger.Tracef("before initializeUpstreamConnectionPool")
-	err, pool := s.initializeUpstreamConnectionPool(route.RouteRule().ClusterName(), s)
+	clusterName := s.upstreamClusterName(route.RouteRule())
+	err, pool := s.initializeUpstreamConnectionPool(clusterName, s)
 
 	if err != nil {
-		log.DefaultLogger.Errorf("initialize Upstream Connection Pool error, request can't be proxyed,error = %v", err)
+		s.logger.Errorf("initialize Upstream Connection Pool error, request can't be proxyed,error = %v", err)
 		return
 	}
 
 	log.StartLogger.Tracef("after initializeUpstreamConnectionPool")
-	s.timeout = parseProxyTimeout(route, headers)
+
+	if s.isWebSocketUpgrade(headers) {
+		s.startWebSocketTunnel(clusterName, headers)
+		return
+	}
+
+	// the data and trailers received while waiting are buffered, and sent after the headers
+	if s.paceUpstream(func() { s.onPaced(pool, headers, endStream) }) {
+		return
+	}
+
+	s.forwardHeaders(pool, headers, endStream)
+}
+
+// forwardHeaders builds the upstream request of the routed cluster, and sends the headers
+func (s *downStream) forwardHeaders(pool types.ConnectionPool, headers map[string]string, endStream bool) {
+	route := s.route
+
+	s.timeout = parseProxyTimeout(route, headers, s.proxy.config.RequestTimeout)
 	s.retryState = newRetryState(route.RouteRule().Policy().RetryPolicy(), headers, s.cluster)
 
+	if s.convertToBolt() {
+		headers = sofarpc.Http2ToBoltRequest(headers, route.RouteRule().BoltConvert())
+		// keep converted headers for retry
+		s.downstreamReqHeaders = headers
+		s.requestContext = sofarpc.NewRequestContext(headers)
+	}
+
+	// after converted, so that the headers of the route are applied to the bolt header map
+	route.RouteRule().FinalizeRequestHeaders(headers, s.requestInfo)
+
+	s.mirror = newMirror(s, route, headers)
+
+	if s.upstreamProtocol() == protocol.SofaRpc {
+		s.startSpan(headers)
+	}
+
 	//Build Request
 	s.upstreamRequest = &upstreamRequest{
 		downStream: s,
@@ -260,11 +377,16 @@ func (s *downStream) doReceiveHeaders(filter *activeStreamReceiverFilter, header
 		connPool:   pool,
 	}
 
+	if !s.oneway {
+		s.hedge = newHedgeState(route.RouteRule().Policy().HedgePolicy(), s.clusterLatency, s.upstreamRequest)
+	}
+
 	//Call upstream's append header method to build upstream's request
 	s.upstreamRequest.appendHeaders(headers, endStream)
 
 	if endStream {
 		s.onUpstreamRequestSent()
+		s.sendMirror()
 	}
 }
 
@@ -287,8 +409,43 @@ func (s *downStream) doReceiveData(filter *activeStreamReceiverFilter, data type
 		return
 	}
 
+	if s.bufferPacedData(data, endStream) {
+		return
+	}
+
+	s.forwardData(data, endStream)
+}
+
+// bufferPacedData buffers the data if the request is waiting for the rate limiter,
+// returns false if the headers are sent already
+func (s *downStream) bufferPacedData(data types.IoBuffer, endStream bool) bool {
+	s.paceMux.Lock()
+	defer s.paceMux.Unlock()
+
+	if !s.pacing {
+		return false
+	}
+
+	if s.downstreamReqDataBuf == nil {
+		s.downstreamReqDataBuf = buffer.NewIoBuffer(data.Len())
+	}
+	if s.downstreamReqDataBuf != data {
+		s.downstreamReqDataBuf.ReadFrom(data)
+	}
+	s.pacedData, s.pacedDataEnd = s.downstreamReqDataBuf, endStream
+
+	return true
+}
+
+func (s *downStream) forwardData(data types.IoBuffer, endStream bool) {
+	// data may be drained by upstream request, copy it before
+	if s.mirror != nil {
+		s.mirror.appendData(data)
+	}
+
 	shouldBufData := false
-	if s.retryState != nil && s.retryState.retryOn {
+	// request is buffered to be sent again by retry or hedge
+	if (s.retryState != nil && s.retryState.retryOn) || s.hedge != nil {
 		shouldBufData = true
 
 		// todo: set a buf limit
@@ -316,6 +473,10 @@ func (s *downStream) doReceiveData(filter *activeStreamReceiverFilter, data type
 		s.upstreamRequest.appendData(data, endStream)
 	}
 
+	if endStream {
+		s.sendMirror()
+	}
+
 	// if upstream process done in the middle of receiving data, just end stream
 	if s.upstreamProcessDone {
 		s.cleanStream()
@@ -359,8 +520,35 @@ func (s *downStream) doReceiveTrailers(filter *activeStreamReceiverFilter, trail
 	}
 
 	s.downstreamReqTrailers = trailers
+	if s.bufferPacedTrailers(trailers) {
+		return
+	}
+
+	s.forwardTrailers(trailers)
+}
+
+// bufferPacedTrailers buffers the trailers if the request is waiting for the rate limiter,
+// returns false if the headers are sent already
+func (s *downStream) bufferPacedTrailers(trailers map[string]string) bool {
+	s.paceMux.Lock()
+	defer s.paceMux.Unlock()
+
+	if !s.pacing {
+		return false
+	}
+
+	s.pacedTrailers = trailers
+
+	return true
+}
+
+func (s *downStream) forwardTrailers(trailers map[string]string) {
+	if s.mirror != nil {
+		s.mirror.appendTrailers(trailers)
+	}
 	s.onUpstreamRequestSent()
 	s.upstreamRequest.appendTrailers(trailers)
+	s.sendMirror()
 
 	// if upstream process done in the middle of receiving trailers, just end stream
 	if s.upstreamProcessDone {
@@ -368,11 +556,76 @@ func (s *downStream) doReceiveTrailers(filter *activeStreamReceiverFilter, trail
 	}
 }
 
+// paceUpstream reserves a slot of the rate limiter of the cluster for the upstream request, the request
+// over the rate is sent by send after waiting, or is shed if the queue of the rate limiter is full.
+// Returns false if the request should be sent now
+func (s *downStream) paceUpstream(send func()) bool {
+	limiter := s.cluster.RateLimiter()
+	if limiter == nil {
+		return false
+	}
+
+	delay, ok := limiter.Reserve()
+	if !ok {
+		s.logger.Debugf("request shed by the rate limit of cluster %s", s.cluster.Name())
+		s.cluster.Stats().UpstreamRequestRateLimited.Inc(1)
+		s.requestInfo.SetResponseFlag(types.RateLimited)
+		s.sendHijackReply(types.RateLimitedCode, s.downstreamReqHeaders)
+		s.cleanUp()
+
+		return true
+	}
+
+	if delay <= 0 {
+		return false
+	}
+
+	s.cluster.Stats().UpstreamRequestPaced.Inc(1)
+	s.paceMux.Lock()
+	s.pacing = true
+	s.paceMux.Unlock()
+
+	// pacing is cleared after the request is sent, so that the data received meanwhile
+	// is buffered and sent after the headers
+	s.paceTimer = newTimer(func() {
+		s.paceMux.Lock()
+		defer s.paceMux.Unlock()
+
+		if atomic.LoadUint32(&s.downstreamCleaned) == 1 || s.upstreamProcessDone {
+			return
+		}
+
+		send()
+		s.pacing = false
+	}, delay)
+	s.paceTimer.start()
+
+	return true
+}
+
+// onPaced sends the request waited for the rate limiter, with the data and trailers passed the filters meanwhile,
+// the data held by filters is sent on continued
+func (s *downStream) onPaced(pool types.ConnectionPool, headers map[string]string, endStream bool) {
+	data, dataEnd, trailers := s.pacedData, s.pacedDataEnd, s.pacedTrailers
+	s.pacedData, s.pacedTrailers = nil, nil
+
+	s.forwardHeaders(pool, headers, endStream)
+
+	if data != nil {
+		s.forwardData(data, dataEnd)
+	}
+
+	if trailers != nil {
+		s.forwardTrailers(trailers)
+	}
+}
+
 func (s *downStream) onUpstreamRequestSent() {
 	s.upstreamRequestSent = true
 	s.requestInfo.SetRequestReceivedDuration(time.Now())
 
-	if s.upstreamRequest != nil {
+	// no response is expected for oneway request, no need to wait
+	if s.upstreamRequest != nil && !s.oneway {
 		// setup per req timeout timer
 		s.setupPerReqTimeout()
 
@@ -384,10 +637,26 @@ func (s *downStream) onUpstreamRequestSent() {
 
 			s.responseTimer = newTimer(s.onResponseTimeout, s.timeout.GlobalTimeout)
 			s.responseTimer.start()
+
+			// retry should not exceed the global timeout
+			if s.retryState != nil {
+				s.retryState.deadline = time.Now().Add(s.timeout.GlobalTimeout)
+			}
+		}
+
+		// setup hedge timer
+		if s.hedge != nil {
+			s.setupHedge()
 		}
 	}
 }
 
+// oneway request ends on upstream request sent, no response is sent back to downstream
+func (s *downStream) onOnewayRequestSent() {
+	s.upstreamProcessDone = true
+	s.cleanStream()
+}
+
 // Note: global-timer MUST be stopped before active stream got recycled, otherwise resetting stream's properties will cause panic here
 func (s *downStream) onResponseTimeout() {
 	s.responseTimer = nil
@@ -412,7 +681,7 @@ func (s *downStream) setupPerReqTimeout() {
 			s.perRetryTimer.stop()
 		}
 
-		s.perRetryTimer = newTimer(s.onPerReqTimeout, timeout.TryTimeout*time.Second)
+		s.perRetryTimer = newTimer(s.onPerReqTimeout, timeout.TryTimeout)
 		s.perRetryTimer.start()
 	}
 }
@@ -437,12 +706,78 @@ func (s *downStream) onPerReqTimeout() {
 	}
 }
 
+// isWebSocketUpgrade returns true if the request upgrades a http/1.1 connection to websocket,
+// which is tunneled to a http/1.1 upstream
+func (s *downStream) isWebSocketUpgrade(headers map[string]string) bool {
+	return s.proxy.downstreamProtocol() == protocol.Http1 &&
+		s.upstreamProtocol() == protocol.Http1 &&
+		isWebSocketUpgrade(headers)
+}
+
+// startWebSocketTunnel hands over the downstream connection to a tunnel to a host of the cluster,
+// the handshake is completed by the host, and the request is done from the view of proxy
+func (s *downStream) startWebSocketTunnel(clusterName string, headers map[string]string) {
+	tunnel, err := newWebSocketTunnel(s.proxy, clusterName, s)
+
+	if err != nil {
+		s.logger.Errorf("websocket upgrade to cluster %s failed: %v", clusterName, err)
+		s.upstreamStatus = upstreamStatus(sofarpc.ResponseErrorConnection)
+		s.requestInfo.SetResponseFlag(types.UpstreamConnectionFailure)
+		s.sendHijackReply(types.NoHealthUpstreamCode, headers)
+
+		return
+	}
+
+	s.requestInfo.OnUpstreamHostSelected(tunnel.host)
+	s.proxy.setWebSocketTunnel(tunnel)
+	tunnel.upgrade(headers)
+
+	s.downstreamRecvDone = true
+	s.upstreamProcessDone = true
+	s.cleanStream()
+}
+
+// sendMirror mirrors the request to the shadow cluster once the whole request is received
+func (s *downStream) sendMirror() {
+	if s.mirror != nil {
+		s.mirror.send()
+		s.mirror = nil
+	}
+}
+
+// upstreamClusterName returns the cluster of the route, or the failover cluster of the route
+// if the cluster has no healthy host. Retries and hedges of the request go to the cluster returned
+func (s *downStream) upstreamClusterName(rule types.RouteRule) string {
+	clusterName := rule.ClusterName()
+	failover := rule.FailoverClusterName()
+
+	if failover == "" {
+		return clusterName
+	}
+
+	clusterSnapshot := s.proxy.clusterManager.Get(nil, clusterName)
+
+	if !reflect.ValueOf(clusterSnapshot).IsNil() {
+		for _, hostSet := range clusterSnapshot.PrioritySet().HostSetsByPriority() {
+			if len(hostSet.HealthyHosts()) > 0 {
+				return clusterName
+			}
+		}
+
+		clusterSnapshot.ClusterInfo().Stats().UpstreamRequestFailover.Inc(1)
+	}
+
+	s.logger.Debugf("no healthy host in cluster %s, failover to cluster %s", clusterName, failover)
+
+	return failover
+}
+
 func (s *downStream) initializeUpstreamConnectionPool(clusterName string, lbCtx types.LoadBalancerContext) (error, types.ConnectionPool) {
 	clusterSnapshot := s.proxy.clusterManager.Get(nil, clusterName)
 
 	if reflect.ValueOf(clusterSnapshot).IsNil() {
 		// no available cluster
-		log.DefaultLogger.Errorf("cluster snapshot is nil, cluster name is: %s", clusterName)
+		s.logger.Errorf("cluster snapshot is nil, cluster name is: %s", clusterName)
 		s.requestInfo.SetResponseFlag(types.NoRouteFound)
 		s.sendHijackReply(types.RouterUnavailableCode, s.downstreamReqHeaders)
 
@@ -450,23 +785,24 @@ func (s *downStream) initializeUpstreamConnectionPool(clusterName string, lbCtx
 	}
 
 	s.cluster = clusterSnapshot.ClusterInfo()
-	var connPool types.ConnectionPool
-
-	// todo: refactor
-	switch types.Protocol(s.proxy.config.UpstreamProtocol) {
-	case protocol.SofaRpc:
-		connPool = s.proxy.clusterManager.SofaRpcConnPoolForCluster(clusterName, lbCtx)
-	case protocol.Http2:
-		connPool = s.proxy.clusterManager.HttpConnPoolForCluster(clusterName, protocol.Http2, lbCtx)
-	case protocol.Http1:
-		connPool = s.proxy.clusterManager.HttpConnPoolForCluster(clusterName, protocol.Http1, lbCtx)
-	case protocol.Xprotocol:
-		connPool = s.proxy.clusterManager.XprotocolConnPoolForCluster(clusterName, protocol.Xprotocol, nil)
-	default:
-		connPool = s.proxy.clusterManager.HttpConnPoolForCluster(clusterName, protocol.Http2, lbCtx)
+
+	// retried requests are counted once
+	if s.clusterTags == nil {
+		s.clusterTags = stats.Tags{
+			stats.TagCluster:  clusterName,
+			stats.TagProtocol: string(s.proxy.downstreamProtocol()),
+		}
+		s.clusterLatency = stats.GetClusterLatency(clusterName, string(s.proxy.downstreamProtocol()))
+
+		sink := stats.GetSink()
+		sink.Count(stats.ClusterRequestsTotal, 1, s.clusterTags)
+		sink.Gauge(stats.ClusterRequestsActive, 1, s.clusterTags)
 	}
 
+	connPool := s.proxy.connPoolForCluster(clusterName, s.upstreamProtocol(), lbCtx)
+
 	if connPool == nil {
+		s.upstreamStatus = upstreamStatus(sofarpc.ResponseErrorConnection)
 		s.requestInfo.SetResponseFlag(types.NoHealthyUpstream)
 		s.sendHijackReply(types.NoHealthUpstreamCode, s.downstreamReqHeaders)
 
@@ -542,12 +878,26 @@ func (s *downStream) onUpstreamReset(urtype UpstreamResetType, reason types.Stre
 	// todo: update stats
 	log.StartLogger.Tracef("on upstream reset invoked")
 
-	// see if we need a retry
-	if urtype != UpstreamGlobalTimeout &&
-		s.downstreamResponseStarted && s.retryState != nil {
+	// the racing requests of hedge are reset as well, e.g. on timeout
+	s.cancelHedges()
+
+	// timeouts and failures of the upstream count as server errors of the host, while the
+	// resets caused by mosn itself, e.g. circuit breaker, don't
+	switch {
+	case urtype == UpstreamGlobalTimeout || urtype == UpstreamPerTryTimeout,
+		reason == types.StreamConnectionFailed, reason == types.StreamConnectionTermination,
+		reason == types.StreamRemoteReset:
+		s.putOutlierResult(types.OutlierResultServerError)
+	}
+
+	// see if we need a retry, the request may be processed already if the response is started
+	if urtype == UpstreamReset &&
+		!s.downstreamResponseStarted && s.retryState != nil {
 		retryCheck := s.retryState.retry(nil, reason, s.doRetry)
 
 		if retryCheck == types.ShouldRetry && s.setupRetry(true) {
+			// the reset of the retried request is handled as well
+			atomic.StoreUint32(&s.upstreamReset, 0)
 			// setup retry timer and return
 			return
 		} else if retryCheck == types.RetryOverflow {
@@ -557,6 +907,14 @@ func (s *downStream) onUpstreamReset(urtype UpstreamResetType, reason types.Stre
 
 	// clean up all timers
 	s.cleanUp()
+
+	if urtype == UpstreamGlobalTimeout || urtype == UpstreamPerTryTimeout {
+		s.upstreamStatus = upstreamStatus(sofarpc.ResponseErrorTimeout)
+	} else if reason == types.StreamOverflow {
+		s.upstreamStatus = upstreamStatus(sofarpc.ResponseErrorClient)
+	} else {
+		s.upstreamStatus = upstreamStatus(sofarpc.ResponseErrorConnection)
+	}
 	/*
 
 		if reason == types.StreamOverflow || reason == types.StreamConnectionFailed ||
@@ -583,7 +941,16 @@ func (s *downStream) onUpstreamReset(urtype UpstreamResetType, reason types.Stre
 		} else {
 			reasonFlag := s.proxy.streamResetReasonToResponseFlag(reason)
 			s.requestInfo.SetResponseFlag(reasonFlag)
-			code = types.NoHealthUpstreamCode
+
+			// circuit breaker is open, fail fast with overflow status
+			if reason == types.StreamOverflow {
+				code = types.UpstreamOverFlowCode
+			} else if reason == types.StreamResponseTooLarge {
+				s.cluster.Stats().UpstreamResponseTooLarge.Inc(1)
+				code = types.PayloadTooLargeCode
+			} else {
+				code = types.NoHealthUpstreamCode
+			}
 		}
 
 		s.sendHijackReply(code, s.downstreamReqHeaders)
@@ -591,7 +958,12 @@ func (s *downStream) onUpstreamReset(urtype UpstreamResetType, reason types.Stre
 }
 
 func (s *downStream) onUpstreamHeaders(headers map[string]string, endStream bool) {
+	if s.convertFromBolt() {
+		headers = sofarpc.Http2ToBoltResponse(headers, s.downstreamReqHeaders)
+	}
+
 	s.downstreamRespHeaders = headers
+	s.recordUpstreamResponseStatus(headers)
 
 	// check retry
 	if s.retryState != nil {
@@ -614,10 +986,142 @@ func (s *downStream) onUpstreamHeaders(headers map[string]string, endStream bool
 		s.onUpstreamResponseRecvFinished()
 	}
 
+	s.setAffinityToken(headers)
+
+	if s.route != nil {
+		s.route.RouteRule().FinalizeResponseHeaders(headers, s.requestInfo)
+	}
+
+	if s.convertToBolt() {
+		headers = sofarpc.BoltToHttp2Response(headers)
+	}
+
 	// todo: insert proxy headers
 	s.appendHeaders(headers, endStream)
 }
 
+// setAffinityToken sets the affinity token of the upstream host in response if the session affinity
+// of the cluster is enabled, and the request is not pinned to the host yet
+func (s *downStream) setAffinityToken(headers map[string]string) {
+	if s.cluster == nil {
+		return
+	}
+
+	affinity := s.cluster.SessionAffinity()
+	host := s.requestInfo.UpstreamHost()
+	if affinity.Header == "" || host == nil {
+		return
+	}
+
+	if token := types.AffinityToken(affinity.Secret, host.AddressString()); s.downstreamReqHeaders[affinity.Header] != token {
+		headers[affinity.Header] = token
+	}
+}
+
+// starts a span if tracing is enabled, the trace context is propagated to upstream in bolt headers
+func (s *downStream) startSpan(headers map[string]string) {
+	driver := trace.GetDriver()
+	if driver == nil {
+		return
+	}
+
+	operation := s.requestContext.ClassName()
+	if operation == "" {
+		operation = s.requestContext.Service()
+	}
+
+	s.span = driver.Start(headers, operation, s.requestInfo.StartTime())
+	s.span.SetTag(types.SpanTagProtocol, string(s.proxy.downstreamProtocol()))
+	s.span.SetTag(types.SpanTagCluster, s.cluster.Name())
+	s.span.InjectContext()
+}
+
+func (s *downStream) finishSpan() {
+	if s.span == nil {
+		return
+	}
+
+	if host := s.requestInfo.UpstreamHost(); host != nil {
+		s.span.SetTag(types.SpanTagUpstreamHost, host.AddressString())
+	}
+	if s.upstreamStatus != "" {
+		s.span.SetTag(types.SpanTagStatus, s.upstreamStatus)
+	}
+
+	s.span.FinishSpan()
+}
+
+// upstreamProtocol returns the protocol of the requests sent to the upstream cluster
+func (s *downStream) upstreamProtocol() types.Protocol {
+	return s.proxy.upstreamProtocol(s.cluster)
+}
+
+// http requests are converted to bolt requests if upstream protocol is sofarpc
+func (s *downStream) convertToBolt() bool {
+	downstreamProtocol := s.proxy.downstreamProtocol()
+
+	return (downstreamProtocol == protocol.Http2 || downstreamProtocol == protocol.Http1) &&
+		s.upstreamProtocol() == protocol.SofaRpc
+}
+
+// bolt requests are converted to http2 requests if the cluster declares http2 as its upstream protocol,
+// requests to the clusters without declared protocol are sent as they are
+func (s *downStream) convertFromBolt() bool {
+	return s.cluster != nil && s.cluster.UpstreamProtocol() == protocol.Http2 &&
+		s.proxy.downstreamProtocol() == protocol.SofaRpc
+}
+
+func (s *downStream) recordUpstreamResponseStatus(headers map[string]string) {
+	// http response, 5xx is a server error of the host
+	if code, ok := headers[types.HeaderStatus]; ok {
+		s.upstreamStatus = UpstreamStatusSuccess
+
+		if codeValue, _ := strconv.Atoi(code); codeValue >= 500 {
+			s.putOutlierResult(types.OutlierResultServerError)
+		} else {
+			s.putOutlierResult(types.OutlierResultSuccess)
+		}
+
+		return
+	}
+
+	status, ok := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)]
+
+	if !ok {
+		s.upstreamStatus = UpstreamStatusSuccess
+		return
+	}
+
+	statusValue, _ := strconv.Atoi(status)
+	s.requestInfo.SetResponseCode(uint32(statusValue))
+	respErr := sofarpc.ResponseStatusToError(int16(statusValue))
+	s.upstreamStatus = upstreamStatus(respErr.Type)
+
+	if respErr.Type != sofarpc.ResponseErrorNone {
+		s.proxy.stats.UpstreamResponseError(respErr.Type).Inc(1)
+		log.DefaultLogger.Debugf("upstream response error, streamId = %s, status = %s, type = %s",
+			s.streamId, status, respErr.Type)
+	}
+
+	switch respErr.Type {
+	case sofarpc.ResponseErrorServer, sofarpc.ResponseErrorServerBusy:
+		s.putOutlierResult(types.OutlierResultServerError)
+	default:
+		s.putOutlierResult(types.OutlierResultSuccess)
+	}
+}
+
+// putOutlierResult reports the result of the request to the outlier detection of upstream host
+func (s *downStream) putOutlierResult(result types.OutlierResult) {
+	if s.upstreamRequest == nil || s.upstreamRequest.host == nil {
+		return
+	}
+
+	if detector := s.upstreamRequest.host.OutlierDetector(); detector != nil {
+		detector.PutResult(result)
+	}
+}
+
 func (s *downStream) onUpstreamData(data types.IoBuffer, endStream bool) {
 	if endStream {
 		s.onUpstreamResponseRecvFinished()
@@ -652,6 +1156,7 @@ func (s *downStream) setupRetry(endStream bool) bool {
 		s.upstreamRequest.resetStream()
 	}
 
+	s.upstreamRequest.readDisable(false)
 	s.upstreamRequest.requestSender = nil
 
 	// reset per req timer
@@ -665,7 +1170,7 @@ func (s *downStream) setupRetry(endStream bool) bool {
 
 // Note: retry-timer MUST be stopped before active stream got recycled, otherwise resetting stream's properties will cause panic here
 func (s *downStream) doRetry() {
-	err, pool := s.initializeUpstreamConnectionPool(s.cluster.Name(), nil)
+	err, pool := s.initializeUpstreamConnectionPool(s.cluster.Name(), s)
 
 	if err != nil {
 		s.sendHijackReply(types.NoHealthUpstreamCode, s.downstreamReqHeaders)
@@ -673,6 +1178,16 @@ func (s *downStream) doRetry() {
 		return
 	}
 
+	// retries are paced by the rate limiter of the cluster as well
+	if s.paceUpstream(func() { s.retryUpstream(pool) }) {
+		return
+	}
+
+	s.retryUpstream(pool)
+}
+
+func (s *downStream) retryUpstream(pool types.ConnectionPool) {
+
 	s.upstreamRequest = &upstreamRequest{
 		downStream: s,
 		proxy:      s.proxy,
@@ -680,7 +1195,7 @@ func (s *downStream) doRetry() {
 	}
 
 	s.upstreamRequest.appendHeaders(s.downstreamReqHeaders,
-		s.downstreamReqDataBuf != nil && s.downstreamReqTrailers != nil)
+		s.downstreamReqDataBuf == nil && s.downstreamReqTrailers == nil)
 
 	if s.upstreamRequest != nil {
 		if s.downstreamReqDataBuf != nil {
@@ -698,6 +1213,26 @@ func (s *downStream) doRetry() {
 	}
 }
 
+// readDisableUpstream pauses or resumes reading the responses of the upstream requests in flight,
+// including the hedged ones
+func (s *downStream) readDisableUpstream(disable bool) {
+	if s.hedge != nil {
+		s.hedge.mux.Lock()
+		requests := append([]*upstreamRequest(nil), s.hedge.requests...)
+		s.hedge.mux.Unlock()
+
+		for _, r := range requests {
+			r.readDisable(disable)
+		}
+
+		return
+	}
+
+	if s.upstreamRequest != nil {
+		s.upstreamRequest.readDisable(disable)
+	}
+}
+
 func (s *downStream) onUpstreamAboveWriteBufferHighWatermark() {
 	s.responseSender.GetStream().ReadDisable(true)
 }
@@ -714,10 +1249,12 @@ func (s *downStream) resetStream() {
 }
 
 func (s *downStream) sendHijackReply(code int, headers map[string]string) {
-	if headers == nil {
+	// request headers may be converted to bolt, which are not expected in http2 response
+	if headers == nil || s.convertToBolt() {
 		headers = make(map[string]string, 5)
 	}
 
+	s.requestInfo.SetResponseCode(uint32(code))
 	headers[types.HeaderStatus] = strconv.Itoa(code)
 	s.appendHeaders(headers, true)
 }
@@ -726,6 +1263,7 @@ func (s *downStream) cleanUp() {
 	// reset upstream request
 	// if a downstream filter ends downstream before send to upstream, upstreamRequest will be nil
 	if s.upstreamRequest != nil {
+		s.upstreamRequest.readDisable(false)
 		s.upstreamRequest.requestSender = nil
 	}
 
@@ -741,11 +1279,20 @@ func (s *downStream) cleanUp() {
 		s.perRetryTimer = nil
 	}
 
+	// stop hedging
+	s.cancelHedges()
+
 	// reset response timer
 	if s.responseTimer != nil {
 		s.responseTimer.stop()
 		s.responseTimer = nil
 	}
+
+	// stop waiting for the rate limiter
+	if s.paceTimer != nil {
+		s.paceTimer.stop()
+		s.paceTimer = nil
+	}
 }
 
 func (s *downStream) setBufferLimit(bufferLimit uint32) {
@@ -772,7 +1319,14 @@ func (s *downStream) reset() {
 	s.element = nil
 	s.timeout = nil
 	s.retryState = nil
+	s.triedHosts = nil
 	s.requestInfo = nil
+	s.clusterTags = nil
+	s.clusterLatency = nil
+	s.upstreamStatus = ""
+	s.span = nil
+	s.mirror = nil
+	s.hedge = nil
 	s.responseSender = nil
 	s.upstreamRequest.downStream = nil
 	s.upstreamRequest.requestSender = nil
@@ -781,6 +1335,11 @@ func (s *downStream) reset() {
 	s.upstreamRequest = nil
 	s.perRetryTimer = nil
 	s.responseTimer = nil
+	s.paceTimer = nil
+	s.pacing = false
+	s.pacedData = nil
+	s.pacedTrailers = nil
+	s.oneway = false
 	s.downstreamRespHeaders = nil
 	s.downstreamReqDataBuf = nil
 	s.downstreamReqTrailers = nil
@@ -813,3 +1372,13 @@ func (s *downStream) DownstreamConnection() net.Conn {
 func (s *downStream) DownstreamHeaders() map[string]string {
 	return s.downstreamReqHeaders
 }
+
+func (s *downStream) ShouldSelectAnotherHost(host types.Host) bool {
+	for _, h := range s.triedHosts {
+		if h == host {
+			return true
+		}
+	}
+
+	return false
+}
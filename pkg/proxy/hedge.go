@@ -0,0 +1,298 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// percentile based hedge delay is used only if the cluster has enough latency samples
+const hedgeMinLatencySamples = 100
+
+// hedgeState sends duplicates of the request to other hosts of the cluster if no upstream
+// response is received within the hedge delay. The first upstream response wins the race,
+// it is the only one sent back to downstream, and the other upstream requests are cancelled.
+type hedgeState struct {
+	delay           time.Duration
+	hedgesRemaining uint32
+	timer           *timer
+
+	// upstream requests racing for the response, including the origin one
+	requests []*upstreamRequest
+	// requests lost the race, their responses and resets are ignored
+	cancelled map[*upstreamRequest]bool
+	// the race is over on the first upstream response, or if all upstream requests failed
+	finished bool
+
+	mux sync.Mutex
+}
+
+// newHedgeState returns nil if the request should not be hedged
+func newHedgeState(policy types.HedgePolicy, clusterLatency *stats.LatencyHistogram, request *upstreamRequest) *hedgeState {
+	if policy == nil || policy.MaxHedges() == 0 {
+		return nil
+	}
+
+	delay := policy.HedgeDelay()
+
+	if percentile := policy.HedgeDelayPercentile(); percentile > 0 {
+		if clusterLatency == nil || clusterLatency.Count() < hedgeMinLatencySamples {
+			return nil
+		}
+
+		delay = clusterLatency.Percentile(percentile)
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	return &hedgeState{
+		delay:           delay,
+		hedgesRemaining: policy.MaxHedges(),
+		requests:        []*upstreamRequest{request},
+		cancelled:       make(map[*upstreamRequest]bool),
+	}
+}
+
+// finish ends the race, requests except the winner are cancelled and returned to be reset
+func (h *hedgeState) finish(winner *upstreamRequest) []*upstreamRequest {
+	h.finished = true
+
+	if h.timer != nil {
+		h.timer.stop()
+		h.timer = nil
+	}
+
+	var losers []*upstreamRequest
+
+	for _, r := range h.requests {
+		if r != winner {
+			h.cancelled[r] = true
+			losers = append(losers, r)
+		}
+	}
+	h.requests = nil
+
+	return losers
+}
+
+func (h *hedgeState) remove(request *upstreamRequest) {
+	for i, r := range h.requests {
+		if r == request {
+			h.requests = append(h.requests[:i], h.requests[i+1:]...)
+			return
+		}
+	}
+}
+
+// setupHedge starts the hedge timer once the whole request is sent upstream
+func (s *downStream) setupHedge() {
+	h := s.hedge
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.finished || h.hedgesRemaining == 0 || h.timer != nil {
+		return
+	}
+
+	h.timer = newTimer(s.onHedgeTimeout, h.delay)
+	h.timer.start()
+}
+
+// Note: hedge-timer MUST be stopped before active stream got recycled, otherwise resetting stream's properties will cause panic here
+func (s *downStream) onHedgeTimeout() {
+	h := s.hedge
+
+	h.mux.Lock()
+	h.timer = nil
+	if h.finished || h.hedgesRemaining == 0 {
+		h.mux.Unlock()
+		return
+	}
+	h.hedgesRemaining--
+	h.mux.Unlock()
+
+	s.sendHedge()
+	s.setupHedge()
+}
+
+// sendHedge sends a duplicate of the buffered request, the load balancer skips the hosts already tried
+func (s *downStream) sendHedge() {
+	pool := s.proxy.connPoolForCluster(s.cluster.Name(), s.upstreamProtocol(), s)
+	if pool == nil {
+		return
+	}
+
+	request := &upstreamRequest{
+		downStream: s,
+		proxy:      s.proxy,
+		connPool:   pool,
+		hedged:     true,
+	}
+
+	h := s.hedge
+	h.mux.Lock()
+	if h.finished {
+		h.mux.Unlock()
+		return
+	}
+	h.requests = append(h.requests, request)
+	h.mux.Unlock()
+
+	s.cluster.Stats().UpstreamRequestHedge.Inc(1)
+	s.logger.Debugf("hedge request of stream %s after %v", s.streamId, h.delay)
+
+	request.appendHeaders(s.downstreamReqHeaders,
+		s.downstreamReqDataBuf == nil && s.downstreamReqTrailers == nil)
+
+	// the duplicate is dropped if no other host is available
+	if request.requestSender == nil {
+		return
+	}
+
+	if s.downstreamReqDataBuf != nil {
+		copied := s.downstreamReqDataBuf.Clone()
+		request.appendData(copied, s.downstreamReqTrailers == nil)
+	}
+
+	if s.downstreamReqTrailers != nil {
+		request.appendTrailers(s.downstreamReqTrailers)
+	}
+}
+
+// onHedgeReady returns false if the duplicate request should not be sent, because its host
+// is already tried, or the race is over
+func (s *downStream) onHedgeReady(request *upstreamRequest, host types.Host) bool {
+	h := s.hedge
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.finished || h.cancelled[request] {
+		return false
+	}
+
+	for _, tried := range s.triedHosts {
+		if tried == host {
+			h.remove(request)
+			h.cancelled[request] = true
+
+			return false
+		}
+	}
+
+	s.triedHosts = append(s.triedHosts, host)
+
+	return true
+}
+
+// acceptResponse returns false if the upstream response should be discarded. The first
+// responding upstream request wins the race, and the others are cancelled.
+func (s *downStream) acceptResponse(request *upstreamRequest) bool {
+	h := s.hedge
+	if h == nil {
+		return true
+	}
+
+	h.mux.Lock()
+	if h.cancelled[request] {
+		h.mux.Unlock()
+		return false
+	}
+
+	var losers []*upstreamRequest
+
+	if !h.finished {
+		losers = h.finish(request)
+		s.upstreamRequest = request
+
+		if request.host != nil {
+			s.requestInfo.OnUpstreamHostSelected(request.host)
+			s.requestInfo.SetUpstreamLocalAddress(request.host.Address())
+		}
+	}
+	h.mux.Unlock()
+
+	for _, r := range losers {
+		r.resetStream()
+	}
+
+	return true
+}
+
+// dropUpstreamRequest returns true if the reset of upstream request should be ignored,
+// which happens if it is cancelled, or other requests are still racing for the response
+func (s *downStream) dropUpstreamRequest(request *upstreamRequest) bool {
+	h := s.hedge
+	if h == nil {
+		return false
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.cancelled[request] {
+		return true
+	}
+
+	if h.finished {
+		return false
+	}
+
+	h.remove(request)
+
+	if len(h.requests) > 0 {
+		if s.upstreamRequest == request {
+			s.upstreamRequest = h.requests[0]
+		}
+
+		return true
+	}
+
+	// all upstream requests failed
+	h.finish(nil)
+	s.upstreamRequest = request
+
+	return false
+}
+
+// cancelHedges ends the race on timeout or stream end, the racing requests except
+// the current upstream request are reset
+func (s *downStream) cancelHedges() {
+	h := s.hedge
+	if h == nil {
+		return
+	}
+
+	h.mux.Lock()
+	if h.finished {
+		h.mux.Unlock()
+		return
+	}
+	losers := h.finish(s.upstreamRequest)
+	h.mux.Unlock()
+
+	for _, r := range losers {
+		r.resetStream()
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxy
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// shadow requests are dropped if no response received within the timeout
+// when the route has no global timeout
+const defaultMirrorTimeout = 3 * time.Second
+
+// mirror sends a copy of the downstream request to the shadow cluster of the route.
+// The shadow response is discarded, and the shadow request never affects the
+// primary request, neither its latency nor its result.
+//
+// types.PoolEventListener
+// types.StreamReceiver
+// types.StreamEventListener
+// types.LoadBalancerContext
+type mirror struct {
+	proxy       *proxy
+	clusterName string
+	timeout     time.Duration
+	oneway      bool
+
+	headers  map[string]string
+	data     types.IoBuffer
+	trailers map[string]string
+
+	sender types.StreamSender
+	timer  *time.Timer
+	done   bool
+	mux    sync.Mutex
+
+	logger log.Logger
+}
+
+// newMirror returns a mirror if the request should be mirrored by the route's shadow policy.
+// Requests which are already mirrored are never mirrored again.
+func newMirror(s *downStream, route types.Route, headers map[string]string) *mirror {
+	policy := route.RouteRule().Policy().ShadowPolicy()
+	if policy == nil || policy.ClusterName() == "" {
+		return nil
+	}
+
+	if _, ok := headers[types.HeaderMirror]; ok {
+		return nil
+	}
+
+	if uint32(rand.Intn(100)) >= policy.Percent() {
+		return nil
+	}
+
+	timeout := route.RouteRule().GlobalTimeout()
+	if timeout <= 0 {
+		timeout = defaultMirrorTimeout
+	}
+
+	m := &mirror{
+		proxy:       s.proxy,
+		clusterName: policy.ClusterName(),
+		timeout:     timeout,
+		oneway:      s.oneway,
+		headers:     copyHeaders(headers),
+		logger:      s.logger,
+	}
+	m.headers[types.HeaderMirror] = "true"
+
+	return m
+}
+
+func (m *mirror) appendData(data types.IoBuffer) {
+	if m.data == nil {
+		m.data = data.Clone()
+	} else {
+		m.data.Write(data.Bytes())
+	}
+}
+
+func (m *mirror) appendTrailers(trailers map[string]string) {
+	m.trailers = copyHeaders(trailers)
+}
+
+// send mirrors the buffered request asynchronously, should be called once the whole request is received
+func (m *mirror) send() {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				m.logger.Errorf("mirror request to cluster %s panic: %v", m.clusterName, r)
+			}
+		}()
+
+		// the mirrored request is sent as received, the protocol declared by the mirror cluster is ignored
+		connPool := m.proxy.connPoolForCluster(m.clusterName, types.Protocol(m.proxy.config.UpstreamProtocol), m)
+		if connPool == nil {
+			m.logger.Debugf("no healthy upstream in mirror cluster %s", m.clusterName)
+			return
+		}
+
+		streamID := m.headers[types.HeaderStreamID]
+		connPool.NewStream(m.proxy.context, streamID, m, m)
+	}()
+}
+
+// types.PoolEventListener
+func (m *mirror) OnFailure(streamId string, reason types.PoolFailureReason, host types.Host) {
+	m.logger.Debugf("mirror request to cluster %s failed, reason = %v", m.clusterName, reason)
+}
+
+func (m *mirror) OnReady(streamId string, sender types.StreamSender, host types.Host) {
+	stream := sender.GetStream()
+	stream.AddEventListener(m)
+
+	if !m.oneway {
+		m.mux.Lock()
+		m.sender = sender
+		m.timer = time.AfterFunc(m.timeout, m.onTimeout)
+		m.mux.Unlock()
+	}
+
+	sender.AppendHeaders(m.headers, m.data == nil && m.trailers == nil)
+
+	if m.data != nil {
+		sender.AppendData(m.data, m.trailers == nil)
+	}
+
+	if m.trailers != nil {
+		sender.AppendTrailers(m.trailers)
+	}
+
+	// no response is expected for oneway request, release the stream
+	if m.oneway {
+		stream.RemoveEventListener(m)
+		stream.ResetStream(types.StreamLocalReset)
+	}
+}
+
+func (m *mirror) onTimeout() {
+	m.mux.Lock()
+	if m.done {
+		m.mux.Unlock()
+		return
+	}
+	m.done = true
+	m.mux.Unlock()
+
+	m.logger.Debugf("mirror request to cluster %s timeout", m.clusterName)
+
+	stream := m.sender.GetStream()
+	stream.RemoveEventListener(m)
+	stream.ResetStream(types.StreamLocalReset)
+}
+
+func (m *mirror) finish() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.done = true
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+}
+
+// types.StreamReceiver
+// shadow response is discarded
+func (m *mirror) OnReceiveHeaders(headers map[string]string, endStream bool) {
+	if endStream {
+		m.finish()
+	}
+}
+
+func (m *mirror) OnReceiveData(data types.IoBuffer, endStream bool) {
+	data.Drain(data.Len())
+
+	if endStream {
+		m.finish()
+	}
+}
+
+func (m *mirror) OnReceiveTrailers(trailers map[string]string) {
+	m.finish()
+}
+
+func (m *mirror) OnDecodeError(err error, headers map[string]string) {
+	m.finish()
+}
+
+// types.StreamEventListener
+func (m *mirror) OnResetStream(reason types.StreamResetReason) {
+	m.logger.Debugf("mirror request to cluster %s reset, reason = %v", m.clusterName, reason)
+	m.finish()
+}
+
+// types.LoadBalancerContext
+func (m *mirror) ComputeHashKey() types.HashedValue {
+	return ""
+}
+
+func (m *mirror) MetadataMatchCriteria() types.MetadataMatchCriteria {
+	return nil
+}
+
+func (m *mirror) DownstreamConnection() net.Conn {
+	return nil
+}
+
+func (m *mirror) DownstreamHeaders() map[string]string {
+	return m.headers
+}
+
+func (m *mirror) ShouldSelectAnotherHost(host types.Host) bool {
+	return false
+}
@@ -22,7 +22,9 @@ import (
 	"sync"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
 	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
 	"github.com/alipay/sofamosn/pkg/router"
 	"github.com/alipay/sofamosn/pkg/stream"
 	"github.com/alipay/sofamosn/pkg/types"
@@ -61,6 +63,19 @@ type proxy struct {
 	activeSteams *list.List
 	asMux        sync.RWMutex
 
+	// closes the downstream connection if no active request for config.IdleTimeout, guarded by asMux
+	idleTimer *timer
+
+	// reading upstream responses is paused while the downstream connection is above its
+	// write buffer high watermark, guarded by asMux
+	upstreamReadDisabled bool
+
+	// frames are forwarded by the tunnel once the connection is upgraded to websocket, guarded by asMux
+	tunnel *webSocketTunnel
+
+	// the first bytes of connection are sniffed for unknown protocol, only accessed in OnData
+	sniffed bool
+
 	// stats
 	stats *proxyStats
 
@@ -87,7 +102,12 @@ func NewProxy(config *v2.Proxy, clusterManager types.ClusterManager, ctx context
 
 	listenStatsNamespace := ctx.Value(types.ContextKeyListenerStatsNameSpace).(string)
 	proxy.listenerStats = newListenerStats(listenStatsNamespace)
-	proxy.routers, _ = router.CreateRouteConfig(types.Protocol(config.DownstreamProtocol), config)
+	// routers are shared by connections of the listener, so that route rules can be updated at runtime
+	if listenerName, ok := ctx.Value(types.ContextKeyListenerName).(string); ok {
+		proxy.routers, _ = router.RouteTables.Routers(listenerName, types.Protocol(config.DownstreamProtocol), config)
+	} else {
+		proxy.routers, _ = router.CreateRouteConfig(types.Protocol(config.DownstreamProtocol), config)
+	}
 	proxy.downstreamCallbacks = &downstreamCallbacks{
 		proxy: proxy,
 	}
@@ -96,8 +116,31 @@ func NewProxy(config *v2.Proxy, clusterManager types.ClusterManager, ctx context
 }
 
 func (p *proxy) OnData(buf types.IoBuffer) types.FilterStatus {
+	if t := p.webSocketTunnel(); t != nil {
+		t.onDownstreamData(buf)
+
+		return types.StopIteration
+	}
+
+	if !p.sniffed {
+		switch sniffProtocol(types.Protocol(p.config.DownstreamProtocol), buf.Bytes()) {
+		case sniffMore:
+			return types.StopIteration
+		case sniffUnknown:
+			p.sniffed = true
+			p.onUnknownProtocol(buf)
+			return types.StopIteration
+		}
+		p.sniffed = true
+	}
+
 	p.serverCodec.Dispatch(buf)
 
+	// data following the upgrade request is left by the codec
+	if t := p.webSocketTunnel(); t != nil && buf.Len() > 0 {
+		t.onDownstreamData(buf)
+	}
+
 	return types.StopIteration
 }
 
@@ -106,6 +149,16 @@ func (p *proxy) onDownstreamEvent(event types.ConnectionEvent) {
 	if event.IsClose() {
 		p.stats.DownstreamConnectionDestroy().Inc(1)
 		p.stats.DownstreamConnectionActive().Dec(1)
+
+		p.asMux.Lock()
+		p.stopIdleTimer()
+		tunnel := p.tunnel
+		p.asMux.Unlock()
+
+		if tunnel != nil {
+			tunnel.onDownstreamEvent(event)
+		}
+
 		var urEleNext *list.Element
 
 		for urEle := p.activeSteams.Front(); urEle != nil; urEle = urEleNext {
@@ -117,14 +170,43 @@ func (p *proxy) onDownstreamEvent(event types.ConnectionEvent) {
 	}
 }
 
+// ReadDisableUpstream pauses or resumes reading the upstream responses of the active requests
 func (p *proxy) ReadDisableUpstream(disable bool) {
-	// TODO
+	p.asMux.Lock()
+	defer p.asMux.Unlock()
+
+	if p.upstreamReadDisabled == disable {
+		return
+	}
+	p.upstreamReadDisabled = disable
+
+	if p.tunnel != nil {
+		p.tunnel.readDisable(disable)
+	}
+
+	for e := p.activeSteams.Front(); e != nil; e = e.Next() {
+		e.Value.(*downStream).readDisableUpstream(disable)
+	}
+}
+
+func (p *proxy) isUpstreamReadDisabled() bool {
+	p.asMux.RLock()
+	defer p.asMux.RUnlock()
+
+	return p.upstreamReadDisabled
 }
 
 func (p *proxy) ReadDisableDownstream(disable bool) {
 	// TODO
 }
 
+func (p *proxy) ActiveStreamsNum() int {
+	p.asMux.RLock()
+	defer p.asMux.RUnlock()
+
+	return p.activeSteams.Len()
+}
+
 func (p *proxy) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {
 	p.readCallbacks = cb
 
@@ -140,6 +222,10 @@ func (p *proxy) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {
 
 	p.readCallbacks.Connection().AddConnectionEventListener(p.downstreamCallbacks)
 	p.serverCodec = stream.CreateServerStreamConnection(p.context, types.Protocol(p.config.DownstreamProtocol), p.readCallbacks.Connection(), p)
+
+	p.asMux.Lock()
+	p.setupIdleTimer()
+	p.asMux.Unlock()
 }
 
 func (p *proxy) OnGoAway() {}
@@ -157,6 +243,7 @@ func (p *proxy) NewStream(streamId string, responseSender types.StreamSender) ty
 
 	p.asMux.Lock()
 	stream.element = p.activeSteams.PushBack(stream)
+	p.stopIdleTimer()
 	p.asMux.Unlock()
 
 	return stream
@@ -178,11 +265,52 @@ func (p *proxy) streamResetReasonToResponseFlag(reason types.StreamResetReason)
 		return types.UpstreamOverflow
 	case types.StreamRemoteReset:
 		return types.UpstreamRemoteReset
+	case types.StreamResponseTooLarge:
+		return types.UpstreamResponseTooLarge
 	}
 
 	return 0
 }
 
+// downstreamProtocol returns the protocol detected on the downstream connection if the configured
+// downstream protocol is auto
+func (p *proxy) downstreamProtocol() types.Protocol {
+	prot := types.Protocol(p.config.DownstreamProtocol)
+
+	if prot == protocol.Auto && p.serverCodec != nil {
+		return p.serverCodec.Protocol()
+	}
+
+	return prot
+}
+
+// upstreamProtocol returns the protocol of the requests sent to the cluster, the one declared by
+// the cluster takes precedence over the configured upstream protocol
+func (p *proxy) upstreamProtocol(cluster types.ClusterInfo) types.Protocol {
+	if cluster != nil && cluster.UpstreamProtocol() != "" {
+		return cluster.UpstreamProtocol()
+	}
+
+	return types.Protocol(p.config.UpstreamProtocol)
+}
+
+// connPoolForCluster returns the upstream connection pool of the cluster by the upstream protocol
+func (p *proxy) connPoolForCluster(clusterName string, prot types.Protocol, lbCtx types.LoadBalancerContext) types.ConnectionPool {
+	// todo: refactor
+	switch prot {
+	case protocol.SofaRpc:
+		return p.clusterManager.SofaRpcConnPoolForCluster(clusterName, lbCtx)
+	case protocol.Http2:
+		return p.clusterManager.HttpConnPoolForCluster(clusterName, protocol.Http2, lbCtx)
+	case protocol.Http1:
+		return p.clusterManager.HttpConnPoolForCluster(clusterName, protocol.Http1, lbCtx)
+	case protocol.Xprotocol:
+		return p.clusterManager.XprotocolConnPoolForCluster(clusterName, protocol.Xprotocol, nil)
+	default:
+		return p.clusterManager.HttpConnPoolForCluster(clusterName, protocol.Http2, lbCtx)
+	}
+}
+
 func (p *proxy) deleteActiveStream(s *downStream) {
 	// reuse decode map
 	if p.resueCodecMaps {
@@ -199,11 +327,80 @@ func (p *proxy) deleteActiveStream(s *downStream) {
 
 	p.asMux.Lock()
 	p.activeSteams.Remove(s.element)
+	if p.activeSteams.Len() == 0 {
+		p.setupIdleTimer()
+	}
 	p.asMux.Unlock()
 
 	//s.reset()
 }
 
+func (p *proxy) webSocketTunnel() *webSocketTunnel {
+	p.asMux.RLock()
+	defer p.asMux.RUnlock()
+
+	return p.tunnel
+}
+
+func (p *proxy) setWebSocketTunnel(t *webSocketTunnel) {
+	p.asMux.Lock()
+	defer p.asMux.Unlock()
+
+	p.tunnel = t
+
+	if p.upstreamReadDisabled {
+		t.readDisable(true)
+	}
+}
+
+// onTunnelActive restarts the idle timer on the frames tunneled in either direction
+func (p *proxy) onTunnelActive() {
+	p.asMux.Lock()
+	if p.activeSteams.Len() == 0 {
+		p.setupIdleTimer()
+	}
+	p.asMux.Unlock()
+}
+
+// setupIdleTimer starts the idle timer of the downstream connection, must be called with asMux held
+func (p *proxy) setupIdleTimer() {
+	if p.config.IdleTimeout <= 0 {
+		return
+	}
+
+	p.stopIdleTimer()
+
+	t := newTimer(nil, p.config.IdleTimeout)
+	t.callback = func() {
+		p.onIdleTimeout(t)
+	}
+	p.idleTimer = t
+	p.idleTimer.start()
+}
+
+// stopIdleTimer must be called with asMux held
+func (p *proxy) stopIdleTimer() {
+	if p.idleTimer != nil {
+		p.idleTimer.stop()
+		p.idleTimer = nil
+	}
+}
+
+func (p *proxy) onIdleTimeout(t *timer) {
+	p.asMux.Lock()
+	// the timer is stopped or restarted in the meantime
+	if p.idleTimer != t || p.activeSteams.Len() > 0 {
+		p.asMux.Unlock()
+		return
+	}
+	p.idleTimer = nil
+	p.asMux.Unlock()
+
+	log.DefaultLogger.Debugf("downstream connection idle for %s, close it", p.config.IdleTimeout)
+	p.stats.DownstreamConnectionIdle().Inc(1)
+	p.readCallbacks.Connection().Close(types.NoFlush, types.LocalClose)
+}
+
 // ConnectionEventListener
 type downstreamCallbacks struct {
 	proxy *proxy
@@ -212,3 +409,13 @@ type downstreamCallbacks struct {
 func (dc *downstreamCallbacks) OnEvent(event types.ConnectionEvent) {
 	dc.proxy.onDownstreamEvent(event)
 }
+
+// types.WriteBufferWatermarkListener
+// the upstreams are not read while the responses are not written to a slow downstream
+func (dc *downstreamCallbacks) OnAboveWriteBufferHighWatermark() {
+	dc.proxy.ReadDisableUpstream(true)
+}
+
+func (dc *downstreamCallbacks) OnBelowWriteBufferLowWatermark() {
+	dc.proxy.ReadDisableUpstream(false)
+}
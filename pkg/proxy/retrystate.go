@@ -21,17 +21,28 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
+const (
+	defaultRetryTimes   = 3
+	defaultRetryBackOff = 25 * time.Millisecond
+)
+
 type retryState struct {
 	retryPolicy     types.RetryPolicy
 	requestHeaders  map[string]string
 	cluster         types.ClusterInfo
 	retryOn         bool
+	retryOnStatus   map[int]bool
+	idempotent      bool
 	retiesRemaining uint32
+	retriesDone     uint32
 	retryFunc       func()
 	retryTimer      *timer
+	// retries must be done before the deadline, zero means no deadline
+	deadline time.Time
 }
 
 func newRetryState(retryPolicy types.RetryPolicy,
@@ -41,13 +52,28 @@ func newRetryState(retryPolicy types.RetryPolicy,
 		requestHeaders:  requestHeaders,
 		cluster:         cluster,
 		retryOn:         retryPolicy.RetryOn(),
-		retiesRemaining: 3,
+		idempotent:      retryPolicy.Idempotent() || requestHeaders[types.HeaderIdempotent] == "true",
+		retiesRemaining: defaultRetryTimes,
 	}
 
-	if retryPolicy.NumRetries() > rs.retiesRemaining {
+	if retryPolicy.NumRetries() > 0 {
 		rs.retiesRemaining = retryPolicy.NumRetries()
 	}
 
+	// the statuses of cluster take precedence, as a status may be retriable for one cluster and terminal for another
+	statuses := retryPolicy.RetryOnStatus()
+	if clusterStatuses := cluster.RetryOnStatus(); len(clusterStatuses) > 0 {
+		statuses = clusterStatuses
+	}
+
+	if len(statuses) > 0 {
+		rs.retryOnStatus = make(map[int]bool, len(statuses))
+
+		for _, status := range statuses {
+			rs.retryOnStatus[status] = true
+		}
+	}
+
 	return rs
 }
 
@@ -56,11 +82,18 @@ func (r *retryState) retry(headers map[string]string, reason types.StreamResetRe
 
 	check := r.shouldRetry(headers, reason)
 
-	if check != 0 {
+	if check != types.ShouldRetry {
 		return check
 	}
 
-	r.retryTimer = r.scheduleRetry(doRetry)
+	backOff := r.backOff()
+
+	// no time left for another try
+	if !r.deadline.IsZero() && time.Now().Add(backOff).After(r.deadline) {
+		return types.NoRetry
+	}
+
+	r.retryTimer = r.scheduleRetry(doRetry, backOff)
 
 	return 0
 }
@@ -76,40 +109,65 @@ func (r *retryState) shouldRetry(headers map[string]string, reason types.StreamR
 		return types.NoRetry
 	}
 
-	if r.cluster.ResourceManager().Retries().CanCreate() {
+	if retries := r.cluster.ResourceManager().Retries(); !retries.CanCreate() {
 		r.cluster.Stats().UpstreamRequestRetryOverflow.Inc(1)
 
+		if _, ok := retries.(types.RetryBudget); ok {
+			r.cluster.Stats().UpstreamRequestRetryBudgetExceeded.Inc(1)
+		}
+
 		return types.RetryOverflow
 	}
 
 	return types.ShouldRetry
 }
 
-func (r *retryState) scheduleRetry(doRetry func()) *timer {
+func (r *retryState) scheduleRetry(doRetry func(), backOff time.Duration) *timer {
 	r.retryFunc = doRetry
+	r.retriesDone++
 	r.cluster.ResourceManager().Retries().Increase()
 	r.cluster.Stats().UpstreamRequestRetry.Inc(1)
 
-	// todo: use backoff alth
-	timeout := rand.Intn(10)
-	timer := newTimer(doRetry, time.Duration(timeout)*time.Second)
+	timer := newTimer(doRetry, backOff)
 	timer.start()
 
 	return timer
 }
 
+// jittered exponential back off, in [0, defaultRetryBackOff * 2^retriesDone)
+func (r *retryState) backOff() time.Duration {
+	return time.Duration(rand.Int63n(int64(defaultRetryBackOff) << r.retriesDone))
+}
+
 func (r *retryState) doRetryCheck(headers map[string]string, reason types.StreamResetReason) bool {
 	if reason == types.StreamOverflow {
 		return false
 	}
 
+	// the connection is closed or failed before any response of the request is received, the request
+	// is never processed by the upstream, e.g. the upstream is restarted, retry it if idempotent
+	if reason == types.StreamConnectionTermination || reason == types.StreamConnectionFailed {
+		return r.idempotent
+	}
+
 	if r.retryOn {
 		if code, ok := headers[types.HeaderStatus]; ok {
 			codeValue, _ := strconv.Atoi(code)
 
+			if r.retryOnStatus != nil {
+				return r.retryOnStatus[codeValue]
+			}
+
 			return codeValue >= 500
 		}
 
+		// sofarpc response status
+		if status, ok := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)]; ok && r.retryOnStatus != nil {
+			statusValue, _ := strconv.Atoi(status)
+
+			return r.retryOnStatus[statusValue]
+		}
+
 		// todo: more conditions
 	}
 
@@ -18,6 +18,7 @@ package proxy
 
 import (
 	"github.com/rcrowley/go-metrics"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/stats"
 )
 
@@ -25,6 +26,7 @@ const (
 	DownstreamConnectionTotal   = "downstream_connection_total"
 	DownstreamConnectionDestroy = "downstream_connection_destroy"
 	DownstreamConnectionActive  = "downstream_connection_active"
+	DownstreamConnectionIdle    = "downstream_connection_idle_timeout"
 	DownstreamBytesRead         = "downstream_bytes_read"
 	DownstreamBytesReadCurrent  = "downstream_bytes_read_current"
 	DownstreamBytesWrite        = "downstream_bytes_write"
@@ -33,8 +35,32 @@ const (
 	DownstreamRequestActive     = "downstream_request_active"
 	DownstreamRequestReset      = "downstream_request_reset"
 	DownstreamRequestTime       = "downstream_request_time"
+	UpstreamResponseError       = "upstream_response_error"
+
+	// flow control of the downstream connection write buffer
+	UpstreamFlowControlPausedReading  = "upstream_flow_control_paused_reading_total"
+	UpstreamFlowControlResumedReading = "upstream_flow_control_resumed_reading_total"
+)
+
+// connections beginning with bytes of no registered protocol, recorded to the metrics sink
+const (
+	UnknownProtocolConnectionsMetric = "mosn_downstream_unknown_protocol_connections_total"
+	TagListener                      = "listener"
+	TagAction                        = "action"
 )
 
+// status of successful upstream responses in cluster request stats,
+// failures are classified by sofarpc.ResponseErrorType
+const UpstreamStatusSuccess = "success"
+
+func upstreamStatus(errType sofarpc.ResponseErrorType) string {
+	if errType == sofarpc.ResponseErrorNone {
+		return UpstreamStatusSuccess
+	}
+
+	return errType.String()
+}
+
 type proxyStats struct {
 	stats *stats.Stats
 }
@@ -46,10 +72,24 @@ func newProxyStats(namespace string) *proxyStats {
 }
 
 func initProxyStats(namespace string) *stats.Stats {
-	return stats.NewStats(namespace).AddCounter(DownstreamConnectionTotal).
-		AddCounter(DownstreamConnectionDestroy).AddCounter(DownstreamConnectionActive).AddCounter(DownstreamBytesRead).
+	s := stats.NewStats(namespace).AddCounter(DownstreamConnectionTotal).
+		AddCounter(DownstreamConnectionDestroy).AddCounter(DownstreamConnectionActive).AddCounter(DownstreamConnectionIdle).AddCounter(DownstreamBytesRead).
 		AddGauge(DownstreamBytesReadCurrent).AddCounter(DownstreamBytesWrite).AddGauge(DownstreamBytesWriteCurrent).
-		AddCounter(DownstreamRequestTotal).AddCounter(DownstreamRequestActive).AddCounter(DownstreamRequestReset).AddHistogram(DownstreamRequestTime)
+		AddCounter(DownstreamRequestTotal).AddCounter(DownstreamRequestActive).AddCounter(DownstreamRequestReset).AddHistogram(DownstreamRequestTime).
+		AddCounter(UpstreamFlowControlPausedReading).AddCounter(UpstreamFlowControlResumedReading)
+
+	// upstream response errors, labeled by category
+	for _, errType := range sofarpc.ResponseErrorTypes {
+		if errType != sofarpc.ResponseErrorNone {
+			s.AddCounter(upstreamResponseErrorName(errType))
+		}
+	}
+
+	return s
+}
+
+func upstreamResponseErrorName(errType sofarpc.ResponseErrorType) string {
+	return UpstreamResponseError + "." + errType.String()
 }
 
 func (s *proxyStats) DownstreamConnectionTotal() metrics.Counter {
@@ -64,6 +104,10 @@ func (s *proxyStats) DownstreamConnectionActive() metrics.Counter {
 	return s.stats.Counter(DownstreamConnectionActive)
 }
 
+func (s *proxyStats) DownstreamConnectionIdle() metrics.Counter {
+	return s.stats.Counter(DownstreamConnectionIdle)
+}
+
 func (s *proxyStats) DownstreamBytesRead() metrics.Counter {
 	return s.stats.Counter(DownstreamBytesRead)
 }
@@ -96,6 +140,18 @@ func (s *proxyStats) DownstreamRequestTime() metrics.Histogram {
 	return s.stats.Histogram(DownstreamRequestTime)
 }
 
+func (s *proxyStats) UpstreamResponseError(errType sofarpc.ResponseErrorType) metrics.Counter {
+	return s.stats.Counter(upstreamResponseErrorName(errType))
+}
+
+func (s *proxyStats) UpstreamFlowControlPausedReading() metrics.Counter {
+	return s.stats.Counter(UpstreamFlowControlPausedReading)
+}
+
+func (s *proxyStats) UpstreamFlowControlResumedReading() metrics.Counter {
+	return s.stats.Counter(UpstreamFlowControlResumedReading)
+}
+
 func (s *proxyStats) String() string {
 	return s.stats.String()
 }
@@ -62,11 +62,10 @@ func (s *downStream) runAppendHeaderFilters(filter *activeStreamSenderFilter, he
 			f.stopped = true
 
 			return true
-		} else {
-			f.headersContinued = true
-
-			return false
 		}
+
+		// continue with the next filter in the chain
+		f.headersContinued = true
 	}
 
 	return false
@@ -163,11 +162,10 @@ func (s *downStream) runReceiveHeadersFilters(filter *activeStreamReceiverFilter
 			f.stopped = true
 
 			return true
-		} else {
-			f.headersContinued = true
-
-			return false
 		}
+
+		// continue with the next filter in the chain
+		f.headersContinued = true
 	}
 
 	return false
@@ -283,6 +281,11 @@ func (f *activeStreamFilter) ResetStream() {
 }
 
 func (f *activeStreamFilter) Route() types.Route {
+	// receive filters run before route matching, match the route on demand
+	if f.activeStream.route == nil && f.activeStream.downstreamReqHeaders != nil {
+		f.activeStream.route = f.activeStream.proxy.routers.Route(f.activeStream.downstreamReqHeaders, 1)
+	}
+
 	return f.activeStream.route
 }
 
@@ -294,6 +297,10 @@ func (f *activeStreamFilter) RequestInfo() types.RequestInfo {
 	return f.activeStream.requestInfo
 }
 
+func (f *activeStreamFilter) RequestContext() types.RequestContext {
+	return f.activeStream.requestContext
+}
+
 // types.StreamReceiverFilterCallbacks
 type activeStreamReceiverFilter struct {
 	activeStreamFilter
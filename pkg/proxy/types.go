@@ -28,6 +28,9 @@ type Proxy interface {
 	ReadDisableUpstream(disable bool)
 
 	ReadDisableDownstream(disable bool)
+
+	// Num of downstream requests in processing
+	ActiveStreamsNum() int
 }
 
 type UpstreamCallbacks interface {
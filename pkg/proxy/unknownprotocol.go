@@ -0,0 +1,93 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxy
+
+import (
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/stream"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// result of sniffing the first bytes of downstream connection
+type sniffResult int
+
+const (
+	sniffMore sniffResult = iota
+	sniffKnown
+	sniffUnknown
+)
+
+// sniffProtocol tells whether the first bytes of connection begin a frame of the downstream protocol,
+// the bytes are only peeked. Only SofaRpc protocol codes are checked, as well as the SofaRpc
+// connections detected by Auto, other protocols are left to their codecs
+func sniffProtocol(prot types.Protocol, data []byte) sniffResult {
+	if prot == protocol.Auto {
+		prot = stream.SelectProtocol(data)
+	}
+
+	switch prot {
+	case protocol.Auto:
+		return sniffMore
+	case protocol.SofaRpc:
+		if len(data) == 0 {
+			return sniffMore
+		}
+
+		if sofarpc.GetProtocol(data[0]) == nil {
+			return sniffUnknown
+		}
+	}
+
+	return sniffKnown
+}
+
+// onUnknownProtocol handles the connection of unknown protocol by the policy of proxy,
+// nothing of the connection is dispatched to the server codec
+func (p *proxy) onUnknownProtocol(buf types.IoBuffer) {
+	policy := p.config.UnknownProtocol
+	if policy.Action == "" {
+		policy.Action = v2.UnknownProtocolClose
+	}
+
+	conn := p.readCallbacks.Connection()
+	listenerName, _ := p.context.Value(types.ContextKeyListenerName).(string)
+	stats.GetSink().Count(UnknownProtocolConnectionsMetric, 1, stats.Tags{TagListener: listenerName, TagAction: string(policy.Action)})
+
+	switch policy.Action {
+	case v2.UnknownProtocolForward:
+		t, err := newWebSocketTunnel(p, policy.Cluster, nil)
+		if err != nil {
+			log.ByContext(p.context).Errorf("forward connection of unknown protocol from %s to cluster %s failed: %v",
+				conn.RemoteAddr(), policy.Cluster, err)
+			conn.Close(types.NoFlush, types.LocalClose)
+			return
+		}
+
+		p.setWebSocketTunnel(t)
+		t.onDownstreamData(buf)
+	case v2.UnknownProtocolCloseSilently:
+		conn.Close(types.NoFlush, types.LocalClose)
+	default:
+		log.ByContext(p.context).Errorf("close connection from %s of unknown protocol, first byte = %x",
+			conn.RemoteAddr(), buf.Bytes()[0])
+		conn.Close(types.NoFlush, types.LocalClose)
+	}
+}
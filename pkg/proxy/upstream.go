@@ -18,8 +18,11 @@ package proxy
 
 import (
 	"container/list"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
@@ -38,9 +41,15 @@ type upstreamRequest struct {
 	upstreamRespHeaders map[string]string
 
 	//~~~ state
+	// duplicate request sent by hedge
+	hedged       bool
 	sendComplete bool
 	dataSent     bool
 	trailerSent  bool
+	// reading the response is paused by the flow control of downstream connection
+	readDisabled bool
+	// counted in the active requests of host, set on dispatched and cleared once on completed
+	active uint32
 }
 
 // reset upstream request in proxy context
@@ -50,18 +59,53 @@ type upstreamRequest struct {
 // 4. on upstream response receive error
 // 5. before a retry
 func (r *upstreamRequest) resetStream() {
+	r.onRequestDone()
+
 	// only reset a alive request sender stream
 	if r.requestSender != nil {
+		r.readDisable(false)
 		r.requestSender.GetStream().RemoveEventListener(r)
 		r.requestSender.GetStream().ResetStream(types.StreamLocalReset)
 	}
 }
 
+// onRequestDone removes the request from the active requests of the host, it is called on response
+// received, stream reset and timeout, and only the first call takes effect
+func (r *upstreamRequest) onRequestDone() {
+	if atomic.CompareAndSwapUint32(&r.active, 1, 0) {
+		r.host.DecActiveRequests()
+	}
+}
+
+// readDisable pauses or resumes reading the upstream response, a paused stream must be
+// resumed before it is released
+func (r *upstreamRequest) readDisable(disable bool) {
+	if r.requestSender == nil || r.readDisabled == disable {
+		return
+	}
+
+	r.readDisabled = disable
+	r.requestSender.GetStream().ReadDisable(disable)
+
+	if disable {
+		r.proxy.stats.UpstreamFlowControlPausedReading().Inc(1)
+	} else {
+		r.proxy.stats.UpstreamFlowControlResumedReading().Inc(1)
+	}
+}
+
 // types.StreamEventListener
 // Called by stream layer normally
 func (r *upstreamRequest) OnResetStream(reason types.StreamResetReason) {
+	r.onRequestDone()
+	r.readDisable(false)
 	r.requestSender = nil
 
+	// a failed hedge request is ignored if others are still waiting for the response
+	if r.downStream.dropUpstreamRequest(r) {
+		return
+	}
+
 	// todo: check if we get a reset on encode request headers. e.g. send failed
 	r.downStream.onUpstreamReset(UpstreamReset, reason)
 }
@@ -69,20 +113,49 @@ func (r *upstreamRequest) OnResetStream(reason types.StreamResetReason) {
 // types.StreamReceiver
 // Method to decode upstream's response message
 func (r *upstreamRequest) OnReceiveHeaders(headers map[string]string, endStream bool) {
+	if endStream {
+		r.onRequestDone()
+	}
+
+	// response of the request losing the hedge race is discarded
+	if !r.downStream.acceptResponse(r) {
+		return
+	}
+
 	r.upstreamRespHeaders = headers
 	r.downStream.onUpstreamHeaders(headers, endStream)
 }
 
 func (r *upstreamRequest) OnReceiveData(data types.IoBuffer, endStream bool) {
+	if endStream {
+		r.onRequestDone()
+	}
+
+	if !r.downStream.acceptResponse(r) {
+		data.Drain(data.Len())
+		return
+	}
+
 	r.downStream.onUpstreamData(data, endStream)
 }
 
 func (r *upstreamRequest) OnReceiveTrailers(trailers map[string]string) {
+	r.onRequestDone()
+
+	if !r.downStream.acceptResponse(r) {
+		return
+	}
+
 	r.downStream.onUpstreamTrailers(trailers)
 }
 
 func (r *upstreamRequest) OnDecodeError(err error, headers map[string]string) {
-	r.OnResetStream(types.StreamLocalReset)
+	reason := types.StreamLocalReset
+	if _, ok := err.(*sofarpc.ResponseTooLargeError); ok {
+		reason = types.StreamResponseTooLarge
+	}
+
+	r.OnResetStream(reason)
 }
 
 // ~~~ send request wrapper
@@ -104,6 +177,10 @@ func (r *upstreamRequest) appendData(data types.IoBuffer, endStream bool) {
 	r.sendComplete = endStream
 	r.dataSent = true
 	r.requestSender.AppendData(data, endStream)
+
+	if endStream {
+		r.onSendComplete()
+	}
 }
 
 func (r *upstreamRequest) appendTrailers(trailers map[string]string) {
@@ -111,6 +188,22 @@ func (r *upstreamRequest) appendTrailers(trailers map[string]string) {
 	r.sendComplete = true
 	r.trailerSent = true
 	r.requestSender.AppendTrailers(trailers)
+	r.onSendComplete()
+}
+
+func (r *upstreamRequest) onSendComplete() {
+	if r.downStream.oneway {
+		// no response is expected, release the stream, so that the connection pool
+		// does not count it as an active request on the connection
+		r.onRequestDone()
+		if r.requestSender != nil {
+			stream := r.requestSender.GetStream()
+			stream.RemoveEventListener(r)
+			stream.ResetStream(types.StreamLocalReset)
+		}
+
+		r.downStream.onOnewayRequestSent()
+	}
 }
 
 // types.PoolEventListener
@@ -128,14 +221,55 @@ func (r *upstreamRequest) OnFailure(streamId string, reason types.PoolFailureRea
 }
 
 func (r *upstreamRequest) OnReady(streamId string, sender types.StreamSender, host types.Host) {
+	if r.hedged {
+		// the duplicate request is only sent to a host not tried yet
+		if !r.downStream.onHedgeReady(r, host) {
+			sender.GetStream().ResetStream(types.StreamLocalReset)
+			return
+		}
+	} else {
+		r.downStream.triedHosts = append(r.downStream.triedHosts, host)
+	}
+
 	r.requestSender = sender
 	r.requestSender.GetStream().AddEventListener(r)
+	r.host = host
+	host.IncActiveRequests()
+	atomic.StoreUint32(&r.active, 1)
+
+	// the downstream is slow to read responses already
+	if r.proxy.isUpstreamReadDisabled() {
+		r.readDisable(true)
+	}
+
+	// codec consumes headers on encode, keep the origin ones for retry, access log,
+	// and the error response on upstream timeout or reset
+	headers := copyHeaders(r.downStream.downstreamReqHeaders)
+	reduceRequestTimeout(headers, r.downStream.requestInfo.StartTime())
+
+	// attempts of the same request share the correlation id, and are told apart by the attempt number
+	if r.proxy.config.CorrelationIdHeader != "" {
+		attempt := atomic.AddUint32(&r.downStream.attempts, 1)
+		headers[types.HeaderAttempt] = strconv.FormatUint(uint64(attempt), 10)
+	}
+
+	// the origin bolt request is kept for the response conversion and the error response
+	if r.downStream.convertFromBolt() {
+		headers = sofarpc.BoltToHttp2Request(headers)
+	}
 
 	endStream := r.sendComplete && !r.dataSent && !r.trailerSent
-	r.requestSender.AppendHeaders(r.downStream.downstreamReqHeaders, endStream)
+	r.requestSender.AppendHeaders(headers, endStream)
 
-	r.downStream.requestInfo.OnUpstreamHostSelected(host)
-	r.downStream.requestInfo.SetUpstreamLocalAddress(host.Address())
+	// upstream host of hedge request is recorded if it wins the race
+	if !r.hedged {
+		r.downStream.requestInfo.OnUpstreamHostSelected(host)
+		r.downStream.requestInfo.SetUpstreamLocalAddress(host.Address())
+	}
 
 	// todo: check if we get a reset on send headers
+
+	if endStream {
+		r.onSendComplete()
+	}
 }
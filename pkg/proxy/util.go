@@ -17,41 +17,91 @@
 package proxy
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"strconv"
 	"time"
 
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
 var bitSize64 = 1 << 6
 
-func parseProxyTimeout(route types.Route, headers map[string]string) *ProxyTimeout {
+// minUpstreamTimeout is the least timeout sent to upstream, even if the deadline of the caller is passed
+const minUpstreamTimeout = 10 * time.Millisecond
+
+// parseProxyTimeout gets the request timeouts from the route and request headers,
+// defaultTimeout is used if neither of them has a timeout
+func parseProxyTimeout(route types.Route, headers map[string]string, defaultTimeout time.Duration) *ProxyTimeout {
 	timeout := &ProxyTimeout{}
 	timeout.GlobalTimeout = route.RouteRule().GlobalTimeout()
 	timeout.TryTimeout = route.RouteRule().Policy().RetryPolicy().TryTimeout()
 
-	// todo: check global timeout in request headers
-	// todo: check per try timeout in request headers
-
+	// timeouts in request headers are in milliseconds, e.g. timeout of bolt request,
+	// zero or negative means no timeout
+	explicit := false
 	if tto, ok := headers[types.HeaderTryTimeout]; ok {
-		if trytimeout, err := strconv.ParseInt(tto, 10, bitSize64); err == nil {
-			timeout.TryTimeout = time.Duration(trytimeout)
+		if trytimeout, err := strconv.ParseInt(tto, 10, bitSize64); err == nil && trytimeout > 0 {
+			timeout.TryTimeout = time.Duration(trytimeout) * time.Millisecond
+			explicit = true
 		}
 	}
 
 	if gto, ok := headers[types.HeaderGlobalTimeout]; ok {
-		if globaltimeout, err := strconv.ParseInt(gto, 10, bitSize64); err == nil {
-			timeout.GlobalTimeout = time.Duration(globaltimeout)
+		if globaltimeout, err := strconv.ParseInt(gto, 10, bitSize64); err == nil && globaltimeout > 0 {
+			timeout.GlobalTimeout = time.Duration(globaltimeout) * time.Millisecond
+			explicit = true
+		}
+	}
+
+	// requests carrying no timeout use the timeout configured for the class name,
+	// which overrides the route timeout
+	if !explicit {
+		className := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)]
+		if classTimeout := route.RouteRule().ClassTimeout(className); classTimeout > 0 {
+			timeout.GlobalTimeout = classTimeout
 		}
 	}
 
-	if timeout.TryTimeout >= timeout.GlobalTimeout {
+	if timeout.GlobalTimeout <= 0 && timeout.TryTimeout <= 0 {
+		timeout.GlobalTimeout = defaultTimeout
+	}
+
+	if timeout.GlobalTimeout > 0 && timeout.TryTimeout >= timeout.GlobalTimeout {
 		timeout.TryTimeout = 0
 	}
 
 	return timeout
 }
 
+// reduceRequestTimeout decrements the bolt request timeout in headers by the time elapsed since start,
+// e.g. spent in mosn and the previous tries, so that upstreams do not work past the deadline of the caller
+func reduceRequestTimeout(headers map[string]string, start time.Time) {
+	key := sofarpc.SofaPropertyHeader(sofarpc.HeaderTimeout)
+	timeout, err := strconv.ParseInt(headers[key], 10, bitSize64)
+	if err != nil || timeout <= 0 {
+		return
+	}
+
+	remaining := time.Duration(timeout)*time.Millisecond - time.Since(start)
+	if remaining < minUpstreamTimeout {
+		remaining = minUpstreamTimeout
+	}
+
+	headers[key] = strconv.FormatInt(int64(remaining/time.Millisecond), 10)
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	copied := make(map[string]string, len(headers))
+
+	for k, v := range headers {
+		copied[k] = v
+	}
+
+	return copied
+}
+
 type timer struct {
 	callback func()
 	interval time.Duration
@@ -86,3 +136,11 @@ func (t *timer) stop() {
 
 	t.stopChan <- true
 }
+
+// newCorrelationId generates a random correlation id in hex
+func newCorrelationId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
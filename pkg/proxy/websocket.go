@@ -0,0 +1,185 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// prefix of the headers used inside mosn, which are not sent in the upgrade request
+const mosnHeaderPrefix = "x-mosn-"
+
+// webSocketTunnel forwards the frames of an upgraded websocket connection between the downstream
+// connection and a dedicated upstream connection, the upstream connection pool is bypassed.
+// The frames are not decoded, so that pings and pongs pass through as well as data frames.
+// Connections of unknown protocol are forwarded to the fallback cluster by the tunnel as raw tcp.
+//
+// types.ConnectionEventListener
+// types.ReadFilter
+type webSocketTunnel struct {
+	proxy    *proxy
+	host     types.HostInfo
+	upstream types.ClientConnection
+	closed   uint32
+
+	logger log.Logger
+}
+
+// isWebSocketUpgrade returns true if the headers are of a websocket handshake request
+func isWebSocketUpgrade(headers map[string]string) bool {
+	return strings.EqualFold(headers["upgrade"], "websocket") &&
+		strings.Contains(strings.ToLower(headers["connection"]), "upgrade")
+}
+
+// newWebSocketTunnel connects to a host of the cluster for the websocket handshake
+func newWebSocketTunnel(p *proxy, clusterName string, lbCtx types.LoadBalancerContext) (*webSocketTunnel, error) {
+	connectionData := p.clusterManager.TcpConnForCluster(clusterName, lbCtx)
+
+	if connectionData.Connection == nil {
+		return nil, fmt.Errorf("no healthy upstream in cluster %s", clusterName)
+	}
+
+	clusterInfo := connectionData.HostInfo.ClusterInfo()
+	connectionResource := clusterInfo.ResourceManager().Connections()
+
+	if !connectionResource.CanCreate() {
+		return nil, errors.New("upstream connections overflow")
+	}
+
+	t := &webSocketTunnel{
+		proxy:    p,
+		host:     connectionData.HostInfo,
+		upstream: connectionData.Connection,
+		logger:   log.ByContext(p.context),
+	}
+
+	clusterStats := clusterInfo.Stats()
+	t.upstream.SetStats(&types.ConnectionStats{
+		ReadTotal:    clusterStats.UpstreamBytesRead,
+		ReadCurrent:  clusterStats.UpstreamBytesReadCurrent,
+		WriteTotal:   clusterStats.UpstreamBytesWrite,
+		WriteCurrent: clusterStats.UpstreamBytesWriteCurrent,
+	})
+	t.upstream.AddConnectionEventListener(t)
+	t.upstream.FilterManager().AddReadFilter(t)
+
+	// counted before connected, the connection may be closed as soon as its read loop starts
+	connectionResource.Increase()
+	clusterStats.UpstreamConnectionTotal.Inc(1)
+	clusterStats.UpstreamConnectionActive.Inc(1)
+
+	if err := t.upstream.Connect(true); err != nil {
+		connectionResource.Decrease()
+		clusterStats.UpstreamConnectionActive.Dec(1)
+		clusterStats.UpstreamConnectionConFail.Inc(1)
+
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// upgrade sends the handshake request to upstream, the handshake response is forwarded as frames
+func (t *webSocketTunnel) upgrade(headers map[string]string) {
+	t.upstream.Write(buffer.NewIoBufferBytes(encodeUpgradeRequest(headers)))
+}
+
+// encodeUpgradeRequest encodes the handshake request in http/1.1 from the decoded headers
+func encodeUpgradeRequest(headers map[string]string) []byte {
+	method := "GET"
+	if m, ok := headers[types.HeaderMethod]; ok {
+		method = m
+	}
+
+	uri := headers[protocol.MosnHeaderPathKey]
+	if uri == "" {
+		uri = "/"
+	}
+	if query := headers[types.HeaderQueryString]; query != "" {
+		uri += "?" + query
+	}
+
+	buf := bytes.NewBufferString(fmt.Sprintf("%s %s HTTP/1.1\r\n", method, uri))
+
+	for k, v := range headers {
+		if k == protocol.MosnHeaderPathKey || strings.HasPrefix(k, mosnHeaderPrefix) {
+			continue
+		}
+
+		buf.WriteString(k + ": " + v + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+func (t *webSocketTunnel) onDownstreamData(data types.IoBuffer) {
+	t.upstream.Write(data)
+	t.proxy.onTunnelActive()
+}
+
+func (t *webSocketTunnel) onDownstreamEvent(event types.ConnectionEvent) {
+	if event == types.RemoteClose {
+		t.upstream.Close(types.FlushWrite, types.LocalClose)
+	} else {
+		t.upstream.Close(types.NoFlush, types.LocalClose)
+	}
+}
+
+func (t *webSocketTunnel) readDisable(disable bool) {
+	t.upstream.SetReadDisable(disable)
+}
+
+// types.ConnectionEventListener
+func (t *webSocketTunnel) OnEvent(event types.ConnectionEvent) {
+	if !event.IsClose() || !atomic.CompareAndSwapUint32(&t.closed, 0, 1) {
+		return
+	}
+
+	clusterInfo := t.host.ClusterInfo()
+	clusterInfo.ResourceManager().Connections().Decrease()
+	clusterInfo.Stats().UpstreamConnectionActive.Dec(1)
+
+	t.logger.Debugf("websocket upstream connection %d closed, event = %v", t.upstream.Id(), event)
+
+	if event != types.LocalClose {
+		t.proxy.readCallbacks.Connection().Close(types.FlushWrite, types.LocalClose)
+	}
+}
+
+// types.ReadFilter
+func (t *webSocketTunnel) OnData(data types.IoBuffer) types.FilterStatus {
+	t.proxy.readCallbacks.Connection().Write(data)
+	t.proxy.onTunnelActive()
+
+	return types.StopIteration
+}
+
+func (t *webSocketTunnel) OnNewConnection() types.FilterStatus {
+	return types.Continue
+}
+
+func (t *webSocketTunnel) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {}
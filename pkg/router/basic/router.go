@@ -131,9 +131,11 @@ func NewRouters(config interface{}) (types.Routers, error) {
 
 			if r.RetryPolicy != nil {
 				router.policy = &routerPolicy{
-					retryOn:      r.RetryPolicy.RetryOn,
-					retryTimeout: r.RetryPolicy.RetryTimeout,
-					numRetries:   r.RetryPolicy.NumRetries,
+					retryOn:       r.RetryPolicy.RetryOn,
+					retryTimeout:  r.RetryPolicy.RetryTimeout,
+					numRetries:    r.RetryPolicy.NumRetries,
+					retryOnStatus: r.RetryPolicy.RetryOnStatus,
+					idempotent:    r.RetryPolicy.Idempotent,
 				}
 			} else {
 				// default
@@ -211,9 +213,11 @@ func (srr *basicRouter) GetRouterName() string {
 }
 
 type routerPolicy struct {
-	retryOn      bool
-	retryTimeout time.Duration
-	numRetries   uint32
+	retryOn       bool
+	retryTimeout  time.Duration
+	numRetries    uint32
+	retryOnStatus []int
+	idempotent    bool
 }
 
 func (p *routerPolicy) RetryOn() bool {
@@ -228,6 +232,14 @@ func (p *routerPolicy) NumRetries() uint32 {
 	return p.numRetries
 }
 
+func (p *routerPolicy) RetryOnStatus() []int {
+	return p.retryOnStatus
+}
+
+func (p *routerPolicy) Idempotent() bool {
+	return p.idempotent
+}
+
 func (p *routerPolicy) RetryPolicy() types.RetryPolicy {
 	return p
 }
@@ -236,6 +248,10 @@ func (p *routerPolicy) ShadowPolicy() types.ShadowPolicy {
 	return nil
 }
 
+func (p *routerPolicy) HedgePolicy() types.HedgePolicy {
+	return nil
+}
+
 func (p *routerPolicy) CorsPolicy() types.CorsPolicy {
 	return nil
 }
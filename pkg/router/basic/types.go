@@ -16,7 +16,12 @@
  */
 package basic
 
-import "github.com/alipay/sofamosn/pkg/types"
+import (
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
 
 type RouteRuleImplAdaptor struct {
 }
@@ -52,3 +57,25 @@ func (r *RouteRuleImplAdaptor) Metadata() types.RouteMetaData {
 func (r *RouteRuleImplAdaptor) MetadataMatchCriteria() types.MetadataMatchCriteria {
 	return nil
 }
+
+func (r *RouteRuleImplAdaptor) BoltConvert() *v2.BoltConvert {
+	return nil
+}
+
+func (r *RouteRuleImplAdaptor) ClassTimeout(className string) time.Duration {
+	return 0
+}
+
+func (r *RouteRuleImplAdaptor) FailoverClusterName() string {
+	return ""
+}
+
+func (r *RouteRuleImplAdaptor) MaxRequestBytes() uint64 {
+	return 0
+}
+
+func (r *RouteRuleImplAdaptor) FinalizeRequestHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+}
+
+func (r *RouteRuleImplAdaptor) FinalizeResponseHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+}
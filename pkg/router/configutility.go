@@ -53,6 +53,8 @@ func (cu *ConfigUtility) MatchHeaders(requestHeaders map[string]string, configHe
 					return false
 				}
 			}
+		} else {
+			return false
 		}
 	}
 
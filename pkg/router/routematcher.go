@@ -17,7 +17,9 @@
 package router
 
 import (
+	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/log"
@@ -30,61 +32,89 @@ func init() {
 	RegisteRouterConfigFactory(protocol.Http2, NewRouteMatcher)
 	RegisteRouterConfigFactory(protocol.Http1, NewRouteMatcher)
 	RegisteRouterConfigFactory(protocol.Xprotocol, NewRouteMatcher)
+	RegisteRouterConfigFactory(protocol.Auto, NewRouteMatcher)
 }
 
 func NewRouteMatcher(config interface{}) (types.Routers, error) {
-	routerMatcher := &RouteMatcher{
-		virtualHosts: make(map[string]types.VirtualHost),
+	routerMatcher := &RouteMatcher{}
+	table := &routeTable{
+		virtualHosts:                make(map[string]types.VirtualHost),
 		wildcardVirtualHostSuffixes: make(map[int]map[string]types.VirtualHost),
 	}
 
 	if config, ok := config.(*v2.Proxy); ok {
+		var err error
+		if table, err = newRouteTable(config.VirtualHosts, config.ValidateClusters); err != nil {
+			log.StartLogger.Fatalln(err)
+		}
+	}
 
-		for _, virtualHost := range config.VirtualHosts {
+	routerMatcher.table.Store(table)
 
-			//todo 补充virtual host 其他成员
-			vh := NewVirtualHostImpl(virtualHost, config.ValidateClusters)
+	return routerMatcher, nil
+}
 
-			for _, domain := range virtualHost.Domains {
-				
-				// Note: we use domain in lowercase
-				domain = strings.ToLower(domain)
+// routeTable is the virtual hosts indexed by domain
+type routeTable struct {
+	virtualHosts                map[string]types.VirtualHost // key: host
+	defaultVirtualHost          types.VirtualHost
+	wildcardVirtualHostSuffixes map[int]map[string]types.VirtualHost
+}
+
+func newRouteTable(virtualHosts []*v2.VirtualHost, validateClusters bool) (*routeTable, error) {
+	table := &routeTable{
+		virtualHosts:                make(map[string]types.VirtualHost),
+		wildcardVirtualHostSuffixes: make(map[int]map[string]types.VirtualHost),
+	}
 
-				if domain == "*" {
-					if routerMatcher.defaultVirtualHost != nil {
-						log.StartLogger.Fatal("Only a single wildcard domain permitted")
-					}
-					log.StartLogger.Tracef("route matcher default virtual host")
-					routerMatcher.defaultVirtualHost = vh
+	for _, virtualHost := range virtualHosts {
 
-				} else if len(domain) > 1 && "*" == domain[:1] {
-					domainMap := map[string]types.VirtualHost{domain[1:]: vh}
-					routerMatcher.wildcardVirtualHostSuffixes[len(domain)-1] = domainMap
+		//todo 补充virtual host 其他成员
+		vh := NewVirtualHostImpl(virtualHost, validateClusters)
 
-				} else if _, ok := routerMatcher.virtualHosts[domain]; ok {
-					log.StartLogger.Fatal("Only unique values for domains are permitted, get duplicate domain = %s", domain)
-				} else {
-					routerMatcher.virtualHosts[domain] = vh
+		for _, domain := range virtualHost.Domains {
+
+			// Note: we use domain in lowercase
+			domain = strings.ToLower(domain)
+
+			if domain == "*" {
+				if table.defaultVirtualHost != nil {
+					return nil, fmt.Errorf("Only a single wildcard domain permitted")
 				}
+				log.StartLogger.Tracef("route matcher default virtual host")
+				table.defaultVirtualHost = vh
+
+			} else if len(domain) > 1 && "*" == domain[:1] {
+				domainMap := map[string]types.VirtualHost{domain[1:]: vh}
+				table.wildcardVirtualHostSuffixes[len(domain)-1] = domainMap
+
+			} else if _, ok := table.virtualHosts[domain]; ok {
+				return nil, fmt.Errorf("Only unique values for domains are permitted, get duplicate domain = %s", domain)
+			} else {
+				table.virtualHosts[domain] = vh
 			}
 		}
 	}
 
-	return routerMatcher, nil
+	return table, nil
 }
 
 // A router wrapper used to matches an incoming request headers to a backend cluster
 type RouteMatcher struct {
-	virtualHosts                map[string]types.VirtualHost // key: host
-	defaultVirtualHost          types.VirtualHost
-	wildcardVirtualHostSuffixes map[int]map[string]types.VirtualHost
+	// *routeTable, replaced as a whole if route rules are updated at runtime,
+	// so that a request is always routed by a consistent table
+	table atomic.Value
+}
+
+func (rm *RouteMatcher) setTable(table *routeTable) {
+	rm.table.Store(table)
 }
 
 // Routing with Virtual Host
 func (rm *RouteMatcher) Route(headers map[string]string, randomValue uint64) types.Route {
 	// First Step: Select VirtualHost with "host" in Headers form VirtualHost Array
 	log.StartLogger.Tracef("routing header = %v,randomValue=%v", headers, randomValue)
-	virtualHost := rm.findVirtualHost(headers)
+	virtualHost := rm.table.Load().(*routeTable).findVirtualHost(headers)
 
 	if virtualHost == nil {
 		log.DefaultLogger.Errorf("No VirtualHost Found when Routing, Request Headers = %+v", headers)
@@ -101,7 +131,7 @@ func (rm *RouteMatcher) Route(headers map[string]string, randomValue uint64) typ
 	return routerInstance
 }
 
-func (rm *RouteMatcher) findVirtualHost(headers map[string]string) types.VirtualHost {
+func (rm *routeTable) findVirtualHost(headers map[string]string) types.VirtualHost {
 	if len(rm.virtualHosts) == 0 && rm.defaultVirtualHost != nil {
 		log.StartLogger.Tracef("route matcher find virtual host return default virtual host")
 		return rm.defaultVirtualHost
@@ -126,7 +156,7 @@ func (rm *RouteMatcher) findVirtualHost(headers map[string]string) types.Virtual
 }
 
 // Rule: longest wildcard suffix match against the host
-func (rm *RouteMatcher) findWildcardVirtualHost(host string) types.VirtualHost {
+func (rm *routeTable) findWildcardVirtualHost(host string) types.VirtualHost {
 
 	// e.g. foo-bar.baz.com will match *-bar.baz.com
 	for wildcardLen, wildcardMap := range rm.wildcardVirtualHostSuffixes {
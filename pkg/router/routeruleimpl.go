@@ -28,13 +28,16 @@ import (
 	httpmosn "github.com/alipay/sofamosn/pkg/protocol/http"
 	"github.com/alipay/sofamosn/pkg/types"
 	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 )
 
 func NewRouteRuleImplBase(vHost *VirtualHostImpl, route *v2.Router) RouteRuleImplBase {
 	routeRuleImplBase := RouteRuleImplBase{
-		vHost:        vHost,
-		routerMatch:  route.Match,
-		routerAction: route.Route,
+		vHost:                 vHost,
+		routerMatch:           route.Match,
+		routerAction:          route.Route,
+		requestHeadersParser:  NewHeaderParser(route.Route.RequestHeadersToAdd, route.Route.RequestHeadersToRemove),
+		responseHeadersParser: NewHeaderParser(route.Route.ResponseHeadersToAdd, route.Route.ResponseHeadersToRemove),
 		policy: &routerPolicy{
 			retryOn:      false,
 			retryTimeout: 0,
@@ -42,6 +45,51 @@ func NewRouteRuleImplBase(vHost *VirtualHostImpl, route *v2.Router) RouteRuleImp
 		},
 	}
 
+	if retryPolicy := route.Route.RetryPolicy; retryPolicy != nil {
+		routeRuleImplBase.policy = &routerPolicy{
+			retryOn:       retryPolicy.RetryOn,
+			retryTimeout:  retryPolicy.RetryTimeout,
+			numRetries:    retryPolicy.NumRetries,
+			retryOnStatus: retryPolicy.RetryOnStatus,
+			idempotent:    retryPolicy.Idempotent,
+		}
+	}
+
+	if mirrorCluster := route.Route.MirrorCluster; mirrorCluster != "" {
+		routeRuleImplBase.shadowPolicy = &ShadowPolicyImpl{
+			cluster: mirrorCluster,
+			percent: route.Route.MirrorPercent,
+		}
+		routeRuleImplBase.policy.shadowPolicy = routeRuleImplBase.shadowPolicy
+	}
+
+	if hedgePolicy := route.Route.HedgePolicy; hedgePolicy != nil && hedgePolicy.MaxHedges > 0 {
+		routeRuleImplBase.policy.hedgePolicy = &HedgePolicyImpl{
+			delay:      hedgePolicy.Delay,
+			percentile: hedgePolicy.DelayPercentile,
+			maxHedges:  hedgePolicy.MaxHedges,
+		}
+	}
+
+	for _, weightedCluster := range route.Route.WeightedClusters {
+		clusterWeight := weightedCluster.Clusters
+		if clusterWeight.Weight == 0 {
+			continue
+		}
+
+		entry := &WeightedClusterEntry{
+			clusterName:   clusterWeight.Name,
+			runtimeKey:    weightedCluster.RuntimeKeyPrefix,
+			clusterWeight: uint64(clusterWeight.Weight),
+		}
+		if len(clusterWeight.MetadataMatch) > 0 {
+			entry.clusterMetadataMatchCriteria = NewMetadataMatchCriteriaImpl(getMosnLBMetaData(clusterWeight.MetadataMatch))
+		}
+
+		routeRuleImplBase.weightedClusters = append(routeRuleImplBase.weightedClusters, entry)
+		routeRuleImplBase.totalClusterWeight += entry.clusterWeight
+	}
+
 	// generate metadata match criteria from router's metadata
 	if len(route.Route.MetadataMatch) > 0 {
 		envoyLBMetaData := GetMosnLBMetaData(route)
@@ -161,9 +209,69 @@ func (rri *RouteRuleImplBase) Metadata() types.RouteMetaData {
 }
 
 func (rri *RouteRuleImplBase) MetadataMatchCriteria() types.MetadataMatchCriteria {
+	// avoid returning a typed nil, which is taken as a valid criteria by subset load balancer
+	if rri.metadataMatchCriteria == nil {
+		return nil
+	}
+
 	return rri.metadataMatchCriteria
 }
 
+func (rri *RouteRuleImplBase) BoltConvert() *v2.BoltConvert {
+	return rri.routerAction.BoltConvert
+}
+
+func (rri *RouteRuleImplBase) ClassTimeout(className string) time.Duration {
+	// prefixes are sorted by length, the first matched is the most specific
+	for _, ct := range rri.routerAction.ClassTimeoutPrefixes {
+		if strings.HasPrefix(className, ct.Prefix) {
+			return ct.Timeout
+		}
+	}
+
+	return 0
+}
+
+func (rri *RouteRuleImplBase) FailoverClusterName() string {
+	return rri.routerAction.FailoverCluster
+}
+
+func (rri *RouteRuleImplBase) MaxRequestBytes() uint64 {
+	return rri.routerAction.MaxRequestBytes
+}
+
+func (rri *RouteRuleImplBase) FinalizeRequestHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+	rri.requestHeadersParser.EvaluateHeaders(headers)
+}
+
+func (rri *RouteRuleImplBase) FinalizeResponseHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+	rri.responseHeadersParser.EvaluateHeaders(headers)
+}
+
+// clusterRoute picks a cluster from weighted clusters by the random value for the matched route,
+// the route is returned as it is if no weighted clusters configured
+func (rri *RouteRuleImplBase) clusterRoute(route types.Route, randomValue uint64) types.Route {
+	if rri.totalClusterWeight == 0 {
+		return route
+	}
+
+	selected := randomValue % rri.totalClusterWeight
+	var end uint64
+
+	for _, cluster := range rri.weightedClusters {
+		end += cluster.clusterWeight
+		if selected < end {
+			return &weightedClusterRoute{
+				route:   route,
+				rule:    route.RouteRule(),
+				cluster: cluster,
+			}
+		}
+	}
+
+	return route
+}
+
 // todo
 func (rri *RouteRuleImplBase) finalizePathHeader(headers map[string]string, matchedPath string) {
 
@@ -194,9 +302,54 @@ func (rri *RouteRuleImplBase) matchRoute(headers map[string]string, randomValue
 
 type SofaRouteRuleImpl struct {
 	RouteRuleImplBase
+	matchKey   string
 	matchValue string
 }
 
+// newSofaRouteRuleImpl creates a sofa route rule matching the header at headerIdx of the router with the matchKey,
+// the other headers of the router are matched as extra conditions, e.g. a canary tag
+func newSofaRouteRuleImpl(vHost *VirtualHostImpl, route *v2.Router, headerIdx int, matchKey string) *SofaRouteRuleImpl {
+	routeRuleImplBase := NewRouteRuleImplBase(vHost, route)
+
+	for i, header := range route.Match.Headers {
+		if i != headerIdx {
+			routeRuleImplBase.configHeaders = append(routeRuleImplBase.configHeaders, newHeaderData(header))
+		}
+	}
+
+	return &SofaRouteRuleImpl{
+		RouteRuleImplBase: routeRuleImplBase,
+		matchKey:          matchKey,
+		matchValue:        route.Match.Headers[headerIdx].Value,
+	}
+}
+
+func newHeaderData(header v2.HeaderMatcher) *types.HeaderData {
+	name := header.Name
+	switch name {
+	case types.SofaRouteServiceKey:
+		name = sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)
+	case types.SofaRouteMethodKey:
+		name = sofarpc.HeaderMethodName
+	}
+
+	headerData := &types.HeaderData{
+		Name:  &LowerCaseString{name},
+		Value: header.Value,
+	}
+
+	if header.Regex {
+		if regPattern, err := regexp.Compile(header.Value); err == nil {
+			headerData.IsRegex = true
+			headerData.RegexPattern = *regPattern
+		} else {
+			log.DefaultLogger.Errorf("Compile Regex Error, header = %s, regex = %s", header.Name, header.Value)
+		}
+	}
+
+	return headerData
+}
+
 func (srri *SofaRouteRuleImpl) Matcher() string {
 
 	return srri.matchValue
@@ -208,15 +361,21 @@ func (srri *SofaRouteRuleImpl) MatchType() types.PathMatchType {
 }
 
 func (srri *SofaRouteRuleImpl) Match(headers map[string]string, randomValue uint64) types.Route {
-	if value, ok := headers[types.SofaRouteMatchKey]; ok {
+	if value, ok := headers[srri.matchKey]; ok {
 		if value == srri.matchValue || srri.matchValue == ".*" {
+			// other headers of the router should be matched too
+			if !ConfigUtilityInst.MatchHeaders(headers, srri.configHeaders) {
+				log.DefaultLogger.Debugf("Sofa router matches failure, headers not matched")
+				return nil
+			}
+
 			log.DefaultLogger.Debugf("Sofa router matches success")
-			return srri
+			return srri.clusterRoute(srri, randomValue)
 		} else {
 			log.DefaultLogger.Warnf(" Sofa router matches failure, service name = %s", value)
 		}
 	} else {
-		log.DefaultLogger.Warnf("No service key found in header, sofa router matcher failure")
+		log.DefaultLogger.Warnf("No %s key found in header, sofa router matcher failure", srri.matchKey)
 	}
 
 	return nil
@@ -248,11 +407,11 @@ func (prri *PathRouteRuleImpl) Match(headers map[string]string, randomValue uint
 			if prri.caseSensitive {
 				if headerPathValue == prri.path {
 					log.DefaultLogger.Debugf("path route rule match success in caseSensitive scene")
-					return prri
+					return prri.clusterRoute(prri, randomValue)
 				}
 			} else if strings.EqualFold(headerPathValue, prri.path) {
 				log.DefaultLogger.Debugf("path route rule match success with exact matching ")
-				return prri
+				return prri.clusterRoute(prri, randomValue)
 			}
 		}
 	}
@@ -263,6 +422,7 @@ func (prri *PathRouteRuleImpl) Match(headers map[string]string, randomValue uint
 
 // todo
 func (prri *PathRouteRuleImpl) FinalizeRequestHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+	prri.RouteRuleImplBase.FinalizeRequestHeaders(headers, requestInfo)
 	prri.finalizePathHeader(headers, prri.path)
 }
 
@@ -291,7 +451,7 @@ func (prei *PrefixRouteRuleImpl) Match(headers map[string]string, randomValue ui
 			if strings.HasPrefix(headerPathValue, prei.prefix) {
 				log.DefaultLogger.Warnf("prefix route rule match success")
 				
-				return prei
+				return prei.clusterRoute(prei, randomValue)
 			}
 		}
 	}
@@ -301,6 +461,7 @@ func (prei *PrefixRouteRuleImpl) Match(headers map[string]string, randomValue ui
 }
 
 func (prei *PrefixRouteRuleImpl) FinalizeRequestHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+	prei.RouteRuleImplBase.FinalizeRequestHeaders(headers, requestInfo)
 	prei.finalizePathHeader(headers, prei.prefix)
 }
 
@@ -328,7 +489,7 @@ func (rrei *RegexRouteRuleImpl) Match(headers map[string]string, randomValue uin
 			if rrei.regexPattern.MatchString(headerPathValue) {
 				log.DefaultLogger.Warnf("regex route rule match success")
 				
-				return rrei
+				return rrei.clusterRoute(rrei, randomValue)
 			}
 		}
 	}
@@ -338,5 +499,29 @@ func (rrei *RegexRouteRuleImpl) Match(headers map[string]string, randomValue uin
 }
 
 func (rrei *RegexRouteRuleImpl) FinalizeRequestHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+	rrei.RouteRuleImplBase.FinalizeRequestHeaders(headers, requestInfo)
 	rrei.finalizePathHeader(headers, rrei.regexStr)
 }
+
+// SourceIPRouteRuleImpl matches all requests, the source ip is matched against its CIDRs by the virtual host
+type SourceIPRouteRuleImpl struct {
+	RouteRuleImplBase
+}
+
+func (sirri *SourceIPRouteRuleImpl) Matcher() string {
+
+	return strings.Join(sirri.routerMatch.SourceCIDRs, ",")
+}
+
+func (sirri *SourceIPRouteRuleImpl) MatchType() types.PathMatchType {
+
+	return types.SourceIP
+}
+
+func (sirri *SourceIPRouteRuleImpl) Match(headers map[string]string, randomValue uint64) types.Route {
+	if sirri.matchRoute(headers, randomValue) {
+		return sirri.clusterRoute(sirri, randomValue)
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package router
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+var (
+	ErrRouteTableNotFound  = errors.New("route table not found")
+	ErrVirtualHostNotFound = errors.New("virtual host not found")
+	ErrRouterNotFound      = errors.New("router index out of range")
+	ErrNoClusterWeight     = errors.New("sum of cluster weights should be positive")
+)
+
+// RouteTables are the route tables of proxy on each listener. Connections accepted by a listener
+// share the routers, so that route rules updated at runtime take effect on the next request of all
+// connections
+var RouteTables = &routeTables{
+	tables: make(map[string]*RouteTable),
+}
+
+type routeTables struct {
+	tables map[string]*RouteTable // key: listener name
+	mux    sync.RWMutex
+}
+
+// Routers returns the routers of the listener, which is created on the first call of
+// a listener, or if the proxy config of the listener is changed
+func (rts *routeTables) Routers(listenerName string, port types.Protocol, config *v2.Proxy) (types.Routers, error) {
+	rts.mux.RLock()
+	table, ok := rts.tables[listenerName]
+	rts.mux.RUnlock()
+
+	if ok && table.config == config {
+		return table.matcher, nil
+	}
+
+	rts.mux.Lock()
+	defer rts.mux.Unlock()
+
+	if table, ok := rts.tables[listenerName]; ok && table.config == config {
+		return table.matcher, nil
+	}
+
+	routers, err := CreateRouteConfig(port, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// only route matcher supports updating rules at runtime
+	if matcher, ok := routers.(*RouteMatcher); ok {
+		rts.tables[listenerName] = &RouteTable{
+			listenerName: listenerName,
+			config:       config,
+			virtualHosts: config.VirtualHosts,
+			matcher:      matcher,
+		}
+	}
+
+	return routers, nil
+}
+
+// Get returns the route table of the listener
+func (rts *routeTables) Get(listenerName string) (*RouteTable, error) {
+	rts.mux.RLock()
+	defer rts.mux.RUnlock()
+
+	if table, ok := rts.tables[listenerName]; ok {
+		return table, nil
+	}
+
+	return nil, ErrRouteTableNotFound
+}
+
+// List returns route tables of all listeners, sorted by listener name
+func (rts *routeTables) List() []*RouteTable {
+	rts.mux.RLock()
+	defer rts.mux.RUnlock()
+
+	tables := make([]*RouteTable, 0, len(rts.tables))
+	for _, table := range rts.tables {
+		tables = append(tables, table)
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].listenerName < tables[j].listenerName
+	})
+
+	return tables
+}
+
+// RouteTable is the effective route rules of a listener, the configured rules are kept to be reverted to
+type RouteTable struct {
+	listenerName string
+	config       *v2.Proxy
+	virtualHosts []*v2.VirtualHost // effective
+	matcher      *RouteMatcher
+
+	mux sync.Mutex
+}
+
+func (rt *RouteTable) ListenerName() string {
+	return rt.listenerName
+}
+
+// VirtualHosts returns the effective virtual hosts, which should not be modified
+func (rt *RouteTable) VirtualHosts() []*v2.VirtualHost {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	return rt.virtualHosts
+}
+
+// Overridden returns true if route rules are updated at runtime
+func (rt *RouteTable) Overridden() bool {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	return !sameVirtualHosts(rt.virtualHosts, rt.config.VirtualHosts)
+}
+
+// AddRouter inserts the router at index of the virtual host, or appends it if index is negative
+func (rt *RouteTable) AddRouter(virtualHost string, index int, router v2.Router) error {
+	return rt.update(virtualHost, func(routers []v2.Router) ([]v2.Router, error) {
+		if index < 0 {
+			index = len(routers)
+		}
+		if index > len(routers) {
+			return nil, ErrRouterNotFound
+		}
+
+		updated := make([]v2.Router, 0, len(routers)+1)
+		updated = append(updated, routers[:index]...)
+		updated = append(updated, router)
+		return append(updated, routers[index:]...), nil
+	})
+}
+
+// ReplaceRouter replaces the router at index of the virtual host
+func (rt *RouteTable) ReplaceRouter(virtualHost string, index int, router v2.Router) error {
+	return rt.update(virtualHost, func(routers []v2.Router) ([]v2.Router, error) {
+		if index < 0 || index >= len(routers) {
+			return nil, ErrRouterNotFound
+		}
+
+		updated := append([]v2.Router{}, routers...)
+		updated[index] = router
+		return updated, nil
+	})
+}
+
+// DeleteRouter deletes the router at index of the virtual host
+func (rt *RouteTable) DeleteRouter(virtualHost string, index int) error {
+	return rt.update(virtualHost, func(routers []v2.Router) ([]v2.Router, error) {
+		if index < 0 || index >= len(routers) {
+			return nil, ErrRouterNotFound
+		}
+
+		updated := make([]v2.Router, 0, len(routers)-1)
+		updated = append(updated, routers[:index]...)
+		return append(updated, routers[index+1:]...), nil
+	})
+}
+
+// UpdateClusterWeights replaces the weights of the weighted clusters of the router at index, the weights
+// are in the order of the weighted clusters and are updated together. Clusters are picked in proportion to
+// the weights, a zero weight stops routing to the cluster. The route is picked on request received, so
+// requests in flight are not affected
+func (rt *RouteTable) UpdateClusterWeights(virtualHost string, index int, weights []uint32) error {
+	return rt.update(virtualHost, func(routers []v2.Router) ([]v2.Router, error) {
+		if index < 0 || index >= len(routers) {
+			return nil, ErrRouterNotFound
+		}
+
+		weightedClusters := routers[index].Route.WeightedClusters
+		if len(weights) != len(weightedClusters) {
+			return nil, fmt.Errorf("%d weights given for %d weighted clusters", len(weights), len(weightedClusters))
+		}
+
+		var total uint64
+		for _, weight := range weights {
+			total += uint64(weight)
+		}
+		if total == 0 {
+			return nil, ErrNoClusterWeight
+		}
+
+		// the configured rules and the effective ones are not modified
+		updated := append([]v2.Router{}, routers...)
+		updated[index].Route.WeightedClusters = make([]v2.WeightedCluster, len(weightedClusters))
+		for i, weightedCluster := range weightedClusters {
+			weightedCluster.Clusters.Weight = weights[i]
+			updated[index].Route.WeightedClusters[i] = weightedCluster
+		}
+
+		return updated, nil
+	})
+}
+
+// Revert restores the configured route rules
+func (rt *RouteTable) Revert() error {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	return rt.apply(rt.config.VirtualHosts)
+}
+
+// update modifies routers of the virtual host on a copy of the effective virtual hosts,
+// the route table is rebuilt and replaced only if the copy is valid
+func (rt *RouteTable) update(virtualHost string, modify func(routers []v2.Router) ([]v2.Router, error)) error {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	virtualHosts := make([]*v2.VirtualHost, len(rt.virtualHosts))
+	copy(virtualHosts, rt.virtualHosts)
+
+	for i, vh := range virtualHosts {
+		if vh.Name != virtualHost {
+			continue
+		}
+
+		routers, err := modify(vh.Routers)
+		if err != nil {
+			return err
+		}
+
+		updated := *vh
+		updated.Routers = routers
+		virtualHosts[i] = &updated
+
+		return rt.apply(virtualHosts)
+	}
+
+	return ErrVirtualHostNotFound
+}
+
+func (rt *RouteTable) apply(virtualHosts []*v2.VirtualHost) error {
+	table, err := newRouteTable(virtualHosts, rt.config.ValidateClusters)
+	if err != nil {
+		return fmt.Errorf("invalid route rules: %v", err)
+	}
+
+	rt.matcher.setTable(table)
+	rt.virtualHosts = virtualHosts
+
+	return nil
+}
+
+func sameVirtualHosts(a, b []*v2.VirtualHost) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
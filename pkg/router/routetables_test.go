@@ -0,0 +1,219 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package router
+
+import (
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func newServiceRouter(service string, cluster string) v2.Router {
+	return v2.Router{
+		Match: v2.RouterMatch{
+			Headers: []v2.HeaderMatcher{
+				{Name: types.SofaRouteMatchKey, Value: service},
+			},
+		},
+		Route: v2.RouteAction{ClusterName: cluster},
+	}
+}
+
+func routedCluster(routers types.Routers, service string) string {
+	route := routers.Route(map[string]string{types.SofaRouteMatchKey: service}, 1)
+	if route == nil || route.RouteRule() == nil {
+		return ""
+	}
+	return route.RouteRule().ClusterName()
+}
+
+func TestRouteTablesUpdate(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	config := &v2.Proxy{
+		VirtualHosts: []*v2.VirtualHost{
+			{
+				Name:    "sofa",
+				Domains: []string{"*"},
+				Routers: []v2.Router{
+					newServiceRouter("com.alipay.test.HelloService:1.0", "hello_cluster"),
+				},
+			},
+		},
+	}
+
+	routers, err := RouteTables.Routers("route_tables_listener", protocol.SofaRpc, config)
+	if err != nil {
+		t.Fatalf("create routers error: %v", err)
+	}
+	// shared by connections of the listener
+	if shared, _ := RouteTables.Routers("route_tables_listener", protocol.SofaRpc, config); shared != routers {
+		t.Fatalf("routers of the listener should be shared")
+	}
+
+	table, err := RouteTables.Get("route_tables_listener")
+	if err != nil {
+		t.Fatalf("get route table error: %v", err)
+	}
+
+	// add a rule
+	if err := table.AddRouter("sofa", -1, newServiceRouter("com.alipay.test.AuditService:1.0", "audit_cluster")); err != nil {
+		t.Fatalf("add router error: %v", err)
+	}
+	if cluster := routedCluster(routers, "com.alipay.test.AuditService:1.0"); cluster != "audit_cluster" {
+		t.Errorf("added rule should take effect, routed to %q", cluster)
+	}
+	if !table.Overridden() || len(table.VirtualHosts()[0].Routers) != 2 {
+		t.Errorf("table should be overridden with 2 routers, got %+v", table.VirtualHosts()[0].Routers)
+	}
+	// configured rules are kept
+	if len(config.VirtualHosts[0].Routers) != 1 {
+		t.Errorf("configured rules should not be modified, got %+v", config.VirtualHosts[0].Routers)
+	}
+
+	// replace a rule
+	if err := table.ReplaceRouter("sofa", 0, newServiceRouter("com.alipay.test.HelloService:1.0", "hello_backup")); err != nil {
+		t.Fatalf("replace router error: %v", err)
+	}
+	if cluster := routedCluster(routers, "com.alipay.test.HelloService:1.0"); cluster != "hello_backup" {
+		t.Errorf("replaced rule should take effect, routed to %q", cluster)
+	}
+
+	// delete a rule
+	if err := table.DeleteRouter("sofa", 1); err != nil {
+		t.Fatalf("delete router error: %v", err)
+	}
+	if cluster := routedCluster(routers, "com.alipay.test.AuditService:1.0"); cluster != "" {
+		t.Errorf("deleted rule should not take effect, routed to %q", cluster)
+	}
+
+	// invalid updates are not applied
+	if err := table.DeleteRouter("sofa", 1); err != ErrRouterNotFound {
+		t.Errorf("expected router not found, got %v", err)
+	}
+	if err := table.AddRouter("unknown", -1, newServiceRouter("com.alipay.test.AuditService:1.0", "audit_cluster")); err != ErrVirtualHostNotFound {
+		t.Errorf("expected virtual host not found, got %v", err)
+	}
+	if len(table.VirtualHosts()[0].Routers) != 1 {
+		t.Errorf("invalid updates should not be applied, got %+v", table.VirtualHosts()[0].Routers)
+	}
+
+	// revert to the configured rules
+	if err := table.Revert(); err != nil {
+		t.Fatalf("revert error: %v", err)
+	}
+	if cluster := routedCluster(routers, "com.alipay.test.HelloService:1.0"); cluster != "hello_cluster" {
+		t.Errorf("configured rule should be restored, routed to %q", cluster)
+	}
+	if table.Overridden() {
+		t.Errorf("table should not be overridden after reverted")
+	}
+
+	// new proxy config of the listener replaces the table
+	updated := &v2.Proxy{VirtualHosts: config.VirtualHosts}
+	if replaced, _ := RouteTables.Routers("route_tables_listener", protocol.SofaRpc, updated); replaced == routers {
+		t.Errorf("routers should be recreated for the new proxy config")
+	}
+}
+
+func TestRouteTablesUpdateClusterWeights(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	weightedRouter := newServiceRouter("com.alipay.test.HelloService:1.0", "")
+	weightedRouter.Route.WeightedClusters = []v2.WeightedCluster{
+		{Clusters: v2.ClusterWeight{Name: "hello_stable", Weight: 90}},
+		{Clusters: v2.ClusterWeight{Name: "hello_canary", Weight: 10}},
+	}
+	config := &v2.Proxy{
+		VirtualHosts: []*v2.VirtualHost{
+			{Name: "sofa", Domains: []string{"*"}, Routers: []v2.Router{weightedRouter}},
+		},
+	}
+
+	routers, err := RouteTables.Routers("route_weights_listener", protocol.SofaRpc, config)
+	if err != nil {
+		t.Fatalf("create routers error: %v", err)
+	}
+	table, _ := RouteTables.Get("route_weights_listener")
+
+	headers := map[string]string{types.SofaRouteMatchKey: "com.alipay.test.HelloService:1.0"}
+	distribution := func(total uint64) map[string]int {
+		counts := make(map[string]int)
+		for i := uint64(0); i < total; i++ {
+			counts[routers.Route(headers, i).RouteRule().ClusterName()]++
+		}
+		return counts
+	}
+
+	if counts := distribution(100); counts["hello_stable"] != 90 || counts["hello_canary"] != 10 {
+		t.Errorf("expect 90 stable and 10 canary in 100 continuous random values, got %v", counts)
+	}
+	// picked before the update
+	inflight := routers.Route(headers, 95)
+
+	// weights are normalized by the sum
+	if err := table.UpdateClusterWeights("sofa", 0, []uint32{1, 3}); err != nil {
+		t.Fatalf("update cluster weights error: %v", err)
+	}
+	if counts := distribution(100); counts["hello_stable"] != 25 || counts["hello_canary"] != 75 {
+		t.Errorf("expect 25 stable and 75 canary in 100 continuous random values, got %v", counts)
+	}
+	if cluster := inflight.RouteRule().ClusterName(); cluster != "hello_canary" {
+		t.Errorf("route picked before the update should not be changed, got %s", cluster)
+	}
+	if weights := config.VirtualHosts[0].Routers[0].Route.WeightedClusters; weights[0].Clusters.Weight != 90 || weights[1].Clusters.Weight != 10 {
+		t.Errorf("configured weights should not be modified, got %+v", weights)
+	}
+
+	// zero weight stops routing to the cluster
+	if err := table.UpdateClusterWeights("sofa", 0, []uint32{0, 5}); err != nil {
+		t.Fatalf("update cluster weights error: %v", err)
+	}
+	if counts := distribution(100); counts["hello_canary"] != 100 {
+		t.Errorf("expect all requests routed to canary, got %v", counts)
+	}
+
+	// invalid weights are not applied
+	for _, invalid := range []struct {
+		virtualHost string
+		index       int
+		weights     []uint32
+	}{
+		{"sofa", 0, []uint32{0, 0}},
+		{"sofa", 0, []uint32{100}},
+		{"sofa", 0, nil},
+		{"sofa", 1, []uint32{50, 50}},
+		{"unknown", 0, []uint32{50, 50}},
+	} {
+		if err := table.UpdateClusterWeights(invalid.virtualHost, invalid.index, invalid.weights); err == nil {
+			t.Errorf("expected error for weights %v of %s index %d", invalid.weights, invalid.virtualHost, invalid.index)
+		}
+	}
+	if counts := distribution(100); counts["hello_canary"] != 100 {
+		t.Errorf("invalid weights should not be applied, got %v", counts)
+	}
+
+	if err := table.Revert(); err != nil {
+		t.Fatalf("revert error: %v", err)
+	}
+	if counts := distribution(100); counts["hello_stable"] != 90 || counts["hello_canary"] != 10 {
+		t.Errorf("configured weights should be restored, got %v", counts)
+	}
+}
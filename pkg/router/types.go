@@ -25,9 +25,41 @@ import (
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
+// HeaderParser adds and removes the headers configured by the route
 type HeaderParser struct {
-	headersToAdd    []types.Pair
-	headersToRemove []*LowerCaseString
+	headersToAdd    []v2.HeaderValueOption
+	headersToRemove []string
+}
+
+// NewHeaderParser returns nil if no header is added or removed
+func NewHeaderParser(headersToAdd []v2.HeaderValueOption, headersToRemove []string) *HeaderParser {
+	if len(headersToAdd) == 0 && len(headersToRemove) == 0 {
+		return nil
+	}
+
+	return &HeaderParser{
+		headersToAdd:    headersToAdd,
+		headersToRemove: headersToRemove,
+	}
+}
+
+// EvaluateHeaders removes the headers first, so that a header both removed and added is replaced
+func (hp *HeaderParser) EvaluateHeaders(headers map[string]string) {
+	if hp == nil || headers == nil {
+		return
+	}
+
+	for _, key := range hp.headersToRemove {
+		delete(headers, key)
+	}
+
+	for _, header := range hp.headersToAdd {
+		if value, ok := headers[header.Key]; ok && header.Append && value != "" {
+			headers[header.Key] = value + "," + header.Value
+		} else {
+			headers[header.Key] = header.Value
+		}
+	}
 }
 
 type Matchable interface {
@@ -48,6 +80,7 @@ type RouteBase interface {
 type ShadowPolicyImpl struct {
 	cluster    string
 	runtimeKey string
+	percent    uint32
 }
 
 func (spi *ShadowPolicyImpl) ClusterName() string {
@@ -58,6 +91,28 @@ func (spi *ShadowPolicyImpl) RuntimeKey() string {
 	return spi.runtimeKey
 }
 
+func (spi *ShadowPolicyImpl) Percent() uint32 {
+	return spi.percent
+}
+
+type HedgePolicyImpl struct {
+	delay      time.Duration
+	percentile float64
+	maxHedges  uint32
+}
+
+func (hpi *HedgePolicyImpl) HedgeDelay() time.Duration {
+	return hpi.delay
+}
+
+func (hpi *HedgePolicyImpl) HedgeDelayPercentile() float64 {
+	return hpi.percentile
+}
+
+func (hpi *HedgePolicyImpl) MaxHedges() uint32 {
+	return hpi.maxHedges
+}
+
 type LowerCaseString struct {
 	string_ string
 }
@@ -111,9 +166,11 @@ func (rp *RateLimitPolicyImpl) GetApplicableRateLimit(stage string) []types.Rate
 }
 
 type RetryPolicyImpl struct {
-	retryOn      bool
-	retryTimeout time.Duration
-	numRetries   uint32
+	retryOn       bool
+	retryTimeout  time.Duration
+	numRetries    uint32
+	retryOnStatus []int
+	idempotent    bool
 }
 
 func (p *RetryPolicyImpl) RetryOn() bool {
@@ -128,6 +185,14 @@ func (p *RetryPolicyImpl) NumRetries() uint32 {
 	return p.numRetries
 }
 
+func (p *RetryPolicyImpl) RetryOnStatus() []int {
+	return p.retryOnStatus
+}
+
+func (p *RetryPolicyImpl) Idempotent() bool {
+	return p.idempotent
+}
+
 // todo implement CorsPolicy
 
 type RuntimeData struct {
@@ -156,16 +221,104 @@ func (repi *RateLimitPolicyEntryImpl) PopulateDescriptors(route types.RouteRule,
 type RateLimitAction interface{}
 
 type WeightedClusterEntry struct {
+	clusterName                  string
 	runtimeKey                   string
 	loader                       types.Loader
 	clusterWeight                uint64
 	clusterMetadataMatchCriteria *MetadataMatchCriteriaImpl
 }
 
+// weightedClusterRoute is the matched route with the cluster picked from weighted clusters,
+// the cluster name and metadata match criteria of the route are replaced by the picked one's
+type weightedClusterRoute struct {
+	route   types.Route
+	rule    types.RouteRule
+	cluster *WeightedClusterEntry
+}
+
+// types.Route
+func (wcr *weightedClusterRoute) RedirectRule() types.RedirectRule {
+	return wcr.route.RedirectRule()
+}
+
+func (wcr *weightedClusterRoute) RouteRule() types.RouteRule {
+	return wcr
+}
+
+func (wcr *weightedClusterRoute) TraceDecorator() types.TraceDecorator {
+	return wcr.route.TraceDecorator()
+}
+
+// types.RouteRule
+func (wcr *weightedClusterRoute) ClusterName() string {
+	return wcr.cluster.clusterName
+}
+
+func (wcr *weightedClusterRoute) GlobalTimeout() time.Duration {
+	return wcr.rule.GlobalTimeout()
+}
+
+func (wcr *weightedClusterRoute) Priority() types.Priority {
+	return wcr.rule.Priority()
+}
+
+func (wcr *weightedClusterRoute) VirtualHost() types.VirtualHost {
+	return wcr.rule.VirtualHost()
+}
+
+func (wcr *weightedClusterRoute) VirtualCluster(headers map[string]string) types.VirtualCluster {
+	return wcr.rule.VirtualCluster(headers)
+}
+
+func (wcr *weightedClusterRoute) Policy() types.Policy {
+	return wcr.rule.Policy()
+}
+
+func (wcr *weightedClusterRoute) Metadata() types.RouteMetaData {
+	return wcr.rule.Metadata()
+}
+
+func (wcr *weightedClusterRoute) MetadataMatchCriteria() types.MetadataMatchCriteria {
+	// avoid returning a typed nil
+	if wcr.cluster.clusterMetadataMatchCriteria == nil {
+		return nil
+	}
+
+	return wcr.cluster.clusterMetadataMatchCriteria
+}
+
+func (wcr *weightedClusterRoute) BoltConvert() *v2.BoltConvert {
+	return wcr.rule.BoltConvert()
+}
+
+func (wcr *weightedClusterRoute) ClassTimeout(className string) time.Duration {
+	return wcr.rule.ClassTimeout(className)
+}
+
+func (wcr *weightedClusterRoute) FailoverClusterName() string {
+	return wcr.rule.FailoverClusterName()
+}
+
+func (wcr *weightedClusterRoute) MaxRequestBytes() uint64 {
+	return wcr.rule.MaxRequestBytes()
+}
+
+func (wcr *weightedClusterRoute) FinalizeRequestHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+	wcr.rule.FinalizeRequestHeaders(headers, requestInfo)
+}
+
+func (wcr *weightedClusterRoute) FinalizeResponseHeaders(headers map[string]string, requestInfo types.RequestInfo) {
+	wcr.rule.FinalizeResponseHeaders(headers, requestInfo)
+}
+
 type routerPolicy struct {
-	retryOn      bool
-	retryTimeout time.Duration
-	numRetries   uint32
+	retryOn       bool
+	retryTimeout  time.Duration
+	numRetries    uint32
+	retryOnStatus []int
+	idempotent    bool
+	shadowPolicy  *ShadowPolicyImpl
+	hedgePolicy   *HedgePolicyImpl
 }
 
 func (p *routerPolicy) RetryOn() bool {
@@ -180,12 +333,34 @@ func (p *routerPolicy) NumRetries() uint32 {
 	return p.numRetries
 }
 
+func (p *routerPolicy) RetryOnStatus() []int {
+	return p.retryOnStatus
+}
+
+func (p *routerPolicy) Idempotent() bool {
+	return p.idempotent
+}
+
 func (p *routerPolicy) RetryPolicy() types.RetryPolicy {
 	return p
 }
 
 func (p *routerPolicy) ShadowPolicy() types.ShadowPolicy {
-	return nil
+	// avoid returning a typed nil
+	if p.shadowPolicy == nil {
+		return nil
+	}
+
+	return p.shadowPolicy
+}
+
+func (p *routerPolicy) HedgePolicy() types.HedgePolicy {
+	// avoid returning a typed nil
+	if p.hedgePolicy == nil {
+		return nil
+	}
+
+	return p.hedgePolicy
 }
 
 func (p *routerPolicy) CorsPolicy() types.CorsPolicy {
@@ -222,7 +397,11 @@ func GetClusterMosnLBMetaDataMap(metadata v2.Metadata) types.RouteMetaData {
 
 // get mosn lb metadata from config
 func GetMosnLBMetaData(route *v2.Router) map[string]interface{} {
-	if metadataInterface, ok := route.Route.MetadataMatch[types.RouterMatadataKey]; ok {
+	return getMosnLBMetaData(route.Route.MetadataMatch)
+}
+
+func getMosnLBMetaData(metadata v2.Metadata) map[string]interface{} {
+	if metadataInterface, ok := metadata[types.RouterMatadataKey]; ok {
 		if value, ok := metadataInterface.(map[string]interface{}); ok {
 			if mosnLbInterface, ok := value[types.RouterMetadataKeyLb]; ok {
 				if mosnLb, ok := mosnLbInterface.(map[string]interface{}); ok {
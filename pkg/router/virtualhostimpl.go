@@ -17,11 +17,13 @@
 package router
 
 import (
+	"net"
 	"regexp"
 
 	"github.com/markphelps/optional"
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
@@ -38,6 +40,7 @@ func NewVirtualHostImpl(virtualHost *v2.VirtualHost, validateClusters bool) *Vir
 	}
 
 	for _, route := range virtualHost.Routers {
+		n := len(virtualHostImpl.routes)
 
 		if route.Match.Prefix != "" {
 
@@ -63,16 +66,50 @@ func NewVirtualHostImpl(virtualHost *v2.VirtualHost, validateClusters bool) *Vir
 			} else {
 				log.DefaultLogger.Errorf("Compile Regex Error")
 			}
+		} else if len(route.Match.Headers) == 0 && len(route.Match.SourceCIDRs) > 0 {
+			// all requests from the CIDRs
+			virtualHostImpl.routes = append(virtualHostImpl.routes, &SourceIPRouteRuleImpl{
+				NewRouteRuleImplBase(virtualHostImpl, &route),
+			})
 		} else {
-			for _, header := range route.Match.Headers {
-				if header.Name == types.SofaRouteMatchKey {
-					virtualHostImpl.routes = append(virtualHostImpl.routes, &SofaRouteRuleImpl{
-						RouteRuleImplBase: NewRouteRuleImplBase(virtualHostImpl, &route),
-						matchValue:        header.Value,
-					})
+			for i, header := range route.Match.Headers {
+				switch header.Name {
+				case types.SofaRouteMatchKey:
+					virtualHostImpl.routes = append(virtualHostImpl.routes,
+						newSofaRouteRuleImpl(virtualHostImpl, &route, i, types.SofaRouteMatchKey))
+				case types.SofaRouteServiceKey:
+					// bolt className is decoded into headers by sofarpc codec
+					virtualHostImpl.routes = append(virtualHostImpl.routes,
+						newSofaRouteRuleImpl(virtualHostImpl, &route, i, sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName)))
+				case types.SofaRouteMethodKey:
+					// bolt method name is carried in the request header map, requests without it
+					// fall through to the routes matching className only
+					virtualHostImpl.routes = append(virtualHostImpl.routes,
+						newSofaRouteRuleImpl(virtualHostImpl, &route, i, sofarpc.HeaderMethodName))
+				case types.DubboRouteServiceKey, types.DubboRouteMethodKey:
+					// service and method of dubbo invocation are decoded into headers by dubbo codec
+					virtualHostImpl.routes = append(virtualHostImpl.routes,
+						newSofaRouteRuleImpl(virtualHostImpl, &route, i, header.Name))
+				case types.ThriftRouteServiceKey, types.ThriftRouteMethodKey:
+					// message name of thrift is decoded into headers by thrift codec
+					virtualHostImpl.routes = append(virtualHostImpl.routes,
+						newSofaRouteRuleImpl(virtualHostImpl, &route, i, header.Name))
+				case types.HeaderPeerIdentity:
+					// identity in verified client certificate of mutual tls listener
+					virtualHostImpl.routes = append(virtualHostImpl.routes,
+						newSofaRouteRuleImpl(virtualHostImpl, &route, i, types.HeaderPeerIdentity))
 				}
 			}
 		}
+
+		// routes of the router are matched only if the source ip is in the CIDRs
+		if len(route.Match.SourceCIDRs) > 0 {
+			cidrs := parseSourceCIDRs(route.Match.SourceCIDRs)
+			for _, r := range virtualHostImpl.routes[n:] {
+				virtualHostImpl.sourceIPRoutes = append(virtualHostImpl.sourceIPRoutes, &sourceIPRoute{r, cidrs})
+			}
+			virtualHostImpl.routes = virtualHostImpl.routes[:n]
+		}
 	}
 
 	// todo check cluster's validity
@@ -100,6 +137,7 @@ func NewVirtualHostImpl(virtualHost *v2.VirtualHost, validateClusters bool) *Vir
 type VirtualHostImpl struct {
 	virtualHostName       string
 	routes                []RouteBase //route impl
+	sourceIPRoutes        []*sourceIPRoute
 	virtualClusters       []VirtualClusterEntry
 	sslRequirements       types.SslRequirements
 	corsPolicy            types.CorsPolicy
@@ -124,6 +162,13 @@ func (vh *VirtualHostImpl) RateLimitPolicy() types.RateLimitPolicy {
 }
 
 func (vh *VirtualHostImpl) GetRouteFromEntries(headers map[string]string, randomValue uint64) types.Route {
+	// routes matching the source ip are preferred, requests not matched fall through to the other routes
+	if len(vh.sourceIPRoutes) > 0 {
+		if routeEntry := vh.getRouteBySourceIP(headers, randomValue); routeEntry != nil {
+			return routeEntry
+		}
+	}
+
 	// todo check tls
 	for _, route := range vh.routes {
 
@@ -135,6 +180,61 @@ func (vh *VirtualHostImpl) GetRouteFromEntries(headers map[string]string, random
 	return nil
 }
 
+// getRouteBySourceIP returns the matched route with the longest CIDR prefix containing the source ip,
+// the first one configured wins if prefixes are equally long
+func (vh *VirtualHostImpl) getRouteBySourceIP(headers map[string]string, randomValue uint64) types.Route {
+	ip := net.ParseIP(headers[types.HeaderSourceIP])
+	if ip == nil {
+		return nil
+	}
+
+	var matched types.Route
+	longest := -1
+
+	for _, route := range vh.sourceIPRoutes {
+		if prefixLen := route.prefixLen(ip); prefixLen > longest {
+			if routeEntry := route.Match(headers, randomValue); routeEntry != nil {
+				matched, longest = routeEntry, prefixLen
+			}
+		}
+	}
+
+	return matched
+}
+
+// sourceIPRoute is a route matched only if the source ip is in its CIDRs
+type sourceIPRoute struct {
+	RouteBase
+	cidrs []*net.IPNet
+}
+
+// prefixLen returns the longest prefix of the CIDRs containing the ip, -1 if none
+func (r *sourceIPRoute) prefixLen(ip net.IP) int {
+	longest := -1
+
+	for _, cidr := range r.cidrs {
+		if ones, _ := cidr.Mask.Size(); ones > longest && cidr.Contains(ip) {
+			longest = ones
+		}
+	}
+
+	return longest
+}
+
+func parseSourceCIDRs(cidrs []string) []*net.IPNet {
+	var ipNets []*net.IPNet
+
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			ipNets = append(ipNets, ipNet)
+		} else {
+			log.DefaultLogger.Errorf("Parse Source CIDR Error, cidr = %s", cidr)
+		}
+	}
+
+	return ipNets
+}
+
 type VirtualClusterEntry struct {
 	pattern regexp.Regexp
 	method  optional.String
@@ -0,0 +1,537 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package router
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func newSofaServiceRouter(className string, cluster string) v2.Router {
+	return v2.Router{
+		Match: v2.RouterMatch{
+			Headers: []v2.HeaderMatcher{
+				{Name: types.SofaRouteServiceKey, Value: className},
+			},
+		},
+		Route: v2.RouteAction{ClusterName: cluster},
+	}
+}
+
+func TestSofaServiceRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "sofa",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			newSofaServiceRouter("com.alipay.test.HelloService", "hello_cluster"),
+			newSofaServiceRouter("com.alipay.test.AuditService", "audit_cluster"),
+		},
+	}, false)
+
+	for className, cluster := range map[string]string{
+		"com.alipay.test.HelloService": "hello_cluster",
+		"com.alipay.test.AuditService": "audit_cluster",
+	} {
+		cmd := &sofarpc.BoltRequestCommand{
+			CodecPro:  sofarpc.HESSIAN_SERIALIZE,
+			ClassLen:  int16(len(className)),
+			ClassName: []byte(className),
+		}
+		headers := map[string]string{
+			sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): cmd.GetServiceName(),
+		}
+
+		route := vh.GetRouteFromEntries(headers, 1)
+		if route == nil || route.RouteRule().ClusterName() != cluster {
+			t.Errorf("class name %s should be routed to %s, got %v", className, cluster, route)
+		}
+	}
+
+	if route := vh.GetRouteFromEntries(map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): "com.alipay.test.UnknownService",
+	}, 1); route != nil {
+		t.Errorf("unknown class name should not be routed, got %v", route)
+	}
+}
+
+func TestSofaMethodRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	className := "com.alipay.test.HelloService"
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "sofa",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.SofaRouteServiceKey, Value: className},
+						{Name: types.SofaRouteMethodKey, Value: "foo"},
+					},
+				},
+				Route: v2.RouteAction{ClusterName: "canary_cluster"},
+			},
+			newSofaServiceRouter(className, "stable_cluster"),
+		},
+	}, false)
+
+	for method, cluster := range map[string]string{
+		"foo": "canary_cluster",
+		"bar": "stable_cluster",
+	} {
+		route := vh.GetRouteFromEntries(map[string]string{
+			sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): className,
+			sofarpc.HeaderMethodName:                            method,
+		}, 1)
+		if route == nil || route.RouteRule().ClusterName() != cluster {
+			t.Errorf("method %s should be routed to %s, got %v", method, cluster, route)
+		}
+	}
+
+	// no method carried, matched by className only
+	route := vh.GetRouteFromEntries(map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): className,
+	}, 1)
+	if route == nil || route.RouteRule().ClusterName() != "stable_cluster" {
+		t.Errorf("request without method should be routed to stable_cluster, got %v", route)
+	}
+
+	// method of other class is not matched
+	if route := vh.GetRouteFromEntries(map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): "com.alipay.test.UnknownService",
+		sofarpc.HeaderMethodName:                            "foo",
+	}, 1); route != nil {
+		t.Errorf("method of unknown class name should not be routed, got %v", route)
+	}
+}
+
+func TestSourceIPRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	className := "com.alipay.test.HelloService"
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "vlan",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			newSofaServiceRouter(className, "stable_cluster"),
+			{
+				Match: v2.RouterMatch{SourceCIDRs: []string{"10.0.0.0/8", "192.168.0.0/16"}},
+				Route: v2.RouteAction{ClusterName: "internal_cluster"},
+			},
+			{
+				Match: v2.RouterMatch{
+					Headers:     []v2.HeaderMatcher{{Name: types.SofaRouteServiceKey, Value: className}},
+					SourceCIDRs: []string{"10.8.0.0/16"},
+				},
+				Route: v2.RouteAction{ClusterName: "vlan_cluster"},
+			},
+		},
+	}, false)
+
+	for _, c := range []struct {
+		sourceIP  string
+		className string
+		cluster   string
+	}{
+		// the longest prefix wins among overlapping CIDRs
+		{"10.8.3.4", className, "vlan_cluster"},
+		{"10.9.3.4", className, "internal_cluster"},
+		{"192.168.1.1", className, "internal_cluster"},
+		// the more specific route of other class is not matched
+		{"10.8.3.4", "com.alipay.test.OtherService", "internal_cluster"},
+		// not in the CIDRs, falls through
+		{"172.16.0.1", className, "stable_cluster"},
+		{"", className, "stable_cluster"},
+	} {
+		headers := map[string]string{sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): c.className}
+		if c.sourceIP != "" {
+			headers[types.HeaderSourceIP] = c.sourceIP
+		}
+
+		route := vh.GetRouteFromEntries(headers, 1)
+		if route == nil || route.RouteRule().ClusterName() != c.cluster {
+			t.Errorf("request of %s from %s should be routed to %s, got %v", c.className, c.sourceIP, c.cluster, route)
+		}
+	}
+}
+
+func TestPeerIdentityRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "mtls",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.HeaderPeerIdentity, Value: "spiffe://cluster.local/ns/default/sa/client"},
+					},
+				},
+				Route: v2.RouteAction{ClusterName: "client_cluster"},
+			},
+		},
+	}, false)
+
+	route := vh.GetRouteFromEntries(map[string]string{
+		types.HeaderPeerIdentity: "spiffe://cluster.local/ns/default/sa/client",
+	}, 1)
+	if route == nil || route.RouteRule().ClusterName() != "client_cluster" {
+		t.Errorf("peer identity should be routed to client_cluster, got %v", route)
+	}
+
+	for _, headers := range []map[string]string{
+		{types.HeaderPeerIdentity: "other"},
+		{},
+	} {
+		if route := vh.GetRouteFromEntries(headers, 1); route != nil {
+			t.Errorf("headers %v should not be routed, got %v", headers, route)
+		}
+	}
+}
+
+func TestDubboServiceRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "dubbo",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.DubboRouteServiceKey, Value: "com.alipay.test.DemoService"},
+						{Name: types.DubboRouteMethodKey, Value: "sayHello"},
+					},
+				},
+				Route: v2.RouteAction{ClusterName: "hello_cluster"},
+			},
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.DubboRouteServiceKey, Value: "com.alipay.test.DemoService"},
+					},
+				},
+				Route: v2.RouteAction{ClusterName: "demo_cluster"},
+			},
+		},
+	}, false)
+
+	for method, cluster := range map[string]string{
+		"sayHello": "hello_cluster",
+		"sayBye":   "demo_cluster",
+	} {
+		route := vh.GetRouteFromEntries(map[string]string{
+			types.DubboRouteServiceKey: "com.alipay.test.DemoService",
+			types.DubboRouteMethodKey:  method,
+		}, 1)
+		if route == nil || route.RouteRule().ClusterName() != cluster {
+			t.Errorf("method %s should be routed to %s, got %v", method, cluster, route)
+		}
+	}
+
+	if route := vh.GetRouteFromEntries(map[string]string{
+		types.DubboRouteServiceKey: "com.alipay.test.UnknownService",
+		types.DubboRouteMethodKey:  "sayHello",
+	}, 1); route != nil {
+		t.Errorf("unknown service should not be routed, got %v", route)
+	}
+}
+
+func TestThriftMethodRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "thrift",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.ThriftRouteServiceKey, Value: "Calculator"},
+						{Name: types.ThriftRouteMethodKey, Value: "add"},
+					},
+				},
+				Route: v2.RouteAction{ClusterName: "add_cluster"},
+			},
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.ThriftRouteMethodKey, Value: "ping"},
+					},
+				},
+				Route: v2.RouteAction{ClusterName: "ping_cluster"},
+			},
+		},
+	}, false)
+
+	for cluster, headers := range map[string]map[string]string{
+		"add_cluster": {
+			types.ThriftRouteServiceKey: "Calculator",
+			types.ThriftRouteMethodKey:  "add",
+		},
+		// message name not multiplexed has no service
+		"ping_cluster": {
+			types.ThriftRouteMethodKey: "ping",
+		},
+	} {
+		route := vh.GetRouteFromEntries(headers, 1)
+		if route == nil || route.RouteRule().ClusterName() != cluster {
+			t.Errorf("headers %v should be routed to %s, got %v", headers, cluster, route)
+		}
+	}
+
+	for _, headers := range []map[string]string{
+		{types.ThriftRouteServiceKey: "Calculator", types.ThriftRouteMethodKey: "subtract"},
+		{types.ThriftRouteMethodKey: "add"},
+	} {
+		if route := vh.GetRouteFromEntries(headers, 1); route != nil {
+			t.Errorf("headers %v should not be routed, got %v", headers, route)
+		}
+	}
+}
+
+func TestMirrorRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	mirrored := newSofaServiceRouter("com.alipay.test.HelloService", "hello_cluster")
+	mirrored.Route.MirrorCluster = "shadow_cluster"
+	mirrored.Route.MirrorPercent = 50
+
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "sofa",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			mirrored,
+			newSofaServiceRouter("com.alipay.test.AuditService", "audit_cluster"),
+		},
+	}, false)
+
+	route := vh.GetRouteFromEntries(map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): "com.alipay.test.HelloService",
+	}, 1)
+	if route == nil {
+		t.Fatal("HelloService should be routed")
+	}
+	policy := route.RouteRule().Policy().ShadowPolicy()
+	if policy == nil || policy.ClusterName() != "shadow_cluster" || policy.Percent() != 50 {
+		t.Errorf("unexpected shadow policy %v", policy)
+	}
+
+	route = vh.GetRouteFromEntries(map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassName): "com.alipay.test.AuditService",
+	}, 1)
+	if route == nil {
+		t.Fatal("AuditService should be routed")
+	}
+	if policy := route.RouteRule().Policy().ShadowPolicy(); policy != nil {
+		t.Errorf("route without mirror cluster should have no shadow policy, got %v", policy)
+	}
+}
+
+func newVersionMetadata(version string) v2.Metadata {
+	return v2.Metadata{
+		types.RouterMatadataKey: map[string]interface{}{
+			types.RouterMetadataKeyLb: map[string]interface{}{"version": version},
+		},
+	}
+}
+
+func routeVersion(t *testing.T, route types.Route) string {
+	if route == nil {
+		t.Fatal("request should be routed")
+	}
+	criteria := route.RouteRule().MetadataMatchCriteria()
+	if criteria == nil {
+		return ""
+	}
+	for _, criterion := range criteria.MetadataMatchCriteria() {
+		if criterion.MetadataKeyName() != "version" {
+			continue
+		}
+		for _, version := range []string{"stable", "canary"} {
+			if criterion.MetadataValue() == types.GenerateHashedValue(version) {
+				return version
+			}
+		}
+	}
+	return ""
+}
+
+func TestCanaryRoute(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	vh := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "sofa",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.SofaRouteMatchKey, Value: "com.alipay.test.HelloService"},
+						{Name: "canary", Value: "true"},
+					},
+				},
+				Route: v2.RouteAction{ClusterName: "hello_cluster", MetadataMatch: newVersionMetadata("canary")},
+			},
+			{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{Name: types.SofaRouteMatchKey, Value: "com.alipay.test.HelloService"},
+					},
+				},
+				Route: v2.RouteAction{
+					WeightedClusters: []v2.WeightedCluster{
+						{Clusters: v2.ClusterWeight{Name: "hello_cluster", Weight: 95, MetadataMatch: newVersionMetadata("stable")}},
+						{Clusters: v2.ClusterWeight{Name: "hello_cluster", Weight: 5, MetadataMatch: newVersionMetadata("canary")}},
+					},
+				},
+			},
+		},
+	}, false)
+
+	//header forced
+	for i := 0; i < 100; i++ {
+		route := vh.GetRouteFromEntries(map[string]string{
+			types.SofaRouteMatchKey: "com.alipay.test.HelloService",
+			"canary":                "true",
+		}, rand.Uint64())
+		if version := routeVersion(t, route); version != "canary" || route.RouteRule().ClusterName() != "hello_cluster" {
+			t.Fatalf("canary header should be routed to canary subset of hello_cluster, got %s %s", route.RouteRule().ClusterName(), version)
+		}
+	}
+
+	//weighted, canary header with another value is not forced
+	headers := map[string]string{
+		types.SofaRouteMatchKey: "com.alipay.test.HelloService",
+		"canary":                "false",
+	}
+	counts := make(map[string]int)
+	for i := uint64(0); i < 100; i++ {
+		route := vh.GetRouteFromEntries(headers, i)
+		if route.RouteRule().ClusterName() != "hello_cluster" {
+			t.Fatalf("weighted clusters should be routed to hello_cluster, got %s", route.RouteRule().ClusterName())
+		}
+		counts[routeVersion(t, route)]++
+	}
+	if counts["stable"] != 95 || counts["canary"] != 5 {
+		t.Errorf("expect 95 stable and 5 canary in 100 continuous random values, got %v", counts)
+	}
+
+	counts = make(map[string]int)
+	total := 100000
+	for i := 0; i < total; i++ {
+		counts[routeVersion(t, vh.GetRouteFromEntries(headers, rand.Uint64()))]++
+	}
+	if canary := counts["canary"]; canary < total*4/100 || canary > total*6/100 {
+		t.Errorf("expect about 5%% of requests routed to canary, got %v", counts)
+	}
+}
+
+func TestClassTimeout(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	router := newServiceRouter(".*", "sofa_cluster")
+	router.Route.Timeout = 3 * time.Second
+	router.Route.ClassTimeoutPrefixes = []v2.ClassTimeout{
+		{Prefix: "com.alipay.pay.PayService", Timeout: 200 * time.Millisecond},
+		{Prefix: "com.alipay.pay.", Timeout: 500 * time.Millisecond},
+		{Prefix: "com.alipay.", Timeout: time.Second},
+	}
+	vh := NewVirtualHostImpl(&v2.VirtualHost{Name: "sofa", Domains: []string{"*"}, Routers: []v2.Router{router}}, false)
+
+	route := vh.GetRouteFromEntries(map[string]string{types.SofaRouteMatchKey: "com.alipay.test.TestService:1.0"}, 1)
+	if route == nil {
+		t.Fatalf("request should be routed")
+	}
+
+	for className, timeout := range map[string]time.Duration{
+		"com.alipay.pay.PayService":    200 * time.Millisecond,
+		"com.alipay.pay.PayServiceV2":  200 * time.Millisecond,
+		"com.alipay.pay.RefundService": 500 * time.Millisecond,
+		"com.alipay.user.UserService":  time.Second,
+		"com.antfin.user.UserService":  0,
+		"":                             0,
+	} {
+		if got := route.RouteRule().ClassTimeout(className); got != timeout {
+			t.Errorf("class %q expected timeout %s, got %s", className, timeout, got)
+		}
+	}
+}
+
+func TestRouteHeaders(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	router := newServiceRouter(".*", "sofa_cluster")
+	router.Route.RequestHeadersToAdd = []v2.HeaderValueOption{
+		{Key: "tag", Value: "gray"},
+		{Key: "zone", Value: "gz00b", Append: true},
+		{Key: "app", Value: "mosn"},
+		{Key: "new", Value: "appended", Append: true},
+	}
+	router.Route.RequestHeadersToRemove = []string{"token", "app"}
+	router.Route.ResponseHeadersToAdd = []v2.HeaderValueOption{{Key: "served-by", Value: "mosn"}}
+	router.Route.ResponseHeadersToRemove = []string{"tag"}
+	vh := NewVirtualHostImpl(&v2.VirtualHost{Name: "sofa", Domains: []string{"*"}, Routers: []v2.Router{router}}, false)
+
+	headers := map[string]string{
+		types.SofaRouteMatchKey: "com.alipay.test.TestService:1.0",
+		"token":                 "secret",
+		"zone":                  "gz00a",
+		"app":                   "client",
+	}
+	route := vh.GetRouteFromEntries(headers, 1)
+	if route == nil {
+		t.Fatalf("request should be routed")
+	}
+
+	route.RouteRule().FinalizeRequestHeaders(headers, nil)
+	want := map[string]string{
+		types.SofaRouteMatchKey: "com.alipay.test.TestService:1.0",
+		"tag":                   "gray",
+		"zone":                  "gz00a,gz00b",
+		"app":                   "mosn",
+		"new":                   "appended",
+	}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("request headers expected %v, got %v", want, headers)
+	}
+
+	route.RouteRule().FinalizeResponseHeaders(headers, nil)
+	if _, ok := headers["tag"]; ok || headers["served-by"] != "mosn" {
+		t.Errorf("unexpected response headers %v", headers)
+	}
+
+	// no header configured
+	plain := NewVirtualHostImpl(&v2.VirtualHost{Name: "sofa", Domains: []string{"*"}, Routers: []v2.Router{newServiceRouter(".*", "sofa_cluster")}}, false)
+	route = plain.GetRouteFromEntries(map[string]string{types.SofaRouteMatchKey: "com.alipay.test.TestService:1.0"}, 1)
+	headers = map[string]string{"token": "secret"}
+	route.RouteRule().FinalizeRequestHeaders(headers, nil)
+	route.RouteRule().FinalizeResponseHeaders(headers, nil)
+	if len(headers) != 1 || headers["token"] != "secret" {
+		t.Errorf("headers expected unchanged, got %v", headers)
+	}
+}
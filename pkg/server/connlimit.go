@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package server
+
+import (
+	"net"
+	"sync"
+)
+
+// reasons of connections rejected by the limits of listener
+const (
+	LimitMaxConnections      = "max_connections"
+	LimitMaxConnectionsPerIP = "max_connections_per_ip"
+)
+
+// connLimiter counts the connections of a listener by source ip. It is kept on listener update,
+// so that the connections accepted by the previous config are counted as well
+type connLimiter struct {
+	mux      sync.Mutex
+	max      uint32
+	maxPerIP uint32
+	total    uint32
+	perIP    map[string]uint32
+}
+
+func newConnLimiter(max, maxPerIP uint32) *connLimiter {
+	return &connLimiter{
+		max:      max,
+		maxPerIP: maxPerIP,
+		perIP:    make(map[string]uint32),
+	}
+}
+
+// update changes the limits, connections accepted already are not affected
+func (l *connLimiter) update(max, maxPerIP uint32) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.max = max
+	l.maxPerIP = maxPerIP
+}
+
+// acquire counts a new connection from the source ip, returns the limit exceeded if rejected,
+// or an empty string if accepted
+func (l *connLimiter) acquire(ip string) string {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.max > 0 && l.total >= l.max {
+		return LimitMaxConnections
+	}
+
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return LimitMaxConnectionsPerIP
+	}
+
+	l.total++
+	l.perIP[ip]++
+
+	return ""
+}
+
+// release uncounts a connection accepted from the source ip
+func (l *connLimiter) release(ip string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.perIP[ip] == 0 {
+		return
+	}
+
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] == 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// sourceIP returns the ip of the remote address, the address itself if it has no port
+func sourceIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+
+	return addr.String()
+}
@@ -25,11 +25,14 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/filter/accept/original_dst"
 	"github.com/alipay/sofamosn/pkg/log"
 	"github.com/alipay/sofamosn/pkg/network"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/tls"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
@@ -83,6 +86,50 @@ func (ch *connHandler) AddListener(lc *v2.ListenerConfig, networkFiltersFactory
 	//TODO: connection level stop-chan usage confirm
 	listenerStopChan := make(chan struct{})
 
+	logger, als := ch.newListenerLoggers(lc)
+
+	l := network.NewListener(lc, logger)
+
+	al := newActiveListener(l, logger, als, networkFiltersFactory, streamFiltersFactories, ch, listenerStopChan, lc.DisableConnIo)
+	al.limiter.update(lc.MaxConnections, lc.MaxConnectionsPerIP)
+	al.idleReaper = startIdleReaper(al, lc.IdleTimeout)
+	l.SetListenerCallbacks(al)
+
+	ch.listeners = append(ch.listeners, al)
+
+	return al
+}
+
+// UpdateListener applies a new config to a running listener with the same name.
+// The listening socket is kept, new connections are served by the new config,
+// connections accepted before are drained and closed after lc.DrainTimeout
+func (ch *connHandler) UpdateListener(lc *v2.ListenerConfig, networkFiltersFactory types.NetworkFilterChainFactory,
+	streamFiltersFactories []types.StreamFilterChainFactory) types.ListenerEventListener {
+	for i, old := range ch.listeners {
+		if old.listener.Name() != lc.Name {
+			continue
+		}
+
+		logger, als := ch.newListenerLoggers(lc)
+
+		al := newActiveListener(old.listener, logger, als, networkFiltersFactory, streamFiltersFactories, ch,
+			make(chan struct{}), lc.DisableConnIo)
+		// connections being drained are still counted by the limits
+		al.limiter = old.limiter
+		al.limiter.update(lc.MaxConnections, lc.MaxConnectionsPerIP)
+		al.idleReaper = startIdleReaper(al, lc.IdleTimeout)
+		old.listener.SetListenerCallbacks(al)
+		ch.listeners[i] = al
+
+		go old.drain(lc.DrainTimeout)
+
+		return al
+	}
+
+	return nil
+}
+
+func (ch *connHandler) newListenerLoggers(lc *v2.ListenerConfig) (log.Logger, []types.AccessLog) {
 	//use default listener path
 	if lc.LogPath == "" {
 		lc.LogPath = MosnLogBasePath + string(os.PathSeparator) + lc.Name + ".log"
@@ -103,21 +150,19 @@ func (ch *connHandler) AddListener(lc *v2.ListenerConfig, networkFiltersFactory
 			alConfig.Path = MosnLogBasePath + string(os.PathSeparator) + lc.Name + "_access.log"
 		}
 
-		if al, err := log.NewAccessLog(alConfig.Path, nil, alConfig.Format); err == nil {
+		var filter types.AccessLogFilter
+		if alConfig.SampleSuccess {
+			filter = log.NewSuccessSampleFilter(alConfig.SuccessSampleRate, alConfig.SampleHeader)
+		}
+
+		if al, err := log.NewAccessLog(alConfig.Path, filter, alConfig.Format); err == nil {
 			als = append(als, al)
 		} else {
 			log.StartLogger.Fatalln("initialize listener access logger %s failed : %v", alConfig.Path, err)
 		}
 	}
 
-	l := network.NewListener(lc, logger)
-
-	al := newActiveListener(l, logger, als, networkFiltersFactory, streamFiltersFactories, ch, listenerStopChan, lc.DisableConnIo)
-	l.SetListenerCallbacks(al)
-
-	ch.listeners = append(ch.listeners, al)
-
-	return al
+	return logger, als
 }
 
 func (ch *connHandler) StartListener(listenerTag uint64, lctx context.Context) {
@@ -168,12 +213,34 @@ func (ch *connHandler) StopListeners(lctx context.Context, close bool) {
 		// stop goruntine
 		if close {
 			l.listener.Close(lctx)
+			l.stopIdleReaper()
 		} else {
 			l.listener.Stop()
 		}
 	}
 }
 
+func (ch *connHandler) GracefulStopListeners(lctx context.Context, timeout time.Duration) int {
+	// new connections are refused once the listening sockets are closed
+	ch.StopListeners(lctx, true)
+
+	var forceClosed int64
+	wg := sync.WaitGroup{}
+
+	for _, l := range ch.listeners {
+		wg.Add(1)
+
+		go func(al *activeListener) {
+			defer wg.Done()
+			atomic.AddInt64(&forceClosed, int64(al.drain(timeout)))
+		}(l)
+	}
+
+	wg.Wait()
+
+	return int(forceClosed)
+}
+
 func (ch *connHandler) ListListenersFD(lctx context.Context) []uintptr {
 	fds := make([]uintptr, len(ch.listeners))
 
@@ -215,6 +282,8 @@ type activeListener struct {
 	handler                *connHandler
 	stopChan               chan struct{}
 	stats                  *ListenerStats
+	limiter                *connLimiter
+	idleReaper             *idleReaper // nil if the listener has no idle timeout
 	logger                 log.Logger
 	accessLogs             []types.AccessLog
 }
@@ -228,6 +297,7 @@ func newActiveListener(listener types.Listener, logger log.Logger, accessLoggers
 		networkFiltersFactory:  networkFiltersFactory,
 		streamFiltersFactories: streamFiltersFactories,
 		conns:      list.New(),
+		limiter:    newConnLimiter(0, 0),
 		handler:    handler,
 		stopChan:   stopChan,
 		logger:     logger,
@@ -274,10 +344,24 @@ func (al *activeListener) OnAccept(rawc net.Conn, handOffRestoredDestinationConn
 	if oriRemoteAddr != nil {
 		ctx = context.WithValue(ctx, types.ContextOriRemoteAddr, oriRemoteAddr)
 	}
+	if identity := tls.PeerIdentity(rawc); identity != "" {
+		ctx = context.WithValue(ctx, types.ContextKeyPeerIdentity, identity)
+	}
 	arc.ContinueFilterChain(true, ctx)
 }
 
 func (al *activeListener) OnNewConnection(conn types.Connection, ctx context.Context) {
+	ip := sourceIP(conn.RemoteAddr())
+	if limit := al.limiter.acquire(ip); limit != "" {
+		conn.Close(types.NoFlush, types.LocalClose)
+
+		al.stats.DownstreamConnectionLimited().Inc(1)
+		stats.GetSink().Count(ListenerConnectionsRejectedMetric, 1, stats.Tags{TagListener: al.listener.Name(), TagLimit: limit})
+		al.logger.Infof("connection from %s rejected by %s of listener %s", conn.RemoteAddr(), limit, al.listener.Name())
+
+		return
+	}
+
 	//Register Proxy's Filter
 	configFactory := al.networkFiltersFactory.CreateFilterFactory(al.handler.clusterManager, ctx)
 	buildFilterChain(conn.FilterManager(), configFactory)
@@ -294,8 +378,10 @@ func (al *activeListener) OnNewConnection(conn types.Connection, ctx context.Con
 		len(filterManager.ListWriteFilters()) == 0 {
 		// no filter found, close connection
 		conn.Close(types.NoFlush, types.LocalClose)
+		al.limiter.release(ip)
 	} else {
 		ac := newActiveConnection(al, conn)
+		ac.sourceIP = ip
 
 		al.connsMux.Lock()
 		e := al.conns.PushBack(ac)
@@ -316,6 +402,7 @@ func (al *activeListener) removeConnection(ac *activeConnection) {
 	al.connsMux.Lock()
 	al.conns.Remove(ac.element)
 	al.connsMux.Unlock()
+	al.limiter.release(ac.sourceIP)
 
 	al.stats.DownstreamConnectionActive().Dec(1)
 	al.stats.DownstreamConnectionDestroy().Inc(1)
@@ -324,6 +411,74 @@ func (al *activeListener) removeConnection(ac *activeConnection) {
 	al.logger.Debugf("close downstream connection, stats: %s", al.stats.String())
 }
 
+// drain waits connections accepted by the listener to finish their requests,
+// connections still alive after the timeout are closed forcibly, returns num of them
+func (al *activeListener) drain(timeout time.Duration) int {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	al.logger.Infof("listener %s start draining, timeout = %s", al.listener.Name(), timeout)
+
+	// no connection is left to be reaped once drained
+	defer al.stopIdleReaper()
+
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		if al.closeIdleConnections() == 0 {
+			al.logger.Infof("listener %s drained", al.listener.Name())
+			return 0
+		}
+
+		time.Sleep(drainCheckInterval)
+	}
+
+	conns := al.activeConnections()
+	for _, ac := range conns {
+		ac.conn.Close(types.FlushWrite, types.LocalClose)
+		al.stats.DownstreamConnectionDrainForceClose().Inc(1)
+	}
+
+	al.logger.Infof("listener %s drain timeout, stats: %s", al.listener.Name(), al.stats.String())
+
+	return len(conns)
+}
+
+// closeIdleConnections closes connections without request in processing, returns num of connections left
+func (al *activeListener) closeIdleConnections() int {
+	left := 0
+
+	for _, ac := range al.activeConnections() {
+		if ac.idle() {
+			ac.conn.Close(types.FlushWrite, types.LocalClose)
+		} else {
+			left++
+		}
+	}
+
+	return left
+}
+
+func (al *activeListener) stopIdleReaper() {
+	if al.idleReaper != nil {
+		al.idleReaper.Stop()
+	}
+}
+
+func (al *activeListener) activeConnections() []*activeConnection {
+	al.connsMux.RLock()
+	defer al.connsMux.RUnlock()
+
+	conns := make([]*activeConnection, 0, al.conns.Len())
+
+	for e := al.conns.Front(); e != nil; e = e.Next() {
+		conns = append(conns, e.Value.(*activeConnection))
+	}
+
+	return conns
+}
+
 func (al *activeListener) newConnection(rawc net.Conn, ctx context.Context) {
 	conn := network.NewServerConnection(rawc, al.stopChan, al.logger)
 	oriRemoteAddr := ctx.Value(types.ContextOriRemoteAddr)
@@ -333,6 +488,7 @@ func (al *activeListener) newConnection(rawc net.Conn, ctx context.Context) {
 	newCtx := context.WithValue(ctx, types.ContextKeyConnectionId, conn.Id())
 
 	conn.SetBufferLimit(al.listener.PerConnBufferLimitBytes())
+	conn.SetWriteBufferWatermarks(al.listener.WriteBufferWatermarks())
 
 	al.OnNewConnection(conn, newCtx)
 }
@@ -414,12 +570,16 @@ type activeConnection struct {
 	element  *list.Element
 	listener *activeListener
 	conn     types.Connection
+	sourceIP string
+	// unix nano of the last read, or of the accept if nothing read yet, updated atomically
+	lastRead int64
 }
 
 func newActiveConnection(listener *activeListener, conn types.Connection) *activeConnection {
 	ac := &activeConnection{
 		conn:     conn,
 		listener: listener,
+		lastRead: time.Now().UnixNano(),
 	}
 
 	ac.conn.SetNoDelay(true)
@@ -429,6 +589,7 @@ func newActiveConnection(listener *activeListener, conn types.Connection) *activ
 
 		if bytesRead > 0 {
 			listener.stats.DownstreamBytesRead().Inc(int64(bytesRead))
+			atomic.StoreInt64(&ac.lastRead, time.Now().UnixNano())
 		}
 	})
 	ac.conn.AddBytesSentListener(func(bytesSent uint64) {
@@ -442,6 +603,39 @@ func newActiveConnection(listener *activeListener, conn types.Connection) *activ
 	return ac
 }
 
+// connection is idle if all read filters able to tell report no stream in processing,
+// otherwise only the peer or the drain timeout closes it
+func (ac *activeConnection) idle() bool {
+	counted := false
+
+	for _, rf := range ac.conn.FilterManager().ListReadFilter() {
+		if sc, ok := rf.(activeStreamsCounter); ok {
+			if sc.ActiveStreamsNum() > 0 {
+				return false
+			}
+
+			counted = true
+		}
+	}
+
+	return counted
+}
+
+// inFlight tells whether any read filter reports a stream in processing
+func (ac *activeConnection) inFlight() bool {
+	for _, rf := range ac.conn.FilterManager().ListReadFilter() {
+		if sc, ok := rf.(activeStreamsCounter); ok && sc.ActiveStreamsNum() > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ac *activeConnection) lastReadTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&ac.lastRead))
+}
+
 // ConnectionEventListener
 func (ac *activeConnection) OnEvent(event types.ConnectionEvent) {
 	if event.IsClose() {
@@ -0,0 +1,94 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// idleReaper closes the connections of a listener which read nothing for the timeout,
+// connections with requests in processing are left alone until the requests finish
+type idleReaper struct {
+	listener *activeListener
+	timeout  time.Duration
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// startIdleReaper starts checking the connections every half of the timeout,
+// returns nil if the timeout is not positive
+func startIdleReaper(listener *activeListener, timeout time.Duration) *idleReaper {
+	if timeout <= 0 {
+		return nil
+	}
+
+	r := &idleReaper{
+		listener: listener,
+		timeout:  timeout,
+		stop:     make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+func (r *idleReaper) run() {
+	ticker := time.NewTicker(r.timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.reap(now)
+		}
+	}
+}
+
+// reap closes the connections idle since now - timeout, returns num of them
+func (r *idleReaper) reap(now time.Time) int {
+	al := r.listener
+	reaped := 0
+
+	for _, ac := range al.activeConnections() {
+		if now.Sub(ac.lastReadTime()) < r.timeout || ac.inFlight() {
+			continue
+		}
+
+		ac.conn.Close(types.FlushWrite, types.LocalClose)
+		reaped++
+
+		al.stats.DownstreamConnectionIdleReaped().Inc(1)
+		stats.GetSink().Count(ListenerIdleConnectionsReapedMetric, 1, stats.Tags{TagListener: al.listener.Name()})
+		al.logger.Debugf("downstream connection %d read nothing for %s, close it", ac.conn.Id(), r.timeout)
+	}
+
+	return reaped
+}
+
+// Stop stops checking the connections, safe to be called more than once
+func (r *idleReaper) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
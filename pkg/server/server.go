@@ -50,10 +50,11 @@ func GetServer() *server {
 var servers []*server
 
 type server struct {
-	logger        log.Logger
-	stopChan      chan struct{}
-	handler       types.ConnectionHandler
-	ListenerInMap cmap.ConcurrentMap
+	logger         log.Logger
+	stopChan       chan struct{}
+	handler        types.ConnectionHandler
+	clusterManager types.ClusterManager
+	ListenerInMap  cmap.ConcurrentMap
 }
 
 func NewServer(config *Config, cmFilter types.ClusterManagerFilter, clMng types.ClusterManager) Server {
@@ -77,10 +78,11 @@ func NewServer(config *Config, cmFilter types.ClusterManagerFilter, clMng types.
 	OnProcessShutDown(log.CloseAll)
 
 	server := &server{
-		logger:        log.DefaultLogger,
-		stopChan:      make(chan struct{}),
-		handler:       NewHandler(cmFilter, clMng, log.DefaultLogger),
-		ListenerInMap: cmap.New(),
+		logger:         log.DefaultLogger,
+		stopChan:       make(chan struct{}),
+		handler:        NewHandler(cmFilter, clMng, log.DefaultLogger),
+		clusterManager: clMng,
+		ListenerInMap:  cmap.New(),
 	}
 
 	servers = append(servers, server)
@@ -101,7 +103,13 @@ func (srv *server) AddListenerAndStart(lc *v2.ListenerConfig, networkFiltersFact
 	streamFiltersFactories []types.StreamFilterChainFactory) error {
 
 	if srv.ListenerInMap.Has(lc.Name) {
-		log.DefaultLogger.Warnf("Listener Already Started, Listener Name = %+v", lc.Name)
+		srv.ListenerInMap.Set(lc.Name, lc)
+
+		if srv.handler.UpdateListener(lc, networkFiltersFactory, streamFiltersFactories) == nil {
+			log.DefaultLogger.Warnf("Listener Not Found, Listener Name = %+v", lc.Name)
+		} else {
+			log.DefaultLogger.Infof("Listener Updated, Listener Name = %+v", lc.Name)
+		}
 	} else {
 		srv.ListenerInMap.Set(lc.Name, lc)
 		al := srv.handler.AddListener(lc, networkFiltersFactory, streamFiltersFactories)
@@ -142,6 +150,31 @@ func (srv *server) Close() {
 	close(srv.stopChan)
 }
 
+func (srv *server) GracefulStop(timeout time.Duration) int {
+	start := time.Now()
+
+	forceClosed := srv.handler.GracefulStopListeners(nil, timeout)
+
+	// requests are done or aborted, the pooled upstream connections are no longer needed
+	if srv.clusterManager != nil {
+		srv.clusterManager.Shutdown()
+	}
+
+	srv.logger.Infof("server graceful stop finished in %s, %d connections closed forcibly",
+		time.Since(start), forceClosed)
+
+	return forceClosed
+}
+
+// GracefulStop stops all servers gracefully, returns num of connections closed forcibly
+func GracefulStop(timeout time.Duration) int {
+	forceClosed := 0
+	for _, server := range servers {
+		forceClosed += server.GracefulStop(timeout)
+	}
+	return forceClosed
+}
+
 func Stop() {
 	for _, server := range servers {
 		server.Close()
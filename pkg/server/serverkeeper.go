@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/tls"
 )
 
 func init() {
@@ -78,6 +79,9 @@ func catchSignalsCrossPlatform() {
 				}
 				os.Exit(0)
 			case syscall.SIGTERM:
+				// wait in-flight requests before the shutdown callbacks close the loggers
+				GracefulStop(gracefulTimeout)
+
 				// stop to quit
 				exitCode := executeShutdownCallbacks("SIGTERM")
 				for _, f := range onProcessExit {
@@ -90,10 +94,14 @@ func catchSignalsCrossPlatform() {
 				// reopen
 				log.Reopen()
 			case syscall.SIGHUP:
+				// reopen log files, so that rotated access logs are released
+				// before the new process takes over
+				log.Reopen()
 				// reload
 				reconfigure()
 			case syscall.SIGUSR2:
-				// ignore
+				// reload tls certificates, errors are logged
+				tls.ReloadCertificates()
 			}
 		}
 	}()
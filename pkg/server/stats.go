@@ -23,15 +23,28 @@ import (
 
 const (
 	// ~~~ stats names
-	DownstreamConnectionTotal   = "downstream_connection_total"
-	DownstreamConnectionDestroy = "downstream_connection_destroy"
-	DownstreamConnectionActive  = "downstream_connection_active"
-	DownstreamBytesRead         = "downstream_bytes_read"
-	DownstreamBytesReadCurrent  = "downstream_bytes_read_current"
-	DownstreamBytesWrite        = "downstream_bytes_write"
-	DownstreamBytesWriteCurrent = "downstream_bytes_write_current"
+	DownstreamConnectionTotal           = "downstream_connection_total"
+	DownstreamConnectionDestroy         = "downstream_connection_destroy"
+	DownstreamConnectionActive          = "downstream_connection_active"
+	DownstreamBytesRead                 = "downstream_bytes_read"
+	DownstreamBytesReadCurrent          = "downstream_bytes_read_current"
+	DownstreamBytesWrite                = "downstream_bytes_write"
+	DownstreamBytesWriteCurrent         = "downstream_bytes_write_current"
+	DownstreamConnectionDrainForceClose = "downstream_connection_drain_force_close"
+	DownstreamConnectionLimited         = "downstream_connection_limited"
+	DownstreamConnectionIdleReaped      = "downstream_connection_idle_reaped"
 )
 
+// connections rejected by the limits of listener, recorded to the metrics sink
+const (
+	ListenerConnectionsRejectedMetric = "mosn_listener_connections_rejected_total"
+	TagListener                       = "listener"
+	TagLimit                          = "limit"
+)
+
+// connections closed by the idle reaper of listener, recorded to the metrics sink
+const ListenerIdleConnectionsReapedMetric = "mosn_listener_idle_connections_reaped_total"
+
 type ListenerStats struct {
 	stats *stats.Stats
 }
@@ -46,7 +59,8 @@ func initStats(namespace string) *stats.Stats {
 	return stats.NewStats(namespace).AddCounter(DownstreamConnectionTotal).AddCounter(DownstreamConnectionDestroy).
 		AddCounter(DownstreamConnectionActive).AddCounter(DownstreamBytesRead).
 		AddGauge(DownstreamBytesReadCurrent).AddCounter(DownstreamBytesWrite).
-		AddGauge(DownstreamBytesWriteCurrent)
+		AddGauge(DownstreamBytesWriteCurrent).AddCounter(DownstreamConnectionDrainForceClose).
+		AddCounter(DownstreamConnectionLimited).AddCounter(DownstreamConnectionIdleReaped)
 }
 
 func (ls *ListenerStats) DownstreamConnectionTotal() metrics.Counter {
@@ -77,6 +91,18 @@ func (ls *ListenerStats) DownstreamBytesWriteCurrent() metrics.Gauge {
 	return ls.stats.Gauge(DownstreamBytesWriteCurrent)
 }
 
+func (ls *ListenerStats) DownstreamConnectionDrainForceClose() metrics.Counter {
+	return ls.stats.Counter(DownstreamConnectionDrainForceClose)
+}
+
+func (ls *ListenerStats) DownstreamConnectionLimited() metrics.Counter {
+	return ls.stats.Counter(DownstreamConnectionLimited)
+}
+
+func (ls *ListenerStats) DownstreamConnectionIdleReaped() metrics.Counter {
+	return ls.stats.Counter(DownstreamConnectionIdleReaped)
+}
+
 func (ls *ListenerStats) String() string {
 	return ls.stats.String()
 }
@@ -36,6 +36,18 @@ const (
 	MosnPidFileName = "mosn.pid"
 )
 
+const (
+	// max time to wait connections drained on listener update
+	DefaultDrainTimeout = 15 * time.Second
+
+	drainCheckInterval = 100 * time.Millisecond
+)
+
+// implemented by read filters able to tell whether a connection is in use, e.g. proxy
+type activeStreamsCounter interface {
+	ActiveStreamsNum() int
+}
+
 type Config struct {
 	LogPath         string
 	LogLevel        log.LogLevel
@@ -53,4 +65,9 @@ type Server interface {
 	Restart()
 
 	Close()
+
+	// Stop accepting new connections, wait the accepted ones to finish their requests
+	// up to the timeout, then close the idle upstream connections.
+	// Returns num of downstream connections closed forcibly
+	GracefulStop(timeout time.Duration) int
 }
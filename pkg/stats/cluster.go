@@ -0,0 +1,57 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"sync"
+)
+
+type clusterLatencyKey struct {
+	cluster  string
+	protocol string
+}
+
+var (
+	clusterLatencyMux sync.RWMutex
+	clusterLatency    = make(map[clusterLatencyKey]*LatencyHistogram)
+)
+
+// GetClusterLatency returns the request latency of cluster for the downstream protocol, creates one if not exists.
+// The latency is kept in process, whichever metrics sink is used, for decisions such as hedging
+func GetClusterLatency(cluster, protocol string) *LatencyHistogram {
+	key := clusterLatencyKey{cluster, protocol}
+
+	clusterLatencyMux.RLock()
+	h, ok := clusterLatency[key]
+	clusterLatencyMux.RUnlock()
+
+	if ok {
+		return h
+	}
+
+	clusterLatencyMux.Lock()
+	defer clusterLatencyMux.Unlock()
+
+	if h, ok := clusterLatency[key]; ok {
+		return h
+	}
+
+	h = NewLatencyHistogram(DefaultLatencyBuckets)
+	clusterLatency[key] = h
+
+	return h
+}
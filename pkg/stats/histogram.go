@@ -0,0 +1,153 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds of latency buckets in seconds
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// LatencyHistogram counts latencies into cumulative buckets, which can be
+// rendered as a prometheus histogram
+type LatencyHistogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     int64 // nanoseconds
+}
+
+func NewLatencyHistogram(buckets []float64) *LatencyHistogram {
+	return &LatencyHistogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *LatencyHistogram) Update(d time.Duration) {
+	seconds := d.Seconds()
+
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			atomic.AddUint64(&h.counts[i], 1)
+		}
+	}
+
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// Buckets returns the upper bounds and cumulative counts of buckets
+func (h *LatencyHistogram) Buckets() ([]float64, []uint64) {
+	counts := make([]uint64, len(h.counts))
+
+	for i := range h.counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+
+	return h.buckets, counts
+}
+
+func (h *LatencyHistogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+func (h *LatencyHistogram) Sum() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.sum))
+}
+
+// Percentile estimates the latency at quantile q (0~1) by linear interpolation
+// within the bucket the quantile falls in, zero if no latency is recorded
+func (h *LatencyHistogram) Percentile(q float64) time.Duration {
+	bounds, counts := h.Buckets()
+	total := h.Count()
+
+	if total == 0 || len(bounds) == 0 {
+		return 0
+	}
+
+	rank := q * float64(total)
+	lower, below := 0.0, uint64(0)
+
+	for i, bound := range bounds {
+		if float64(counts[i]) >= rank {
+			inBucket := counts[i] - below
+			seconds := bound
+			if inBucket > 0 {
+				seconds = lower + (bound-lower)*(rank-float64(below))/float64(inBucket)
+			}
+
+			return time.Duration(seconds * float64(time.Second))
+		}
+
+		lower, below = bound, counts[i]
+	}
+
+	// quantile is above the largest bucket
+	return time.Duration(bounds[len(bounds)-1] * float64(time.Second))
+}
+
+// DefaultSizeBuckets are the upper bounds of size buckets in bytes
+var DefaultSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+
+// SizeHistogram counts sizes in bytes into cumulative buckets, which can be
+// rendered as a prometheus histogram
+type SizeHistogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     uint64 // bytes
+}
+
+func NewSizeHistogram(buckets []float64) *SizeHistogram {
+	return &SizeHistogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *SizeHistogram) Update(size uint64) {
+	for i, bound := range h.buckets {
+		if float64(size) <= bound {
+			atomic.AddUint64(&h.counts[i], 1)
+		}
+	}
+
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, size)
+}
+
+// Buckets returns the upper bounds and cumulative counts of buckets
+func (h *SizeHistogram) Buckets() ([]float64, []uint64) {
+	counts := make([]uint64, len(h.counts))
+
+	for i := range h.counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+
+	return h.buckets, counts
+}
+
+func (h *SizeHistogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+func (h *SizeHistogram) Sum() uint64 {
+	return atomic.LoadUint64(&h.sum)
+}
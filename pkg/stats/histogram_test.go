@@ -0,0 +1,59 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	h := NewLatencyHistogram([]float64{0.01, 0.1, 1})
+	if p := h.Percentile(0.95); p != 0 {
+		t.Errorf("percentile of empty histogram should be zero, got %v", p)
+	}
+
+	for i := 0; i < 90; i++ {
+		h.Update(5 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.Update(50 * time.Millisecond)
+	}
+
+	testCases := []struct {
+		q        float64
+		expected time.Duration
+	}{
+		{0.45, 5 * time.Millisecond},
+		{0.9, 10 * time.Millisecond},
+		{0.95, 55 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		p := h.Percentile(tc.q)
+		if diff := p - tc.expected; diff > time.Microsecond || diff < -time.Microsecond {
+			t.Errorf("percentile %v expected %v, got %v", tc.q, tc.expected, p)
+		}
+	}
+
+	// latencies above the largest bucket are counted as the largest bucket
+	h = NewLatencyHistogram([]float64{0.01, 0.1, 1})
+	h.Update(5 * time.Second)
+	if p := h.Percentile(0.5); p != time.Second {
+		t.Errorf("percentile above the largest bucket expected 1s, got %v", p)
+	}
+}
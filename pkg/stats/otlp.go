@@ -0,0 +1,283 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"google.golang.org/grpc"
+)
+
+// resource attributes identifying mosn, following the opentelemetry semantic conventions
+const (
+	OtlpServiceName       = "service.name"
+	OtlpServiceInstanceId = "service.instance.id"
+)
+
+// otlpScope is the instrumentation scope of metrics exported by mosn
+const otlpScope = "github.com/alipay/sofamosn"
+
+// OtlpSink keeps the metrics in memory as the prometheus sink does, and exports them periodically to
+// an OTLP receiver over grpc. Recording never waits for the export, which runs in background, and an
+// export in progress delays the next one instead of queuing. Sums and histograms are cumulative, so
+// the metrics of a failed export are sent by the next one.
+type OtlpSink struct {
+	*PrometheusSink
+
+	endpoint  string
+	conn      *grpc.ClientConn
+	interval  time.Duration
+	resource  *OtlpResource
+	startTime uint64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewOtlpSink returns a sink exporting to the OTLP endpoint every interval, attributes such as
+// service name and instance id are the resource attributes of the exported metrics
+func NewOtlpSink(endpoint string, interval time.Duration, attributes map[string]string) (*OtlpSink, error) {
+	// connecting in background, exports fail until connected
+	conn, err := grpc.Dial(endpoint, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &OtlpSink{
+		PrometheusSink: NewPrometheusSink(),
+		endpoint:       endpoint,
+		conn:           conn,
+		interval:       interval,
+		resource:       &OtlpResource{Attributes: otlpAttributes(attributes)},
+		startTime:      uint64(time.Now().UnixNano()),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// Close stops the periodic export after exporting the metrics once more
+func (s *OtlpSink) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+
+	return s.conn.Close()
+}
+
+func (s *OtlpSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			s.export()
+			return
+		case <-ticker.C:
+			s.export()
+		}
+	}
+}
+
+// export sends all metrics, the call times out in an interval so that a slow receiver delays
+// at most one export
+func (s *OtlpSink) export() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	request := &OtlpExportMetricsServiceRequest{
+		ResourceMetrics: []*OtlpResourceMetrics{
+			{
+				Resource: s.resource,
+				ScopeMetrics: []*OtlpScopeMetrics{
+					{
+						Scope:   &OtlpInstrumentationScope{Name: otlpScope},
+						Metrics: s.collect(uint64(time.Now().UnixNano())),
+					},
+				},
+			},
+		},
+	}
+
+	response := &OtlpExportMetricsServiceResponse{}
+	if err := s.conn.Invoke(ctx, otlpExportMethod, request, response); err != nil {
+		s.Count(OtlpExportsFailed, 1, nil)
+		log.DefaultLogger.Errorf("export metrics to otlp endpoint %s failed: %v", s.endpoint, err)
+		return err
+	}
+
+	if partial := response.PartialSuccess; partial != nil && partial.RejectedDataPoints > 0 {
+		log.DefaultLogger.Warnf("otlp endpoint %s rejected %d data points: %s", s.endpoint,
+			partial.RejectedDataPoints, partial.ErrorMessage)
+	}
+
+	return nil
+}
+
+// collect converts the metrics kept in memory to OTLP metrics, sorted by name
+func (s *OtlpSink) collect(now uint64) []*OtlpMetric {
+	s.mux.RLock()
+	families := make([]*promFamily, 0, len(s.families))
+	for _, family := range s.families {
+		families = append(families, family)
+	}
+	s.mux.RUnlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	metrics := make([]*OtlpMetric, 0, len(families))
+	for _, family := range families {
+		metrics = append(metrics, s.collectFamily(family, now))
+	}
+
+	return metrics
+}
+
+func (s *OtlpSink) collectFamily(f *promFamily, now uint64) *OtlpMetric {
+	f.mux.RLock()
+	all := make([]*promSeries, 0, len(f.series))
+	for _, series := range f.series {
+		all = append(all, series)
+	}
+	f.mux.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].labels < all[j].labels
+	})
+
+	metric := &OtlpMetric{
+		Name:        f.name,
+		Description: promHelps[f.name],
+		Unit:        "1",
+	}
+
+	switch f.typ {
+	case promCounter:
+		metric.Sum = &OtlpSum{
+			AggregationTemporality: otlpTemporalityCumulative,
+			IsMonotonic:            true,
+		}
+		for _, series := range all {
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, s.numberDataPoint(series, now))
+		}
+
+	case promGauge:
+		metric.Gauge = &OtlpGauge{}
+		for _, series := range all {
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, s.numberDataPoint(series, now))
+		}
+
+	case promHistogram:
+		metric.Unit = "s"
+		if promSizeHistograms[f.name] {
+			metric.Unit = "By"
+		}
+		metric.Histogram = &OtlpHistogram{AggregationTemporality: otlpTemporalityCumulative}
+		for _, series := range all {
+			metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, s.histogramDataPoint(series, now))
+		}
+	}
+
+	return metric
+}
+
+func (s *OtlpSink) numberDataPoint(series *promSeries, now uint64) *OtlpNumberDataPoint {
+	value := atomic.LoadInt64(&series.value)
+
+	return &OtlpNumberDataPoint{
+		StartTimeUnixNano: s.startTime,
+		TimeUnixNano:      now,
+		AsInt:             &value,
+		Attributes:        otlpAttributes(series.tags),
+	}
+}
+
+func (s *OtlpSink) histogramDataPoint(series *promSeries, now uint64) *OtlpHistogramDataPoint {
+	var count uint64
+	var bounds []float64
+	var cumulative []uint64
+	var sum float64
+
+	if h := series.sizes; h != nil {
+		count = h.Count()
+		bounds, cumulative = h.Buckets()
+		sum = float64(h.Sum())
+	} else {
+		h := series.histogram
+		count = h.Count()
+		bounds, cumulative = h.Buckets()
+		sum = h.Sum().Seconds()
+	}
+
+	// buckets are not updated atomically together, so the cumulative counts are made
+	// non-decreasing before converted to the counts of each bucket
+	counts := make([]uint64, len(cumulative)+1)
+	var last uint64
+	for i, c := range cumulative {
+		if c < last {
+			c = last
+		}
+		counts[i] = c - last
+		last = c
+	}
+	if count < last {
+		count = last
+	}
+	counts[len(cumulative)] = count - last
+
+	return &OtlpHistogramDataPoint{
+		StartTimeUnixNano: s.startTime,
+		TimeUnixNano:      now,
+		Count:             count,
+		Sum:               &sum,
+		BucketCounts:      counts,
+		ExplicitBounds:    bounds,
+		Attributes:        otlpAttributes(series.tags),
+	}
+}
+
+// otlpAttributes converts tags to attributes sorted by key
+func otlpAttributes(tags map[string]string) []*OtlpKeyValue {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]*OtlpKeyValue, len(keys))
+	for i, key := range keys {
+		value := tags[key]
+		attributes[i] = &OtlpKeyValue{Key: key, Value: &OtlpAnyValue{StringValue: &value}}
+	}
+
+	return attributes
+}
@@ -0,0 +1,213 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"google.golang.org/grpc"
+)
+
+func init() {
+	log.InitDefaultLogger("", log.INFO)
+}
+
+// fakeOtlpReceiver sends the export requests it receives to the channel, after the delay if set
+type fakeOtlpReceiver struct {
+	requests chan *OtlpExportMetricsServiceRequest
+	delay    time.Duration
+}
+
+func (r *fakeOtlpReceiver) Export(ctx context.Context, in *OtlpExportMetricsServiceRequest) (*OtlpExportMetricsServiceResponse, error) {
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	select {
+	case r.requests <- in:
+	default:
+	}
+
+	return &OtlpExportMetricsServiceResponse{}, nil
+}
+
+func startOtlpReceiver(t *testing.T, receiver *fakeOtlpReceiver) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+
+	server := grpc.NewServer()
+	RegisterOtlpMetricsServiceServer(server, receiver)
+	go server.Serve(lis)
+
+	return lis.Addr().String(), server.Stop
+}
+
+func otlpAttributeMap(attributes []*OtlpKeyValue) map[string]string {
+	m := make(map[string]string, len(attributes))
+	for _, kv := range attributes {
+		if kv.Value != nil && kv.Value.StringValue != nil {
+			m[kv.Key] = *kv.Value.StringValue
+		}
+	}
+	return m
+}
+
+func findOtlpMetric(request *OtlpExportMetricsServiceRequest, name string) *OtlpMetric {
+	for _, rm := range request.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, metric := range sm.Metrics {
+				if metric.Name == name {
+					return metric
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestOtlpSinkExport(t *testing.T) {
+	receiver := &fakeOtlpReceiver{requests: make(chan *OtlpExportMetricsServiceRequest, 1)}
+	address, stop := startOtlpReceiver(t, receiver)
+	defer stop()
+
+	s, err := NewOtlpSink(address, 20*time.Millisecond, map[string]string{
+		OtlpServiceName:       "mosn",
+		OtlpServiceInstanceId: "mosn-test",
+	})
+	if err != nil {
+		t.Fatalf("create otlp sink error: %v", err)
+	}
+	defer s.Close()
+
+	tags := Tags{TagCluster: "otlp_cluster", TagProtocol: "SofaRpc"}
+	s.Count(ClusterRequestsTotal, 2, tags)
+	s.Gauge(ClusterRequestsActive, 3, tags)
+	s.Gauge(ClusterRequestsActive, -1, tags)
+	s.Histogram(ClusterRequestDuration, 0.03, tags)
+	s.Histogram(ClusterRequestDuration, 20, tags)
+	s.Histogram(ClusterContentSize, 2000, tags)
+
+	var request *OtlpExportMetricsServiceRequest
+	deadline := time.After(2 * time.Second)
+	for request == nil || findOtlpMetric(request, ClusterContentSize) == nil {
+		select {
+		case request = <-receiver.requests:
+		case <-deadline:
+			t.Fatalf("no metrics exported")
+		}
+	}
+
+	if len(request.ResourceMetrics) != 1 {
+		t.Fatalf("expect 1 resource metrics, got %d", len(request.ResourceMetrics))
+	}
+	resource := otlpAttributeMap(request.ResourceMetrics[0].Resource.Attributes)
+	if resource[OtlpServiceName] != "mosn" || resource[OtlpServiceInstanceId] != "mosn-test" {
+		t.Errorf("unexpected resource attributes %v", resource)
+	}
+
+	total := findOtlpMetric(request, ClusterRequestsTotal)
+	if total == nil || total.Sum == nil || !total.Sum.IsMonotonic ||
+		total.Sum.AggregationTemporality != otlpTemporalityCumulative || len(total.Sum.DataPoints) != 1 {
+		t.Fatalf("unexpected requests total metric %v", total)
+	}
+	point := total.Sum.DataPoints[0]
+	if point.AsInt == nil || *point.AsInt != 2 || point.StartTimeUnixNano == 0 || point.TimeUnixNano < point.StartTimeUnixNano {
+		t.Errorf("unexpected requests total data point %v", point)
+	}
+	if attributes := otlpAttributeMap(point.Attributes); attributes[TagCluster] != "otlp_cluster" || attributes[TagProtocol] != "SofaRpc" {
+		t.Errorf("unexpected data point attributes %v", attributes)
+	}
+
+	active := findOtlpMetric(request, ClusterRequestsActive)
+	if active == nil || active.Gauge == nil || len(active.Gauge.DataPoints) != 1 || *active.Gauge.DataPoints[0].AsInt != 2 {
+		t.Errorf("unexpected requests active metric %v", active)
+	}
+
+	duration := findOtlpMetric(request, ClusterRequestDuration)
+	if duration == nil || duration.Histogram == nil || duration.Unit != "s" || len(duration.Histogram.DataPoints) != 1 {
+		t.Fatalf("unexpected request duration metric %v", duration)
+	}
+	hp := duration.Histogram.DataPoints[0]
+	if hp.Count != 2 || hp.Sum == nil || *hp.Sum < 20 || len(hp.ExplicitBounds) != len(DefaultLatencyBuckets) ||
+		len(hp.BucketCounts) != len(DefaultLatencyBuckets)+1 {
+		t.Fatalf("unexpected request duration data point %v", hp)
+	}
+	// 0.03s in the bucket of (0.025, 0.05], and 20s above the last bound
+	for i, count := range hp.BucketCounts {
+		var want uint64
+		if i == 3 || i == len(DefaultLatencyBuckets) {
+			want = 1
+		}
+		if count != want {
+			t.Errorf("bucket %d expect count %d, got %d", i, want, count)
+		}
+	}
+
+	if size := findOtlpMetric(request, ClusterContentSize); size.Unit != "By" || size.Histogram.DataPoints[0].Count != 1 {
+		t.Errorf("unexpected content size metric %v", size)
+	}
+}
+
+func TestOtlpSinkExportFailure(t *testing.T) {
+	// the receiver is slower than the export interval
+	receiver := &fakeOtlpReceiver{requests: make(chan *OtlpExportMetricsServiceRequest, 1), delay: time.Second}
+	address, stop := startOtlpReceiver(t, receiver)
+	defer stop()
+
+	s, err := NewOtlpSink(address, 20*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("create otlp sink error: %v", err)
+	}
+
+	failed := s.getSeries(OtlpExportsFailed, promCounter, nil)
+
+	// recording is not blocked by the exports in progress
+	start := time.Now()
+	for atomic.LoadInt64(&failed.value) < 2 {
+		for i := 0; i < 1000; i++ {
+			s.Count(ClusterRequestsTotal, 1, Tags{TagCluster: "otlp_cluster"})
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatalf("exports to slow receiver should fail by timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the receiver is unreachable
+	stop()
+
+	closed := make(chan error)
+	go func() {
+		closed <- s.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Errorf("close should not wait for the unreachable receiver longer than an interval")
+	}
+}
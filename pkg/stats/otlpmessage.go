@@ -0,0 +1,222 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// Messages of the OTLP metrics service, opentelemetry/proto/collector/metrics/v1/metrics_service.proto.
+// Only the fields exported by mosn are declared, the field tags follow the proto definition so they are
+// encoded in protobuf wire format. Fields of oneof are pointers, so that zero values are encoded as well.
+
+const otlpExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// aggregation temporality of sums and histograms, metrics are exported as totals since the sink started
+const otlpTemporalityCumulative int32 = 2
+
+type OtlpExportMetricsServiceRequest struct {
+	ResourceMetrics []*OtlpResourceMetrics `protobuf:"bytes,1,rep,name=resource_metrics,json=resourceMetrics" json:"resource_metrics,omitempty"`
+}
+
+func (m *OtlpExportMetricsServiceRequest) Reset()         { *m = OtlpExportMetricsServiceRequest{} }
+func (m *OtlpExportMetricsServiceRequest) String() string { return proto.CompactTextString(m) }
+func (*OtlpExportMetricsServiceRequest) ProtoMessage()    {}
+
+type OtlpExportMetricsServiceResponse struct {
+	PartialSuccess *OtlpExportMetricsPartialSuccess `protobuf:"bytes,1,opt,name=partial_success,json=partialSuccess" json:"partial_success,omitempty"`
+}
+
+func (m *OtlpExportMetricsServiceResponse) Reset()         { *m = OtlpExportMetricsServiceResponse{} }
+func (m *OtlpExportMetricsServiceResponse) String() string { return proto.CompactTextString(m) }
+func (*OtlpExportMetricsServiceResponse) ProtoMessage()    {}
+
+type OtlpExportMetricsPartialSuccess struct {
+	RejectedDataPoints int64  `protobuf:"varint,1,opt,name=rejected_data_points,json=rejectedDataPoints,proto3" json:"rejected_data_points,omitempty"`
+	ErrorMessage       string `protobuf:"bytes,2,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+}
+
+func (m *OtlpExportMetricsPartialSuccess) Reset()         { *m = OtlpExportMetricsPartialSuccess{} }
+func (m *OtlpExportMetricsPartialSuccess) String() string { return proto.CompactTextString(m) }
+func (*OtlpExportMetricsPartialSuccess) ProtoMessage()    {}
+
+type OtlpResourceMetrics struct {
+	Resource     *OtlpResource       `protobuf:"bytes,1,opt,name=resource" json:"resource,omitempty"`
+	ScopeMetrics []*OtlpScopeMetrics `protobuf:"bytes,2,rep,name=scope_metrics,json=scopeMetrics" json:"scope_metrics,omitempty"`
+}
+
+func (m *OtlpResourceMetrics) Reset()         { *m = OtlpResourceMetrics{} }
+func (m *OtlpResourceMetrics) String() string { return proto.CompactTextString(m) }
+func (*OtlpResourceMetrics) ProtoMessage()    {}
+
+type OtlpResource struct {
+	Attributes []*OtlpKeyValue `protobuf:"bytes,1,rep,name=attributes" json:"attributes,omitempty"`
+}
+
+func (m *OtlpResource) Reset()         { *m = OtlpResource{} }
+func (m *OtlpResource) String() string { return proto.CompactTextString(m) }
+func (*OtlpResource) ProtoMessage()    {}
+
+type OtlpScopeMetrics struct {
+	Scope   *OtlpInstrumentationScope `protobuf:"bytes,1,opt,name=scope" json:"scope,omitempty"`
+	Metrics []*OtlpMetric             `protobuf:"bytes,2,rep,name=metrics" json:"metrics,omitempty"`
+}
+
+func (m *OtlpScopeMetrics) Reset()         { *m = OtlpScopeMetrics{} }
+func (m *OtlpScopeMetrics) String() string { return proto.CompactTextString(m) }
+func (*OtlpScopeMetrics) ProtoMessage()    {}
+
+type OtlpInstrumentationScope struct {
+	Name    string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+}
+
+func (m *OtlpInstrumentationScope) Reset()         { *m = OtlpInstrumentationScope{} }
+func (m *OtlpInstrumentationScope) String() string { return proto.CompactTextString(m) }
+func (*OtlpInstrumentationScope) ProtoMessage()    {}
+
+// OtlpKeyValue is an attribute, only string values are exported
+type OtlpKeyValue struct {
+	Key   string        `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value *OtlpAnyValue `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *OtlpKeyValue) Reset()         { *m = OtlpKeyValue{} }
+func (m *OtlpKeyValue) String() string { return proto.CompactTextString(m) }
+func (*OtlpKeyValue) ProtoMessage()    {}
+
+type OtlpAnyValue struct {
+	StringValue *string `protobuf:"bytes,1,opt,name=string_value,json=stringValue" json:"string_value,omitempty"`
+}
+
+func (m *OtlpAnyValue) Reset()         { *m = OtlpAnyValue{} }
+func (m *OtlpAnyValue) String() string { return proto.CompactTextString(m) }
+func (*OtlpAnyValue) ProtoMessage()    {}
+
+// OtlpMetric has one of gauge, sum and histogram
+type OtlpMetric struct {
+	Name        string         `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Description string         `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Unit        string         `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Gauge       *OtlpGauge     `protobuf:"bytes,5,opt,name=gauge" json:"gauge,omitempty"`
+	Sum         *OtlpSum       `protobuf:"bytes,7,opt,name=sum" json:"sum,omitempty"`
+	Histogram   *OtlpHistogram `protobuf:"bytes,9,opt,name=histogram" json:"histogram,omitempty"`
+}
+
+func (m *OtlpMetric) Reset()         { *m = OtlpMetric{} }
+func (m *OtlpMetric) String() string { return proto.CompactTextString(m) }
+func (*OtlpMetric) ProtoMessage()    {}
+
+type OtlpGauge struct {
+	DataPoints []*OtlpNumberDataPoint `protobuf:"bytes,1,rep,name=data_points,json=dataPoints" json:"data_points,omitempty"`
+}
+
+func (m *OtlpGauge) Reset()         { *m = OtlpGauge{} }
+func (m *OtlpGauge) String() string { return proto.CompactTextString(m) }
+func (*OtlpGauge) ProtoMessage()    {}
+
+type OtlpSum struct {
+	DataPoints             []*OtlpNumberDataPoint `protobuf:"bytes,1,rep,name=data_points,json=dataPoints" json:"data_points,omitempty"`
+	AggregationTemporality int32                  `protobuf:"varint,2,opt,name=aggregation_temporality,json=aggregationTemporality,proto3" json:"aggregation_temporality,omitempty"`
+	IsMonotonic            bool                   `protobuf:"varint,3,opt,name=is_monotonic,json=isMonotonic,proto3" json:"is_monotonic,omitempty"`
+}
+
+func (m *OtlpSum) Reset()         { *m = OtlpSum{} }
+func (m *OtlpSum) String() string { return proto.CompactTextString(m) }
+func (*OtlpSum) ProtoMessage()    {}
+
+type OtlpHistogram struct {
+	DataPoints             []*OtlpHistogramDataPoint `protobuf:"bytes,1,rep,name=data_points,json=dataPoints" json:"data_points,omitempty"`
+	AggregationTemporality int32                     `protobuf:"varint,2,opt,name=aggregation_temporality,json=aggregationTemporality,proto3" json:"aggregation_temporality,omitempty"`
+}
+
+func (m *OtlpHistogram) Reset()         { *m = OtlpHistogram{} }
+func (m *OtlpHistogram) String() string { return proto.CompactTextString(m) }
+func (*OtlpHistogram) ProtoMessage()    {}
+
+type OtlpNumberDataPoint struct {
+	StartTimeUnixNano uint64          `protobuf:"fixed64,2,opt,name=start_time_unix_nano,json=startTimeUnixNano,proto3" json:"start_time_unix_nano,omitempty"`
+	TimeUnixNano      uint64          `protobuf:"fixed64,3,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	AsInt             *int64          `protobuf:"fixed64,6,opt,name=as_int,json=asInt" json:"as_int,omitempty"`
+	Attributes        []*OtlpKeyValue `protobuf:"bytes,7,rep,name=attributes" json:"attributes,omitempty"`
+}
+
+func (m *OtlpNumberDataPoint) Reset()         { *m = OtlpNumberDataPoint{} }
+func (m *OtlpNumberDataPoint) String() string { return proto.CompactTextString(m) }
+func (*OtlpNumberDataPoint) ProtoMessage()    {}
+
+// OtlpHistogramDataPoint has counts of explicit buckets, which are not cumulative, and the bucket
+// counts has one more element than the explicit bounds for the bucket above the last bound
+type OtlpHistogramDataPoint struct {
+	StartTimeUnixNano uint64          `protobuf:"fixed64,2,opt,name=start_time_unix_nano,json=startTimeUnixNano,proto3" json:"start_time_unix_nano,omitempty"`
+	TimeUnixNano      uint64          `protobuf:"fixed64,3,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Count             uint64          `protobuf:"fixed64,4,opt,name=count,proto3" json:"count,omitempty"`
+	Sum               *float64        `protobuf:"fixed64,5,opt,name=sum" json:"sum,omitempty"`
+	BucketCounts      []uint64        `protobuf:"fixed64,6,rep,packed,name=bucket_counts,json=bucketCounts" json:"bucket_counts,omitempty"`
+	ExplicitBounds    []float64       `protobuf:"fixed64,7,rep,packed,name=explicit_bounds,json=explicitBounds" json:"explicit_bounds,omitempty"`
+	Attributes        []*OtlpKeyValue `protobuf:"bytes,9,rep,name=attributes" json:"attributes,omitempty"`
+}
+
+func (m *OtlpHistogramDataPoint) Reset()         { *m = OtlpHistogramDataPoint{} }
+func (m *OtlpHistogramDataPoint) String() string { return proto.CompactTextString(m) }
+func (*OtlpHistogramDataPoint) ProtoMessage()    {}
+
+// OtlpMetricsServiceServer is implemented by OTLP receivers written in go, such as the one in tests
+type OtlpMetricsServiceServer interface {
+	Export(ctx context.Context, in *OtlpExportMetricsServiceRequest) (*OtlpExportMetricsServiceResponse, error)
+}
+
+func RegisterOtlpMetricsServiceServer(s *grpc.Server, srv OtlpMetricsServiceServer) {
+	s.RegisterService(&otlpMetricsServiceDesc, srv)
+}
+
+func otlpExportHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OtlpExportMetricsServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(OtlpMetricsServiceServer).Export(ctx, in)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: otlpExportMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OtlpMetricsServiceServer).Export(ctx, req.(*OtlpExportMetricsServiceRequest))
+	}
+
+	return interceptor(ctx, in, info, handler)
+}
+
+var otlpMetricsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.collector.metrics.v1.MetricsService",
+	HandlerType: (*OtlpMetricsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Export",
+			Handler:    otlpExportHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "opentelemetry/proto/collector/metrics/v1/metrics_service.proto",
+}
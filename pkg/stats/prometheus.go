@@ -0,0 +1,276 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	promCounter   = "counter"
+	promGauge     = "gauge"
+	promHistogram = "histogram"
+)
+
+var promHelps = map[string]string{
+	ClusterRequestsTotal:      "Total requests sent to upstream cluster.",
+	ClusterRequestsActive:     "Active requests of upstream cluster.",
+	ClusterResponsesTotal:     "Total responses of upstream cluster by classified status.",
+	ClusterRequestDuration:    "Request latency of upstream cluster in seconds.",
+	ClusterContentSize:        "Content size of upstream cluster before compression in bytes.",
+	ClusterWireContentSize:    "Content size of upstream cluster on the wire in bytes.",
+	ClusterUnmatchedResponses: "Responses of upstream cluster dropped as no pending request matches the request id.",
+	OtlpExportsFailed:         "Failed exports of metrics to the OTLP endpoint.",
+}
+
+// histograms observing sizes in bytes, the others observe latencies in seconds
+var promSizeHistograms = map[string]bool{
+	ClusterContentSize:     true,
+	ClusterWireContentSize: true,
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusSink keeps the metrics in memory, which are rendered in prometheus text exposition format
+type PrometheusSink struct {
+	mux      sync.RWMutex
+	families map[string]*promFamily
+}
+
+// promFamily is a metric of a type, with a series for each set of tags
+type promFamily struct {
+	name string
+	typ  string
+
+	mux    sync.RWMutex
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	labels    string
+	tags      Tags
+	value     int64
+	histogram *LatencyHistogram
+	sizes     *SizeHistogram
+}
+
+func NewPrometheusSink() *PrometheusSink {
+	return &PrometheusSink{
+		families: make(map[string]*promFamily),
+	}
+}
+
+func (s *PrometheusSink) Count(name string, value int64, tags Tags) {
+	atomic.AddInt64(&s.getSeries(name, promCounter, tags).value, value)
+}
+
+func (s *PrometheusSink) Gauge(name string, delta int64, tags Tags) {
+	atomic.AddInt64(&s.getSeries(name, promGauge, tags).value, delta)
+}
+
+func (s *PrometheusSink) Histogram(name string, value float64, tags Tags) {
+	series := s.getSeries(name, promHistogram, tags)
+	if series.sizes != nil {
+		series.sizes.Update(uint64(value))
+	} else {
+		series.histogram.Update(time.Duration(value * float64(time.Second)))
+	}
+}
+
+// getSeries returns the series of tags, the type of a metric is decided when it is first recorded
+func (s *PrometheusSink) getSeries(name, typ string, tags Tags) *promSeries {
+	s.mux.RLock()
+	family, ok := s.families[name]
+	s.mux.RUnlock()
+
+	if !ok {
+		s.mux.Lock()
+		if family, ok = s.families[name]; !ok {
+			family = &promFamily{
+				name:   name,
+				typ:    typ,
+				series: make(map[string]*promSeries),
+			}
+			s.families[name] = family
+		}
+		s.mux.Unlock()
+	}
+
+	labels := promLabels(tags)
+
+	family.mux.RLock()
+	series, ok := family.series[labels]
+	family.mux.RUnlock()
+
+	if ok {
+		return series
+	}
+
+	family.mux.Lock()
+	defer family.mux.Unlock()
+
+	if series, ok := family.series[labels]; ok {
+		return series
+	}
+
+	// tags may be reused by the caller, they are kept for the sinks exporting the series
+	seriesTags := make(Tags, len(tags))
+	for k, v := range tags {
+		seriesTags[k] = v
+	}
+
+	series = &promSeries{labels: labels, tags: seriesTags}
+	if family.typ == promHistogram {
+		if promSizeHistograms[name] {
+			series.sizes = NewSizeHistogram(DefaultSizeBuckets)
+		} else {
+			series.histogram = NewLatencyHistogram(DefaultLatencyBuckets)
+		}
+	}
+	family.series[labels] = series
+
+	return series
+}
+
+// WritePrometheus renders the metrics of the sink, metrics are sorted by name and tags
+func (s *PrometheusSink) WritePrometheus(w io.Writer) error {
+	s.mux.RLock()
+	families := make([]*promFamily, 0, len(s.families))
+	for _, family := range s.families {
+		families = append(families, family)
+	}
+	s.mux.RUnlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, family := range families {
+		family.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+func (f *promFamily) write(w io.Writer) {
+	f.mux.RLock()
+	all := make([]*promSeries, 0, len(f.series))
+	for _, series := range f.series {
+		all = append(all, series)
+	}
+	f.mux.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].labels < all[j].labels
+	})
+
+	if help, ok := promHelps[f.name]; ok {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, help)
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	for _, series := range all {
+		if f.typ != promHistogram {
+			fmt.Fprintf(w, "%s%s %d\n", f.name, wrapLabels(series.labels), atomic.LoadInt64(&series.value))
+			continue
+		}
+
+		var count uint64
+		var bounds []float64
+		var counts []uint64
+		var sum string
+
+		if h := series.sizes; h != nil {
+			count = h.Count()
+			bounds, counts = h.Buckets()
+			sum = strconv.FormatUint(h.Sum(), 10)
+		} else {
+			h := series.histogram
+			count = h.Count()
+			bounds, counts = h.Buckets()
+			sum = strconv.FormatFloat(h.Sum().Seconds(), 'g', -1, 64)
+		}
+
+		for i, bound := range bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name,
+				wrapLabels(joinLabels(series.labels, "le=\""+strconv.FormatFloat(bound, 'g', -1, 64)+"\"")), counts[i])
+		}
+		// buckets may be updated after count is loaded
+		if len(counts) > 0 && counts[len(counts)-1] > count {
+			count = counts[len(counts)-1]
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, wrapLabels(joinLabels(series.labels, `le="+Inf"`)), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, wrapLabels(series.labels), sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, wrapLabels(series.labels), count)
+	}
+}
+
+// promWriter is implemented by the sinks keeping metrics in memory, such as the prometheus and OTLP sinks
+type promWriter interface {
+	WritePrometheus(w io.Writer) error
+}
+
+// WritePrometheus renders the metrics of the sink in use, nothing is written
+// if metrics are not kept in memory by the sink
+func WritePrometheus(w io.Writer) error {
+	if s, ok := GetSink().(promWriter); ok {
+		return s.WritePrometheus(w)
+	}
+
+	return nil
+}
+
+// promLabels renders tags as labels sorted by name, without braces
+func promLabels(tags Tags) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		labels[i] = fmt.Sprintf("%s=\"%s\"", key, promLabelEscaper.Replace(tags[key]))
+	}
+
+	return strings.Join(labels, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+
+	return labels + "," + label
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+
+	return "{" + labels + "}"
+}
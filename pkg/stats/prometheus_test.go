@@ -0,0 +1,137 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	promSampleRegexp = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\]|\\.)*"(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\]|\\.)*")*\})? [-+]?[0-9.eE+-]+$`)
+	promTypeRegexp   = regexp.MustCompile(`^# TYPE ([a-zA-Z_:][a-zA-Z0-9_:]*) (counter|gauge|histogram|summary|untyped)$`)
+)
+
+// checkPrometheusText checks the text is valid prometheus exposition format, every sample belongs to a declared metric
+func checkPrometheusText(t *testing.T, text string) {
+	declared := make(map[string]string)
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		if m := promTypeRegexp.FindStringSubmatch(line); m != nil {
+			declared[m[1]] = m[2]
+			continue
+		}
+
+		m := promSampleRegexp.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("invalid prometheus line: %q", line)
+			continue
+		}
+		name := m[1]
+		if _, ok := declared[name]; !ok {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if declared[strings.TrimSuffix(name, suffix)] == "histogram" {
+					name = strings.TrimSuffix(name, suffix)
+				}
+			}
+		}
+		if _, ok := declared[name]; !ok {
+			t.Errorf("sample of undeclared metric: %q", line)
+		}
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	s := NewPrometheusSink()
+	tags := Tags{TagCluster: "prom_cluster", TagProtocol: "SofaRpc"}
+
+	// simulated traffic: 3 requests, one is still active
+	for i := 0; i < 3; i++ {
+		s.Count(ClusterRequestsTotal, 1, tags)
+		s.Gauge(ClusterRequestsActive, 1, tags)
+	}
+	s.Gauge(ClusterRequestsActive, -2, tags)
+	s.Histogram(ClusterRequestDuration, (3 * time.Millisecond).Seconds(), tags)
+	s.Histogram(ClusterRequestDuration, (200 * time.Millisecond).Seconds(), tags)
+	s.Count(ClusterResponsesTotal, 1, tags.With(TagStatus, "success"))
+	s.Count(ClusterResponsesTotal, 1, tags.With(TagStatus, "timeout"))
+
+	s.Count(ClusterRequestsTotal, 1, Tags{TagCluster: `escape"cluster`, TagProtocol: "Http2"})
+	s.Count("mosn_untagged_total", 1, nil)
+
+	var buf bytes.Buffer
+	if err := s.WritePrometheus(&buf); err != nil {
+		t.Fatalf("write prometheus error: %v", err)
+	}
+	text := buf.String()
+	checkPrometheusText(t, text)
+
+	for _, expected := range []string{
+		`mosn_cluster_requests_total{cluster="prom_cluster",protocol="SofaRpc"} 3`,
+		`mosn_cluster_requests_active{cluster="prom_cluster",protocol="SofaRpc"} 1`,
+		`mosn_cluster_responses_total{cluster="prom_cluster",protocol="SofaRpc",status="success"} 1`,
+		`mosn_cluster_responses_total{cluster="prom_cluster",protocol="SofaRpc",status="timeout"} 1`,
+		`mosn_cluster_request_duration_seconds_bucket{cluster="prom_cluster",protocol="SofaRpc",le="0.005"} 1`,
+		`mosn_cluster_request_duration_seconds_bucket{cluster="prom_cluster",protocol="SofaRpc",le="0.25"} 2`,
+		`mosn_cluster_request_duration_seconds_bucket{cluster="prom_cluster",protocol="SofaRpc",le="+Inf"} 2`,
+		`mosn_cluster_request_duration_seconds_sum{cluster="prom_cluster",protocol="SofaRpc"} 0.203`,
+		`mosn_cluster_request_duration_seconds_count{cluster="prom_cluster",protocol="SofaRpc"} 2`,
+		`mosn_cluster_requests_total{cluster="escape\"cluster",protocol="Http2"} 1`,
+		`mosn_untagged_total 1`,
+	} {
+		if !strings.Contains(text, expected+"\n") {
+			t.Errorf("expected %s in prometheus output:\n%s", expected, text)
+		}
+	}
+}
+
+func TestWritePrometheusSizeHistogram(t *testing.T) {
+	s := NewPrometheusSink()
+	tags := Tags{TagCluster: "prom_cluster", TagDirection: DirectionRequest}
+
+	// a content compressed from 10000 to 3000 bytes, and a small one not compressed
+	s.Histogram(ClusterContentSize, 10000, tags)
+	s.Histogram(ClusterWireContentSize, 3000, tags)
+	s.Histogram(ClusterContentSize, 100, tags)
+	s.Histogram(ClusterWireContentSize, 100, tags)
+
+	var buf bytes.Buffer
+	if err := s.WritePrometheus(&buf); err != nil {
+		t.Fatalf("write prometheus error: %v", err)
+	}
+	text := buf.String()
+	checkPrometheusText(t, text)
+
+	for _, expected := range []string{
+		`mosn_cluster_content_size_bytes_bucket{cluster="prom_cluster",direction="request",le="256"} 1`,
+		`mosn_cluster_content_size_bytes_bucket{cluster="prom_cluster",direction="request",le="16384"} 2`,
+		`mosn_cluster_content_size_bytes_sum{cluster="prom_cluster",direction="request"} 10100`,
+		`mosn_cluster_content_size_bytes_count{cluster="prom_cluster",direction="request"} 2`,
+		`mosn_cluster_wire_content_size_bytes_bucket{cluster="prom_cluster",direction="request",le="4096"} 2`,
+		`mosn_cluster_wire_content_size_bytes_sum{cluster="prom_cluster",direction="request"} 3100`,
+	} {
+		if !strings.Contains(text, expected+"\n") {
+			t.Errorf("expected %s in prometheus output:\n%s", expected, text)
+		}
+	}
+}
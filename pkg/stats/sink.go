@@ -0,0 +1,175 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/rcrowley/go-metrics"
+)
+
+// names of the request metrics of upstream clusters
+const (
+	ClusterRequestsTotal   = "mosn_cluster_requests_total"
+	ClusterRequestsActive  = "mosn_cluster_requests_active"
+	ClusterResponsesTotal  = "mosn_cluster_responses_total"
+	ClusterRequestDuration = "mosn_cluster_request_duration_seconds"
+	// content size before compression, and on the wire which may be compressed
+	ClusterContentSize     = "mosn_cluster_content_size_bytes"
+	ClusterWireContentSize = "mosn_cluster_wire_content_size_bytes"
+	// responses dropped as no pending request on the upstream connection has the request id
+	ClusterUnmatchedResponses = "mosn_cluster_unmatched_responses_total"
+)
+
+// exports of the OTLP sink failed, e.g. the receiver is unreachable or too slow
+const OtlpExportsFailed = "mosn_otlp_exports_failed_total"
+
+// tag names of metrics
+const (
+	TagCluster   = "cluster"
+	TagProtocol  = "protocol"
+	TagStatus    = "status"
+	TagDirection = "direction"
+)
+
+// values of the direction tag
+const (
+	DirectionRequest  = "request"
+	DirectionResponse = "response"
+)
+
+// metrics sink types
+const (
+	PrometheusSinkType = "prometheus"
+	StatsdSinkType     = "statsd"
+	OtlpSinkType       = "otlp"
+)
+
+// Tags are the dimensions of a metric, such as cluster and protocol
+type Tags map[string]string
+
+// With returns a copy of tags with the tag added
+func (t Tags) With(key, value string) Tags {
+	tags := make(Tags, len(t)+1)
+	for k, v := range t {
+		tags[k] = v
+	}
+	tags[key] = value
+
+	return tags
+}
+
+// MetricsSink records metrics to a monitoring system
+type MetricsSink interface {
+	// Count adds value to the counter
+	Count(name string, value int64, tags Tags)
+
+	// Gauge adds delta to the gauge, which may go down
+	Gauge(name string, delta int64, tags Tags)
+
+	// Histogram observes a value, latencies are observed in seconds
+	Histogram(name string, value float64, tags Tags)
+}
+
+// DefaultPrometheusSink is the sink used if not configured, its metrics are served by admin
+var DefaultPrometheusSink = NewPrometheusSink()
+
+type sinkHolder struct {
+	sink MetricsSink
+}
+
+var sink atomic.Value
+
+func init() {
+	sink.Store(sinkHolder{DefaultPrometheusSink})
+}
+
+// SetSink sets the sink all metrics are recorded to, the default prometheus sink is used if nil
+func SetSink(s MetricsSink) {
+	if s == nil {
+		s = DefaultPrometheusSink
+	}
+
+	sink.Store(sinkHolder{s})
+}
+
+// GetSink returns the sink metrics should be recorded to
+func GetSink() MetricsSink {
+	return sink.Load().(sinkHolder).sink
+}
+
+// NewSink creates the sink of config, the default prometheus sink is returned if no sink configured
+func NewSink(config *v2.MetricsConfig) (MetricsSink, error) {
+	switch config.Sink {
+	case "", PrometheusSinkType:
+		return DefaultPrometheusSink, nil
+	case StatsdSinkType:
+		return NewStatsdSink(config.StatsdAddress, config.StatsdPrefix)
+	case OtlpSinkType:
+		attributes := map[string]string{
+			OtlpServiceName:       config.OtlpServiceName,
+			OtlpServiceInstanceId: config.OtlpInstanceId,
+		}
+		for k, v := range config.OtlpResourceAttributes {
+			attributes[k] = v
+		}
+		return NewOtlpSink(config.OtlpEndpoint, config.OtlpExportInterval, attributes)
+	default:
+		return nil, fmt.Errorf("unknown metrics sink: %s", config.Sink)
+	}
+}
+
+// sinkCounter records the updates of a counter to the sink as well
+type sinkCounter struct {
+	metrics.Counter
+
+	name  string
+	tags  Tags
+	gauge bool
+}
+
+// CounterWithSink returns a counter whose updates are also recorded to the sink, as a gauge
+// if the counter counts active ones, such as active connections, and may go down
+func CounterWithSink(counter metrics.Counter, name string, tags Tags) metrics.Counter {
+	return &sinkCounter{
+		Counter: counter,
+		name:    name,
+		tags:    tags,
+		gauge:   strings.HasSuffix(strings.ToLower(name), "active"),
+	}
+}
+
+func (c *sinkCounter) Inc(i int64) {
+	c.Counter.Inc(i)
+	c.record(i)
+}
+
+func (c *sinkCounter) Dec(i int64) {
+	c.Counter.Dec(i)
+	c.record(-i)
+}
+
+func (c *sinkCounter) record(delta int64) {
+	if c.gauge {
+		GetSink().Gauge(c.name, delta, c.tags)
+	} else {
+		GetSink().Count(c.name, delta, c.tags)
+	}
+}
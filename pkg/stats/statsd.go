@@ -0,0 +1,102 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// characters reserved by statsd line protocol and graphite tags are replaced
+var statsdEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", ";", "_", "=", "_", " ", "_", "\n", "_")
+
+// StatsdSink sends metrics to statsd over udp, tags are appended to the metric name
+// in graphite tagged format, e.g. mosn.mosn_cluster_requests_total;cluster=foo;protocol=SofaRpc
+type StatsdSink struct {
+	prefix string
+	conn   net.Conn
+}
+
+// NewStatsdSink returns a sink sending to the statsd address, metric names are prefixed with prefix if not empty
+func NewStatsdSink(address, prefix string) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	return &StatsdSink{
+		prefix: prefix,
+		conn:   conn,
+	}, nil
+}
+
+func (s *StatsdSink) Count(name string, value int64, tags Tags) {
+	s.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (s *StatsdSink) Gauge(name string, delta int64, tags Tags) {
+	// a signed value adjusts the gauge instead of setting it
+	value := strconv.FormatInt(delta, 10)
+	if delta >= 0 {
+		value = "+" + value
+	}
+
+	s.send(name, value, "g", tags)
+}
+
+func (s *StatsdSink) Histogram(name string, value float64, tags Tags) {
+	if promSizeHistograms[name] {
+		s.send(name, strconv.FormatFloat(value, 'g', -1, 64), "h", tags)
+		return
+	}
+
+	// latencies are observed in seconds, statsd timers are in milliseconds
+	s.send(name, strconv.FormatFloat(value*1000, 'g', -1, 64), "ms", tags)
+}
+
+func (s *StatsdSink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsdSink) send(name, value, typ string, tags Tags) {
+	var buf bytes.Buffer
+
+	buf.WriteString(s.prefix)
+	buf.WriteString(statsdEscaper.Replace(name))
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		buf.WriteString(";" + statsdEscaper.Replace(key) + "=" + statsdEscaper.Replace(tags[key]))
+	}
+
+	buf.WriteString(":" + value + "|" + typ)
+
+	// metrics are dropped if statsd is unreachable, as udp does
+	s.conn.Write(buf.Bytes())
+}
@@ -0,0 +1,107 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stats
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsdSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp error: %v", err)
+	}
+	defer conn.Close()
+
+	s, err := NewStatsdSink(conn.LocalAddr().String(), "mosn")
+	if err != nil {
+		t.Fatalf("create statsd sink error: %v", err)
+	}
+	defer s.Close()
+
+	tags := Tags{TagProtocol: "SofaRpc", TagCluster: "statsd:cluster"}
+	s.Count(ClusterRequestsTotal, 1, tags)
+	s.Gauge(ClusterRequestsActive, 1, tags)
+	s.Gauge(ClusterRequestsActive, -1, tags)
+	s.Histogram(ClusterRequestDuration, 0.25, tags)
+	s.Histogram(ClusterContentSize, 512, tags)
+	s.Count("untagged", 2, nil)
+
+	//tags are sorted by name, reserved characters are replaced
+	for _, expected := range []string{
+		"mosn.mosn_cluster_requests_total;cluster=statsd_cluster;protocol=SofaRpc:1|c",
+		"mosn.mosn_cluster_requests_active;cluster=statsd_cluster;protocol=SofaRpc:+1|g",
+		"mosn.mosn_cluster_requests_active;cluster=statsd_cluster;protocol=SofaRpc:-1|g",
+		"mosn.mosn_cluster_request_duration_seconds;cluster=statsd_cluster;protocol=SofaRpc:250|ms",
+		"mosn.mosn_cluster_content_size_bytes;cluster=statsd_cluster;protocol=SofaRpc:512|h",
+		"mosn.untagged:2|c",
+	} {
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read statsd packet error: %v", err)
+		}
+		if string(buf[:n]) != expected {
+			t.Errorf("expect statsd packet %s, got %s", expected, buf[:n])
+		}
+	}
+}
+
+type fakeSink struct {
+	counts map[string]int64
+	gauges map[string]int64
+}
+
+func (s *fakeSink) Count(name string, value int64, tags Tags) {
+	s.counts[name+promLabels(tags)] += value
+}
+
+func (s *fakeSink) Gauge(name string, delta int64, tags Tags) {
+	s.gauges[name+promLabels(tags)] += delta
+}
+
+func (s *fakeSink) Histogram(name string, value float64, tags Tags) {}
+
+func TestCounterWithSink(t *testing.T) {
+	sink := &fakeSink{counts: make(map[string]int64), gauges: make(map[string]int64)}
+	SetSink(sink)
+	defer SetSink(nil)
+
+	tags := Tags{TagCluster: "sink_cluster"}
+	total := CounterWithSink(NewStats("sink").AddCounter("total").Counter("total"), "total", tags)
+	active := CounterWithSink(NewStats("sink").AddCounter("active").Counter("active"), "active", tags)
+
+	total.Inc(2)
+	active.Inc(2)
+	active.Dec(1)
+
+	if total.Count() != 2 || active.Count() != 1 {
+		t.Errorf("wrapped counters should be updated, got total %d, active %d", total.Count(), active.Count())
+	}
+	if sink.counts[`totalcluster="sink_cluster"`] != 2 || sink.gauges[`activecluster="sink_cluster"`] != 1 ||
+		len(sink.counts) != 1 || len(sink.gauges) != 1 {
+		t.Errorf("unexpected recorded metrics, counts %v, gauges %v", sink.counts, sink.gauges)
+	}
+
+	SetSink(nil)
+	if GetSink() != DefaultPrometheusSink {
+		t.Errorf("expect default prometheus sink, got %v", GetSink())
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stream
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// methods which http1 request line begins with
+var httpMethods = [][]byte{
+	[]byte("GET "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("DELETE "),
+	[]byte("HEAD "),
+	[]byte("OPTIONS "),
+	[]byte("PATCH "),
+	[]byte("TRACE "),
+	[]byte("CONNECT "),
+}
+
+func init() {
+	Register(protocol.Auto, &autoStreamConnFactory{})
+}
+
+// autoStreamConnFactory creates server stream connection which detects the protocol
+// on the first bytes received, only server side is supported
+type autoStreamConnFactory struct{}
+
+func (f *autoStreamConnFactory) CreateClientStream(context context.Context, connection types.ClientConnection,
+	streamConnCallbacks types.StreamConnectionEventListener, connCallbacks types.ConnectionEventListener) types.ClientStreamConnection {
+	return nil
+}
+
+func (f *autoStreamConnFactory) CreateServerStream(context context.Context, connection types.Connection,
+	callbacks types.ServerStreamConnectionEventListener) types.ServerStreamConnection {
+	return &autoServerStreamConnection{
+		context:    context,
+		connection: connection,
+		callbacks:  callbacks,
+		protocol:   protocol.Auto,
+	}
+}
+
+func (f *autoStreamConnFactory) CreateBiDirectStream(context context.Context, connection types.ClientConnection,
+	clientCallbacks types.StreamConnectionEventListener,
+	serverCallbacks types.ServerStreamConnectionEventListener) types.ClientStreamConnection {
+	return nil
+}
+
+// types.ServerStreamConnection
+type autoServerStreamConnection struct {
+	context    context.Context
+	connection types.Connection
+	callbacks  types.ServerStreamConnectionEventListener
+
+	protocol types.Protocol
+	codec    types.ServerStreamConnection
+}
+
+// Dispatch detects the protocol on the first call, and dispatches data to the codec created then.
+// Data is only peeked on detection, so that it is decoded by the codec as a whole.
+func (conn *autoServerStreamConnection) Dispatch(buffer types.IoBuffer) {
+	if conn.codec == nil {
+		prot := SelectProtocol(buffer.Bytes())
+
+		// not enough data to tell
+		if prot == protocol.Auto {
+			return
+		}
+
+		conn.codec = CreateServerStreamConnection(conn.context, prot, conn.connection, conn.callbacks)
+		if conn.codec == nil {
+			log.ByContext(conn.context).Errorf("no stream factory for detected protocol %s, close connection", prot)
+			conn.connection.Close(types.NoFlush, types.LocalClose)
+			return
+		}
+
+		conn.protocol = prot
+	}
+
+	conn.codec.Dispatch(buffer)
+}
+
+// Protocol returns the protocol detected, or protocol.Auto before detection
+func (conn *autoServerStreamConnection) Protocol() types.Protocol {
+	return conn.protocol
+}
+
+func (conn *autoServerStreamConnection) GoAway() {
+	if conn.codec != nil {
+		conn.codec.GoAway()
+	}
+}
+
+// SelectProtocol tells http1 request from bolt frame by the first bytes of connection.
+// Bolt frame begins with a protocol code byte, which never starts a http1 method.
+// protocol.Auto is returned if data is a prefix of http1 method, more data is needed then.
+func SelectProtocol(data []byte) types.Protocol {
+	if len(data) == 0 {
+		return protocol.Auto
+	}
+
+	for _, method := range httpMethods {
+		if len(data) >= len(method) {
+			if bytes.HasPrefix(data, method) {
+				return protocol.Http1
+			}
+		} else if bytes.HasPrefix(method, data) {
+			return protocol.Auto
+		}
+	}
+
+	return protocol.SofaRpc
+}
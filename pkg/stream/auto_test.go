@@ -0,0 +1,48 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package stream
+
+import (
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func TestSelectProtocol(t *testing.T) {
+	testCases := []struct {
+		data     []byte
+		expected types.Protocol
+	}{
+		{[]byte("GET / HTTP/1.1\r\n"), protocol.Http1},
+		{[]byte("POST /echo HTTP/1.1\r\n"), protocol.Http1},
+		{[]byte("OPTIONS * HTTP/1.1\r\n"), protocol.Http1},
+		{[]byte{1, 1, 0, 1}, protocol.SofaRpc},
+		{[]byte{2}, protocol.SofaRpc},
+		{[]byte("GETX"), protocol.SofaRpc},
+		// prefix of http method, more data is needed
+		{[]byte("P"), protocol.Auto},
+		{[]byte("OPTION"), protocol.Auto},
+		{[]byte{}, protocol.Auto},
+	}
+
+	for i, tc := range testCases {
+		if prot := SelectProtocol(tc.data); prot != tc.expected {
+			t.Errorf("case %d: expect protocol %s, but got %s", i, tc.expected, prot)
+		}
+	}
+}
@@ -259,7 +259,11 @@ func (r *activeRequest) OnReceiveTrailers(trailers map[string]string) {
 	r.onDecodeComplete()
 }
 
+// the response is received but broken, e.g. exceeds the limits of cluster, the request is done with the error
 func (r *activeRequest) OnDecodeError(err error, headers map[string]string) {
+	r.onPreDecodeComplete()
+	r.responseReceiver.OnDecodeError(err, headers)
+	r.onDecodeComplete()
 }
 
 func (r *activeRequest) onPreDecodeComplete() {
@@ -22,11 +22,7 @@ import (
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
-var streamFactories map[types.Protocol]ProtocolStreamFactory
-
-func init() {
-	streamFactories = make(map[types.Protocol]ProtocolStreamFactory)
-}
+var streamFactories = make(map[types.Protocol]ProtocolStreamFactory)
 
 func Register(prot types.Protocol, factory ProtocolStreamFactory) {
 	streamFactories[prot] = factory
@@ -78,6 +78,8 @@ func (p *connPool) Close() {
 
 func (p *connPool) onConnectionEvent(client *activeClient, event types.ConnectionEvent) {
 	if event.IsClose() {
+		p.host.HostStats().UpstreamConnectionActive.Dec(1)
+		p.host.ClusterInfo().Stats().UpstreamConnectionActive.Dec(1)
 
 		if client.closeWithActiveReq {
 			if event == types.LocalClose {
@@ -0,0 +1,199 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// limits of the requests decoded by server stream connection, the body limit is the default one of fasthttp server
+const (
+	DefaultMaxRequestHeaderSize = 64 * 1024
+	DefaultMaxRequestBodySize   = fasthttp.DefaultMaxRequestBodySize
+)
+
+// max length of a chunk size line, chunk extensions are not supported
+const maxChunkSizeLineLen = 32
+
+var (
+	ErrRequestHeaderTooLarge = errors.New("request header exceeds the limit")
+	ErrMalformedChunk        = errors.New("malformed chunked body")
+)
+
+var (
+	// end of the request header
+	headerEnd = []byte("\r\n\r\n")
+	crlf      = []byte("\r\n")
+)
+
+// requestDecoder decodes requests from the data read by connection. The framing of the request
+// being received is kept between reads, so that the data is scanned only once rather than decoded
+// from the start on every read.
+type requestDecoder struct {
+	maxHeaderSize int
+	maxBodySize   int
+
+	// request with the header decoded, nil if the header is not received completely
+	ctx *fasthttp.RequestCtx
+	// end of header is searched from scanned
+	scanned   int
+	headerLen int
+	// length of the whole request, -1 if the end of chunked body is not found yet
+	requestLen int
+	// offset of the next chunk and the body length of the chunks before it
+	chunkOffset int
+	bodyLen     int
+}
+
+func newRequestDecoder(maxHeaderSize, maxBodySize int) *requestDecoder {
+	return &requestDecoder{
+		maxHeaderSize: maxHeaderSize,
+		maxBodySize:   maxBodySize,
+	}
+}
+
+// decode returns the request at the start of data and the num of bytes of it, or nil request
+// if data is not enough. data should start with the bytes passed last time if nil request is returned.
+// fasthttp.ErrBodyTooLarge is returned if the body exceeds the limit.
+func (d *requestDecoder) decode(data []byte) (*fasthttp.RequestCtx, int, error) {
+	if d.ctx == nil {
+		if err := d.decodeHeader(data); err != nil || d.ctx == nil {
+			return nil, 0, err
+		}
+	}
+
+	if d.requestLen < 0 {
+		if err := d.scanChunks(data); err != nil || d.requestLen < 0 {
+			return nil, 0, err
+		}
+	}
+
+	if len(data) < d.requestLen {
+		return nil, 0, nil
+	}
+
+	ctx, headerLen, requestLen := d.ctx, d.headerLen, d.requestLen
+	d.reset()
+
+	body := data[headerLen:requestLen]
+	if err := ctx.Request.ContinueReadBody(bufio.NewReaderSize(bytes.NewReader(body), len(body)+1), d.maxBodySize); err != nil {
+		return nil, 0, err
+	}
+
+	return ctx, requestLen, nil
+}
+
+func (d *requestDecoder) decodeHeader(data []byte) error {
+	// the end of header may be split by reads
+	from := d.scanned - len(headerEnd) + 1
+	if from < 0 {
+		from = 0
+	}
+
+	end := bytes.Index(data[from:], headerEnd)
+	if end < 0 {
+		if len(data) > d.maxHeaderSize {
+			return ErrRequestHeaderTooLarge
+		}
+		d.scanned = len(data)
+
+		return nil
+	}
+
+	headerLen := from + end + len(headerEnd)
+	if headerLen > d.maxHeaderSize {
+		return ErrRequestHeaderTooLarge
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	if err := ctx.Request.Header.Read(bufio.NewReaderSize(bytes.NewReader(data[:headerLen]), headerLen)); err != nil {
+		return err
+	}
+
+	d.ctx = ctx
+	d.headerLen = headerLen
+
+	switch contentLength := ctx.Request.Header.ContentLength(); {
+	case contentLength == -1:
+		// chunked
+		d.requestLen = -1
+		d.chunkOffset = headerLen
+	case contentLength > d.maxBodySize:
+		return fasthttp.ErrBodyTooLarge
+	case contentLength >= 0:
+		d.requestLen = headerLen + contentLength
+	default:
+		// requests without content length and chunked encoding have no body
+		d.requestLen = headerLen
+	}
+
+	return nil
+}
+
+// scanChunks finds the end of the chunked body, from the chunk not received completely last time
+func (d *requestDecoder) scanChunks(data []byte) error {
+	for {
+		line := data[d.chunkOffset:]
+		lineEnd := bytes.Index(line, crlf)
+		if lineEnd < 0 {
+			if len(line) > maxChunkSizeLineLen {
+				return ErrMalformedChunk
+			}
+
+			return nil
+		}
+
+		chunkSize, err := strconv.ParseInt(string(line[:lineEnd]), 16, 64)
+		if err != nil || lineEnd > maxChunkSizeLineLen || chunkSize < 0 {
+			return ErrMalformedChunk
+		}
+		if int64(d.bodyLen)+chunkSize > int64(d.maxBodySize) {
+			return fasthttp.ErrBodyTooLarge
+		}
+
+		chunkEnd := d.chunkOffset + lineEnd + len(crlf) + int(chunkSize) + len(crlf)
+		if len(data) < chunkEnd {
+			return nil
+		}
+		if !bytes.Equal(data[chunkEnd-len(crlf):chunkEnd], crlf) {
+			return ErrMalformedChunk
+		}
+
+		d.chunkOffset = chunkEnd
+		d.bodyLen += int(chunkSize)
+
+		// last chunk, trailers are not supported
+		if chunkSize == 0 {
+			d.requestLen = chunkEnd
+			return nil
+		}
+	}
+}
+
+func (d *requestDecoder) reset() {
+	d.ctx = nil
+	d.scanned = 0
+	d.headerLen = 0
+	d.requestLen = 0
+	d.chunkOffset = 0
+	d.bodyLen = 0
+}
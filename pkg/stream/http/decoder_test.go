@@ -0,0 +1,98 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package http
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestRequestDecoderIncremental(t *testing.T) {
+	request := "POST /echo HTTP/1.1\r\nHost: mosn\r\nContent-Length: 5\r\n\r\nhello"
+	data := request + "GET /next HTTP/1.1\r\nHost: mosn\r\n\r\n"
+
+	d := newRequestDecoder(DefaultMaxRequestHeaderSize, DefaultMaxRequestBodySize)
+
+	// the request is received byte by byte
+	for i := 1; i < len(request); i++ {
+		if ctx, _, err := d.decode([]byte(data[:i])); ctx != nil || err != nil {
+			t.Fatalf("expect request incomplete with %d bytes, got %v, %v", i, ctx, err)
+		}
+	}
+
+	ctx, consumed, err := d.decode([]byte(data))
+	if err != nil || ctx == nil {
+		t.Fatalf("decode request failed: %v", err)
+	}
+	if consumed != len(request) || string(ctx.Path()) != "/echo" || string(ctx.Request.Body()) != "hello" {
+		t.Errorf("unexpected request, consumed = %d, path = %s, body = %s", consumed, ctx.Path(), ctx.Request.Body())
+	}
+
+	// the pipelined request follows
+	ctx, consumed, err = d.decode([]byte(data[consumed:]))
+	if err != nil || ctx == nil || string(ctx.Path()) != "/next" || consumed != len(data)-len(request) {
+		t.Errorf("decode pipelined request failed: %v, %v, %d", ctx, err, consumed)
+	}
+}
+
+func TestRequestDecoderChunked(t *testing.T) {
+	request := "POST /echo HTTP/1.1\r\nHost: mosn\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"
+
+	d := newRequestDecoder(DefaultMaxRequestHeaderSize, DefaultMaxRequestBodySize)
+
+	for i := 1; i < len(request); i++ {
+		if ctx, _, err := d.decode([]byte(request[:i])); ctx != nil || err != nil {
+			t.Fatalf("expect request incomplete with %d bytes, got %v, %v", i, ctx, err)
+		}
+	}
+
+	ctx, consumed, err := d.decode([]byte(request))
+	if err != nil || ctx == nil {
+		t.Fatalf("decode request failed: %v", err)
+	}
+	if consumed != len(request) || string(ctx.Request.Body()) != "hello world" {
+		t.Errorf("unexpected request, consumed = %d, body = %s", consumed, ctx.Request.Body())
+	}
+}
+
+func TestRequestDecoderErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		request string
+		err     error
+	}{
+		{"bad chunk size", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n", ErrMalformedChunk},
+		{"no crlf after chunk", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello world", ErrMalformedChunk},
+		{"long chunk size line", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" + strings.Repeat("0", 64), ErrMalformedChunk},
+		{"large content length", "POST / HTTP/1.1\r\nContent-Length: 1025\r\n\r\n", fasthttp.ErrBodyTooLarge},
+		{"large chunked body", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n400\r\n", fasthttp.ErrBodyTooLarge},
+		{"large header", "GET / HTTP/1.1\r\nCookie: " + strings.Repeat("a", 256), ErrRequestHeaderTooLarge},
+	} {
+		d := newRequestDecoder(128, 1024)
+
+		// a chunk of 0x400 bytes is allowed alone
+		if tc.name == "large chunked body" {
+			tc.request += strings.Repeat("a", 0x400) + "\r\n1\r\n"
+		}
+
+		if _, _, err := d.decode([]byte(tc.request)); err != tc.err {
+			t.Errorf("%s: expect error %v, got %v", tc.name, tc.err, err)
+		}
+	}
+}
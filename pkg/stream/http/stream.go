@@ -147,7 +147,18 @@ func (csw *clientStreamWrapper) NewStream(streamId string, responseDecoder types
 // types.ServerStreamConnection
 type serverStreamConnection struct {
 	streamConnection
+	connection                types.Connection
 	serverStreamConnCallbacks types.ServerStreamConnectionEventListener
+
+	decoder *requestDecoder
+
+	// requests read are decoded one by one, the next one is decoded after the response of the active
+	// stream is sent, so that the responses of pipelined requests are in order. guarded by mux
+	mux          sync.Mutex
+	pending      types.IoBuffer
+	dispatching  bool
+	readDisabled bool
+	upgraded     bool
 }
 
 func newServerStreamConnection(context context.Context, connection types.Connection,
@@ -155,22 +166,117 @@ func newServerStreamConnection(context context.Context, connection types.Connect
 	ssc := &serverStreamConnection{
 		streamConnection: streamConnection{
 			context:       context,
+			protocol:      protocol.Http1,
 			rawConnection: connection.RawConn(),
+			logger:        log.ByContext(context),
 		},
+		connection:                connection,
 		serverStreamConnCallbacks: callbacks,
+		decoder:                   newRequestDecoder(DefaultMaxRequestHeaderSize, DefaultMaxRequestBodySize),
+		pending:                   buffer.NewIoBuffer(0),
 	}
 
-	fasthttp.ServeConn(connection.RawConn(), ssc.ServeHTTP)
-
 	return ssc
 }
 
+// types.StreamConnection
+// requests are decoded from the data read by connection, rather than served on the raw connection,
+// so that the bytes already read, e.g. for protocol detection, are not lost
+func (ssc *serverStreamConnection) Dispatch(buf types.IoBuffer) {
+	ssc.mux.Lock()
+	ssc.pending.Write(buf.Bytes())
+	buf.Drain(buf.Len())
+	ssc.mux.Unlock()
+
+	ssc.dispatch()
+
+	// data following an upgrade request is of the upgraded protocol, e.g. websocket frames,
+	// which is left in the buffer for the caller
+	ssc.mux.Lock()
+	if ssc.upgraded && ssc.pending.Len() > 0 {
+		buf.Write(ssc.pending.Bytes())
+		ssc.pending.Drain(ssc.pending.Len())
+	}
+	ssc.mux.Unlock()
+}
+
+// dispatch serves the pending requests until a response is waited for, it returns at once
+// if the requests are being served by another call
+func (ssc *serverStreamConnection) dispatch() {
+	ssc.mux.Lock()
+	if ssc.dispatching {
+		ssc.mux.Unlock()
+		return
+	}
+	ssc.dispatching = true
+
+	for ssc.activeStream == nil && !ssc.upgraded && ssc.pending.Len() > 0 {
+		ctx, consumed, err := ssc.decoder.decode(ssc.pending.Bytes())
+
+		if err != nil {
+			ssc.dispatching = false
+			ssc.pending.Drain(ssc.pending.Len())
+			ssc.mux.Unlock()
+
+			ssc.onDecodeError(err)
+			return
+		}
+
+		// request not received completely, wait for more data
+		if ctx == nil {
+			break
+		}
+
+		ssc.pending.Drain(consumed)
+		s := ssc.newServerStream(ctx)
+		ssc.upgraded = ctx.Request.Header.ConnectionUpgrade()
+		ssc.mux.Unlock()
+
+		s.serve()
+
+		ssc.mux.Lock()
+	}
+
+	// the pipelined requests waiting for the active stream are not read further than the max request size
+	if disable := ssc.pending.Len() > ssc.decoder.maxHeaderSize+ssc.decoder.maxBodySize; disable != ssc.readDisabled {
+		ssc.readDisabled = disable
+		ssc.connection.SetReadDisable(disable)
+	}
+
+	ssc.dispatching = false
+	ssc.mux.Unlock()
+}
+
+// onDecodeError responds the malformed or too large request and closes the connection, as fasthttp server does
+func (ssc *serverStreamConnection) onDecodeError(err error) {
+	ssc.logger.Errorf("http1 server stream decode error: %v", err)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err == fasthttp.ErrBodyTooLarge {
+		resp.SetStatusCode(fasthttp.StatusRequestEntityTooLarge)
+	} else if err == ErrRequestHeaderTooLarge {
+		resp.SetStatusCode(fasthttp.StatusRequestHeaderFieldsTooLarge)
+	} else {
+		resp.SetStatusCode(fasthttp.StatusBadRequest)
+	}
+	resp.SetConnectionClose()
+
+	buf := buffer.NewIoBuffer(128)
+	if _, err := resp.WriteTo(buf); err == nil {
+		ssc.connection.Write(buf)
+	}
+
+	ssc.connection.Close(types.FlushWrite, types.LocalClose)
+}
+
 func (ssc *serverStreamConnection) OnGoAway() {
 	ssc.serverStreamConnCallbacks.OnGoAway()
 }
 
-//作为PROXY的STREAM SERVER
-func (ssc *serverStreamConnection) ServeHTTP(ctx *fasthttp.RequestCtx) {
+// newServerStream creates the active stream of the request, guarded by mux
+func (ssc *serverStreamConnection) newServerStream(ctx *fasthttp.RequestCtx) *serverStream {
 	//generate stream id using timestamp
 	streamId := "streamID-" + time.Now().String()
 
@@ -178,23 +284,43 @@ func (ssc *serverStreamConnection) ServeHTTP(ctx *fasthttp.RequestCtx) {
 		stream: stream{
 			context: context.WithValue(ssc.context, types.ContextKeyStreamId, streamId),
 		},
-		ctx:              ctx,
-		connection:       ssc,
-		responseDoneChan: make(chan bool, 1),
+		streamId:   streamId,
+		ctx:        ctx,
+		connection: ssc,
 	}
 
-	s.receiver = ssc.serverStreamConnCallbacks.NewStream(streamId, s)
-
 	ssc.activeStream = &s.stream
 
-	if atomic.LoadInt32(&s.readDisableCount) <= 0 {
-		s.handleRequest()
-	}
+	return s
+}
+
+// isActive returns whether the stream is not ended yet
+func (ssc *serverStreamConnection) isActive(s *serverStream) bool {
+	ssc.mux.Lock()
+	defer ssc.mux.Unlock()
 
-	select {
-	case <-s.responseDoneChan:
-		s.ctx = nil
+	return ssc.activeStream == &s.stream
+}
+
+// onStreamEnd decodes the pipelined requests after the response of the active stream is sent
+func (ssc *serverStreamConnection) onStreamEnd(s *serverStream) {
+	ssc.mux.Lock()
+	if ssc.activeStream == &s.stream {
 		ssc.activeStream = nil
+		// the upgrade request is responded, e.g. upgrade failed, the connection is still of http/1.1
+		ssc.upgraded = false
+	}
+	ssc.mux.Unlock()
+
+	ssc.dispatch()
+}
+
+//作为PROXY的STREAM SERVER
+func (s *serverStream) serve() {
+	s.receiver = s.connection.serverStreamConnCallbacks.NewStream(s.streamId, s)
+
+	if atomic.LoadInt32(&s.readDisableCount) <= 0 {
+		s.handleRequest()
 	}
 }
 
@@ -357,11 +483,12 @@ func (s *clientStream) GetStream() types.Stream {
 type serverStream struct {
 	stream
 
+	streamId string
+
 	// NOTICE: fasthttp ctx and its member not allowed holding by others after request handle finished
 	ctx *fasthttp.RequestCtx
 
-	connection       *serverStreamConnection
-	responseDoneChan chan bool
+	connection *serverStreamConnection
 }
 
 // types.StreamSender
@@ -399,9 +526,8 @@ func (s *serverStream) AppendTrailers(trailers map[string]string) error {
 
 func (s *serverStream) endStream() {
 	s.doSend()
-	s.responseDoneChan <- true
 
-	s.connection.activeStream = nil
+	s.connection.onStreamEnd(s)
 }
 
 func (s *serverStream) ReadDisable(disable bool) {
@@ -419,7 +545,18 @@ func (s *serverStream) ReadDisable(disable bool) {
 }
 
 func (s *serverStream) doSend() {
-	// fasthttp will automaticlly flush headers and body
+	buf := buffer.NewIoBuffer(len(s.ctx.Response.Body()) + 1024)
+
+	if _, err := s.ctx.Response.WriteTo(buf); err != nil {
+		s.connection.logger.Errorf("http1 server stream encode error: %v", err)
+		return
+	}
+
+	s.connection.connection.Write(buf)
+
+	if s.ctx.Request.Header.ConnectionClose() {
+		s.connection.connection.Close(types.FlushWrite, types.LocalClose)
+	}
 }
 
 func (s *serverStream) handleRequest() {
@@ -441,7 +578,7 @@ func (s *serverStream) handleRequest() {
 		s.receiver.OnReceiveHeaders(header, false)
 
 		// data remove detect
-		if s.connection.activeStream != nil {
+		if s.connection.isActive(s) {
 			buf := buffer.NewIoBufferBytes(s.ctx.Request.Body())
 			s.receiver.OnReceiveData(buf, true)
 			//no Trailer in Http/1.x
@@ -484,6 +621,9 @@ func decodeRespHeader(in fasthttp.ResponseHeader) (out map[string]string) {
 		out[strings.ToLower(string(key))] = string(value)
 	})
 
+	// status of the response, which is written back to the downstream and checked by retry and outlier detection
+	out[types.HeaderStatus] = strconv.Itoa(in.StatusCode())
+
 	return
 }
 
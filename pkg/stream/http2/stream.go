@@ -388,9 +388,18 @@ func (s *clientStream) CleanStream() {
 
 func (s *clientStream) handleResponse() {
 	if s.response != nil {
-		s.decoder.OnReceiveHeaders(decodeHeader(s.response.Header), false)
+		header := decodeHeader(s.response.Header)
+		header[types.HeaderStatus] = strconv.Itoa(s.response.StatusCode)
+
+		// read body before headers handled, so that body length is known on headers, e.g. converting to bolt
 		buf := &buffer.IoBuffer{}
 		buf.ReadFrom(s.response.Body)
+
+		if _, ok := header[protocol.MosnHeaderContentLengthKey]; !ok {
+			header[protocol.MosnHeaderContentLengthKey] = strconv.Itoa(buf.Len())
+		}
+
+		s.decoder.OnReceiveHeaders(header, false)
 		s.decoder.OnReceiveData(buf, false)
 		s.decoder.OnReceiveTrailers(decodeHeader(s.response.Trailer))
 
@@ -422,13 +431,14 @@ func (s *serverStream) AppendHeaders(headers_ interface{}, endStream bool) error
 		s.response.StatusCode = 200
 	}
 
-	s.response.Header = encodeHeader(headers)
-
-	if status := s.response.Header.Get(types.HeaderStatus); status != "" {
+	// read status from headers directly, http.Header.Get canonicalizes the key
+	if status, ok := headers[types.HeaderStatus]; ok {
 		s.response.StatusCode, _ = strconv.Atoi(status)
-		s.response.Header.Del(types.HeaderStatus)
+		delete(headers, types.HeaderStatus)
 	}
 
+	s.response.Header = encodeHeader(headers)
+
 	if endStream {
 		s.endStream()
 	}
@@ -499,12 +509,25 @@ func (s *serverStream) doSend() {
 
 func (s *serverStream) handleRequest() {
 	if s.request != nil {
-		s.decoder.OnReceiveHeaders(decodeHeader(s.request.Header), false)
+		header := decodeHeader(s.request.Header)
+
+		//set path header if not found
+		if _, ok := header[protocol.MosnHeaderPathKey]; !ok {
+			header[protocol.MosnHeaderPathKey] = s.request.URL.Path
+		}
+
+		// read body before headers handled, so that body length is known on headers, e.g. converting to bolt
+		buf := &buffer.IoBuffer{}
+		buf.ReadFrom(s.request.Body)
+
+		if _, ok := header[protocol.MosnHeaderContentLengthKey]; !ok {
+			header[protocol.MosnHeaderContentLengthKey] = strconv.Itoa(buf.Len())
+		}
+
+		s.decoder.OnReceiveHeaders(header, false)
 
 		//remove detect
 		if s.element != nil {
-			buf := &buffer.IoBuffer{}
-			buf.ReadFrom(s.request.Body)
 			s.decoder.OnReceiveData(buf, false)
 			s.decoder.OnReceiveTrailers(decodeHeader(s.request.Trailer))
 		}
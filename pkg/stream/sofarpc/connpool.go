@@ -18,24 +18,35 @@ package sofarpc
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
 	str "github.com/alipay/sofamosn/pkg/stream"
 	"github.com/alipay/sofamosn/pkg/types"
-	"sync"
 )
 
 // types.ConnectionPool
+// requests are multiplexed by request id on the connections to the host,
+// a new connection is created only if all connections reach max requests per connection
 type connPool struct {
-	activeClient *activeClient
-	host         types.Host
+	host       types.Host
+	clients    []*activeClient
+	connecting uint32
+	// closed and renewed on stream or connection released, to wake up the requests waiting for a connection
+	released chan struct{}
+	// set when the host is removed from cluster, connections are closed once they have no request
+	draining bool
 
 	mux sync.Mutex
 }
 
 func NewConnPool(host types.Host) types.ConnectionPool {
 	return &connPool{
-		host: host,
+		host:     host,
+		released: make(chan struct{}),
 	}
 }
 
@@ -43,45 +54,294 @@ func (p *connPool) Protocol() types.Protocol {
 	return protocol.SofaRpc
 }
 
-func (p *connPool) DrainConnections() {}
+// DrainConnections closes the idle connections, and the busy ones after their requests are done
+func (p *connPool) DrainConnections() {
+	p.mux.Lock()
+	p.draining = true
+
+	var idleClients []*activeClient
+	for _, ac := range append([]*activeClient(nil), p.clients...) {
+		if ac.activeStream == 0 && p.removeClient(ac) {
+			idleClients = append(idleClients, ac)
+		}
+	}
+	p.mux.Unlock()
+
+	for _, ac := range idleClients {
+		ac.codecClient.Close()
+	}
+}
+
+// Prewarm opens connections to the host concurrently until the pool holds num of them, up to the
+// max connections per host, and waits for them until the context is done
+func (p *connPool) Prewarm(ctx context.Context, num uint32) {
+	if max := p.connPoolConfig().MaxConnectionsPerHost; num > max {
+		num = max
+	}
+
+	var wg sync.WaitGroup
 
-func (p *connPool) NewStream(context context.Context, streamId string,
-	responseDecoder types.StreamReceiver, cb types.PoolEventListener) types.Cancellable {
 	p.mux.Lock()
-	if p.activeClient == nil {
-		p.activeClient = newActiveClient(context, p)
+	for !p.draining && uint32(len(p.clients))+p.connecting < num &&
+		p.host.ClusterInfo().ResourceManager().Connections().CanCreate() {
+		p.connecting++
+		p.host.ClusterInfo().ResourceManager().Connections().Increase()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.addPrewarmedClient()
+		}()
+	}
+	p.mux.Unlock()
+
+	connected := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(connected)
+	}()
+
+	select {
+	case <-connected:
+	case <-ctx.Done():
+	}
+}
+
+// connects a connection without stream, it's closed on idle timeout as the released ones
+func (p *connPool) addPrewarmedClient() {
+	// the connection outlives the pre-warming, so it's not bound to the pre-warming context
+	ac := newActiveClient(context.Background(), p)
+
+	p.mux.Lock()
+	p.connecting--
+
+	if ac == nil || p.draining {
+		p.host.ClusterInfo().ResourceManager().Connections().Decrease()
+		p.notifyReleased()
+		p.mux.Unlock()
+
+		if ac != nil {
+			ac.codecClient.Close()
+		}
+		return
 	}
 
+	p.clients = append(p.clients, ac)
+	p.onClientAdded()
+	if idleTimeout := p.host.ClusterInfo().ConnectionPool().IdleTimeout; idleTimeout > 0 {
+		ac.idleTimer = time.AfterFunc(idleTimeout, func() {
+			p.onClientIdle(ac)
+		})
+	}
+	p.notifyReleased()
 	p.mux.Unlock()
+}
 
-	if p.activeClient == nil {
-		cb.OnFailure(streamId, types.ConnectionFailure, nil)
+func (p *connPool) NewStream(context context.Context, streamId string,
+	responseDecoder types.StreamReceiver, cb types.PoolEventListener) types.Cancellable {
+	resourceManager := p.host.ClusterInfo().ResourceManager()
+
+	// fail fast when the concurrent requests reach the limit, instead of queueing
+	if !resourceManager.Requests().CanCreate() {
+		p.host.ClusterInfo().Stats().UpstreamRequestOverflow.Inc(1)
+		cb.OnFailure(streamId, types.Overflow, nil)
 		return nil
 	}
 
-	if !p.host.ClusterInfo().ResourceManager().Requests().CanCreate() {
+	// requests waiting for the upstream connection are pending requests
+	if !resourceManager.PendingRequests().CanCreate() {
+		p.host.ClusterInfo().Stats().UpstreamRequestPendingOverflow.Inc(1)
 		cb.OnFailure(streamId, types.Overflow, nil)
-	} else {
-		// todo: update host stats
-		p.activeClient.totalStream++
-		p.host.ClusterInfo().ResourceManager().Requests().Increase()
-		streamEncoder := p.activeClient.codecClient.NewStream(streamId, responseDecoder)
-		cb.OnReady(streamId, streamEncoder, p.host)
+		return nil
+	}
+
+	resourceManager.PendingRequests().Increase()
+	activeClient, reason := p.getActiveClient(context)
+	resourceManager.PendingRequests().Decrease()
+
+	if activeClient == nil {
+		if reason == types.Overflow {
+			p.host.ClusterInfo().Stats().UpstreamRequestPendingOverflow.Inc(1)
+		}
+		cb.OnFailure(streamId, reason, nil)
+		return nil
+	}
+
+	// todo: update host stats
+	resourceManager.Requests().Increase()
+	streamEncoder := activeClient.codecClient.NewStream(streamId, responseDecoder)
+	cb.OnReady(streamId, streamEncoder, p.host)
+
+	return nil
+}
+
+// getActiveClient reserves a stream on a connection which is not busy, or on a new connection if the
+// connections do not reach the limit. When the pool is saturated, it waits for a released stream
+// unless fail fast is configured.
+func (p *connPool) getActiveClient(context context.Context) (*activeClient, types.PoolFailureReason) {
+	config := p.connPoolConfig()
+	var timer *time.Timer
+
+	for {
+		p.mux.Lock()
+
+		if ac := p.availableClient(); ac != nil {
+			p.onStreamCreate(ac)
+			p.mux.Unlock()
+			return ac, ""
+		}
+
+		if uint32(len(p.clients))+p.connecting < config.MaxConnectionsPerHost &&
+			p.host.ClusterInfo().ResourceManager().Connections().CanCreate() {
+			// connection events are raised on connect, so connect without lock
+			p.connecting++
+			p.host.ClusterInfo().ResourceManager().Connections().Increase()
+			p.mux.Unlock()
+
+			ac := newActiveClient(context, p)
+
+			p.mux.Lock()
+			p.connecting--
+			if ac == nil {
+				p.host.ClusterInfo().ResourceManager().Connections().Decrease()
+				p.notifyReleased()
+				p.mux.Unlock()
+				return nil, types.ConnectionFailure
+			}
+			p.clients = append(p.clients, ac)
+			p.onClientAdded()
+			p.onStreamCreate(ac)
+			p.mux.Unlock()
+			return ac, ""
+		}
+
+		released := p.released
+		p.mux.Unlock()
+
+		if config.FailFast {
+			return nil, types.Overflow
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(config.MaxWaitTime)
+			defer timer.Stop()
+		}
+
+		select {
+		case <-released:
+		case <-timer.C:
+			return nil, types.Overflow
+		}
+	}
+}
+
+func (p *connPool) connPoolConfig() v2.ConnectionPool {
+	config := p.host.ClusterInfo().ConnectionPool()
+
+	if config.MaxConnectionsPerHost == 0 {
+		config.MaxConnectionsPerHost = v2.DefaultMaxConnectionsPerHost
+	}
+
+	if config.MaxWaitTime == 0 {
+		config.MaxWaitTime = v2.DefaultConnPoolMaxWaitTime
+	}
+
+	return config
+}
+
+// the first connection which is not busy, so that the other ones can be closed on idle
+// must be called with lock
+func (p *connPool) availableClient() *activeClient {
+	maxRequests := uint64(p.host.ClusterInfo().MaxRequestsPerConn())
+
+	for _, ac := range p.clients {
+		if maxRequests == 0 || ac.activeStream < maxRequests {
+			return ac
+		}
 	}
 
 	return nil
 }
 
+// must be called with lock
+func (p *connPool) onStreamCreate(ac *activeClient) {
+	ac.totalStream++
+	ac.activeStream++
+
+	if ac.idleTimer != nil {
+		ac.idleTimer.Stop()
+		ac.idleTimer = nil
+	}
+}
+
+func (p *connPool) onClientAdded() {
+	p.host.HostStats().UpstreamConnectionTotal.Inc(1)
+	p.host.HostStats().UpstreamConnectionActive.Inc(1)
+	p.host.HostStats().UpstreamConnectionTotalSofaRpc.Inc(1)
+	p.host.ClusterInfo().Stats().UpstreamConnectionTotal.Inc(1)
+	p.host.ClusterInfo().Stats().UpstreamConnectionActive.Inc(1)
+	p.host.ClusterInfo().Stats().UpstreamConnectionTotalSofaRpc.Inc(1)
+}
+
+func (p *connPool) onClientRemoved() {
+	p.host.HostStats().UpstreamConnectionActive.Dec(1)
+	p.host.ClusterInfo().Stats().UpstreamConnectionActive.Dec(1)
+}
+
+// must be called with lock
+func (p *connPool) notifyReleased() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// removes the client from pool, returns false if it is already removed
+// must be called with lock
+func (p *connPool) removeClient(ac *activeClient) bool {
+	for i, client := range p.clients {
+		if client == ac {
+			p.clients = append(p.clients[:i], p.clients[i+1:]...)
+
+			if ac.idleTimer != nil {
+				ac.idleTimer.Stop()
+				ac.idleTimer = nil
+			}
+
+			p.host.ClusterInfo().ResourceManager().Connections().Decrease()
+			p.onClientRemoved()
+			p.notifyReleased()
+
+			return true
+		}
+	}
+
+	return false
+}
+
 func (p *connPool) Close() {
-	if p.activeClient != nil {
-		p.activeClient.codecClient.Close()
+	p.mux.Lock()
+	clients := p.clients
+	p.clients = nil
+	for _, ac := range clients {
+		if ac.idleTimer != nil {
+			ac.idleTimer.Stop()
+			ac.idleTimer = nil
+		}
+		p.host.ClusterInfo().ResourceManager().Connections().Decrease()
+		p.onClientRemoved()
+	}
+	p.mux.Unlock()
+
+	for _, ac := range clients {
+		ac.codecClient.Close()
 	}
 }
 
 func (p *connPool) onConnectionEvent(client *activeClient, event types.ConnectionEvent) {
 	if event.IsClose() || event.ConnectFailure() {
 		// todo: update host stats
-		p.activeClient = nil
+		p.mux.Lock()
+		p.removeClient(client)
+		p.mux.Unlock()
 	} else if event == types.ConnectTimeout {
 		// todo: update host stats
 		client.codecClient.Close()
@@ -91,14 +351,79 @@ func (p *connPool) onConnectionEvent(client *activeClient, event types.Connectio
 func (p *connPool) onStreamDestroy(client *activeClient) {
 	// todo: update host stats
 	p.host.ClusterInfo().ResourceManager().Requests().Decrease()
+
+	p.mux.Lock()
+
+	if client.activeStream > 0 {
+		client.activeStream--
+	}
+
+	drained := false
+	if client.activeStream == 0 {
+		if p.draining {
+			drained = p.removeClient(client)
+		} else if idleTimeout := p.host.ClusterInfo().ConnectionPool().IdleTimeout; idleTimeout > 0 {
+			client.idleTimer = time.AfterFunc(idleTimeout, func() {
+				p.onClientIdle(client)
+			})
+		}
+	}
+
+	p.notifyReleased()
+	p.mux.Unlock()
+
+	if drained {
+		client.codecClient.Close()
+	}
+}
+
+// closes the connection which has no request during idle timeout
+func (p *connPool) onClientIdle(client *activeClient) {
+	p.mux.Lock()
+	// a new stream is created on the connection after timer fired
+	if client.activeStream > 0 || !p.removeClient(client) {
+		p.mux.Unlock()
+		return
+	}
+	p.mux.Unlock()
+
+	client.codecClient.Close()
 }
 
 func (p *connPool) onStreamReset(client *activeClient, reason types.StreamResetReason) {
 	// todo: update host stats
 }
 
-func (p *connPool) createCodecClient(context context.Context, connData types.CreateConnectionData) str.CodecClient {
-	return str.NewCodecClient(context, protocol.SofaRpc, connData.Connection, connData.HostInfo)
+func (p *connPool) createCodecClient(ctx context.Context, connData types.CreateConnectionData) str.CodecClient {
+	// content sizes of the requests and responses are recorded by cluster
+	ctx = context.WithValue(ctx, types.ContextKeyUpstreamCluster, p.host.ClusterInfo().Name())
+
+	// features turned on by cluster are set on the requests sent by the connection
+	boltSwitch := sofarpc.SwitchCode(p.host.ClusterInfo().BoltSwitch())
+	if p.host.ClusterInfo().ForceCrc() {
+		boltSwitch = boltSwitch.Set(sofarpc.SWITCH_CRC_ON)
+		ctx = context.WithValue(ctx, types.ContextKeyBoltForceCrc, true)
+	}
+	if boltSwitch != 0 {
+		ctx = context.WithValue(ctx, types.ContextKeyBoltSwitch, boltSwitch)
+	}
+
+	if compression := p.host.ClusterInfo().BoltCompression(); compression.Algorithm != 0 {
+		ctx = context.WithValue(ctx, types.ContextKeyBoltCompression, sofarpc.Compression{
+			Algorithm: sofarpc.SwitchCode(compression.Algorithm),
+			Threshold: compression.Threshold,
+		})
+	}
+
+	if interval := p.host.ClusterInfo().HeartbeatInterval(); interval > 0 {
+		ctx = context.WithValue(ctx, types.ContextKeyBoltHeartbeatInterval, interval)
+	}
+
+	if limits := p.host.ClusterInfo().ResponseLimits(); limits.MaxHeaderLen > 0 || limits.MaxContentLen > 0 {
+		ctx = context.WithValue(ctx, types.ContextKeyBoltResponseLimits, limits)
+	}
+
+	return str.NewCodecClient(ctx, protocol.SofaRpc, connData.Connection, connData.HostInfo)
 }
 
 // stream.CodecClientCallbacks
@@ -109,6 +434,10 @@ type activeClient struct {
 	codecClient str.CodecClient
 	host        types.CreateConnectionData
 	totalStream uint64
+
+	// guarded by pool's lock
+	activeStream uint64
+	idleTimer    *time.Timer
 }
 
 func newActiveClient(context context.Context, pool *connPool) *activeClient {
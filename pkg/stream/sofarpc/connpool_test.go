@@ -0,0 +1,434 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/network"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/rcrowley/go-metrics"
+)
+
+type mockResource struct {
+	current int64
+}
+
+func (r *mockResource) CanCreate() bool { return true }
+func (r *mockResource) Increase()       { atomic.AddInt64(&r.current, 1) }
+func (r *mockResource) Decrease()       { atomic.AddInt64(&r.current, -1) }
+func (r *mockResource) Max() uint64     { return 0 }
+
+type mockResourceManager struct {
+	connections, pendingRequests, requests, retries mockResource
+}
+
+func (rm *mockResourceManager) Connections() types.Resource     { return &rm.connections }
+func (rm *mockResourceManager) PendingRequests() types.Resource { return &rm.pendingRequests }
+func (rm *mockResourceManager) Requests() types.Resource        { return &rm.requests }
+func (rm *mockResourceManager) Retries() types.Resource         { return &rm.retries }
+
+type mockClusterInfo struct {
+	types.ClusterInfo
+	maxRequestsPerConn uint32
+	connectionPool     v2.ConnectionPool
+	resourceManager    *mockResourceManager
+}
+
+func (ci *mockClusterInfo) Name() string                           { return "mock_cluster" }
+func (ci *mockClusterInfo) MaxRequestsPerConn() uint32             { return ci.maxRequestsPerConn }
+func (ci *mockClusterInfo) ConnectionPool() v2.ConnectionPool      { return ci.connectionPool }
+func (ci *mockClusterInfo) ResourceManager() types.ResourceManager { return ci.resourceManager }
+func (ci *mockClusterInfo) BoltSwitch() byte                       { return 0 }
+func (ci *mockClusterInfo) BoltCompression() v2.BoltCompression    { return v2.BoltCompression{} }
+func (ci *mockClusterInfo) ForceCrc() bool                         { return false }
+func (ci *mockClusterInfo) HeartbeatInterval() time.Duration       { return 0 }
+func (ci *mockClusterInfo) ResponseLimits() v2.ResponseLimits      { return v2.ResponseLimits{} }
+func (ci *mockClusterInfo) Stats() types.ClusterStats {
+	return types.ClusterStats{
+		UpstreamConnectionTotal:        metrics.NewCounter(),
+		UpstreamConnectionActive:       metrics.NewCounter(),
+		UpstreamConnectionTotalSofaRpc: metrics.NewCounter(),
+		UpstreamRequestOverflow:        metrics.NewCounter(),
+		UpstreamRequestPendingOverflow: metrics.NewCounter(),
+	}
+}
+
+type mockHost struct {
+	types.Host
+	addr              net.Addr
+	clusterInfo       *mockClusterInfo
+	activeConnections metrics.Counter
+	connectDelay      time.Duration
+}
+
+func (h *mockHost) ClusterInfo() types.ClusterInfo { return h.clusterInfo }
+func (h *mockHost) AddressString() string          { return h.addr.String() }
+func (h *mockHost) HostStats() types.HostStats {
+	return types.HostStats{
+		UpstreamConnectionTotal:        metrics.NewCounter(),
+		UpstreamConnectionActive:       h.activeConnections,
+		UpstreamConnectionTotalSofaRpc: metrics.NewCounter(),
+	}
+}
+func (h *mockHost) CreateConnection(context context.Context) types.CreateConnectionData {
+	return types.CreateConnectionData{
+		Connection: &slowConnection{
+			ClientConnection: network.NewClientConnection(nil, nil, h.addr, nil, log.DefaultLogger),
+			delay:            h.connectDelay,
+		},
+		HostInfo: h,
+	}
+}
+
+// connection takes the delay to connect
+type slowConnection struct {
+	types.ClientConnection
+	delay time.Duration
+}
+
+func (c *slowConnection) Connect(ioEnabled bool) error {
+	time.Sleep(c.delay)
+	return c.ClientConnection.Connect(ioEnabled)
+}
+
+type poolResult struct {
+	streamId string
+	reason   types.PoolFailureReason
+}
+
+type mockPoolListener struct {
+	results chan poolResult
+}
+
+func (l *mockPoolListener) OnFailure(streamId string, reason types.PoolFailureReason, host types.Host) {
+	l.results <- poolResult{streamId: streamId, reason: reason}
+}
+
+func (l *mockPoolListener) OnReady(streamId string, sender types.StreamSender, host types.Host) {
+	l.results <- poolResult{streamId: streamId}
+}
+
+// upstream server counts the accepted connections, and the ones closed by client
+type mockUpstream struct {
+	listener net.Listener
+	accepted int32
+	closed   int32
+}
+
+func newMockUpstream(t *testing.T) *mockUpstream {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &mockUpstream{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&u.accepted, 1)
+
+			go func() {
+				buf := make([]byte, 1024)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						atomic.AddInt32(&u.closed, 1)
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return u
+}
+
+func newTestConnPool(u *mockUpstream, maxRequestsPerConn uint32, config v2.ConnectionPool) *connPool {
+	log.InitDefaultLogger("", log.INFO)
+
+	host := &mockHost{
+		addr: u.listener.Addr(),
+		clusterInfo: &mockClusterInfo{
+			maxRequestsPerConn: maxRequestsPerConn,
+			connectionPool:     config,
+			resourceManager:    &mockResourceManager{},
+		},
+		activeConnections: metrics.NewCounter(),
+	}
+
+	return NewConnPool(host).(*connPool)
+}
+
+func newStream(p *connPool, streamId string) poolResult {
+	listener := &mockPoolListener{results: make(chan poolResult, 1)}
+	p.NewStream(context.Background(), streamId, &mockReceiver{}, listener)
+	return <-listener.results
+}
+
+// waits the counter updated by upstream server
+func waitCount(counter *int32, expected int32) int32 {
+	for i := 0; i < 50 && atomic.LoadInt32(counter) != expected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return atomic.LoadInt32(counter)
+}
+
+func (p *connPool) clientsNum() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return len(p.clients)
+}
+
+func TestConnPoolReuse(t *testing.T) {
+	u := newMockUpstream(t)
+	defer u.listener.Close()
+	p := newTestConnPool(u, 2, v2.ConnectionPool{MaxConnectionsPerHost: 2})
+	defer p.Close()
+
+	for _, id := range []string{"1", "2", "3"} {
+		if r := newStream(p, id); r.reason != "" {
+			t.Fatalf("stream %s failed: %s", id, r.reason)
+		}
+	}
+
+	// requests are multiplexed up to max requests per connection
+	if p.clientsNum() != 2 || p.clients[0].activeStream != 2 || p.clients[1].activeStream != 1 {
+		t.Fatalf("expect 2 connections with 2 and 1 streams, got %d", p.clientsNum())
+	}
+
+	// the first connection which is not busy is reused
+	first := p.clients[0]
+	first.OnStreamDestroy()
+	if r := newStream(p, "4"); r.reason != "" {
+		t.Fatalf("stream 4 failed: %s", r.reason)
+	}
+	if first.activeStream != 2 || first.totalStream != 3 {
+		t.Errorf("expect stream created on the first connection, active %d, total %d", first.activeStream, first.totalStream)
+	}
+
+	if accepted := waitCount(&u.accepted, 2); accepted != 2 {
+		t.Errorf("expect 2 connections accepted by upstream, got %d", accepted)
+	}
+	if current := p.host.ClusterInfo().ResourceManager().Connections().(*mockResource).current; current != 2 {
+		t.Errorf("expect 2 connections counted, got %d", current)
+	}
+	if active := p.host.HostStats().UpstreamConnectionActive.Count(); active != 2 {
+		t.Errorf("expect 2 active connections of host, got %d", active)
+	}
+}
+
+func TestConnPoolIdleTimeout(t *testing.T) {
+	u := newMockUpstream(t)
+	defer u.listener.Close()
+	p := newTestConnPool(u, 0, v2.ConnectionPool{IdleTimeout: 100 * time.Millisecond})
+	defer p.Close()
+
+	if r := newStream(p, "1"); r.reason != "" {
+		t.Fatalf("stream failed: %s", r.reason)
+	}
+	client := p.clients[0]
+
+	// connection with active request is not reaped
+	time.Sleep(200 * time.Millisecond)
+	if p.clientsNum() != 1 {
+		t.Fatalf("connection with active request should not be closed")
+	}
+
+	client.OnStreamDestroy()
+	time.Sleep(300 * time.Millisecond)
+	if p.clientsNum() != 0 {
+		t.Fatalf("idle connection should be removed from pool")
+	}
+	if closed := waitCount(&u.closed, 1); closed != 1 {
+		t.Errorf("expect idle connection closed, got %d closed", closed)
+	}
+	if current := p.host.ClusterInfo().ResourceManager().Connections().(*mockResource).current; current != 0 {
+		t.Errorf("expect no connections counted, got %d", current)
+	}
+	if active := p.host.HostStats().UpstreamConnectionActive.Count(); active != 0 {
+		t.Errorf("expect no active connections of host, got %d", active)
+	}
+
+	// a new connection is created for subsequent request
+	if r := newStream(p, "2"); r.reason != "" {
+		t.Fatalf("stream failed: %s", r.reason)
+	}
+	if accepted := waitCount(&u.accepted, 2); accepted != 2 {
+		t.Errorf("expect a new connection, got %d accepted", accepted)
+	}
+}
+
+func TestConnPoolDrain(t *testing.T) {
+	u := newMockUpstream(t)
+	defer u.listener.Close()
+	p := newTestConnPool(u, 1, v2.ConnectionPool{MaxConnectionsPerHost: 2})
+	defer p.Close()
+
+	for _, id := range []string{"1", "2"} {
+		if r := newStream(p, id); r.reason != "" {
+			t.Fatalf("stream %s failed: %s", id, r.reason)
+		}
+	}
+	idle, busy := p.clients[0], p.clients[1]
+	idle.OnStreamDestroy()
+
+	// idle connection is closed at once
+	p.DrainConnections()
+	if p.clientsNum() != 1 || p.clients[0] != busy {
+		t.Fatalf("idle connection should be removed from pool on drain")
+	}
+	if closed := waitCount(&u.closed, 1); closed != 1 {
+		t.Errorf("expect idle connection closed, got %d closed", closed)
+	}
+
+	// busy connection is closed after its request is done
+	busy.OnStreamDestroy()
+	if p.clientsNum() != 0 {
+		t.Fatalf("drained connection should be removed from pool")
+	}
+	if closed := waitCount(&u.closed, 2); closed != 2 {
+		t.Errorf("expect drained connection closed, got %d closed", closed)
+	}
+	if current := p.host.ClusterInfo().ResourceManager().Connections().(*mockResource).current; current != 0 {
+		t.Errorf("expect no connections counted, got %d", current)
+	}
+}
+
+func TestConnPoolSaturatedFailFast(t *testing.T) {
+	u := newMockUpstream(t)
+	defer u.listener.Close()
+	p := newTestConnPool(u, 1, v2.ConnectionPool{MaxConnectionsPerHost: 1, FailFast: true})
+	defer p.Close()
+
+	if r := newStream(p, "1"); r.reason != "" {
+		t.Fatalf("stream failed: %s", r.reason)
+	}
+
+	start := time.Now()
+	if r := newStream(p, "2"); r.reason != types.Overflow {
+		t.Fatalf("expect overflow when pool saturated, got %q", r.reason)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("expect fail fast, but cost %s", time.Since(start))
+	}
+}
+
+func TestConnPoolSaturatedWait(t *testing.T) {
+	u := newMockUpstream(t)
+	defer u.listener.Close()
+	p := newTestConnPool(u, 1, v2.ConnectionPool{MaxConnectionsPerHost: 1, MaxWaitTime: time.Second})
+	defer p.Close()
+
+	if r := newStream(p, "1"); r.reason != "" {
+		t.Fatalf("stream failed: %s", r.reason)
+	}
+
+	// the waiting request gets the connection after the stream released
+	client := p.clients[0]
+	time.AfterFunc(100*time.Millisecond, client.OnStreamDestroy)
+	start := time.Now()
+	if r := newStream(p, "2"); r.reason != "" {
+		t.Fatalf("expect waiting request succeed, got %s", r.reason)
+	}
+	if cost := time.Since(start); cost < 100*time.Millisecond {
+		t.Errorf("expect request blocked until stream released, but cost %s", cost)
+	}
+	if p.clientsNum() != 1 || client.activeStream != 1 {
+		t.Errorf("expect the connection reused")
+	}
+
+	// the waiting request fails after max wait time
+	p.host.ClusterInfo().(*mockClusterInfo).connectionPool.MaxWaitTime = 100 * time.Millisecond
+	if r := newStream(p, "3"); r.reason != types.Overflow {
+		t.Fatalf("expect overflow after max wait time, got %q", r.reason)
+	}
+}
+
+func TestConnPoolPrewarm(t *testing.T) {
+	u := newMockUpstream(t)
+	defer u.listener.Close()
+	p := newTestConnPool(u, 1, v2.ConnectionPool{MaxConnectionsPerHost: 3})
+	defer p.Close()
+
+	// the connections are capped by max connections per host
+	p.Prewarm(context.Background(), 5)
+	if p.clientsNum() != 3 {
+		t.Fatalf("expect 3 pre-warmed connections in pool, got %d", p.clientsNum())
+	}
+	if accepted := waitCount(&u.accepted, 3); accepted != 3 {
+		t.Errorf("expect 3 connections accepted by upstream, got %d", accepted)
+	}
+	if current := p.host.ClusterInfo().ResourceManager().Connections().(*mockResource).current; current != 3 {
+		t.Errorf("expect 3 connections counted, got %d", current)
+	}
+
+	// connections already in pool are counted
+	p.Prewarm(context.Background(), 2)
+	if p.clientsNum() != 3 {
+		t.Fatalf("expect no more connections, got %d", p.clientsNum())
+	}
+
+	// requests are sent on the pre-warmed connections
+	for _, id := range []string{"1", "2", "3"} {
+		if r := newStream(p, id); r.reason != "" {
+			t.Fatalf("stream %s failed: %s", id, r.reason)
+		}
+	}
+	if accepted := waitCount(&u.accepted, 4); accepted != 3 {
+		t.Errorf("expect no new connection, got %d accepted", accepted)
+	}
+}
+
+func TestConnPoolPrewarmTimeout(t *testing.T) {
+	u := newMockUpstream(t)
+	defer u.listener.Close()
+	p := newTestConnPool(u, 0, v2.ConnectionPool{MaxConnectionsPerHost: 2})
+	defer p.Close()
+	p.host.(*mockHost).connectDelay = 300 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	p.Prewarm(ctx, 2)
+	if cost := time.Since(start); cost > 200*time.Millisecond {
+		t.Errorf("expect pre-warming given up after timeout, but cost %s", cost)
+	}
+	if p.clientsNum() != 0 {
+		t.Fatalf("expect no connection established before timeout, got %d", p.clientsNum())
+	}
+
+	// the connections are added to pool once established
+	if accepted := waitCount(&u.accepted, 2); accepted != 2 {
+		t.Fatalf("expect 2 connections accepted by upstream, got %d", accepted)
+	}
+	for i := 0; i < 50 && p.clientsNum() != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p.clientsNum() != 2 {
+		t.Errorf("expect 2 pre-warmed connections in pool, got %d", p.clientsNum())
+	}
+}
@@ -18,11 +18,17 @@ package sofarpc
 
 import (
 	"context"
+	"reflect"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/alipay/sofamosn/pkg/log"
 	"github.com/alipay/sofamosn/pkg/protocol"
 	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/stats"
 	str "github.com/alipay/sofamosn/pkg/stream"
 	"github.com/alipay/sofamosn/pkg/types"
 )
@@ -42,18 +48,25 @@ type streamConnFactory struct{}
 
 func (f *streamConnFactory) CreateClientStream(context context.Context, connection types.ClientConnection,
 	clientCallbacks types.StreamConnectionEventListener, connCallbacks types.ConnectionEventListener) types.ClientStreamConnection {
-	return newStreamConnection(context, connection, clientCallbacks, nil)
+	return watchConnection(newStreamConnection(context, connection, clientCallbacks, nil), connection)
 }
 
 func (f *streamConnFactory) CreateServerStream(context context.Context, connection types.Connection,
 	serverCallbacks types.ServerStreamConnectionEventListener) types.ServerStreamConnection {
-	return newStreamConnection(context, connection, nil, serverCallbacks)
+	return watchConnection(newStreamConnection(context, connection, nil, serverCallbacks), connection)
 }
 
 func (f *streamConnFactory) CreateBiDirectStream(context context.Context, connection types.ClientConnection,
 	clientCallbacks types.StreamConnectionEventListener,
 	serverCallbacks types.ServerStreamConnectionEventListener) types.ClientStreamConnection {
-	return newStreamConnection(context, connection, clientCallbacks, serverCallbacks)
+	return watchConnection(newStreamConnection(context, connection, clientCallbacks, serverCallbacks), connection)
+}
+
+// watchConnection listens the close event of connection, to tell the frame cut by remote close
+func watchConnection(sc types.ClientStreamConnection, connection types.Connection) types.ClientStreamConnection {
+	connection.AddConnectionEventListener(sc.(*streamConnection))
+
+	return sc
 }
 
 // types.DecodeFilter
@@ -69,6 +82,34 @@ type streamConnection struct {
 	clientCallbacks types.StreamConnectionEventListener
 	serverCallbacks types.ServerStreamConnectionEventListener
 
+	// heartbeat trigger for client stream connection, started on the first request
+	heartbeatTrigger atomic.Value
+	triggerOnce      sync.Once
+
+	// source of the request ids remapped on client stream connection and the ids of heartbeats
+	requestIdCounter uint32
+
+	// protocol code and length of the incomplete frame left in the read buffer
+	pendingProtocol byte
+	pendingBytes    int
+	// the connection is closed with an incomplete frame left, the responses of the requests in flight
+	// may be received partially
+	truncated bool
+	// bytes left of the response exceeding the limits of cluster, skipped as they are read
+	discardBytes int
+
+	// closes the connection if the pending frame is not complete within the receive timeout,
+	// frameSeq tells the timer of the current pending frame
+	frameTimer *time.Timer
+	frameSeq   uint64
+	frameMux   sync.Mutex
+
+	// client streams with reading paused, the connection is not read only if all the
+	// active streams are paused, so that other requests multiplexed are not blocked
+	pausedStreams map[string]bool
+	readDisabled  bool
+	flowMux       sync.Mutex
+
 	logger log.Logger
 }
 
@@ -80,6 +121,7 @@ func newStreamConnection(context context.Context, connection types.Connection, c
 		connection:      connection,
 		protocols:       sofarpc.DefaultProtocols(),
 		activeStreams:   newStreamMap(context),
+		pausedStreams:   make(map[string]bool),
 		clientCallbacks: clientCallbacks,
 		serverCallbacks: serverCallbacks,
 		logger:          log.ByContext(context),
@@ -88,7 +130,122 @@ func newStreamConnection(context context.Context, connection types.Connection, c
 
 // types.StreamConnection
 func (conn *streamConnection) Dispatch(buffer types.IoBuffer) {
-	conn.protocols.Decode(conn.context, buffer, conn)
+	conn.onActive()
+	readableBytes := buffer.Len()
+
+	// frames following the skipped response are decoded once it is skipped
+	for conn.discard(buffer) {
+		conn.protocols.Decode(conn.context, buffer, conn)
+
+		if conn.discardBytes == 0 {
+			break
+		}
+	}
+
+	conn.pendingBytes = buffer.Len()
+	if conn.pendingBytes > 0 {
+		conn.pendingProtocol = buffer.Bytes()[0]
+	}
+
+	// frames are drained only if complete, the bytes left belong to a new frame
+	conn.checkPendingFrame(conn.pendingBytes < readableBytes)
+}
+
+// discard skips the bytes of the response exceeding the limits of cluster, returns true if
+// the response is skipped completely
+func (conn *streamConnection) discard(buffer types.IoBuffer) bool {
+	if conn.discardBytes == 0 {
+		return true
+	}
+
+	n := buffer.Len()
+	if n > conn.discardBytes {
+		n = conn.discardBytes
+	}
+	buffer.Drain(n)
+	conn.discardBytes -= n
+
+	return conn.discardBytes == 0
+}
+
+// checkPendingFrame limits the time and bytes of receiving the incomplete frame left in the read buffer,
+// so that a peer dribbling a large frame slowly can't hold the connection and buffer forever
+func (conn *streamConnection) checkPendingFrame(frameDecoded bool) {
+	limits := codec.GetFrameLimits()
+
+	if limits.MaxPendingBytes > 0 && conn.pendingBytes > limits.MaxPendingBytes {
+		conn.stopFrameTimer()
+		conn.closeOnPendingFrame(conn.pendingProtocol, sofarpc.ReasonPendingOverflow, sofarpc.PendingOverflow)
+		return
+	}
+
+	if conn.pendingBytes == 0 || frameDecoded {
+		conn.stopFrameTimer()
+	}
+
+	if conn.pendingBytes == 0 || limits.ReceiveTimeout <= 0 {
+		return
+	}
+
+	conn.frameMux.Lock()
+	defer conn.frameMux.Unlock()
+
+	// the timer is started on the first bytes of the frame, and not reset by the following bytes
+	if conn.frameTimer == nil {
+		conn.frameSeq++
+		seq, protocolCode := conn.frameSeq, conn.pendingProtocol
+		conn.frameTimer = time.AfterFunc(limits.ReceiveTimeout, func() {
+			conn.onFrameTimeout(seq, protocolCode)
+		})
+	}
+}
+
+func (conn *streamConnection) stopFrameTimer() {
+	conn.frameMux.Lock()
+	defer conn.frameMux.Unlock()
+
+	if conn.frameTimer != nil {
+		conn.frameTimer.Stop()
+		conn.frameTimer = nil
+	}
+}
+
+func (conn *streamConnection) onFrameTimeout(seq uint64, protocolCode byte) {
+	conn.frameMux.Lock()
+	// the frame is complete or the connection is closed
+	if conn.frameTimer == nil || conn.frameSeq != seq {
+		conn.frameMux.Unlock()
+		return
+	}
+	conn.frameTimer = nil
+	conn.frameMux.Unlock()
+
+	conn.closeOnPendingFrame(protocolCode, sofarpc.ReasonSlowFrame, sofarpc.SlowFrame)
+}
+
+func (conn *streamConnection) closeOnPendingFrame(protocolCode byte, reason, msg string) {
+	err := sofarpc.NewDecodeError(sofarpc.CodecName(protocolCode), reason, msg)
+	sofarpc.RecordConnectionClose(err)
+	conn.logger.Errorf("close connection on incomplete frame: %v, reason = %s", err, reason)
+	conn.connection.Close(types.NoFlush, types.LocalClose)
+}
+
+// types.ConnectionEventListener
+// the incomplete frame left on remote close is recorded as a short frame, e.g. truncated by a broken peer
+func (conn *streamConnection) OnEvent(event types.ConnectionEvent) {
+	if event.IsClose() {
+		conn.stopFrameTimer()
+		conn.truncated = conn.pendingBytes > 0
+	}
+
+	if event != types.RemoteClose || conn.pendingBytes == 0 {
+		return
+	}
+
+	err := sofarpc.NewDecodeError(sofarpc.CodecName(conn.pendingProtocol), sofarpc.ReasonShortFrame, sofarpc.ShortFrame)
+	reason := sofarpc.RecordConnectionClose(err)
+	conn.logger.Errorf("connection closed by remote with %d bytes of incomplete frame, reason = %s", conn.pendingBytes, reason)
+	conn.pendingBytes = 0
 }
 
 func (conn *streamConnection) Protocol() types.Protocol {
@@ -108,34 +265,158 @@ func (conn *streamConnection) NewStream(streamId string, responseDecoder types.S
 		connection: conn,
 		decoder:    responseDecoder,
 	}
-	conn.activeStreams.Set(streamId, stream)
+
+	// requests from different downstream connections share the upstream connection, and the
+	// request id may be in use by another in-flight request. Remap it to an unused one, the
+	// original id is kept as requestId and restored on response.
+	for !conn.activeStreams.SetIfAbsent(stream.streamId, stream) {
+		stream.streamId = sofarpc.StreamIDConvert(atomic.AddUint32(&conn.requestIdCounter, 1))
+	}
+
+	if stream.streamId != streamId {
+		conn.logger.Debugf("request id %s is in use, remapped to %s", streamId, stream.streamId)
+	}
+
+	// the new request is not paused, resume reading if all the others are
+	conn.updateReadDisable()
 
 	return &stream
 }
 
+// removeStream removes the stream, reading may be paused if the active streams left are all paused
+func (conn *streamConnection) removeStream(streamId string) {
+	conn.activeStreams.Remove(streamId)
+	conn.updateReadDisable()
+}
+
+// resetStream removes the reset client stream, its id is quarantined
+func (conn *streamConnection) resetStream(streamId string) {
+	conn.activeStreams.Reset(streamId)
+	conn.updateReadDisable()
+}
+
+// readDisableStream pauses or resumes reading the response of the client stream
+func (conn *streamConnection) readDisableStream(streamId string, disable bool) {
+	conn.flowMux.Lock()
+	if disable {
+		conn.pausedStreams[streamId] = true
+	} else {
+		delete(conn.pausedStreams, streamId)
+	}
+	conn.flowMux.Unlock()
+
+	conn.updateReadDisable()
+}
+
+// updateReadDisable disables reading the connection if all the active streams are paused
+func (conn *streamConnection) updateReadDisable() {
+	conn.flowMux.Lock()
+	defer conn.flowMux.Unlock()
+
+	if len(conn.pausedStreams) == 0 && !conn.readDisabled {
+		return
+	}
+
+	// streams removed are not paused any more
+	for streamId := range conn.pausedStreams {
+		if !conn.activeStreams.Has(streamId) {
+			delete(conn.pausedStreams, streamId)
+		}
+	}
+
+	disable := len(conn.pausedStreams) > 0 && len(conn.pausedStreams) == conn.activeStreams.Len()
+
+	if disable != conn.readDisabled {
+		conn.readDisabled = disable
+		conn.connection.SetReadDisable(disable)
+	}
+}
+
 func (conn *streamConnection) OnDecodeHeader(streamId string, headers map[string]string) types.FilterStatus {
-	if sofarpc.IsSofaRequest(headers) {
+	if conn.onHeartbeatAck(streamId, headers) {
+		return types.StopIteration
+	}
+
+	isRequest := sofarpc.IsSofaRequest(headers)
+	if isRequest {
 		conn.onNewStreamDetected(streamId, headers)
 	}
 	endStream := decodeSterilize(streamId, headers)
 
-	if stream, ok := conn.activeStreams.Get(streamId); ok {
-		stream.decoder.OnReceiveHeaders(headers, endStream)
-		if endStream {
-			return types.StopIteration
+	stream, ok := conn.getStream(streamId, isRequest)
+	if !ok {
+		if !isRequest {
+			conn.onUnmatchedResponse(streamId)
 		}
+
+		// the data of the frame is dropped as well
+		return types.StopIteration
+	}
+
+	if stream.direction == ClientStream && stream.requestId != streamId {
+		// response of a remapped request, restore the original request id
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = stream.requestId
+		headers[types.HeaderStreamID] = stream.requestId
+	}
+
+	if stream.direction == ClientStream {
+		conn.recordResponseContentSize(headers)
+	}
+
+	stream.decoder.OnReceiveHeaders(headers, endStream)
+	if endStream {
+		// for client stream, response without body(e.g. heartbeat ack) ends on header read
+		// oneway request has no response, remove stream on request read
+		if stream.direction == ClientStream || stream.oneway {
+			conn.removeStream(streamId)
+		}
+
+		return types.StopIteration
 	}
 
 	return types.Continue
 }
 
+// getStream returns the stream the decoded frame belongs to. Responses are matched strictly by request
+// id to the pending requests sent on the connection, and requests to the streams detected on them,
+// so that a response is never delivered to a stream of another direction with the same id.
+func (conn *streamConnection) getStream(streamId string, isRequest bool) (stream, bool) {
+	s, ok := conn.activeStreams.Get(streamId)
+	if !ok || (s.direction == ServerStream) != isRequest {
+		return stream{}, false
+	}
+
+	return s, true
+}
+
+// onUnmatchedResponse drops the response as no pending request has the request id. The late response
+// of a reset request releases the quarantined id, others are recorded as errors, e.g. the upstream
+// responds with a wrong request id.
+func (conn *streamConnection) onUnmatchedResponse(streamId string) {
+	if conn.activeStreams.ReleaseReset(streamId) {
+		conn.logger.Debugf("response of reset request dropped, request id = %s", streamId)
+		return
+	}
+
+	conn.logger.Errorf("no pending request matches the response, request id = %s", streamId)
+
+	tags := stats.Tags{}
+	if conn.context != nil {
+		if cluster, ok := conn.context.Value(types.ContextKeyUpstreamCluster).(string); ok {
+			tags[stats.TagCluster] = cluster
+		}
+	}
+	stats.GetSink().Count(stats.ClusterUnmatchedResponses, 1, tags)
+}
+
 func (conn *streamConnection) OnDecodeData(streamId string, data types.IoBuffer) types.FilterStatus {
 	if stream, ok := conn.activeStreams.Get(streamId); ok {
 		stream.decoder.OnReceiveData(data, true)
 
-		if stream.direction == ClientStream {
+		if stream.direction == ClientStream || stream.oneway {
 			// for client stream, remove stream on response read
-			stream.connection.activeStreams.Remove(stream.streamId)
+			// for oneway server stream, remove stream on request read
+			conn.removeStream(stream.streamId)
 		}
 	}
 
@@ -147,28 +428,142 @@ func (conn *streamConnection) OnDecodeTrailer(streamId string, trailers map[stri
 	return types.StopIteration
 }
 
+// start heartbeat trigger if the protocol supports, sub protocol of client stream
+// connection is unknown until the first request sent
+func (conn *streamConnection) startHeartbeatTrigger(protocolCode byte) {
+	conn.triggerOnce.Do(func() {
+		if trigger := sofarpc.CreateHeartbeatTrigger(conn.context, protocolCode, conn.connection, conn.nextRequestId); trigger != nil {
+			conn.heartbeatTrigger.Store(trigger)
+			trigger.Start()
+		}
+	})
+}
+
+// nextRequestId returns a request id not used by the active streams, for the requests
+// sent without stream, e.g. heartbeat
+func (conn *streamConnection) nextRequestId() uint32 {
+	for {
+		requestId := atomic.AddUint32(&conn.requestIdCounter, 1)
+
+		if !conn.activeStreams.Has(sofarpc.StreamIDConvert(requestId)) {
+			return requestId
+		}
+	}
+}
+
+// onActive postpones the heartbeat on reads and writes, only idle connections send heartbeats
+func (conn *streamConnection) onActive() {
+	if trigger, ok := conn.heartbeatTrigger.Load().(sofarpc.HeartbeatTrigger); ok {
+		trigger.OnActive()
+	}
+}
+
+// heartbeat ack for the heartbeat trigger has no stream
+func (conn *streamConnection) onHeartbeatAck(streamId string, headers map[string]string) bool {
+	trigger, ok := conn.heartbeatTrigger.Load().(sofarpc.HeartbeatTrigger)
+	if !ok || sofarpc.IsSofaRequest(headers) || conn.activeStreams.Has(streamId) {
+		return false
+	}
+
+	if cmdCodeStr, ok := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode)]; ok {
+		if sofarpc.ConvertPropertyValue(cmdCodeStr, reflect.Int16) == sofarpc.HEARTBEAT {
+			requestId := sofarpc.ConvertPropertyValue(streamId, reflect.Uint32).(uint32)
+			trigger.OnHeartbeatAck(requestId)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordResponseContentSize records the content size of the response decoded by the client stream,
+// the wire content length differs from contentlen if the content is decompressed
+func (conn *streamConnection) recordResponseContentSize(headers map[string]string) {
+	wireLen, wireOk := headers[types.HeaderWireContentLen]
+	delete(headers, types.HeaderWireContentLen)
+
+	contentLen, err := strconv.Atoi(headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)])
+	if err != nil {
+		return
+	}
+
+	wireContentLen := contentLen
+	if wireOk {
+		if l, err := strconv.Atoi(wireLen); err == nil {
+			wireContentLen = l
+		}
+	}
+
+	conn.recordContentSize(stats.DirectionResponse, contentLen, wireContentLen)
+}
+
+// recordContentSize records the content size before compression and on the wire to the upstream cluster
+// of the connection, nothing is recorded for connections not to a cluster
+func (conn *streamConnection) recordContentSize(direction string, contentLen, wireContentLen int) {
+	if conn.context == nil {
+		return
+	}
+
+	cluster, ok := conn.context.Value(types.ContextKeyUpstreamCluster).(string)
+	if !ok {
+		return
+	}
+
+	tags := stats.Tags{
+		stats.TagCluster:   cluster,
+		stats.TagDirection: direction,
+	}
+	sink := stats.GetSink()
+	sink.Histogram(stats.ClusterContentSize, float64(contentLen), tags)
+	sink.Histogram(stats.ClusterWireContentSize, float64(wireContentLen), tags)
+}
+
+func bufferLen(buf types.IoBuffer) int {
+	if buf == nil {
+		return 0
+	}
+
+	return buf.Len()
+}
+
 // todo, deal with more exception
 func (conn *streamConnection) OnDecodeError(err error, header map[string]string) {
 	if err == nil {
 		return
 	}
 
+	// the response exceeding the limits of cluster fails its request only, other requests
+	// multiplexed on the connection are not affected
+	if tooLarge, ok := err.(*sofarpc.ResponseTooLargeError); ok {
+		conn.onResponseTooLarge(tooLarge)
+		return
+	}
+
 	switch err.Error() {
-	case types.UnSupportedProCode, sofarpc.UnKnownCmdcode, sofarpc.UnKnownReqtype:
+	case types.UnSupportedProCode, sofarpc.UnKnownCmdcode, sofarpc.UnKnownReqtype, sofarpc.InvalidCrc32,
+		sofarpc.InvalidCompression, sofarpc.FrameTooLarge, sofarpc.UnKnownCodec:
 		// for header decode error, close the connection directly
+		reason := sofarpc.RecordConnectionClose(err)
+		conn.logger.Errorf("close connection on decode error: %v, reason = %s", err, reason)
 		conn.connection.Close(types.NoFlush, types.LocalClose)
 	case types.CodecException:
 		if v, ok := header[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)]; ok {
-			conn.onNewStreamDetected(v, header)
+			isRequest := sofarpc.IsSofaRequest(header)
+			if isRequest {
+				conn.onNewStreamDetected(v, header)
+			}
 
-			if stream, ok := conn.activeStreams.Get(v); ok {
+			if stream, ok := conn.getStream(v, isRequest); ok {
 
 				stream.decoder.OnDecodeError(err, header)
 
 				if stream.direction == ClientStream {
 					// for client stream, remove stream on response read
-					stream.connection.activeStreams.Remove(stream.streamId)
+					conn.removeStream(stream.streamId)
 				}
+			} else if !isRequest {
+				conn.onUnmatchedResponse(v)
 			}
 		} else {
 			// if no request id found, no reason to send response, so close connection
@@ -177,6 +572,24 @@ func (conn *streamConnection) OnDecodeError(err error, header map[string]string)
 	}
 }
 
+// onResponseTooLarge skips the rest of the response, and fails the client stream of it
+func (conn *streamConnection) onResponseTooLarge(err *sofarpc.ResponseTooLargeError) {
+	conn.discardBytes = err.FrameLen
+
+	streamId := strconv.FormatUint(uint64(err.RequestId), 10)
+	conn.logger.Errorf("skip the response exceeding the limits of cluster, request id = %s", streamId)
+
+	stream, ok := conn.getStream(streamId, false)
+	if !ok {
+		conn.onUnmatchedResponse(streamId)
+		return
+	}
+
+	// the response is received, so the request id is released at once rather than quarantined
+	conn.removeStream(streamId)
+	stream.decoder.OnDecodeError(err, nil)
+}
+
 func (conn *streamConnection) onNewStreamDetected(streamId string, headers map[string]string) {
 	if ok := conn.activeStreams.Has(streamId); ok {
 		log.DefaultLogger.Infof("OnReceiveHeaders, stream already exist, maybe response, StreamID = %s", streamId)
@@ -193,12 +606,30 @@ func (conn *streamConnection) onNewStreamDetected(streamId string, headers map[s
 
 	headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = streamId
 
+	_, oneway := headers[types.HeaderOneway]
+
+	streamContext := context.WithValue(conn.context, types.ContextKeyStreamId, streamId)
+	// response is compressed by the algorithm accepted by the peer
+	if v, ok := headers[types.HeaderCompression]; ok {
+		delete(headers, types.HeaderCompression)
+
+		if algorithm, err := strconv.ParseUint(v, 10, 8); err == nil {
+			streamContext = context.WithValue(streamContext, types.ContextKeyBoltCompression, sofarpc.Compression{
+				Algorithm: sofarpc.SwitchCode(algorithm),
+				Threshold: sofarpc.DefaultCompressionThreshold,
+			})
+		}
+	}
+
 	stream := stream{
-		context:    context.WithValue(conn.context, types.ContextKeyStreamId, streamId),
+		context:    streamContext,
 		streamId:   streamId,
 		requestId:  requestId,
 		direction:  ServerStream,
+		oneway:     oneway,
 		connection: conn,
+		// the response replied by mosn itself follows the frame of request
+		requestFrame: sofarpc.RequestFrameHeaders(headers),
 	}
 
 	log.DefaultLogger.Infof("OnReceiveHeaders, New stream detected, Request id = %s, StreamID = %s", requestId, streamId)
@@ -215,12 +646,15 @@ type stream struct {
 	streamId         string
 	requestId        string
 	direction        StreamDirection // 0: out, 1: in
+	oneway           bool            // request expects no response
 	readDisableCount int
 	connection       *streamConnection
 	decoder          types.StreamReceiver
 	streamCbs        []types.StreamEventListener
 	encodedHeaders   types.IoBuffer
 	encodedData      types.IoBuffer
+	// protocol, version and codec of the request, for server stream only
+	requestFrame map[string]string
 }
 
 // ~~ types.Stream
@@ -244,12 +678,31 @@ func (s *stream) RemoveEventListener(cb types.StreamEventListener) {
 }
 
 func (s *stream) ResetStream(reason types.StreamResetReason) {
+	// no response is expected after reset, e.g. on timeout or connection close, but the late
+	// response may still arrive, the request id of client stream is not reused until then
+	if s.direction == ClientStream {
+		s.connection.resetStream(s.streamId)
+
+		// the request may be processed already if its response is received partially, the frame left
+		// can't be matched to a request, so all the requests in flight are reset by remote
+		if reason == types.StreamConnectionTermination && s.connection.truncated {
+			reason = types.StreamRemoteReset
+		}
+	}
+
 	for _, cb := range s.streamCbs {
 		cb.OnResetStream(reason)
 	}
 }
 
+// ReadDisable of a client stream pauses the response of the request only, the connection
+// is shared by multiplexed requests
 func (s *stream) ReadDisable(disable bool) {
+	if s.direction == ClientStream {
+		s.connection.readDisableStream(s.streamId, disable)
+		return
+	}
+
 	s.connection.connection.SetReadDisable(disable)
 }
 
@@ -261,12 +714,20 @@ func (s *stream) BufferLimit() uint32 {
 func (s *stream) AppendHeaders(headers interface{}, endStream bool) error {
 	var err error
 
+	if headerMaps, ok := headers.(map[string]string); ok && s.direction == ClientStream {
+		_, s.oneway = headerMaps[types.HeaderOneway]
+	}
+
 	if err, s.encodedHeaders = s.connection.protocols.EncodeHeaders(s.context, s.encodeSterilize(headers)); err != nil {
 		return err
 	}
 
 	log.DefaultLogger.Infof("AppendHeaders,request id = %s, direction = %d", s.streamId, s.direction)
 
+	if s.direction == ClientStream && s.encodedHeaders.Len() > 0 {
+		s.connection.startHeartbeatTrigger(s.encodedHeaders.Bytes()[0])
+	}
+
 	if endStream {
 		s.endStream()
 	}
@@ -300,14 +761,39 @@ func (s *stream) endStream() {
 		log.DefaultLogger.Infof("Write to remote, stream id = %s, direction = %d", s.streamId, s.direction)
 
 		if stream, ok := s.connection.activeStreams.Get(s.streamId); ok {
+			// the headers are drained by the write, the protocol code is kept to give the buffer back
+			var protocolCode byte
+			if s.encodedHeaders.Len() > 0 {
+				protocolCode = s.encodedHeaders.Bytes()[0]
+			}
+			contentLen := bufferLen(s.encodedData)
+			// content may be compressed, the encoded headers are updated as well
+			s.encodedData = sofarpc.EncodeContent(s.context, s.encodedHeaders, s.encodedData)
 
-			if s.encodedData != nil {
+			if s.direction == ClientStream {
+				s.connection.recordContentSize(stats.DirectionRequest, contentLen, bufferLen(s.encodedData))
+			}
+
+			// trailer covering the content, e.g. crc32 of bolt v2, is written after data
+			if trailer := sofarpc.EncodeFrameTrailer(s.context, s.encodedHeaders, s.encodedData); trailer != nil {
+				if s.encodedData != nil {
+					stream.connection.connection.Write(s.encodedHeaders, s.encodedData, trailer)
+				} else {
+					stream.connection.connection.Write(s.encodedHeaders, trailer)
+				}
+			} else if s.encodedData != nil {
 				//	log.DefaultLogger.Debugf("[response data1 Response Body is full]",s.encodedHeaders.Bytes(),time.Now().String())
 				stream.connection.connection.Write(s.encodedHeaders, s.encodedData)
 			} else {
 				//	s.connection.logger.Debugf("stream %s response body is void...", s.streamId)
 				stream.connection.connection.Write(s.encodedHeaders)
 			}
+
+			s.connection.onActive()
+
+			// written to the connection buffer, the encoded headers are done with
+			sofarpc.ReleaseEncodedHeaders(protocolCode, s.encodedHeaders)
+			s.encodedHeaders = nil
 		} else {
 			s.connection.logger.Errorf("No stream %s to end", s.streamId)
 		}
@@ -315,9 +801,10 @@ func (s *stream) endStream() {
 		s.connection.logger.Debugf("Response Headers is void...")
 	}
 
-	if s.direction == ServerStream {
+	if s.direction == ServerStream || s.oneway {
 		// for a server stream, remove stream on response wrote
-		s.connection.activeStreams.Remove(s.streamId)
+		// for a oneway client stream, remove stream on request wrote as no response is expected
+		s.connection.removeStream(s.streamId)
 		//	log.StartLogger.Warnf("Remove Request ID = %+v",s.streamId)
 	}
 }
@@ -326,16 +813,23 @@ func (s *stream) GetStream() types.Stream {
 	return s
 }
 
+// ResetStreamIdQuarantine is the time the id of a reset client stream is not reused, so that the late
+// response of the reset request, e.g. timeout, is not matched to a new request with the same id
+var ResetStreamIdQuarantine = time.Minute
+
 type streamMap struct {
 	smap map[string]interface{}
-	mux  sync.RWMutex
+	// ids of the reset client streams by reset time
+	reset map[string]time.Time
+	mux   sync.RWMutex
 }
 
 func newStreamMap(context context.Context) streamMap {
 	smap := make(map[string]interface{}, 5096)
 
 	return streamMap{
-		smap: smap,
+		smap:  smap,
+		reset: make(map[string]time.Time),
 	}
 }
 
@@ -361,6 +855,13 @@ func (m *streamMap) Get(streamId string) (stream, bool) {
 	}
 }
 
+func (m *streamMap) Len() int {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	return len(m.smap)
+}
+
 func (m *streamMap) Remove(streamId string) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
@@ -374,3 +875,49 @@ func (m *streamMap) Set(streamId string, s stream) {
 
 	m.smap[streamId] = s
 }
+
+// SetIfAbsent sets the stream only if the stream id is neither in use nor quarantined, returns false otherwise
+func (m *streamMap) SetIfAbsent(streamId string, s stream) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, ok := m.smap[streamId]; ok {
+		return false
+	}
+	if _, ok := m.reset[streamId]; ok {
+		return false
+	}
+
+	m.smap[streamId] = s
+	return true
+}
+
+// Reset removes the stream and quarantines its id until the late response arrives or the quarantine
+// expires, ids expired are released on the way
+func (m *streamMap) Reset(streamId string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	for id, resetTime := range m.reset {
+		if now.Sub(resetTime) > ResetStreamIdQuarantine {
+			delete(m.reset, id)
+		}
+	}
+
+	delete(m.smap, streamId)
+	m.reset[streamId] = now
+}
+
+// ReleaseReset releases the quarantined id, returns false if the id is not quarantined
+func (m *streamMap) ReleaseReset(streamId string) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, ok := m.reset[streamId]; !ok {
+		return false
+	}
+
+	delete(m.reset, streamId)
+	return true
+}
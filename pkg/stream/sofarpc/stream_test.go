@@ -0,0 +1,1223 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type mockConnection struct {
+	types.Connection
+	written      int
+	bytes        []byte
+	readDisabled bool
+	closed       chan struct{}
+}
+
+func (c *mockConnection) Close(ccType types.ConnectionCloseType, eventType types.ConnectionEvent) error {
+	if c.closed != nil {
+		close(c.closed)
+	}
+	return nil
+}
+
+func (c *mockConnection) SetReadDisable(disable bool) {
+	c.readDisabled = disable
+}
+
+func (c *mockConnection) Write(buf ...types.IoBuffer) error {
+	c.written++
+	for _, b := range buf {
+		c.bytes = append(c.bytes, b.Bytes()...)
+	}
+	return nil
+}
+
+type mockReceiver struct {
+	headers map[string]string
+	data    types.IoBuffer
+	err     error
+}
+
+func (r *mockReceiver) OnReceiveHeaders(headers map[string]string, endOfStream bool) {
+	r.headers = headers
+}
+
+func (r *mockReceiver) OnReceiveData(data types.IoBuffer, endOfStream bool) {
+	r.data = data
+}
+
+func (r *mockReceiver) OnReceiveTrailers(trailers map[string]string) {}
+
+func (r *mockReceiver) OnDecodeError(err error, headers map[string]string) {
+	r.err = err
+}
+
+type mockServerCallbacks struct {
+	receiver *mockReceiver
+	sender   types.StreamSender
+}
+
+func (cb *mockServerCallbacks) OnGoAway() {}
+
+func (cb *mockServerCallbacks) NewStream(streamId string, responseEncoder types.StreamSender) types.StreamReceiver {
+	cb.sender = responseEncoder
+	return cb.receiver
+}
+
+func newOnewayRequestHeaders() map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.REQUEST_ONEWAY)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode):      strconv.Itoa(int(sofarpc.RPC_REQUEST)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderVersion):      "1",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        "1",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCodec):        strconv.Itoa(int(sofarpc.HESSIAN_SERIALIZE)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderTimeout):      "3000",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderClassLen):     "0",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderHeaderLen):    "0",
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen):   "0",
+		"service": "com.alipay.test.AuditService:1.0",
+	}
+}
+
+func Test_OnewayServerStream(t *testing.T) {
+	err, buf := codec.BoltV1.GetEncoder().EncodeHeaders(nil, newOnewayRequestHeaders())
+	if err != nil {
+		t.Fatalf("encode oneway request failed: %v", err)
+	}
+
+	receiver := &mockReceiver{}
+	conn := newStreamConnection(context.Background(), &mockConnection{}, nil,
+		&mockServerCallbacks{receiver: receiver}).(*streamConnection)
+	conn.Dispatch(buffer.NewIoBufferBytes(buf.Bytes()))
+
+	if _, ok := receiver.headers[types.HeaderOneway]; !ok {
+		t.Errorf("oneway request should be marked, headers = %v", receiver.headers)
+	}
+	if len(conn.activeStreams.smap) != 0 {
+		t.Errorf("oneway request should not wait for response, active streams = %v", conn.activeStreams.smap)
+	}
+}
+
+func Test_OnewayClientStream(t *testing.T) {
+	connection := &mockConnection{}
+	conn := newStreamConnection(context.Background(), connection, nil, nil).(*streamConnection)
+
+	headers := newOnewayRequestHeaders()
+	headers[types.HeaderOneway] = "yes"
+
+	sender := conn.NewStream("1", &mockReceiver{})
+	if err := sender.AppendHeaders(headers, true); err != nil {
+		t.Fatalf("append oneway request failed: %v", err)
+	}
+
+	if connection.written != 1 {
+		t.Errorf("oneway request should be written, written = %d", connection.written)
+	}
+	if conn.activeStreams.Has("1") {
+		t.Errorf("no pending response should remain for oneway request")
+	}
+}
+
+func newResponseHeaders(requestId string) map[string]string {
+	return map[string]string{
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode): strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType):      strconv.Itoa(int(sofarpc.RESPONSE)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdCode):      strconv.Itoa(int(sofarpc.RPC_RESPONSE)),
+		sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID):        requestId,
+		types.HeaderStremEnd:                                   "yes",
+	}
+}
+
+func Test_RequestIdRemap(t *testing.T) {
+	conn := newStreamConnection(context.Background(), &mockConnection{}, nil, nil).(*streamConnection)
+
+	// two downstream requests with the same request id share the upstream connection
+	first, second := &mockReceiver{}, &mockReceiver{}
+	firstSender := conn.NewStream("1", first).(*stream)
+	secondSender := conn.NewStream("1", second).(*stream)
+
+	if firstSender.streamId != "1" {
+		t.Errorf("request id not in use should not be remapped, got %s", firstSender.streamId)
+	}
+	if secondSender.streamId == "1" {
+		t.Fatalf("colliding request id should be remapped")
+	}
+
+	// the remapped id is sent to upstream
+	headers := secondSender.encodeSterilize(newOnewayRequestHeaders()).(map[string]string)
+	if headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] != secondSender.streamId {
+		t.Errorf("expect request id %s sent to upstream, got %s", secondSender.streamId, headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)])
+	}
+
+	// responses are routed back to their callers, with the original request id
+	conn.OnDecodeHeader(secondSender.streamId, newResponseHeaders(secondSender.streamId))
+	if second.headers == nil || first.headers != nil {
+		t.Fatalf("response of remapped request should be routed to its caller")
+	}
+	if id := second.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)]; id != "1" {
+		t.Errorf("expect original request id restored on response, got %s", id)
+	}
+
+	conn.OnDecodeHeader("1", newResponseHeaders("1"))
+	if first.headers == nil {
+		t.Fatalf("response should be routed to the first caller")
+	}
+
+	if len(conn.activeStreams.smap) != 0 {
+		t.Errorf("request ids should be released on response, active streams = %v", conn.activeStreams.smap)
+	}
+}
+
+func Test_RequestIdReleasedOnReset(t *testing.T) {
+	conn := newStreamConnection(context.Background(), &mockConnection{}, nil, nil).(*streamConnection)
+
+	sender := conn.NewStream("1", &mockReceiver{})
+	// e.g. the upstream connection is closed
+	sender.GetStream().ResetStream(types.StreamConnectionTermination)
+
+	if conn.activeStreams.Has("1") {
+		t.Errorf("reset stream should be removed")
+	}
+
+	// the late response of the reset request may still arrive, the id is not reused until then
+	remapped := conn.NewStream("1", &mockReceiver{}).(*stream)
+	if remapped.streamId == "1" {
+		t.Fatalf("request id of reset stream should not be reused before its response")
+	}
+	remapped.ResetStream(types.StreamLocalReset)
+
+	conn.OnDecodeHeader("1", newResponseHeaders("1"))
+	if s := conn.NewStream("1", &mockReceiver{}).(*stream); s.streamId != "1" {
+		t.Errorf("request id should be reused after the late response, got %s", s.streamId)
+	}
+
+	// ids not responded are released after the quarantine
+	quarantine := ResetStreamIdQuarantine
+	ResetStreamIdQuarantine = 0
+	defer func() {
+		ResetStreamIdQuarantine = quarantine
+	}()
+
+	conn.NewStream("2", &mockReceiver{}).GetStream().ResetStream(types.StreamLocalReset)
+	time.Sleep(time.Millisecond)
+	conn.NewStream("3", &mockReceiver{}).GetStream().ResetStream(types.StreamLocalReset)
+	if s := conn.NewStream("2", &mockReceiver{}).(*stream); s.streamId != "2" {
+		t.Errorf("request id should be reused after the quarantine, got %s", s.streamId)
+	}
+}
+
+type mockStreamEventListener struct {
+	reason types.StreamResetReason
+}
+
+func (l *mockStreamEventListener) OnResetStream(reason types.StreamResetReason) {
+	l.reason = reason
+}
+
+// requests in flight are reset by remote if the connection is closed with a response received partially,
+// so that they are not retried as the requests never processed
+func Test_ResetOnTruncatedResponse(t *testing.T) {
+	conn := newStreamConnection(context.Background(), &mockConnection{}, nil, nil).(*streamConnection)
+
+	listener := &mockStreamEventListener{}
+	sender := conn.NewStream("1", &mockReceiver{})
+	sender.GetStream().AddEventListener(listener)
+	conn.OnEvent(types.RemoteClose)
+	sender.GetStream().ResetStream(types.StreamConnectionTermination)
+	if listener.reason != types.StreamConnectionTermination {
+		t.Errorf("expect reset reason %s without response received, got %s", types.StreamConnectionTermination, listener.reason)
+	}
+
+	conn = newStreamConnection(context.Background(), &mockConnection{}, nil, nil).(*streamConnection)
+	sender = conn.NewStream("1", &mockReceiver{})
+	sender.GetStream().AddEventListener(listener)
+	// the first bytes of a bolt v1 response
+	conn.Dispatch(buffer.NewIoBufferBytes([]byte{sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE, 0, 2, 1}))
+	conn.OnEvent(types.RemoteClose)
+	sender.GetStream().ResetStream(types.StreamConnectionTermination)
+	if listener.reason != types.StreamRemoteReset {
+		t.Errorf("expect reset reason %s with response received partially, got %s", types.StreamRemoteReset, listener.reason)
+	}
+}
+
+func Test_ReadDisableMultiplexedStreams(t *testing.T) {
+	mc := &mockConnection{}
+	conn := newStreamConnection(context.Background(), mc, nil, nil).(*streamConnection)
+
+	paused := conn.NewStream("1", &mockReceiver{}).GetStream()
+	conn.NewStream("2", &mockReceiver{})
+
+	// the other request on the connection is still read
+	paused.ReadDisable(true)
+	if mc.readDisabled {
+		t.Fatalf("connection should not be paused while other requests are not paused")
+	}
+
+	// only the paused request is left, the connection is not read any more
+	conn.OnDecodeHeader("2", newResponseHeaders("2"))
+	if !mc.readDisabled {
+		t.Fatalf("connection should be paused if all requests are paused")
+	}
+
+	// a new request needs reading the connection
+	third := &mockReceiver{}
+	conn.NewStream("3", third)
+	if mc.readDisabled {
+		t.Fatalf("connection should be resumed on a new request")
+	}
+	conn.OnDecodeHeader("3", newResponseHeaders("3"))
+	if third.headers == nil || !mc.readDisabled {
+		t.Fatalf("connection should be paused again after the new request is responded")
+	}
+
+	paused.ReadDisable(false)
+	if mc.readDisabled {
+		t.Errorf("connection should be resumed on the request resumed")
+	}
+
+	// a paused request reset does not keep the connection paused
+	paused.ReadDisable(true)
+	if !mc.readDisabled {
+		t.Fatalf("connection should be paused if all requests are paused")
+	}
+	paused.ResetStream(types.StreamLocalReset)
+	if mc.readDisabled || len(conn.pausedStreams) != 0 {
+		t.Errorf("connection should be resumed on the paused request reset, paused streams = %v", conn.pausedStreams)
+	}
+}
+
+func newBoltV2Frame(t *testing.T, switchCode sofarpc.SwitchCode, content []byte) []byte {
+	err, buf := codec.BoltV2.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltV2RequestCommand{
+		BoltRequestCommand: sofarpc.BoltRequestCommand{
+			Protocol:   sofarpc.PROTOCOL_CODE_V2,
+			CmdType:    sofarpc.REQUEST,
+			CmdCode:    sofarpc.RPC_REQUEST,
+			Version:    1,
+			ReqId:      1,
+			CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+			Timeout:    3000,
+			ContentLen: len(content),
+			Content:    content,
+		},
+		Version1:   2,
+		SwitchCode: switchCode,
+	})
+	if err != nil {
+		t.Fatalf("encode bolt v2 request failed: %v", err)
+	}
+
+	frame := buf.Bytes()
+	if !switchCode.Has(sofarpc.SWITCH_CRC_ON) {
+		frame = append(frame, content...)
+	}
+
+	return frame
+}
+
+// proxies the frame from a server stream to a client stream, returns the frame written to upstream
+func proxyBoltV2Frame(t *testing.T, clientContext context.Context, frame []byte) *sofarpc.BoltV2RequestCommand {
+	receiver := &mockReceiver{}
+	serverConn := newStreamConnection(context.Background(), &mockConnection{}, nil,
+		&mockServerCallbacks{receiver: receiver}).(*streamConnection)
+	serverConn.Dispatch(buffer.NewIoBufferBytes(frame))
+
+	if receiver.headers == nil || receiver.data == nil {
+		t.Fatalf("request is not received by server stream")
+	}
+
+	upstream := &mockConnection{}
+	clientConn := newStreamConnection(clientContext, upstream, nil, nil).(*streamConnection)
+	sender := clientConn.NewStream("1", &mockReceiver{})
+	sender.AppendHeaders(receiver.headers, false)
+	sender.AppendData(receiver.data, true)
+
+	data := buffer.NewIoBufferBytes(upstream.bytes)
+	read, cmd := codec.BoltV2.GetDecoder().Decode(nil, data)
+	request, ok := cmd.(*sofarpc.BoltV2RequestCommand)
+	if !ok || read != len(upstream.bytes) {
+		t.Fatalf("expect a bolt v2 request of %d bytes sent to upstream, got %+v, read %d", len(upstream.bytes), cmd, read)
+	}
+
+	return request
+}
+
+func Test_BoltV2SwitchPassThrough(t *testing.T) {
+	content := []byte("hello bolt v2")
+
+	// crc switch with an unknown bit
+	switchCode := sofarpc.SWITCH_CRC_ON | 0x80
+	request := proxyBoltV2Frame(t, context.Background(), newBoltV2Frame(t, switchCode, content))
+
+	if request.SwitchCode != switchCode {
+		t.Errorf("expect switch %x kept on pass through, got %x", switchCode, request.SwitchCode)
+	}
+	if request.Version1 != 2 || !bytes.Equal(request.Content, content) {
+		t.Errorf("unexpected request sent to upstream: %+v", request)
+	}
+}
+
+func Test_BoltV2ConnectionSwitch(t *testing.T) {
+	content := []byte("hello bolt v2")
+
+	// crc is turned on by the upstream connection
+	clientContext := context.WithValue(context.Background(), types.ContextKeyBoltSwitch, sofarpc.SWITCH_CRC_ON)
+	request := proxyBoltV2Frame(t, clientContext, newBoltV2Frame(t, 0x80, content))
+
+	if request.SwitchCode != sofarpc.SWITCH_CRC_ON|0x80 {
+		t.Errorf("expect crc switch turned on, got %x", request.SwitchCode)
+	}
+	if !bytes.Equal(request.Content, content) {
+		t.Errorf("unexpected request sent to upstream: %+v", request)
+	}
+}
+
+func Test_BoltV2Compression(t *testing.T) {
+	content := bytes.Repeat([]byte("hello bolt v2 "), 1024)
+
+	// request content is compressed by gzip downstream
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(content)
+	writer.Close()
+
+	downstream := &mockConnection{}
+	receiver := &mockReceiver{}
+	callbacks := &mockServerCallbacks{receiver: receiver}
+	serverConn := newStreamConnection(context.Background(), downstream, nil, callbacks).(*streamConnection)
+	serverConn.Dispatch(buffer.NewIoBufferBytes(newBoltV2Frame(t,
+		sofarpc.SWITCH_GZIP_ON|sofarpc.SWITCH_COMPRESSED, compressed.Bytes())))
+
+	// content is decompressed before handed to filters
+	if receiver.data == nil || !bytes.Equal(receiver.data.Bytes(), content) {
+		t.Fatalf("expect decompressed content received by server stream")
+	}
+	if _, ok := receiver.headers[types.HeaderCompression]; ok {
+		t.Errorf("compression header should not be forwarded")
+	}
+
+	// request is compressed by deflate upstream
+	upstream := &mockConnection{}
+	clientContext := context.WithValue(context.Background(), types.ContextKeyBoltCompression, sofarpc.Compression{
+		Algorithm: sofarpc.SWITCH_DEFLATE_ON,
+		Threshold: 1024,
+	})
+	clientConn := newStreamConnection(clientContext, upstream, nil, nil).(*streamConnection)
+	sender := clientConn.NewStream("1", &mockReceiver{})
+	sender.AppendHeaders(receiver.headers, false)
+	sender.AppendData(receiver.data, true)
+
+	if len(upstream.bytes) >= len(content) ||
+		sofarpc.SwitchCode(upstream.bytes[11]) != sofarpc.SWITCH_DEFLATE_ON|sofarpc.SWITCH_COMPRESSED {
+		t.Fatalf("expect request compressed by deflate, got %d bytes, switch %x", len(upstream.bytes), upstream.bytes[11])
+	}
+	read, cmd := codec.BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(upstream.bytes))
+	request, ok := cmd.(*sofarpc.BoltV2RequestCommand)
+	if !ok || read != len(upstream.bytes) || !bytes.Equal(request.Content, content) {
+		t.Fatalf("unexpected request sent to upstream: %+v", cmd)
+	}
+
+	// response is compressed by the algorithm accepted downstream
+	callbacks.sender.AppendHeaders(&sofarpc.BoltV2ResponseCommand{
+		BoltResponseCommand: sofarpc.BoltResponseCommand{
+			Protocol:   sofarpc.PROTOCOL_CODE_V2,
+			CmdType:    sofarpc.RESPONSE,
+			CmdCode:    sofarpc.RPC_RESPONSE,
+			Version:    1,
+			ReqId:      1,
+			CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+			ContentLen: len(content),
+		},
+		Version1: 2,
+	}, false)
+	callbacks.sender.AppendData(buffer.NewIoBufferBytes(content), true)
+
+	if len(downstream.bytes) >= len(content) ||
+		sofarpc.SwitchCode(downstream.bytes[11]) != sofarpc.SWITCH_GZIP_ON|sofarpc.SWITCH_COMPRESSED {
+		t.Fatalf("expect response compressed by gzip, got %d bytes, switch %x", len(downstream.bytes), downstream.bytes[11])
+	}
+	_, cmd = codec.BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(downstream.bytes))
+	response, ok := cmd.(*sofarpc.BoltV2ResponseCommand)
+	if !ok || !bytes.Equal(response.Content, content) || response.SwitchCode != 0 {
+		t.Errorf("unexpected response sent to downstream: %+v", cmd)
+	}
+}
+
+func Test_ReplyWithResponseStatus(t *testing.T) {
+	s := &stream{
+		context:   context.Background(),
+		direction: ServerStream,
+		requestId: "7",
+	}
+
+	// replied by mosn with the response status, e.g. fault injection
+	headers := newOnewayRequestHeaders()
+	headers[types.HeaderStatus] = strconv.Itoa(types.UpstreamOverFlowCode)
+	headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] = strconv.Itoa(int(sofarpc.RESPONSE_STATUS_NO_PROCESSOR))
+
+	response, ok := s.encodeSterilize(headers).(*sofarpc.BoltResponseCommand)
+	if !ok {
+		t.Fatalf("expect bolt response built, got %+v", response)
+	}
+	if response.ResponseStatus != sofarpc.RESPONSE_STATUS_NO_PROCESSOR || response.ReqId != 7 {
+		t.Errorf("unexpected response: %+v", response)
+	}
+}
+
+type codecErrorSink struct {
+	stats.MetricsSink
+	counts map[string]int64
+}
+
+func (s *codecErrorSink) Count(name string, value int64, tags stats.Tags) {
+	s.counts[name+":"+tags[sofarpc.TagCodec]+":"+tags[sofarpc.TagReason]] += value
+}
+
+func Test_ShortFrameOnRemoteClose(t *testing.T) {
+	sink := &codecErrorSink{counts: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	frame := newBoltV2Frame(t, 0, []byte("hello bolt v2"))
+	conn := newStreamConnection(context.Background(), &mockConnection{}, nil,
+		&mockServerCallbacks{receiver: &mockReceiver{}}).(*streamConnection)
+	conn.Dispatch(buffer.NewIoBufferBytes(frame[:len(frame)-1]))
+	conn.OnEvent(types.RemoteClose)
+	// recorded only once
+	conn.OnEvent(types.RemoteClose)
+
+	if got := sink.counts[sofarpc.CodecDecodeErrorsMetric+":boltv2:"+sofarpc.ReasonShortFrame]; got != 1 {
+		t.Errorf("expect 1 short frame decode error, got %d", got)
+	}
+	if got := sink.counts[sofarpc.CodecConnectionClosesMetric+":boltv2:"+sofarpc.ReasonShortFrame]; got != 1 {
+		t.Errorf("expect 1 connection close of short frame, got %d", got)
+	}
+
+	// a complete frame leaves nothing pending
+	conn.Dispatch(buffer.NewIoBufferBytes(frame))
+	conn.OnEvent(types.RemoteClose)
+	if got := sink.counts[sofarpc.CodecDecodeErrorsMetric+":boltv2:"+sofarpc.ReasonShortFrame]; got != 1 {
+		t.Errorf("expect no more short frame decode error, got %d", got)
+	}
+}
+
+func Test_ErrorResponseFollowsRequestFrame(t *testing.T) {
+	frame := newBoltV2Frame(t, 0, []byte("hello bolt v2"))
+	// protobuf codec
+	frame[10] = sofarpc.PROTOBUF_SERIALIZE
+
+	connection := &mockConnection{}
+	callbacks := &mockServerCallbacks{receiver: &mockReceiver{}}
+	conn := newStreamConnection(context.Background(), connection, nil, callbacks).(*streamConnection)
+	conn.Dispatch(buffer.NewIoBufferBytes(frame))
+
+	// no route, replied with headers built by mosn
+	callbacks.sender.AppendHeaders(map[string]string{types.HeaderStatus: strconv.Itoa(types.RouterUnavailableCode)}, true)
+
+	_, cmd := codec.BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(connection.bytes))
+	resp, ok := cmd.(*sofarpc.BoltV2ResponseCommand)
+	if !ok {
+		t.Fatalf("expect bolt v2 response, got %+v", cmd)
+	}
+	if resp.ResponseStatus != sofarpc.RESPONSE_STATUS_NO_PROCESSOR {
+		t.Errorf("expect status %d, but got %d", sofarpc.RESPONSE_STATUS_NO_PROCESSOR, resp.ResponseStatus)
+	}
+	if resp.ReqId != 1 || resp.CodecPro != sofarpc.PROTOBUF_SERIALIZE || resp.Version1 != 2 {
+		t.Errorf("response should follow the frame of request, got %+v", resp)
+	}
+}
+
+type contentSizeSink struct {
+	stats.MetricsSink
+	sizes map[string][]float64
+}
+
+func (s *contentSizeSink) Histogram(name string, value float64, tags stats.Tags) {
+	key := name + ":" + tags[stats.TagCluster] + ":" + tags[stats.TagDirection]
+	s.sizes[key] = append(s.sizes[key], value)
+}
+
+func (s *contentSizeSink) expect(t *testing.T, direction string, content, wire []float64) {
+	for name, expected := range map[string][]float64{
+		stats.ClusterContentSize:     content,
+		stats.ClusterWireContentSize: wire,
+	} {
+		got := s.sizes[name+":size_cluster:"+direction]
+		if len(got) != len(expected) {
+			t.Errorf("expect %s of %s %v, got %v", name, direction, expected, got)
+			continue
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("expect %s of %s %v, got %v", name, direction, expected, got)
+				break
+			}
+		}
+	}
+}
+
+func newBoltV2ResponseFrame(t *testing.T, reqId uint32, switchCode sofarpc.SwitchCode, content []byte) []byte {
+	err, buf := codec.BoltV2.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltV2ResponseCommand{
+		BoltResponseCommand: sofarpc.BoltResponseCommand{
+			Protocol:   sofarpc.PROTOCOL_CODE_V2,
+			CmdType:    sofarpc.RESPONSE,
+			CmdCode:    sofarpc.RPC_RESPONSE,
+			Version:    1,
+			ReqId:      reqId,
+			CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+			ContentLen: len(content),
+		},
+		Version1:   2,
+		SwitchCode: switchCode,
+	})
+	if err != nil {
+		t.Fatalf("encode bolt v2 response failed: %v", err)
+	}
+
+	return append(buf.Bytes(), content...)
+}
+
+func Test_ContentSizeMetrics(t *testing.T) {
+	sink := &contentSizeSink{sizes: make(map[string][]float64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	small := []byte("hello bolt v2")
+	large := bytes.Repeat([]byte("hello bolt v2 "), 1024)
+
+	clientContext := context.WithValue(context.Background(), types.ContextKeyUpstreamCluster, "size_cluster")
+	clientContext = context.WithValue(clientContext, types.ContextKeyBoltCompression, sofarpc.Compression{
+		Algorithm: sofarpc.SWITCH_GZIP_ON,
+		Threshold: 1024,
+	})
+	upstream := &mockConnection{}
+	clientConn := newStreamConnection(clientContext, upstream, nil, nil).(*streamConnection)
+
+	// the small request is not compressed, the large one is
+	var wireLens []float64
+	for i, content := range [][]byte{small, large} {
+		headers := newOnewayRequestHeaders()
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode)] = strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V2))
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.Itoa(int(sofarpc.REQUEST))
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderVersion1)] = "2"
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(len(content))
+
+		upstream.bytes = nil
+		sender := clientConn.NewStream(strconv.Itoa(i+1), &mockReceiver{})
+		sender.AppendHeaders(headers, false)
+		sender.AppendData(buffer.NewIoBufferBytes(content), true)
+
+		if len(upstream.bytes) < sofarpc.REQUEST_HEADER_LEN_V2 {
+			t.Fatalf("invalid request sent to upstream: %v", upstream.bytes)
+		}
+		// content length is the last field of the fixed header
+		wireLens = append(wireLens, float64(binary.BigEndian.Uint32(upstream.bytes[20:24])))
+	}
+	if wireLens[1] >= float64(len(large)) {
+		t.Fatalf("expect the large request compressed, got %v bytes on the wire", wireLens[1])
+	}
+	sink.expect(t, stats.DirectionRequest, []float64{float64(len(small)), float64(len(large))}, wireLens)
+
+	// responses of a compressed and an uncompressed content
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(large)
+	writer.Close()
+
+	for i, frame := range [][]byte{
+		newBoltV2ResponseFrame(t, 3, 0, small),
+		newBoltV2ResponseFrame(t, 4, sofarpc.SWITCH_GZIP_ON|sofarpc.SWITCH_COMPRESSED, compressed.Bytes()),
+	} {
+		receiver := &mockReceiver{}
+		clientConn.NewStream(strconv.Itoa(i+3), receiver)
+		clientConn.Dispatch(buffer.NewIoBufferBytes(frame))
+
+		if receiver.headers == nil {
+			t.Fatalf("response is not received by client stream")
+		}
+		if _, ok := receiver.headers[types.HeaderWireContentLen]; ok {
+			t.Errorf("wire content length header should not be forwarded")
+		}
+	}
+	sink.expect(t, stats.DirectionResponse, []float64{float64(len(small)), float64(len(large))},
+		[]float64{float64(len(small)), float64(compressed.Len())})
+
+	// not recorded for connections not to a cluster
+	serverConn := newStreamConnection(context.Background(), &mockConnection{}, nil,
+		&mockServerCallbacks{receiver: &mockReceiver{}}).(*streamConnection)
+	serverConn.recordContentSize(stats.DirectionRequest, 1, 1)
+	sink.expect(t, stats.DirectionRequest, []float64{float64(len(small)), float64(len(large))}, wireLens)
+}
+
+func isClosed(conn *mockConnection, wait time.Duration) bool {
+	select {
+	case <-conn.closed:
+		return true
+	case <-time.After(wait):
+	}
+
+	// the timer may fire at the same time with zero wait
+	select {
+	case <-conn.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func Test_SlowFrameReceiveTimeout(t *testing.T) {
+	codec.SetFrameLimits(v2.BoltFrameLimits{ReceiveTimeout: 100 * time.Millisecond})
+	defer codec.SetFrameLimits(v2.BoltFrameLimits{})
+
+	sink := &codecErrorSink{counts: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	frame := newBoltV2Frame(t, 0, []byte("hello bolt v2"))
+	downstream := &mockConnection{closed: make(chan struct{})}
+	conn := newStreamConnection(context.Background(), downstream, nil,
+		&mockServerCallbacks{receiver: &mockReceiver{}}).(*streamConnection)
+
+	// bytes dribbled slowly don't extend the timeout
+	buf := buffer.NewIoBuffer(len(frame))
+	for i := 0; i < 3; i++ {
+		buf.Write(frame[i : i+1])
+		conn.Dispatch(buf)
+		time.Sleep(40 * time.Millisecond)
+	}
+
+	if !isClosed(downstream, time.Second) {
+		t.Fatal("connection should be closed if the frame is not complete in time")
+	}
+	if got := sink.counts[sofarpc.CodecConnectionClosesMetric+":boltv2:"+sofarpc.ReasonSlowFrame]; got != 1 {
+		t.Errorf("expect 1 connection close of slow frame, got %d", got)
+	}
+}
+
+func Test_FrameReceivedInTime(t *testing.T) {
+	codec.SetFrameLimits(v2.BoltFrameLimits{ReceiveTimeout: 100 * time.Millisecond})
+	defer codec.SetFrameLimits(v2.BoltFrameLimits{})
+
+	frame := newBoltV2Frame(t, 0, []byte("hello bolt v2"))
+	receiver := &mockReceiver{}
+	downstream := &mockConnection{closed: make(chan struct{})}
+	conn := newStreamConnection(context.Background(), downstream, nil,
+		&mockServerCallbacks{receiver: receiver}).(*streamConnection)
+
+	// the first frame is complete with the head of the second one, the timeout starts
+	// over for the second frame, so the frames taking longer than the timeout in total are fine
+	half := len(frame) / 2
+	buf := buffer.NewIoBuffer(2 * len(frame))
+	buf.Write(frame[:half])
+	conn.Dispatch(buf)
+	time.Sleep(60 * time.Millisecond)
+
+	buf.Write(frame[half:])
+	buf.Write(frame[:half])
+	conn.Dispatch(buf)
+	if receiver.headers == nil {
+		t.Fatal("the first frame should be received")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	receiver.headers = nil
+	buf.Write(frame[half:])
+	conn.Dispatch(buf)
+	if receiver.headers == nil {
+		t.Fatal("the second frame should be received")
+	}
+
+	if isClosed(downstream, 200*time.Millisecond) {
+		t.Fatal("connection should not be closed if the frames are received in time")
+	}
+}
+
+func Test_PendingBytesOverflow(t *testing.T) {
+	codec.SetFrameLimits(v2.BoltFrameLimits{MaxPendingBytes: 16})
+	defer codec.SetFrameLimits(v2.BoltFrameLimits{})
+
+	sink := &codecErrorSink{counts: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	frame := newBoltV2Frame(t, 0, []byte("hello bolt v2"))
+	downstream := &mockConnection{closed: make(chan struct{})}
+	conn := newStreamConnection(context.Background(), downstream, nil,
+		&mockServerCallbacks{receiver: &mockReceiver{}}).(*streamConnection)
+
+	conn.Dispatch(buffer.NewIoBufferBytes(frame[:16]))
+	if isClosed(downstream, 0) {
+		t.Fatal("connection should not be closed within the pending bytes limit")
+	}
+
+	conn.Dispatch(buffer.NewIoBufferBytes(frame[:17]))
+	if !isClosed(downstream, 0) {
+		t.Fatal("connection should be closed if the incomplete frame exceeds the pending bytes limit")
+	}
+	if got := sink.counts[sofarpc.CodecConnectionClosesMetric+":boltv2:"+sofarpc.ReasonPendingOverflow]; got != 1 {
+		t.Errorf("expect 1 connection close of pending overflow, got %d", got)
+	}
+}
+
+// syncConnection collects the frames written by concurrent streams
+type syncConnection struct {
+	types.Connection
+	mux   sync.Mutex
+	bytes []byte
+}
+
+func (c *syncConnection) Write(buf ...types.IoBuffer) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, b := range buf {
+		c.bytes = append(c.bytes, b.Bytes()...)
+	}
+	return nil
+}
+
+func (c *syncConnection) SetReadDisable(disable bool) {}
+
+// responseReceiver notifies the caller once the response is received
+type responseReceiver struct {
+	headers map[string]string
+	data    types.IoBuffer
+	done    chan struct{}
+}
+
+func (r *responseReceiver) OnReceiveHeaders(headers map[string]string, endOfStream bool) {
+	r.headers = headers
+	if endOfStream {
+		close(r.done)
+	}
+}
+
+func (r *responseReceiver) OnReceiveData(data types.IoBuffer, endOfStream bool) {
+	r.data = data
+	close(r.done)
+}
+
+func (r *responseReceiver) OnReceiveTrailers(trailers map[string]string) {}
+
+func (r *responseReceiver) OnDecodeError(err error, headers map[string]string) {}
+
+type unmatchedSink struct {
+	stats.MetricsSink
+	mux   sync.Mutex
+	count map[string]int64
+}
+
+func (s *unmatchedSink) Count(name string, value int64, tags stats.Tags) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.count[name+":"+tags[stats.TagCluster]] += value
+}
+
+func (s *unmatchedSink) Histogram(name string, value float64, tags stats.Tags) {}
+
+func (s *unmatchedSink) get(name string) int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.count[name]
+}
+
+func newBoltV1ResponseFrame(t *testing.T, reqId uint32, content []byte) []byte {
+	err, buf := codec.BoltV1.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltResponseCommand{
+		Protocol:   sofarpc.PROTOCOL_CODE_V1,
+		CmdType:    sofarpc.RESPONSE,
+		CmdCode:    sofarpc.RPC_RESPONSE,
+		Version:    1,
+		ReqId:      reqId,
+		CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+		ContentLen: len(content),
+	})
+	if err != nil {
+		t.Fatalf("encode bolt v1 response failed: %v", err)
+	}
+
+	return append(buf.Bytes(), content...)
+}
+
+// many concurrent requests, some sharing the same request id, are sent over one upstream connection,
+// the responses are read in random order and chunks, and every response reaches its caller
+func Test_ConcurrentResponsesMatchedByRequestId(t *testing.T) {
+	sink := &unmatchedSink{count: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	connection := &syncConnection{}
+	clientContext := context.WithValue(context.Background(), types.ContextKeyUpstreamCluster, "stress_cluster")
+	conn := newStreamConnection(clientContext, connection, nil, nil).(*streamConnection)
+
+	callers := 1000
+	receivers := make([]*responseReceiver, callers)
+	reset := func(i int) bool { return i%10 == 0 }
+
+	var sent sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		receivers[i] = &responseReceiver{done: make(chan struct{})}
+		sent.Add(1)
+
+		go func(i int) {
+			defer sent.Done()
+
+			content := []byte("request of caller " + strconv.Itoa(i))
+			headers := newOnewayRequestHeaders()
+			headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.Itoa(int(sofarpc.REQUEST))
+			headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(len(content))
+
+			// downstream request ids collide, which are remapped on the upstream connection
+			sender := conn.NewStream(strconv.Itoa(i%100+1), receivers[i])
+			sender.AppendHeaders(headers, false)
+			sender.AppendData(buffer.NewIoBufferBytes(content), true)
+
+			// e.g. timeout before the response
+			if reset(i) {
+				sender.GetStream().ResetStream(types.StreamLocalReset)
+			}
+		}(i)
+	}
+	sent.Wait()
+
+	// the upstream echoes the content of each request
+	var responses [][]byte
+	requests := buffer.NewIoBufferBytes(connection.bytes)
+	for requests.Len() > 0 {
+		_, cmd := codec.BoltV1.GetDecoder().Decode(nil, requests)
+		request, ok := cmd.(*sofarpc.BoltRequestCommand)
+		if !ok {
+			t.Fatalf("expect bolt v1 request, got %+v", cmd)
+		}
+		responses = append(responses, newBoltV1ResponseFrame(t, request.ReqId, append([]byte("response to "), request.Content...)))
+	}
+	if len(responses) != callers {
+		t.Fatalf("expect %d requests sent, got %d", callers, len(responses))
+	}
+
+	// responses are read by one read buffer, which is reused as the real connection does
+	// responses of unknown request ids are dropped
+	unknown := 10
+	for i := 0; i < unknown; i++ {
+		responses = append(responses, newBoltV1ResponseFrame(t, uint32(100000+i), []byte("unknown")))
+	}
+
+	rand.Shuffle(len(responses), func(i, j int) { responses[i], responses[j] = responses[j], responses[i] })
+	var wire []byte
+	for _, response := range responses {
+		wire = append(wire, response...)
+	}
+
+	readBuffer := buffer.NewIoBuffer(1024)
+	for len(wire) > 0 {
+		n := rand.Intn(200) + 1
+		if n > len(wire) {
+			n = len(wire)
+		}
+		readBuffer.Write(wire[:n])
+		wire = wire[n:]
+		conn.Dispatch(readBuffer)
+	}
+
+	for i, receiver := range receivers {
+		if reset(i) {
+			select {
+			case <-receiver.done:
+				t.Errorf("response of reset caller %d should be dropped", i)
+			default:
+			}
+			continue
+		}
+
+		select {
+		case <-receiver.done:
+		case <-time.After(time.Second):
+			t.Fatalf("caller %d got no response", i)
+		}
+
+		if id := receiver.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)]; id != strconv.Itoa(i%100+1) {
+			t.Errorf("caller %d expect its request id %d restored, got %s", i, i%100+1, id)
+		}
+		if expected := "response to request of caller " + strconv.Itoa(i); receiver.data == nil || receiver.data.String() != expected {
+			t.Errorf("caller %d expect %q, got %v", i, expected, receiver.data)
+		}
+	}
+
+	// late responses of the reset requests are not errors
+	if got := sink.get(stats.ClusterUnmatchedResponses + ":stress_cluster"); got != int64(unknown) {
+		t.Errorf("expect %d unmatched responses recorded, got %d", unknown, got)
+	}
+	if conn.activeStreams.Len() != 0 || len(conn.activeStreams.reset) != 0 {
+		t.Errorf("no pending or reset request should remain, got %d, %d", conn.activeStreams.Len(), len(conn.activeStreams.reset))
+	}
+}
+
+// a response is never delivered to a server stream with the same id
+func Test_ResponseNotMatchedToServerStream(t *testing.T) {
+	sink := &unmatchedSink{count: make(map[string]int64)}
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	receiver := &mockReceiver{}
+	conn := newStreamConnection(context.Background(), &mockConnection{}, nil,
+		&mockServerCallbacks{receiver: receiver}).(*streamConnection)
+
+	request := newOnewayRequestHeaders()
+	request[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.Itoa(int(sofarpc.REQUEST))
+	request[types.HeaderStremEnd] = "yes"
+	conn.OnDecodeHeader("1", request)
+	if receiver.headers == nil || !conn.activeStreams.Has("1") {
+		t.Fatalf("request should be delivered to the server stream")
+	}
+
+	receiver.headers = nil
+	if status := conn.OnDecodeHeader("1", newResponseHeaders("1")); status != types.StopIteration {
+		t.Errorf("data of unmatched response should be dropped")
+	}
+	if receiver.headers != nil {
+		t.Errorf("response should not be delivered to the server stream, got %v", receiver.headers)
+	}
+	if got := sink.get(stats.ClusterUnmatchedResponses + ":"); got != 1 {
+		t.Errorf("expect 1 unmatched response recorded, got %d", got)
+	}
+}
+
+func forceCrcContext() context.Context {
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltForceCrc, true)
+	return context.WithValue(ctx, types.ContextKeyBoltSwitch, sofarpc.SWITCH_CRC_ON)
+}
+
+func newBoltV2CrcResponseFrame(t *testing.T, reqId uint32, content []byte) []byte {
+	err, buf := codec.BoltV2.GetEncoder().EncodeHeaders(nil, &sofarpc.BoltV2ResponseCommand{
+		BoltResponseCommand: sofarpc.BoltResponseCommand{
+			Protocol:   sofarpc.PROTOCOL_CODE_V2,
+			CmdType:    sofarpc.RESPONSE,
+			CmdCode:    sofarpc.RPC_RESPONSE,
+			Version:    1,
+			ReqId:      reqId,
+			CodecPro:   sofarpc.HESSIAN_SERIALIZE,
+			ContentLen: len(content),
+			Content:    content,
+		},
+		Version1:   2,
+		SwitchCode: sofarpc.SWITCH_CRC_ON,
+	})
+	if err != nil {
+		t.Fatalf("encode bolt v2 response failed: %v", err)
+	}
+
+	// content and crc32 are encoded with the headers
+	return buf.Bytes()
+}
+
+func Test_ForceCrcUpgradesBoltV1(t *testing.T) {
+	content := []byte("hello bolt v1")
+
+	// bolt v1 request from downstream
+	headers := newOnewayRequestHeaders()
+	headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.Itoa(int(sofarpc.REQUEST))
+	headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderContentLen)] = strconv.Itoa(len(content))
+	_, buf := codec.BoltV1.GetEncoder().EncodeHeaders(nil, headers)
+
+	downstream := &mockConnection{}
+	receiver := &mockReceiver{}
+	callbacks := &mockServerCallbacks{receiver: receiver}
+	serverConn := newStreamConnection(context.Background(), downstream, nil, callbacks).(*streamConnection)
+	serverConn.Dispatch(buffer.NewIoBufferBytes(append(buf.Bytes(), content...)))
+	if receiver.headers == nil || receiver.data == nil {
+		t.Fatalf("request is not received by server stream")
+	}
+
+	// sent to the cluster forcing crc in bolt v2 with crc32
+	upstream := &mockConnection{}
+	clientConn := newStreamConnection(forceCrcContext(), upstream, nil, nil).(*streamConnection)
+	responseReceiver := &mockReceiver{}
+	sender := clientConn.NewStream("1", responseReceiver)
+	sender.AppendHeaders(receiver.headers, false)
+	sender.AppendData(receiver.data, true)
+
+	if len(upstream.bytes) < sofarpc.REQUEST_HEADER_LEN_V2 || upstream.bytes[0] != sofarpc.PROTOCOL_CODE_V2 ||
+		upstream.bytes[1] != sofarpc.PROTOCOL_VERSION_2 || !sofarpc.SwitchCode(upstream.bytes[11]).Has(sofarpc.SWITCH_CRC_ON) {
+		t.Fatalf("expect bolt v2 request with crc32 sent to upstream, got %v", upstream.bytes)
+	}
+	read, cmd := codec.BoltV2.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(upstream.bytes))
+	request, ok := cmd.(*sofarpc.BoltV2RequestCommand)
+	if !ok || read != len(upstream.bytes) || !bytes.Equal(request.Content, content) {
+		t.Fatalf("unexpected request sent to upstream: %+v, read %d of %d bytes", cmd, read, len(upstream.bytes))
+	}
+	if v := receiver.headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderProtocolCode)]; v != strconv.Itoa(int(sofarpc.PROTOCOL_CODE_V1)) {
+		t.Errorf("headers of downstream request should not be changed, got protocol %s", v)
+	}
+
+	// the response with crc32 is replied to downstream in bolt v1
+	clientConn.Dispatch(buffer.NewIoBufferBytes(newBoltV2CrcResponseFrame(t, 1, content)))
+	if responseReceiver.headers == nil || responseReceiver.data == nil {
+		t.Fatalf("response is not received by client stream")
+	}
+	callbacks.sender.AppendHeaders(responseReceiver.headers, false)
+	callbacks.sender.AppendData(responseReceiver.data, true)
+
+	read, cmd = codec.BoltV1.GetDecoder().Decode(nil, buffer.NewIoBufferBytes(downstream.bytes))
+	response, ok := cmd.(*sofarpc.BoltResponseCommand)
+	if !ok || read != len(downstream.bytes) || response.ReqId != 1 || !bytes.Equal(response.Content, content) {
+		t.Errorf("expect bolt v1 response replied to downstream, got %+v, read %d of %d bytes", cmd, read, len(downstream.bytes))
+	}
+}
+
+func Test_ForceCrcRejectsResponse(t *testing.T) {
+	content := []byte("hello bolt")
+	badCrc := newBoltV2CrcResponseFrame(t, 1, content)
+	badCrc[len(badCrc)-1]++
+
+	for name, frame := range map[string][]byte{
+		"bolt v2 without crc32": newBoltV2ResponseFrame(t, 1, 0, content),
+		"bolt v1":               newBoltV1ResponseFrame(t, 1, content),
+		"invalid crc32":         badCrc,
+	} {
+		upstream := &mockConnection{closed: make(chan struct{})}
+		conn := newStreamConnection(forceCrcContext(), upstream, nil, nil).(*streamConnection)
+		receiver := &mockReceiver{}
+		conn.NewStream("1", receiver)
+		conn.Dispatch(buffer.NewIoBufferBytes(frame))
+
+		if receiver.headers != nil {
+			t.Errorf("%s: response should not be received", name)
+		}
+		if !isClosed(upstream, 0) {
+			t.Errorf("%s: connection should be closed", name)
+		}
+	}
+}
+
+// the response exceeding the limits of cluster is skipped as it is read, and only its request fails
+func Test_ResponseTooLarge(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.ContextKeyBoltResponseLimits, v2.ResponseLimits{MaxContentLen: 16})
+	upstream := &mockConnection{closed: make(chan struct{})}
+	conn := newStreamConnection(ctx, upstream, nil, nil).(*streamConnection)
+
+	tooLarge := &mockReceiver{}
+	conn.NewStream("1", tooLarge)
+	normal := &mockReceiver{}
+	conn.NewStream("2", normal)
+
+	frame := newBoltV1ResponseFrame(t, 1, make([]byte, 64))
+	next := newBoltV1ResponseFrame(t, 2, []byte("hello bolt"))
+
+	// the body of the large response is received in pieces, followed by the normal response
+	buf := buffer.NewIoBuffer(1024)
+	buf.Write(frame[:sofarpc.RESPONSE_HEADER_LEN_V1+8])
+	conn.Dispatch(buf)
+	buf.Write(frame[sofarpc.RESPONSE_HEADER_LEN_V1+8 : len(frame)-8])
+	conn.Dispatch(buf)
+	buf.Write(append(frame[len(frame)-8:], next...))
+	conn.Dispatch(buf)
+
+	if _, ok := tooLarge.err.(*sofarpc.ResponseTooLargeError); !ok || tooLarge.headers != nil {
+		t.Errorf("expect the large response rejected, got headers %v, error %v", tooLarge.headers, tooLarge.err)
+	}
+	if normal.headers == nil || normal.data == nil || normal.data.String() != "hello bolt" {
+		t.Errorf("expect the following response received, got %v", normal.headers)
+	}
+	if isClosed(upstream, 0) {
+		t.Errorf("connection should not be closed")
+	}
+	if buf.Len() != 0 || conn.activeStreams.Has("1") || conn.activeStreams.Has("2") {
+		t.Errorf("expect both responses consumed, %d bytes left", buf.Len())
+	}
+}
+
+// heartbeatConnection collects the frames written by streams and the heartbeat trigger
+type heartbeatConnection struct {
+	syncConnection
+}
+
+func (c *heartbeatConnection) AddConnectionEventListener(cb types.ConnectionEventListener) {}
+
+func (c *heartbeatConnection) Close(ccType types.ConnectionCloseType, eventType types.ConnectionEvent) error {
+	return nil
+}
+
+func (c *heartbeatConnection) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12200}
+}
+
+// heartbeats returns the number of heartbeats written
+func (c *heartbeatConnection) heartbeats(t *testing.T) int {
+	c.mux.Lock()
+	frames := buffer.NewIoBufferBytes(append([]byte(nil), c.bytes...))
+	c.mux.Unlock()
+
+	heartbeats := 0
+	for frames.Len() > 0 {
+		_, cmd := codec.BoltV1.GetDecoder().Decode(nil, frames)
+		request, ok := cmd.(*sofarpc.BoltRequestCommand)
+		if !ok {
+			t.Fatalf("expect bolt v1 request, got %+v", cmd)
+		}
+		if request.CmdCode == sofarpc.HEARTBEAT {
+			heartbeats++
+		}
+	}
+
+	return heartbeats
+}
+
+// requests and responses on the connection postpone the heartbeats
+func Test_NoHeartbeatOnBusyConnection(t *testing.T) {
+	connection := &heartbeatConnection{}
+	clientContext := context.WithValue(context.Background(), types.ContextKeyBoltHeartbeatInterval, 50*time.Millisecond)
+	conn := newStreamConnection(clientContext, connection, nil, nil).(*streamConnection)
+
+	for i := 1; i <= 40; i++ {
+		headers := newOnewayRequestHeaders()
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderCmdType)] = strconv.Itoa(int(sofarpc.REQUEST))
+		headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = strconv.Itoa(i)
+		conn.NewStream(strconv.Itoa(i), &responseReceiver{done: make(chan struct{})}).AppendHeaders(headers, true)
+
+		time.Sleep(5 * time.Millisecond)
+		conn.Dispatch(buffer.NewIoBufferBytes(newBoltV1ResponseFrame(t, uint32(i), nil)))
+	}
+	defer conn.heartbeatTrigger.Load().(sofarpc.HeartbeatTrigger).Stop()
+
+	if heartbeats := connection.heartbeats(t); heartbeats != 0 {
+		t.Fatalf("expect no heartbeat sent on busy connection, got %d", heartbeats)
+	}
+
+	// heartbeats are sent once the connection is idle
+	time.Sleep(100 * time.Millisecond)
+	if heartbeats := connection.heartbeats(t); heartbeats == 0 {
+		t.Errorf("expect heartbeats sent on idle connection")
+	}
+}
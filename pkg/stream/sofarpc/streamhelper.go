@@ -28,6 +28,11 @@ func (s *stream) encodeSterilize(headers interface{}) interface{} {
 	if headerMaps, ok := headers.(map[string]string); ok {
 		if s.direction == ServerStream {
 			headerMaps[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = s.requestId
+			// the response follows the frame of request, which may be upgraded by the cluster forcing crc
+			sofarpc.DowngradeToRequestFrame(headerMaps, s.requestFrame)
+		} else {
+			// request id may be remapped on the upstream connection
+			headerMaps[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)] = s.streamId
 		}
 
 		// remove proxy header before codec encode
@@ -36,6 +41,11 @@ func (s *stream) encodeSterilize(headers interface{}) interface{} {
 		delete(headerMaps, types.HeaderTryTimeout)
 		
 		delete(headerMaps, types.HeaderStremEnd)
+		delete(headerMaps, types.HeaderOneway)
+		delete(headerMaps, types.HeaderPeerIdentity)
+		delete(headerMaps, types.HeaderSourceIP)
+		delete(headerMaps, types.HeaderCompression)
+		delete(headerMaps, types.HeaderWireContentLen)
 
 		if status, ok := headerMaps[types.HeaderStatus]; ok {
 			delete(headerMaps, types.HeaderStatus)
@@ -45,24 +55,15 @@ func (s *stream) encodeSterilize(headers interface{}) interface{} {
 				var err error
 				var respHeaders interface{}
 
-				//Build Router Unavailable Response Msg
-				switch statusCode {
-				case types.RouterUnavailableCode, types.NoHealthUpstreamCode, types.UpstreamOverFlowCode:
-					//No available path
-					respHeaders, err = sofarpc.BuildSofaRespMsg(s.context, headerMaps, sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR)
-				case types.CodecExceptionCode:
-					//Decode or Encode Error
-					respHeaders, err = sofarpc.BuildSofaRespMsg(s.context, headerMaps, sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION)
-				case types.DeserialExceptionCode:
-					//Hessian Exception
-					respHeaders, err = sofarpc.BuildSofaRespMsg(s.context, headerMaps, sofarpc.RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION)
-				case types.TimeoutExceptionCode:
-					//Response Timeout
-					respHeaders, err = sofarpc.BuildSofaRespMsg(s.context, headerMaps, sofarpc.RESPONSE_STATUS_TIMEOUT)
-				default:
-					respHeaders, err = sofarpc.BuildSofaRespMsg(s.context, headerMaps, sofarpc.RESPONSE_STATUS_UNKNOWN)
+				// headers may be built by mosn without the frame of request, e.g. on decode error
+				for k, v := range s.requestFrame {
+					if _, ok := headerMaps[k]; !ok {
+						headerMaps[k] = v
+					}
 				}
 
+				respHeaders, err = sofarpc.BuildErrorResponse(s.context, headerMaps, statusCode)
+
 				if err == nil {
 					headers = respHeaders
 				} else {
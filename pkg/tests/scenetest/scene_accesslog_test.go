@@ -0,0 +1,111 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//an access log record is written for each proxied bolt request
+func TestAccessLog(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	dir, err := ioutil.TempDir("", "mosn_accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "access.log")
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].AccessLogs = []config.AccessLogConfig{
+		{
+			LogPath:   logPath,
+			LogFormat: "%DownstreamRemoteAddress%|%REQ.classname%|%UpstreamHostSelected%|%ResponseCode%|%Duration%",
+		},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	id := GetStreamId()
+	request := buildBoltV1Request(id)
+	request.ClassName, _ = serialize.Instance.Serialize("com.alipay.test.TestService")
+	request.ClassLen = int16(len(request.ClassName))
+	receiver := &statusReceiver{status: make(chan int16, 1)}
+	client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver).AppendHeaders(request, true)
+	if s := waitStatus(t, receiver.status, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	time.Sleep(100 * time.Millisecond) //wait streams cleaned
+
+	b, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read access log error: %v\n", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expect one access log record, but got: %s\n", b)
+	}
+	//the record is prefixed by the time of the logger
+	fields := strings.Split(lines[0], "|")
+	if len(fields) != 5 {
+		t.Fatalf("unexpected access log record: %s\n", lines[0])
+	}
+	remote := fields[0][strings.LastIndex(fields[0], " ")+1:]
+	if host, port, err := net.SplitHostPort(remote); err != nil || host != "127.0.0.1" || port == "2045" {
+		t.Errorf("unexpected downstream remote address: %s\n", remote)
+	}
+	if fields[1] != "com.alipay.test.TestService" {
+		t.Errorf("unexpected class name: %s\n", fields[1])
+	}
+	if fields[2] != sofaAddr {
+		t.Errorf("upstream host expect %s, but got %s\n", sofaAddr, fields[2])
+	}
+	if fields[3] != "0" {
+		t.Errorf("response code expect 0, but got %s\n", fields[3])
+	}
+	if _, err := time.ParseDuration(fields[4]); err != nil {
+		t.Errorf("unexpected latency: %s\n", fields[4])
+	}
+}
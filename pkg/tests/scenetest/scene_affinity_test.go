@@ -0,0 +1,130 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	clusterAdapter "github.com/alipay/sofamosn/pkg/upstream/cluster"
+	"github.com/orcaman/concurrent-map"
+)
+
+const affinityHeader = "x-mosn-affinity"
+
+//sends a request with the affinity token, returns the address of the host received it and the response headers
+func sendAffinityRequest(t *testing.T, client *BoltV1Client, token string, received map[string]chan map[string]string) (string, map[string]string) {
+	id := GetStreamId()
+	request := buildBoltV1Request(id)
+	headers := map[string]string{"service": "testSofa"}
+	if token != "" {
+		headers[affinityHeader] = token
+	}
+	headerBytes, _ := serialize.Instance.Serialize(headers)
+	request.HeaderMap = headerBytes
+	request.HeaderLen = int16(len(headerBytes))
+	receiver := &headersReceiver{headers: make(chan map[string]string, 1)}
+	client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver).AppendHeaders(request, true)
+
+	respHeaders := waitHeaders(t, receiver.headers, 3*time.Second)
+	for addr, ch := range received {
+		select {
+		case <-ch:
+			return addr, respHeaders
+		default:
+		}
+	}
+	t.Fatalf("request %d is not received by any host\n", id)
+	return "", nil
+}
+
+//requests carrying the affinity token are pinned to the host, and pinned again if the host is removed
+func TestSessionAffinity(t *testing.T) {
+	sofaAddr1 := "127.0.0.1:8080"
+	sofaAddr2 := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	received := map[string]chan map[string]string{
+		sofaAddr1: make(chan map[string]string, 10),
+		sofaAddr2: make(chan map[string]string, 10),
+	}
+	server1 := NewUpstreamServer(t, sofaAddr1, ServeBoltV1RecordHeaders(received[sofaAddr1]))
+	server1.GoServe()
+	defer server1.Close()
+	server2 := NewUpstreamServer(t, sofaAddr2, ServeBoltV1RecordHeaders(received[sofaAddr2]))
+	server2.GoServe()
+	defer server2.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr1, sofaAddr2}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.ClusterManager.Clusters[0].SessionAffinity = v2.SessionAffinityConfig{Header: affinityHeader, Secret: "secret"}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//the first request is pinned to the selected host
+	pinned, respHeaders := sendAffinityRequest(t, client, "", received)
+	token := respHeaders[affinityHeader]
+	if token != types.AffinityToken("secret", pinned) {
+		t.Fatalf("response expect affinity token of %s, but got %s\n", pinned, token)
+	}
+	for i := 0; i < 4; i++ {
+		if addr, _ := sendAffinityRequest(t, client, token, received); addr != pinned {
+			t.Fatalf("request expect pinned to %s, but received by %s\n", pinned, addr)
+		}
+	}
+
+	//the pinned host is removed, requests fall back to the other host and are pinned again
+	other := sofaAddr1
+	if pinned == sofaAddr1 {
+		other = sofaAddr2
+	}
+	if err := clusterAdapter.ClusterAdap.TriggerClusterUpdate("testCluster", []v2.Host{{Address: other, Weight: 100}}); err != nil {
+		t.Fatalf("update cluster hosts failed: %v\n", err)
+	}
+	addr, respHeaders := sendAffinityRequest(t, client, token, received)
+	if addr != other {
+		t.Fatalf("request expect fall back to %s, but received by %s\n", other, addr)
+	}
+	newToken := respHeaders[affinityHeader]
+	if newToken != types.AffinityToken("secret", other) {
+		t.Fatalf("response expect affinity token of %s, but got %s\n", other, newToken)
+	}
+
+	//the new pin is kept after the removed host comes back
+	if err := clusterAdapter.ClusterAdap.TriggerClusterUpdate("testCluster", []v2.Host{{Address: sofaAddr1, Weight: 100}, {Address: sofaAddr2, Weight: 100}}); err != nil {
+		t.Fatalf("update cluster hosts failed: %v\n", err)
+	}
+	for i := 0; i < 4; i++ {
+		if addr, _ := sendAffinityRequest(t, client, newToken, received); addr != other {
+			t.Fatalf("request expect pinned to %s, but received by %s\n", other, addr)
+		}
+	}
+}
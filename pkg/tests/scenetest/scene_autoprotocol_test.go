@@ -0,0 +1,126 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+)
+
+//writes data in two parts, so that protocol is detected on a partial request
+func writeSplit(t *testing.T, conn net.Conn, data []byte, at int) {
+	if _, err := conn.Write(data[:at]); err != nil {
+		t.Fatalf("write request failed: %v\n", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := conn.Write(data[at:]); err != nil {
+		t.Fatalf("write request failed: %v\n", err)
+	}
+}
+
+//http1 requests and bolt requests on the same listener are dispatched to their own codecs
+func TestAutoProtocol(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	requests := make(chan *boltRequest, 2)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1Echo(requests))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.Auto, protocol.SofaRpc)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	//http1 request, converted to bolt request for sofarpc upstream
+	httpConn, err := net.Dial("tcp", meshAddr)
+	if err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer httpConn.Close()
+	httpConn.SetDeadline(time.Now().Add(5 * time.Second))
+	httpReq := "POST /com.alipay.test.TestService/echo HTTP/1.1\r\n" +
+		"Host: " + meshAddr + "\r\n" +
+		"Service: com.alipay.test.TestService\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello"
+	//the first bytes are a prefix of http method, not enough to tell the protocol
+	writeSplit(t, httpConn, []byte(httpReq), 2)
+	resp, err := http.ReadResponse(bufio.NewReader(httpConn), nil)
+	if err != nil {
+		t.Fatalf("read http response failed: %v\n", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expect http status %d, but got %d\n", http.StatusOK, resp.StatusCode)
+	}
+	if string(body) != "echo:hello" {
+		t.Errorf("unexpected http response body: %s\n", body)
+	}
+	select {
+	case req := <-requests:
+		if req.className != "com.alipay.test.TestService" {
+			t.Errorf("unexpected bolt class name of http request: %s\n", req.className)
+		}
+		if req.content != "hello" {
+			t.Errorf("unexpected bolt content of http request: %s\n", req.content)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("upstream receives no request converted from http\n")
+	}
+
+	//bolt request, forwarded as it is
+	boltConn, err := net.Dial("tcp", meshAddr)
+	if err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer boltConn.Close()
+	boltConn.SetDeadline(time.Now().Add(5 * time.Second))
+	boltReq := buildBoltV1Request(GetStreamId())
+	err, iobuf := codec.BoltV1.GetEncoder().EncodeHeaders(nil, boltReq)
+	if err != nil {
+		t.Fatalf("encode bolt request failed: %v\n", err)
+	}
+	//the protocol is told by the first byte, which is still decoded by bolt codec
+	writeSplit(t, boltConn, iobuf.Bytes(), 1)
+	boltResp := readBoltV1Response(t, boltConn)
+	if boltResp.ReqId != boltReq.ReqId {
+		t.Errorf("expect bolt response of request %d, but got %d\n", boltReq.ReqId, boltResp.ReqId)
+	}
+	if boltResp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("expect bolt response status %d, but got %d\n", sofarpc.RESPONSE_STATUS_SUCCESS, boltResp.ResponseStatus)
+	}
+	select {
+	case req := <-requests:
+		if req.headers["service"] != "testSofa" {
+			t.Errorf("unexpected bolt headers: %v\n", req.headers)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("upstream receives no bolt request\n")
+	}
+}
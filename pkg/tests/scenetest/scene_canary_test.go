@@ -0,0 +1,147 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+func versionMetadata(version string) v2.Metadata {
+	return v2.Metadata{
+		types.RouterMatadataKey: map[string]interface{}{
+			types.RouterMetadataKeyLb: map[string]interface{}{"version": version},
+		},
+	}
+}
+
+//canary mesh config, stable and canary hosts are subsets of one cluster tagged by version
+//requests with canary header are routed to canary subset, the others are split by weight
+func CreateCanaryMeshConfig(addr string, stableHost, canaryHost string, canaryWeight uint32) *config.MOSNConfig {
+	clusterName := "testCluster"
+	cmconfig := config.ClusterManagerConfig{
+		Clusters: []config.ClusterConfig{
+			config.ClusterConfig{
+				Name:                 clusterName,
+				Type:                 "SIMPLE",
+				LbType:               "LB_ROUNDROBIN",
+				MaxRequestPerConn:    1024,
+				ConnBufferLimitBytes: 16 * 1026,
+				Hosts: []v2.Host{
+					{Address: stableHost, Weight: 100, MetaData: v2.Metadata{"version": "stable"}},
+					{Address: canaryHost, Weight: 100, MetaData: v2.Metadata{"version": "canary"}},
+				},
+				LBSubsetConfig: v2.LBSubsetConfig{SubsetSelectors: [][]string{{"version"}}},
+			},
+		},
+	}
+	canaryRouter := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{
+			{Name: "service", Value: ".*"},
+			{Name: "canary", Value: "true"},
+		}},
+		Route: v2.RouteAction{ClusterName: clusterName, MetadataMatch: versionMetadata("canary")},
+	}
+	weightedRouter := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{{Name: "service", Value: ".*"}}},
+		Route: v2.RouteAction{
+			WeightedClusters: []v2.WeightedCluster{
+				{Clusters: v2.ClusterWeight{Name: clusterName, Weight: 100 - canaryWeight, MetadataMatch: versionMetadata("stable")}},
+				{Clusters: v2.ClusterWeight{Name: clusterName, Weight: canaryWeight, MetadataMatch: versionMetadata("canary")}},
+			},
+		},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{canaryRouter, weightedRouter}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//requests with canary header are forced to canary hosts, and the others are split by weight
+func TestCanary(t *testing.T) {
+	stableAddr := "127.0.0.1:8080"
+	canaryAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	stableHeaders := make(chan map[string]string, 1000)
+	stable := NewUpstreamServer(t, stableAddr, ServeBoltV1RecordHeaders(stableHeaders))
+	stable.GoServe()
+	defer stable.Close()
+	canaryHeaders := make(chan map[string]string, 1000)
+	canary := NewUpstreamServer(t, canaryAddr, ServeBoltV1RecordHeaders(canaryHeaders))
+	canary.GoServe()
+	defer canary.Close()
+	mesh := mosn.NewMosn(CreateCanaryMeshConfig(meshAddr, stableAddr, canaryAddr, 20))
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	for i := 0; i < 20; i++ {
+		if s := waitStatus(t, sendRequestWithHeaders(client, map[string]string{"service": "testSofa", "canary": "true"}), 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success, but got %d\n", s)
+		}
+	}
+	if n := len(stableHeaders); n != 0 {
+		t.Errorf("requests with canary header should not be routed to stable host, got %d\n", n)
+	}
+	if n := len(canaryHeaders); n != 20 {
+		t.Errorf("requests with canary header should be routed to canary host, expect 20, got %d\n", n)
+	}
+	for len(canaryHeaders) > 0 {
+		<-canaryHeaders
+	}
+
+	total := 500
+	for i := 0; i < total; i++ {
+		if s := waitStatus(t, sendRequestWithHeaders(client, map[string]string{"service": "testSofa"}), 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success, but got %d\n", s)
+		}
+	}
+	//20% expected, with a loose bound for randomness
+	if n := len(canaryHeaders); n < total*10/100 || n > total*30/100 || n+len(stableHeaders) != total {
+		t.Errorf("expect about 20%% of %d requests routed to canary host, got canary %d, stable %d\n", total, n, len(stableHeaders))
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//types.StreamReceiver, records response status of a request
+type statusReceiver struct {
+	status chan int16
+}
+
+func (r *statusReceiver) OnReceiveHeaders(headers map[string]string, endStream bool) {
+	status, _ := strconv.Atoi(headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)])
+	r.status <- int16(status)
+}
+func (r *statusReceiver) OnReceiveData(data types.IoBuffer, endStream bool) {}
+func (r *statusReceiver) OnReceiveTrailers(trailers map[string]string)     {}
+func (r *statusReceiver) OnDecodeError(err error, headers map[string]string) {}
+
+func sendRequestWithStatus(client *BoltV1Client) chan int16 {
+	id := GetStreamId()
+	receiver := &statusReceiver{status: make(chan int16, 1)}
+	requestEncoder := client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver)
+	requestEncoder.AppendHeaders(buildBoltV1Request(id), true)
+	return receiver.status
+}
+
+func waitStatus(t *testing.T, status chan int16, timeout time.Duration) int16 {
+	select {
+	case s := <-status:
+		return s
+	case <-time.After(timeout):
+		t.Fatalf("wait response timeout\n")
+	}
+	return -1
+}
+
+//requests exceed max_requests of cluster fail fast, and the breaker closes after requests complete
+func TestCircuitBreakerMaxRequests(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithDelay(time.Second))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.ClusterManager.Clusters[0].CircuitBreakers = []*config.CircuitBreakerdConfig{
+		&config.CircuitBreakerdConfig{Priority: "default", MaxRequests: 1},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+	first := sendRequestWithStatus(client)
+	time.Sleep(200 * time.Millisecond) //first request in flight
+	//breaker is open, fail fast without waiting for the upstream
+	if status := waitStatus(t, sendRequestWithStatus(client), 500*time.Millisecond); status != sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR {
+		t.Errorf("request exceeds max requests expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR, status)
+	}
+	if status := waitStatus(t, first, 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request in flight expect success, but got %d\n", status)
+	}
+	//first request completed, breaker closed
+	if status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request after breaker closed expect success, but got %d\n", status)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+	"golang.org/x/net/http2"
+)
+
+// http2 request received by upstream server
+type http2Request struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+// Http2 Serve, records requests and echoes the body, responses service unavailable if body is "busy"
+type http2EchoServer struct {
+	requests chan *http2Request
+}
+
+func (s *http2EchoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.requests <- &http2Request{method: r.Method, path: r.URL.Path, header: r.Header, body: string(body)}
+	w.Header().Set("app", r.Header.Get("app"))
+	if string(body) == "busy" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintf(w, "http2:%s", body)
+}
+
+// types.StreamReceiver, records response headers and content of a request
+type responseReceiver struct {
+	headers chan map[string]string
+	content chan string
+}
+
+func (r *responseReceiver) OnReceiveHeaders(headers map[string]string, endStream bool) {
+	r.headers <- headers
+	if endStream {
+		r.content <- ""
+	}
+}
+func (r *responseReceiver) OnReceiveData(data types.IoBuffer, endStream bool) {
+	r.content <- data.String()
+}
+func (r *responseReceiver) OnReceiveTrailers(trailers map[string]string)       {}
+func (r *responseReceiver) OnDecodeError(err error, headers map[string]string) {}
+
+func CreateClusterProtocolMeshConfig(addr string, http2Hosts, boltHosts []string) *config.MOSNConfig {
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: "http2Cluster", hosts: http2Hosts},
+		cluster{name: "boltCluster", hosts: boltHosts},
+	})
+	cmconfig.Clusters[0].UpstreamProtocol = string(protocol.Http2)
+	routers := []v2.Router{
+		v2.Router{
+			Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{v2.HeaderMatcher{Name: "service", Value: "http2Service"}}},
+			Route: v2.RouteAction{ClusterName: "http2Cluster"},
+		},
+		v2.Router{
+			Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{v2.HeaderMatcher{Name: "service", Value: "boltService"}}},
+			Route: v2.RouteAction{ClusterName: "boltCluster"},
+		},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: routers},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+// bolt requests to the cluster declaring http2 are converted to http2, the other cluster still receives bolt
+func TestClusterUpstreamProtocol(t *testing.T) {
+	http2Addr := "127.0.0.1:8080"
+	sofaAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	http2Requests := make(chan *http2Request, 1)
+	h2 := &http2EchoServer{requests: http2Requests}
+	http2Server := NewUpstreamServer(t, http2Addr, func(t *testing.T, conn net.Conn) {
+		(&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: h2})
+	})
+	http2Server.GoServe()
+	defer http2Server.Close()
+	boltRequests := make(chan *boltRequest, 1)
+	boltServer := NewUpstreamServer(t, sofaAddr, ServeBoltV1Echo(boltRequests))
+	boltServer.GoServe()
+	defer boltServer.Close()
+	mesh_config := CreateClusterProtocolMeshConfig(meshAddr, []string{http2Addr}, []string{sofaAddr})
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+	className := "com.alipay.test.TestService"
+	doRequest := func(service, content string) (map[string]string, string) {
+		id := GetStreamId()
+		request := buildBoltV1Request(id)
+		headerBytes, _ := serialize.Instance.Serialize(map[string]string{"service": service, "app": "testapp"})
+		request.HeaderMap = headerBytes
+		request.HeaderLen = int16(len(headerBytes))
+		request.ClassName = []byte(className)
+		request.ClassLen = int16(len(className))
+		request.ContentLen = len(content)
+		receiver := &responseReceiver{headers: make(chan map[string]string, 1), content: make(chan string, 1)}
+		requestEncoder := client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver)
+		requestEncoder.AppendHeaders(request, false)
+		requestEncoder.AppendData(buffer.NewIoBufferString(content), true)
+		headers := waitHeaders(t, receiver.headers, 3*time.Second)
+		select {
+		case data := <-receiver.content:
+			return headers, data
+		case <-time.After(3 * time.Second):
+			t.Fatalf("wait response content timeout\n")
+		}
+		return nil, ""
+	}
+
+	//converted to http2 request
+	headers, content := doRequest("http2Service", "hello")
+	select {
+	case req := <-http2Requests:
+		if req.method != http.MethodPost || req.path != "/"+className {
+			t.Errorf("unexpected http2 request %s %s\n", req.method, req.path)
+		}
+		if req.body != "hello" {
+			t.Errorf("unexpected http2 request body: %s\n", req.body)
+		}
+		if req.header.Get("app") != "testapp" {
+			t.Errorf("bolt header not found in http2 request: %v\n", req.header)
+		}
+		if req.header.Get(sofarpc.HeaderCmdCode) != "" || req.header.Get(sofarpc.HeaderClassName) != "" {
+			t.Errorf("bolt protocol header found in http2 request: %v\n", req.header)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("http2 upstream receives no request\n")
+	}
+	if headers[sofarpc.HeaderRespStatus] != fmt.Sprint(sofarpc.RESPONSE_STATUS_SUCCESS) {
+		t.Errorf("unexpected bolt response status: %v\n", headers)
+	}
+	if headers["app"] != "testapp" {
+		t.Errorf("http2 response header not found in bolt response: %v\n", headers)
+	}
+	if content != "http2:hello" {
+		t.Errorf("unexpected bolt response content: %s\n", content)
+	}
+
+	//http status is mapped to bolt response status
+	headers, _ = doRequest("http2Service", "busy")
+	<-http2Requests
+	if headers[sofarpc.HeaderRespStatus] != fmt.Sprint(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY) {
+		t.Errorf("unexpected bolt response status: %v\n", headers)
+	}
+
+	//the cluster without declared protocol still receives bolt request
+	headers, content = doRequest("boltService", "hello")
+	select {
+	case req := <-boltRequests:
+		if req.className != className || req.content != "hello" {
+			t.Errorf("unexpected bolt request, class name %s, content %s\n", req.className, req.content)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("bolt upstream receives no request\n")
+	}
+	if headers[sofarpc.HeaderRespStatus] != fmt.Sprint(sofarpc.RESPONSE_STATUS_SUCCESS) {
+		t.Errorf("unexpected bolt response status: %v\n", headers)
+	}
+	if content != "echo:hello" {
+		t.Errorf("unexpected bolt response content: %s\n", content)
+	}
+	select {
+	case <-http2Requests:
+		t.Errorf("request to bolt cluster is sent to http2 upstream\n")
+	default:
+	}
+}
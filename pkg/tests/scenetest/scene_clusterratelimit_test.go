@@ -0,0 +1,288 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/filter"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+const rateLimitedMetric = "mosn_cluster_upstream_request_rate_limited{cluster=testCluster}"
+
+//records the time requests arrive at the upstream
+type arrivalRecorder struct {
+	mux      sync.Mutex
+	arrivals []time.Time
+}
+
+func (r *arrivalRecorder) reset() []time.Time {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	arrivals := r.arrivals
+	r.arrivals = nil
+	return arrivals
+}
+
+//SofaRpc Serve, records the arrival of requests and responses immediately
+func (r *arrivalRecorder) serve(t *testing.T, conn net.Conn) {
+	iobuf := buffer.NewIoBuffer(102400)
+	for {
+		buf := make([]byte, 10*1024)
+		bytesRead, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		iobuf.Write(buf[:bytesRead])
+		for iobuf.Len() > 1 {
+			_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+			if cmd == nil {
+				break
+			}
+			if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+				r.mux.Lock()
+				r.arrivals = append(r.arrivals, time.Now())
+				r.mux.Unlock()
+				_, resp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Resposne(req))
+				conn.Write(resp.Bytes())
+			}
+		}
+	}
+}
+
+func countStatus(t *testing.T, statuses []chan int16) (success, busy int) {
+	for _, status := range statuses {
+		switch s := waitStatus(t, status, 3*time.Second); s {
+		case sofarpc.RESPONSE_STATUS_SUCCESS:
+			success++
+		case sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY:
+			busy++
+		default:
+			t.Errorf("unexpected response status %d\n", s)
+		}
+	}
+	return success, busy
+}
+
+//requests to the cluster are paced to max_requests_per_second, requests over the queue are shed
+func TestClusterRateLimit(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	recorder := &arrivalRecorder{}
+	server := NewUpstreamServer(t, sofaAddr, recorder.serve)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.ClusterManager.Clusters[0].RateLimit = &config.ClusterRateLimitConfig{
+		MaxRequestsPerSecond: 20,
+		MaxQueueDelay:        config.DurationConfig{Duration: 500 * time.Millisecond},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//burst: one is sent at once, 10 wait in the queue of 500ms, and the others are shed
+	var statuses []chan int16
+	for i := 0; i < 30; i++ {
+		statuses = append(statuses, sendRequestWithStatus(client))
+	}
+	if success, busy := countStatus(t, statuses); success < 11 || success > 12 || success+busy != 30 {
+		t.Errorf("burst expect 11 requests passed and the others shed, but got %d passed, %d shed\n", success, busy)
+	}
+	sink.mux.Lock()
+	if n := sink.counts[rateLimitedMetric]; n < 18 {
+		t.Errorf("expect requests shed counted, but got %d\n", n)
+	}
+	sink.mux.Unlock()
+
+	//sustained traffic at 40 rps for 2 seconds is sent at 20 rps
+	time.Sleep(time.Second)
+	recorder.reset()
+	statuses = nil
+	for i := 0; i < 80; i++ {
+		statuses = append(statuses, sendRequestWithStatus(client))
+		time.Sleep(25 * time.Millisecond)
+	}
+	success, busy := countStatus(t, statuses)
+	if busy == 0 {
+		t.Error("sustained traffic over the rate expect some requests shed\n")
+	}
+	arrivals := recorder.reset()
+	if len(arrivals) != success {
+		t.Fatalf("expect %d requests arrived at upstream, but got %d\n", success, len(arrivals))
+	}
+	if rate := float64(len(arrivals)-1) / arrivals[len(arrivals)-1].Sub(arrivals[0]).Seconds(); rate > 22 || rate < 18 {
+		t.Errorf("expect requests arrived at 20 rps, but got %.1f rps\n", rate)
+	}
+}
+
+//holdDataFilter holds the data of the nth request for n * interval -/+ 10ms, and continues it in upper case,
+//so that the data of paced requests passes the filters right before or after the pacing timers fire
+type holdDataFilter struct {
+	hold time.Duration
+	cb   types.StreamReceiverFilterCallbacks
+}
+
+func (f *holdDataFilter) OnDecodeHeaders(headers map[string]string, endStream bool) types.FilterHeadersStatus {
+	return types.FilterHeadersStatusContinue
+}
+func (f *holdDataFilter) OnDecodeData(buf types.IoBuffer, endStream bool) types.FilterDataStatus {
+	if f.hold < 0 {
+		return types.FilterDataStatusContinue
+	}
+	hold := f.hold
+	f.hold = -1
+	go func() {
+		time.Sleep(hold)
+		buf := f.cb.DecodingBuffer()
+		content := strings.ToUpper(buf.String())
+		buf.Reset()
+		buf.Write([]byte(content))
+		f.cb.ContinueDecoding()
+	}()
+	return types.FilterDataStatusStopIterationAndBuffer
+}
+func (f *holdDataFilter) OnDecodeTrailers(trailers map[string]string) types.FilterTrailersStatus {
+	return types.FilterTrailersStatusContinue
+}
+func (f *holdDataFilter) SetDecoderFilterCallbacks(cb types.StreamReceiverFilterCallbacks) {
+	f.cb = cb
+}
+func (f *holdDataFilter) OnDestroy() {}
+
+type holdDataFilterFactory struct {
+	interval time.Duration
+	count    int64
+}
+
+func (f *holdDataFilterFactory) CreateFilterChain(context context.Context, callbacks types.FilterChainFactoryCallbacks) {
+	n := atomic.AddInt64(&f.count, 1) - 1
+	hold := time.Duration(n)*f.interval + 10*time.Millisecond
+	if n%2 == 1 {
+		hold -= 20 * time.Millisecond
+	}
+	callbacks.AddStreamReceiverFilter(&holdDataFilter{hold: hold})
+}
+
+//the content of paced requests passes the filters while the pacing timers fire, and is sent once after the headers,
+//the content held by filters is not sent until continued
+func TestClusterRateLimitPacedContent(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	requests := make(chan *boltRequest, 20)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1Echo(requests))
+	server.GoServe()
+	defer server.Close()
+	//the nth request is paced for n * 50ms, and its content is held for about n * 50ms as well
+	filter.Register("hold_data", func(map[string]interface{}) (types.StreamFilterChainFactory, error) {
+		return &holdDataFilterFactory{interval: 50 * time.Millisecond}, nil
+	})
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].StreamFilters = []config.FilterConfig{
+		config.FilterConfig{Type: "hold_data"},
+	}
+	mesh_config.ClusterManager.Clusters[0].RateLimit = &config.ClusterRateLimitConfig{
+		MaxRequestsPerSecond: 20,
+		MaxQueueDelay:        config.DurationConfig{Duration: time.Second},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	contents := make(map[string]bool)
+	var receivers []*responseReceiver
+	for i := 0; i < 10; i++ {
+		id := GetStreamId()
+		request := buildBoltV1Request(id)
+		content := fmt.Sprintf("content-%d", id)
+		request.ContentLen = len(content)
+		receiver := &responseReceiver{headers: make(chan map[string]string, 1), content: make(chan string, 1)}
+		requestEncoder := client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver)
+		requestEncoder.AppendHeaders(request, false)
+		requestEncoder.AppendData(buffer.NewIoBufferString(content), true)
+		contents[strings.ToUpper(content)] = true
+		receivers = append(receivers, receiver)
+	}
+
+	for _, receiver := range receivers {
+		headers := waitHeaders(t, receiver.headers, 3*time.Second)
+		if status := headers[sofarpc.HeaderRespStatus]; status != fmt.Sprint(sofarpc.RESPONSE_STATUS_SUCCESS) {
+			t.Errorf("unexpected response status %s\n", status)
+			continue
+		}
+		select {
+		case content := <-receiver.content:
+			if !contents[strings.TrimPrefix(content, "echo:")] {
+				t.Errorf("unexpected response content %s\n", content)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("wait response content timeout\n")
+		}
+	}
+
+	//each request arrives at upstream once with its content
+	time.Sleep(100 * time.Millisecond)
+	if n := len(requests); n != 10 {
+		t.Errorf("expect 10 requests arrived at upstream, but got %d\n", n)
+	}
+	for len(requests) > 0 {
+		req := <-requests
+		if !contents[req.content] {
+			t.Errorf("unexpected request content %s\n", req.content)
+		}
+		delete(contents, req.content)
+	}
+}
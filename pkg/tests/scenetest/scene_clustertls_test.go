@@ -0,0 +1,147 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//creates a ca in pem, and a server certificate for 127.0.0.1 signed by the ca
+func createServerCert(t *testing.T) (string, tls.Certificate) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create ca error: %v\n", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create certificate error: %v\n", err)
+	}
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+	return caPEM, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+//SofaRpc Serve over TLS, records whether the connection is tls
+func ServeBoltV1TLS(cert tls.Certificate, handshakes chan error) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		err := tlsConn.Handshake()
+		handshakes <- err
+		if err != nil {
+			return
+		}
+		ServeBoltV1(t, tlsConn)
+	}
+}
+
+func runTLSClusterCase(t *testing.T, caPEM string, cert tls.Certificate) (int16, error) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	handshakes := make(chan error, 10)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1TLS(cert, handshakes))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.ClusterManager.Clusters[0].TLS = config.TLSConfig{
+		Status:     true,
+		CACert:     caPEM,
+		MinVersion: "TLSv1_2",
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+	status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second)
+	select {
+	case err := <-handshakes:
+		return status, err
+	case <-time.After(time.Second):
+		t.Fatalf("upstream receives no tls handshake\n")
+	}
+	return status, nil
+}
+
+//plaintext bolt from downstream is sent over tls to upstream cluster configured with tls
+func TestClusterTLS(t *testing.T) {
+	caPEM, cert := createServerCert(t)
+	status, err := runTLSClusterCase(t, caPEM, cert)
+	if err != nil {
+		t.Errorf("tls handshake error: %v\n", err)
+	}
+	if status != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request over tls expect success, but got %d\n", status)
+	}
+}
+
+//upstream server certificate not signed by configured ca is rejected
+func TestClusterTLSUntrustedServer(t *testing.T) {
+	caPEM, _ := createServerCert(t)
+	_, cert := createServerCert(t)
+	status, err := runTLSClusterCase(t, caPEM, cert)
+	if err == nil {
+		t.Errorf("tls handshake with untrusted server should fail\n")
+	}
+	if status != sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR {
+		t.Errorf("request to untrusted server expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR, status)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+)
+
+//the connection is served by mesh
+func expectConnAccepted(t *testing.T, conn net.Conn) {
+	if resp := roundTripBoltV1(t, conn, buildBoltV1Request(GetStreamId())); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request on accepted connection expect success, but got %d\n", resp.ResponseStatus)
+	}
+}
+
+//the connection is closed by mesh without any response
+func expectConnRejected(t *testing.T, conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("connection over limit expect closed, but read %d bytes\n", n)
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Errorf("connection over limit expect closed, but it is kept\n")
+	}
+}
+
+func dialMeshFrom(t *testing.T, local, addr string) net.Conn {
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(local)}}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial mesh from %s failed: %v\n", local, err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+//connections over max_connections are closed, and accepted again after one of them closed
+func TestListenerMaxConnections(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].MaxConnections = 2
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	first := dialMesh(t, meshAddr)
+	defer first.Close()
+	expectConnAccepted(t, first)
+	second := dialMesh(t, meshAddr)
+	expectConnAccepted(t, second)
+	third := dialMesh(t, meshAddr)
+	defer third.Close()
+	expectConnRejected(t, third)
+
+	//the existing connections are not affected
+	expectConnAccepted(t, first)
+
+	second.Close()
+	time.Sleep(200 * time.Millisecond) //wait mesh notice the close
+	fourth := dialMesh(t, meshAddr)
+	defer fourth.Close()
+	expectConnAccepted(t, fourth)
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+	if n := sink.counts["mosn_listener_connections_rejected_total{limit=max_connections,listener=testListener}"]; n != 1 {
+		t.Errorf("expect 1 rejected connection recorded, got %v\n", sink.counts)
+	}
+}
+
+//connections over max_connections_per_ip are closed, connections from other ips are accepted
+func TestListenerMaxConnectionsPerIP(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].MaxConnectionsPerIP = 1
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	first := dialMeshFrom(t, "127.0.0.1", meshAddr)
+	defer first.Close()
+	expectConnAccepted(t, first)
+	second := dialMeshFrom(t, "127.0.0.1", meshAddr)
+	defer second.Close()
+	expectConnRejected(t, second)
+	other := dialMeshFrom(t, "127.0.0.2", meshAddr)
+	defer other.Close()
+	expectConnAccepted(t, other)
+}
+
+//the limits are changed on listener update
+func TestListenerUpdateMaxConnections(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].MaxConnections = 1
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	first := dialMesh(t, meshAddr)
+	defer first.Close()
+	expectConnAccepted(t, first)
+	rejected := dialMesh(t, meshAddr)
+	defer rejected.Close()
+	expectConnRejected(t, rejected)
+
+	//raise the limit, the idle connection of the old listener is drained
+	listenerConfig := mesh_config.Servers[0].Listeners[0]
+	listenerConfig.MaxConnections = 3
+	if err := mesh.UpdateListener(&listenerConfig); err != nil {
+		t.Fatalf("update listener failed: %v\n", err)
+	}
+	time.Sleep(200 * time.Millisecond) //wait drain
+	//connections are accepted concurrently, make sure each one is served before dialing the next
+	for i := 0; i < 3; i++ {
+		conn := dialMesh(t, meshAddr)
+		defer conn.Close()
+		expectConnAccepted(t, conn)
+	}
+	over := dialMesh(t, meshAddr)
+	defer over.Close()
+	expectConnRejected(t, over)
+}
@@ -0,0 +1,170 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const correlationIdHeader = "x-correlation-id"
+
+//records the headers of bolt requests, and serves them after delay
+func ServeBoltV1RecordHeadersWithDelay(delay time.Duration, headers chan map[string]string) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		iobuf := buffer.NewIoBuffer(102400)
+		for {
+			conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			buf := make([]byte, 10*1024)
+			bytesRead, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:bytesRead])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+					headerMap := make(map[string]string)
+					serialize.Instance.DeSerialize(req.HeaderMap, &headerMap)
+					headers <- headerMap
+					time.Sleep(delay)
+					if _, iobufresp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Resposne(req)); iobufresp != nil {
+						conn.Write(iobufresp.Bytes())
+					}
+				}
+			}
+		}
+	}
+}
+
+//the correlation id of request is written into the upstream frame and the access log,
+//and it is generated if the request has none
+func TestCorrelationId(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	dir, err := ioutil.TempDir("", "mosn_correlation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "access.log")
+	upstreamHeaders := make(chan map[string]string, 2)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1RecordHeaders(upstreamHeaders))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	setProxyOption(mesh_config, "correlation_id_header", correlationIdHeader)
+	mesh_config.Servers[0].Listeners[0].AccessLogs = []config.AccessLogConfig{
+		{LogPath: logPath, LogFormat: "correlation_id=%CorrelationId%"},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//the id of downstream is kept
+	status := sendRequestWithHeaders(client, map[string]string{"service": "testSofa", correlationIdHeader: "5f2d8e1c"})
+	if s := waitStatus(t, status, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	headers := waitHeaders(t, upstreamHeaders, time.Second)
+	if headers[correlationIdHeader] != "5f2d8e1c" || headers[types.HeaderAttempt] != "1" {
+		t.Errorf("unexpected correlation id in upstream headers: %v\n", headers)
+	}
+
+	//a new id is generated
+	status = sendRequestWithHeaders(client, map[string]string{"service": "testSofa"})
+	if s := waitStatus(t, status, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	headers = waitHeaders(t, upstreamHeaders, time.Second)
+	generated := headers[correlationIdHeader]
+	if len(generated) != 32 || generated == "5f2d8e1c" || headers[types.HeaderAttempt] != "1" {
+		t.Errorf("unexpected correlation id in upstream headers: %v\n", headers)
+	}
+	time.Sleep(100 * time.Millisecond) //wait streams cleaned
+
+	b, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read access log error: %v\n", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect two access log records, but got: %s\n", b)
+	}
+	//the record is prefixed by the time of the logger
+	for i, id := range []string{"5f2d8e1c", generated} {
+		if !strings.HasSuffix(lines[i], " correlation_id="+id) {
+			t.Errorf("access log record expect correlation id %s, but got: %s\n", id, lines[i])
+		}
+	}
+}
+
+//the hedged request carries the same correlation id as the origin one, with a new attempt number
+func TestCorrelationIdHedge(t *testing.T) {
+	sofaAddr1 := "127.0.0.1:8080"
+	sofaAddr2 := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	upstreamHeaders := make(chan map[string]string, 10)
+	server1 := NewUpstreamServer(t, sofaAddr1, ServeBoltV1RecordHeadersWithDelay(300*time.Millisecond, upstreamHeaders))
+	server1.GoServe()
+	defer server1.Close()
+	server2 := NewUpstreamServer(t, sofaAddr2, ServeBoltV1RecordHeadersWithDelay(300*time.Millisecond, upstreamHeaders))
+	server2.GoServe()
+	defer server2.Close()
+	mesh_config := CreateHedgeMeshConfig(meshAddr, []string{sofaAddr1, sofaAddr2}, &v2.HedgePolicy{HedgeDelay: "50ms", MaxHedges: 1})
+	setProxyOption(mesh_config, "correlation_id_header", correlationIdHeader)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	status := sendRequestWithHeaders(client, map[string]string{"service": "testSofa"})
+	if s := waitStatus(t, status, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	first := waitHeaders(t, upstreamHeaders, time.Second)
+	second := waitHeaders(t, upstreamHeaders, time.Second)
+	if first[correlationIdHeader] == "" || first[correlationIdHeader] != second[correlationIdHeader] {
+		t.Errorf("hedged request expect the same correlation id, but got %v and %v\n", first, second)
+	}
+	if first[types.HeaderAttempt] != "1" || second[types.HeaderAttempt] != "2" {
+		t.Errorf("unexpected attempts of hedged request: %v and %v\n", first, second)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//a request in flight on listener update should complete during drain,
+//and new connections are served by the new listener config
+func TestListenerUpdateDrain(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithDelay(time.Second))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	oldClient := &BoltV1Client{
+		t:        t,
+		ClientId: "oldClient",
+		Waits:    cmap.New(),
+	}
+	if err := oldClient.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer oldClient.conn.Close(types.NoFlush, types.LocalClose)
+	oldClient.SendRequest()
+	time.Sleep(200 * time.Millisecond) //request in flight
+	listenerConfig := mesh_config.Servers[0].Listeners[0]
+	listenerConfig.DrainTimeout.Duration = 5 * time.Second
+	if err := mesh.UpdateListener(&listenerConfig); err != nil {
+		t.Fatalf("update listener failed: %v\n", err)
+	}
+	newClient := &BoltV1Client{
+		t:        t,
+		ClientId: "newClient",
+		Waits:    cmap.New(),
+	}
+	if err := newClient.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh after listener updated failed: %v\n", err)
+	}
+	defer newClient.conn.Close(types.NoFlush, types.LocalClose)
+	newClient.SendRequest()
+	<-time.After(3 * time.Second) //wait request finish
+	if !oldClient.Waits.IsEmpty() {
+		t.Errorf("request in flight get no response during drain\n")
+	}
+	if !newClient.Waits.IsEmpty() {
+		t.Errorf("request get no response after listener updated\n")
+	}
+}
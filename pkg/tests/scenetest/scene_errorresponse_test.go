@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+)
+
+//sends the bolt v1 request on the raw connection, returns the response
+func roundTripBoltV1(t *testing.T, conn net.Conn, req *sofarpc.BoltRequestCommand) *sofarpc.BoltResponseCommand {
+	_, buf := codec.BoltV1.GetEncoder().EncodeHeaders(nil, req)
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		t.Fatalf("write request failed: %v\n", err)
+	}
+	return readBoltV1Response(t, conn)
+}
+
+//checks the error response replied by mosn keeps the request id, version and codec of request
+func expectErrorResponse(t *testing.T, req *sofarpc.BoltRequestCommand, resp *sofarpc.BoltResponseCommand, status int16) {
+	if resp.ResponseStatus != status {
+		t.Errorf("expect status %d, but got %d\n", status, resp.ResponseStatus)
+	}
+	if resp.ReqId != req.ReqId || resp.Version != req.Version || resp.CodecPro != req.CodecPro {
+		t.Errorf("response should follow the request %d, version %d, codec %d, but got %+v\n",
+			req.ReqId, req.Version, req.CodecPro, resp)
+	}
+}
+
+func dialMesh(t *testing.T, addr string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial mesh failed: %v\n", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+//requests without a healthy host or a route get a structured bolt response instead of a dropped connection
+func TestErrorResponseNoHealthyHost(t *testing.T) {
+	//nothing listens on the host
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh start
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+
+	req := buildBoltV1Request(GetStreamId())
+	expectErrorResponse(t, req, roundTripBoltV1(t, conn, req), sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR)
+
+	//no service header to route
+	req = buildBoltV1Request(GetStreamId())
+	req.HeaderMap, req.HeaderLen = nil, 0
+	expectErrorResponse(t, req, roundTripBoltV1(t, conn, req), sofarpc.RESPONSE_STATUS_NO_PROCESSOR)
+}
+
+//requests rejected by filter get the status of the filter
+func TestErrorResponseRateLimited(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].StreamFilters = []config.FilterConfig{
+		config.FilterConfig{
+			Type:   "rate_limit",
+			Config: map[string]interface{}{"rate": float64(0.1), "burst": float64(1)},
+		},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+
+	req := buildBoltV1Request(GetStreamId())
+	if resp := roundTripBoltV1(t, conn, req); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request under rate limit expect success, but got %d\n", resp.ResponseStatus)
+	}
+	req = buildBoltV1Request(GetStreamId())
+	expectErrorResponse(t, req, roundTripBoltV1(t, conn, req), sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)
+}
@@ -0,0 +1,118 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/filter/stream/extproc"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+	"google.golang.org/grpc"
+)
+
+//external processor sets a header on requests, and replies requests of the blocked service immediately
+type sceneProcessor struct{}
+
+func (p *sceneProcessor) Process(ctx context.Context, in *extproc.ProcessingRequest) (*extproc.ProcessingResponse, error) {
+	if in.Headers["service"] == "blocked" {
+		return &extproc.ProcessingResponse{
+			ImmediateResponse: &extproc.ImmediateResponse{Status: int32(sofarpc.RESPONSE_STATUS_NO_PROCESSOR)},
+		}, nil
+	}
+	return &extproc.ProcessingResponse{SetHeaders: map[string]string{"processed": "true"}}, nil
+}
+
+func TestExtProc(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v\n", err)
+	}
+	processor := grpc.NewServer()
+	extproc.RegisterExternalProcessorServer(processor, &sceneProcessor{})
+	go processor.Serve(lis)
+	defer processor.Stop()
+	upstreamHeaders := make(chan map[string]string, 1)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1RecordHeaders(upstreamHeaders))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].StreamFilters = []config.FilterConfig{
+		config.FilterConfig{
+			Type: "ext_proc",
+			Config: map[string]interface{}{
+				"address": lis.Addr().String(),
+				"timeout": "1s",
+			},
+		},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//processed request is forwarded with the header set by the processor
+	id := GetStreamId()
+	receiver := &headersReceiver{headers: make(chan map[string]string, 1)}
+	client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver).AppendHeaders(buildBoltV1Request(id), true)
+	reqHeaders := waitHeaders(t, upstreamHeaders, 3*time.Second)
+	if reqHeaders["processed"] != "true" {
+		t.Errorf("header set by processor not found in upstream frame: %v\n", reqHeaders)
+	}
+	respHeaders := waitHeaders(t, receiver.headers, 3*time.Second)
+	if respHeaders[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] != strconv.Itoa(int(sofarpc.RESPONSE_STATUS_SUCCESS)) {
+		t.Errorf("unexpected response: %v\n", respHeaders)
+	}
+
+	//request of the blocked service is replied by the processor without forwarding
+	id = GetStreamId()
+	request := buildBoltV1Request(id)
+	headerBytes, _ := serialize.Instance.Serialize(map[string]string{"service": "blocked"})
+	request.HeaderMap = headerBytes
+	request.HeaderLen = int16(len(headerBytes))
+	receiver = &headersReceiver{headers: make(chan map[string]string, 1)}
+	client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver).AppendHeaders(request, true)
+	respHeaders = waitHeaders(t, receiver.headers, 3*time.Second)
+	if respHeaders[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)] != strconv.Itoa(int(sofarpc.RESPONSE_STATUS_NO_PROCESSOR)) {
+		t.Errorf("unexpected immediate response: %v\n", respHeaders)
+	}
+	select {
+	case h := <-upstreamHeaders:
+		t.Errorf("request replied immediately should not be forwarded: %v\n", h)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
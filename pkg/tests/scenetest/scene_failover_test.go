@@ -0,0 +1,139 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+	clusterAdapter "github.com/alipay/sofamosn/pkg/upstream/cluster"
+)
+
+const failoverMetric = "mosn_cluster_upstream_request_failover{cluster=testCluster}"
+
+//expects a success response and returns the upstream receiving the request
+func sendFailoverRequest(t *testing.T, client *BoltV1Client, primary, failover chan map[string]string) string {
+	if s := waitStatus(t, sendRequestWithHeaders(client, map[string]string{"service": "testSofa"}), 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	select {
+	case <-primary:
+		return "primary"
+	case <-failover:
+		return "failover"
+	case <-time.After(time.Second):
+		t.Fatalf("request not received by any upstream\n")
+	}
+	return ""
+}
+
+//requests go to the failover cluster while the route cluster has no healthy host,
+//and return to the route cluster once it recovers
+func TestFailoverCluster(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	failoverAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	primaryHeaders := make(chan map[string]string, 10)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1RecordHeaders(primaryHeaders))
+	server.GoServe()
+	defer server.Close()
+	failoverHeaders := make(chan map[string]string, 10)
+	failover := NewUpstreamServer(t, failoverAddr, ServeBoltV1RecordHeaders(failoverHeaders))
+	failover.GoServe()
+	defer failover.Close()
+	mesh_config := CreateFailoverMeshConfig(meshAddr, []string{sofaAddr}, []string{failoverAddr}, 0)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	for i := 0; i < 3; i++ {
+		if to := sendFailoverRequest(t, client, primaryHeaders, failoverHeaders); to != "primary" {
+			t.Fatalf("request expect sent to primary cluster, but sent to %s\n", to)
+		}
+	}
+	sink.mux.Lock()
+	if n := sink.counts[failoverMetric]; n != 0 {
+		t.Errorf("expect no failover, but got %d\n", n)
+	}
+	sink.mux.Unlock()
+
+	//all hosts of the route cluster are gone
+	if err := clusterAdapter.ClusterAdap.TriggerClusterUpdate("testCluster", []v2.Host{}); err != nil {
+		t.Fatalf("update cluster hosts failed: %v\n", err)
+	}
+	for i := 0; i < 3; i++ {
+		if to := sendFailoverRequest(t, client, primaryHeaders, failoverHeaders); to != "failover" {
+			t.Fatalf("request expect sent to failover cluster, but sent to %s\n", to)
+		}
+	}
+	sink.mux.Lock()
+	if n := sink.counts[failoverMetric]; n != 3 {
+		t.Errorf("expect 3 failovers, but got %d\n", n)
+	}
+	sink.mux.Unlock()
+
+	//route cluster recovers
+	if err := clusterAdapter.ClusterAdap.TriggerClusterUpdate("testCluster", []v2.Host{{Address: sofaAddr, Weight: 100}}); err != nil {
+		t.Fatalf("update cluster hosts failed: %v\n", err)
+	}
+	for i := 0; i < 3; i++ {
+		if to := sendFailoverRequest(t, client, primaryHeaders, failoverHeaders); to != "primary" {
+			t.Fatalf("request expect sent back to primary cluster, but sent to %s\n", to)
+		}
+	}
+	sink.mux.Lock()
+	if n := sink.counts[failoverMetric]; n != 3 {
+		t.Errorf("expect no more failovers, but got %d\n", n)
+	}
+	sink.mux.Unlock()
+}
+
+//requests sent to the failover cluster still use the route timeout
+func TestFailoverClusterTimeout(t *testing.T) {
+	failoverAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	failover := NewUpstreamServer(t, failoverAddr, ServeBoltV1WithDelay(2*time.Second))
+	failover.GoServe()
+	defer failover.Close()
+	//no host in the route cluster
+	mesh_config := CreateFailoverMeshConfig(meshAddr, nil, []string{failoverAddr}, 300*time.Millisecond)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	start := time.Now()
+	if s := waitStatus(t, sendRequestWithHeaders(client, map[string]string{"service": "testSofa"}), 3*time.Second); s != sofarpc.RESPONSE_STATUS_TIMEOUT {
+		t.Fatalf("request expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_TIMEOUT, s)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("request expect timeout after 300ms, but cost %v\n", cost)
+	}
+}
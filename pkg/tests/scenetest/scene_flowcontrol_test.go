@@ -0,0 +1,118 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/proxy"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const flowControlContentLen = 64 * 1024
+
+//SofaRpc Serve, responses with large content
+func serveBoltV1LargeResponse(t *testing.T, conn net.Conn) {
+	iobuf := buffer.NewIoBuffer(102400)
+	content := make([]byte, flowControlContentLen)
+	for {
+		buf := make([]byte, 10*1024)
+		bytesRead, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		iobuf.Write(buf[:bytesRead])
+		for iobuf.Len() > 1 {
+			_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+			if cmd == nil {
+				break
+			}
+			if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+				resp := buildBoltV1Resposne(req)
+				resp.ContentLen = len(content)
+				_, respHeaders := codec.BoltV1.GetEncoder().EncodeHeaders(nil, resp)
+				conn.Write(respHeaders.Bytes())
+				conn.Write(content)
+			}
+		}
+	}
+}
+
+//upstream responses are not read while a slow downstream does not read the responses written
+func TestFlowControlSlowDownstream(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, serveBoltV1LargeResponse)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].WriteBufferHighWatermark = 256 * 1024
+	mesh_config.Servers[0].Listeners[0].WriteBufferLowWatermark = 64 * 1024
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	proxyStats := stats.NewStats(types.GlobalStatsNamespace).AddCounter(proxy.UpstreamFlowControlPausedReading).
+		AddCounter(proxy.UpstreamFlowControlResumedReading)
+	paused := proxyStats.Counter(proxy.UpstreamFlowControlPausedReading)
+	resumed := proxyStats.Counter(proxy.UpstreamFlowControlResumedReading)
+	pausedBefore, resumedBefore := paused.Count(), resumed.Count()
+
+	conn, err := net.Dial("tcp", meshAddr)
+	if err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer conn.Close()
+
+	//responses are much more than the socket buffers can hold
+	requests := 400
+	for i := 0; i < requests; i++ {
+		_, req := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Request(GetStreamId()))
+		if _, err := conn.Write(req.Bytes()); err != nil {
+			t.Fatalf("write request failed: %v\n", err)
+		}
+	}
+
+	//the client does not read, reading upstream is paused
+	for i := 0; i < 50 && paused.Count() == pausedBefore; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if paused.Count() == pausedBefore {
+		t.Fatalf("upstream reading is not paused on a slow downstream\n")
+	}
+
+	//the client reads all the responses, reading upstream is resumed
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	expected := int64(requests * flowControlContentLen)
+	if n, err := io.CopyN(io.Discard, conn, expected); err != nil {
+		t.Fatalf("read responses failed, %d bytes read: %v\n", n, err)
+	}
+	if resumed.Count()-resumedBefore != paused.Count()-pausedBefore {
+		t.Errorf("upstream reading paused %d times, but resumed %d times\n",
+			paused.Count()-pausedBefore, resumed.Count()-resumedBefore)
+	}
+}
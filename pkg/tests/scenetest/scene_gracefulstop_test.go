@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+//new connections are refused once graceful stop begins, in-flight requests complete within
+//the grace period, and idle connections are closed without waiting
+func TestGracefulStop(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	var count uint32
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SUCCESS, time.Second, &count))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+	idleClient := connectBoltV1Client(t, meshAddr)
+	defer idleClient.conn.Close(types.NoFlush, types.LocalClose)
+
+	result := sendRequestWithTimeout(client, 5000)
+	time.Sleep(100 * time.Millisecond) //wait request forwarded
+
+	start := time.Now()
+	forceClosed := make(chan int, 1)
+	go func() {
+		forceClosed <- mesh.GracefulStop(5 * time.Second)
+	}()
+	time.Sleep(100 * time.Millisecond) //wait listener closed
+
+	if conn, err := net.DialTimeout("tcp", meshAddr, time.Second); err == nil {
+		conn.Close()
+		t.Error("new connection expect refused during graceful stop")
+	}
+
+	if status := waitStatus(t, result, 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("in-flight request expect success, but got %d\n", status)
+	}
+
+	select {
+	case n := <-forceClosed:
+		if n != 0 {
+			t.Errorf("expect no connection closed forcibly, but got %d\n", n)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("graceful stop expect finished after in-flight requests, but took %s\n", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("graceful stop expect finished within the grace period")
+	}
+}
+
+//connections with requests not finished in the grace period are closed forcibly
+func TestGracefulStopForceClose(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	var count uint32
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SUCCESS, 3*time.Second, &count))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	sendRequestWithTimeout(client, 5000)
+	time.Sleep(100 * time.Millisecond) //wait request forwarded
+
+	if n := mesh.GracefulStop(500 * time.Millisecond); n != 1 {
+		t.Errorf("expect 1 connection closed forcibly, but got %d\n", n)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//SofaRpc Serve, records the header map of requests decoded from the upstream frame
+func ServeBoltV1RecordHeaders(headers chan map[string]string) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		iobuf := buffer.NewIoBuffer(102400)
+		for {
+			conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			buf := make([]byte, 10*1024)
+			bytesRead, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:bytesRead])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+					headerMap := make(map[string]string)
+					serialize.Instance.DeSerialize(req.HeaderMap, &headerMap)
+					headers <- headerMap
+					err, iobufresp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Resposne(req))
+					if err != nil {
+						t.Errorf("Build response error: %v\n", err)
+					} else {
+						conn.Write(iobufresp.Bytes())
+					}
+				}
+			}
+		}
+	}
+}
+
+//types.StreamReceiver, records response headers of a request
+type headersReceiver struct {
+	headers chan map[string]string
+}
+
+func (r *headersReceiver) OnReceiveHeaders(headers map[string]string, endStream bool) {
+	r.headers <- headers
+}
+func (r *headersReceiver) OnReceiveData(data types.IoBuffer, endStream bool) {}
+func (r *headersReceiver) OnReceiveTrailers(trailers map[string]string)     {}
+func (r *headersReceiver) OnDecodeError(err error, headers map[string]string) {}
+
+func waitHeaders(t *testing.T, headers chan map[string]string, timeout time.Duration) map[string]string {
+	select {
+	case h := <-headers:
+		return h
+	case <-time.After(timeout):
+		t.Fatalf("wait headers timeout\n")
+	}
+	return nil
+}
+
+//header mutation filter injects and strips headers in bolt frames of both directions
+func TestHeaderMutation(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	upstreamHeaders := make(chan map[string]string, 1)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1RecordHeaders(upstreamHeaders))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].StreamFilters = []config.FilterConfig{
+		config.FilterConfig{
+			Type: "header_mutation",
+			Config: map[string]interface{}{
+				"request_headers_to_add":     map[string]interface{}{"injected": "mosn"},
+				"request_headers_to_remove":  []interface{}{"internal"},
+				"response_headers_to_add":    map[string]interface{}{"response-added": "mosn"},
+				"response_headers_to_remove": []interface{}{"injected"},
+			},
+		},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	id := GetStreamId()
+	request := buildBoltV1Request(id)
+	headerBytes, _ := serialize.Instance.Serialize(map[string]string{"service": "testSofa", "internal": "secret"})
+	request.HeaderMap = headerBytes
+	request.HeaderLen = int16(len(headerBytes))
+	receiver := &headersReceiver{headers: make(chan map[string]string, 1)}
+	client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver).AppendHeaders(request, true)
+
+	reqHeaders := waitHeaders(t, upstreamHeaders, 3*time.Second)
+	if reqHeaders["injected"] != "mosn" {
+		t.Errorf("injected header not found in upstream frame: %v\n", reqHeaders)
+	}
+	if _, ok := reqHeaders["internal"]; ok {
+		t.Errorf("stripped header found in upstream frame: %v\n", reqHeaders)
+	}
+	if reqHeaders["service"] != "testSofa" {
+		t.Errorf("service header changed in upstream frame: %v\n", reqHeaders)
+	}
+
+	//upstream echoes request headers, the injected one is stripped in response
+	respHeaders := waitHeaders(t, receiver.headers, 3*time.Second)
+	if respHeaders["response-added"] != "mosn" {
+		t.Errorf("injected header not found in response: %v\n", respHeaders)
+	}
+	if _, ok := respHeaders["injected"]; ok {
+		t.Errorf("stripped header found in response: %v\n", respHeaders)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//serves bolt requests after delay, and records the received request ids
+func ServeBoltV1RecordRequests(delay time.Duration, requests chan uint32) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		iobuf := buffer.NewIoBuffer(102400)
+		for {
+			conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			buf := make([]byte, 10*1024)
+			bytesRead, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:bytesRead])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+					requests <- req.ReqId
+					time.Sleep(delay)
+					if _, iobufresp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Resposne(req)); iobufresp != nil {
+						conn.Write(iobufresp.Bytes())
+					}
+				}
+			}
+		}
+	}
+}
+
+//requests to a slow host are hedged to another host, and the faster response is used
+func TestHedgeSlowHost(t *testing.T) {
+	slowAddr := "127.0.0.1:8080"
+	fastAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	slow := NewUpstreamServer(t, slowAddr, ServeBoltV1WithDelay(2*time.Second))
+	slow.GoServe()
+	defer slow.Close()
+	fast := NewUpstreamServer(t, fastAddr, ServeBoltV1)
+	fast.GoServe()
+	defer fast.Close()
+	mesh_config := CreateHedgeMeshConfig(meshAddr, []string{slowAddr, fastAddr}, &v2.HedgePolicy{HedgeDelay: "100ms", MaxHedges: 1})
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//half of the requests are routed to the slow host by round robin
+	for i := 0; i < 6; i++ {
+		start := time.Now()
+		if s := waitStatus(t, sendRequestWithStatus(client), time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success, but got %d\n", s)
+		}
+		if cost := time.Now().Sub(start); cost > time.Second {
+			t.Errorf("request expect hedged to the fast host, but cost %v\n", cost)
+		}
+	}
+}
+
+//both hosts respond to the hedged request, but downstream receives exactly one response,
+//and the cancelled upstream requests are released
+func TestHedgeResponseDedup(t *testing.T) {
+	sofaAddr1 := "127.0.0.1:8080"
+	sofaAddr2 := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	requests := make(chan uint32, 100)
+	server1 := NewUpstreamServer(t, sofaAddr1, ServeBoltV1RecordRequests(300*time.Millisecond, requests))
+	server1.GoServe()
+	defer server1.Close()
+	server2 := NewUpstreamServer(t, sofaAddr2, ServeBoltV1RecordRequests(300*time.Millisecond, requests))
+	server2.GoServe()
+	defer server2.Close()
+	mesh_config := CreateHedgeMeshConfig(meshAddr, []string{sofaAddr1, sofaAddr2}, &v2.HedgePolicy{HedgeDelay: "50ms", MaxHedges: 1})
+	//requests of the losers are not released if the breaker overflows
+	mesh_config.ClusterManager.Clusters[0].CircuitBreakers = []*config.CircuitBreakerdConfig{
+		&config.CircuitBreakerdConfig{Priority: "default", MaxRequests: 2},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	conn, err := net.Dial("tcp", meshAddr)
+	if err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer conn.Close()
+
+	responses := make(chan *sofarpc.BoltResponseCommand, 100)
+	go func() {
+		iobuf := buffer.NewIoBuffer(10240)
+		buf := make([]byte, 10240)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:n])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				if resp, ok := cmd.(*sofarpc.BoltResponseCommand); ok {
+					responses <- resp
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		id := GetStreamId()
+		_, request := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Request(id))
+		if _, err := conn.Write(request.Bytes()); err != nil {
+			t.Fatalf("send request failed: %v\n", err)
+		}
+		//the request is sent to both hosts
+		for j := 0; j < 2; j++ {
+			select {
+			case reqId := <-requests:
+				if reqId != id {
+					t.Fatalf("upstream expect request %d, but got %d\n", id, reqId)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("request %d expect hedged to both hosts\n", id)
+			}
+		}
+		select {
+		case resp := <-responses:
+			if resp.ReqId != id || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+				t.Fatalf("request %d expect success, but got response %d with status %d\n", id, resp.ReqId, resp.ResponseStatus)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("wait response of request %d timeout\n", id)
+		}
+		//the response of the other host is discarded
+		select {
+		case resp := <-responses:
+			t.Fatalf("request %d expect one response, but got another one %d\n", id, resp.ReqId)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
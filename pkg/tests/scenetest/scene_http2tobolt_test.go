@@ -0,0 +1,190 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"golang.org/x/net/http2"
+)
+
+//bolt request received by upstream server
+type boltRequest struct {
+	className string
+	headers   map[string]string
+	content   string
+}
+
+//SofaRpc Serve, records requests and echoes the content, responses server busy if content is "busy"
+func ServeBoltV1Echo(requests chan *boltRequest) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		iobuf := buffer.NewIoBuffer(102400)
+		for {
+			conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			buf := make([]byte, 10*1024)
+			bytesRead, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:bytesRead])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+					headers := make(map[string]string)
+					serialize.Instance.DeSerialize(req.HeaderMap, &headers)
+					requests <- &boltRequest{className: req.GetServiceName(), headers: headers, content: string(req.Content)}
+					status := sofarpc.RESPONSE_STATUS_SUCCESS
+					if string(req.Content) == "busy" {
+						status = sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY
+					}
+					resp := buildBoltV1ResposneWithStatus(req, status)
+					content := []byte("echo:" + string(req.Content))
+					resp.ContentLen = len(content)
+					err, iobufresp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, resp)
+					if err != nil {
+						t.Errorf("Build response error: %v\n", err)
+					} else {
+						conn.Write(append(iobufresp.Bytes(), content...))
+					}
+				}
+			}
+		}
+	}
+}
+
+func CreateHttp2ToBoltMeshConfig(addr string, hosts []string, boltConvert *v2.BoltConvert) *config.MOSNConfig {
+	clusterName := "testCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+	})
+	header := v2.HeaderMatcher{Name: "service", Value: ".*"}
+	routerV2 := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
+		Route: v2.RouteAction{ClusterName: clusterName, BoltConvert: boltConvert},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.Http2),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{routerV2}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//http2 requests are converted to bolt requests, and bolt responses are converted back
+func TestHttp2ToBolt(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	requests := make(chan *boltRequest, 1)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1Echo(requests))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateHttp2ToBoltMeshConfig(meshAddr, []string{sofaAddr}, &v2.BoltConvert{
+		PathPrefix: "/rpc",
+		Headers:    []string{"service", "app"},
+	})
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	tr := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(netw, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(netw, addr)
+		},
+	}
+	httpClient := http.Client{Transport: tr, Timeout: 5 * time.Second}
+	doRequest := func(body string) (*http.Response, string) {
+		request, _ := http.NewRequest("POST", fmt.Sprintf("http://%s/rpc/com.alipay.test.TestService/echo", meshAddr), bytes.NewBufferString(body))
+		request.Header.Add("service", "com.alipay.test.TestService")
+		request.Header.Add("app", "testapp")
+		request.Header.Add("internal", "secret")
+		resp, err := httpClient.Do(request)
+		if err != nil {
+			t.Fatalf("request error: %v\n", err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	resp, body := doRequest("hello")
+	select {
+	case req := <-requests:
+		if req.className != "com.alipay.test.TestService" {
+			t.Errorf("unexpected bolt class name: %s\n", req.className)
+		}
+		if req.content != "hello" {
+			t.Errorf("unexpected bolt content: %s\n", req.content)
+		}
+		if req.headers["app"] != "testapp" {
+			t.Errorf("selected header not found in bolt header map: %v\n", req.headers)
+		}
+		if _, ok := req.headers["internal"]; ok {
+			t.Errorf("header not selected found in bolt header map: %v\n", req.headers)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("upstream receives no bolt request\n")
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expect http status %d, but got %d\n", http.StatusOK, resp.StatusCode)
+	}
+	if body != "echo:hello" {
+		t.Errorf("unexpected response body: %s\n", body)
+	}
+	if resp.Header.Get("app") != "testapp" {
+		t.Errorf("bolt response header not found in http2 response: %v\n", resp.Header)
+	}
+	if resp.Header.Get(sofarpc.HeaderRespStatus) != "" {
+		t.Errorf("bolt protocol header found in http2 response: %v\n", resp.Header)
+	}
+
+	//bolt response status is mapped to http status
+	resp, _ = doRequest("busy")
+	<-requests
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expect http status %d, but got %d\n", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
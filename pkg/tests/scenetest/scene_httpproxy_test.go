@@ -17,8 +17,10 @@
 package tests
 
 import (
+	"bufio"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
@@ -26,7 +28,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alipay/sofamosn/pkg/config"
 	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
 )
 
 func GetServerAddr(s *httptest.Server) string {
@@ -95,3 +99,60 @@ func TestHttpProxy(t *testing.T) {
 		t.Errorf("expected %s, but got %s\n", cluster2Server.name, clustername)
 	}
 }
+
+// responses of pipelined requests are sent in the order of requests,
+// even if the later one is responded first as the first one is delayed by fault inject
+func TestHttpPipelining(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	meshAddr := "127.0.0.1:2045"
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{GetServerAddr(server)}, protocol.Http1, protocol.Http1)
+	mesh_config.Servers[0].Listeners[0].StreamFilters = []config.FilterConfig{
+		config.FilterConfig{
+			Type: "fault_inject",
+			Config: map[string]interface{}{
+				"delay_percent":  float64(100),
+				"delay_duration": "300ms",
+				"header":         map[string]interface{}{"name": "delay", "value": "true"},
+			},
+		},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	conn, err := net.Dial("tcp", meshAddr)
+	if err != nil {
+		t.Fatalf("dial mesh error: %v", err)
+	}
+	defer conn.Close()
+
+	paths := []string{"/delay", "/fast", "/fast"}
+	var requests string
+	for _, path := range paths {
+		requests += fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nService: testCluster\r\nDelay: %t\r\n\r\n",
+			path, meshAddr, path == "/delay")
+	}
+	if _, err := conn.Write([]byte(requests)); err != nil {
+		t.Fatalf("write requests error: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+	for _, path := range paths {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("read response error: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != path {
+			t.Errorf("expected response of %s, but got %s", path, body)
+		}
+	}
+}
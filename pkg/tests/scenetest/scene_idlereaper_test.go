@@ -0,0 +1,105 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+)
+
+//connections read nothing for idle_timeout of listener are closed, active ones are kept
+func TestListenerIdleReaper(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].IdleTimeout.Duration = time.Second
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	idle := dialMesh(t, meshAddr)
+	defer idle.Close()
+	active := dialMesh(t, meshAddr)
+	defer active.Close()
+	expectConnAccepted(t, idle)
+
+	//the active connection sends a request more often than the timeout
+	start := time.Now()
+	closed := make(chan time.Duration, 1)
+	go func() {
+		idle.Read(make([]byte, 1))
+		closed <- time.Since(start)
+	}()
+	for time.Since(start) < 2500*time.Millisecond {
+		expectConnAccepted(t, active)
+		time.Sleep(300 * time.Millisecond)
+	}
+
+	select {
+	case cost := <-closed:
+		if cost < 900*time.Millisecond || cost > 2*time.Second {
+			t.Errorf("idle connection expect closed after 1s, but got %s\n", cost)
+		}
+	default:
+		t.Errorf("idle connection expect closed\n")
+	}
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+	if n := sink.counts["mosn_listener_idle_connections_reaped_total{listener=testListener}"]; n != 1 {
+		t.Errorf("expect 1 reaped connection recorded, got %v\n", sink.counts)
+	}
+}
+
+//a request in processing longer than idle_timeout of listener keeps the connection
+func TestListenerIdleReaperInFlight(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithDelay(2500*time.Millisecond))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].IdleTimeout.Duration = time.Second
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+	if resp := roundTripBoltV1(t, conn, buildBoltV1Request(GetStreamId())); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request in flight expect success, but got %d\n", resp.ResponseStatus)
+	}
+
+	//reaped once the request is done
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("idle connection expect closed after the request done, but got %v\n", err)
+	}
+}
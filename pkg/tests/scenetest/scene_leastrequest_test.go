@@ -0,0 +1,99 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/admin"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func fetchClustersStatus(t *testing.T, addr string) *admin.ClustersStatus {
+	resp, err := http.Get("http://" + addr + admin.ClustersPath)
+	if err != nil {
+		t.Fatalf("get clusters error: %v\n", err)
+	}
+	defer resp.Body.Close()
+	status := &admin.ClustersStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		t.Fatalf("decode clusters error: %v\n", err)
+	}
+	return status
+}
+
+//least request load balancer favors the host that drains requests faster,
+//active requests of hosts go back to zero when requests complete or time out
+func TestLeastRequestLoadBalancer(t *testing.T) {
+	fastAddr := "127.0.0.1:8080"
+	slowAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	adminAddr := "127.0.0.1:2046"
+	var fastCount, slowCount uint32
+	fastServer := NewUpstreamServer(t, fastAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SUCCESS, 5*time.Millisecond, &fastCount))
+	fastServer.GoServe()
+	defer fastServer.Close()
+	slowServer := NewUpstreamServer(t, slowAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SUCCESS, time.Second, &slowCount))
+	slowServer.GoServe()
+	defer slowServer.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{fastAddr, slowAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.ClusterManager.Clusters[0].LbType = "LB_LEAST_REQUEST"
+	mesh_config.Admin.Address = adminAddr
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	total := 200
+	results := make([]chan int16, 0, total)
+	for i := 0; i < total; i++ {
+		results = append(results, sendRequestWithTimeout(client, 300))
+		time.Sleep(10 * time.Millisecond)
+	}
+	timeouts := 0
+	for _, result := range results {
+		if status := waitStatus(t, result, 3*time.Second); status == sofarpc.RESPONSE_STATUS_TIMEOUT {
+			timeouts++
+		}
+	}
+
+	fast, slow := atomic.LoadUint32(&fastCount), atomic.LoadUint32(&slowCount)
+	if fast <= 2*slow {
+		t.Errorf("fast host expect most of the requests, but got fast %d, slow %d\n", fast, slow)
+	}
+	if timeouts == 0 || timeouts != int(slow) {
+		t.Errorf("requests to slow host expect timeout, but got %d timeouts of %d\n", timeouts, slow)
+	}
+
+	time.Sleep(100 * time.Millisecond) //wait streams cleaned
+	for _, cluster := range fetchClustersStatus(t, adminAddr).Clusters {
+		for _, host := range cluster.Hosts {
+			if host.ActiveRequests != 0 {
+				t.Errorf("host %s expect no active requests, but got %d\n", host.Address, host.ActiveRequests)
+			}
+		}
+	}
+}
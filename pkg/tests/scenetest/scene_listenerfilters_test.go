@@ -0,0 +1,85 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//two listeners share the cluster, only the public listener applies the rate limit filter
+func TestListenerStreamFilters(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	publicAddr := "127.0.0.1:2045"
+	internalAddr := "127.0.0.1:2046"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(publicAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	public := &mesh_config.Servers[0].Listeners[0]
+	internal := *public
+	internal.Name = "internalListener"
+	internal.Address = internalAddr
+	public.StreamFilters = []config.FilterConfig{
+		config.FilterConfig{
+			Type:   "rate_limit",
+			Config: map[string]interface{}{"rate": 0.01, "burst": 1.0},
+		},
+	}
+	mesh_config.Servers[0].Listeners = append(mesh_config.Servers[0].Listeners, internal)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	connect := func(addr string) *BoltV1Client {
+		client := &BoltV1Client{
+			t:        t,
+			ClientId: "client",
+			Waits:    cmap.New(),
+		}
+		if err := client.Connect(addr); err != nil {
+			t.Fatalf("connect to mesh failed: %v\n", err)
+		}
+		return client
+	}
+	publicClient := connect(publicAddr)
+	defer publicClient.conn.Close(types.NoFlush, types.LocalClose)
+	internalClient := connect(internalAddr)
+	defer internalClient.conn.Close(types.NoFlush, types.LocalClose)
+
+	if status := waitStatus(t, sendRequestWithStatus(publicClient), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request within burst expect success, but got %d\n", status)
+	}
+	if status := waitStatus(t, sendRequestWithStatus(publicClient), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("request exceeds rate limit of public listener expect status %d, but got %d\n",
+			sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, status)
+	}
+	//internal listener has no rate limit, and shares no filter state with the public one
+	for i := 0; i < 3; i++ {
+		if status := waitStatus(t, sendRequestWithStatus(internalClient), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Errorf("request to internal listener expect success, but got %d\n", status)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/admin"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//fetches prometheus metrics, returns the samples keyed by metric name with labels
+func fetchMetrics(t *testing.T, addr string) map[string]float64 {
+	resp, err := http.Get("http://" + addr + admin.MetricsPath)
+	if err != nil {
+		t.Fatalf("get metrics error: %v\n", err)
+	}
+	defer resp.Body.Close()
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if idx < 0 || err != nil {
+			t.Fatalf("invalid metrics line: %s\n", line)
+		}
+		samples[line[:idx]] = value
+	}
+	return samples
+}
+
+//cluster request metrics are exposed in prometheus format by admin server
+func TestPrometheusMetrics(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	adminAddr := "127.0.0.1:2046"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Admin.Address = adminAddr
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	labels := `{cluster="testCluster",protocol="SofaRpc"}`
+	success := `{cluster="testCluster",protocol="SofaRpc",status="success"}`
+	before := fetchMetrics(t, adminAddr)
+	for i := 0; i < 5; i++ {
+		if status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success, but got %d\n", status)
+		}
+	}
+	time.Sleep(100 * time.Millisecond) //wait streams cleaned
+	after := fetchMetrics(t, adminAddr)
+
+	for name, delta := range map[string]float64{
+		"mosn_cluster_requests_total" + labels:                 5,
+		"mosn_cluster_responses_total" + success:               5,
+		"mosn_cluster_request_duration_seconds_count" + labels: 5,
+	} {
+		if after[name]-before[name] != delta {
+			t.Errorf("%s expect increased by %v, but got %v -> %v\n", name, delta, before[name], after[name])
+		}
+	}
+	if after["mosn_cluster_requests_active"+labels] != 0 {
+		t.Errorf("expect no active requests, but got %v\n", after["mosn_cluster_requests_active"+labels])
+	}
+}
+
+//records metrics keyed by metric name with sorted tags
+type fakeMetricsSink struct {
+	mux        sync.Mutex
+	counts     map[string]int64
+	gauges     map[string][]int64
+	histograms map[string]int
+}
+
+func newFakeMetricsSink() *fakeMetricsSink {
+	return &fakeMetricsSink{
+		counts:     make(map[string]int64),
+		gauges:     make(map[string][]int64),
+		histograms: make(map[string]int),
+	}
+}
+
+func metricKey(name string, tags stats.Tags) string {
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		keys = append(keys, key+"="+value)
+	}
+	sort.Strings(keys)
+	return name + "{" + strings.Join(keys, ",") + "}"
+}
+
+func (s *fakeMetricsSink) Count(name string, value int64, tags stats.Tags) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.counts[metricKey(name, tags)] += value
+}
+
+func (s *fakeMetricsSink) Gauge(name string, delta int64, tags stats.Tags) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.gauges[metricKey(name, tags)] = append(s.gauges[metricKey(name, tags)], delta)
+}
+
+func (s *fakeMetricsSink) Histogram(name string, value float64, tags stats.Tags) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.histograms[metricKey(name, tags)]++
+}
+
+//the request lifecycle is recorded through the configured metrics sink
+func TestMetricsSink(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+	if status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", status)
+	}
+	time.Sleep(100 * time.Millisecond) //wait streams cleaned
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+	labels := "{cluster=testCluster,protocol=SofaRpc}"
+	if sink.counts["mosn_cluster_requests_total"+labels] != 1 {
+		t.Errorf("expect 1 request recorded, got %v\n", sink.counts)
+	}
+	if sink.counts["mosn_cluster_responses_total{cluster=testCluster,protocol=SofaRpc,status=success}"] != 1 {
+		t.Errorf("expect 1 success response recorded, got %v\n", sink.counts)
+	}
+	if active := sink.gauges["mosn_cluster_requests_active"+labels]; len(active) != 2 || active[0] != 1 || active[1] != -1 {
+		t.Errorf("expect active requests increased and decreased, got %v\n", active)
+	}
+	if sink.histograms["mosn_cluster_request_duration_seconds"+labels] != 1 {
+		t.Errorf("expect 1 latency recorded, got %v\n", sink.histograms)
+	}
+	//upstream counters of cluster are recorded with the cluster tag
+	if sink.counts["mosn_cluster_upstream_connection_total{cluster=testCluster}"] != 1 {
+		t.Errorf("expect 1 upstream connection recorded, got %v\n", sink.counts)
+	}
+}
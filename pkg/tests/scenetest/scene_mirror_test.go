@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+func startMirrorMesh(t *testing.T, meshAddr, sofaAddr, shadowAddr string, percent uint32) (*mosn.Mosn, *BoltV1Client) {
+	mesh_config := CreateMirrorMeshConfig(meshAddr, []string{sofaAddr}, []string{shadowAddr}, percent)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		mesh.Close()
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	return mesh, client
+}
+
+//requests are mirrored to the shadow cluster with the mirror tag, and mirrored requests are not mirrored again
+func TestMirror(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	shadowAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	shadowHeaders := make(chan map[string]string, 100)
+	shadow := NewUpstreamServer(t, shadowAddr, ServeBoltV1RecordHeaders(shadowHeaders))
+	shadow.GoServe()
+	defer shadow.Close()
+	mesh, client := startMirrorMesh(t, meshAddr, sofaAddr, shadowAddr, 100)
+	defer mesh.Close()
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	for i := 0; i < 10; i++ {
+		if s := waitStatus(t, sendRequestWithHeaders(client, map[string]string{"service": "testSofa"}), 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success, but got %d\n", s)
+		}
+		headers := waitHeaders(t, shadowHeaders, 3*time.Second)
+		if headers[types.HeaderMirror] == "" || headers["service"] != "testSofa" {
+			t.Errorf("unexpected mirrored request headers: %v\n", headers)
+		}
+	}
+
+	//already mirrored
+	if s := waitStatus(t, sendRequestWithHeaders(client, map[string]string{"service": "testSofa", types.HeaderMirror: "true"}), 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	select {
+	case headers := <-shadowHeaders:
+		t.Errorf("mirrored request should not be mirrored again, got %v\n", headers)
+	case <-time.After(time.Second):
+	}
+}
+
+//the shadow cluster receives the configured fraction of requests
+func TestMirrorPercent(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	shadowAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	shadowHeaders := make(chan map[string]string, 1000)
+	shadow := NewUpstreamServer(t, shadowAddr, ServeBoltV1RecordHeaders(shadowHeaders))
+	shadow.GoServe()
+	defer shadow.Close()
+	mesh, client := startMirrorMesh(t, meshAddr, sofaAddr, shadowAddr, 30)
+	defer mesh.Close()
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	total := 500
+	for i := 0; i < total; i++ {
+		if s := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success, but got %d\n", s)
+		}
+	}
+	time.Sleep(time.Second) //wait mirrored requests
+	//30% expected, with a loose bound for randomness
+	if mirrored := len(shadowHeaders); mirrored < total*15/100 || mirrored > total*45/100 {
+		t.Errorf("expect about 30%% of %d requests mirrored, but got %d\n", total, mirrored)
+	}
+}
+
+//a slow or unavailable shadow cluster does not affect the latency and result of primary requests
+func TestMirrorShadowUnhealthy(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	shadowAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	shadow := NewUpstreamServer(t, shadowAddr, ServeBoltV1WithDelay(5*time.Second))
+	shadow.GoServe()
+	mesh, client := startMirrorMesh(t, meshAddr, sofaAddr, shadowAddr, 100)
+	defer mesh.Close()
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	for i := 0; i < 5; i++ {
+		if s := waitStatus(t, sendRequestWithStatus(client), 500*time.Millisecond); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success with slow shadow, but got %d\n", s)
+		}
+	}
+	//shadow cluster down
+	shadow.Close()
+	for i := 0; i < 5; i++ {
+		if s := waitStatus(t, sendRequestWithStatus(client), 500*time.Millisecond); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success with shadow down, but got %d\n", s)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/tls"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func createCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create ca error: %v\n", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+//issues a certificate in pem signed by the ca, returns the certificate and private key
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate error: %v\n", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func (ca *testCA) issueClient(t *testing.T, cn, uri string) (string, string) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		u, _ := url.Parse(uri)
+		template.URIs = []*url.URL{u}
+	}
+	return ca.issue(t, template)
+}
+
+//mesh config with mutual tls listener, only requests with peer identity can be routed
+func CreateMTLSMeshConfig(addr string, hosts []string, ca *testCA, identity string, t *testing.T) *config.MOSNConfig {
+	clusterName := "testCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+	})
+	header := v2.HeaderMatcher{Name: types.HeaderPeerIdentity, Value: identity}
+	routerV2 := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
+		Route: v2.RouteAction{ClusterName: clusterName},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{routerV2}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	certPEM, keyPEM := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "mesh"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	})
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{
+			TLS: config.TLSConfig{
+				Status:       true,
+				CACert:       ca.pem,
+				CertChain:    certPEM,
+				PrivateKey:   keyPEM,
+				VerifyClient: true,
+			},
+			Filters: []config.FilterConfig{
+				config.FilterConfig{Type: "proxy", Config: filterChains},
+			},
+		},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+func connectMTLS(t *testing.T, addr string, ca *testCA, certPEM, keyPEM string) (*BoltV1Client, error) {
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+		TLSMng: tls.NewTLSClientContextManager(&v2.TLSConfig{
+			Status:     true,
+			CACert:     ca.pem,
+			CertChain:  certPEM,
+			PrivateKey: keyPEM,
+		}, nil),
+	}
+	return client, client.Connect(addr)
+}
+
+//listener verifies client certificates, and routes by the identity in the verified certificate
+func TestMTLSListener(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	identity := "spiffe://cluster.local/ns/default/sa/client"
+	upstreamHeaders := make(chan map[string]string, 1)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1RecordHeaders(upstreamHeaders))
+	server.GoServe()
+	defer server.Close()
+	ca := createCA(t)
+	mesh := mosn.NewMosn(CreateMTLSMeshConfig(meshAddr, []string{sofaAddr}, ca, identity, t))
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	//spiffe uri san is used as identity
+	certPEM, keyPEM := ca.issueClient(t, "client", identity)
+	client, err := connectMTLS(t, meshAddr, ca, certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("connect with trusted client certificate failed: %v\n", err)
+	}
+	if status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request with matched identity expect success, but got %d\n", status)
+	}
+	if headers := waitHeaders(t, upstreamHeaders, time.Second); headers[types.HeaderPeerIdentity] != "" {
+		t.Errorf("peer identity should not be sent to upstream, but got %s\n", headers[types.HeaderPeerIdentity])
+	}
+	client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//common name is used as identity without spiffe uri san, which is not routed
+	certPEM, keyPEM = ca.issueClient(t, "other", "")
+	client, err = connectMTLS(t, meshAddr, ca, certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("connect with trusted client certificate failed: %v\n", err)
+	}
+	if status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); status == sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request with unmatched identity expect failure\n")
+	}
+	client.conn.Close(types.NoFlush, types.LocalClose)
+}
+
+//client certificate not signed by the configured ca is rejected in tls handshake
+func TestMTLSListenerUntrustedClient(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	ca := createCA(t)
+	mesh := mosn.NewMosn(CreateMTLSMeshConfig(meshAddr, []string{sofaAddr}, ca, "client", t))
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	certPEM, keyPEM := createCA(t).issueClient(t, "client", "")
+	if _, err := connectMTLS(t, meshAddr, ca, certPEM, keyPEM); err == nil {
+		t.Errorf("connect with untrusted client certificate should fail\n")
+	}
+}
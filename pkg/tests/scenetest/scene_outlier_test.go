@@ -0,0 +1,86 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+)
+
+// the upstream host keeps returning 5xx is ejected by outlier detection, and the status is sent to downstream
+func TestHttpOutlierDetection(t *testing.T) {
+	badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer badServer.Close()
+	goodServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer goodServer.Close()
+
+	meshAddr := "127.0.0.1:2045"
+	meshConfig := CreateSimpleMeshConfig(meshAddr, []string{GetServerAddr(badServer), GetServerAddr(goodServer)},
+		protocol.Http1, protocol.Http1)
+	meshConfig.ClusterManager.Clusters[0].OutlierDetection = config.ClusterOutlierDetectionConfig{
+		ConsecutiveErrors:  3,
+		BaseEjectionTime:   config.DurationConfig{Duration: time.Minute},
+		MaxEjectionPercent: 50,
+	}
+	mesh := mosn.NewMosn(meshConfig)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	request := func() int {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/", meshAddr), nil)
+		if err != nil {
+			t.Fatalf("create request error:%v\n", err)
+		}
+		req.Header.Add("service", "testCluster")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request error:%v\n", err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	// requests are balanced in round robin until the bad host is ejected
+	unavailable := 0
+	for i := 0; i < 6; i++ {
+		if request() == http.StatusServiceUnavailable {
+			unavailable++
+		}
+	}
+	if unavailable != 3 {
+		t.Errorf("expected 3 responses of status 503 before ejection, but got %d\n", unavailable)
+	}
+
+	for i := 0; i < 10; i++ {
+		if status := request(); status != http.StatusOK {
+			t.Errorf("expected status 200 after ejection, but got %d\n", status)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol/redis"
+)
+
+//fakeRedis is an in-memory redis server supports GET, SET and MGET
+type fakeRedis struct {
+	mux   sync.Mutex
+	store map[string]string
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{store: make(map[string]string)}
+}
+
+func (r *fakeRedis) get(key string) (string, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	v, ok := r.store[key]
+	return v, ok
+}
+
+func (r *fakeRedis) bulk(key string) string {
+	if v, ok := r.get(key); ok {
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	}
+	return "$-1\r\n"
+}
+
+func (r *fakeRedis) ServeConn(t *testing.T, conn net.Conn) {
+	var data []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		data = append(data, buf[:n]...)
+		for {
+			cmd, read, err := redis.DecodeCommand(data)
+			if err != nil {
+				t.Errorf("fake redis decode command failed: %v\n", err)
+				return
+			}
+			if read == 0 {
+				break
+			}
+			data = data[read:]
+			if cmd == nil {
+				continue
+			}
+			var reply string
+			switch cmd.Name() {
+			case "set":
+				r.mux.Lock()
+				r.store[string(cmd.Args[1])] = string(cmd.Args[2])
+				r.mux.Unlock()
+				reply = "+OK\r\n"
+			case "get":
+				reply = r.bulk(string(cmd.Args[1]))
+			case "mget":
+				reply = fmt.Sprintf("*%d\r\n", len(cmd.Args)-1)
+				for _, key := range cmd.Args[1:] {
+					reply += r.bulk(string(key))
+				}
+			default:
+				reply = fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd.Name())
+			}
+			if _, err := conn.Write([]byte(reply)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+//readReply reads a simple reply line, and the data line of a bulk reply
+func readReply(t *testing.T, r *bufio.Reader) string {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read reply failed: %v\n", err)
+	}
+	if strings.HasPrefix(line, "$") && line != "$-1\r\n" {
+		data, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read bulk reply failed: %v\n", err)
+		}
+		line += data
+	}
+	return line
+}
+
+//commands should be sharded to the redis servers by the key hash,
+//and multi-key commands across servers should be rejected
+func TestRedisProxy(t *testing.T) {
+	meshAddr := "127.0.0.1:2045"
+	serverAddrs := []string{
+		"127.0.0.1:8080",
+		"127.0.0.1:8081",
+	}
+	var servers []*fakeRedis
+	for _, addr := range serverAddrs {
+		fake := newFakeRedis()
+		servers = append(servers, fake)
+		server := NewUpstreamServer(t, addr, fake.ServeConn)
+		server.GoServe()
+		defer server.Close()
+	}
+	mesh_config := CreateRedisProxyConfig(meshAddr, serverAddrs)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	conn, err := net.Dial("tcp", meshAddr)
+	if err != nil {
+		t.Fatalf("dial mesh failed: %v\n", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	command := func(args ...string) string {
+		cmd := &redis.Command{}
+		for _, arg := range args {
+			cmd.Args = append(cmd.Args, []byte(arg))
+		}
+		if _, err := conn.Write(cmd.Encode()); err != nil {
+			t.Fatalf("write command failed: %v\n", err)
+		}
+		return readReply(t, reader)
+	}
+
+	if reply := command("PING"); reply != "+PONG\r\n" {
+		t.Errorf("expected PONG, but got %q\n", reply)
+	}
+
+	keys := []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7"}
+	for _, key := range keys {
+		if reply := command("SET", key, "v-"+key); reply != "+OK\r\n" {
+			t.Errorf("set %s expected OK, but got %q\n", key, reply)
+		}
+	}
+	owner := make(map[string]int)
+	for _, key := range keys {
+		for i, server := range servers {
+			if _, ok := server.get(key); ok {
+				if _, dup := owner[key]; dup {
+					t.Errorf("key %s is stored on more than one server\n", key)
+				}
+				owner[key] = i
+			}
+		}
+		expected := fmt.Sprintf("$%d\r\nv-%s\r\n", len("v-"+key), key)
+		if reply := command("GET", key); reply != expected {
+			t.Errorf("get %s expected %q, but got %q\n", key, expected, reply)
+		}
+	}
+
+	//inline commands are forwarded too
+	if _, err := conn.Write([]byte("GET k0\r\n")); err != nil {
+		t.Fatalf("write inline command failed: %v\n", err)
+	}
+	if reply := readReply(t, reader); reply != "$4\r\nv-k0\r\n" {
+		t.Errorf("inline get expected v-k0, but got %q\n", reply)
+	}
+
+	var crossKey string
+	for _, key := range keys {
+		if owner[key] != owner["k0"] {
+			crossKey = key
+			break
+		}
+	}
+	if crossKey == "" {
+		t.Fatalf("keys should be sharded to all servers, but got %v\n", owner)
+	}
+	if reply := command("MGET", "k0", crossKey); !strings.HasPrefix(reply, "-CROSSSLOT") {
+		t.Errorf("cross server MGET expected CROSSSLOT error, but got %q\n", reply)
+	}
+
+	if reply := command("KEYS", "*"); !strings.HasPrefix(reply, "-ERR") {
+		t.Errorf("unsupported command expected error, but got %q\n", reply)
+	}
+}
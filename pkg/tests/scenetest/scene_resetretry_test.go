@@ -0,0 +1,170 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+const (
+	//the connection is closed once the request is received
+	resetBeforeResponse = "before_response"
+	//the connection is closed after a part of the response is written
+	resetMidResponse = "mid_response"
+)
+
+//SofaRpc Serve, a request is failed by the fault taken from faults if any,
+//otherwise it is served normally. Requests received are counted
+func ServeBoltV1WithReset(faults chan string, count *uint32) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		iobuf := buffer.NewIoBuffer(102400)
+		for {
+			conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			buf := make([]byte, 10*1024)
+			bytesRead, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:bytesRead])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				req, ok := cmd.(*sofarpc.BoltRequestCommand)
+				if !ok {
+					continue
+				}
+				atomic.AddUint32(count, 1)
+				_, resp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Resposne(req))
+				var fault string
+				select {
+				case fault = <-faults:
+				default:
+				}
+				switch fault {
+				case resetBeforeResponse:
+					conn.Close()
+					return
+				case resetMidResponse:
+					conn.Write(resp.Bytes()[:10])
+					time.Sleep(100 * time.Millisecond)
+					conn.Close()
+					return
+				}
+				conn.Write(resp.Bytes())
+			}
+		}
+	}
+}
+
+func startResetRetryMesh(t *testing.T, meshAddr, sofaAddr string, retryPolicy *v2.RetryPolicy) (*mosn.Mosn, *BoltV1Client) {
+	mesh_config := CreateRetryMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc, retryPolicy)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		mesh.Close()
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	return mesh, client
+}
+
+//requests marked idempotent by bolt header are retried on a fresh connection if the upstream connection
+//is reset before any response, but not if the response is received partially, or not marked idempotent
+func TestRetryOnResetBeforeResponse(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	faults := make(chan string, 1)
+	var count uint32
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithReset(faults, &count))
+	server.GoServe()
+	defer server.Close()
+	mesh, client := startResetRetryMesh(t, meshAddr, sofaAddr, nil)
+	defer mesh.Close()
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		fault   string
+		retried bool
+	}{
+		{"not idempotent", map[string]string{"service": "testSofa"}, resetBeforeResponse, false},
+		{"idempotent", map[string]string{"service": "testSofa", types.HeaderIdempotent: "true"}, resetBeforeResponse, true},
+		{"reset mid response", map[string]string{"service": "testSofa", types.HeaderIdempotent: "true"}, resetMidResponse, false},
+	}
+	for _, c := range cases {
+		atomic.StoreUint32(&count, 0)
+		faults <- c.fault
+		status := waitStatus(t, sendRequestWithHeaders(client, c.headers), 3*time.Second)
+		if c.retried {
+			if status != sofarpc.RESPONSE_STATUS_SUCCESS {
+				t.Errorf("%s: request expect retried and success, but got %d\n", c.name, status)
+			}
+			if got := atomic.LoadUint32(&count); got != 2 {
+				t.Errorf("%s: upstream expect 2 requests, but got %d\n", c.name, got)
+			}
+		} else {
+			if status == sofarpc.RESPONSE_STATUS_SUCCESS {
+				t.Errorf("%s: request expect failed without retry, but got success\n", c.name)
+			}
+			if got := atomic.LoadUint32(&count); got != 1 {
+				t.Errorf("%s: upstream expect 1 request, but got %d\n", c.name, got)
+			}
+		}
+	}
+}
+
+//requests of the route configured idempotent are retried on the upstream reset before any response
+func TestIdempotentRouteRetryOnReset(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	faults := make(chan string, 1)
+	var count uint32
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithReset(faults, &count))
+	server.GoServe()
+	defer server.Close()
+	mesh, client := startResetRetryMesh(t, meshAddr, sofaAddr, &v2.RetryPolicy{Idempotent: true})
+	defer mesh.Close()
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	faults <- resetBeforeResponse
+	if s := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request expect retried and success, but got %d\n", s)
+	}
+	if got := atomic.LoadUint32(&count); got != 2 {
+		t.Errorf("upstream expect 2 requests, but got %d\n", got)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+//successful responses of the cached classes are replied by mosn until the ttl expires,
+//failed responses are not cached
+func TestResponseCache(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	busyAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	busyMeshAddr := "127.0.0.1:2046"
+	var count, busyCount uint32
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SUCCESS, 0, &count))
+	server.GoServe()
+	defer server.Close()
+	busyServer := NewUpstreamServer(t, busyAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, 0, &busyCount))
+	busyServer.GoServe()
+	defer busyServer.Close()
+	cacheFilter := config.FilterConfig{
+		Type: "response_cache",
+		Config: map[string]interface{}{
+			"class_names": []interface{}{"com.alipay.test.QueryService"},
+			"ttl":         "1s",
+		},
+	}
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].StreamFilters = []config.FilterConfig{cacheFilter}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	busy_config := CreateSimpleMeshConfig(busyMeshAddr, []string{busyAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	busy_config.Servers[0].Listeners[0].StreamFilters = []config.FilterConfig{cacheFilter}
+	busyMesh := mosn.NewMosn(busy_config)
+	go busyMesh.Start()
+	defer busyMesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+	busyClient := connectBoltV1Client(t, busyMeshAddr)
+	defer busyClient.conn.Close(types.NoFlush, types.LocalClose)
+
+	expect := func(client *BoltV1Client, className string, status int16, count *uint32, upstreamCount uint32) {
+		if s := waitStatus(t, sendClassRequestWithTimeout(client, className, -1), 3*time.Second); s != status {
+			t.Errorf("request of %s expect status %d, but got %d\n", className, status, s)
+		}
+		if c := atomic.LoadUint32(count); c != upstreamCount {
+			t.Errorf("request of %s expect %d requests to upstream, but got %d\n", className, upstreamCount, c)
+		}
+	}
+
+	expect(client, "com.alipay.test.QueryService", sofarpc.RESPONSE_STATUS_SUCCESS, &count, 1)
+	//replied from cache with the request id of the request
+	expect(client, "com.alipay.test.QueryService", sofarpc.RESPONSE_STATUS_SUCCESS, &count, 1)
+	//class not cached
+	expect(client, "com.alipay.test.PayService", sofarpc.RESPONSE_STATUS_SUCCESS, &count, 2)
+	time.Sleep(time.Second) //wait ttl expires
+	expect(client, "com.alipay.test.QueryService", sofarpc.RESPONSE_STATUS_SUCCESS, &count, 3)
+
+	//failed responses are not cached
+	expect(busyClient, "com.alipay.test.QueryService", sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, &busyCount, 1)
+	expect(busyClient, "com.alipay.test.QueryService", sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, &busyCount, 2)
+}
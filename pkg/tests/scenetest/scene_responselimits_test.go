@@ -0,0 +1,106 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/stats"
+)
+
+const responseTooLargeMetric = "mosn_cluster_upstream_response_too_large{cluster=testCluster}"
+
+//SofaRpc Serve, responses with the content as large as the request content
+func serveBoltV1EchoContentLen(t *testing.T, conn net.Conn) {
+	iobuf := buffer.NewIoBuffer(102400)
+	for {
+		buf := make([]byte, 10*1024)
+		bytesRead, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		iobuf.Write(buf[:bytesRead])
+		for iobuf.Len() > 1 {
+			_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+			if cmd == nil {
+				break
+			}
+			if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+				resp := buildBoltV1Resposne(req)
+				resp.ContentLen = req.ContentLen
+				_, respHeaders := codec.BoltV1.GetEncoder().EncodeHeaders(nil, resp)
+				conn.Write(respHeaders.Bytes())
+				conn.Write(make([]byte, req.ContentLen))
+			}
+		}
+	}
+}
+
+func roundTripBoltV1WithContent(t *testing.T, conn net.Conn, contentLen int) (*sofarpc.BoltRequestCommand, *sofarpc.BoltResponseCommand) {
+	req := buildBoltV1Request(GetStreamId())
+	req.ContentLen = contentLen
+	_, buf := codec.BoltV1.GetEncoder().EncodeHeaders(nil, req)
+	if _, err := conn.Write(append(buf.Bytes(), make([]byte, contentLen)...)); err != nil {
+		t.Fatalf("write request failed: %v\n", err)
+	}
+	return req, readBoltV1Response(t, conn)
+}
+
+//responses larger than max_response_content_len of cluster are rejected,
+//other requests on the same connections are not affected
+func TestResponseLimits(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, serveBoltV1EchoContentLen)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.ClusterManager.Clusters[0].MaxResponseContentLen = 1024
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+
+	if _, resp := roundTripBoltV1WithContent(t, conn, 1024); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS || resp.ContentLen != 1024 {
+		t.Errorf("response within the limits should be passed, but got status %d, content %d\n", resp.ResponseStatus, resp.ContentLen)
+	}
+	req, resp := roundTripBoltV1WithContent(t, conn, 4096)
+	expectErrorResponse(t, req, resp, sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION)
+	if resp.ContentLen != 0 {
+		t.Errorf("response too large should not be forwarded, but got content %d\n", resp.ContentLen)
+	}
+	if _, resp := roundTripBoltV1WithContent(t, conn, 16); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS || resp.ContentLen != 16 {
+		t.Errorf("response after the rejected one should be passed, but got status %d, content %d\n", resp.ResponseStatus, resp.ContentLen)
+	}
+	sink.mux.Lock()
+	if n := sink.counts[responseTooLargeMetric]; n != 1 {
+		t.Errorf("expect 1 response too large, but got %d\n", n)
+	}
+	sink.mux.Unlock()
+}
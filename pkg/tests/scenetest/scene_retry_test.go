@@ -0,0 +1,324 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+	"github.com/rcrowley/go-metrics"
+)
+
+//records the response status of each request
+type statusBoltV1Client struct {
+	BoltV1Client
+	status cmap.ConcurrentMap
+}
+
+func (c *statusBoltV1Client) SendRequest() {
+	id := GetStreamId()
+	streamId := sofarpc.StreamIDConvert(id)
+	requestEncoder := c.Codec.NewStream(streamId, c)
+	requestEncoder.AppendHeaders(buildBoltV1Request(id), true)
+	c.Waits.Set(streamId, streamId)
+}
+
+func (c *statusBoltV1Client) OnReceiveHeaders(headers map[string]string, endStream bool) {
+	streamId := headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderReqID)]
+	if _, ok := c.Waits.Get(streamId); ok {
+		c.status.Set(streamId, headers[sofarpc.SofaPropertyHeader(sofarpc.HeaderRespStatus)])
+		c.Waits.Remove(streamId)
+	}
+}
+
+//a SERVER_BUSY response should be retried on another host,
+//and the SUCCESS response of the retry is returned to the client
+func TestRetryOnServerBusy(t *testing.T) {
+	meshAddr := "127.0.0.1:2045"
+	busyAddr := "127.0.0.1:8080"
+	successAddr := "127.0.0.1:8081"
+	var busyCount uint32
+	busyServe := ServeBoltV1WithStatus(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)
+	busyServer := NewUpstreamServer(t, busyAddr, func(t *testing.T, conn net.Conn) {
+		atomic.AddUint32(&busyCount, 1)
+		busyServe(t, conn)
+	})
+	busyServer.GoServe()
+	defer busyServer.Close()
+	successServer := NewUpstreamServer(t, successAddr, ServeBoltV1)
+	successServer.GoServe()
+	defer successServer.Close()
+	retryPolicy := &v2.RetryPolicy{
+		RetryOn:       true,
+		NumRetries:    1,
+		RetryOnStatus: []int{int(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)},
+	}
+	mesh_config := CreateRetryMeshConfig(meshAddr, []string{busyAddr, successAddr}, protocol.SofaRpc, protocol.SofaRpc, retryPolicy)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &statusBoltV1Client{
+		BoltV1Client: BoltV1Client{
+			t:        t,
+			ClientId: "testClient",
+			Waits:    cmap.New(),
+		},
+		status: cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+	for i := 0; i < 10; i++ {
+		client.SendRequest()
+		time.Sleep(100 * time.Millisecond)
+	}
+	<-time.After(5 * time.Second) //wait request finish
+	if !client.Waits.IsEmpty() {
+		t.Errorf("some request get no response\n")
+	}
+	if atomic.LoadUint32(&busyCount) == 0 {
+		t.Errorf("no request is sent to the busy server\n")
+	}
+	for streamId, status := range client.status.Items() {
+		if status.(string) != "0" {
+			t.Errorf("request %s expected status SUCCESS, but got %s\n", streamId, status)
+		}
+	}
+}
+
+//serves bolt requests concurrently, responses with the status after delay
+func ServeBoltV1ConcurrentWithStatus(status int16, delay time.Duration, count *uint32) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		var writeMux sync.Mutex
+		iobuf := buffer.NewIoBuffer(102400)
+		for {
+			buf := make([]byte, 10*1024)
+			bytesRead, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:bytesRead])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+					atomic.AddUint32(count, 1)
+					go func() {
+						time.Sleep(delay)
+						_, resp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1ResposneWithStatus(req, status))
+						writeMux.Lock()
+						conn.Write(resp.Bytes())
+						writeMux.Unlock()
+					}()
+				}
+			}
+		}
+	}
+}
+
+//retries in flight are limited by the retry budget of cluster, the requests with retry suppressed
+//get the original error
+func TestRetryBudget(t *testing.T) {
+	meshAddr := "127.0.0.1:2045"
+	busyAddr := "127.0.0.1:8080"
+	var requestCount uint32
+	busyServer := NewUpstreamServer(t, busyAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, 300*time.Millisecond, &requestCount))
+	busyServer.GoServe()
+	defer busyServer.Close()
+	retryPolicy := &v2.RetryPolicy{
+		RetryOn:       true,
+		NumRetries:    1,
+		RetryOnStatus: []int{int(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)},
+	}
+	mesh_config := CreateRetryMeshConfig(meshAddr, []string{busyAddr}, protocol.SofaRpc, protocol.SofaRpc, retryPolicy)
+	mesh_config.ClusterManager.Clusters[0].CircuitBreakers = []*config.CircuitBreakerdConfig{
+		&config.CircuitBreakerdConfig{
+			Priority:    "default",
+			RetryBudget: &config.RetryBudgetConfig{BudgetPercent: 1, MinRetryConcurrency: 1},
+		},
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	retried := metrics.GetOrRegisterCounter("cluster.testCluster.upstream_request_retry", nil)
+	suppressed := metrics.GetOrRegisterCounter("cluster.testCluster.upstream_request_retry_budget_exceeded", nil)
+	retriedBefore, suppressedBefore := retried.Count(), suppressed.Count()
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//a single failed request is retried under budget
+	if status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, status)
+	}
+	if n := atomic.LoadUint32(&requestCount); n != 2 {
+		t.Errorf("expect the request retried once, but upstream got %d requests\n", n)
+	}
+	if retried.Count()-retriedBefore != 1 || suppressed.Count() != suppressedBefore {
+		t.Errorf("expect 1 retry under budget, got %d retries and %d suppressed\n",
+			retried.Count()-retriedBefore, suppressed.Count()-suppressedBefore)
+	}
+
+	//requests failed together, only one retry is allowed in flight
+	var waits []chan int16
+	for i := 0; i < 4; i++ {
+		waits = append(waits, sendRequestWithStatus(client))
+	}
+	for _, wait := range waits {
+		if status := waitStatus(t, wait, 3*time.Second); status != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+			t.Errorf("expect original status %d, but got %d\n", sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, status)
+		}
+	}
+	if n := atomic.LoadUint32(&requestCount); n != 2+5 {
+		t.Errorf("expect only one of the requests retried, but upstream got %d requests\n", n-2)
+	}
+	if retried.Count()-retriedBefore != 2 || suppressed.Count()-suppressedBefore != 3 {
+		t.Errorf("expect 1 retry and 3 suppressed by budget, got %d retries and %d suppressed\n",
+			retried.Count()-retriedBefore-1, suppressed.Count()-suppressedBefore)
+	}
+}
+
+//requests are retried 3 times by default if the retry policy has no NumRetries
+func TestRetryDefaultTimes(t *testing.T) {
+	meshAddr := "127.0.0.1:2045"
+	busyAddr := "127.0.0.1:8080"
+	var requestCount uint32
+	busyServer := NewUpstreamServer(t, busyAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, 0, &requestCount))
+	busyServer.GoServe()
+	defer busyServer.Close()
+	retryPolicy := &v2.RetryPolicy{
+		RetryOn:       true,
+		RetryOnStatus: []int{int(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)},
+	}
+	mesh_config := CreateRetryMeshConfig(meshAddr, []string{busyAddr}, protocol.SofaRpc, protocol.SofaRpc, retryPolicy)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	if status := waitStatus(t, sendRequestWithStatus(client), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, status)
+	}
+	if n := atomic.LoadUint32(&requestCount); n != 1+3 {
+		t.Errorf("expect the request retried 3 times, but upstream got %d requests\n", n)
+	}
+}
+
+//routes requests of the services to the clusters of the same name, with the retry policy of route
+func CreateClusterRetryMeshConfig(addr string, clusterHosts map[string]string, retryPolicy *v2.RetryPolicy) *config.MOSNConfig {
+	var clusters []cluster
+	var routers []v2.Router
+	for name, host := range clusterHosts {
+		clusters = append(clusters, cluster{name: name, hosts: []string{host}})
+		routers = append(routers, v2.Router{
+			Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{{Name: "service", Value: name}}},
+			Route: v2.RouteAction{ClusterName: name, RetryPolicy: retryPolicy},
+		})
+	}
+	cmconfig := CreateBasicClusterConfig(clusters)
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: routers},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//SERVER_BUSY is retried for the cluster using the retry statuses of route, and is terminal
+//for the cluster overriding them with its own retry statuses
+func TestRetryOnClusterStatus(t *testing.T) {
+	meshAddr := "127.0.0.1:2045"
+	retriableAddr := "127.0.0.1:8080"
+	terminalAddr := "127.0.0.1:8081"
+	var retriableCount, terminalCount uint32
+	retriableServer := NewUpstreamServer(t, retriableAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, 0, &retriableCount))
+	retriableServer.GoServe()
+	defer retriableServer.Close()
+	terminalServer := NewUpstreamServer(t, terminalAddr, ServeBoltV1ConcurrentWithStatus(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, 0, &terminalCount))
+	terminalServer.GoServe()
+	defer terminalServer.Close()
+	retryPolicy := &v2.RetryPolicy{
+		RetryOn:       true,
+		NumRetries:    1,
+		RetryOnStatus: []int{int(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)},
+	}
+	mesh_config := CreateClusterRetryMeshConfig(meshAddr, map[string]string{
+		"busyRetriable": retriableAddr,
+		"busyTerminal":  terminalAddr,
+	}, retryPolicy)
+	for i := range mesh_config.ClusterManager.Clusters {
+		if mesh_config.ClusterManager.Clusters[i].Name == "busyTerminal" {
+			mesh_config.ClusterManager.Clusters[i].RetryOnStatus = []int{int(sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION)}
+		}
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	for i := 0; i < 5; i++ {
+		for _, service := range []string{"busyRetriable", "busyTerminal"} {
+			if status := waitStatus(t, sendRequestWithHeaders(client, map[string]string{"service": service}), 3*time.Second); status != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+				t.Errorf("expect status %d of %s, but got %d\n", sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, service, status)
+			}
+		}
+	}
+	if n := atomic.LoadUint32(&retriableCount); n != 10 {
+		t.Errorf("expect each request to busyRetriable retried once, but upstream got %d requests of 5\n", n)
+	}
+	if n := atomic.LoadUint32(&terminalCount); n != 5 {
+		t.Errorf("expect no request to busyTerminal retried, but upstream got %d requests of 5\n", n)
+	}
+}
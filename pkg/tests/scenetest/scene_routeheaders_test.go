@@ -0,0 +1,101 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//headers configured by the route are added and removed in bolt frames of both directions
+func TestRouteHeaders(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	upstreamHeaders := make(chan map[string]string, 1)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1RecordHeaders(upstreamHeaders))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateRouteActionMeshConfig(meshAddr, []string{sofaAddr}, v2.RouteAction{
+		RequestHeadersToAdd: []v2.HeaderValueOption{
+			{Key: "route-tag", Value: "gray"},
+			{Key: "zone", Value: "gz00b", Append: true},
+			{Key: "app", Value: "mosn"},
+		},
+		RequestHeadersToRemove: []string{"internal-token"},
+		ResponseHeadersToAdd: []v2.HeaderValueOption{
+			{Key: "served-by", Value: "mosn"},
+		},
+		ResponseHeadersToRemove: []string{"route-tag"},
+	})
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	id := GetStreamId()
+	request := buildBoltV1Request(id)
+	headerBytes, _ := serialize.Instance.Serialize(map[string]string{
+		"service":        "testSofa",
+		"internal-token": "secret",
+		"zone":           "gz00a",
+		"app":            "client",
+	})
+	request.HeaderMap = headerBytes
+	request.HeaderLen = int16(len(headerBytes))
+	receiver := &headersReceiver{headers: make(chan map[string]string, 1)}
+	client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver).AppendHeaders(request, true)
+
+	reqHeaders := waitHeaders(t, upstreamHeaders, 3*time.Second)
+	for key, value := range map[string]string{
+		"service":   "testSofa",
+		"route-tag": "gray",
+		"zone":      "gz00a,gz00b", // appended
+		"app":       "mosn",        // overwritten
+	} {
+		if reqHeaders[key] != value {
+			t.Errorf("upstream frame expect header %s: %s, but got %v\n", key, value, reqHeaders)
+		}
+	}
+	if _, ok := reqHeaders["internal-token"]; ok {
+		t.Errorf("removed header found in upstream frame: %v\n", reqHeaders)
+	}
+
+	//upstream echoes request headers, the tag added to request is removed in response
+	respHeaders := waitHeaders(t, receiver.headers, 3*time.Second)
+	if respHeaders["served-by"] != "mosn" {
+		t.Errorf("added header not found in response: %v\n", respHeaders)
+	}
+	if _, ok := respHeaders["route-tag"]; ok {
+		t.Errorf("removed header found in response: %v\n", respHeaders)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/admin"
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+//weighted mesh config, requests are split between the stable and canary clusters by weight
+func CreateWeightedMeshConfig(addr string, stableHost, canaryHost string, stableWeight, canaryWeight uint32) *config.MOSNConfig {
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: "stableCluster", hosts: []string{stableHost}},
+		cluster{name: "canaryCluster", hosts: []string{canaryHost}},
+	})
+	weightedRouter := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{{Name: "service", Value: ".*"}}},
+		Route: v2.RouteAction{
+			WeightedClusters: []v2.WeightedCluster{
+				{Clusters: v2.ClusterWeight{Name: "stableCluster", Weight: stableWeight}},
+				{Clusters: v2.ClusterWeight{Name: "canaryCluster", Weight: canaryWeight}},
+			},
+		},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{weightedRouter}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//sends requests and returns the number of them routed to stable and canary hosts
+func sendWeightedRequests(t *testing.T, client *BoltV1Client, total int, stableHeaders, canaryHeaders chan map[string]string) (int, int) {
+	results := make([]chan int16, 0, total)
+	for i := 0; i < total; i++ {
+		results = append(results, sendRequestWithHeaders(client, map[string]string{"service": "testSofa"}))
+	}
+	for _, result := range results {
+		if s := waitStatus(t, result, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request expect success, but got %d\n", s)
+		}
+	}
+	stable, canary := len(stableHeaders), len(canaryHeaders)
+	for len(stableHeaders) > 0 {
+		<-stableHeaders
+	}
+	for len(canaryHeaders) > 0 {
+		<-canaryHeaders
+	}
+	return stable, canary
+}
+
+//requests are split by the weights of clusters, the weights updated by admin api take effect
+//on the following requests, and the requests in flight are not affected
+func TestRouteWeightsUpdate(t *testing.T) {
+	stableAddr := "127.0.0.1:8080"
+	canaryAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	adminAddr := "127.0.0.1:2046"
+	stableHeaders := make(chan map[string]string, 1000)
+	stableServer := NewUpstreamServer(t, stableAddr, ServeBoltV1RecordHeaders(stableHeaders))
+	stableServer.GoServe()
+	defer stableServer.Close()
+	canaryHeaders := make(chan map[string]string, 1000)
+	canaryServer := NewUpstreamServer(t, canaryAddr, ServeBoltV1RecordHeaders(canaryHeaders))
+	canaryServer.GoServe()
+	defer canaryServer.Close()
+	mesh_config := CreateWeightedMeshConfig(meshAddr, stableAddr, canaryAddr, 90, 10)
+	mesh_config.Admin.Address = adminAddr
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	total := 500
+	//10% expected, with a loose bound for randomness
+	if stable, canary := sendWeightedRequests(t, client, total, stableHeaders, canaryHeaders); canary < total*5/100 || canary > total*15/100 || stable+canary != total {
+		t.Errorf("expect about 10%% of %d requests routed to canary, got canary %d, stable %d\n", total, canary, stable)
+	}
+
+	//requests in flight while updating weights complete
+	inflight := make([]chan int16, 0, 100)
+	for i := 0; i < 100; i++ {
+		inflight = append(inflight, sendRequestWithHeaders(client, map[string]string{"service": "testSofa"}))
+	}
+	weightsURL := "http://" + adminAddr + admin.RouteWeightsPath + "?listener=testListener&virtual_host=testHost&index=0"
+	req, _ := http.NewRequest(http.MethodPut, weightsURL, strings.NewReader(`{"weights":[1,1]}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("update route weights failed: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update route weights expect status %d, but got %d\n", http.StatusOK, resp.StatusCode)
+	}
+	for _, result := range inflight {
+		if s := waitStatus(t, result, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("request in flight expect success, but got %d\n", s)
+		}
+	}
+	for len(stableHeaders) > 0 {
+		<-stableHeaders
+	}
+	for len(canaryHeaders) > 0 {
+		<-canaryHeaders
+	}
+
+	//50% expected after the weights normalized
+	if stable, canary := sendWeightedRequests(t, client, total, stableHeaders, canaryHeaders); canary < total*40/100 || canary > total*60/100 || stable+canary != total {
+		t.Errorf("expect about 50%% of %d requests routed to canary after weights updated, got canary %d, stable %d\n", total, canary, stable)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+//source ip mesh config, requests from the test vlan are routed to the dedicated cluster,
+//the listener reads the real client ip from PROXY protocol header
+func CreateSourceIPMeshConfig(addr string, defaultHost, vlanHost string) *config.MOSNConfig {
+	cmconfig := config.ClusterManagerConfig{
+		Clusters: []config.ClusterConfig{
+			config.ClusterConfig{
+				Name:                 "testCluster",
+				Type:                 "SIMPLE",
+				LbType:               "LB_RANDOM",
+				MaxRequestPerConn:    1024,
+				ConnBufferLimitBytes: 16 * 1026,
+				Hosts:                []v2.Host{{Address: defaultHost, Weight: 100}},
+			},
+			config.ClusterConfig{
+				Name:                 "vlanCluster",
+				Type:                 "SIMPLE",
+				LbType:               "LB_RANDOM",
+				MaxRequestPerConn:    1024,
+				ConnBufferLimitBytes: 16 * 1026,
+				Hosts:                []v2.Host{{Address: vlanHost, Weight: 100}},
+			},
+		},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{
+				{
+					Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{{Name: "service", Value: ".*"}}},
+					Route: v2.RouteAction{ClusterName: "testCluster"},
+				},
+				{
+					Match: v2.RouterMatch{SourceCIDRs: []string{"10.8.0.0/16"}},
+					Route: v2.RouteAction{ClusterName: "vlanCluster"},
+				},
+			}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	meshConfig := CreateMeshConfig(addr, proxyconfig, cmconfig)
+	meshConfig.Servers[0].Listeners[0].ProxyProtocol = true
+	return meshConfig
+}
+
+//requests from the test vlan go to the dedicated cluster, the others fall through to the service route
+func TestSourceIPRoute(t *testing.T) {
+	defaultAddr := "127.0.0.1:8080"
+	vlanAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	defaultHeaders := make(chan map[string]string, 10)
+	defaultServer := NewUpstreamServer(t, defaultAddr, ServeBoltV1RecordHeaders(defaultHeaders))
+	defaultServer.GoServe()
+	defer defaultServer.Close()
+	vlanHeaders := make(chan map[string]string, 10)
+	vlanServer := NewUpstreamServer(t, vlanAddr, ServeBoltV1RecordHeaders(vlanHeaders))
+	vlanServer.GoServe()
+	defer vlanServer.Close()
+	mesh := mosn.NewMosn(CreateSourceIPMeshConfig(meshAddr, defaultAddr, vlanAddr))
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	for _, c := range []struct {
+		clientIP string
+		headers  chan map[string]string
+	}{
+		{"10.8.3.4", vlanHeaders},
+		{"10.9.3.4", defaultHeaders},
+	} {
+		conn := dialMesh(t, meshAddr)
+		fmt.Fprintf(conn, "PROXY TCP4 %s 127.0.0.1 50000 2045\r\n", c.clientIP)
+		if resp := roundTripBoltV1(t, conn, buildBoltV1Request(GetStreamId())); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Errorf("request from %s expect success, but got %d\n", c.clientIP, resp.ResponseStatus)
+		}
+		conn.Close()
+		select {
+		case headers := <-c.headers:
+			if _, ok := headers[types.HeaderSourceIP]; ok {
+				t.Errorf("source ip header should not be forwarded to upstream\n")
+			}
+		default:
+			t.Errorf("request from %s routed to unexpected cluster\n", c.clientIP)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+)
+
+//ServeEcho writes the server name first, then echoes everything it reads
+func ServeEcho(name string) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		if _, err := conn.Write([]byte(name)); err != nil {
+			return
+		}
+		io.Copy(conn, conn)
+	}
+}
+
+//an arbitrary byte stream should be forwarded untouched,
+//and connections should be balanced between the cluster hosts
+func TestTCPProxy(t *testing.T) {
+	meshAddr := "127.0.0.1:2045"
+	serverAddrs := []string{
+		"127.0.0.1:8080",
+		"127.0.0.1:8081",
+	}
+	serverNames := []string{"server1", "server2"}
+	for i, addr := range serverAddrs {
+		server := NewUpstreamServer(t, addr, ServeEcho(serverNames[i]))
+		server.GoServe()
+		defer server.Close()
+	}
+	mesh_config := CreateTCPProxyConfig(meshAddr, serverAddrs)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	payload := []byte{0x00, 0xff, 0x01, 0xfe, '\r', '\n', 0x7f, 0x80}
+	hits := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		conn, err := net.Dial("tcp", meshAddr)
+		if err != nil {
+			t.Fatalf("dial mesh failed: %v\n", err)
+		}
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		if _, err := conn.Write(payload); err != nil {
+			t.Fatalf("write payload failed: %v\n", err)
+		}
+		resp := make([]byte, len(serverNames[0])+len(payload))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			t.Fatalf("read response failed: %v\n", err)
+		}
+		conn.Close()
+		name := string(resp[:len(serverNames[0])])
+		if !bytes.Equal(resp[len(name):], payload) {
+			t.Errorf("expected payload %v, but got %v\n", payload, resp[len(name):])
+		}
+		hits[name]++
+	}
+	for _, name := range serverNames {
+		if hits[name] != 2 {
+			t.Errorf("expected %s got 2 connections, but got %d\n", name, hits[name])
+		}
+	}
+}
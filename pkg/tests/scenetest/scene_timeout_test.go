@@ -0,0 +1,342 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/network/buffer"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc/codec"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//sets an option of the proxy filter of the simple mesh config
+func setProxyOption(mesh_config *config.MOSNConfig, key string, value interface{}) {
+	mesh_config.Servers[0].Listeners[0].FilterChains[0].Filters[0].Config[key] = value
+}
+
+//sends a bolt v1 request with the timeout in milliseconds
+func sendRequestWithTimeout(client *BoltV1Client, timeout int) chan int16 {
+	id := GetStreamId()
+	receiver := &statusReceiver{status: make(chan int16, 1)}
+	req := buildBoltV1Request(id)
+	req.Timeout = timeout
+	requestEncoder := client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver)
+	requestEncoder.AppendHeaders(req, true)
+	return receiver.status
+}
+
+func connectBoltV1Client(t *testing.T, addr string) *BoltV1Client {
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(addr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	return client
+}
+
+//request without timeout uses the request_timeout of proxy,
+//timeout in the bolt request takes precedence
+func TestRequestTimeout(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithDelay(3*time.Second))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	setProxyOption(mesh_config, "request_timeout", "1s")
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	start := time.Now()
+	if status := waitStatus(t, sendRequestWithTimeout(client, -1), 3*time.Second); status != sofarpc.RESPONSE_STATUS_TIMEOUT {
+		t.Errorf("request without timeout expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_TIMEOUT, status)
+	}
+	if cost := time.Since(start); cost < 900*time.Millisecond || cost > 2*time.Second {
+		t.Errorf("request without timeout expect timeout after 1s, but got %s\n", cost)
+	}
+
+	start = time.Now()
+	if status := waitStatus(t, sendRequestWithTimeout(client, 300), 3*time.Second); status != sofarpc.RESPONSE_STATUS_TIMEOUT {
+		t.Errorf("request with timeout expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_TIMEOUT, status)
+	}
+	if cost := time.Since(start); cost < 250*time.Millisecond || cost > 900*time.Millisecond {
+		t.Errorf("request with timeout expect timeout after 300ms, but got %s\n", cost)
+	}
+}
+
+//sends a bolt v1 request of the class with the timeout in milliseconds
+func sendClassRequestWithTimeout(client *BoltV1Client, className string, timeout int) chan int16 {
+	id := GetStreamId()
+	receiver := &statusReceiver{status: make(chan int16, 1)}
+	req := buildBoltV1Request(id)
+	req.Timeout = timeout
+	req.ClassName = []byte(className)
+	req.ClassLen = int16(len(className))
+	requestEncoder := client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver)
+	requestEncoder.AppendHeaders(req, true)
+	return receiver.status
+}
+
+//request without timeout uses the timeout of the longest matched class name prefix instead of the route timeout,
+//timeout in the bolt request takes precedence
+func TestClassTimeout(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithDelay(2*time.Second))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateClassTimeoutMeshConfig(meshAddr, []string{sofaAddr}, 3*time.Second, map[string]string{
+		"com.alipay.test.":            "1s",
+		"com.alipay.test.SlowService": "300ms",
+	})
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	cases := []struct {
+		className string
+		timeout   int
+		status    int16
+		min       time.Duration
+		max       time.Duration
+	}{
+		//route timeout, sent first as the upstream server handles requests one by one
+		{"com.antfin.test.OtherService", -1, sofarpc.RESPONSE_STATUS_SUCCESS, 1900 * time.Millisecond, 2900 * time.Millisecond},
+		//most specific prefix
+		{"com.alipay.test.SlowService", -1, sofarpc.RESPONSE_STATUS_TIMEOUT, 250 * time.Millisecond, 900 * time.Millisecond},
+		{"com.alipay.test.OtherService", -1, sofarpc.RESPONSE_STATUS_TIMEOUT, 900 * time.Millisecond, 1800 * time.Millisecond},
+		//explicit timeout of the request
+		{"com.alipay.test.SlowService", 1500, sofarpc.RESPONSE_STATUS_TIMEOUT, 1400 * time.Millisecond, 1900 * time.Millisecond},
+	}
+	for _, c := range cases {
+		start := time.Now()
+		if status := waitStatus(t, sendClassRequestWithTimeout(client, c.className, c.timeout), 4*time.Second); status != c.status {
+			t.Errorf("request of %s with timeout %d expect status %d, but got %d\n", c.className, c.timeout, c.status, status)
+		}
+		if cost := time.Since(start); cost < c.min || cost > c.max {
+			t.Errorf("request of %s with timeout %d expect response in %s~%s, but got %s\n", c.className, c.timeout, c.min, c.max, cost)
+		}
+	}
+}
+
+//listenBlackhole listens on the address without accepting, and fills the accept queue,
+//so that new connections to it hang in connecting
+func listenBlackhole(t *testing.T, addr string) func() {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("create socket failed: %v\n", err)
+	}
+	syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	sa := &syscall.SockaddrInet4{Port: tcpAddr.Port}
+	copy(sa.Addr[:], tcpAddr.IP.To4())
+	if err := syscall.Bind(fd, sa); err != nil {
+		t.Fatalf("bind %s failed: %v\n", addr, err)
+	}
+	syscall.Listen(fd, 0)
+	filler, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("fill accept queue failed: %v\n", err)
+	}
+	return func() {
+		filler.Close()
+		syscall.Close(fd)
+	}
+}
+
+//connecting to an unresponsive host fails after connect_timeout of the cluster,
+//instead of waiting for the request timeout
+func TestConnectTimeout(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	closeBlackhole := listenBlackhole(t, sofaAddr)
+	defer closeBlackhole()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.ClusterManager.Clusters[0].ConnectTimeout.Duration = 500 * time.Millisecond
+	setProxyOption(mesh_config, "request_timeout", "10s")
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	start := time.Now()
+	if status := waitStatus(t, sendRequestWithTimeout(client, -1), 3*time.Second); status != sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR {
+		t.Errorf("connect timeout expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_CLIENT_SEND_ERROR, status)
+	}
+	if cost := time.Since(start); cost < 400*time.Millisecond {
+		t.Errorf("connect timeout expect failure after 500ms, but got %s\n", cost)
+	}
+}
+
+//reads a bolt v1 response from the raw connection
+func readBoltV1Response(t *testing.T, conn net.Conn) *sofarpc.BoltResponseCommand {
+	iobuf := buffer.NewIoBuffer(1024)
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read response failed: %v\n", err)
+		}
+		iobuf.Write(buf[:n])
+		if _, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf); cmd != nil {
+			resp, ok := cmd.(*sofarpc.BoltResponseCommand)
+			if !ok {
+				t.Fatalf("expect bolt v1 response, but got %+v\n", cmd)
+			}
+			return resp
+		}
+	}
+}
+
+//downstream connection is closed after idle_timeout without active request,
+//a request in flight longer than idle_timeout keeps the connection
+func TestIdleTimeout(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1WithDelay(1500*time.Millisecond))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	setProxyOption(mesh_config, "idle_timeout", "1s")
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	conn, err := net.Dial("tcp", meshAddr)
+	if err != nil {
+		t.Fatalf("dial mesh failed: %v\n", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, req := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Request(GetStreamId()))
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		t.Fatalf("write request failed: %v\n", err)
+	}
+	if resp := readBoltV1Response(t, conn); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("request in flight expect success, but got %d\n", resp.ResponseStatus)
+	}
+
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("idle connection expect closed, but got %v\n", err)
+	}
+	if cost := time.Since(start); cost < 900*time.Millisecond || cost > 2*time.Second {
+		t.Errorf("idle connection expect closed after 1s, but got %s\n", cost)
+	}
+}
+
+//serves bolt requests, records the timeout of each request received
+func ServeBoltV1RecordTimeout(timeouts chan int) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		iobuf := buffer.NewIoBuffer(1024)
+		for {
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			iobuf.Write(buf[:n])
+			for iobuf.Len() > 1 {
+				_, cmd := codec.BoltV1.GetDecoder().Decode(nil, iobuf)
+				if cmd == nil {
+					break
+				}
+				if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
+					timeouts <- req.Timeout
+					_, resp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, buildBoltV1Resposne(req))
+					conn.Write(resp.Bytes())
+				}
+			}
+		}
+	}
+}
+
+//upstream gets the rest of the request timeout, the time spent in the failed try is excluded on retry
+func TestUpstreamTimeoutReduced(t *testing.T) {
+	meshAddr := "127.0.0.1:2045"
+	busyAddr := "127.0.0.1:8080"
+	successAddr := "127.0.0.1:8081"
+	busyServer := NewUpstreamServer(t, busyAddr, func(t *testing.T, conn net.Conn) {
+		serveBoltV1(t, conn, sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY, 500*time.Millisecond)
+	})
+	busyServer.GoServe()
+	defer busyServer.Close()
+	timeouts := make(chan int, 10)
+	successServer := NewUpstreamServer(t, successAddr, ServeBoltV1RecordTimeout(timeouts))
+	successServer.GoServe()
+	defer successServer.Close()
+	retryPolicy := &v2.RetryPolicy{
+		RetryOn:       true,
+		NumRetries:    1,
+		RetryOnStatus: []int{int(sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY)},
+	}
+	mesh_config := CreateRetryMeshConfig(meshAddr, []string{busyAddr, successAddr}, protocol.SofaRpc, protocol.SofaRpc, retryPolicy)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := connectBoltV1Client(t, meshAddr)
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//requests are sent to the busy host at most once, and retried on the success one
+	retried := false
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		if status := waitStatus(t, sendRequestWithTimeout(client, 3000), 4*time.Second); status != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Fatalf("expect status %d, but got %d\n", sofarpc.RESPONSE_STATUS_SUCCESS, status)
+		}
+		cost := time.Since(start)
+		timeout := <-timeouts
+		if timeout > 3000 || timeout < 3000-int(cost/time.Millisecond)-100 {
+			t.Errorf("upstream expect timeout within %dms of 3000ms, but got %d\n", cost/time.Millisecond, timeout)
+		}
+		if cost >= 500*time.Millisecond {
+			retried = true
+			if timeout > 2500 {
+				t.Errorf("retried request expect timeout less than 2500ms, but got %d\n", timeout)
+			}
+		}
+	}
+	if !retried {
+		t.Errorf("no request is retried\n")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/config"
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/serialize"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/trace"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/orcaman/concurrent-map"
+)
+
+//trace.Reporter, records reported spans
+type spanRecorder struct {
+	spans chan *trace.Span
+}
+
+func (r *spanRecorder) Report(span *trace.Span) {
+	r.spans <- span
+}
+
+func waitSpan(t *testing.T, spans chan *trace.Span, timeout time.Duration) *trace.Span {
+	select {
+	case span := <-spans:
+		return span
+	case <-time.After(timeout):
+		t.Fatalf("wait span timeout\n")
+	}
+	return nil
+}
+
+func sendRequestWithHeaders(client *BoltV1Client, headers map[string]string) chan int16 {
+	id := GetStreamId()
+	request := buildBoltV1Request(id)
+	headerBytes, _ := serialize.Instance.Serialize(headers)
+	request.HeaderMap = headerBytes
+	request.HeaderLen = int16(len(headerBytes))
+	receiver := &statusReceiver{status: make(chan int16, 1)}
+	client.Codec.NewStream(sofarpc.StreamIDConvert(id), receiver).AppendHeaders(request, true)
+	return receiver.status
+}
+
+//a span is reported for each bolt request, and the trace context is propagated to upstream
+func TestTracing(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	upstreamHeaders := make(chan map[string]string, 1)
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1RecordHeaders(upstreamHeaders))
+	server.GoServe()
+	defer server.Close()
+	recorder := &spanRecorder{spans: make(chan *trace.Span, 2)}
+	trace.RegisterReporter("scenetest", recorder)
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{sofaAddr}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Tracing = config.TracingConfig{Enable: true, Reporter: "scenetest"}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	defer trace.SetDriver(nil)
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	client := &BoltV1Client{
+		t:        t,
+		ClientId: "client",
+		Waits:    cmap.New(),
+	}
+	if err := client.Connect(meshAddr); err != nil {
+		t.Fatalf("connect to mesh failed: %v\n", err)
+	}
+	defer client.conn.Close(types.NoFlush, types.LocalClose)
+
+	//continues the trace of downstream
+	status := sendRequestWithHeaders(client, map[string]string{
+		"service":                        "testSofa",
+		config.DefaultTraceIdHeader:      "0af7651916cd43dd8448eb211c80319c",
+		config.DefaultSpanIdHeader:       "b7ad6b7169203331",
+		config.DefaultParentSpanIdHeader: "spoofed",
+	})
+	if s := waitStatus(t, status, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	headers := waitHeaders(t, upstreamHeaders, time.Second)
+	span := waitSpan(t, recorder.spans, time.Second)
+	if headers[config.DefaultTraceIdHeader] != "0af7651916cd43dd8448eb211c80319c" ||
+		headers[config.DefaultParentSpanIdHeader] != "b7ad6b7169203331" ||
+		headers[config.DefaultSpanIdHeader] == "b7ad6b7169203331" || headers[config.DefaultSpanIdHeader] == "" {
+		t.Errorf("unexpected trace context in upstream headers: %v\n", headers)
+	}
+	if span.TraceId != headers[config.DefaultTraceIdHeader] || span.SpanId != headers[config.DefaultSpanIdHeader] ||
+		span.ParentSpanId != "b7ad6b7169203331" {
+		t.Errorf("reported span %+v mismatches upstream headers %v\n", span, headers)
+	}
+	if span.Tags[types.SpanTagUpstreamHost] != sofaAddr || span.Tags[types.SpanTagCluster] != "testCluster" ||
+		span.Tags[types.SpanTagStatus] != "success" || !span.EndTime.After(span.StartTime) {
+		t.Errorf("unexpected reported span %+v\n", span)
+	}
+
+	//starts a new trace without trace context
+	status = sendRequestWithHeaders(client, map[string]string{"service": "testSofa"})
+	if s := waitStatus(t, status, 3*time.Second); s != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Fatalf("request expect success, but got %d\n", s)
+	}
+	headers = waitHeaders(t, upstreamHeaders, time.Second)
+	span = waitSpan(t, recorder.spans, time.Second)
+	if len(headers[config.DefaultTraceIdHeader]) != 32 || headers[config.DefaultSpanIdHeader] != span.SpanId ||
+		headers[config.DefaultParentSpanIdHeader] != "" || span.TraceId == "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("unexpected trace context in upstream headers: %v, span: %+v\n", headers, span)
+	}
+}
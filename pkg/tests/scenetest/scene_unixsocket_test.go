@@ -0,0 +1,90 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+)
+
+func NewUnixUpstreamServer(t *testing.T, path string, serve ServeConn) *UpstreamServer {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen %s failed, error: %v\n", path, err)
+		return nil
+	}
+	return &UpstreamServer{
+		Listener: l,
+		conns:    []net.Conn{},
+		mu:       sync.Mutex{},
+		Serve:    serve,
+		t:        t,
+		closed:   false,
+	}
+}
+
+//bolt requests go through a unix socket listener to a unix socket upstream,
+//the socket file of the listener is created with the configured mode and removed on close
+func TestUnixSocketListenerAndHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mosn_scenetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sofaPath := filepath.Join(dir, "sofa.sock")
+	meshPath := filepath.Join(dir, "mesh.sock")
+
+	server := NewUnixUpstreamServer(t, sofaPath, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig("unix://"+meshPath, []string{"unix://" + sofaPath}, protocol.SofaRpc, protocol.SofaRpc)
+	mesh_config.Servers[0].Listeners[0].SocketMode = "0600"
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	if fi, err := os.Stat(meshPath); err != nil || fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("expect listener socket file with mode 0600, got %v, %v\n", fi, err)
+	}
+
+	conn, err := net.Dial("unix", meshPath)
+	if err != nil {
+		mesh.Close()
+		t.Fatalf("dial mesh failed: %v\n", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 5; i++ {
+		if _, resp := roundTripBoltV1WithContent(t, conn, 16); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+			t.Errorf("request %d through unix sockets expect success, but got status %d\n", i, resp.ResponseStatus)
+		}
+	}
+	conn.Close()
+
+	mesh.Close()
+	if _, err := os.Stat(meshPath); !os.IsNotExist(err) {
+		t.Errorf("expect listener socket file removed after mesh closed, got %v\n", err)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/stats"
+)
+
+//the first byte is no registered bolt protocol code
+var unknownProtocolBytes = []byte{0x7f, 'r', 'a', 'w'}
+
+func unknownProtocolMetric(action string) string {
+	return "mosn_downstream_unknown_protocol_connections_total{action=" + action + ",listener=testListener}"
+}
+
+//starts a sofarpc mesh with the unknown_protocol policy, the raw hosts are in the fallback cluster rawCluster
+func startUnknownProtocolMesh(t *testing.T, meshAddr string, boltHosts, rawHosts []string, policy map[string]interface{}) *mosn.Mosn {
+	mesh_config := CreateSimpleMeshConfig(meshAddr, boltHosts, protocol.SofaRpc, protocol.SofaRpc)
+	if policy != nil {
+		setProxyOption(mesh_config, "unknown_protocol", policy)
+	}
+	if rawHosts != nil {
+		rawCluster := CreateBasicClusterConfig([]cluster{cluster{name: "rawCluster", hosts: rawHosts}})
+		mesh_config.ClusterManager.Clusters = append(mesh_config.ClusterManager.Clusters, rawCluster.Clusters...)
+	}
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+	return mesh
+}
+
+//expects the mesh closes the connection after the bytes of unknown protocol
+func expectUnknownProtocolClosed(t *testing.T, meshAddr string) {
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+	if _, err := conn.Write(unknownProtocolBytes); err != nil {
+		t.Fatalf("write failed: %v\n", err)
+	}
+	if n, err := conn.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("expect connection of unknown protocol closed, but read %d bytes, error: %v\n", n, err)
+	}
+}
+
+func expectCount(t *testing.T, sink *fakeMetricsSink, key string, expected int64) {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+	if n := sink.counts[key]; n != expected {
+		t.Errorf("expect %s %d, but got %d\n", key, expected, n)
+	}
+}
+
+//connections of unknown protocol are closed by default, bolt connections are not affected
+func TestUnknownProtocolClose(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh := startUnknownProtocolMesh(t, meshAddr, []string{sofaAddr}, nil, nil)
+	defer mesh.Close()
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	expectUnknownProtocolClosed(t, meshAddr)
+	expectCount(t, sink, unknownProtocolMetric("close"), 1)
+
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+	if resp := roundTripBoltV1(t, conn, buildBoltV1Request(GetStreamId())); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("bolt request expect success, but got status %d\n", resp.ResponseStatus)
+	}
+}
+
+func TestUnknownProtocolCloseSilently(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	mesh := startUnknownProtocolMesh(t, meshAddr, []string{sofaAddr}, nil, map[string]interface{}{"action": "close_silently"})
+	defer mesh.Close()
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	expectUnknownProtocolClosed(t, meshAddr)
+	expectCount(t, sink, unknownProtocolMetric("close_silently"), 1)
+}
+
+//connections of unknown protocol are forwarded untouched to the fallback cluster,
+//including the sniffed first bytes
+func TestUnknownProtocolForward(t *testing.T) {
+	sofaAddr := "127.0.0.1:8080"
+	rawAddr := "127.0.0.1:8081"
+	meshAddr := "127.0.0.1:2045"
+	server := NewUpstreamServer(t, sofaAddr, ServeBoltV1)
+	server.GoServe()
+	defer server.Close()
+	raw := NewUpstreamServer(t, rawAddr, ServeEcho("raw:"))
+	raw.GoServe()
+	defer raw.Close()
+	mesh := startUnknownProtocolMesh(t, meshAddr, []string{sofaAddr}, []string{rawAddr},
+		map[string]interface{}{"action": "forward", "cluster": "rawCluster"})
+	defer mesh.Close()
+	sink := newFakeMetricsSink()
+	stats.SetSink(sink)
+	defer stats.SetSink(nil)
+
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Write(unknownProtocolBytes); err != nil {
+			t.Fatalf("write failed: %v\n", err)
+		}
+	}
+	expected := "raw:" + string(unknownProtocolBytes) + string(unknownProtocolBytes)
+	buf := make([]byte, len(expected))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != expected {
+		t.Errorf("expect %q forwarded by the fallback cluster, but got %q, error: %v\n", expected, buf, err)
+	}
+	expectCount(t, sink, unknownProtocolMetric("forward"), 1)
+
+	bolt := dialMesh(t, meshAddr)
+	defer bolt.Close()
+	if resp := roundTripBoltV1(t, bolt, buildBoltV1Request(GetStreamId())); resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("bolt request expect success, but got status %d\n", resp.ResponseStatus)
+	}
+}
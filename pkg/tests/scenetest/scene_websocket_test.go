@@ -0,0 +1,234 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tests
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/mosn"
+	"github.com/alipay/sofamosn/pkg/protocol"
+)
+
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+	wsKey     = "dGhlIHNhbXBsZSBub25jZQ=="
+)
+
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+//writes a websocket frame with payload shorter than 126 bytes, client frames are masked
+func writeWebSocketFrame(t *testing.T, w io.Writer, opcode byte, payload []byte, masked bool) {
+	frame := []byte{0x80 | opcode, byte(len(payload))}
+	if masked {
+		mask := []byte{1, 2, 3, 4}
+		frame[1] |= 0x80
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatalf("write websocket frame failed: %v\n", err)
+	}
+}
+
+//reads a websocket frame with payload shorter than 126 bytes
+func readWebSocketFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	var mask []byte
+	if header[1]&0x80 != 0 {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, header[1]&0x7f)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		if mask != nil {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return header[0] & 0x0f, payload, nil
+}
+
+func expectWebSocketFrame(t *testing.T, r *bufio.Reader, opcode byte, payload string) {
+	op, data, err := readWebSocketFrame(r)
+	if err != nil {
+		t.Fatalf("read websocket frame failed: %v\n", err)
+	}
+	if op != opcode || string(data) != payload {
+		t.Errorf("expect frame %x %q, but got %x %q\n", opcode, payload, op, data)
+	}
+}
+
+//completes the handshake, greets the client, then echoes text frames and answers pings
+func ServeWebSocketEcho(uris chan string) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		uris <- req.RequestURI
+		if req.Header.Get("Upgrade") != "websocket" {
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"))
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + webSocketAccept(req.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"))
+		writeWebSocketFrame(t, conn, wsOpText, []byte("welcome"), false)
+		for {
+			op, payload, err := readWebSocketFrame(br)
+			if err != nil {
+				return
+			}
+			switch op {
+			case wsOpText:
+				writeWebSocketFrame(t, conn, wsOpText, payload, false)
+			case wsOpPing:
+				writeWebSocketFrame(t, conn, wsOpPong, payload, false)
+			case wsOpClose:
+				writeWebSocketFrame(t, conn, wsOpClose, payload, false)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+//sends the handshake through mesh, returns the reader of frames after the handshake response
+func upgradeWebSocket(t *testing.T, conn net.Conn, uri string) *bufio.Reader {
+	req := "GET " + uri + " HTTP/1.1\r\n" +
+		"Host: 127.0.0.1:2045\r\n" +
+		"Service: com.alipay.test.TestService\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + wsKey + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatalf("write handshake failed: %v\n", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("read handshake response failed: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect status %d, but got %d\n", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != webSocketAccept(wsKey) {
+		t.Errorf("unexpected handshake accept %s\n", accept)
+	}
+	return br
+}
+
+//the handshake is proxied to upstream, and frames flow both directions on the upgraded connection
+func TestWebSocketTunnel(t *testing.T) {
+	httpAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	uris := make(chan string, 1)
+	server := NewUpstreamServer(t, httpAddr, ServeWebSocketEcho(uris))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{httpAddr}, protocol.Http1, protocol.Http1)
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+	br := upgradeWebSocket(t, conn, "/chat?room=1")
+	if uri := <-uris; uri != "/chat?room=1" {
+		t.Errorf("expect upgrade request to /chat?room=1, but got %s\n", uri)
+	}
+
+	//upstream to downstream
+	expectWebSocketFrame(t, br, wsOpText, "welcome")
+	//downstream to upstream and back
+	writeWebSocketFrame(t, conn, wsOpText, []byte("hello"), true)
+	expectWebSocketFrame(t, br, wsOpText, "hello")
+	writeWebSocketFrame(t, conn, wsOpPing, []byte("ping"), true)
+	expectWebSocketFrame(t, br, wsOpPong, "ping")
+	writeWebSocketFrame(t, conn, wsOpClose, nil, true)
+	expectWebSocketFrame(t, br, wsOpClose, "")
+
+	//the upstream connection closed is followed by the downstream connection
+	if _, _, err := readWebSocketFrame(br); err != io.EOF {
+		t.Errorf("expect downstream connection closed, but got %v\n", err)
+	}
+}
+
+//the upgraded connection is kept by pings within idle_timeout, and closed after idle_timeout without frames
+func TestWebSocketIdleTimeout(t *testing.T) {
+	httpAddr := "127.0.0.1:8080"
+	meshAddr := "127.0.0.1:2045"
+	uris := make(chan string, 1)
+	server := NewUpstreamServer(t, httpAddr, ServeWebSocketEcho(uris))
+	server.GoServe()
+	defer server.Close()
+	mesh_config := CreateSimpleMeshConfig(meshAddr, []string{httpAddr}, protocol.Http1, protocol.Http1)
+	setProxyOption(mesh_config, "idle_timeout", "1s")
+	mesh := mosn.NewMosn(mesh_config)
+	go mesh.Start()
+	defer mesh.Close()
+	time.Sleep(5 * time.Second) //wait mesh and server start
+
+	conn := dialMesh(t, meshAddr)
+	defer conn.Close()
+	br := upgradeWebSocket(t, conn, "/chat")
+	<-uris
+	expectWebSocketFrame(t, br, wsOpText, "welcome")
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(500 * time.Millisecond)
+		writeWebSocketFrame(t, conn, wsOpPing, []byte("ping"), true)
+		expectWebSocketFrame(t, br, wsOpPong, "ping")
+	}
+
+	start := time.Now()
+	if _, _, err := readWebSocketFrame(br); err != io.EOF {
+		t.Errorf("idle websocket connection expect closed, but got %v\n", err)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("idle websocket connection expect closed after 1s, but closed after %s\n", elapsed)
+	}
+}
@@ -17,6 +17,7 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -235,18 +236,19 @@ type BoltV1Client struct {
 	conn         types.ClientConnection
 	respCount    uint32
 	requestCount uint32
+	TLSMng       types.TLSContextManager
 }
 
 func (c *BoltV1Client) Connect(addr string) error {
 	stopChan := make(chan struct{})
 	remoteAddr, _ := net.ResolveTCPAddr("tcp", addr)
-	cc := network.NewClientConnection(nil, nil, remoteAddr, stopChan, log.DefaultLogger)
+	cc := network.NewClientConnection(nil, c.TLSMng, remoteAddr, stopChan, log.DefaultLogger)
 	c.conn = cc
 	if err := cc.Connect(true); err != nil {
 		c.t.Logf("client[%s] connect to server error: %v\n", c.ClientId, err)
 		return err
 	}
-	c.Codec = stream.NewCodecClient(nil, protocol.SofaRpc, cc, nil)
+	c.Codec = stream.NewCodecClient(context.Background(), protocol.SofaRpc, cc, nil)
 	return nil
 }
 func (c *BoltV1Client) SendRequest() {
@@ -304,6 +306,9 @@ func buildBoltV1Request(requestId uint32) *sofarpc.BoltRequestCommand {
 	return request
 }
 func buildBoltV1Resposne(req *sofarpc.BoltRequestCommand) *sofarpc.BoltResponseCommand {
+	return buildBoltV1ResposneWithStatus(req, sofarpc.RESPONSE_STATUS_SUCCESS)
+}
+func buildBoltV1ResposneWithStatus(req *sofarpc.BoltRequestCommand, status int16) *sofarpc.BoltResponseCommand {
 	return &sofarpc.BoltResponseCommand{
 		Protocol:       req.Protocol,
 		CmdType:        sofarpc.RESPONSE,
@@ -311,7 +316,7 @@ func buildBoltV1Resposne(req *sofarpc.BoltRequestCommand) *sofarpc.BoltResponseC
 		Version:        req.Version,
 		ReqId:          req.ReqId,
 		CodecPro:       req.CodecPro, //todo: read default codec from config
-		ResponseStatus: sofarpc.RESPONSE_STATUS_SUCCESS,
+		ResponseStatus: status,
 		HeaderLen:      req.HeaderLen,
 		HeaderMap:      req.HeaderMap,
 	}
@@ -320,6 +325,24 @@ func buildBoltV1Resposne(req *sofarpc.BoltRequestCommand) *sofarpc.BoltResponseC
 
 //SofaRpc Serve
 func ServeBoltV1(t *testing.T, conn net.Conn) {
+	serveBoltV1(t, conn, sofarpc.RESPONSE_STATUS_SUCCESS, 0)
+}
+
+//SofaRpc Serve, responses with the status
+func ServeBoltV1WithStatus(status int16) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		serveBoltV1(t, conn, status, 0)
+	}
+}
+
+//SofaRpc Serve, responses after the delay
+func ServeBoltV1WithDelay(delay time.Duration) ServeConn {
+	return func(t *testing.T, conn net.Conn) {
+		serveBoltV1(t, conn, sofarpc.RESPONSE_STATUS_SUCCESS, delay)
+	}
+}
+
+func serveBoltV1(t *testing.T, conn net.Conn, status int16, delay time.Duration) {
 	iobuf := buffer.NewIoBuffer(102400)
 	for {
 		now := time.Now()
@@ -341,7 +364,8 @@ func ServeBoltV1(t *testing.T, conn net.Conn) {
 					break
 				}
 				if req, ok := cmd.(*sofarpc.BoltRequestCommand); ok {
-					resp := buildBoltV1Resposne(req)
+					time.Sleep(delay)
+					resp := buildBoltV1ResposneWithStatus(req, status)
 					err, iobufresp := codec.BoltV1.GetEncoder().EncodeHeaders(nil, resp)
 					if err != nil {
 						t.Errorf("Build response error: %v\n", err)
@@ -19,10 +19,12 @@ package tests
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/config"
 	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/redis"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
@@ -78,6 +80,11 @@ func CreateBasicClusterConfig(clusters []cluster) config.ClusterManagerConfig {
 
 //simple mesh config, based on protocol only
 func CreateSimpleMeshConfig(addr string, hosts []string, downstream, upstream types.Protocol) *config.MOSNConfig {
+	return CreateRetryMeshConfig(addr, hosts, downstream, upstream, nil)
+}
+
+//simple mesh config with route retry policy
+func CreateRetryMeshConfig(addr string, hosts []string, downstream, upstream types.Protocol, retryPolicy *v2.RetryPolicy) *config.MOSNConfig {
 	clusterName := "testCluster"
 	cmconfig := CreateBasicClusterConfig([]cluster{
 		cluster{name: clusterName, hosts: hosts},
@@ -86,7 +93,7 @@ func CreateSimpleMeshConfig(addr string, hosts []string, downstream, upstream ty
 	header := v2.HeaderMatcher{Name: "service", Value: ".*"}
 	routerV2 := v2.Router{
 		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
-		Route: v2.RouteAction{ClusterName: clusterName},
+		Route: v2.RouteAction{ClusterName: clusterName, RetryPolicy: retryPolicy},
 	}
 	p := &v2.Proxy{
 		DownstreamProtocol: string(downstream),
@@ -106,6 +113,173 @@ func CreateSimpleMeshConfig(addr string, hosts []string, downstream, upstream ty
 	return CreateMeshConfig(addr, proxyconfig, cmconfig)
 }
 
+//sofarpc mesh config with route timeout and timeouts of class name prefixes
+func CreateClassTimeoutMeshConfig(addr string, hosts []string, timeout time.Duration, classTimeouts map[string]string) *config.MOSNConfig {
+	clusterName := "testCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+	})
+	//proxy
+	header := v2.HeaderMatcher{Name: "service", Value: ".*"}
+	routerV2 := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
+		Route: v2.RouteAction{
+			ClusterName:   clusterName,
+			Timeout:       timeout,
+			ClassTimeouts: classTimeouts,
+		},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{routerV2}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//sofarpc mesh config with the route action, requests are routed to the cluster of hosts
+func CreateRouteActionMeshConfig(addr string, hosts []string, route v2.RouteAction) *config.MOSNConfig {
+	clusterName := "testCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+	})
+	//proxy
+	header := v2.HeaderMatcher{Name: "service", Value: ".*"}
+	route.ClusterName = clusterName
+	routerV2 := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
+		Route: route,
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{routerV2}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//sofarpc mesh config with requests mirrored to the shadow cluster
+func CreateMirrorMeshConfig(addr string, hosts []string, mirrorHosts []string, mirrorPercent uint32) *config.MOSNConfig {
+	clusterName := "testCluster"
+	mirrorClusterName := "shadowCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+		cluster{name: mirrorClusterName, hosts: mirrorHosts},
+	})
+	//proxy
+	header := v2.HeaderMatcher{Name: "service", Value: ".*"}
+	routerV2 := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
+		Route: v2.RouteAction{
+			ClusterName:   clusterName,
+			MirrorCluster: mirrorClusterName,
+			MirrorPercent: mirrorPercent,
+		},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{routerV2}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//sofarpc mesh config with slow requests hedged to other hosts
+func CreateHedgeMeshConfig(addr string, hosts []string, hedgePolicy *v2.HedgePolicy) *config.MOSNConfig {
+	clusterName := "testCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+	})
+	//proxy
+	header := v2.HeaderMatcher{Name: "service", Value: ".*"}
+	routerV2 := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
+		Route: v2.RouteAction{ClusterName: clusterName, HedgePolicy: hedgePolicy},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{routerV2}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//sofarpc mesh config with a failover cluster used if the route cluster has no healthy host
+func CreateFailoverMeshConfig(addr string, hosts []string, failoverHosts []string, timeout time.Duration) *config.MOSNConfig {
+	clusterName := "testCluster"
+	failoverClusterName := "failoverCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+		cluster{name: failoverClusterName, hosts: failoverHosts},
+	})
+	//proxy
+	header := v2.HeaderMatcher{Name: "service", Value: ".*"}
+	routerV2 := v2.Router{
+		Match: v2.RouterMatch{Headers: []v2.HeaderMatcher{header}},
+		Route: v2.RouteAction{
+			ClusterName:     clusterName,
+			FailoverCluster: failoverClusterName,
+			Timeout:         timeout,
+		},
+	}
+	p := &v2.Proxy{
+		DownstreamProtocol: string(protocol.SofaRpc),
+		UpstreamProtocol:   string(protocol.SofaRpc),
+		VirtualHosts: []*v2.VirtualHost{
+			&v2.VirtualHost{Name: "testHost", Domains: []string{"*"}, Routers: []v2.Router{routerV2}},
+		},
+	}
+	b, _ := json.Marshal(p)
+	filterChains := make(map[string]interface{})
+	json.Unmarshal(b, &filterChains)
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: "proxy", Config: filterChains},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
 //HTTP router mesh config
 func CreateHTTPRouteConfig(addr string, hosts [][]string) *config.MOSNConfig {
 	clusters := []cluster{}
@@ -152,3 +326,41 @@ func CreateHTTPRouteConfig(addr string, hosts [][]string) *config.MOSNConfig {
 	return CreateMeshConfig(addr, proxyconfig, cmconfig)
 
 }
+
+//TCP proxy mesh config, forward bytes to the cluster without protocol decoding
+func CreateTCPProxyConfig(addr string, hosts []string) *config.MOSNConfig {
+	clusterName := "testCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+	})
+	tcpProxy := map[string]interface{}{
+		"routes": []interface{}{
+			map[string]interface{}{"cluster": clusterName},
+		},
+	}
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: v2.TCP_PROXY, Config: tcpProxy},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
+
+//redis proxy config, keys are sharded to the hosts by consistent hash
+func CreateRedisProxyConfig(addr string, hosts []string) *config.MOSNConfig {
+	clusterName := "redisCluster"
+	cmconfig := CreateBasicClusterConfig([]cluster{
+		cluster{name: clusterName, hosts: hosts},
+	})
+	cmconfig.Clusters[0].LbType = "LB_CONSISTENT_HASH"
+	cmconfig.Clusters[0].ConsistentHash = v2.ConsistentHashConfig{HeaderKey: redis.HeaderKey}
+	redisProxy := map[string]interface{}{
+		"cluster": clusterName,
+	}
+	proxyconfig := []config.FilterChain{
+		config.FilterChain{Filters: []config.FilterConfig{
+			config.FilterConfig{Type: v2.REDIS_PROXY, Config: redisProxy},
+		}},
+	}
+	return CreateMeshConfig(addr, proxyconfig, cmconfig)
+}
@@ -0,0 +1,128 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tls
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/log"
+)
+
+// context managers of listeners and clusters, keyed by the owner.
+// a manager created for the same owner replaces the old one
+var (
+	contextManagers    = make(map[string]*contextManager)
+	contextManagersMux sync.Mutex
+)
+
+func registerContextManager(owner string, cm *contextManager) {
+	contextManagersMux.Lock()
+	defer contextManagersMux.Unlock()
+
+	contextManagers[owner] = cm
+}
+
+// ReloadCertificates reloads the certificates of all listeners and clusters from disk.
+// The new certificates are used for new handshakes only, existing connections are not affected.
+// If the new certificates of a listener or cluster are invalid, the old ones are kept.
+func ReloadCertificates() error {
+	contextManagersMux.Lock()
+	defer contextManagersMux.Unlock()
+
+	var errs []string
+	for owner, cm := range contextManagers {
+		if err := cm.reload(); err != nil {
+			log.DefaultLogger.Errorf("reload tls certificates of %s failed, keep the old ones: %v", owner, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", owner, err))
+			continue
+		}
+
+		log.DefaultLogger.Infof("tls certificates of %s reloaded", owner)
+	}
+
+	if len(errs) > 0 {
+		return errors.New("reload tls certificates failed: " + strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// reload creates new tls configs of all contexts, the configs are replaced only if all of them are valid
+func (cm *contextManager) reload() error {
+	cm.RLock()
+	defer cm.RUnlock()
+
+	var contexts []*context
+	seen := make(map[*context]bool)
+	add := func(c *context) {
+		if c != nil && !seen[c] {
+			seen[c] = true
+			contexts = append(contexts, c)
+		}
+	}
+
+	add(cm.tlscontext)
+	for _, m := range cm.contextMap {
+		for _, c := range m {
+			add(c)
+		}
+	}
+
+	newContexts := make([]*context, len(contexts))
+	for i, c := range contexts {
+		newContext, err := newTLSContext(&c.v2Config, cm)
+		if err != nil {
+			return err
+		}
+
+		if err := checkCertificates(newContext); err != nil {
+			return err
+		}
+
+		newContexts[i] = newContext
+	}
+
+	for i, c := range contexts {
+		c.tlsConfig.Store(newContexts[i].getTLSConfig())
+	}
+
+	return nil
+}
+
+// checkCertificates checks the certificates are valid now, the key pairs have been checked on loading
+func checkCertificates(c *context) error {
+	now := time.Now()
+
+	for _, cert := range c.getTLSConfig().Certificates {
+		x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("parse certificate error: %v", err)
+		}
+
+		if now.Before(x509Cert.NotBefore) || now.After(x509Cert.NotAfter) {
+			return fmt.Errorf("certificate %s is not valid from %v to %v", x509Cert.Subject.CommonName,
+				x509Cert.NotBefore, x509Cert.NotAfter)
+		}
+	}
+
+	return nil
+}
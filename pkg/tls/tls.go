@@ -29,11 +29,16 @@ import (
 	"io/ioutil"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var TLSdefaultMinProtocols uint16 = tls.VersionTLS10
 var TLSdefaultMaxProtocols uint16 = tls.VersionTLS12
 
+// DefaultSessionCacheSize is the default max number of upstream hosts of a cluster whose sessions are cached
+const DefaultSessionCacheSize = 64
+
 var TLSProtocols = map[string]uint16{
 	"tls_auto": 0,
 	"tlsv1_0":  tls.VersionTLS10,
@@ -102,6 +107,8 @@ type context struct {
 	ecdhCurves   []tls.CurveID
 	certificates []tls.Certificate
 	ticket       string
+	// upstream sessions are cached for resumption if positive
+	sessionCacheSize int
 
 	verifyClient bool
 	verifyServer bool
@@ -109,7 +116,11 @@ type context struct {
 	listener    types.Listener
 	clusterInfo types.ClusterInfo
 
-	tlsConfig *tls.Config
+	// the config the context is created from, which is used to reload certificates
+	v2Config v2.TLSConfig
+
+	// *tls.Config used for new handshakes, it is replaced when certificates are reloaded
+	tlsConfig atomic.Value
 }
 
 type contextManager struct {
@@ -134,7 +145,7 @@ func buildContextMap(cm *contextManager, tlscontext *context, index int) {
 		return
 	}
 
-	c := tlscontext.tlsConfig
+	c := tlscontext.getTLSConfig()
 
 	m := make(map[string]*context)
 
@@ -191,6 +202,10 @@ func NewTLSServerContextManager(config []v2.FilterChain, l types.Listener, logge
 		}
 	}
 
+	if l != nil {
+		registerContextManager("listener "+l.Name(), cm)
+	}
+
 	return cm
 }
 
@@ -274,16 +289,67 @@ func NewTLSClientContextManager(config *v2.TLSConfig, info types.ClusterInfo) ty
 	tlscontext.clusterInfo = info
 	cm.tlscontext = tlscontext
 
+	if info != nil {
+		registerContextManager("cluster "+info.Name(), cm)
+	}
+
 	return cm
 }
 
+// CheckClientConfig loads certificates in the tls config of upstream cluster,
+// returns error if the config is invalid
+func CheckClientConfig(config *v2.TLSConfig) error {
+	_, err := newTLSContext(config, &contextManager{isClient: true})
+
+	return err
+}
+
+// Handshake runs the tls handshake of c within timeout, it does nothing if c is not a tls connection
+func Handshake(c net.Conn, timeout time.Duration) error {
+	tlsConn, ok := c.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	return tlsConn.SetDeadline(time.Time{})
+}
+
+// PeerIdentity returns the identity in verified peer certificate of a tls connection,
+// the SPIFFE URI SAN is used if present, else the common name. Returns empty if
+// the connection is not tls or the peer certificate is not verified.
+func PeerIdentity(c net.Conn) string {
+	tlsConn, ok := c.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := state.PeerCertificates[0]
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+
+	return cert.Subject.CommonName
+}
+
 func (cm *contextManager) GetConfigForClient(info *tls.ClientHelloInfo) (*tls.Config, error) {
 	var tlscontext *context
 	var ok bool
 
 	// only one Cartificate
 	if len(cm.contextMap) == 1 {
-		return cm.tlscontext.tlsConfig.Clone(), nil
+		return cm.tlscontext.getTLSConfig().Clone(), nil
 	}
 
 	for _, maps := range cm.contextMap {
@@ -332,7 +398,7 @@ find:
 	// callback select filter config
 	// callback(cm.listener, index)
 
-	return tlscontext.tlsConfig.Clone(), nil
+	return tlscontext.getTLSConfig().Clone(), nil
 
 }
 
@@ -348,11 +414,24 @@ func (cm *contextManager) Conn(c net.Conn) net.Conn {
 	tlscontext := cm.defaultContext()
 
 	if cm.isClient {
-		return tls.Client(c, tlscontext.tlsConfig)
+		config := tlscontext.getTLSConfig().Clone()
+
+		// verify server certificate against the remote address if no server name configured
+		if !config.InsecureSkipVerify && config.ServerName == "" {
+			if host, _, err := net.SplitHostPort(c.RemoteAddr().String()); err == nil {
+				config.ServerName = host
+			}
+		}
+
+		if config.ClientSessionCache != nil {
+			config.ClientSessionCache = &hostSessionCache{cache: config.ClientSessionCache, host: c.RemoteAddr().String()}
+		}
+
+		return tls.Client(c, config)
 	}
 
 	if !cm.inspector {
-		return tls.Server(c, tlscontext.tlsConfig)
+		return tls.Server(c, tlscontext.getTLSConfig())
 	}
 
 	tlsconn := &conn{
@@ -361,13 +440,13 @@ func (cm *contextManager) Conn(c net.Conn) net.Conn {
 
 	buf := tlsconn.Peek()
 	if buf == nil {
-		return tls.Server(tlsconn, tlscontext.tlsConfig)
+		return tls.Server(tlsconn, tlscontext.getTLSConfig())
 	}
 
 	switch buf[0] {
 	// TLS handshake
 	case 0x16:
-		return tls.Server(tlsconn, tlscontext.tlsConfig)
+		return tls.Server(tlsconn, tlscontext.getTLSConfig())
 	// http plain
 	default:
 		return tlsconn
@@ -401,19 +480,29 @@ func (c *context) newTLSConfig(cm *contextManager) error {
 
 	if cm.isClient {
 		config.ServerName = c.serverName
+
+		// a new cache is created on reload, so that the sessions verified by the old ca are not resumed
+		if c.sessionCacheSize > 0 {
+			config.ClientSessionCache = tls.NewLRUClientSessionCache(c.sessionCacheSize)
+		}
 	}
 
-	c.tlsConfig = config
+	c.tlsConfig.Store(config)
 
 	return nil
 }
 
+func (c *context) getTLSConfig() *tls.Config {
+	return c.tlsConfig.Load().(*tls.Config)
+}
+
 func newTLSContext(c *v2.TLSConfig, cm *contextManager) (*context, error) {
 	if c.Status == false {
 		return nil, nil
 	}
 
 	tlscontext := new(context)
+	tlscontext.v2Config = *c
 
 	if c.CipherSuites != "" {
 		ciphers := strings.Split(c.CipherSuites, ":")
@@ -539,8 +628,20 @@ func newTLSContext(c *v2.TLSConfig, cm *contextManager) (*context, error) {
 	tlscontext.verifyClient = c.VerifyClient
 	tlscontext.verifyServer = c.VerifyServer
 
+	// upstream server certificate is always verified if ca is configured
+	if cm.isClient && tlscontext.caCert != nil {
+		tlscontext.verifyServer = true
+	}
+
 	tlscontext.serverName = c.ServerName
 
+	if cm.isClient {
+		tlscontext.sessionCacheSize = c.SessionCacheSize
+		if tlscontext.sessionCacheSize == 0 {
+			tlscontext.sessionCacheSize = DefaultSessionCacheSize
+		}
+	}
+
 	if c.Inspector {
 		cm.inspector = true
 	}
@@ -552,6 +653,21 @@ func newTLSContext(c *v2.TLSConfig, cm *contextManager) (*context, error) {
 	return tlscontext, nil
 }
 
+// hostSessionCache keys the sessions in the cache of a cluster by the host address, so that a session
+// is resumed only with the host it is established with, even if the hosts share the server name
+type hostSessionCache struct {
+	cache tls.ClientSessionCache
+	host  string
+}
+
+func (c *hostSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	return c.cache.Get(c.host + "/" + sessionKey)
+}
+
+func (c *hostSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.cache.Put(c.host+"/"+sessionKey, cs)
+}
+
 type conn struct {
 	net.Conn
 	peek    [1]byte
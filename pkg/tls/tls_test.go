@@ -0,0 +1,487 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type certInfo struct {
+	caPEM   string
+	certPEM string
+	keyPEM  string
+	ca      *x509.Certificate
+	caKey   *ecdsa.PrivateKey
+}
+
+// createCerts creates a ca and a server certificate for 127.0.0.1 signed by the ca
+func createCerts(t *testing.T) *certInfo {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create ca error: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create certificate error: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return &certInfo{
+		caPEM:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		ca:      ca,
+		caKey:   caKey,
+	}
+}
+
+// createClientCert creates a client certificate signed by the ca in certs, with an optional uri san
+func createClientCert(t *testing.T, certs *certInfo, cn, uri string) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		u, _ := url.Parse(uri)
+		template.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, certs.ca, &key.PublicKey, certs.caKey)
+	if err != nil {
+		t.Fatalf("create client certificate error: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestCheckClientConfig(t *testing.T) {
+	certs := createCerts(t)
+
+	cases := []struct {
+		config *v2.TLSConfig
+		valid  bool
+	}{
+		{&v2.TLSConfig{Status: false, CACert: "not exists"}, true},
+		{&v2.TLSConfig{Status: true}, true},
+		{&v2.TLSConfig{Status: true, CACert: certs.caPEM, ServerName: "127.0.0.1", MinVersion: "TLSv1_2"}, true},
+		{&v2.TLSConfig{Status: true, CACert: certs.caPEM, CertChain: certs.certPEM, PrivateKey: certs.keyPEM}, true},
+		{&v2.TLSConfig{Status: true, CACert: "/not/exists/ca.pem"}, false},
+		{&v2.TLSConfig{Status: true, CACert: "-----BEGIN CERTIFICATE-----\ninvalid"}, false},
+		{&v2.TLSConfig{Status: true, CertChain: certs.caPEM, PrivateKey: certs.keyPEM}, false},
+		{&v2.TLSConfig{Status: true, MinVersion: "sslv3"}, false},
+	}
+
+	for i, c := range cases {
+		if err := CheckClientConfig(c.config); (err == nil) != c.valid {
+			t.Errorf("case %d expected valid %v, but got error %v", i, c.valid, err)
+		}
+	}
+}
+
+func serveTLS(t *testing.T, certs *certInfo) net.Listener {
+	cert, err := tls.X509KeyPair([]byte(certs.certPEM), []byte(certs.keyPEM))
+	if err != nil {
+		t.Fatalf("load server certificate error: %v", err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+func clientHandshake(t *testing.T, config *v2.TLSConfig, addr string) error {
+	cm := NewTLSClientContextManager(config, nil)
+	if cm == nil || !cm.Enabled() {
+		t.Fatalf("client tls context manager should be enabled")
+	}
+	rawConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	conn := cm.Conn(rawConn).(*tls.Conn)
+	defer conn.Close()
+	return conn.Handshake()
+}
+
+func TestClientVerifyServer(t *testing.T) {
+	certs := createCerts(t)
+	l := serveTLS(t, certs)
+	defer l.Close()
+
+	// server certificate is verified against configured ca and remote address
+	if err := clientHandshake(t, &v2.TLSConfig{Status: true, CACert: certs.caPEM}, l.Addr().String()); err != nil {
+		t.Errorf("handshake with trusted server error: %v", err)
+	}
+
+	// server certificate signed by another ca
+	otherCerts := createCerts(t)
+	if err := clientHandshake(t, &v2.TLSConfig{Status: true, CACert: otherCerts.caPEM}, l.Addr().String()); err == nil {
+		t.Errorf("handshake with untrusted server should fail")
+	}
+
+	// server name mismatched
+	if err := clientHandshake(t, &v2.TLSConfig{Status: true, CACert: certs.caPEM, ServerName: "www.example.com"}, l.Addr().String()); err == nil {
+		t.Errorf("handshake with mismatched server name should fail")
+	}
+
+	// server certificate is not verified if no ca configured
+	if err := clientHandshake(t, &v2.TLSConfig{Status: true}, l.Addr().String()); err != nil {
+		t.Errorf("handshake without verify error: %v", err)
+	}
+}
+
+// serveTLSHosts serves tls on n addresses sharing the server config, so that the session tickets
+// issued by one of them are accepted by the others
+func serveTLSHosts(t *testing.T, certs *certInfo, n int) []net.Listener {
+	cert, err := tls.X509KeyPair([]byte(certs.certPEM), []byte(certs.keyPEM))
+	if err != nil {
+		t.Fatalf("load server certificate error: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	var listeners []net.Listener
+	for i := 0; i < n; i++ {
+		l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+		if err != nil {
+			t.Fatalf("listen error: %v", err)
+		}
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}()
+			}
+		}()
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// resumed returns whether the handshake of a new connection to addr resumes a cached session
+func resumed(t *testing.T, cm types.TLSContextManager, addr string) bool {
+	rawConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	conn := cm.Conn(rawConn).(*tls.Conn)
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("handshake error: %v", err)
+	}
+	return conn.ConnectionState().DidResume
+}
+
+func TestClientSessionResumption(t *testing.T) {
+	certs := createCerts(t)
+	listeners := serveTLSHosts(t, certs, 2)
+	for _, l := range listeners {
+		defer l.Close()
+	}
+	first, second := listeners[0].Addr().String(), listeners[1].Addr().String()
+
+	cm := NewTLSClientContextManager(&v2.TLSConfig{Status: true, CACert: certs.caPEM}, nil)
+	if resumed(t, cm, first) {
+		t.Errorf("first connection to the host should do a full handshake")
+	}
+	if !resumed(t, cm, first) {
+		t.Errorf("second connection to the same host should resume the session")
+	}
+	// sessions are keyed by host, though the hosts share the server name and ticket keys
+	if resumed(t, cm, second) {
+		t.Errorf("first connection to another host should do a full handshake")
+	}
+	if !resumed(t, cm, second) || !resumed(t, cm, first) {
+		t.Errorf("sessions of both hosts should be cached")
+	}
+
+	// the least recently used host is evicted
+	cm = NewTLSClientContextManager(&v2.TLSConfig{Status: true, CACert: certs.caPEM, SessionCacheSize: 1}, nil)
+	resumed(t, cm, first)
+	resumed(t, cm, second)
+	if resumed(t, cm, first) {
+		t.Errorf("session of evicted host should not be resumed")
+	}
+
+	// disabled
+	cm = NewTLSClientContextManager(&v2.TLSConfig{Status: true, CACert: certs.caPEM, SessionCacheSize: -1}, nil)
+	resumed(t, cm, first)
+	if resumed(t, cm, first) {
+		t.Errorf("session should not be resumed if the cache is disabled")
+	}
+}
+
+// peerIdentity accepts one connection with server config, and returns the peer identity after handshake
+func peerIdentity(t *testing.T, server *v2.TLSConfig, client *v2.TLSConfig) (string, error) {
+	cm := NewTLSServerContextManager([]v2.FilterChain{{TLS: *server}}, nil, log.DefaultLogger)
+	if cm == nil || !cm.Enabled() {
+		t.Fatalf("server tls context manager should be enabled")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer l.Close()
+
+	clientMng := NewTLSClientContextManager(client, nil)
+	go func() {
+		if rawConn, err := net.Dial("tcp", l.Addr().String()); err == nil {
+			conn := clientMng.Conn(rawConn).(*tls.Conn)
+			conn.Handshake()
+			conn.Close()
+		}
+	}()
+
+	rawConn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept error: %v", err)
+	}
+	conn := cm.Conn(rawConn)
+	defer conn.Close()
+	if err := Handshake(conn, time.Second); err != nil {
+		return "", err
+	}
+	return PeerIdentity(conn), nil
+}
+
+func TestPeerIdentity(t *testing.T) {
+	certs := createCerts(t)
+	server := &v2.TLSConfig{
+		Status:       true,
+		CACert:       certs.caPEM,
+		CertChain:    certs.certPEM,
+		PrivateKey:   certs.keyPEM,
+		VerifyClient: true,
+	}
+
+	// spiffe uri san is preferred
+	spiffeCert, spiffeKey := createClientCert(t, certs, "client", "spiffe://cluster.local/ns/default/sa/client")
+	identity, err := peerIdentity(t, server, &v2.TLSConfig{Status: true, CACert: certs.caPEM, CertChain: spiffeCert, PrivateKey: spiffeKey})
+	if err != nil || identity != "spiffe://cluster.local/ns/default/sa/client" {
+		t.Errorf("expected spiffe identity, but got %s, error %v", identity, err)
+	}
+
+	// common name is used without spiffe uri san
+	cnCert, cnKey := createClientCert(t, certs, "client", "https://www.example.com")
+	identity, err = peerIdentity(t, server, &v2.TLSConfig{Status: true, CACert: certs.caPEM, CertChain: cnCert, PrivateKey: cnKey})
+	if err != nil || identity != "client" {
+		t.Errorf("expected common name identity, but got %s, error %v", identity, err)
+	}
+
+	// client certificate signed by another ca is rejected
+	otherCerts := createCerts(t)
+	otherCert, otherKey := createClientCert(t, otherCerts, "other", "")
+	if _, err = peerIdentity(t, server, &v2.TLSConfig{Status: true, CACert: certs.caPEM, CertChain: otherCert, PrivateKey: otherKey}); err == nil {
+		t.Errorf("handshake with untrusted client certificate should fail")
+	}
+
+	// no identity without client certificate verify
+	server.VerifyClient = false
+	identity, err = peerIdentity(t, server, &v2.TLSConfig{Status: true, CACert: certs.caPEM, CertChain: cnCert, PrivateKey: cnKey})
+	if err != nil || identity != "" {
+		t.Errorf("expected empty identity, but got %s, error %v", identity, err)
+	}
+
+	// not a tls connection
+	if identity := PeerIdentity(&net.TCPConn{}); identity != "" {
+		t.Errorf("expected empty identity for plain connection, but got %s", identity)
+	}
+}
+
+// serveReloadable serves tls with the server context manager, and echoes data after handshake
+func serveReloadable(t *testing.T, cm types.TLSContextManager) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	go func() {
+		for {
+			rawConn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn := cm.Conn(rawConn)
+				defer conn.Close()
+				if err := Handshake(conn, time.Second); err != nil {
+					return
+				}
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+// presentedCert returns a connection and the certificate presented by server
+func presentedCert(t *testing.T, addr string) (*tls.Conn, []byte) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("handshake error: %v", err)
+	}
+	return conn, conn.ConnectionState().PeerCertificates[0].Raw
+}
+
+func certDER(certPEM string) []byte {
+	block, _ := pem.Decode([]byte(certPEM))
+	return block.Bytes
+}
+
+func TestReloadCertificates(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	dir, err := ioutil.TempDir("", "tls_reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCerts := func(certPEM, keyPEM string) {
+		ioutil.WriteFile(certFile, []byte(certPEM), 0644)
+		ioutil.WriteFile(keyFile, []byte(keyPEM), 0644)
+	}
+
+	oldCerts := createCerts(t)
+	writeCerts(oldCerts.certPEM, oldCerts.keyPEM)
+
+	cm := NewTLSServerContextManager([]v2.FilterChain{
+		{TLS: v2.TLSConfig{Status: true, CertChain: certFile, PrivateKey: keyFile}},
+	}, nil, log.DefaultLogger)
+	if cm == nil || !cm.Enabled() {
+		t.Fatalf("server tls context manager should be enabled")
+	}
+	registerContextManager("listener reload_test", cm.(*contextManager))
+	defer func() {
+		contextManagersMux.Lock()
+		delete(contextManagers, "listener reload_test")
+		contextManagersMux.Unlock()
+	}()
+
+	l := serveReloadable(t, cm)
+	defer l.Close()
+
+	oldConn, presented := presentedCert(t, l.Addr().String())
+	defer oldConn.Close()
+	if !bytes.Equal(presented, certDER(oldCerts.certPEM)) {
+		t.Fatalf("expected the old certificate presented")
+	}
+
+	// the reloaded certificate is presented on new handshakes
+	newCerts := createCerts(t)
+	writeCerts(newCerts.certPEM, newCerts.keyPEM)
+	if err := ReloadCertificates(); err != nil {
+		t.Fatalf("reload certificates error: %v", err)
+	}
+	conn, presented := presentedCert(t, l.Addr().String())
+	conn.Close()
+	if !bytes.Equal(presented, certDER(newCerts.certPEM)) {
+		t.Errorf("expected the new certificate presented after reload")
+	}
+
+	// the existing connection is not affected
+	oldConn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := oldConn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write on existing connection error: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(oldConn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("read on existing connection got %s, error %v", buf, err)
+	}
+
+	// invalid certificates are rejected and the current one is kept
+	badCerts := createCerts(t)
+	for i, bad := range [][2]string{
+		{"-----BEGIN CERTIFICATE-----\ninvalid", newCerts.keyPEM},
+		{badCerts.certPEM, newCerts.keyPEM},
+	} {
+		writeCerts(bad[0], bad[1])
+		if err := ReloadCertificates(); err == nil {
+			t.Errorf("case %d reload invalid certificates should fail", i)
+		}
+		conn, presented := presentedCert(t, l.Addr().String())
+		conn.Close()
+		if !bytes.Equal(presented, certDER(newCerts.certPEM)) {
+			t.Errorf("case %d expected the current certificate kept", i)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package trace
+
+import (
+	"sync"
+
+	"github.com/alipay/sofamosn/pkg/log"
+)
+
+// Reporter sends finished spans to a tracing system, such as zipkin or jaeger
+type Reporter interface {
+	Report(span *Span)
+}
+
+var (
+	reportersMux sync.RWMutex
+	reporters    = make(map[string]Reporter)
+)
+
+func init() {
+	RegisterReporter("log", &logReporter{})
+}
+
+// RegisterReporter registers a reporter by name, which can be used in tracing config
+func RegisterReporter(name string, reporter Reporter) {
+	reportersMux.Lock()
+	defer reportersMux.Unlock()
+
+	reporters[name] = reporter
+}
+
+func GetReporter(name string) Reporter {
+	reportersMux.RLock()
+	defer reportersMux.RUnlock()
+
+	return reporters[name]
+}
+
+// logReporter writes spans into the default logger
+type logReporter struct{}
+
+func (r *logReporter) Report(span *Span) {
+	log.DefaultLogger.Infof("span traceId=%s, spanId=%s, parentSpanId=%s, operation=%s, start=%s, duration=%s, tags=%v",
+		span.TraceId, span.SpanId, span.ParentSpanId, span.Operation,
+		span.StartTime.Format("2006-01-02 15:04:05.000"), span.EndTime.Sub(span.StartTime), span.Tags)
+}
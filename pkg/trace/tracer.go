@@ -0,0 +1,143 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+var (
+	driverMux sync.RWMutex
+	driver    types.Driver
+)
+
+// SetDriver sets the global tracing driver used by proxies, tracing is disabled if nil
+func SetDriver(d types.Driver) {
+	driverMux.Lock()
+	defer driverMux.Unlock()
+
+	driver = d
+}
+
+func GetDriver() types.Driver {
+	driverMux.RLock()
+	defer driverMux.RUnlock()
+
+	return driver
+}
+
+// Tracer is a tracing driver, the trace context is carried in bolt header map
+type Tracer struct {
+	config   *v2.TracingConfig
+	reporter Reporter
+}
+
+func NewTracer(config *v2.TracingConfig, reporter Reporter) *Tracer {
+	return &Tracer{
+		config:   config,
+		reporter: reporter,
+	}
+}
+
+// Start starts a span for the request, continues the trace in request headers if present.
+// The span of the incoming request becomes the parent of the new span.
+func (t *Tracer) Start(requestHeaders map[string]string, operationName string, startTime time.Time) types.Span {
+	traceId := requestHeaders[t.config.TraceIdHeader]
+	if traceId == "" {
+		traceId = newId(16)
+	}
+
+	return &Span{
+		TraceId:      traceId,
+		SpanId:       newId(8),
+		ParentSpanId: requestHeaders[t.config.SpanIdHeader],
+		Operation:    operationName,
+		StartTime:    startTime,
+		Tags:         make(map[string]string),
+		tracer:       t,
+		headers:      requestHeaders,
+	}
+}
+
+// Span records a proxied request, it's reported when finished
+type Span struct {
+	TraceId      string
+	SpanId       string
+	ParentSpanId string
+	Operation    string
+	StartTime    time.Time
+	EndTime      time.Time
+	Tags         map[string]string
+
+	tracer  *Tracer
+	headers map[string]string
+}
+
+func (s *Span) SetOperation(operation string) {
+	s.Operation = operation
+}
+
+func (s *Span) SetTag(key string, value string) {
+	s.Tags[key] = value
+}
+
+func (s *Span) FinishSpan() {
+	s.EndTime = time.Now()
+
+	if s.tracer.reporter != nil {
+		s.tracer.reporter.Report(s)
+	}
+}
+
+// InjectContext writes the trace context into the request headers, which are sent to upstream
+func (s *Span) InjectContext() {
+	s.headers[s.tracer.config.TraceIdHeader] = s.TraceId
+	s.headers[s.tracer.config.SpanIdHeader] = s.SpanId
+
+	if s.ParentSpanId != "" {
+		s.headers[s.tracer.config.ParentSpanIdHeader] = s.ParentSpanId
+	} else {
+		delete(s.headers, s.tracer.config.ParentSpanIdHeader)
+	}
+}
+
+func (s *Span) SpawnChild() types.Span {
+	return &Span{
+		TraceId:      s.TraceId,
+		SpanId:       newId(8),
+		ParentSpanId: s.SpanId,
+		Operation:    s.Operation,
+		StartTime:    time.Now(),
+		Tags:         make(map[string]string),
+		tracer:       s.tracer,
+		headers:      s.headers,
+	}
+}
+
+// newId generates a random id in hex of n bytes, 16 bytes trace id and 8 bytes span id are compatible with zipkin
+func newId(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
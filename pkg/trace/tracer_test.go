@@ -0,0 +1,108 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type recordReporter struct {
+	spans []*Span
+}
+
+func (r *recordReporter) Report(span *Span) {
+	r.spans = append(r.spans, span)
+}
+
+var testConfig = &v2.TracingConfig{
+	TraceIdHeader:      "trace_id",
+	SpanIdHeader:       "span_id",
+	ParentSpanIdHeader: "parent_span_id",
+}
+
+func TestTracerContinueTrace(t *testing.T) {
+	reporter := &recordReporter{}
+	tracer := NewTracer(testConfig, reporter)
+	headers := map[string]string{
+		"trace_id": "0af7651916cd43dd8448eb211c80319c",
+		"span_id":  "b7ad6b7169203331",
+	}
+
+	start := time.Now()
+	span := tracer.Start(headers, "com.alipay.test.HelloService", start)
+	span.SetTag(types.SpanTagCluster, "hello_cluster")
+	span.InjectContext()
+
+	if headers["trace_id"] != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace id should be continued, got %s", headers["trace_id"])
+	}
+	if headers["parent_span_id"] != "b7ad6b7169203331" {
+		t.Errorf("incoming span should be parent, got %s", headers["parent_span_id"])
+	}
+	if id := headers["span_id"]; len(id) != 16 || id == "b7ad6b7169203331" {
+		t.Errorf("expected a new span id, got %s", id)
+	}
+
+	span.FinishSpan()
+	if len(reporter.spans) != 1 {
+		t.Fatalf("expected 1 span reported, got %d", len(reporter.spans))
+	}
+	reported := reporter.spans[0]
+	if reported.SpanId != headers["span_id"] || reported.Operation != "com.alipay.test.HelloService" ||
+		reported.Tags[types.SpanTagCluster] != "hello_cluster" || reported.StartTime != start || reported.EndTime.Before(start) {
+		t.Errorf("unexpected reported span %+v", reported)
+	}
+}
+
+func TestTracerNewTrace(t *testing.T) {
+	tracer := NewTracer(testConfig, nil)
+	headers := map[string]string{"parent_span_id": "spoofed"}
+
+	span := tracer.Start(headers, "", time.Now()).(*Span)
+	span.InjectContext()
+
+	if len(headers["trace_id"]) != 32 || len(headers["span_id"]) != 16 {
+		t.Errorf("expected generated trace context, got %v", headers)
+	}
+	if _, ok := headers["parent_span_id"]; ok || span.ParentSpanId != "" {
+		t.Errorf("root span should have no parent, got %v", headers)
+	}
+
+	child := span.SpawnChild().(*Span)
+	if child.TraceId != span.TraceId || child.ParentSpanId != span.SpanId || child.SpanId == span.SpanId {
+		t.Errorf("unexpected child span %+v of %+v", child, span)
+	}
+
+	// finish without reporter
+	span.FinishSpan()
+}
+
+func TestGetReporter(t *testing.T) {
+	if GetReporter("log") == nil {
+		t.Errorf("log reporter should be registered")
+	}
+
+	reporter := &recordReporter{}
+	RegisterReporter("record", reporter)
+	if GetReporter("record") != reporter {
+		t.Errorf("registered reporter not found")
+	}
+}
@@ -68,6 +68,8 @@ const (
 	LogDownstreamRemoteAddress string = "DownstreamRemoteAddress"
 	// identification of host selected
 	LogUpstreamHostSelectedGetter string = "UpstreamHostSelected"
+	// identification of request's correlation id
+	LogCorrelationId string = "CorrelationId"
 )
 
 const (
@@ -77,6 +79,9 @@ const (
 	RespHeaderPrefix string = "RESP."
 )
 
+// AccessLogEmptyValue is written in place of a placeholder that has no value
+const AccessLogEmptyValue = "-"
+
 const (
 	// Default Access Log Format, for more details please read "AccessLogDetails.md"
 	DefaultAccessLogFormat = "%StartTime% %RequestReceivedDuration% %ResponseReceivedDuration% %BytesSent%" + " " +
@@ -30,6 +30,13 @@ const (
 	ContextKeyLogger                     ContextKey = "Logger"
 	ContextKeyAccessLogs                 ContextKey = "AccessLogs"
 	ContextOriRemoteAddr                 ContextKey = "OriRemoteAddr"
+	ContextKeyPeerIdentity               ContextKey = "PeerIdentity"
+	ContextKeyBoltSwitch                 ContextKey = "BoltSwitch"
+	ContextKeyBoltCompression            ContextKey = "BoltCompression"
+	ContextKeyBoltForceCrc               ContextKey = "BoltForceCrc"
+	ContextKeyBoltHeartbeatInterval      ContextKey = "BoltHeartbeatInterval"
+	ContextKeyBoltResponseLimits         ContextKey = "BoltResponseLimits"
+	ContextKeyUpstreamCluster            ContextKey = "UpstreamCluster"
 )
 
 const (
@@ -17,16 +17,24 @@
 package types
 
 const (
-	HeaderStatus        = "x-mosn-status"
-	HeaderMethod        = "x-mosn-method"
-	HeaderHost          = "x-mosn-host"
-	HeaderPath          = "x-mosn-path"
-	HeaderQueryString   = "x-mosn-querystring"
-	HeaderStreamID      = "x-mosn-streamid"
-	HeaderGlobalTimeout = "x-mosn-global-timeout"
-	HeaderTryTimeout    = "x-mosn-try-timeout"
-	HeaderException     = "x-mosn-exception"
-	HeaderStremEnd      = "x-mosn-endstream"
+	HeaderStatus         = "x-mosn-status"
+	HeaderMethod         = "x-mosn-method"
+	HeaderHost           = "x-mosn-host"
+	HeaderPath           = "x-mosn-path"
+	HeaderQueryString    = "x-mosn-querystring"
+	HeaderStreamID       = "x-mosn-streamid"
+	HeaderGlobalTimeout  = "x-mosn-global-timeout"
+	HeaderTryTimeout     = "x-mosn-try-timeout"
+	HeaderException      = "x-mosn-exception"
+	HeaderStremEnd       = "x-mosn-endstream"
+	HeaderOneway         = "x-mosn-oneway"
+	HeaderPeerIdentity   = "x-mosn-peer-identity"
+	HeaderSourceIP       = "x-mosn-source-ip"
+	HeaderMirror         = "x-mosn-mirror"
+	HeaderCompression    = "x-mosn-compression"
+	HeaderWireContentLen = "x-mosn-wire-contentlen"
+	HeaderIdempotent     = "x-mosn-idempotent"
+	HeaderAttempt        = "x-mosn-attempt"
 )
 
 const (
@@ -40,7 +48,10 @@ const (
 	UnknownCode           int = 2
 	DeserialExceptionCode int = 3
 	SuccessCode           int = 200
+	PermissionDeniedCode  int = 403
 	RouterUnavailableCode int = 404
+	PayloadTooLargeCode   int = 413
+	RateLimitedCode       int = 429
 	NoHealthUpstreamCode  int = 500
 	UpstreamOverFlowCode  int = 503
 	TimeoutExceptionCode  int = 504
@@ -17,6 +17,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/alipay/sofamosn/pkg/api/v2"
 )
 
@@ -62,7 +64,10 @@ type HealthCheckSession interface {
 	SetUnhealthy(fType FailureType)
 }
 
+// HealthCheckHostMonitor is the health check session of a host
 type HealthCheckHostMonitor interface {
+	// LastCheckResult returns the time and result of the last health check, zero time if never checked
+	LastCheckResult() (time.Time, bool)
 }
 
 // todo: move facotry instance to a factory package
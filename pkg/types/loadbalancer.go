@@ -17,20 +17,47 @@
 package types
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"net"
 )
 
 type LoadBalancerType string
 
 const (
-	RoundRobin LoadBalancerType = "RoundRobin"
-	Random     LoadBalancerType = "Random"
+	RoundRobin         LoadBalancerType = "RoundRobin"
+	Random             LoadBalancerType = "Random"
+	WeightedRoundRobin LoadBalancerType = "WeightedRoundRobin"
+	ConsistentHash     LoadBalancerType = "ConsistentHash"
+	LeastRequest       LoadBalancerType = "LeastRequest"
 )
 
 type LoadBalancer interface {
 	ChooseHost(context LoadBalancerContext) Host
 }
 
+// HostFilter narrows the candidate hosts of a request in a load balancer chain,
+// the hosts passed in should not be modified
+type HostFilter interface {
+	// returns the hosts left to the following policies of the chain
+	Filter(context LoadBalancerContext, hosts []Host) []Host
+}
+
+// HostPicker chooses a host from the candidate hosts at the end of a load balancer chain
+type HostPicker interface {
+	PickHost(context LoadBalancerContext, hosts []Host) Host
+}
+
+// AffinityToken returns the session affinity token pinned to the host address, the token is
+// the truncated hmac of the address signed by the secret, so that it can't be forged or decoded by clients
+func AffinityToken(secret, addr string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(addr))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
 type LoadBalancerContext interface {
 	// compute an optional hash key to use during load balancing
 	ComputeHashKey() HashedValue
@@ -41,6 +68,9 @@ type LoadBalancerContext interface {
 	DownstreamConnection() net.Conn
 
 	DownstreamHeaders() map[string]string
+
+	// returns true if the host should be skipped, e.g. it has been tried by a previous retry
+	ShouldSelectAnotherHost(host Host) bool
 }
 
 // SubSetLoadBalancer
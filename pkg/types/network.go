@@ -20,6 +20,7 @@ import (
 	"context"
 	"io"
 	"net"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
 	"github.com/alipay/sofamosn/pkg/api/v2"
@@ -101,6 +102,9 @@ type Listener interface {
 	// Limit bytes per connection
 	PerConnBufferLimitBytes() uint32
 
+	// Watermarks of the bytes buffered to write per connection, zero high watermark means disabled
+	WriteBufferWatermarks() (low, high uint32)
+
 	// Set listener event listener
 	SetListenerCallbacks(cb ListenerEventListener)
 
@@ -339,6 +343,10 @@ type Connection interface {
 	// Return buffer limit
 	BufferLimit() uint32
 
+	// Set watermarks of the bytes buffered to write, the connection event listeners implementing
+	// WriteBufferWatermarkListener are notified when the buffered bytes cross the watermarks
+	SetWriteBufferWatermarks(low, high uint32)
+
 	// Set a local address
 	SetLocalAddress(localAddress net.Addr, restored bool)
 
@@ -373,6 +381,9 @@ type ClientConnection interface {
 
 	// connect to server in a async way
 	Connect(ioEnabled bool) error
+
+	// SetConnectTimeout sets the timeout of Connect, zero means no timeout
+	SetConnectTimeout(timeout time.Duration)
 }
 
 type ConnectionEvent string
@@ -403,6 +414,14 @@ type ConnectionEventListener interface {
 	OnEvent(event ConnectionEvent)
 }
 
+// WriteBufferWatermarkListener is notified when the bytes buffered to write on a connection go above
+// the high watermark, and when they drain to the low watermark after that
+type WriteBufferWatermarkListener interface {
+	OnAboveWriteBufferHighWatermark()
+
+	OnBelowWriteBufferLowWatermark()
+}
+
 type ConnectionHandler interface {
 	// Num of connections
 	NumConnections() uint64
@@ -411,6 +430,10 @@ type ConnectionHandler interface {
 	AddListener(lc *v2.ListenerConfig, networkFiltersFactory NetworkFilterChainFactory,
 		streamFiltersFactories []StreamFilterChainFactory)ListenerEventListener
 
+	// Update a running listener by name, connections accepted before are drained
+	UpdateListener(lc *v2.ListenerConfig, networkFiltersFactory NetworkFilterChainFactory,
+		streamFiltersFactories []StreamFilterChainFactory) ListenerEventListener
+
 	// Start a listener by tag
 	StartListener(listenerTag uint64, lctx context.Context)
 
@@ -430,6 +453,11 @@ type ConnectionHandler interface {
 	// + close : indicates whether the listening sockets will be closed
 	StopListeners(lctx context.Context, close bool)
 
+	// Close all listening sockets and wait the accepted connections to finish their requests,
+	// connections still alive after the timeout are closed forcibly.
+	// Returns num of connections closed forcibly
+	GracefulStopListeners(lctx context.Context, timeout time.Duration) int
+
 	// List all listeners' fd
 	ListListenersFD(lctx context.Context) []uintptr
 }
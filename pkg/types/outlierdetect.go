@@ -16,13 +16,37 @@
  */
 package types
 
+import "time"
+
+// OutlierResult is the result of a request reported to outlier detection
+type OutlierResult int
+
+const (
+	OutlierResultSuccess OutlierResult = iota
+	// the host returned a server side error, such as 5xx or SERVER_BUSY
+	OutlierResultServerError
+)
+
+// Detector ejects upstream hosts which keep returning errors, and re-admits them after a cool-down
 type Detector interface {
+	// Add a callback, which will be called when a host is ejected or re-admitted
 	AddChangedStateCb(cb func(host Host))
 
-	SuccessRateAverage() float64
+	// Used to update cluster's hosts for outlier detection
+	OnClusterMemberUpdate(hostsAdded []Host, hostsRemoved []Host)
 
-	SuccessRateEjectionThreshold() float64
+	// Stop stops the detector and re-admits all ejected hosts
+	Stop()
 }
 
+// DetectorHostMonitor records request results of a single host
 type DetectorHostMonitor interface {
+	// PutResult reports the result of a request sent to the host
+	PutResult(result OutlierResult)
+
+	// NumEjections returns how many times the host has been ejected
+	NumEjections() uint32
+
+	// LastEjectionTime returns the time the host was ejected last time, zero if never ejected
+	LastEjectionTime() time.Time
 }
@@ -47,6 +47,16 @@ const (
 	FaultInjected ResponseFlag = 0x400
 	// rate limited
 	RateLimited ResponseFlag = 0x800
+	// external processing of the request failed
+	ExtProcFailed ResponseFlag = 0x1000
+	// denied by authorization
+	Unauthorized ResponseFlag = 0x2000
+	// request content exceeds the max request bytes
+	RequestTooLarge ResponseFlag = 0x4000
+	// shed by the adaptive concurrency limit
+	ConcurrencyLimited ResponseFlag = 0x8000
+	// upstream response exceeds the response limits of cluster
+	UpstreamResponseTooLarge ResponseFlag = 0x10000
 )
 
 type RequestInfo interface {
@@ -83,6 +93,9 @@ type RequestInfo interface {
 	// get request's response code
 	ResponseCode() uint32
 
+	// set request's response code
+	SetResponseCode(code uint32)
+
 	// get duration since request's starting time
 	Duration() time.Duration
 
@@ -127,4 +140,10 @@ type RequestInfo interface {
 
 	// set route rule
 	SetRouteEntry(routerRule RouteRule)
+
+	// get correlation id of the request
+	CorrelationId() string
+
+	// set correlation id of the request
+	SetCorrelationId(id string)
 }
@@ -21,18 +21,26 @@ import (
 	"crypto/md5"
 	"regexp"
 	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
 )
 
 type Priority int
 
 const (
-	PriorityDefault     Priority = 0
-	PriorityHigh        Priority = 1
-	GlobalTimeout                = 60 * time.Second
-	DefaultRouteTimeout          = 15 * time.Second
-	SofaRouteMatchKey            = "service"
-	RouterMatadataKey            = "filter_metadata"
-	RouterMetadataKeyLb          = "mosn.lb"
+	PriorityDefault       Priority = 0
+	PriorityHigh          Priority = 1
+	GlobalTimeout                  = 60 * time.Second
+	DefaultRouteTimeout            = 15 * time.Second
+	SofaRouteMatchKey              = "service"
+	SofaRouteServiceKey            = "sofa_service"  // matches bolt className
+	SofaRouteMethodKey             = "sofa_method"   // matches bolt method name
+	DubboRouteServiceKey           = "dubbo_service" // matches dubbo service path
+	DubboRouteMethodKey            = "dubbo_method"
+	ThriftRouteServiceKey          = "thrift_service" // matches service of thrift multiplexed protocol
+	ThriftRouteMethodKey           = "thrift_method"
+	RouterMatadataKey              = "filter_metadata"
+	RouterMetadataKeyLb            = "mosn.lb"
 )
 
 // change RouterConfig -> Routers to manage all routers
@@ -83,6 +91,25 @@ type RouteRule interface {
 
 	// return the metadata that a subset load balancer should match when selecting an upstream host
 	MetadataMatchCriteria() MetadataMatchCriteria
+
+	// return the config to convert http2 requests to bolt requests, nil if not configured
+	BoltConvert() *v2.BoltConvert
+
+	// return the timeout of bolt requests carrying no timeout by the longest matched class name prefix,
+	// zero if not configured
+	ClassTimeout(className string) time.Duration
+
+	// return the cluster used if the cluster of the route has no healthy host, empty if not configured
+	FailoverClusterName() string
+
+	// return the max content length of requests checked by the request size filter, zero if not configured
+	MaxRequestBytes() uint64
+
+	// add and remove the request headers configured by the route
+	FinalizeRequestHeaders(headers map[string]string, requestInfo RequestInfo)
+
+	// add and remove the response headers configured by the route
+	FinalizeResponseHeaders(headers map[string]string, requestInfo RequestInfo)
 }
 
 type Policy interface {
@@ -90,6 +117,9 @@ type Policy interface {
 
 	ShadowPolicy() ShadowPolicy
 
+	// nil if requests are not hedged
+	HedgePolicy() HedgePolicy
+
 	CorsPolicy() CorsPolicy
 
 	LoadBalancerPolicy() LoadBalancerPolicy
@@ -171,6 +201,13 @@ type RetryPolicy interface {
 	TryTimeout() time.Duration
 
 	NumRetries() uint32
+
+	// response status codes which should be retried
+	RetryOnStatus() []int
+
+	// Idempotent returns true if the requests are safe to be sent again, e.g. on the upstream
+	// connection reset before any response
+	Idempotent() bool
 }
 
 type DoRetryCallback func()
@@ -185,6 +222,20 @@ type ShadowPolicy interface {
 	ClusterName() string
 
 	RuntimeKey() string
+
+	// percent of requests mirrored to the shadow cluster, 0~100
+	Percent() uint32
+}
+
+type HedgePolicy interface {
+	// fixed delay before a duplicate request is sent, zero if the delay is percentile based
+	HedgeDelay() time.Duration
+
+	// percentile of the cluster request latency used as the delay, 0~1
+	HedgeDelayPercentile() float64
+
+	// max duplicate requests sent for a request
+	MaxHedges() uint32
 }
 
 type VirtualServer interface {
@@ -263,7 +314,6 @@ type Decorator interface {
 // currently use string for easily debug
 type HashedValue string // value as md5's result
 
-
 type HeaderFormat interface {
 	Format(info RequestInfo) string
 	Append() bool
@@ -277,6 +327,7 @@ const (
 	Exact
 	Regex
 	SofaHeader
+	SourceIP
 )
 
 type SslRequirements uint32
@@ -89,6 +89,7 @@ const (
 	StreamLocalReset            StreamResetReason = "StreamLocalReset"
 	StreamOverflow              StreamResetReason = "StreamOverflow"
 	StreamRemoteReset           StreamResetReason = "StreamRemoteReset"
+	StreamResponseTooLarge      StreamResetReason = "StreamResponseTooLarge"
 )
 
 // Core model in stream layer, a generic protocol stream
@@ -213,6 +214,39 @@ type StreamFilterCallbacks interface {
 
 	// Request info related to the stream
 	RequestInfo() RequestInfo
+
+	// Well-known request headers decoded once on request received
+	RequestContext() RequestContext
+}
+
+// RequestContext is the typed view of the request headers, filters read the well-known
+// headers from it instead of parsing the header map again
+type RequestContext interface {
+	// unique name of the service, formatted as interface:version[:uniqueId]
+	Service() string
+
+	ServiceInterface() string
+
+	ServiceVersion() string
+
+	Method() string
+
+	ClassName() string
+
+	AppName() string
+
+	TargetApp() string
+
+	TargetInstance() string
+
+	TraceId() string
+
+	RpcId() string
+
+	CallerIp() string
+
+	// raw header map, including the headers not known
+	Headers() map[string]string
 }
 
 // Stream encoder filter
@@ -314,6 +348,15 @@ type StreamFilterChainFactory interface {
 	CreateFilterChain(context context.Context, callbacks FilterChainFactoryCallbacks)
 }
 
+// HeadersMutator mutates decoded headers of a stream in place. Request headers are mutated
+// before being sent upstream, and response headers before being sent downstream.
+// Mutations of the header map are encoded into the outgoing frame by the stream codec.
+type HeadersMutator interface {
+	MutateRequestHeaders(headers map[string]string)
+
+	MutateResponseHeaders(headers map[string]string)
+}
+
 type FilterChainFactoryCallbacks interface {
 	AddStreamSenderFilter(filter StreamSenderFilter)
 
@@ -369,6 +412,14 @@ type ConnectionPool interface {
 	Close()
 }
 
+// ConnectionPoolPrewarmer is implemented by the connection pools which can open connections
+// before the requests come
+type ConnectionPoolPrewarmer interface {
+	// Prewarm opens connections until the pool holds num of them, it returns once the connections
+	// are established or the context is done, connections still connecting are added to pool later
+	Prewarm(context context.Context, num uint32)
+}
+
 type PoolEventListener interface {
 	OnFailure(streamId string, reason PoolFailureReason, host Host)
 
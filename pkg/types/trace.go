@@ -30,6 +30,15 @@ type Span interface {
 	SpawnChild() Span
 }
 
+// Driver starts spans for requests, the trace context is read from request headers
 type Driver interface {
-	start(requestHeaders map[string]string, operationName string, startTime time.Time) Span
+	Start(requestHeaders map[string]string, operationName string, startTime time.Time) Span
 }
+
+// tags set on spans of proxied requests
+const (
+	SpanTagProtocol     = "protocol"
+	SpanTagCluster      = "cluster"
+	SpanTagUpstreamHost = "upstream_host"
+	SpanTagStatus       = "status"
+)
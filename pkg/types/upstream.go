@@ -20,6 +20,7 @@ import (
 	"context"
 	"net"
 	"sort"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
 	"github.com/alipay/sofamosn/pkg/api/v2"
@@ -65,6 +66,9 @@ type ClusterManager interface {
 	ClusterExist(clusterName string) bool
 
 	RemoveClusterHosts(clusterName string, host Host) error
+
+	// PrewarmingClusters returns the clusters whose connections to the hosts are being pre-warmed
+	PrewarmingClusters() []string
 }
 
 // thread-safe cluster snapshot
@@ -92,7 +96,15 @@ type Cluster interface {
 	// return the cluster's health checker
 	HealthChecker() HealthChecker
 
+	// set the cluster's outlier detector
+	SetOutlierDetector(detector Detector)
+
+	// return the cluster's outlier detector
 	OutlierDetector() Detector
+
+	// set the health override of the host by address, which is kept for the address until cleared by
+	// HealthOverrideNone, so that hosts updated by discovery keep it. Returns false if the host is not in the cluster
+	SetHostHealthOverride(address string, override HealthOverride) bool
 }
 
 type InitializePhase string
@@ -145,6 +157,29 @@ const (
 	FAILED_OUTLIER_CHECK HealthFlag = 0x02
 )
 
+// HealthOverride is the health of a host set manually, e.g. by admin api. It takes precedence over
+// the health flags set by active health check and outlier detection until it is cleared.
+type HealthOverride int32
+
+const (
+	HealthOverrideNone HealthOverride = iota
+	// the host is unhealthy whatever the health flags are
+	HealthOverrideEjected
+	// the host is healthy whatever the health flags are, and is not ejected by outlier detection
+	HealthOverrideAdmitted
+)
+
+func (o HealthOverride) String() string {
+	switch o {
+	case HealthOverrideEjected:
+		return "ejected"
+	case HealthOverrideAdmitted:
+		return "admitted"
+	default:
+		return "none"
+	}
+}
+
 // An upstream host
 type Host interface {
 	HostInfo
@@ -162,8 +197,13 @@ type Host interface {
 
 	SetHealthFlag(flag HealthFlag)
 
+	// Health returns false if the host is manually ejected or has any health flag set, unless manually admitted
 	Health() bool
 
+	HealthOverride() HealthOverride
+
+	SetHealthOverride(override HealthOverride)
+
 	SetHealthChecker(healthCheck HealthCheckHostMonitor)
 
 	SetOutlierDetector(outlierDetector DetectorHostMonitor)
@@ -175,6 +215,15 @@ type Host interface {
 	Used() bool
 
 	SetUsed(used bool)
+
+	// ActiveRequests returns the requests dispatched to the host and not completed yet
+	ActiveRequests() int64
+
+	// IncActiveRequests is called when a request is dispatched to the host
+	IncActiveRequests()
+
+	// DecActiveRequests is called when a request to the host is completed, by response, reset or timeout
+	DecActiveRequests()
 }
 
 type HostInfo interface {
@@ -231,7 +280,40 @@ type ClusterInfo interface {
 
 	SourceAddress() net.Addr
 
-	ConnectTimeout() int
+	// ConnectTimeout returns the timeout to establish upstream connections, zero means no timeout
+	ConnectTimeout() time.Duration
+
+	// BoltSwitch returns the bolt v2 switch bits turned on for the requests sent to the cluster
+	BoltSwitch() byte
+
+	// BoltCompression returns the bolt v2 content compression of the requests sent to the cluster
+	BoltCompression() v2.BoltCompression
+
+	// ForceCrc returns whether the frames sent to the cluster are forced to be bolt v2 with crc32,
+	// the responses without valid crc32 are rejected
+	ForceCrc() bool
+
+	// HeartbeatInterval returns the interval of heartbeats sent on the bolt connections to the cluster,
+	// zero means no heartbeat
+	HeartbeatInterval() time.Duration
+
+	// ResponseLimits returns the max declared lengths of the bolt responses from the cluster
+	ResponseLimits() v2.ResponseLimits
+
+	// SessionAffinity returns the session affinity config, requests carrying the affinity token
+	// are sent to the pinned host
+	SessionAffinity() v2.SessionAffinityConfig
+
+	// UpstreamProtocol returns the protocol of the requests sent to the cluster, empty means
+	// the upstream protocol of proxy
+	UpstreamProtocol() Protocol
+
+	// RateLimiter returns the rate limiter pacing the requests sent to the cluster, nil means no limit
+	RateLimiter() RequestRateLimiter
+
+	// RetryOnStatus returns the response statuses retried on for the requests sent to the cluster,
+	// which override the ones of the route retry policy, empty means the route ones
+	RetryOnStatus() []int
 
 	ConnBufferLimitBytes() uint32
 
@@ -245,6 +327,9 @@ type ClusterInfo interface {
 
 	MaxRequestsPerConn() uint32
 
+	// settings of the connection pool to each host
+	ConnectionPool() v2.ConnectionPool
+
 	Stats() ClusterStats
 
 	ResourceManager() ResourceManager
@@ -280,6 +365,22 @@ type Resource interface {
 	Max() uint64
 }
 
+// RequestRateLimiter paces the requests sent to a cluster
+type RequestRateLimiter interface {
+	// Reserve takes a slot for a request, returns how long the request should wait before sent,
+	// or false if the request should be shed
+	Reserve() (time.Duration, bool)
+}
+
+// RetryBudget is a Retries resource limiting the retries in flight to a percentage of the active requests
+type RetryBudget interface {
+	Resource
+
+	BudgetPercent() float64
+
+	MinRetryConcurrency() uint64
+}
+
 type ClusterStats struct {
 	Namespace                                      string
 	UpstreamConnectionTotal                        metrics.Counter
@@ -305,13 +406,23 @@ type ClusterStats struct {
 	UpstreamRequestRemoteReset                     metrics.Counter
 	UpstreamRequestRetry                           metrics.Counter
 	UpstreamRequestRetryOverflow                   metrics.Counter
+	UpstreamRequestRetryBudgetExceeded             metrics.Counter
+	UpstreamRequestHedge                           metrics.Counter
+	UpstreamRequestFailover                        metrics.Counter
 	UpstreamRequestTimeout                         metrics.Counter
 	UpstreamRequestFailureEject                    metrics.Counter
 	UpstreamRequestPendingOverflow                 metrics.Counter
+	UpstreamRequestOverflow                        metrics.Counter
+	UpstreamResponseTooLarge                       metrics.Counter
+	UpstreamRequestPaced                           metrics.Counter
+	UpstreamRequestRateLimited                     metrics.Counter
 	LBSubSetsFallBack                              metrics.Counter
 	LBSubSetsActive                                metrics.Counter
 	LBSubsetsCreated                               metrics.Counter
 	LBSubsetsRemoved                               metrics.Counter
+	OutlierDetectionEjectionsTotal                 metrics.Counter
+	OutlierDetectionEjectionsActive                metrics.Counter
+	OutlierDetectionEjectionsOverflow              metrics.Counter
 }
 
 type CreateConnectionData struct {
@@ -336,6 +447,16 @@ type ClusterManagerFilter interface {
 	OnCreated(cccb ClusterConfigFactoryCb, chcb ClusterHostFactoryCb)
 }
 
+// ServiceDiscovery provides the host list of clusters from an external source, such as a hosts file
+type ServiceDiscovery interface {
+	// Subscribe returns a channel receiving the full host list of the cluster each time it changes,
+	// the current host list is delivered first if it is known
+	Subscribe(clusterName string) (<-chan []v2.Host, error)
+
+	// Close stops watching and closes all the subscribed channels
+	Close()
+}
+
 type RegisterUpstreamUpdateMethodCb interface {
 	TriggerClusterUpdate(clusterName string, hosts []v2.Host)
 	GetClusterNameByServiceName(serviceName string) string
@@ -17,14 +17,17 @@
 package cluster
 
 import (
+	"crypto/rand"
 	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
 	"github.com/alipay/sofamosn/pkg/api/v2"
 
 	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/stats"
 	"github.com/alipay/sofamosn/pkg/tls"
 	"github.com/alipay/sofamosn/pkg/types"
 )
@@ -38,6 +41,11 @@ type cluster struct {
 	mux                            sync.RWMutex
 	initHelper                     concreteClusterInitHelper
 	healthChecker                  types.HealthChecker
+	outlierDetector                types.Detector
+
+	// manual health overrides by host address, applied to the hosts added later
+	overrideMux     sync.Mutex
+	healthOverrides map[string]types.HealthOverride
 }
 
 type concreteClusterInitHelper interface {
@@ -51,6 +59,9 @@ func NewCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaApi bool)
 
 	case v2.SIMPLE_CLUSTER, v2.DYNAMIC_CLUSTER:
 		newCluster = newSimpleInMemCluster(clusterConfig, sourceAddr, addedViaApi)
+
+	case v2.STRICT_DNS_CLUSTER:
+		newCluster = newStrictDnsCluster(clusterConfig, sourceAddr, addedViaApi)
 	}
 
 	// init health check for cluster's host
@@ -60,6 +71,11 @@ func NewCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaApi bool)
 		newCluster.SetHealthChecker(hc)
 	}
 
+	// init outlier detection for cluster's host
+	if clusterConfig.OutlierDetection.Consecutive_5Xx > 0 {
+		newCluster.SetOutlierDetector(NewOutlierDetector(clusterConfig.OutlierDetection, newCluster))
+	}
+
 	return newCluster
 }
 
@@ -72,11 +88,23 @@ func newCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaApi bool,
 			sourceAddr:           sourceAddr,
 			addedViaApi:          addedViaApi,
 			maxRequestsPerConn:   clusterConfig.MaxRequestPerConn,
+			connectionPool:       clusterConfig.ConnectionPool,
 			connBufferLimitBytes: clusterConfig.ConnBufferLimitBytes,
+			connectTimeout:       clusterConfig.ConnectTimeout,
+			boltSwitch:           clusterConfig.BoltSwitch,
+			boltCompression:      clusterConfig.BoltCompression,
+			forceCrc:             clusterConfig.ForceCrc,
+			heartbeatInterval:    clusterConfig.HeartbeatInterval,
+			responseLimits:       clusterConfig.ResponseLimits,
+			sessionAffinity:      newSessionAffinity(clusterConfig.SessionAffinity),
+			upstreamProtocol:     types.Protocol(clusterConfig.UpstreamProtocol),
+			rateLimiter:          newRequestRateLimiter(clusterConfig.RateLimit),
+			retryOnStatus:        clusterConfig.RetryOnStatus,
 			stats:                newClusterStats(clusterConfig),
 			lbSubsetInfo:         NewLBSubsetInfo(&clusterConfig.LBSubSetConfig), // new subset load balancer info
 		},
-		initHelper: initHelper,
+		initHelper:      initHelper,
+		healthOverrides: make(map[string]types.HealthOverride),
 	}
 	
 	switch clusterConfig.LbType {
@@ -85,6 +113,15 @@ func newCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaApi bool,
 		
 	case v2.LB_ROUNDROBIN:
 		cluster.info.lbType = types.RoundRobin
+
+	case v2.LB_WEIGHTED_ROUNDROBIN:
+		cluster.info.lbType = types.WeightedRoundRobin
+
+	case v2.LB_CONSISTENT_HASH:
+		cluster.info.lbType = types.ConsistentHash
+
+	case v2.LB_LEAST_REQUEST:
+		cluster.info.lbType = types.LeastRequest
 	}
 	
 	// TODO: init more props: maxrequestsperconn, connecttimeout, connectionbuflimit
@@ -98,16 +135,49 @@ func newCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaApi bool,
 	
 	var lb types.LoadBalancer
 	
-	if cluster.Info().LbSubsetInfo().IsEnabled() {
+	if len(clusterConfig.LbChain) > 0 {
+		// hosts are narrowed by the filters in order, and chosen by the lb type at last
+		var filters []types.HostFilter
+		for _, filterType := range clusterConfig.LbChain {
+			filters = append(filters, NewHostFilter(filterType, clusterConfig))
+		}
+		lb = NewChainLoadBalancer(cluster.PrioritySet(), filters,
+			NewHostPicker(cluster.Info().LbType(), clusterConfig.ConsistentHash))
+
+	} else if cluster.Info().LbSubsetInfo().IsEnabled() {
 		// use subset loadbalancer
 		lb = NewSubsetLoadBalancer(cluster.Info().LbType(), cluster.PrioritySet(), cluster.Info().Stats(),
-			cluster.Info().LbSubsetInfo())
+			cluster.Info().LbSubsetInfo(), clusterConfig.ConsistentHash)
 		
+	} else if clusterConfig.ZoneAware.LocalZone != "" {
+		// hosts in local zone are preferred, each zone is balanced by its own loadbalancer
+		lbType, window := cluster.Info().LbType(), clusterConfig.SlowStartWindow
+		lb = NewZoneAwareLoadBalancer(cluster.PrioritySet(), clusterConfig.ZoneAware, func(prioritySet types.PrioritySet) types.LoadBalancer {
+			if lbType == types.WeightedRoundRobin && window > 0 {
+				return NewSlowStartLoadBalancer(prioritySet, window)
+			}
+
+			return NewLoadBalancer(lbType, prioritySet)
+		})
+
+	} else if cluster.Info().LbType() == types.WeightedRoundRobin && clusterConfig.SlowStartWindow > 0 {
+		// hosts added or recovered are in slow start
+		lb = NewSlowStartLoadBalancer(cluster.PrioritySet(), clusterConfig.SlowStartWindow)
+
+	} else if cluster.Info().LbType() == types.ConsistentHash {
+		// consistent hash loadbalancer needs hash key config
+		lb = NewConsistentHashLoadBalancer(cluster.PrioritySet(), clusterConfig.ConsistentHash)
+
 	} else {
 		// use common loadbalancer
 		lb = NewLoadBalancer(cluster.Info().LbType(), cluster.PrioritySet())
 	}
 	
+	if affinity := cluster.info.sessionAffinity; affinity.Header != "" {
+		// requests with affinity token are sent to the pinned host
+		lb = NewStickyLoadBalancer(lb, cluster.PrioritySet(), affinity)
+	}
+
 	cluster.info.lbInstance = lb
 	
 	cluster.info.tlsMng = tls.NewTLSClientContextManager(&clusterConfig.TLS, cluster.info)
@@ -127,42 +197,72 @@ func (c *cluster) Initialize(cb func()) {
 	}
 }
 
+// newSessionAffinity returns the session affinity config of the cluster, a random secret
+// is generated to sign the affinity tokens if it's not configured
+func newSessionAffinity(config v2.SessionAffinityConfig) v2.SessionAffinityConfig {
+	if config.Header != "" && config.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		config.Secret = string(secret)
+	}
+
+	return config
+}
+
 func newClusterStats(config v2.Cluster) types.ClusterStats {
 	nameSpace := fmt.Sprintf("cluster.%s", config.Name)
 
 	return types.ClusterStats{
 		Namespace:                                      nameSpace,
-		UpstreamConnectionTotal:                        metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_total"), nil),
-		UpstreamConnectionClose:                        metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_close"), nil),
-		UpstreamConnectionActive:                       metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_active"), nil),
-		UpstreamConnectionTotalHttp1:                   metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_total_http1"), nil),
-		UpstreamConnectionTotalHttp2:                   metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_total_http2"), nil),
-		UpstreamConnectionTotalSofaRpc:                 metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_total_sofarpc"), nil),
-		UpstreamConnectionConFail:                      metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_con_fail"), nil),
-		UpstreamConnectionRetry:                        metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_retry"), nil),
-		UpstreamConnectionLocalClose:                   metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_local_close"), nil),
-		UpstreamConnectionRemoteClose:                  metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_remote_close"), nil),
-		UpstreamConnectionLocalCloseWithActiveRequest:  metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_local_close_with_active_request"), nil),
-		UpstreamConnectionRemoteCloseWithActiveRequest: metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_remote_close_with_active_request"), nil),
-		UpstreamConnectionCloseNotify:                  metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_close_notify"), nil),
-		UpstreamBytesRead:                              metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_bytes_read"), nil),
+		UpstreamConnectionTotal:                        clusterCounter(nameSpace, config.Name, "upstream_connection_total"),
+		UpstreamConnectionClose:                        clusterCounter(nameSpace, config.Name, "upstream_connection_close"),
+		UpstreamConnectionActive:                       clusterCounter(nameSpace, config.Name, "upstream_connection_active"),
+		UpstreamConnectionTotalHttp1:                   clusterCounter(nameSpace, config.Name, "upstream_connection_total_http1"),
+		UpstreamConnectionTotalHttp2:                   clusterCounter(nameSpace, config.Name, "upstream_connection_total_http2"),
+		UpstreamConnectionTotalSofaRpc:                 clusterCounter(nameSpace, config.Name, "upstream_connection_total_sofarpc"),
+		UpstreamConnectionConFail:                      clusterCounter(nameSpace, config.Name, "upstream_connection_con_fail"),
+		UpstreamConnectionRetry:                        clusterCounter(nameSpace, config.Name, "upstream_connection_retry"),
+		UpstreamConnectionLocalClose:                   clusterCounter(nameSpace, config.Name, "upstream_connection_local_close"),
+		UpstreamConnectionRemoteClose:                  clusterCounter(nameSpace, config.Name, "upstream_connection_remote_close"),
+		UpstreamConnectionLocalCloseWithActiveRequest:  clusterCounter(nameSpace, config.Name, "upstream_connection_local_close_with_active_request"),
+		UpstreamConnectionRemoteCloseWithActiveRequest: clusterCounter(nameSpace, config.Name, "upstream_connection_remote_close_with_active_request"),
+		UpstreamConnectionCloseNotify:                  clusterCounter(nameSpace, config.Name, "upstream_connection_close_notify"),
+		UpstreamBytesRead:                              clusterCounter(nameSpace, config.Name, "upstream_connection_bytes_read"),
 		UpstreamBytesReadCurrent:                       metrics.GetOrRegisterGauge(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_bytes_read_current"), nil),
-		UpstreamBytesWrite:                             metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_bytes_write"), nil),
+		UpstreamBytesWrite:                             clusterCounter(nameSpace, config.Name, "upstream_connection_bytes_write"),
 		UpstreamBytesWriteCurrent:                      metrics.GetOrRegisterGauge(fmt.Sprintf("%s.%s", nameSpace, "upstream_connection_bytes_write_current"), nil),
-		UpstreamRequestTotal:                           metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_request_request_total"), nil),
-		UpstreamRequestActive:                          metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_request_request_active"), nil),
-		UpstreamRequestLocalReset:                      metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_request_request_local_reset"), nil),
-		UpstreamRequestRemoteReset:                     metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_request_request_remote_reset"), nil),
-		UpstreamRequestTimeout:                         metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_request_request_timeout"), nil),
-		UpstreamRequestFailureEject:                    metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_request_failure_eject"), nil),
-		UpstreamRequestPendingOverflow:                 metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_request_pending_overflow"), nil),
-		LBSubSetsFallBack:                              metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_LBSubSetsFallBack"), nil),
-		LBSubSetsActive:                                metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_LBSubSetsActive"), nil),
-		LBSubsetsCreated:                               metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_LBSubsetsCreated"), nil),
-		LBSubsetsRemoved:                               metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, "upstream_LBSubsetsRemoved"), nil),
+		UpstreamRequestTotal:                           clusterCounter(nameSpace, config.Name, "upstream_request_request_total"),
+		UpstreamRequestActive:                          clusterCounter(nameSpace, config.Name, "upstream_request_request_active"),
+		UpstreamRequestLocalReset:                      clusterCounter(nameSpace, config.Name, "upstream_request_request_local_reset"),
+		UpstreamRequestRemoteReset:                     clusterCounter(nameSpace, config.Name, "upstream_request_request_remote_reset"),
+		UpstreamRequestRetry:                           clusterCounter(nameSpace, config.Name, "upstream_request_retry"),
+		UpstreamRequestRetryOverflow:                   clusterCounter(nameSpace, config.Name, "upstream_request_retry_overflow"),
+		UpstreamRequestRetryBudgetExceeded:             clusterCounter(nameSpace, config.Name, "upstream_request_retry_budget_exceeded"),
+		UpstreamRequestHedge:                           clusterCounter(nameSpace, config.Name, "upstream_request_hedge"),
+		UpstreamRequestFailover:                        clusterCounter(nameSpace, config.Name, "upstream_request_failover"),
+		UpstreamRequestTimeout:                         clusterCounter(nameSpace, config.Name, "upstream_request_request_timeout"),
+		UpstreamRequestFailureEject:                    clusterCounter(nameSpace, config.Name, "upstream_request_failure_eject"),
+		UpstreamRequestPendingOverflow:                 clusterCounter(nameSpace, config.Name, "upstream_request_pending_overflow"),
+		UpstreamRequestOverflow:                        clusterCounter(nameSpace, config.Name, "upstream_request_overflow"),
+		UpstreamResponseTooLarge:                       clusterCounter(nameSpace, config.Name, "upstream_response_too_large"),
+		UpstreamRequestPaced:                           clusterCounter(nameSpace, config.Name, "upstream_request_paced"),
+		UpstreamRequestRateLimited:                     clusterCounter(nameSpace, config.Name, "upstream_request_rate_limited"),
+		LBSubSetsFallBack:                              clusterCounter(nameSpace, config.Name, "upstream_LBSubSetsFallBack"),
+		LBSubSetsActive:                                clusterCounter(nameSpace, config.Name, "upstream_LBSubSetsActive"),
+		LBSubsetsCreated:                               clusterCounter(nameSpace, config.Name, "upstream_LBSubsetsCreated"),
+		LBSubsetsRemoved:                               clusterCounter(nameSpace, config.Name, "upstream_LBSubsetsRemoved"),
+		OutlierDetectionEjectionsTotal:                 clusterCounter(nameSpace, config.Name, "outlier_detection_ejections_total"),
+		OutlierDetectionEjectionsActive:                clusterCounter(nameSpace, config.Name, "outlier_detection_ejections_active"),
+		OutlierDetectionEjectionsOverflow:              clusterCounter(nameSpace, config.Name, "outlier_detection_ejections_overflow"),
 	}
 }
 
+// clusterCounter registers the counter of cluster, whose updates are also recorded to the metrics sink
+func clusterCounter(nameSpace, clusterName, name string) metrics.Counter {
+	return stats.CounterWithSink(metrics.GetOrRegisterCounter(fmt.Sprintf("%s.%s", nameSpace, name), nil),
+		"mosn_cluster_"+name, stats.Tags{stats.TagCluster: clusterName})
+}
+
 func (c *cluster) Info() types.ClusterInfo {
 	return c.info
 }
@@ -178,21 +278,84 @@ func (c *cluster) PrioritySet() types.PrioritySet {
 func (c *cluster) SetHealthChecker(hc types.HealthChecker) {
 	c.healthChecker = hc
 	c.healthChecker.SetCluster(c)
-	c.healthChecker.Start()
 	c.healthChecker.AddHostCheckCompleteCb(func(host types.Host, changedState bool) {
 		if changedState {
 			c.refreshHealthHosts(host)
 		}
 	})
+	c.healthChecker.Start()
 }
 
 func (c *cluster) HealthChecker() types.HealthChecker {
 	return c.healthChecker
 }
 
+func (c *cluster) SetOutlierDetector(detector types.Detector) {
+	c.outlierDetector = detector
+	c.outlierDetector.AddChangedStateCb(func(host types.Host) {
+		c.refreshHealthHosts(host)
+	})
+}
+
 func (c *cluster) OutlierDetector() types.Detector {
-	// TODO
-	return nil
+	return c.outlierDetector
+}
+
+func (c *cluster) SetHostHealthOverride(address string, override types.HealthOverride) bool {
+	var hosts []types.Host
+	for _, hostSet := range c.prioritySet.HostSetsByPriority() {
+		for _, host := range hostSet.Hosts() {
+			if host.AddressString() == address {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	if len(hosts) == 0 {
+		return false
+	}
+
+	c.overrideMux.Lock()
+	if override == types.HealthOverrideNone {
+		delete(c.healthOverrides, address)
+	} else {
+		c.healthOverrides[address] = override
+	}
+	c.overrideMux.Unlock()
+
+	for _, host := range hosts {
+		host.SetHealthOverride(override)
+		c.refreshHealthHosts(host)
+	}
+
+	log.DefaultLogger.Infof("health override of host %s in cluster %s is set to %s", address, c.info.name, override)
+
+	return true
+}
+
+// applyHealthOverrides sets the health overrides kept for the addresses of hosts added by discovery
+func (c *cluster) applyHealthOverrides(hosts []types.Host) {
+	c.overrideMux.Lock()
+	defer c.overrideMux.Unlock()
+
+	for _, host := range hosts {
+		if override, ok := c.healthOverrides[host.AddressString()]; ok {
+			host.SetHealthOverride(override)
+		}
+	}
+}
+
+// copyHealthOverrides keeps the health overrides of the cluster replaced by the new one
+func (c *cluster) copyHealthOverrides(from *cluster) {
+	from.overrideMux.Lock()
+	defer from.overrideMux.Unlock()
+
+	c.overrideMux.Lock()
+	defer c.overrideMux.Unlock()
+
+	for address, override := range from.healthOverrides {
+		c.healthOverrides[address] = override
+	}
 }
 
 // update health-hostSet for only one hostSet, reduce update times
@@ -227,10 +390,20 @@ type clusterInfo struct {
 	lbType               types.LoadBalancerType
 	lbInstance           types.LoadBalancer         // load balancer used for this cluster
 	sourceAddr           net.Addr
-	connectTimeout       int
+	connectTimeout       time.Duration
+	boltSwitch           byte
+	boltCompression      v2.BoltCompression
+	forceCrc             bool
+	heartbeatInterval    time.Duration
+	responseLimits       v2.ResponseLimits
+	sessionAffinity      v2.SessionAffinityConfig
+	upstreamProtocol     types.Protocol
+	rateLimiter          types.RequestRateLimiter
+	retryOnStatus        []int
 	connBufferLimitBytes uint32
 	features             int
 	maxRequestsPerConn   uint32
+	connectionPool       v2.ConnectionPool
 	addedViaApi          bool
 	resourceManager      types.ResourceManager
 	stats                types.ClusterStats
@@ -261,10 +434,46 @@ func (ci *clusterInfo) SourceAddress() net.Addr {
 	return ci.sourceAddr
 }
 
-func (ci *clusterInfo) ConnectTimeout() int {
+func (ci *clusterInfo) ConnectTimeout() time.Duration {
 	return ci.connectTimeout
 }
 
+func (ci *clusterInfo) BoltSwitch() byte {
+	return ci.boltSwitch
+}
+
+func (ci *clusterInfo) BoltCompression() v2.BoltCompression {
+	return ci.boltCompression
+}
+
+func (ci *clusterInfo) ForceCrc() bool {
+	return ci.forceCrc
+}
+
+func (ci *clusterInfo) HeartbeatInterval() time.Duration {
+	return ci.heartbeatInterval
+}
+
+func (ci *clusterInfo) ResponseLimits() v2.ResponseLimits {
+	return ci.responseLimits
+}
+
+func (ci *clusterInfo) SessionAffinity() v2.SessionAffinityConfig {
+	return ci.sessionAffinity
+}
+
+func (ci *clusterInfo) UpstreamProtocol() types.Protocol {
+	return ci.upstreamProtocol
+}
+
+func (ci *clusterInfo) RateLimiter() types.RequestRateLimiter {
+	return ci.rateLimiter
+}
+
+func (ci *clusterInfo) RetryOnStatus() []int {
+	return ci.retryOnStatus
+}
+
 func (ci *clusterInfo) ConnBufferLimitBytes() uint32 {
 	return ci.connBufferLimitBytes
 }
@@ -289,6 +498,10 @@ func (ci *clusterInfo) MaxRequestsPerConn() uint32 {
 	return ci.maxRequestsPerConn
 }
 
+func (ci *clusterInfo) ConnectionPool() v2.ConnectionPool {
+	return ci.connectionPool
+}
+
 func (ci *clusterInfo) Stats() types.ClusterStats {
 	return ci.stats
 }
@@ -329,7 +542,11 @@ func (ps *prioritySet) GetOrCreateHostSet(priority uint32) types.HostSet {
 		for i := uint32(len(ps.hostSets)); i <= priority; i++ {
 			hostSet := ps.createHostSet(i)
 			hostSet.addMemberUpdateCb(func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
-				for _, cb := range ps.updateCallbacks {
+				ps.mux.RLock()
+				callbacks := ps.updateCallbacks
+				ps.mux.RUnlock()
+
+				for _, cb := range callbacks {
 					cb(priority, hostsAdded, hostsRemoved)
 				}
 			})
@@ -346,7 +563,11 @@ func (ps *prioritySet) createHostSet(priority uint32) *hostSet {
 	}
 }
 
+// AddMemberUpdateCb may be called while hosts are updated, as load balancers of zones are created on demand
 func (ps *prioritySet) AddMemberUpdateCb(cb types.MemberUpdateCallback) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
 	ps.updateCallbacks = append(ps.updateCallbacks, cb)
 }
 
@@ -402,10 +623,20 @@ func addHealthyHost(hostSets []types.HostSet, host types.Host) {
 		}
 
 		if found {
-			newHealthHost := hostSet.HealthyHosts()
+			for _, hh := range hostSet.HealthyHosts() {
+				if hh.AddressString() == host.AddressString() {
+					return
+				}
+			}
+
+			newHealthHost := make([]types.Host, len(hostSet.HealthyHosts()), len(hostSet.HealthyHosts())+1)
+			copy(newHealthHost, hostSet.HealthyHosts())
 			newHealthHost = append(newHealthHost, host)
 			newHealthyHostPerLocality := hostSet.HealthHostsPerLocality()
-			newHealthyHostPerLocality[len(newHealthyHostPerLocality)-1] = append(newHealthyHostPerLocality[len(newHealthyHostPerLocality)-1], host)
+
+			if len(newHealthyHostPerLocality) > 0 {
+				newHealthyHostPerLocality[len(newHealthyHostPerLocality)-1] = append(newHealthyHostPerLocality[len(newHealthyHostPerLocality)-1], host)
+			}
 
 			hostSet.UpdateHosts(hostSet.Hosts(), newHealthHost, hostSet.HostsPerLocality(),
 				newHealthyHostPerLocality, nil, nil)
@@ -428,21 +659,20 @@ func delHealthHost(hostSets []types.HostSet, host types.Host) {
 		}
 
 		if found {
-			newHealthHost := hostSet.HealthyHosts()
+			var newHealthHost []types.Host
 			newHealthyHostPerLocality := hostSet.HealthHostsPerLocality()
 
-			for i, hh := range newHealthHost {
-				if host.Hostname() == hh.Hostname() {
-					//remove
-					newHealthHost = append(newHealthHost[:i], newHealthHost[i+1:]...)
-					break
+			// build a new slice, the old one may be in use by load balancers
+			for _, hh := range hostSet.HealthyHosts() {
+				if host.AddressString() != hh.AddressString() {
+					newHealthHost = append(newHealthHost, hh)
 				}
 			}
 
 			for i := range newHealthyHostPerLocality {
 				for j := range newHealthyHostPerLocality[i] {
 
-					if host.Hostname() == newHealthyHostPerLocality[i][j].Hostname() {
+					if host.AddressString() == newHealthyHostPerLocality[i][j].AddressString() {
 						newHealthyHostPerLocality[i] = append(newHealthyHostPerLocality[i][:j], newHealthyHostPerLocality[i][j+1:]...)
 						break
 					}
@@ -22,6 +22,7 @@ import (
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/log"
 	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
 )
 
 var ClusterAdap ClusterAdapter
@@ -62,6 +63,25 @@ func (ca *ClusterAdapter) TriggerClusterUpdate(clusterName string, hosts []v2.Ho
 	return nil
 }
 
+// Subscribes cluster's hosts from the service discovery, the cluster is updated on each host list pushed.
+// Surviving hosts keep their connections, and removed hosts are drained.
+func (ca *ClusterAdapter) SubscribeServiceDiscovery(sd types.ServiceDiscovery, clusterName string) error {
+	updates, err := sd.Subscribe(clusterName)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for hosts := range updates {
+			if err := ca.TriggerClusterUpdate(clusterName, hosts); err != nil {
+				log.DefaultLogger.Errorf("update cluster %s from service discovery failed: %v", clusterName, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
 // Called when mesh receive subscribe info
 func (ca *ClusterAdapter) TriggerClusterAdded(cluster v2.Cluster) {
 	clusterExist := ca.clusterMng.ClusterExist(cluster.Name)
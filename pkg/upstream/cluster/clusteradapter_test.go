@@ -0,0 +1,294 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// pushes host lists written to the channel
+type mockDiscovery struct {
+	cluster string
+	updates chan []v2.Host
+}
+
+func (d *mockDiscovery) Subscribe(clusterName string) (<-chan []v2.Host, error) {
+	d.cluster = clusterName
+	return d.updates, nil
+}
+
+func (d *mockDiscovery) Close() {
+	close(d.updates)
+}
+
+type mockConnPool struct {
+	drained chan struct{}
+}
+
+func (p *mockConnPool) Protocol() types.Protocol {
+	return protocol.SofaRpc
+}
+
+func (p *mockConnPool) DrainConnections() {
+	close(p.drained)
+}
+
+func (p *mockConnPool) NewStream(context context.Context, streamId string,
+	responseDecoder types.StreamReceiver, cb types.PoolEventListener) types.Cancellable {
+	return nil
+}
+
+func (p *mockConnPool) Close() {}
+
+func clusterHosts(cm types.ClusterManager, clusterName string) map[string]types.Host {
+	hosts := make(map[string]types.Host)
+	snapshot := cm.Get(nil, clusterName)
+	for _, hostSet := range snapshot.PrioritySet().HostSetsByPriority() {
+		for _, host := range hostSet.Hosts() {
+			hosts[host.AddressString()] = host
+		}
+	}
+
+	return hosts
+}
+
+func waitClusterHosts(t *testing.T, cm types.ClusterManager, clusterName string, expected ...string) map[string]types.Host {
+	sort.Strings(expected)
+
+	var got []string
+	for i := 0; i < 100; i++ {
+		hosts := clusterHosts(cm, clusterName)
+		got = got[:0]
+		for addr := range hosts {
+			got = append(got, addr)
+		}
+		sort.Strings(got)
+
+		if len(got) == len(expected) {
+			matched := true
+			for j := range got {
+				matched = matched && got[j] == expected[j]
+			}
+			if matched {
+				return hosts
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("cluster hosts expected %v, got %v", expected, got)
+	return nil
+}
+
+func TestSubscribeServiceDiscovery(t *testing.T) {
+	clusterName := "discoveryCluster"
+	cm := NewClusterManager(nil, []v2.Cluster{
+		{
+			Name:        clusterName,
+			ClusterType: v2.SIMPLE_CLUSTER,
+			LbType:      v2.LB_ROUNDROBIN,
+		},
+	}, map[string][]v2.Host{
+		clusterName: {
+			{Address: "127.0.0.1:8080"},
+			{Address: "127.0.0.2:8080"},
+		},
+	}, false, false).(*clusterManager)
+
+	sd := &mockDiscovery{updates: make(chan []v2.Host)}
+	defer sd.Close()
+
+	if err := ClusterAdap.SubscribeServiceDiscovery(sd, clusterName); err != nil {
+		t.Fatal(err)
+	}
+	if sd.cluster != clusterName {
+		t.Fatalf("subscribed cluster expected %s, got %s", clusterName, sd.cluster)
+	}
+
+	before := clusterHosts(cm, clusterName)
+	survivingPool := &mockConnPool{drained: make(chan struct{})}
+	removedPool := &mockConnPool{drained: make(chan struct{})}
+	cm.sofaRpcConnPool.Set("127.0.0.1:8080", survivingPool)
+	cm.sofaRpcConnPool.Set("127.0.0.2:8080", removedPool)
+
+	// add a host and remove a host
+	sd.updates <- []v2.Host{{Address: "127.0.0.1:8080"}, {Address: "127.0.0.3:8080"}}
+	after := waitClusterHosts(t, cm, clusterName, "127.0.0.1:8080", "127.0.0.3:8080")
+
+	if after["127.0.0.1:8080"] != before["127.0.0.1:8080"] {
+		t.Error("surviving host should not be recreated")
+	}
+
+	select {
+	case <-removedPool.drained:
+	case <-time.After(time.Second):
+		t.Error("connection pool of removed host is not drained")
+	}
+	if cm.sofaRpcConnPool.Has("127.0.0.2:8080") {
+		t.Error("connection pool of removed host should not be used any more")
+	}
+
+	select {
+	case <-survivingPool.drained:
+		t.Error("connection pool of surviving host should not be drained")
+	default:
+	}
+	if pool, _ := cm.sofaRpcConnPool.Get("127.0.0.1:8080"); pool != survivingPool {
+		t.Error("connection pool of surviving host should be kept")
+	}
+
+	// all hosts removed
+	sd.updates <- []v2.Host{}
+	waitClusterHosts(t, cm, clusterName)
+
+	select {
+	case <-survivingPool.drained:
+	case <-time.After(time.Second):
+		t.Error("connection pool of removed host is not drained")
+	}
+}
+
+func TestDrainConnPoolSharedByClusters(t *testing.T) {
+	cm := NewClusterManager(nil, []v2.Cluster{
+		{Name: "cluster1", ClusterType: v2.SIMPLE_CLUSTER, LbType: v2.LB_ROUNDROBIN},
+		{Name: "cluster2", ClusterType: v2.SIMPLE_CLUSTER, LbType: v2.LB_ROUNDROBIN},
+	}, map[string][]v2.Host{
+		"cluster1": {{Address: "127.0.0.1:8080"}},
+		"cluster2": {{Address: "127.0.0.1:8080"}},
+	}, false, false).(*clusterManager)
+
+	pool := &mockConnPool{drained: make(chan struct{})}
+	cm.sofaRpcConnPool.Set("127.0.0.1:8080", pool)
+
+	if err := cm.UpdateClusterHosts("cluster1", 0, []v2.Host{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-pool.drained:
+		t.Fatal("connection pool should not be drained when the host is still used by another cluster")
+	default:
+	}
+
+	if err := cm.UpdateClusterHosts("cluster2", 0, []v2.Host{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-pool.drained:
+	default:
+		t.Fatal("connection pool should be drained when the host is removed from all clusters")
+	}
+}
+
+func TestShutdownDrainConnPools(t *testing.T) {
+	cm := NewClusterManager(nil, []v2.Cluster{
+		{Name: "cluster1", ClusterType: v2.SIMPLE_CLUSTER, LbType: v2.LB_ROUNDROBIN},
+	}, map[string][]v2.Host{
+		"cluster1": {{Address: "127.0.0.1:8080"}, {Address: "127.0.0.1:8081"}},
+	}, false, false).(*clusterManager)
+
+	pools := []*mockConnPool{{drained: make(chan struct{})}, {drained: make(chan struct{})}}
+	cm.sofaRpcConnPool.Set("127.0.0.1:8080", pools[0])
+	cm.xProtocolConnPool.Set("127.0.0.1:8081", pools[1])
+
+	if err := cm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, pool := range pools {
+		select {
+		case <-pool.drained:
+		default:
+			t.Fatalf("connection pool %d should be drained on shutdown", i)
+		}
+	}
+
+	if cm.sofaRpcConnPool.Count() != 0 || cm.xProtocolConnPool.Count() != 0 {
+		t.Fatal("connection pools should be removed on shutdown")
+	}
+}
+
+func TestPrewarmConnPools(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			atomic.AddInt32(&accepted, 1)
+		}
+	}()
+
+	addr := listener.Addr().String()
+	pool := v2.ConnectionPool{MaxConnectionsPerHost: 2, PrewarmConnections: 2, PrewarmTimeout: time.Second}
+	cm := NewClusterManager(nil, []v2.Cluster{
+		{Name: "prewarm_cluster", ClusterType: v2.SIMPLE_CLUSTER, LbType: v2.LB_ROUNDROBIN, ConnectionPool: pool},
+		{Name: "http2_cluster", ClusterType: v2.SIMPLE_CLUSTER, LbType: v2.LB_ROUNDROBIN, ConnectionPool: pool,
+			UpstreamProtocol: string(protocol.Http2)},
+	}, map[string][]v2.Host{
+		"prewarm_cluster": {{Address: addr}},
+		"http2_cluster":   {{Address: "127.0.0.1:8081"}},
+	}, false, false).(*clusterManager)
+	defer cm.Shutdown()
+
+	for i := 0; i < 100 && len(cm.PrewarmingClusters()) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if prewarming := cm.PrewarmingClusters(); len(prewarming) > 0 {
+		t.Fatalf("expect pre-warming done, got %v", prewarming)
+	}
+
+	// the pre-warmed connections are pooled
+	if _, ok := cm.sofaRpcConnPool.Get(addr); !ok {
+		t.Fatal("expect connection pool created for the pre-warmed host")
+	}
+	for i := 0; i < 50 && atomic.LoadInt32(&accepted) != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&accepted); n != 2 {
+		t.Errorf("expect 2 pre-warmed connections, got %d", n)
+	}
+	if active := cm.Clusters()["prewarm_cluster"].Info().Stats().UpstreamConnectionActive.Count(); active != 2 {
+		t.Errorf("expect 2 active connections of cluster, got %d", active)
+	}
+
+	// cluster of other upstream protocol is not pre-warmed
+	if _, ok := cm.sofaRpcConnPool.Get("127.0.0.1:8081"); ok {
+		t.Error("expect no connection pool created for http2 cluster")
+	}
+}
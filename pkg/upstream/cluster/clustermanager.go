@@ -21,6 +21,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"sync"
 
 	"github.com/orcaman/concurrent-map"
 	"github.com/alipay/sofamosn/pkg/api/v2"
@@ -44,6 +46,10 @@ type clusterManager struct {
 	clusterAdapter         ClusterAdapter
 	autoDiscovery          bool
 	registryUseHealthCheck bool
+
+	// num of pre-warmings in progress by cluster name
+	prewarming    map[string]int
+	prewarmingMux sync.Mutex
 }
 
 type clusterSnapshot struct {
@@ -62,6 +68,7 @@ func NewClusterManager(sourceAddr net.Addr, clusters []v2.Cluster,
 		xProtocolConnPool: cmap.New(),
 		http1ConnPool:   cmap.New(),
 		autoDiscovery:   true, //todo delete
+		prewarming:      make(map[string]int),
 	}
 	//init ClusterAdap when run app
 	ClusterAdap = ClusterAdapter{
@@ -105,18 +112,41 @@ type primaryCluster struct {
 func (cm *clusterManager) AddOrUpdatePrimaryCluster(cluster v2.Cluster) bool {
 	clusterName := cluster.Name
 
+	var replaced types.Cluster
 	if v, exist := cm.primaryClusters.Get(clusterName); exist {
 		if !v.(*primaryCluster).addedViaApi {
 			return false
 		}
+		replaced = v.(*primaryCluster).cluster
+
+		// the replaced dns cluster stops resolving
+		if dnsCluster, ok := replaced.(*strictDnsCluster); ok {
+			dnsCluster.Stop()
+		}
 	}
 
 	// todo for static cluster, shouldn't use this way
-	cm.loadCluster(cluster, true)
+	loaded := cm.loadCluster(cluster, true)
+
+	// manual health overrides of hosts are kept, the hosts are updated to the new cluster by discovery
+	if to, from := baseCluster(loaded), baseCluster(replaced); to != nil && from != nil {
+		to.copyHealthOverrides(from)
+	}
 
 	return true
 }
 
+func baseCluster(c types.Cluster) *cluster {
+	switch c := c.(type) {
+	case *simpleInMemCluster:
+		return &c.cluster
+	case *strictDnsCluster:
+		return &c.cluster
+	}
+
+	return nil
+}
+
 func (cm *clusterManager) ClusterExist(clusterName string) bool {
 	if _, exist := cm.primaryClusters.Get(clusterName); exist {
 		return true
@@ -131,6 +161,11 @@ func (cm *clusterManager) loadCluster(clusterConfig v2.Cluster, addedViaApi bool
 
 	cluster.Initialize(func() {
 		cluster.PrioritySet().AddMemberUpdateCb(func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+			for _, host := range hostsRemoved {
+				cm.drainConnPools(host)
+			}
+
+			cm.prewarmConnPools(cluster.Info(), hostsAdded)
 		})
 	})
 
@@ -142,6 +177,115 @@ func (cm *clusterManager) loadCluster(clusterConfig v2.Cluster, addedViaApi bool
 	return cluster
 }
 
+// drainConnPools removes the connection pools of the host removed from cluster, so that new requests
+// won't use them, and drains the connections. Pools are shared by address, so they are kept if the
+// address is still a member of any cluster.
+func (cm *clusterManager) drainConnPools(host types.Host) {
+	addr := host.AddressString()
+
+	if cm.hostInUse(addr) {
+		return
+	}
+
+	for _, pools := range []cmap.ConcurrentMap{cm.sofaRpcConnPool, cm.http2ConnPool, cm.http1ConnPool, cm.xProtocolConnPool} {
+		if connPool, ok := pools.Pop(addr); ok {
+			log.DefaultLogger.Infof("drain connection pool of removed host %s", addr)
+			connPool.(types.ConnectionPool).DrainConnections()
+		}
+	}
+}
+
+// prewarmConnPools opens the configured num of connections to each healthy host added to cluster
+// in background, the cluster is pre-warming until the connections are established or the timeout
+func (cm *clusterManager) prewarmConnPools(info types.ClusterInfo, hosts []types.Host) {
+	config := info.ConnectionPool()
+	if config.PrewarmConnections == 0 {
+		return
+	}
+
+	// the pools of other protocols are created on requests
+	if prot := info.UpstreamProtocol(); prot != "" && prot != proto.SofaRpc {
+		return
+	}
+
+	var prewarmers []types.ConnectionPoolPrewarmer
+	for _, host := range hosts {
+		if !host.Health() {
+			continue
+		}
+
+		if prewarmer, ok := cm.sofaRpcConnPoolForHost(host).(types.ConnectionPoolPrewarmer); ok {
+			prewarmers = append(prewarmers, prewarmer)
+		}
+	}
+
+	if len(prewarmers) == 0 {
+		return
+	}
+
+	timeout := config.PrewarmTimeout
+	if timeout == 0 {
+		timeout = v2.DefaultConnPoolPrewarmTimeout
+	}
+
+	clusterName := info.Name()
+	cm.prewarmingMux.Lock()
+	cm.prewarming[clusterName]++
+	cm.prewarmingMux.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for _, prewarmer := range prewarmers {
+			wg.Add(1)
+			go func(prewarmer types.ConnectionPoolPrewarmer) {
+				defer wg.Done()
+				prewarmer.Prewarm(ctx, config.PrewarmConnections)
+			}(prewarmer)
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			log.DefaultLogger.Warnf("pre-warming connections of cluster %s not done in %s", clusterName, timeout)
+		}
+
+		cm.prewarmingMux.Lock()
+		if cm.prewarming[clusterName]--; cm.prewarming[clusterName] == 0 {
+			delete(cm.prewarming, clusterName)
+		}
+		cm.prewarmingMux.Unlock()
+	}()
+}
+
+func (cm *clusterManager) PrewarmingClusters() []string {
+	cm.prewarmingMux.Lock()
+	defer cm.prewarmingMux.Unlock()
+
+	var clusters []string
+	for clusterName := range cm.prewarming {
+		clusters = append(clusters, clusterName)
+	}
+	sort.Strings(clusters)
+
+	return clusters
+}
+
+func (cm *clusterManager) hostInUse(addr string) bool {
+	for _, v := range cm.primaryClusters.Items() {
+		for _, hostSet := range v.(*primaryCluster).cluster.PrioritySet().HostSetsByPriority() {
+			for _, host := range hostSet.Hosts() {
+				if host.AddressString() == addr {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
 func (cm *clusterManager) getOrCreateClusterSnapshot(clusterName string) *clusterSnapshot {
 	if v, ok := cm.primaryClusters.Get(clusterName); ok {
 		pcc := v.(*primaryCluster).cluster
@@ -178,6 +322,12 @@ func (cm *clusterManager) UpdateClusterHosts(clusterName string, priority uint32
 	if v, ok := cm.primaryClusters.Get(clusterName); ok {
 		pcc := v.(*primaryCluster).cluster
 
+		// hosts of dns cluster are resolved from the hostnames
+		if dnsCluster, ok := pcc.(*strictDnsCluster); ok {
+			dnsCluster.SetTargets(hostConfigs)
+			return nil
+		}
+
 		// todo: hack
 		if concretedCluster, ok := pcc.(*simpleInMemCluster); ok {
 			var hosts []types.Host
@@ -238,7 +388,7 @@ func (cm *clusterManager) HttpConnPoolForCluster(cluster string, protocol types.
 		return nil
 	}
 
-	host := clusterSnapshot.loadbalancer.ChooseHost(lbCtx)
+	host := chooseHost(clusterSnapshot.loadbalancer, lbCtx)
 
 	if host != nil {
 		addr := host.AddressString()
@@ -280,7 +430,7 @@ func (cm *clusterManager) XprotocolConnPoolForCluster(cluster string, protocol t
 		return nil
 	}
 
-	host := clusterSnapshot.loadbalancer.ChooseHost(nil)
+	host := chooseHost(clusterSnapshot.loadbalancer, nil)
 
 	if host != nil {
 		addr := host.AddressString()
@@ -306,7 +456,7 @@ func (cm *clusterManager) TcpConnForCluster(cluster string,lbCtx types.LoadBalan
 		return types.CreateConnectionData{}
 	}
 
-	host := clusterSnapshot.loadbalancer.ChooseHost(lbCtx)
+	host := chooseHost(clusterSnapshot.loadbalancer, lbCtx)
 
 	if host != nil {
 		return host.CreateConnection(nil)
@@ -323,33 +473,43 @@ func (cm *clusterManager) SofaRpcConnPoolForCluster(cluster string, lbCtx types.
 		return nil
 	}
 
-	host := clusterSnapshot.loadbalancer.ChooseHost(lbCtx)
+	host := chooseHost(clusterSnapshot.loadbalancer, lbCtx)
 
 	if host != nil {
 		addr := host.AddressString()
 		log.DefaultLogger.Debugf(" clusterSnapshot.loadbalancer.ChooseHost result is %s, cluster name = %s", addr, cluster)
 
-		if connPool, ok := cm.sofaRpcConnPool.Get(addr); ok {
-			return connPool.(types.ConnectionPool)
-		} else {
-			// todo: move this to a centralized factory, remove dependency to sofarpc stream
-			connPool := sofarpc.NewConnPool(host)
-			cm.sofaRpcConnPool.Set(addr, connPool)
-
-			return connPool
-		}
+		return cm.sofaRpcConnPoolForHost(host)
 	} else {
 		log.DefaultLogger.Errorf("clusterSnapshot.loadbalancer.ChooseHost is nil, cluster name = %s", cluster)
 		return nil
 	}
 }
 
+// connection pools are shared by the hosts of the same address
+func (cm *clusterManager) sofaRpcConnPoolForHost(host types.Host) types.ConnectionPool {
+	addr := host.AddressString()
+
+	if connPool, ok := cm.sofaRpcConnPool.Get(addr); ok {
+		return connPool.(types.ConnectionPool)
+	} else {
+		// todo: move this to a centralized factory, remove dependency to sofarpc stream
+		connPool := sofarpc.NewConnPool(host)
+		cm.sofaRpcConnPool.Set(addr, connPool)
+
+		return connPool
+	}
+}
+
 func (cm *clusterManager) RemovePrimaryCluster(clusterName string) bool {
 	if v, exist := cm.primaryClusters.Get(clusterName); exist {
 		if !v.(*primaryCluster).addedViaApi {
 			return false
 			log.DefaultLogger.Warnf("Remove Primary Cluster Failed, Cluster Name = %s not addedViaApi", clusterName)
 		} else {
+			if dnsCluster, ok := v.(*primaryCluster).cluster.(*strictDnsCluster); ok {
+				dnsCluster.Stop()
+			}
 			cm.primaryClusters.Remove(clusterName)
 			log.DefaultLogger.Debugf("Remove Primary Cluster, Cluster Name = %s", clusterName)
 		}
@@ -358,7 +518,17 @@ func (cm *clusterManager) RemovePrimaryCluster(clusterName string) bool {
 	return true
 }
 
+// Shutdown drains all the connection pools, idle connections are closed at once
+// and the busy ones after their requests are done
 func (cm *clusterManager) Shutdown() error {
+	for _, pools := range []cmap.ConcurrentMap{cm.sofaRpcConnPool, cm.http2ConnPool, cm.http1ConnPool, cm.xProtocolConnPool} {
+		for addr := range pools.Items() {
+			if connPool, ok := pools.Pop(addr); ok {
+				connPool.(types.ConnectionPool).DrainConnections()
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -373,3 +543,20 @@ func (cm *clusterManager) VersionInfo() string {
 func (cm *clusterManager) LocalClusterName() string {
 	return ""
 }
+
+// max times to choose another host when the chosen one should be skipped
+const maxHostSelectionAttempts = 5
+
+func chooseHost(lb types.LoadBalancer, lbCtx types.LoadBalancerContext) types.Host {
+	host := lb.ChooseHost(lbCtx)
+
+	if lbCtx == nil {
+		return host
+	}
+
+	for i := 0; i < maxHostSelectionAttempts && host != nil && lbCtx.ShouldSelectAnotherHost(host); i++ {
+		host = lb.ChooseHost(lbCtx)
+	}
+
+	return host
+}
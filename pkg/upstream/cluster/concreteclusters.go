@@ -112,10 +112,18 @@ func (sc *simpleInMemCluster) UpdateHosts(newHosts []types.Host) {
 
 	if changed {
 		sc.hosts = finalHosts
-		// todo: need to consider how to update healthyHost
+
+		// hosts removed and added again keep the manual health overrides
+		sc.applyHealthOverrides(hostsAdded)
+
+		// attach outlier monitors before hosts become available to load balancers
+		if sc.outlierDetector != nil {
+			sc.outlierDetector.OnClusterMemberUpdate(hostsAdded, hostsRemoved)
+		}
+
 		// Note: currently, we only use priority 0
 		sc.prioritySet.GetOrCreateHostSet(0).UpdateHosts(sc.hosts,
-			sc.hosts, nil, nil, hostsAdded, hostsRemoved)
+			getHealthHost(sc.hosts), nil, nil, hostsAdded, hostsRemoved)
 
 		if sc.healthChecker != nil {
 			sc.healthChecker.OnClusterMemberUpdate(hostsAdded, hostsRemoved)
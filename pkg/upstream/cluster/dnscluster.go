@@ -0,0 +1,180 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// DnsResolver resolves hostname to ip addresses, ttl is the min TTL of the records, zero if unknown
+type DnsResolver interface {
+	Resolve(hostname string) (ips []net.IP, ttl time.Duration, err error)
+}
+
+// resolver used by STRICT_DNS clusters
+var dnsResolver DnsResolver = systemDnsResolver{}
+
+// systemDnsResolver resolves by the system resolver, which doesn't report TTL
+type systemDnsResolver struct{}
+
+func (r systemDnsResolver) Resolve(hostname string) ([]net.IP, time.Duration, error) {
+	ips, err := net.LookupIP(hostname)
+
+	return ips, 0, err
+}
+
+// strictDnsCluster resolves the configured hosts by hostname periodically, the cluster has a host for
+// each resolved ip. Hosts of surviving ips keep their connections, and hosts of removed ips are drained.
+type strictDnsCluster struct {
+	*simpleInMemCluster
+
+	resolver    DnsResolver
+	refreshRate time.Duration
+	respectTTL  bool
+
+	resolveMux sync.Mutex
+	targets    []v2.Host
+	// hosts last resolved by target address, kept on resolution failure
+	resolved map[string][]v2.Host
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+}
+
+func newStrictDnsCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaApi bool) *strictDnsCluster {
+	refreshRate := clusterConfig.DnsRefreshRate
+	if refreshRate <= 0 {
+		refreshRate = v2.DefaultDnsRefreshRate
+	}
+
+	return &strictDnsCluster{
+		simpleInMemCluster: newSimpleInMemCluster(clusterConfig, sourceAddr, addedViaApi),
+		resolver:           dnsResolver,
+		refreshRate:        refreshRate,
+		respectTTL:         clusterConfig.RespectDnsTTL,
+		resolved:           make(map[string][]v2.Host),
+		stop:               make(chan struct{}),
+	}
+}
+
+// SetTargets replaces the hosts to be resolved and resolves them at once, then they are
+// re-resolved periodically
+func (dc *strictDnsCluster) SetTargets(targets []v2.Host) {
+	dc.resolveMux.Lock()
+	dc.targets = targets
+	dc.resolveMux.Unlock()
+
+	interval := dc.resolve()
+
+	dc.startOnce.Do(func() {
+		go dc.refreshLoop(interval)
+	})
+}
+
+// Stop stops the periodic resolution
+func (dc *strictDnsCluster) Stop() {
+	dc.stopOnce.Do(func() {
+		close(dc.stop)
+	})
+}
+
+func (dc *strictDnsCluster) refreshLoop(interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-dc.stop:
+			return
+		case <-timer.C:
+			timer.Reset(dc.resolve())
+		}
+	}
+}
+
+// resolve resolves all targets and updates the cluster hosts, returns the interval to the next resolution
+func (dc *strictDnsCluster) resolve() time.Duration {
+	dc.resolveMux.Lock()
+	defer dc.resolveMux.Unlock()
+
+	var minTTL time.Duration
+	var hosts []types.Host
+	resolved := make(map[string][]v2.Host, len(dc.targets))
+
+	for _, target := range dc.targets {
+		targetHosts, ttl, err := dc.resolveTarget(target)
+		if err != nil {
+			// keep the last resolved hosts, a transient DNS failure should not empty the cluster
+			log.DefaultLogger.Errorf("resolve host %s of cluster %s failed: %v", target.Address, dc.info.name, err)
+			targetHosts = dc.resolved[target.Address]
+		}
+
+		if ttl > 0 && (minTTL == 0 || ttl < minTTL) {
+			minTTL = ttl
+		}
+
+		resolved[target.Address] = targetHosts
+		for _, hc := range targetHosts {
+			hosts = append(hosts, NewHost(hc, dc.info))
+		}
+	}
+
+	dc.resolved = resolved
+	dc.UpdateHosts(hosts)
+
+	if dc.respectTTL && minTTL > 0 {
+		return minTTL
+	}
+
+	return dc.refreshRate
+}
+
+// resolveTarget returns a host for each ip of the target hostname, targets addressed by ip are returned as is
+func (dc *strictDnsCluster) resolveTarget(target v2.Host) ([]v2.Host, time.Duration, error) {
+	hostname, port, err := net.SplitHostPort(target.Address)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if net.ParseIP(hostname) != nil {
+		return []v2.Host{target}, 0, nil
+	}
+
+	ips, ttl, err := dc.resolver.Resolve(hostname)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hosts := make([]v2.Host, 0, len(ips))
+	for _, ip := range ips {
+		host := target
+		host.Address = net.JoinHostPort(ip.String(), port)
+		if host.Hostname == "" {
+			host.Hostname = hostname
+		}
+		hosts = append(hosts, host)
+	}
+
+	return hosts, ttl, nil
+}
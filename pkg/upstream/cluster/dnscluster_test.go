@@ -0,0 +1,197 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+)
+
+// returns the ips set by hostname, or the error if set
+type fakeResolver struct {
+	mux     sync.Mutex
+	ips     map[string][]string
+	ttl     time.Duration
+	err     error
+	resolve int
+}
+
+func (r *fakeResolver) Resolve(hostname string) ([]net.IP, time.Duration, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.resolve++
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+
+	var ips []net.IP
+	for _, ip := range r.ips[hostname] {
+		ips = append(ips, net.ParseIP(ip))
+	}
+
+	return ips, r.ttl, nil
+}
+
+func (r *fakeResolver) set(hostname string, ips ...string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.ips[hostname] = ips
+}
+
+func (r *fakeResolver) setErr(err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.err = err
+}
+
+func (r *fakeResolver) resolveCount() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.resolve
+}
+
+func newDnsClusterManager(resolver *fakeResolver, cluster v2.Cluster, hosts []v2.Host) *clusterManager {
+	origin := dnsResolver
+	dnsResolver = resolver
+	defer func() {
+		dnsResolver = origin
+	}()
+
+	cluster.ClusterType = v2.STRICT_DNS_CLUSTER
+	cluster.LbType = v2.LB_ROUNDROBIN
+
+	return NewClusterManager(nil, []v2.Cluster{cluster}, map[string][]v2.Host{
+		cluster.Name: hosts,
+	}, false, false).(*clusterManager)
+}
+
+func TestStrictDnsClusterRefresh(t *testing.T) {
+	clusterName := "dnsCluster"
+	resolver := &fakeResolver{ips: make(map[string][]string)}
+	resolver.set("upstream.example.com", "10.0.0.1", "10.0.0.2")
+
+	cm := newDnsClusterManager(resolver, v2.Cluster{
+		Name:           clusterName,
+		DnsRefreshRate: 20 * time.Millisecond,
+	}, []v2.Host{
+		{Address: "upstream.example.com:12200", Weight: 10},
+		{Address: "127.0.0.1:12200"},
+	})
+	defer cm.RemovePrimaryCluster(clusterName)
+
+	// resolved at once
+	before := clusterHosts(cm, clusterName)
+	if len(before) != 3 {
+		t.Fatalf("expect 3 hosts resolved at once, got %v", before)
+	}
+	host := before["10.0.0.1:12200"]
+	if host == nil || host.Hostname() != "upstream.example.com" || host.Weight() != 10 {
+		t.Fatalf("unexpected resolved host: %+v", host)
+	}
+
+	survivingPool := &mockConnPool{drained: make(chan struct{})}
+	removedPool := &mockConnPool{drained: make(chan struct{})}
+	cm.sofaRpcConnPool.Set("10.0.0.1:12200", survivingPool)
+	cm.sofaRpcConnPool.Set("10.0.0.2:12200", removedPool)
+
+	// an ip added and an ip removed
+	resolver.set("upstream.example.com", "10.0.0.1", "10.0.0.3")
+	after := waitClusterHosts(t, cm, clusterName, "10.0.0.1:12200", "10.0.0.3:12200", "127.0.0.1:12200")
+
+	if after["10.0.0.1:12200"] != before["10.0.0.1:12200"] {
+		t.Error("host of surviving ip should not be recreated")
+	}
+
+	select {
+	case <-removedPool.drained:
+	case <-time.After(time.Second):
+		t.Error("connection pool of removed ip is not drained")
+	}
+
+	select {
+	case <-survivingPool.drained:
+		t.Error("connection pool of surviving ip should not be drained")
+	default:
+	}
+	if pool, _ := cm.sofaRpcConnPool.Get("10.0.0.1:12200"); pool != survivingPool {
+		t.Error("connection pool of surviving ip should be kept")
+	}
+
+	// resolution failure keeps the last resolved hosts
+	resolver.setErr(errors.New("dns timeout"))
+	count := resolver.resolveCount()
+	for resolver.resolveCount() < count+2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitClusterHosts(t, cm, clusterName, "10.0.0.1:12200", "10.0.0.3:12200", "127.0.0.1:12200")
+
+	resolver.setErr(nil)
+	resolver.set("upstream.example.com", "10.0.0.4")
+	waitClusterHosts(t, cm, clusterName, "10.0.0.4:12200", "127.0.0.1:12200")
+}
+
+func TestStrictDnsClusterRespectTTL(t *testing.T) {
+	clusterName := "dnsTTLCluster"
+	resolver := &fakeResolver{ips: make(map[string][]string), ttl: 20 * time.Millisecond}
+	resolver.set("upstream.example.com", "10.0.0.1")
+
+	cm := newDnsClusterManager(resolver, v2.Cluster{
+		Name:           clusterName,
+		DnsRefreshRate: time.Hour,
+		RespectDnsTTL:  true,
+	}, []v2.Host{
+		{Address: "upstream.example.com:12200"},
+	})
+	defer cm.RemovePrimaryCluster(clusterName)
+
+	waitClusterHosts(t, cm, clusterName, "10.0.0.1:12200")
+
+	// re-resolved on ttl instead of refresh rate
+	resolver.set("upstream.example.com", "10.0.0.2")
+	waitClusterHosts(t, cm, clusterName, "10.0.0.2:12200")
+}
+
+func TestStrictDnsClusterStop(t *testing.T) {
+	clusterName := "dnsStopCluster"
+	resolver := &fakeResolver{ips: make(map[string][]string)}
+	resolver.set("upstream.example.com", "10.0.0.1")
+
+	cm := newDnsClusterManager(resolver, v2.Cluster{
+		Name:           clusterName,
+		DnsRefreshRate: 10 * time.Millisecond,
+	}, []v2.Host{
+		{Address: "upstream.example.com:12200"},
+	})
+
+	cm.RemovePrimaryCluster(clusterName)
+	time.Sleep(20 * time.Millisecond)
+
+	count := resolver.resolveCount()
+	time.Sleep(50 * time.Millisecond)
+	if got := resolver.resolveCount(); got != count {
+		t.Errorf("removed cluster should not be resolved any more, resolved %d times", got-count)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/rcrowley/go-metrics"
 	"github.com/alipay/sofamosn/pkg/api/v2"
@@ -100,10 +101,14 @@ type host struct {
 	used   bool
 
 	healthFlags uint64
+	// types.HealthOverride
+	healthOverride int32
+	// requests in flight, counted by proxy
+	activeRequests int64
 }
 
 func NewHost(config v2.Host, clusterInfo types.ClusterInfo) types.Host {
-	addr, _ := net.ResolveTCPAddr("tcp", config.Address)
+	addr, _ := network.ResolveAddr(config.Address)
 
 	return &host{
 		hostInfo: newHostInfo(addr, config, clusterInfo),
@@ -143,6 +148,7 @@ func (h *host) CreateConnection(context context.Context) types.CreateConnectionD
 
 	clientConn := network.NewClientConnection(h.clusterInfo.SourceAddress(), h.clusterInfo.TLSMng(), h.address, nil, logger)
 	clientConn.SetBufferLimit(h.clusterInfo.ConnBufferLimitBytes())
+	clientConn.SetConnectTimeout(h.clusterInfo.ConnectTimeout())
 
 	return types.CreateConnectionData{
 		Connection: clientConn,
@@ -162,28 +168,55 @@ func (h *host) Gauges() types.HostStats {
 // set h.healthFlags = 0
 // ^1 = 0
 func (h *host) ClearHealthFlag(flag types.HealthFlag) {
-	h.healthFlags &= ^uint64(flag)
+	for {
+		old := atomic.LoadUint64(&h.healthFlags)
+		if atomic.CompareAndSwapUint64(&h.healthFlags, old, old&^uint64(flag)) {
+			return
+		}
+	}
 }
 
 // return 1, if h.healthFlags = 1
 func (h *host) ContainHealthFlag(flag types.HealthFlag) bool {
-	return h.healthFlags&uint64(flag) > 0
+	return atomic.LoadUint64(&h.healthFlags)&uint64(flag) > 0
 }
 
 // set h.healthFlags = 1
 func (h *host) SetHealthFlag(flag types.HealthFlag) {
-	h.healthFlags |= uint64(flag)
+	for {
+		old := atomic.LoadUint64(&h.healthFlags)
+		if atomic.CompareAndSwapUint64(&h.healthFlags, old, old|uint64(flag)) {
+			return
+		}
+	}
 }
 
-// return 1 when h.healthFlags == 0
+// return 1 when h.healthFlags == 0, or the host is admitted manually
 func (h *host) Health() bool {
-	return h.healthFlags == 0
+	switch h.HealthOverride() {
+	case types.HealthOverrideEjected:
+		return false
+	case types.HealthOverrideAdmitted:
+		return true
+	}
+
+	return atomic.LoadUint64(&h.healthFlags) == 0
+}
+
+func (h *host) HealthOverride() types.HealthOverride {
+	return types.HealthOverride(atomic.LoadInt32(&h.healthOverride))
+}
+
+func (h *host) SetHealthOverride(override types.HealthOverride) {
+	atomic.StoreInt32(&h.healthOverride, int32(override))
 }
 
 func (h *host) SetHealthChecker(healthCheck types.HealthCheckHostMonitor) {
+	h.healthChecker.Store(healthCheckHolder{healthCheck})
 }
 
 func (h *host) SetOutlierDetector(outlierDetector types.DetectorHostMonitor) {
+	h.outlierDetector = outlierDetector
 }
 
 func (h *host) Weight() uint32 {
@@ -202,6 +235,18 @@ func (h *host) SetUsed(used bool) {
 	h.used = used
 }
 
+func (h *host) ActiveRequests() int64 {
+	return atomic.LoadInt64(&h.activeRequests)
+}
+
+func (h *host) IncActiveRequests() {
+	atomic.AddInt64(&h.activeRequests, 1)
+}
+
+func (h *host) DecActiveRequests() {
+	atomic.AddInt64(&h.activeRequests, -1)
+}
+
 // HostInfo
 type hostInfo struct {
 	hostname      string
@@ -212,7 +257,16 @@ type hostInfo struct {
 	stats         types.HostStats
 	metaData      types.RouteMetaData
 
-	// TODO: locality, outlier, healthchecker
+	outlierDetector types.DetectorHostMonitor
+	// healthCheckHolder of the health check session, set by health checker
+	healthChecker atomic.Value
+
+	// TODO: locality
+}
+
+// atomic.Value requires values of the same concrete type
+type healthCheckHolder struct {
+	monitor types.HealthCheckHostMonitor
 }
 
 func newHostInfo(addr net.Addr, config v2.Host, clusterInfo types.ClusterInfo) hostInfo {
@@ -243,10 +297,14 @@ func (hi *hostInfo) ClusterInfo() types.ClusterInfo {
 }
 
 func (hi *hostInfo) OutlierDetector() types.DetectorHostMonitor {
-	return nil
+	return hi.outlierDetector
 }
 
 func (hi *hostInfo) HealthChecker() types.HealthCheckHostMonitor {
+	if holder, ok := hi.healthChecker.Load().(healthCheckHolder); ok {
+		return holder.monitor
+	}
+
 	return nil
 }
 
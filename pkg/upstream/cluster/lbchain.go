@@ -0,0 +1,260 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// Chain load balancer narrows the healthy hosts of the request by the filters in order,
+// e.g. by subset and then by zone, and the host is chosen from the hosts left by the picker.
+// No host is chosen if any filter leaves no host.
+type chainLoadBalancer struct {
+	loadbalaner
+
+	filters []types.HostFilter
+	picker  types.HostPicker
+}
+
+func NewChainLoadBalancer(prioritySet types.PrioritySet, filters []types.HostFilter, picker types.HostPicker) types.LoadBalancer {
+	return &chainLoadBalancer{
+		loadbalaner: loadbalaner{
+			prioritySet: prioritySet,
+		},
+		filters: filters,
+		picker:  picker,
+	}
+}
+
+func (l *chainLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	var hosts []types.Host
+
+	// hosts in higher priority(lower number) host set are preferred
+	for _, hostSet := range l.prioritySet.HostSetsByPriority() {
+		if hosts = hostSet.HealthyHosts(); len(hosts) > 0 {
+			break
+		}
+	}
+
+	for _, filter := range l.filters {
+		if len(hosts) == 0 {
+			return nil
+		}
+
+		hosts = filter.Filter(context, hosts)
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	return l.picker.PickHost(context, hosts)
+}
+
+// NewHostFilter returns the filter of the type in the lb chain of cluster
+func NewHostFilter(filterType v2.LbFilterType, config v2.Cluster) types.HostFilter {
+	switch filterType {
+	case v2.LB_FILTER_SUBSET:
+		return &subsetFilter{}
+	case v2.LB_FILTER_ZONE:
+		return &zoneFilter{
+			zone: types.GenerateHashedValue(config.ZoneAware.LocalZone),
+		}
+	case v2.LB_FILTER_LEAST_REQUEST:
+		return &leastRequestFilter{}
+	}
+
+	return nil
+}
+
+// subsetFilter keeps the hosts matching the metadata match criteria of the request,
+// all hosts are kept if the request has no criteria
+type subsetFilter struct{}
+
+func (f *subsetFilter) Filter(context types.LoadBalancerContext, hosts []types.Host) []types.Host {
+	if context == nil {
+		return hosts
+	}
+
+	matchCriteria := context.MetadataMatchCriteria()
+	if matchCriteria == nil {
+		return hosts
+	}
+
+	criteria := matchCriteria.MetadataMatchCriteria()
+	if len(criteria) == 0 {
+		return hosts
+	}
+
+	var matched []types.Host
+	for _, host := range hosts {
+		if hostMatchesCriteria(host, criteria) {
+			matched = append(matched, host)
+		}
+	}
+
+	return matched
+}
+
+// hostMatchesCriteria returns true if the metadata of the host matches all the criteria
+func hostMatchesCriteria(host types.Host, criteria []types.MetadataMatchCriterion) bool {
+	metadata := host.Metadata()
+	for _, criterion := range criteria {
+		if metadata[criterion.MetadataKeyName()] != criterion.MetadataValue() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// zoneFilter keeps the hosts in the local zone, all hosts are kept if none is in the local zone
+type zoneFilter struct {
+	zone types.HashedValue
+}
+
+func (f *zoneFilter) Filter(context types.LoadBalancerContext, hosts []types.Host) []types.Host {
+	var local []types.Host
+	for _, host := range hosts {
+		if hostZone(host) == f.zone {
+			local = append(local, host)
+		}
+	}
+
+	if len(local) == 0 {
+		return hosts
+	}
+
+	return local
+}
+
+// leastRequestFilter keeps the hosts with the least active requests relative to their weights,
+// so that the picker breaks the tie, e.g. by consistent hash for cache affinity
+type leastRequestFilter struct{}
+
+func (f *leastRequestFilter) Filter(context types.LoadBalancerContext, hosts []types.Host) []types.Host {
+	var least []types.Host
+	var leastHost types.Host
+
+	for _, host := range hosts {
+		if leastHost == nil {
+			least, leastHost = append(least, host), host
+			continue
+		}
+
+		// compare active/weight without division
+		load := host.ActiveRequests() * int64(leastRequestWeight(leastHost))
+		leastLoad := leastHost.ActiveRequests() * int64(leastRequestWeight(host))
+
+		switch {
+		case load < leastLoad:
+			least, leastHost = append(least[:0:0], host), host
+		case load == leastLoad:
+			least = append(least, host)
+		}
+	}
+
+	return least
+}
+
+// NewHostPicker returns the picker of the lb type at the end of lb chain
+func NewHostPicker(lbType types.LoadBalancerType, config v2.ConsistentHashConfig) types.HostPicker {
+	switch lbType {
+	case types.RoundRobin:
+		return &roundRobinPicker{}
+	case types.LeastRequest:
+		return &leastRequestPicker{
+			rand: newRand(nil),
+		}
+	case types.ConsistentHash:
+		return &hashPicker{
+			headerKey: config.HeaderKey,
+			rand:      newRand(nil),
+		}
+	default:
+		return &randomPicker{
+			rand: newRand(nil),
+		}
+	}
+}
+
+type randomPicker struct {
+	rand *rand.Rand
+}
+
+func (p *randomPicker) PickHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
+	return hosts[p.rand.Intn(len(hosts))]
+}
+
+type roundRobinPicker struct {
+	index uint32
+}
+
+func (p *roundRobinPicker) PickHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
+	return hosts[atomic.AddUint32(&p.index, 1)%uint32(len(hosts))]
+}
+
+type leastRequestPicker struct {
+	rand *rand.Rand
+}
+
+func (p *leastRequestPicker) PickHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
+	return chooseLeastRequest(p.rand, hosts)
+}
+
+// hashPicker picks the host by rendezvous hashing of the configured header, the host with the
+// highest hash of the key and its address is picked. Unlike the hash ring, nothing is rebuilt
+// as the candidates vary by request, and removing a host only remaps the keys it owned.
+type hashPicker struct {
+	headerKey string
+	rand      *rand.Rand
+}
+
+func (p *hashPicker) PickHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
+	var key string
+	if context != nil {
+		if headers := context.DownstreamHeaders(); headers != nil {
+			key = headers[p.headerKey]
+		}
+	}
+
+	// no hash key found, choose a random one
+	if key == "" {
+		return hosts[p.rand.Intn(len(hosts))]
+	}
+
+	var picked types.Host
+	var maxHash uint64
+
+	for _, host := range hosts {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{'#'})
+		h.Write([]byte(host.AddressString()))
+
+		if hash := h.Sum64(); picked == nil || hash > maxHash {
+			picked, maxHash = host, hash
+		}
+	}
+
+	return picked
+}
@@ -0,0 +1,211 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/router"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+type chainLbContext struct {
+	types.LoadBalancerContext
+	mmc     types.MetadataMatchCriteria
+	headers map[string]string
+}
+
+func (ctx *chainLbContext) MetadataMatchCriteria() types.MetadataMatchCriteria {
+	return ctx.mmc
+}
+
+func (ctx *chainLbContext) DownstreamHeaders() map[string]string {
+	return ctx.headers
+}
+
+func versionContext(version string) types.LoadBalancerContext {
+	return &chainLbContext{
+		mmc: router.NewMetadataMatchCriteriaImpl(map[string]interface{}{"version": version}),
+	}
+}
+
+func newVersionHosts(version string, count int) []v2.Host {
+	var hosts []v2.Host
+	for i := 0; i < count; i++ {
+		hosts = append(hosts, v2.Host{
+			Address:  fmt.Sprintf("127.0.%d.%d:12200", len(version), i+1),
+			MetaData: v2.Metadata{"version": version},
+		})
+	}
+
+	return hosts
+}
+
+// hosts of the subset are chosen by least request
+func Test_chainLoadBalancer_SubsetLeastRequest(t *testing.T) {
+	c := NewCluster(v2.Cluster{
+		Name:        "chain",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_LEAST_REQUEST,
+		LbChain:     []v2.LbFilterType{v2.LB_FILTER_SUBSET},
+	}, nil, true)
+
+	var hostConfigs []v2.Host
+	hostConfigs = append(hostConfigs, newVersionHosts("v1", 3)...)
+	hostConfigs = append(hostConfigs, newVersionHosts("v22", 2)...)
+
+	var hosts []types.Host
+	for _, hc := range hostConfigs {
+		hosts = append(hosts, NewHost(hc, c.Info()))
+	}
+	c.(*simpleInMemCluster).UpdateHosts(hosts)
+
+	lb := c.Info().LBInstance()
+	busy := hosts[0]
+	for i := 0; i < 10; i++ {
+		busy.IncActiveRequests()
+	}
+
+	total := 3000
+	counts := make(map[types.Host]int)
+	for i := 0; i < total; i++ {
+		host := lb.ChooseHost(versionContext("v1"))
+		if host == nil || host.Metadata()["version"] != types.GenerateHashedValue("v1") {
+			t.Fatalf("host of version v1 expected, got %v", host)
+		}
+		counts[host]++
+	}
+
+	// the busy host is chosen only if it's picked twice
+	if counts[busy] > total*20/100 {
+		t.Errorf("busy host expected less requests, got %d of %d", counts[busy], total)
+	}
+	for _, host := range hosts[1:3] {
+		if counts[host] < total*30/100 {
+			t.Errorf("idle host %s expected more requests, got %d of %d", host.AddressString(), counts[host], total)
+		}
+	}
+
+	// no host matches
+	if host := lb.ChooseHost(versionContext("v3")); host != nil {
+		t.Errorf("no host expected if no host matches the subset, got %s", host.AddressString())
+	}
+
+	// all hosts are candidates without criteria
+	versions := make(map[types.HashedValue]bool)
+	for i := 0; i < 100; i++ {
+		versions[lb.ChooseHost(nil).Metadata()["version"]] = true
+	}
+	if len(versions) != 2 {
+		t.Errorf("hosts of all versions expected without criteria, got %d versions", len(versions))
+	}
+}
+
+// hash of the key breaks the tie of least request
+func Test_chainLoadBalancer_LeastRequestHash(t *testing.T) {
+	var hosts []types.Host
+	for i := 1; i <= 4; i++ {
+		hosts = append(hosts, NewHost(v2.Host{Address: fmt.Sprintf("127.0.0.%d:12200", i)}, nil))
+	}
+
+	lb := NewChainLoadBalancer(&prioritySet{
+		hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}},
+	}, []types.HostFilter{NewHostFilter(v2.LB_FILTER_LEAST_REQUEST, v2.Cluster{})},
+		NewHostPicker(types.ConsistentHash, v2.ConsistentHashConfig{HeaderKey: "uid"}))
+
+	choose := func(uid string) types.Host {
+		return lb.ChooseHost(&chainLbContext{headers: map[string]string{"uid": uid}})
+	}
+
+	keys := 1000
+	mapping := make(map[string]types.Host)
+	counts := make(map[types.Host]int)
+	for i := 0; i < keys; i++ {
+		uid := strconv.Itoa(i)
+		mapping[uid] = choose(uid)
+		counts[mapping[uid]]++
+		if got := choose(uid); got != mapping[uid] {
+			t.Fatalf("key %s expected host %s, got %s", uid, mapping[uid].AddressString(), got.AddressString())
+		}
+	}
+	for _, host := range hosts {
+		if counts[host] < keys*15/100 {
+			t.Errorf("keys expected to spread evenly, host %s got %d of %d", host.AddressString(), counts[host], keys)
+		}
+	}
+
+	// keys of the busy host move to other hosts, others stay
+	busy := hosts[0]
+	busy.IncActiveRequests()
+	defer busy.DecActiveRequests()
+
+	for uid, host := range mapping {
+		got := choose(uid)
+		if got == busy {
+			t.Fatalf("key %s expected not on busy host", uid)
+		}
+		if host != busy && got != host {
+			t.Errorf("key %s expected to stay on host %s, got %s", uid, host.AddressString(), got.AddressString())
+		}
+	}
+}
+
+// local zone is preferred, and all hosts are chosen from if no host is in local zone
+func Test_chainLoadBalancer_ZoneSubset(t *testing.T) {
+	var hosts []types.Host
+	for _, zone := range []string{"a", "a", "bb", "bb"} {
+		for _, version := range []string{"v1", "v22"} {
+			hosts = append(hosts, NewHost(v2.Host{
+				Address:  fmt.Sprintf("127.0.%d.%d:12200", len(version), len(hosts)),
+				MetaData: v2.Metadata{ZoneMetadataKey: zone, "version": version},
+			}, nil))
+		}
+	}
+
+	hs := &hostSet{hosts: hosts, healthyHosts: hosts}
+	config := v2.Cluster{ZoneAware: v2.ZoneAwareConfig{LocalZone: "a"}}
+	lb := NewChainLoadBalancer(&prioritySet{hostSets: []types.HostSet{hs}}, []types.HostFilter{
+		NewHostFilter(v2.LB_FILTER_SUBSET, config),
+		NewHostFilter(v2.LB_FILTER_ZONE, config),
+	}, NewHostPicker(types.RoundRobin, v2.ConsistentHashConfig{}))
+
+	for i := 0; i < 10; i++ {
+		host := lb.ChooseHost(versionContext("v22"))
+		if hostZone(host) != types.GenerateHashedValue("a") || host.Metadata()["version"] != types.GenerateHashedValue("v22") {
+			t.Fatalf("host of version v22 in local zone expected, got %s", host.AddressString())
+		}
+	}
+
+	// no v22 host in local zone
+	var healthy []types.Host
+	for _, host := range hosts {
+		if hostZone(host) != types.GenerateHashedValue("a") || host.Metadata()["version"] != types.GenerateHashedValue("v22") {
+			healthy = append(healthy, host)
+		}
+	}
+	hs.healthyHosts = healthy
+
+	for i := 0; i < 10; i++ {
+		host := lb.ChooseHost(versionContext("v22"))
+		if hostZone(host) != types.GenerateHashedValue("bb") || host.Metadata()["version"] != types.GenerateHashedValue("v22") {
+			t.Fatalf("host of version v22 in other zone expected, got %s", host.AddressString())
+		}
+	}
+}
@@ -17,18 +17,41 @@
 package cluster
 
 import (
+	"crypto/hmac"
+	"hash/crc32"
 	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
+const DefaultVirtualNodeCount = 160
+
+// weight of a host in slow start ramps from SlowStartMinWeightPercent of its weight
+const SlowStartMinWeightPercent = 10
+
 // Note: Random is the default lb
 func NewLoadBalancer(lbType types.LoadBalancerType, prioritySet types.PrioritySet) types.LoadBalancer {
+	return NewLoadBalancerWithSource(lbType, prioritySet, nil)
+}
+
+// NewLoadBalancerWithSource creates a load balancer picking hosts randomly by source,
+// so that the selections are reproducible with a seeded source.
+// A nil source means a time seeded one, the source is safe for concurrent use in either case.
+func NewLoadBalancerWithSource(lbType types.LoadBalancerType, prioritySet types.PrioritySet, source rand.Source) types.LoadBalancer {
 	switch lbType {
 	case types.RoundRobin:
 		return newRoundRobinLoadBalancer(prioritySet)
+	case types.WeightedRoundRobin:
+		return newWeightedRoundRobinLoadBalancer(prioritySet)
+	case types.LeastRequest:
+		return newLeastRequestLoadBalancer(prioritySet, source)
 	default :
-		return newRandomLoadbalancer(prioritySet)
+		return newRandomLoadbalancer(prioritySet, source)
 	}
 
 	return nil
@@ -36,6 +59,38 @@ func NewLoadBalancer(lbType types.LoadBalancerType, prioritySet types.PrioritySe
 
 type loadbalaner struct {
 	prioritySet types.PrioritySet
+	// random source of the load balancers picking hosts randomly
+	rand *rand.Rand
+}
+
+// lockedSource guards the source with a lock like the global source of math/rand,
+// as the hosts of a load balancer are chosen concurrently
+type lockedSource struct {
+	mux    sync.Mutex
+	source rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.source.Seed(seed)
+}
+
+// newRand returns a random generator safe for concurrent use on source, nil source means a time seeded one
+func newRand(source rand.Source) *rand.Rand {
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+
+	return rand.New(&lockedSource{source: source})
 }
 
 // Random LoadBalancer
@@ -43,17 +98,18 @@ type randomLoadBalancer struct {
 	loadbalaner
 }
 
-func newRandomLoadbalancer(prioritySet types.PrioritySet) types.LoadBalancer {
+func newRandomLoadbalancer(prioritySet types.PrioritySet, source rand.Source) types.LoadBalancer {
 	return &randomLoadBalancer{
 		loadbalaner: loadbalaner{
 			prioritySet: prioritySet,
+			rand:        newRand(source),
 		},
 	}
 }
 
 func (l *randomLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
 	hostSets := l.prioritySet.HostSetsByPriority()
-	idx := rand.Intn(len(hostSets))
+	idx := l.rand.Intn(len(hostSets))
 	hostset := hostSets[idx]
 
 	hosts := hostset.HealthyHosts()
@@ -63,7 +119,7 @@ func (l *randomLoadBalancer) ChooseHost(context types.LoadBalancerContext) types
 		//	logger.Debugf("Choose host failed, no health host found")
 		return nil
 	}
-	hostIdx := rand.Intn(len(hosts))
+	hostIdx := l.rand.Intn(len(hosts))
 	return hosts[hostIdx]
 }
 
@@ -110,3 +166,620 @@ func (l *roundRobinLoadBalancer) ChooseHost(context types.LoadBalancerContext) t
 
 	return selectedHost
 }
+
+// Smooth weighted round robin, hosts with higher weight are picked more often
+// while the picks are still interleaved. If all healthy hosts are zero weighted,
+// it falls back to plain round robin.
+type weightedRoundRobinLoadBalancer struct {
+	loadbalaner
+
+	mux sync.Mutex
+	// current weight for each host, keyed by host address
+	currentWeights map[string]int64
+	// rrIndex for the zero weight fallback
+	rrIndex uint32
+
+	// weight of a host ramps linearly to its full weight within slowStartWindow after it becomes healthy,
+	// zero means no slow start
+	slowStartWindow time.Duration
+	// healthy hosts of the last pick, hosts in the first pick are present at startup and skip slow start
+	lastHealthyHosts []types.Host
+	started          bool
+	// time when hosts in slow start become healthy, keyed by host address
+	healthySince map[string]time.Time
+	now          func() time.Time
+}
+
+func newWeightedRoundRobinLoadBalancer(prioritySet types.PrioritySet) types.LoadBalancer {
+	l := &weightedRoundRobinLoadBalancer{
+		loadbalaner: loadbalaner{
+			prioritySet: prioritySet,
+		},
+		currentWeights: make(map[string]int64),
+	}
+	prioritySet.AddMemberUpdateCb(l.onMemberUpdate)
+
+	return l
+}
+
+// NewSlowStartLoadBalancer creates a weighted round robin load balancer, newly added
+// or recovered hosts are in slow start within window
+func NewSlowStartLoadBalancer(prioritySet types.PrioritySet, window time.Duration) types.LoadBalancer {
+	l := &weightedRoundRobinLoadBalancer{
+		loadbalaner: loadbalaner{
+			prioritySet: prioritySet,
+		},
+		currentWeights:  make(map[string]int64),
+		slowStartWindow: window,
+		healthySince:    make(map[string]time.Time),
+		now:             time.Now,
+	}
+	prioritySet.AddMemberUpdateCb(l.onMemberUpdate)
+
+	return l
+}
+
+// onMemberUpdate drops the current weights of removed hosts, so that they don't
+// pile up as hosts come and go, and a host added back starts from zero
+func (l *weightedRoundRobinLoadBalancer) onMemberUpdate(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	for _, host := range hostsRemoved {
+		delete(l.currentWeights, host.AddressString())
+	}
+}
+
+func (l *weightedRoundRobinLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	var hosts []types.Host
+
+	// hosts in higher priority(lower number) host set are preferred
+	for _, hostSet := range l.prioritySet.HostSetsByPriority() {
+		if hosts = hostSet.HealthyHosts(); len(hosts) > 0 {
+			break
+		}
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	var now time.Time
+	if l.slowStartWindow > 0 {
+		now = l.now()
+		l.updateHealthyHosts(hosts, now)
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	var selectedHost types.Host
+	var totalWeight, selectedWeight int64
+
+	for _, host := range hosts {
+		weight := int64(host.Weight())
+		if weight == 0 {
+			continue
+		}
+
+		if l.slowStartWindow > 0 {
+			weight = l.slowStartWeight(host, weight, now)
+		}
+
+		addr := host.AddressString()
+		current := l.currentWeights[addr] + weight
+		l.currentWeights[addr] = current
+		totalWeight += weight
+
+		if selectedHost == nil || current > selectedWeight {
+			selectedHost = host
+			selectedWeight = current
+		}
+	}
+
+	if selectedHost == nil {
+		selectedHost = hosts[l.rrIndex%uint32(len(hosts))]
+		l.rrIndex++
+
+		return selectedHost
+	}
+
+	l.currentWeights[selectedHost.AddressString()] -= totalWeight
+
+	return selectedHost
+}
+
+// updateHealthyHosts records the time when hosts join the healthy hosts
+func (l *weightedRoundRobinLoadBalancer) updateHealthyHosts(hosts []types.Host, now time.Time) {
+	if l.started && sameHosts(l.lastHealthyHosts, hosts) {
+		return
+	}
+
+	healthy := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		addr := host.AddressString()
+		healthy[addr] = true
+
+		if l.started && !containsHost(l.lastHealthyHosts, addr) {
+			l.healthySince[addr] = now
+		}
+	}
+
+	// hosts not healthy any more start slow again when they come back
+	for addr := range l.healthySince {
+		if !healthy[addr] {
+			delete(l.healthySince, addr)
+		}
+	}
+
+	l.lastHealthyHosts = append([]types.Host{}, hosts...)
+	l.started = true
+}
+
+// slowStartWeight returns the weight of host, which ramps linearly from
+// SlowStartMinWeightPercent to 100 percent within the slow start window
+func (l *weightedRoundRobinLoadBalancer) slowStartWeight(host types.Host, weight int64, now time.Time) int64 {
+	addr := host.AddressString()
+
+	since, ok := l.healthySince[addr]
+	if !ok {
+		return weight
+	}
+
+	elapsed := now.Sub(since)
+	if elapsed >= l.slowStartWindow {
+		delete(l.healthySince, addr)
+		return weight
+	}
+
+	percent := SlowStartMinWeightPercent + (100-SlowStartMinWeightPercent)*float64(elapsed)/float64(l.slowStartWindow)
+	if weight = int64(float64(weight) * percent / 100); weight == 0 {
+		weight = 1
+	}
+
+	return weight
+}
+
+func containsHost(hosts []types.Host, addr string) bool {
+	for _, host := range hosts {
+		if host.AddressString() == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Least request load balancer picks two hosts randomly by weight, and sends the request to
+// the one with less active requests relative to its weight (power of two choices),
+// so that slow hosts with requests piling up receive fewer new requests
+type leastRequestLoadBalancer struct {
+	loadbalaner
+}
+
+func newLeastRequestLoadBalancer(prioritySet types.PrioritySet, source rand.Source) types.LoadBalancer {
+	return &leastRequestLoadBalancer{
+		loadbalaner: loadbalaner{
+			prioritySet: prioritySet,
+			rand:        newRand(source),
+		},
+	}
+}
+
+func (l *leastRequestLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	var hosts []types.Host
+
+	// hosts in higher priority(lower number) host set are preferred
+	for _, hostSet := range l.prioritySet.HostSetsByPriority() {
+		if hosts = hostSet.HealthyHosts(); len(hosts) > 0 {
+			break
+		}
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	return chooseLeastRequest(l.rand, hosts)
+}
+
+// chooseLeastRequest chooses the less loaded one of two hosts picked by weight
+func chooseLeastRequest(r *rand.Rand, hosts []types.Host) types.Host {
+	if len(hosts) == 1 {
+		return hosts[0]
+	}
+
+	first, second := pickWeightedHost(r, hosts), pickWeightedHost(r, hosts)
+
+	// compare active/weight without division, the first one is kept on tie,
+	// so that idle hosts are picked in proportion to their weights
+	load1 := first.ActiveRequests() * int64(leastRequestWeight(second))
+	load2 := second.ActiveRequests() * int64(leastRequestWeight(first))
+	if load2 < load1 {
+		return second
+	}
+
+	return first
+}
+
+// pickWeightedHost picks a host randomly, the probability is proportional to its weight
+func pickWeightedHost(r *rand.Rand, hosts []types.Host) types.Host {
+	var totalWeight int64
+	for _, host := range hosts {
+		totalWeight += int64(leastRequestWeight(host))
+	}
+
+	n := r.Int63n(totalWeight)
+	for _, host := range hosts {
+		if n -= int64(leastRequestWeight(host)); n < 0 {
+			return host
+		}
+	}
+
+	return hosts[len(hosts)-1]
+}
+
+// zero weight is taken as one, so that hosts without weight configured are picked evenly
+func leastRequestWeight(host types.Host) uint32 {
+	if weight := host.Weight(); weight > 0 {
+		return weight
+	}
+
+	return 1
+}
+
+// ZoneMetadataKey is the key of the zone in host metadata
+const ZoneMetadataKey = "zone"
+
+// Zone aware load balancer sends requests to healthy hosts in the local zone. If the healthy
+// percent of local hosts drops below MinHealthyPercent, the local zone keeps the share of
+// its healthy hosts, so that the load of each local host is unchanged, and the rest spills
+// to other zones in proportion to their healthy hosts. Hosts of the chosen zone are picked
+// by the load balancer created for the zone.
+type zoneAwareLoadBalancer struct {
+	loadbalaner
+
+	localZone         types.HashedValue
+	minHealthyPercent int
+	newLB             func(types.PrioritySet) types.LoadBalancer
+	// used when there is no host in local zone
+	lb types.LoadBalancer
+
+	mux     sync.Mutex
+	zoneLBs map[types.HashedValue]types.LoadBalancer
+}
+
+func NewZoneAwareLoadBalancer(prioritySet types.PrioritySet, config v2.ZoneAwareConfig,
+	newLB func(types.PrioritySet) types.LoadBalancer) types.LoadBalancer {
+	return &zoneAwareLoadBalancer{
+		loadbalaner: loadbalaner{
+			prioritySet: prioritySet,
+			rand:        newRand(nil),
+		},
+		localZone:         types.GenerateHashedValue(config.LocalZone),
+		minHealthyPercent: int(config.MinHealthyPercent),
+		newLB:             newLB,
+		lb:                newLB(prioritySet),
+		zoneLBs:           make(map[types.HashedValue]types.LoadBalancer),
+	}
+}
+
+func (l *zoneAwareLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	zone, ok := l.chooseZone()
+	if !ok {
+		return l.lb.ChooseHost(context)
+	}
+
+	return l.zoneLB(zone).ChooseHost(context)
+}
+
+// chooseZone returns false if zone aware routing is not applicable, that is no host is healthy
+// or no host is in local zone
+func (l *zoneAwareLoadBalancer) chooseZone() (types.HashedValue, bool) {
+	var hostSet types.HostSet
+
+	// hosts in higher priority(lower number) host set are preferred
+	for _, hs := range l.prioritySet.HostSetsByPriority() {
+		if len(hs.HealthyHosts()) > 0 {
+			hostSet = hs
+			break
+		}
+	}
+
+	if hostSet == nil {
+		return "", false
+	}
+
+	localTotal := 0
+	for _, host := range hostSet.Hosts() {
+		if hostZone(host) == l.localZone {
+			localTotal++
+		}
+	}
+
+	if localTotal == 0 {
+		return "", false
+	}
+
+	// healthy hosts per zone, zones are kept in order so that the spill is deterministic by random number
+	var zones []types.HashedValue
+	healthy := make(map[types.HashedValue]int)
+	for _, host := range hostSet.HealthyHosts() {
+		zone := hostZone(host)
+		if _, ok := healthy[zone]; !ok {
+			zones = append(zones, zone)
+		}
+		healthy[zone]++
+	}
+
+	localHealthy := healthy[l.localZone]
+	remoteHealthy := len(hostSet.HealthyHosts()) - localHealthy
+
+	if localHealthy*100 >= localTotal*l.minHealthyPercent || remoteHealthy == 0 {
+		return l.localZone, true
+	}
+
+	if l.rand.Intn(localTotal) < localHealthy {
+		return l.localZone, true
+	}
+
+	n := l.rand.Intn(remoteHealthy)
+	for _, zone := range zones {
+		if zone == l.localZone {
+			continue
+		}
+
+		if n -= healthy[zone]; n < 0 {
+			return zone, true
+		}
+	}
+
+	return l.localZone, true
+}
+
+func (l *zoneAwareLoadBalancer) zoneLB(zone types.HashedValue) types.LoadBalancer {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	lb, ok := l.zoneLBs[zone]
+	if !ok {
+		lb = l.newLB(&zonePrioritySet{
+			PrioritySet: l.prioritySet,
+			zone:        zone,
+		})
+		l.zoneLBs[zone] = lb
+	}
+
+	return lb
+}
+
+func hostZone(host types.Host) types.HashedValue {
+	return host.Metadata()[ZoneMetadataKey]
+}
+
+// zonePrioritySet is a view of the hosts in one zone of the priority set
+type zonePrioritySet struct {
+	types.PrioritySet
+
+	zone types.HashedValue
+}
+
+func (ps *zonePrioritySet) HostSetsByPriority() []types.HostSet {
+	hostSets := ps.PrioritySet.HostSetsByPriority()
+	zoneHostSets := make([]types.HostSet, 0, len(hostSets))
+
+	for _, hs := range hostSets {
+		zoneHostSets = append(zoneHostSets, &hostSet{
+			priority:     hs.Priority(),
+			hosts:        ps.filter(hs.Hosts()),
+			healthyHosts: ps.filter(hs.HealthyHosts()),
+		})
+	}
+
+	return zoneHostSets
+}
+
+func (ps *zonePrioritySet) filter(hosts []types.Host) []types.Host {
+	var zoneHosts []types.Host
+	for _, host := range hosts {
+		if hostZone(host) == ps.zone {
+			zoneHosts = append(zoneHosts, host)
+		}
+	}
+
+	return zoneHosts
+}
+
+// Sticky load balancer sends requests carrying the affinity token in the configured header
+// to the pinned host, if the host is still healthy, matches the metadata match criteria of
+// the request and is not tried by previous retries.
+// Otherwise the host is chosen by the wrapped load balancer, and the request is pinned again
+// by the affinity token of the new host in response.
+type stickyLoadBalancer struct {
+	loadbalaner
+
+	affinity v2.SessionAffinityConfig
+	lb       types.LoadBalancer
+}
+
+func NewStickyLoadBalancer(lb types.LoadBalancer, prioritySet types.PrioritySet, affinity v2.SessionAffinityConfig) types.LoadBalancer {
+	return &stickyLoadBalancer{
+		loadbalaner: loadbalaner{
+			prioritySet: prioritySet,
+		},
+		affinity: affinity,
+		lb:       lb,
+	}
+}
+
+func (l *stickyLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	if host := l.pinnedHost(context); host != nil {
+		return host
+	}
+
+	return l.lb.ChooseHost(context)
+}
+
+func (l *stickyLoadBalancer) pinnedHost(context types.LoadBalancerContext) types.Host {
+	if context == nil {
+		return nil
+	}
+
+	headers := context.DownstreamHeaders()
+	if headers == nil || headers[l.affinity.Header] == "" {
+		return nil
+	}
+	token := headers[l.affinity.Header]
+
+	// hosts out of the subset of the request can't be pinned
+	var criteria []types.MetadataMatchCriterion
+	if matchCriteria := context.MetadataMatchCriteria(); matchCriteria != nil {
+		criteria = matchCriteria.MetadataMatchCriteria()
+	}
+
+	for _, hostSet := range l.prioritySet.HostSetsByPriority() {
+		for _, host := range hostSet.HealthyHosts() {
+			if !hmac.Equal([]byte(token), []byte(types.AffinityToken(l.affinity.Secret, host.AddressString()))) {
+				continue
+			}
+
+			if !hostMatchesCriteria(host, criteria) || context.ShouldSelectAnotherHost(host) {
+				return nil
+			}
+
+			return host
+		}
+	}
+
+	return nil
+}
+
+// Consistent hash, requests with the same value of the configured header
+// are sent to the same host as long as the host set is stable.
+// Each host is put onto the hash ring with a number of virtual nodes,
+// so removing a host only remaps the keys it owned.
+type consistentHashLoadBalancer struct {
+	loadbalaner
+
+	headerKey        string
+	virtualNodeCount uint32
+
+	mux sync.RWMutex
+	// hosts the ring is built on
+	ringHosts []types.Host
+	ring      hashRing
+}
+
+type hashRingNode struct {
+	hash uint32
+	host types.Host
+}
+
+type hashRing []hashRingNode
+
+func (r hashRing) Len() int           { return len(r) }
+func (r hashRing) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r hashRing) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+func NewConsistentHashLoadBalancer(prioritySet types.PrioritySet, config v2.ConsistentHashConfig) types.LoadBalancer {
+	virtualNodeCount := config.VirtualNodeCount
+	if virtualNodeCount == 0 {
+		virtualNodeCount = DefaultVirtualNodeCount
+	}
+
+	return &consistentHashLoadBalancer{
+		loadbalaner: loadbalaner{
+			prioritySet: prioritySet,
+			rand:        newRand(nil),
+		},
+		headerKey:        config.HeaderKey,
+		virtualNodeCount: virtualNodeCount,
+	}
+}
+
+func (l *consistentHashLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	var hosts []types.Host
+
+	// hosts in higher priority(lower number) host set are preferred
+	for _, hostSet := range l.prioritySet.HostSetsByPriority() {
+		if hosts = hostSet.HealthyHosts(); len(hosts) > 0 {
+			break
+		}
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	var key string
+	if context != nil {
+		if headers := context.DownstreamHeaders(); headers != nil {
+			key = headers[l.headerKey]
+		}
+	}
+
+	// no hash key found, choose a random one
+	if key == "" {
+		return hosts[l.rand.Intn(len(hosts))]
+	}
+
+	ring := l.getRing(hosts)
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= hash
+	})
+
+	if idx == len(ring) {
+		idx = 0
+	}
+
+	return ring[idx].host
+}
+
+// getRing returns the hash ring of hosts, rebuild it if hosts changed
+func (l *consistentHashLoadBalancer) getRing(hosts []types.Host) hashRing {
+	l.mux.RLock()
+	if sameHosts(l.ringHosts, hosts) {
+		ring := l.ring
+		l.mux.RUnlock()
+
+		return ring
+	}
+	l.mux.RUnlock()
+
+	ring := make(hashRing, 0, len(hosts)*int(l.virtualNodeCount))
+
+	for _, host := range hosts {
+		addr := host.AddressString()
+
+		for i := uint32(0); i < l.virtualNodeCount; i++ {
+			ring = append(ring, hashRingNode{
+				hash: crc32.ChecksumIEEE([]byte(addr + "#" + strconv.Itoa(int(i)))),
+				host: host,
+			})
+		}
+	}
+
+	sort.Sort(ring)
+
+	l.mux.Lock()
+	l.ringHosts = append([]types.Host{}, hosts...)
+	l.ring = ring
+	l.mux.Unlock()
+
+	return ring
+}
+
+func sameHosts(h1 []types.Host, h2 []types.Host) bool {
+	if len(h1) != len(h2) {
+		return false
+	}
+
+	for i := range h1 {
+		if h1[i] != h2[i] {
+			return false
+		}
+	}
+
+	return true
+}
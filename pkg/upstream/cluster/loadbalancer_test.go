@@ -17,7 +17,12 @@
 package cluster
 
 import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alipay/sofamosn/pkg/api/v2"
 	"github.com/alipay/sofamosn/pkg/types"
@@ -73,4 +78,519 @@ func Test_roundRobinLoadBalancer_ChooseHost(t *testing.T) {
 			t.Errorf("Test Error in case %d , got %+v, but want %+v,", i, got, want[i])
 		}
 	}
-}
\ No newline at end of file
+}
+
+func Test_randomLoadBalancer_SeededSource(t *testing.T) {
+	var hosts []types.Host
+	for i := 0; i < 5; i++ {
+		hosts = append(hosts, NewHost(v2.Host{Address: fmt.Sprintf("127.0.0.%d", i+1), Hostname: "test", Weight: 100}, nil))
+	}
+	ps := &prioritySet{
+		hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}},
+	}
+
+	// selections follow the seeded source exactly
+	l := NewLoadBalancerWithSource(types.Random, ps, rand.NewSource(42))
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		r.Intn(1) // host set
+		want := hosts[r.Intn(len(hosts))]
+		if got := l.ChooseHost(nil); got != want {
+			t.Fatalf("Test Error in case %d, got %s, but want %s", i, got.AddressString(), want.AddressString())
+		}
+	}
+}
+
+func Test_leastRequestLoadBalancer_SeededSource(t *testing.T) {
+	host1 := NewHost(v2.Host{Address: "127.0.0.1", Hostname: "test", Weight: 1}, nil)
+	host2 := NewHost(v2.Host{Address: "127.0.0.2", Hostname: "test2", Weight: 3}, nil)
+	host3 := NewHost(v2.Host{Address: "127.0.0.3", Hostname: "test3", Weight: 2}, nil)
+	hosts := []types.Host{host1, host2, host3}
+	ps := &prioritySet{
+		hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}},
+	}
+
+	choose := func(seed int64) []types.Host {
+		l := NewLoadBalancerWithSource(types.LeastRequest, ps, rand.NewSource(seed))
+		var selected []types.Host
+		for i := 0; i < 100; i++ {
+			host := l.ChooseHost(nil)
+			// keep some requests active, so that the active requests take part in the choices
+			if i%3 == 0 {
+				host.IncActiveRequests()
+			}
+			selected = append(selected, host)
+		}
+		for _, host := range selected {
+			for host.ActiveRequests() > 0 {
+				host.DecActiveRequests()
+			}
+		}
+
+		return selected
+	}
+
+	first := choose(7)
+	if second := choose(7); !sameHosts(first, second) {
+		t.Errorf("same seed expect the same selections")
+	}
+	if other := choose(8); sameHosts(first, other) {
+		t.Errorf("different seeds expect different selections")
+	}
+}
+
+func Test_newRand_Concurrent(t *testing.T) {
+	r := newRand(nil)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if n := r.Intn(10); n < 0 || n >= 10 {
+					t.Errorf("unexpected random number %d", n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_weightedRoundRobinLoadBalancer_ChooseHost(t *testing.T) {
+	host1 := NewHost(v2.Host{Address: "127.0.0.1", Hostname: "test", Weight: 1}, nil)
+	host2 := NewHost(v2.Host{Address: "127.0.0.2", Hostname: "test2", Weight: 3}, nil)
+	host3 := NewHost(v2.Host{Address: "127.0.0.3", Hostname: "test3", Weight: 6}, nil)
+
+	hosts := []types.Host{host1, host2, host3}
+	hs := hostSet{
+		hosts:        hosts,
+		healthyHosts: hosts,
+	}
+
+	l := newWeightedRoundRobinLoadBalancer(&prioritySet{
+		hostSets: []types.HostSet{&hs},
+	})
+
+	total := 3000
+	counts := make(map[types.Host]int)
+	for i := 0; i < total; i++ {
+		counts[l.ChooseHost(nil)]++
+	}
+
+	totalWeight := 10
+	for _, host := range hosts {
+		want := total * int(host.Weight()) / totalWeight
+		got := counts[host]
+		if got < want*95/100 || got > want*105/100 {
+			t.Errorf("Test Error for host %s, got %d selections, but want about %d", host.AddressString(), got, want)
+		}
+	}
+}
+
+func Test_weightedRoundRobinLoadBalancer_ZeroWeight(t *testing.T) {
+	host1 := NewHost(v2.Host{Address: "127.0.0.1", Hostname: "test", Weight: 0}, nil)
+	host2 := NewHost(v2.Host{Address: "127.0.0.2", Hostname: "test2", Weight: 0}, nil)
+
+	hosts := []types.Host{host1, host2}
+	hs := hostSet{
+		hosts:        hosts,
+		healthyHosts: hosts,
+	}
+
+	l := newWeightedRoundRobinLoadBalancer(&prioritySet{
+		hostSets: []types.HostSet{&hs},
+	})
+
+	want := []types.Host{host1, host2, host1, host2}
+	for i := 0; i < len(want); i++ {
+		got := l.ChooseHost(nil)
+		if got != want[i] {
+			t.Errorf("Test Error in case %d , got %+v, but want %+v,", i, got, want[i])
+		}
+	}
+}
+
+func Test_weightedRoundRobinLoadBalancer_HostsRemoved(t *testing.T) {
+	host1 := NewHost(v2.Host{Address: "127.0.0.1", Hostname: "test", Weight: 1}, nil)
+	host2 := NewHost(v2.Host{Address: "127.0.0.2", Hostname: "test2", Weight: 3}, nil)
+
+	ps := &prioritySet{}
+	hs := ps.GetOrCreateHostSet(0)
+	hosts := []types.Host{host1, host2}
+	hs.UpdateHosts(hosts, hosts, nil, nil, hosts, nil)
+
+	l := newWeightedRoundRobinLoadBalancer(ps).(*weightedRoundRobinLoadBalancer)
+	for i := 0; i < 3; i++ {
+		l.ChooseHost(nil)
+	}
+
+	hosts = []types.Host{host2}
+	hs.UpdateHosts(hosts, hosts, nil, nil, nil, []types.Host{host1})
+
+	if _, ok := l.currentWeights[host1.AddressString()]; ok {
+		t.Errorf("Test Error, current weight of removed host %s is kept", host1.AddressString())
+	}
+
+	if got := l.ChooseHost(nil); got != host2 {
+		t.Errorf("Test Error, got %+v, but want %+v", got, host2)
+	}
+}
+
+func Test_slowStartLoadBalancer_ChooseHost(t *testing.T) {
+	host1 := NewHost(v2.Host{Address: "127.0.0.1", Hostname: "test", Weight: 100}, nil)
+	host2 := NewHost(v2.Host{Address: "127.0.0.2", Hostname: "test2", Weight: 100}, nil)
+	host3 := NewHost(v2.Host{Address: "127.0.0.3", Hostname: "test3", Weight: 100}, nil)
+
+	hs := &hostSet{
+		hosts:        []types.Host{host1, host2},
+		healthyHosts: []types.Host{host1, host2},
+	}
+
+	window := 10 * time.Second
+	now := time.Now()
+	l := NewSlowStartLoadBalancer(&prioritySet{
+		hostSets: []types.HostSet{hs},
+	}, window).(*weightedRoundRobinLoadBalancer)
+	l.now = func() time.Time {
+		return now
+	}
+
+	total := 3000
+	// share of host in percent
+	share := func(host types.Host) int {
+		count := 0
+		for i := 0; i < total; i++ {
+			if l.ChooseHost(nil) == host {
+				count++
+			}
+		}
+		return count * 100 / total
+	}
+
+	// hosts present at startup skip slow start
+	if got := share(host1); got != 50 {
+		t.Errorf("Test Error for startup host, got %d%% selections, but want 50%%", got)
+	}
+
+	// a freshly added host receives a growing share of traffic over the window
+	hs.hosts = []types.Host{host1, host2, host3}
+	hs.healthyHosts = []types.Host{host1, host2, host3}
+	last := 0
+	for i, want := range []int{4, 13, 21, 28, 33} {
+		got := share(host3)
+		if got < want-2 || got > want+2 || got <= last {
+			t.Errorf("Test Error at %v of slow start, got %d%% selections, but want about %d%%", now.Sub(l.healthySince[host3.AddressString()]), got, want)
+		}
+		last = got
+		if i < 4 {
+			now = now.Add(window / 4)
+		}
+	}
+
+	// host recovered from unhealthy starts slow again
+	hs.healthyHosts = []types.Host{host1, host2}
+	l.ChooseHost(nil)
+	hs.healthyHosts = []types.Host{host1, host2, host3}
+	if got := share(host3); got > 6 {
+		t.Errorf("Test Error for recovered host, got %d%% selections, but want about 4%%", got)
+	}
+}
+
+type mockLbContext struct {
+	types.LoadBalancerContext
+	headers map[string]string
+	tried   types.Host
+	mmc     types.MetadataMatchCriteria
+}
+
+func (ctx *mockLbContext) DownstreamHeaders() map[string]string {
+	return ctx.headers
+}
+
+func (ctx *mockLbContext) MetadataMatchCriteria() types.MetadataMatchCriteria {
+	return ctx.mmc
+}
+
+func (ctx *mockLbContext) ShouldSelectAnotherHost(host types.Host) bool {
+	return host == ctx.tried
+}
+
+func Test_stickyLoadBalancer_ChooseHost(t *testing.T) {
+	host1 := NewHost(v2.Host{Address: "127.0.0.1:12200", Hostname: "test", Weight: 0}, nil)
+	host2 := NewHost(v2.Host{Address: "127.0.0.2:12200", Hostname: "test2", Weight: 0}, nil)
+
+	hs := &hostSet{
+		hosts:        []types.Host{host1, host2},
+		healthyHosts: []types.Host{host1, host2},
+	}
+	ps := &prioritySet{
+		hostSets: []types.HostSet{hs},
+	}
+	affinity := v2.SessionAffinityConfig{Header: "affinity", Secret: "secret"}
+	l := NewStickyLoadBalancer(newRoundRobinLoadBalancer(ps), ps, affinity)
+
+	choose := func(token string, tried types.Host) types.Host {
+		return l.ChooseHost(&mockLbContext{headers: map[string]string{"affinity": token}, tried: tried})
+	}
+
+	// requests with token are pinned to the host
+	token := types.AffinityToken(affinity.Secret, host2.AddressString())
+	for i := 0; i < 4; i++ {
+		if got := choose(token, nil); got != host2 {
+			t.Errorf("Test Error in case %d, got %s, but want pinned host %s", i, got.AddressString(), host2.AddressString())
+		}
+	}
+
+	// requests without token, with invalid token or token signed by other secret are balanced
+	for _, invalid := range []string{"", "!invalid", types.AffinityToken(affinity.Secret, "127.0.0.3:12200"),
+		types.AffinityToken("other", host2.AddressString())} {
+		if choose(invalid, nil) == choose(invalid, nil) {
+			t.Errorf("Test Error for token %s, requests expect to be balanced", invalid)
+		}
+	}
+
+	// pinned host tried by previous retry is skipped
+	if got := choose(token, host2); got != host1 {
+		t.Errorf("Test Error for tried host, got %s, but want %s", got.AddressString(), host1.AddressString())
+	}
+
+	// unhealthy or removed pinned host falls back to the other host
+	hs.healthyHosts = []types.Host{host1}
+	if got := choose(token, nil); got != host1 {
+		t.Errorf("Test Error for unhealthy host, got %s, but want %s", got.AddressString(), host1.AddressString())
+	}
+	hs.hosts = []types.Host{host1}
+	if got := choose(token, nil); got != host1 {
+		t.Errorf("Test Error for removed host, got %s, but want %s", got.AddressString(), host1.AddressString())
+	}
+}
+
+func Test_consistentHashLoadBalancer_ChooseHost(t *testing.T) {
+	var hosts []types.Host
+	for i := 1; i <= 5; i++ {
+		hosts = append(hosts, NewHost(v2.Host{Address: fmt.Sprintf("127.0.0.%d:12200", i), Hostname: "test", Weight: 0}, nil))
+	}
+
+	hs := &hostSet{
+		hosts:        hosts[:4],
+		healthyHosts: hosts[:4],
+	}
+	l := NewConsistentHashLoadBalancer(&prioritySet{
+		hostSets: []types.HostSet{hs},
+	}, v2.ConsistentHashConfig{HeaderKey: "uid"})
+
+	choose := func(uid string) types.Host {
+		return l.ChooseHost(&mockLbContext{headers: map[string]string{"uid": uid}})
+	}
+
+	keys := 1000
+	mapping := make(map[string]types.Host)
+	for i := 0; i < keys; i++ {
+		uid := strconv.Itoa(i)
+		mapping[uid] = choose(uid)
+		if got := choose(uid); got != mapping[uid] {
+			t.Fatalf("Test Error for key %s, got %s, but want %s", uid, got.AddressString(), mapping[uid].AddressString())
+		}
+	}
+
+	// add an unrelated host, keys not moved to it keep their hosts
+	hs.hosts = hosts
+	hs.healthyHosts = hosts
+	moved := 0
+	for uid, host := range mapping {
+		got := choose(uid)
+		if got == hosts[4] {
+			moved++
+		} else if got != host {
+			t.Errorf("Test Error for key %s after host added, got %s, but want %s", uid, got.AddressString(), host.AddressString())
+		}
+	}
+	if moved == 0 || moved > keys/2 {
+		t.Errorf("Test Error after host added, %d keys moved to the new host", moved)
+	}
+
+	// remove a host, only its keys are remapped
+	removed := hosts[0]
+	hs.hosts = hosts[1:4]
+	hs.healthyHosts = hosts[1:4]
+	for uid, host := range mapping {
+		got := choose(uid)
+		if host == removed {
+			if got == removed {
+				t.Errorf("Test Error for key %s, got removed host %s", uid, got.AddressString())
+			}
+		} else if got != host {
+			t.Errorf("Test Error for key %s after host removed, got %s, but want %s", uid, got.AddressString(), host.AddressString())
+		}
+	}
+}
+
+func Test_leastRequestLoadBalancer_UnevenLatency(t *testing.T) {
+	fast := NewHost(v2.Host{Address: "127.0.0.1", Hostname: "fast", Weight: 100}, nil)
+	slow := NewHost(v2.Host{Address: "127.0.0.2", Hostname: "slow", Weight: 100}, nil)
+
+	hosts := []types.Host{fast, slow}
+	l := NewLoadBalancerWithSource(types.LeastRequest, &prioritySet{
+		hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}},
+	}, rand.NewSource(1))
+
+	// a request is dispatched on each tick, the fast host completes it on the next tick,
+	// and the slow host after 10 ticks
+	latency := map[types.Host]int{fast: 1, slow: 10}
+	completions := make(map[int][]types.Host)
+	counts := make(map[types.Host]int)
+
+	total := 3000
+	for tick := 0; tick < total; tick++ {
+		for _, host := range completions[tick] {
+			host.DecActiveRequests()
+		}
+		delete(completions, tick)
+
+		host := l.ChooseHost(nil)
+		host.IncActiveRequests()
+		counts[host]++
+		completions[tick+latency[host]] = append(completions[tick+latency[host]], host)
+	}
+
+	if counts[fast] < total*70/100 {
+		t.Errorf("fast host expected most of the requests, got fast %d, slow %d", counts[fast], counts[slow])
+	}
+}
+
+func Test_leastRequestLoadBalancer_Weight(t *testing.T) {
+	host1 := NewHost(v2.Host{Address: "127.0.0.1", Hostname: "test", Weight: 1}, nil)
+	host2 := NewHost(v2.Host{Address: "127.0.0.2", Hostname: "test2", Weight: 3}, nil)
+
+	hosts := []types.Host{host1, host2}
+	l := newLeastRequestLoadBalancer(&prioritySet{
+		hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}},
+	}, rand.NewSource(1))
+
+	// idle hosts are picked in proportion to weights
+	total := 4000
+	counts := make(map[types.Host]int)
+	for i := 0; i < total; i++ {
+		counts[l.ChooseHost(nil)]++
+	}
+
+	for _, host := range hosts {
+		want := total * int(host.Weight()) / 4
+		if got := counts[host]; got < want*90/100 || got > want*110/100 {
+			t.Errorf("host %s expected about %d selections, got %d", host.AddressString(), want, got)
+		}
+	}
+
+	// host2 carries more active requests relative to its weight, so host1 gets more than its idle share
+	for i := 0; i < 6; i++ {
+		host2.IncActiveRequests()
+	}
+	host1.IncActiveRequests()
+	counts = make(map[types.Host]int)
+	for i := 0; i < total; i++ {
+		counts[l.ChooseHost(nil)]++
+	}
+	if counts[host1] < total*35/100 {
+		t.Errorf("less loaded host expected more than its idle share, got %d vs %d", counts[host1], counts[host2])
+	}
+}
+
+func newZoneHosts(zone string, count int) []types.Host {
+	var hosts []types.Host
+	for i := 0; i < count; i++ {
+		hosts = append(hosts, NewHost(v2.Host{
+			Address:  fmt.Sprintf("127.0.0.%d:%d", len(zone), 8080+i),
+			Hostname: zone,
+			Weight:   100,
+			MetaData: v2.Metadata{ZoneMetadataKey: zone},
+		}, nil))
+	}
+
+	return hosts
+}
+
+func newZoneAwareLoadBalancer(hosts, healthyHosts []types.Host) types.LoadBalancer {
+	return NewZoneAwareLoadBalancer(&prioritySet{
+		hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: healthyHosts}},
+	}, v2.ZoneAwareConfig{LocalZone: "a", MinHealthyPercent: 70}, func(ps types.PrioritySet) types.LoadBalancer {
+		return NewLoadBalancer(types.RoundRobin, ps)
+	})
+}
+
+func Test_zoneAwareLoadBalancer_SameZone(t *testing.T) {
+	local, remote := newZoneHosts("a", 4), newZoneHosts("bb", 4)
+	hosts := append(append([]types.Host{}, local...), remote...)
+
+	// all local hosts healthy, and 3 of 4 local hosts healthy which is above min healthy percent
+	for _, healthyLocal := range [][]types.Host{local, local[:3]} {
+		l := newZoneAwareLoadBalancer(hosts, append(append([]types.Host{}, healthyLocal...), remote...))
+
+		counts := make(map[types.Host]int)
+		for i := 0; i < 480; i++ {
+			host := l.ChooseHost(nil)
+			if host.Hostname() != "a" {
+				t.Fatalf("expect host in local zone, but got %s", host.Hostname())
+			}
+			counts[host]++
+		}
+		// round robin among healthy local hosts
+		for _, host := range healthyLocal {
+			if counts[host] != 480/len(healthyLocal) {
+				t.Errorf("local host %s expect %d selections, but got %d", host.AddressString(), 480/len(healthyLocal), counts[host])
+			}
+		}
+	}
+}
+
+func Test_zoneAwareLoadBalancer_Spill(t *testing.T) {
+	local, zoneB, zoneC := newZoneHosts("a", 4), newZoneHosts("bb", 2), newZoneHosts("ccc", 1)
+	hosts := append(append(append([]types.Host{}, local...), zoneB...), zoneC...)
+
+	// 1 of 4 local hosts is healthy, the local zone keeps 25% of the requests,
+	// the rest 75% spills to other zones in proportion to their healthy hosts
+	healthyHosts := append(append([]types.Host{local[0]}, zoneB...), zoneC...)
+	l := newZoneAwareLoadBalancer(hosts, healthyHosts)
+	l.(*zoneAwareLoadBalancer).rand = newRand(rand.NewSource(1))
+
+	total := 8000
+	counts := make(map[string]int)
+	for i := 0; i < total; i++ {
+		host := l.ChooseHost(nil)
+		if !host.Health() || (host.Hostname() == "a" && host != local[0]) {
+			t.Fatalf("expect healthy host, but got %s", host.AddressString())
+		}
+		counts[host.Hostname()]++
+	}
+
+	for zone, percent := range map[string]int{"a": 25, "bb": 50, "ccc": 25} {
+		want := total * percent / 100
+		if got := counts[zone]; got < want*90/100 || got > want*110/100 {
+			t.Errorf("zone %s expect about %d selections, but got %d", zone, want, got)
+		}
+	}
+}
+
+func Test_zoneAwareLoadBalancer_Fallback(t *testing.T) {
+	// no local host, all zones are balanced together
+	remote := newZoneHosts("bb", 2)
+	l := newZoneAwareLoadBalancer(remote, remote)
+	if host := l.ChooseHost(nil); host == nil {
+		t.Fatal("expect host in other zone, but got nil")
+	}
+
+	// no local host is healthy, requests spill to other zones entirely
+	local := newZoneHosts("a", 2)
+	l = newZoneAwareLoadBalancer(append(append([]types.Host{}, local...), remote...), remote)
+	for i := 0; i < 10; i++ {
+		if host := l.ChooseHost(nil); host == nil || host.Hostname() != "bb" {
+			t.Fatalf("expect host in other zone, but got %v", host)
+		}
+	}
+
+	// no healthy host at all
+	l = newZoneAwareLoadBalancer(local, nil)
+	if host := l.ChooseHost(nil); host != nil {
+		t.Errorf("expect no host, but got %s", host.AddressString())
+	}
+}
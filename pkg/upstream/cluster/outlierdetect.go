@@ -0,0 +1,280 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const (
+	DefaultBaseEjectionTime   = 30 * time.Second
+	DefaultMaxEjectionPercent = 10
+	// ejection time stops growing after it reaches base ejection time * 2^maxEjectionBackoffShift
+	maxEjectionBackoffShift = 6
+)
+
+// types.Detector
+type outlierDetector struct {
+	consecutiveErrors  uint32
+	baseEjectionTime   time.Duration
+	maxEjectionPercent uint32
+	stats              types.ClusterStats
+
+	mux          sync.Mutex
+	hostMonitors map[string]*outlierHostMonitor
+	numEjected   uint32
+	stopped      bool
+	callbacks    []func(host types.Host)
+}
+
+// NewOutlierDetector creates an outlier detector which ejects hosts returning consecutive server errors
+func NewOutlierDetector(config v2.OutlierDetection, cluster types.Cluster) types.Detector {
+	od := &outlierDetector{
+		consecutiveErrors:  config.Consecutive_5Xx,
+		baseEjectionTime:   config.BaseEjectionTime,
+		maxEjectionPercent: config.MaxEjectionPercent,
+		stats:              cluster.Info().Stats(),
+		hostMonitors:       make(map[string]*outlierHostMonitor),
+	}
+
+	if od.baseEjectionTime == 0 {
+		od.baseEjectionTime = DefaultBaseEjectionTime
+	}
+
+	if od.maxEjectionPercent == 0 {
+		od.maxEjectionPercent = DefaultMaxEjectionPercent
+	} else if od.maxEjectionPercent > 100 {
+		od.maxEjectionPercent = 100
+	}
+
+	for _, hostSet := range cluster.PrioritySet().HostSetsByPriority() {
+		od.OnClusterMemberUpdate(hostSet.Hosts(), nil)
+	}
+
+	return od
+}
+
+func (od *outlierDetector) AddChangedStateCb(cb func(host types.Host)) {
+	od.mux.Lock()
+	defer od.mux.Unlock()
+
+	od.callbacks = append(od.callbacks, cb)
+}
+
+func (od *outlierDetector) OnClusterMemberUpdate(hostsAdded []types.Host, hostsRemoved []types.Host) {
+	od.mux.Lock()
+	defer od.mux.Unlock()
+
+	for _, host := range hostsAdded {
+		if _, ok := od.hostMonitors[host.AddressString()]; ok {
+			continue
+		}
+
+		monitor := &outlierHostMonitor{
+			detector: od,
+			host:     host,
+		}
+		od.hostMonitors[host.AddressString()] = monitor
+		host.SetOutlierDetector(monitor)
+	}
+
+	// removed hosts are not re-admitted, they are no longer in the cluster
+	for _, host := range hostsRemoved {
+		if monitor, ok := od.hostMonitors[host.AddressString()]; ok {
+			if monitor.ejected {
+				monitor.unejectTimer.Stop()
+				od.numEjected--
+				od.stats.OutlierDetectionEjectionsActive.Dec(1)
+			}
+
+			delete(od.hostMonitors, host.AddressString())
+		}
+	}
+}
+
+func (od *outlierDetector) Stop() {
+	od.mux.Lock()
+	od.stopped = true
+
+	var readmitted []types.Host
+	for _, monitor := range od.hostMonitors {
+		if monitor.ejected {
+			monitor.unejectTimer.Stop()
+			od.unejectLocked(monitor)
+			readmitted = append(readmitted, monitor.host)
+		}
+	}
+	od.mux.Unlock()
+
+	for _, host := range readmitted {
+		od.runCallbacks(host)
+	}
+}
+
+// ejectionTime doubles the base ejection time for each repeated ejection
+func (od *outlierDetector) ejectionTime(numEjections uint32) time.Duration {
+	shift := numEjections - 1
+	if shift > maxEjectionBackoffShift {
+		shift = maxEjectionBackoffShift
+	}
+
+	return od.baseEjectionTime << shift
+}
+
+// ejectAllowed checks the max ejection percent, and never ejects the last available host
+func (od *outlierDetector) ejectAllowed() bool {
+	total := uint32(len(od.hostMonitors))
+
+	if od.numEjected+1 >= total {
+		return false
+	}
+
+	return od.numEjected*100 < total*od.maxEjectionPercent
+}
+
+func (od *outlierDetector) onConsecutiveErrors(monitor *outlierHostMonitor) {
+	od.mux.Lock()
+
+	if od.stopped || monitor.ejected || od.hostMonitors[monitor.host.AddressString()] != monitor {
+		od.mux.Unlock()
+		return
+	}
+
+	// manual override takes precedence, the host is admitted until the override is cleared
+	if monitor.host.HealthOverride() == types.HealthOverrideAdmitted {
+		od.mux.Unlock()
+		log.DefaultLogger.Debugf("outlier detection: host %s not ejected, admitted manually", monitor.host.AddressString())
+		return
+	}
+
+	if !od.ejectAllowed() {
+		od.mux.Unlock()
+		od.stats.OutlierDetectionEjectionsOverflow.Inc(1)
+		log.DefaultLogger.Warnf("outlier detection: host %s not ejected, reach max ejection percent %d%% or no host left",
+			monitor.host.AddressString(), od.maxEjectionPercent)
+		return
+	}
+
+	now := time.Now()
+
+	// a host staying healthy longer than its last ejection time starts over from the base ejection time
+	if monitor.numEjections > 0 && now.Sub(monitor.lastUnejectionTime) > od.ejectionTime(monitor.numEjections) {
+		monitor.numEjections = 0
+	}
+
+	monitor.numEjections++
+	monitor.lastEjectionTime = now
+	monitor.ejected = true
+	od.numEjected++
+
+	ejectionTime := od.ejectionTime(monitor.numEjections)
+	monitor.unejectTimer = time.AfterFunc(ejectionTime, func() {
+		od.onEjectionTimeout(monitor)
+	})
+
+	monitor.host.SetHealthFlag(types.FAILED_OUTLIER_CHECK)
+	od.mux.Unlock()
+
+	od.stats.OutlierDetectionEjectionsTotal.Inc(1)
+	od.stats.OutlierDetectionEjectionsActive.Inc(1)
+	log.DefaultLogger.Infof("outlier detection: eject host %s for %s, ejections = %d",
+		monitor.host.AddressString(), ejectionTime, monitor.numEjections)
+
+	od.runCallbacks(monitor.host)
+}
+
+func (od *outlierDetector) onEjectionTimeout(monitor *outlierHostMonitor) {
+	od.mux.Lock()
+
+	if !monitor.ejected || od.hostMonitors[monitor.host.AddressString()] != monitor {
+		od.mux.Unlock()
+		return
+	}
+
+	od.unejectLocked(monitor)
+	od.mux.Unlock()
+
+	log.DefaultLogger.Infof("outlier detection: re-admit host %s", monitor.host.AddressString())
+
+	od.runCallbacks(monitor.host)
+}
+
+func (od *outlierDetector) unejectLocked(monitor *outlierHostMonitor) {
+	monitor.ejected = false
+	monitor.lastUnejectionTime = time.Now()
+	atomic.StoreUint32(&monitor.consecutiveErrors, 0)
+	od.numEjected--
+
+	monitor.host.ClearHealthFlag(types.FAILED_OUTLIER_CHECK)
+	od.stats.OutlierDetectionEjectionsActive.Dec(1)
+}
+
+func (od *outlierDetector) runCallbacks(host types.Host) {
+	od.mux.Lock()
+	callbacks := od.callbacks
+	od.mux.Unlock()
+
+	for _, cb := range callbacks {
+		cb(host)
+	}
+}
+
+// types.DetectorHostMonitor
+type outlierHostMonitor struct {
+	detector          *outlierDetector
+	host              types.Host
+	consecutiveErrors uint32
+
+	// protected by detector's mux
+	ejected            bool
+	numEjections       uint32
+	lastEjectionTime   time.Time
+	lastUnejectionTime time.Time
+	unejectTimer       *time.Timer
+}
+
+func (m *outlierHostMonitor) PutResult(result types.OutlierResult) {
+	switch result {
+	case types.OutlierResultServerError:
+		if atomic.AddUint32(&m.consecutiveErrors, 1) >= m.detector.consecutiveErrors {
+			atomic.StoreUint32(&m.consecutiveErrors, 0)
+			m.detector.onConsecutiveErrors(m)
+		}
+	default:
+		atomic.StoreUint32(&m.consecutiveErrors, 0)
+	}
+}
+
+func (m *outlierHostMonitor) NumEjections() uint32 {
+	m.detector.mux.Lock()
+	defer m.detector.mux.Unlock()
+
+	return m.numEjections
+}
+
+func (m *outlierHostMonitor) LastEjectionTime() time.Time {
+	m.detector.mux.Lock()
+	defer m.detector.mux.Unlock()
+
+	return m.lastEjectionTime
+}
@@ -0,0 +1,260 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func init() {
+	log.InitDefaultLogger("", log.INFO)
+}
+
+func newOutlierTestCluster(name string, hostNum int, config v2.OutlierDetection) (types.Cluster, []types.Host) {
+	c := NewCluster(v2.Cluster{
+		Name:             name,
+		ClusterType:      v2.SIMPLE_CLUSTER,
+		LbType:           v2.LB_ROUNDROBIN,
+		OutlierDetection: config,
+	}, nil, true)
+
+	var hosts []types.Host
+	for i := 0; i < hostNum; i++ {
+		hosts = append(hosts, NewHost(v2.Host{Address: fmt.Sprintf("127.0.0.%d:8080", i+1)}, c.Info()))
+	}
+	c.(*simpleInMemCluster).UpdateHosts(hosts)
+
+	return c, hosts
+}
+
+func putErrors(host types.Host, n int) {
+	for i := 0; i < n; i++ {
+		host.OutlierDetector().PutResult(types.OutlierResultServerError)
+	}
+}
+
+func healthyHostsNum(c types.Cluster) int {
+	return len(c.PrioritySet().HostSetsByPriority()[0].HealthyHosts())
+}
+
+func TestOutlierDetectionEject(t *testing.T) {
+	c, hosts := newOutlierTestCluster("outlier_eject", 4, v2.OutlierDetection{
+		Consecutive_5Xx:    3,
+		BaseEjectionTime:   100 * time.Millisecond,
+		MaxEjectionPercent: 50,
+	})
+	defer c.OutlierDetector().Stop()
+
+	stats := c.Info().Stats()
+	ejectionsTotal := stats.OutlierDetectionEjectionsTotal.Count()
+
+	// errors interrupted by a success are not consecutive
+	putErrors(hosts[0], 2)
+	hosts[0].OutlierDetector().PutResult(types.OutlierResultSuccess)
+	putErrors(hosts[0], 2)
+
+	if !hosts[0].Health() || healthyHostsNum(c) != 4 {
+		t.Fatalf("host should not be ejected before reaching consecutive errors")
+	}
+
+	putErrors(hosts[0], 1)
+
+	if hosts[0].Health() || !hosts[0].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Fatalf("host should be ejected after consecutive errors")
+	}
+	if healthyHostsNum(c) != 3 {
+		t.Errorf("ejected host should be excluded from healthy hosts, got %d healthy hosts", healthyHostsNum(c))
+	}
+	for i := 0; i < 8; i++ {
+		if h := c.Info().LBInstance().ChooseHost(nil); h == hosts[0] {
+			t.Errorf("ejected host should not be chosen by load balancer")
+		}
+	}
+
+	if stats.OutlierDetectionEjectionsTotal.Count()-ejectionsTotal != 1 || stats.OutlierDetectionEjectionsActive.Count() != 1 {
+		t.Errorf("unexpected ejection stats, total = %d, active = %d",
+			stats.OutlierDetectionEjectionsTotal.Count()-ejectionsTotal, stats.OutlierDetectionEjectionsActive.Count())
+	}
+	if hosts[0].OutlierDetector().NumEjections() != 1 || hosts[0].OutlierDetector().LastEjectionTime().IsZero() {
+		t.Errorf("unexpected ejection records of host")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if !hosts[0].Health() || healthyHostsNum(c) != 4 {
+		t.Errorf("host should be re-admitted after ejection time")
+	}
+	if stats.OutlierDetectionEjectionsActive.Count() != 0 {
+		t.Errorf("active ejections should be 0, got %d", stats.OutlierDetectionEjectionsActive.Count())
+	}
+}
+
+func TestOutlierDetectionEjectionBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	c, hosts := newOutlierTestCluster("outlier_backoff", 4, v2.OutlierDetection{
+		Consecutive_5Xx:    1,
+		BaseEjectionTime:   base,
+		MaxEjectionPercent: 50,
+	})
+	defer c.OutlierDetector().Stop()
+
+	od := c.OutlierDetector().(*outlierDetector)
+	want := []time.Duration{base, 2 * base, 4 * base, 8 * base}
+	for i, w := range want {
+		if got := od.ejectionTime(uint32(i + 1)); got != w {
+			t.Errorf("ejection %d: want ejection time %s, got %s", i+1, w, got)
+		}
+	}
+	if got := od.ejectionTime(100); got != base<<maxEjectionBackoffShift {
+		t.Errorf("ejection time should be capped, got %s", got)
+	}
+
+	// first ejection lasts base ejection time
+	putErrors(hosts[0], 1)
+	time.Sleep(base + 50*time.Millisecond)
+	if !hosts[0].Health() {
+		t.Fatalf("host should be re-admitted after first ejection")
+	}
+
+	// repeated offense doubles the ejection time
+	putErrors(hosts[0], 1)
+	if hosts[0].OutlierDetector().NumEjections() != 2 {
+		t.Fatalf("want 2 ejections, got %d", hosts[0].OutlierDetector().NumEjections())
+	}
+	time.Sleep(base + 50*time.Millisecond)
+	if hosts[0].Health() {
+		t.Errorf("host should still be ejected on repeated offense")
+	}
+	time.Sleep(base)
+	if !hosts[0].Health() {
+		t.Errorf("host should be re-admitted after doubled ejection time")
+	}
+}
+
+func TestOutlierDetectionMaxEjectionPercent(t *testing.T) {
+	c, hosts := newOutlierTestCluster("outlier_max_percent", 4, v2.OutlierDetection{
+		Consecutive_5Xx:    1,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	defer c.OutlierDetector().Stop()
+
+	overflow := c.Info().Stats().OutlierDetectionEjectionsOverflow.Count()
+
+	for _, host := range hosts {
+		putErrors(host, 1)
+	}
+
+	if healthyHostsNum(c) != 2 {
+		t.Errorf("at most 50%% hosts should be ejected, got %d healthy hosts", healthyHostsNum(c))
+	}
+	if got := c.Info().Stats().OutlierDetectionEjectionsOverflow.Count() - overflow; got != 2 {
+		t.Errorf("want 2 ejection overflow, got %d", got)
+	}
+
+	// stop re-admits all ejected hosts
+	c.OutlierDetector().Stop()
+	if healthyHostsNum(c) != 4 {
+		t.Errorf("all hosts should be re-admitted after stop, got %d healthy hosts", healthyHostsNum(c))
+	}
+}
+
+func TestOutlierDetectionNeverEjectAll(t *testing.T) {
+	c, hosts := newOutlierTestCluster("outlier_never_all", 2, v2.OutlierDetection{
+		Consecutive_5Xx:    1,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionPercent: 100,
+	})
+	defer c.OutlierDetector().Stop()
+
+	putErrors(hosts[0], 1)
+	putErrors(hosts[1], 1)
+
+	if healthyHostsNum(c) != 1 || !hosts[1].Health() {
+		t.Errorf("the last available host should never be ejected")
+	}
+}
+
+func TestHostHealthOverride(t *testing.T) {
+	c, hosts := newOutlierTestCluster("outlier_override", 4, v2.OutlierDetection{
+		Consecutive_5Xx:    1,
+		BaseEjectionTime:   time.Hour,
+		MaxEjectionPercent: 50,
+	})
+	defer c.OutlierDetector().Stop()
+
+	// manual ejection
+	if !c.SetHostHealthOverride(hosts[0].AddressString(), types.HealthOverrideEjected) {
+		t.Fatalf("host should be found in cluster")
+	}
+	if hosts[0].Health() || healthyHostsNum(c) != 3 {
+		t.Fatalf("manually ejected host should be excluded from healthy hosts")
+	}
+
+	// un-eject the host ejected by outlier detection
+	putErrors(hosts[1], 1)
+	if hosts[1].Health() || healthyHostsNum(c) != 2 {
+		t.Fatalf("host should be ejected by outlier detection")
+	}
+	c.SetHostHealthOverride(hosts[1].AddressString(), types.HealthOverrideAdmitted)
+	if !hosts[1].Health() || healthyHostsNum(c) != 3 {
+		t.Fatalf("manually admitted host should be healthy even if ejected by outlier detection")
+	}
+
+	// admitted host is not ejected by outlier detection
+	c.SetHostHealthOverride(hosts[2].AddressString(), types.HealthOverrideAdmitted)
+	putErrors(hosts[2], 3)
+	if !hosts[2].Health() || hosts[2].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Errorf("manually admitted host should not be ejected by outlier detection")
+	}
+
+	// clearing restores the automatic detection
+	c.SetHostHealthOverride(hosts[1].AddressString(), types.HealthOverrideNone)
+	if hosts[1].Health() || healthyHostsNum(c) != 2 {
+		t.Errorf("host still ejected by outlier detection should be unhealthy once override cleared")
+	}
+
+	if c.SetHostHealthOverride("127.0.0.100:8080", types.HealthOverrideEjected) {
+		t.Errorf("host not in cluster should not be found")
+	}
+}
+
+func TestHostHealthOverrideSurvivesUpdate(t *testing.T) {
+	c, hosts := newOutlierTestCluster("override_update", 3, v2.OutlierDetection{})
+	address := hosts[0].AddressString()
+	c.SetHostHealthOverride(address, types.HealthOverrideEjected)
+
+	// the host is removed and added again by discovery
+	c.(*simpleInMemCluster).UpdateHosts(hosts[1:])
+	readded := NewHost(v2.Host{Address: address}, c.Info())
+	c.(*simpleInMemCluster).UpdateHosts([]types.Host{readded, hosts[1], hosts[2]})
+
+	if readded.HealthOverride() != types.HealthOverrideEjected || healthyHostsNum(c) != 2 {
+		t.Fatalf("host added again should keep manual ejection")
+	}
+
+	c.SetHostHealthOverride(address, types.HealthOverrideNone)
+	if !readded.Health() || healthyHostsNum(c) != 3 {
+		t.Errorf("host should be healthy once override cleared")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// requestRateLimiter is a leaky bucket pacing the requests sent to a cluster, requests are
+// spaced by the interval of the max rate, and wait in the queue up to maxQueueDelay
+type requestRateLimiter struct {
+	mux           sync.Mutex
+	interval      time.Duration
+	maxQueueDelay time.Duration
+	// the time the next request could be sent
+	next time.Time
+	now  func() time.Time
+}
+
+// newRequestRateLimiter returns nil if no rate is configured
+func newRequestRateLimiter(config v2.ClusterRateLimit) types.RequestRateLimiter {
+	if config.MaxRequestsPerSecond <= 0 {
+		return nil
+	}
+
+	return &requestRateLimiter{
+		interval:      time.Duration(float64(time.Second) / config.MaxRequestsPerSecond),
+		maxQueueDelay: config.MaxQueueDelay,
+		now:           time.Now,
+	}
+}
+
+func (l *requestRateLimiter) Reserve() (time.Duration, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := l.now()
+	// the bucket is drained while idle, no burst is allowed
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	delay := l.next.Sub(now)
+	if delay > l.maxQueueDelay {
+		return 0, false
+	}
+	l.next = l.next.Add(l.interval)
+
+	return delay, true
+}
@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+)
+
+func newTestRateLimiter(rps float64, maxQueueDelay time.Duration, now *time.Time) *requestRateLimiter {
+	l := newRequestRateLimiter(v2.ClusterRateLimit{MaxRequestsPerSecond: rps, MaxQueueDelay: maxQueueDelay}).(*requestRateLimiter)
+	l.now = func() time.Time {
+		return *now
+	}
+
+	return l
+}
+
+func TestRequestRateLimiterQueue(t *testing.T) {
+	now := time.Now()
+	l := newTestRateLimiter(10, 250*time.Millisecond, &now)
+
+	for i, want := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if delay, ok := l.Reserve(); !ok || delay != want {
+			t.Errorf("request %d expect delay %v, got %v %v", i, want, delay, ok)
+		}
+	}
+	if _, ok := l.Reserve(); ok {
+		t.Error("request should be shed if the queue is full")
+	}
+
+	// a slot is released after the interval
+	now = now.Add(100 * time.Millisecond)
+	if delay, ok := l.Reserve(); !ok || delay != 200*time.Millisecond {
+		t.Errorf("expect delay 200ms, got %v %v", delay, ok)
+	}
+
+	// no burst after idle
+	now = now.Add(10 * time.Second)
+	if delay, ok := l.Reserve(); !ok || delay != 0 {
+		t.Errorf("expect no delay after idle, got %v %v", delay, ok)
+	}
+	if delay, ok := l.Reserve(); !ok || delay != 100*time.Millisecond {
+		t.Errorf("expect delay 100ms after idle, got %v %v", delay, ok)
+	}
+}
+
+// sustained requests over the rate are sent at the rate, and the overflow is shed
+func TestRequestRateLimiterSustained(t *testing.T) {
+	start := time.Now()
+	now := start
+	l := newTestRateLimiter(50, 100*time.Millisecond, &now)
+
+	var sent []time.Time
+	shed := 0
+	// 200 rps for 2 seconds
+	for i := 0; i < 400; i++ {
+		if delay, ok := l.Reserve(); ok {
+			sent = append(sent, now.Add(delay))
+		} else {
+			shed++
+		}
+		now = now.Add(5 * time.Millisecond)
+	}
+
+	// 100 in 2 seconds, and the ones queued
+	if len(sent) < 100 || len(sent) > 106 {
+		t.Errorf("expect about 100 requests sent, got %d", len(sent))
+	}
+	if shed != 400-len(sent) {
+		t.Errorf("expect %d requests shed, got %d", 400-len(sent), shed)
+	}
+	for i := 1; i < len(sent); i++ {
+		if interval := sent[i].Sub(sent[i-1]); interval < 20*time.Millisecond {
+			t.Fatalf("requests %d and %d are sent within %v", i-1, i, interval)
+		}
+	}
+	if last := sent[len(sent)-1].Sub(start); last > 2*time.Second+100*time.Millisecond {
+		t.Errorf("requests should not be queued longer than max queue delay, the last is sent at %v", last)
+	}
+}
+
+func TestRequestRateLimiterNotConfigured(t *testing.T) {
+	if l := newRequestRateLimiter(v2.ClusterRateLimit{}); l != nil {
+		t.Errorf("expect no rate limiter, got %v", l)
+	}
+}
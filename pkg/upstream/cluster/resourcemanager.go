@@ -28,6 +28,9 @@ const (
 	DefaultMaxPendingRequests = uint64(10240)
 	DefaultMaxRequests        = uint64(10240)
 	DefaultMaxRetries         = uint64(3)
+
+	DefaultRetryBudgetPercent        = float64(20)
+	DefaultRetryBudgetMinConcurrency = uint64(3)
 )
 
 // ResourceManager
@@ -35,7 +38,7 @@ type resourcemanager struct {
 	connections     *resource
 	pendingRequests *resource
 	requests        *resource
-	retries         *resource
+	retries         types.Resource
 }
 
 func NewResourceManager(circuitBreakers v2.CircuitBreakers) types.ResourceManager {
@@ -44,15 +47,32 @@ func NewResourceManager(circuitBreakers v2.CircuitBreakers) types.ResourceManage
 	maxRequests := DefaultMaxRequests
 	maxRetries := DefaultMaxRetries
 
+	var budget *v2.RetryBudget
+
 	// note: we dont support group cb by priority
+	// zero in thresholds means not configured, use the default value
 	if circuitBreakers.Thresholds != nil && len(circuitBreakers.Thresholds) > 0 {
-		maxConnections = uint64(circuitBreakers.Thresholds[0].MaxConnections)
-		maxPendingRequests = uint64(circuitBreakers.Thresholds[0].MaxPendingRequests)
-		maxRequests = uint64(circuitBreakers.Thresholds[0].MaxRequests)
-		maxRetries = uint64(circuitBreakers.Thresholds[0].MaxRetries)
+		thresholds := circuitBreakers.Thresholds[0]
+		budget = thresholds.RetryBudget
+
+		if thresholds.MaxConnections > 0 {
+			maxConnections = uint64(thresholds.MaxConnections)
+		}
+
+		if thresholds.MaxPendingRequests > 0 {
+			maxPendingRequests = uint64(thresholds.MaxPendingRequests)
+		}
+
+		if thresholds.MaxRequests > 0 {
+			maxRequests = uint64(thresholds.MaxRequests)
+		}
+
+		if thresholds.MaxRetries > 0 {
+			maxRetries = uint64(thresholds.MaxRetries)
+		}
 	}
 
-	return &resourcemanager{
+	rm := &resourcemanager{
 		connections: &resource{
 			max: maxConnections,
 		},
@@ -66,6 +86,12 @@ func NewResourceManager(circuitBreakers v2.CircuitBreakers) types.ResourceManage
 			max: maxRetries,
 		},
 	}
+
+	if budget != nil {
+		rm.retries = newRetryBudget(budget, rm.requests, rm.pendingRequests)
+	}
+
+	return rm
 }
 
 func (rm *resourcemanager) Connections() types.Resource {
@@ -111,3 +137,73 @@ func (r *resource) Decrease() {
 func (r *resource) Max() uint64 {
 	return r.max
 }
+
+// retryBudget is the retries resource with the max changing with the active requests,
+// the ones pending in connection pools included
+type retryBudget struct {
+	current             int64
+	budgetPercent       float64
+	minRetryConcurrency uint64
+	requests            *resource
+	pendingRequests     *resource
+}
+
+func newRetryBudget(budget *v2.RetryBudget, requests, pendingRequests *resource) *retryBudget {
+	b := &retryBudget{
+		budgetPercent:       DefaultRetryBudgetPercent,
+		minRetryConcurrency: DefaultRetryBudgetMinConcurrency,
+		requests:            requests,
+		pendingRequests:     pendingRequests,
+	}
+
+	if budget.BudgetPercent > 0 {
+		b.budgetPercent = budget.BudgetPercent
+	}
+
+	if budget.MinRetryConcurrency > 0 {
+		b.minRetryConcurrency = uint64(budget.MinRetryConcurrency)
+	}
+
+	return b
+}
+
+func (b *retryBudget) CanCreate() bool {
+	curValue := atomic.LoadInt64(&b.current)
+
+	if curValue < 0 {
+		return true
+	}
+
+	return uint64(curValue) < b.Max()
+}
+
+func (b *retryBudget) Increase() {
+	atomic.AddInt64(&b.current, 1)
+}
+
+func (b *retryBudget) Decrease() {
+	atomic.AddInt64(&b.current, -1)
+}
+
+func (b *retryBudget) Max() uint64 {
+	active := atomic.LoadInt64(&b.requests.current) + atomic.LoadInt64(&b.pendingRequests.current)
+
+	max := uint64(0)
+	if active > 0 {
+		max = uint64(float64(active) * b.budgetPercent / 100)
+	}
+
+	if max < b.minRetryConcurrency {
+		return b.minRetryConcurrency
+	}
+
+	return max
+}
+
+func (b *retryBudget) BudgetPercent() float64 {
+	return b.budgetPercent
+}
+
+func (b *retryBudget) MinRetryConcurrency() uint64 {
+	return b.minRetryConcurrency
+}
@@ -0,0 +1,140 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cluster
+
+import (
+	"testing"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func TestResourceManagerDefaultThresholds(t *testing.T) {
+	rm := NewResourceManager(v2.CircuitBreakers{
+		Thresholds: []v2.Thresholds{
+			{MaxRequests: 2},
+		},
+	})
+
+	if rm.Requests().Max() != 2 {
+		t.Errorf("want max requests 2, got %d", rm.Requests().Max())
+	}
+	if rm.PendingRequests().Max() != DefaultMaxPendingRequests {
+		t.Errorf("zero max pending requests should use default value, got %d", rm.PendingRequests().Max())
+	}
+	if rm.Retries().Max() != DefaultMaxRetries {
+		t.Errorf("zero max retries should use default value, got %d", rm.Retries().Max())
+	}
+}
+
+func TestResourceTripAndRecover(t *testing.T) {
+	rm := NewResourceManager(v2.CircuitBreakers{
+		Thresholds: []v2.Thresholds{
+			{MaxRequests: 2, MaxPendingRequests: 1},
+		},
+	})
+
+	requests := rm.Requests()
+	for i := 0; i < 2; i++ {
+		if !requests.CanCreate() {
+			t.Fatalf("request %d should be allowed", i)
+		}
+		requests.Increase()
+	}
+	if requests.CanCreate() {
+		t.Errorf("requests exceed max requests should be rejected")
+	}
+
+	requests.Decrease()
+	if !requests.CanCreate() {
+		t.Errorf("request should be allowed after a request completed")
+	}
+
+	pending := rm.PendingRequests()
+	pending.Increase()
+	if pending.CanCreate() {
+		t.Errorf("pending requests exceed max pending requests should be rejected")
+	}
+	pending.Decrease()
+	if !pending.CanCreate() {
+		t.Errorf("pending request should be allowed after a pending request dispatched")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	rm := NewResourceManager(v2.CircuitBreakers{
+		Thresholds: []v2.Thresholds{
+			{RetryBudget: &v2.RetryBudget{BudgetPercent: 25, MinRetryConcurrency: 1}},
+		},
+	})
+
+	retries := rm.Retries()
+	if _, ok := retries.(types.RetryBudget); !ok {
+		t.Fatalf("retries should be limited by the budget")
+	}
+
+	// at least MinRetryConcurrency retries are allowed without active requests
+	if !retries.CanCreate() {
+		t.Fatalf("retry under min retry concurrency should be allowed")
+	}
+	retries.Increase()
+	if retries.CanCreate() {
+		t.Errorf("retries exceed min retry concurrency should be suppressed")
+	}
+
+	// the budget grows with the active requests, pending ones included
+	for i := 0; i < 6; i++ {
+		rm.Requests().Increase()
+	}
+	for i := 0; i < 2; i++ {
+		rm.PendingRequests().Increase()
+	}
+	if retries.Max() != 2 {
+		t.Errorf("want max retries 25%% of 8 active requests, got %d", retries.Max())
+	}
+	if !retries.CanCreate() {
+		t.Fatalf("retry under budget should be allowed")
+	}
+	retries.Increase()
+	if retries.CanCreate() {
+		t.Errorf("retries exceed budget should be suppressed")
+	}
+
+	retries.Decrease()
+	if !retries.CanCreate() {
+		t.Errorf("retry should be allowed after a retry completed")
+	}
+}
+
+func TestRetryBudgetDefaults(t *testing.T) {
+	rm := NewResourceManager(v2.CircuitBreakers{
+		Thresholds: []v2.Thresholds{
+			{MaxRetries: 10, RetryBudget: &v2.RetryBudget{}},
+		},
+	})
+
+	budget, ok := rm.Retries().(types.RetryBudget)
+	if !ok {
+		t.Fatalf("retries should be limited by the budget instead of max retries")
+	}
+	if budget.BudgetPercent() != DefaultRetryBudgetPercent || budget.MinRetryConcurrency() != DefaultRetryBudgetMinConcurrency {
+		t.Errorf("zero budget should use default values, got %v/%d", budget.BudgetPercent(), budget.MinRetryConcurrency())
+	}
+	if budget.Max() != DefaultRetryBudgetMinConcurrency {
+		t.Errorf("want max retries %d without active requests, got %d", DefaultRetryBudgetMinConcurrency, budget.Max())
+	}
+}
@@ -26,6 +26,7 @@ import (
 
 type subSetLoadBalancer struct {
 	lbType                types.LoadBalancerType // inner LB algorithm for choosing subset's host
+	consistentHash        v2.ConsistentHashConfig // hash key config of the consistent hash lb type
 	runtime               types.Loader
 	stats                 types.ClusterStats
 	random                rand.Rand
@@ -39,10 +40,11 @@ type subSetLoadBalancer struct {
 
 //
 func NewSubsetLoadBalancer(lbType types.LoadBalancerType, prioritySet types.PrioritySet, stats types.ClusterStats,
-	subsets types.LBSubsetInfo) types.SubSetLoadBalancer {
+	subsets types.LBSubsetInfo, consistentHash v2.ConsistentHashConfig) types.SubSetLoadBalancer {
 
 	ssb := &subSetLoadBalancer{
 		lbType:                lbType,
+		consistentHash:        consistentHash,
 		fallBackPolicy:        subsets.FallbackPolicy(),
 		defaultSubSetMetadata: GenerateDftSubsetKeys(subsets.DefaultSubset()), //ordered subset metadata pair, value为md5 hash值
 		subSetKeys:            subsets.SubsetKeys(),
@@ -138,14 +140,14 @@ func (sslb *subSetLoadBalancer) TryChooseHostFromContext(context types.LoadBalan
 	matchCriteria := context.MetadataMatchCriteria()
 
 	if nil == matchCriteria {
-		log.DefaultLogger.Errorf("subset load balancer: context is nil")
+		log.DefaultLogger.Debugf("subset load balancer: no metadata match criteria")
 		return nil
 	}
 
 	entry := sslb.FindSubset(matchCriteria.MetadataMatchCriteria())
 
 	if nil == entry || !entry.Active() {
-		log.DefaultLogger.Errorf("subset load balancer: match entry failure")
+		log.DefaultLogger.Debugf("subset load balancer: no host matches the criteria")
 		return nil
 	}
 
@@ -360,8 +362,9 @@ func (lbbe *LBSubsetEntry) Initialized() bool {
 	return nil != lbbe.prioritySubset
 }
 
+// Active returns false if all hosts of the subset are removed, requests fall back then
 func (lbbe *LBSubsetEntry) Active() bool {
-	return true
+	return nil != lbbe.prioritySubset && !lbbe.prioritySubset.Empty()
 }
 
 func (lbbe *LBSubsetEntry) PrioritySubset() types.PrioritySubset {
@@ -416,7 +419,9 @@ func (hsi *hostSubsetImpl) UpdateHostSubset(hostsAdded []types.Host, hostsRemove
 }
 
 func (hsi *hostSubsetImpl) GetFinalHosts(hostsAdded []types.Host, hostsRemoved []types.Host) []types.Host {
-	hosts := hsi.hostSubset.Hosts()
+	// the current hosts may be in use by load balancer, update a copy of them
+	hosts := make([]types.Host, len(hsi.hostSubset.Hosts()))
+	copy(hosts, hsi.hostSubset.Hosts())
 
 	for _, host := range hostsAdded {
 		found := false
@@ -435,7 +440,7 @@ func (hsi *hostSubsetImpl) GetFinalHosts(hostsAdded []types.Host, hostsRemoved [
 		for i, hostOrig := range hosts {
 			if host.AddressString() == hostOrig.AddressString() {
 				hosts = append(hosts[:i], hosts[i+1:]...)
-				continue
+				break
 			}
 		}
 	}
@@ -470,21 +475,15 @@ func NewPrioritySubsetImpl(subsetLB *subSetLoadBalancer, predicate types.HostPre
 
 	var i uint32
 
-	for i = 0; i < uint32(len(psi.originalPrioritySet.HostSetsByPriority())); i++ {
-		if len(psi.originalPrioritySet.GetOrCreateHostSet(i).Hosts()) > 0 {
-			psi.empty = false
-		}
-	}
-
 	for i = 0; i < uint32(len(psi.originalPrioritySet.HostSetsByPriority())); i++ {
 		psi.Update(i, subsetLB.originalPrioritySet.HostSetsByPriority()[i].Hosts(), []types.Host{})
 	}
 
-	switch subsetLB.lbType {
-	case types.Random:
-		psi.loadbalancer = newRandomLoadbalancer(psi.prioritySubset)
-	case types.RoundRobin:
-		psi.loadbalancer = newRoundRobinLoadBalancer(psi.prioritySubset)
+	// hosts of the subset are chosen by the lb type of the cluster
+	if subsetLB.lbType == types.ConsistentHash {
+		psi.loadbalancer = NewConsistentHashLoadBalancer(psi.prioritySubset, subsetLB.consistentHash)
+	} else {
+		psi.loadbalancer = NewLoadBalancer(subsetLB.lbType, psi.prioritySubset)
 	}
 
 	return psi
@@ -494,6 +493,8 @@ func (psi *PrioritySubsetImpl) Update(priority uint32, hostsAdded []types.Host,
 
 	psi.GetOrCreateHostSubset(priority).UpdateHostSubset(hostsAdded, hostsRemoved, psi.predicate_)
 
+	// the subset becomes empty if all its hosts are removed
+	psi.empty = true
 	for _, hostSet := range psi.prioritySubset.HostSetsByPriority() {
 		if len(hostSet.Hosts()) > 0 {
 			psi.empty = false
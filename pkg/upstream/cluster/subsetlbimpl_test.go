@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -441,7 +442,7 @@ func Test_subSetLoadBalancer_ChooseHost(t *testing.T) {
 	}
 
 	sslb := NewSubsetLoadBalancer(types.RoundRobin, &prioritySetExample,
-		newClusterStats(v2.Cluster{Name: "testcluster"}), NewLBSubsetInfo(InitExampleLbSubsetConfig()))
+		newClusterStats(v2.Cluster{Name: "testcluster"}), NewLBSubsetInfo(InitExampleLbSubsetConfig()), v2.ConsistentHashConfig{})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -455,6 +456,187 @@ func Test_subSetLoadBalancer_ChooseHost(t *testing.T) {
 	}
 }
 
+func zoneContext(zone string) types.LoadBalancerContext {
+	metadata := map[string]interface{}{}
+	if zone != "" {
+		metadata["zone"] = zone
+	}
+
+	return &ContextImplMock{mmc: router.NewMetadataMatchCriteriaImpl(metadata)}
+}
+
+func zoneHost(address, zone string, info types.ClusterInfo) types.Host {
+	return NewHost(v2.Host{Address: address, MetaData: v2.Metadata{"zone": zone}}, info)
+}
+
+// hosts are selected from the subset matching the zone, or from the default subset
+// if no host matches, as hosts are added and removed
+func Test_subSetLoadBalancer_ZoneSubset(t *testing.T) {
+	c := NewCluster(v2.Cluster{
+		Name:        "zone_subset",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_ROUNDROBIN,
+		LBSubSetConfig: v2.LBSubsetConfig{
+			FallBackPolicy:  uint8(types.DefaultSubsetDefaultSubset),
+			DefaultSubset:   map[string]string{"zone": "a"},
+			SubsetSelectors: [][]string{{"zone"}},
+		},
+	}, nil, true).(*simpleInMemCluster)
+
+	a1 := zoneHost("127.0.0.1:8080", "a", c.Info())
+	a2 := zoneHost("127.0.0.2:8080", "a", c.Info())
+	b1 := zoneHost("127.0.0.3:8080", "b", c.Info())
+	c.UpdateHosts([]types.Host{a1, a2, b1})
+
+	expectZone := func(step string, ctx types.LoadBalancerContext, zone string) {
+		for i := 0; i < 4; i++ {
+			host := c.Info().LBInstance().ChooseHost(ctx)
+			if host == nil || host.Metadata()["zone"] != types.GenerateHashedValue(zone) {
+				t.Fatalf("%s: expect host of zone %s, got %v", step, zone, host)
+			}
+		}
+	}
+
+	expectZone("zone matched", zoneContext("b"), "b")
+	expectZone("zone not exists", zoneContext("c"), "a")
+	expectZone("no criteria", zoneContext(""), "a")
+
+	// all hosts of zone b are removed
+	c.UpdateHosts([]types.Host{a1, a2})
+	expectZone("zone emptied", zoneContext("b"), "a")
+
+	// zone b is back
+	b2 := zoneHost("127.0.0.4:8080", "b", c.Info())
+	c.UpdateHosts([]types.Host{a1, a2, b2})
+	expectZone("zone re-added", zoneContext("b"), "b")
+	if host := c.Info().LBInstance().ChooseHost(zoneContext("b")); host.AddressString() != b2.AddressString() {
+		t.Errorf("expect the added host %s, got %s", b2.AddressString(), host.AddressString())
+	}
+}
+
+// the hosts of subsets are chosen by least request load balancer of the cluster
+func Test_subSetLoadBalancer_LeastRequest(t *testing.T) {
+	c := NewCluster(v2.Cluster{
+		Name:        "least_request_subset",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_LEAST_REQUEST,
+		LBSubSetConfig: v2.LBSubsetConfig{
+			FallBackPolicy:  uint8(types.DefaultSubsetDefaultSubset),
+			DefaultSubset:   map[string]string{"zone": "a"},
+			SubsetSelectors: [][]string{{"zone"}},
+		},
+	}, nil, true).(*simpleInMemCluster)
+
+	a1 := zoneHost("127.0.0.1:8080", "a", c.Info())
+	b1 := zoneHost("127.0.0.2:8080", "b", c.Info())
+	b2 := zoneHost("127.0.0.3:8080", "b", c.Info())
+	c.UpdateHosts([]types.Host{a1, b1, b2})
+
+	// b1 is busy, the idle b2 of the subset gets most of the requests
+	for i := 0; i < 10; i++ {
+		b1.IncActiveRequests()
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		host := c.Info().LBInstance().ChooseHost(zoneContext("b"))
+		if host == nil || host.Metadata()["zone"] != types.GenerateHashedValue("b") {
+			t.Fatalf("expect host of zone b, got %v", host)
+		}
+		counts[host.AddressString()]++
+	}
+
+	if counts[b2.AddressString()] <= counts[b1.AddressString()] {
+		t.Errorf("expect the idle host %s chosen more, got %v", b2.AddressString(), counts)
+	}
+
+	if host := c.Info().LBInstance().ChooseHost(zoneContext("c")); host == nil || host.AddressString() != a1.AddressString() {
+		t.Errorf("expect the default subset host %s, got %v", a1.AddressString(), host)
+	}
+}
+
+// the hosts of subsets are chosen by consistent hash of the cluster, keyed on the configured header
+func Test_subSetLoadBalancer_ConsistentHash(t *testing.T) {
+	c := NewCluster(v2.Cluster{
+		Name:           "consistent_hash_subset",
+		ClusterType:    v2.SIMPLE_CLUSTER,
+		LbType:         v2.LB_CONSISTENT_HASH,
+		ConsistentHash: v2.ConsistentHashConfig{HeaderKey: "user"},
+		LBSubSetConfig: v2.LBSubsetConfig{
+			FallBackPolicy:  uint8(types.DefaultSubsetDefaultSubset),
+			DefaultSubset:   map[string]string{"zone": "a"},
+			SubsetSelectors: [][]string{{"zone"}},
+		},
+	}, nil, true).(*simpleInMemCluster)
+
+	var hosts []types.Host
+	for i, zone := range []string{"a", "b", "b", "b"} {
+		hosts = append(hosts, zoneHost(fmt.Sprintf("127.0.0.%d:8080", i+1), zone, c.Info()))
+	}
+	c.UpdateHosts(hosts)
+
+	for i := 0; i < 10; i++ {
+		ctx := &ContextImplMock{
+			mmc:    router.NewMetadataMatchCriteriaImpl(map[string]interface{}{"zone": "b"}),
+			header: map[string]string{"user": fmt.Sprintf("user-%d", i)},
+		}
+
+		host := c.Info().LBInstance().ChooseHost(ctx)
+		if host == nil || host.Metadata()["zone"] != types.GenerateHashedValue("b") {
+			t.Fatalf("expect host of zone b, got %v", host)
+		}
+
+		// the same key is sent to the same host
+		for j := 0; j < 5; j++ {
+			if again := c.Info().LBInstance().ChooseHost(ctx); again != host {
+				t.Fatalf("expect host %s for key %s, got %v", host.AddressString(), ctx.header["user"], again)
+			}
+		}
+	}
+}
+
+// affinity tokens of hosts out of the subset of the request are ignored
+func Test_subSetLoadBalancer_SessionAffinity(t *testing.T) {
+	c := NewCluster(v2.Cluster{
+		Name:            "affinity_subset",
+		ClusterType:     v2.SIMPLE_CLUSTER,
+		LbType:          v2.LB_ROUNDROBIN,
+		SessionAffinity: v2.SessionAffinityConfig{Header: "affinity"},
+		LBSubSetConfig: v2.LBSubsetConfig{
+			FallBackPolicy:  uint8(types.NoFallBack),
+			SubsetSelectors: [][]string{{"zone"}},
+		},
+	}, nil, true).(*simpleInMemCluster)
+
+	a1 := zoneHost("127.0.0.1:8080", "a", c.Info())
+	a2 := zoneHost("127.0.0.2:8080", "a", c.Info())
+	b1 := zoneHost("127.0.0.3:8080", "b", c.Info())
+	c.UpdateHosts([]types.Host{a1, a2, b1})
+
+	affinity := c.Info().SessionAffinity()
+	if affinity.Secret == "" {
+		t.Fatal("expect a random secret generated for the affinity tokens")
+	}
+
+	choose := func(zone string, pinned types.Host) types.Host {
+		ctx := zoneContext(zone).(*ContextImplMock)
+		ctx.header = map[string]string{"affinity": types.AffinityToken(affinity.Secret, pinned.AddressString())}
+		return c.Info().LBInstance().ChooseHost(ctx)
+	}
+
+	for i := 0; i < 4; i++ {
+		if host := choose("a", a2); host != a2 {
+			t.Fatalf("expect pinned host %s, got %v", a2.AddressString(), host)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		if host := choose("a", b1); host == nil || host == b1 {
+			t.Fatalf("expect token of host out of the subset ignored, got %v", host)
+		}
+	}
+}
+
 // passed
 func TestGenerateSubsetKeys(t *testing.T) {
 	type args struct {
@@ -669,7 +851,8 @@ func InitExampleHosts() []types.Host {
 }
 
 type ContextImplMock struct {
-	mmc *router.MetadataMatchCriteriaImpl
+	mmc    *router.MetadataMatchCriteriaImpl
+	header map[string]string
 }
 
 func (ci *ContextImplMock) ComputeHashKey() types.HashedValue {
@@ -686,5 +869,9 @@ func (ci *ContextImplMock) DownstreamConnection() net.Conn {
 }
 
 func (ci *ContextImplMock) DownstreamHeaders() map[string]string {
-	return nil
+	return ci.header
+}
+
+func (ci *ContextImplMock) ShouldSelectAnotherHost(host types.Host) bool {
+	return false
 }
@@ -0,0 +1,58 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package discovery
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+// Creator creates a service discovery from config
+type Creator func(config v2.ServiceDiscovery) (types.ServiceDiscovery, error)
+
+var (
+	creatorsMux sync.RWMutex
+	creators    = make(map[string]Creator)
+)
+
+func init() {
+	Register("file", NewFileDiscovery)
+}
+
+// Register registers a service discovery implementation by type, which can be used in cluster manager config
+func Register(typ string, creator Creator) {
+	creatorsMux.Lock()
+	defer creatorsMux.Unlock()
+
+	creators[typ] = creator
+}
+
+// New creates the service discovery of the configured type
+func New(config v2.ServiceDiscovery) (types.ServiceDiscovery, error) {
+	creatorsMux.RLock()
+	creator, ok := creators[config.Type]
+	creatorsMux.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported service discovery type: %s", config.Type)
+	}
+
+	return creator(config)
+}
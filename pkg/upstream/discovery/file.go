@@ -0,0 +1,194 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+const DefaultRefreshInterval = time.Second
+
+var ErrDiscoveryClosed = errors.New("service discovery is closed")
+
+// fileDiscovery reads cluster hosts from a json file, which maps cluster names to host lists:
+//
+//	{"cluster": [{"address": "127.0.0.1:8080", "weight": 100}]}
+//
+// The file is reloaded when its content changes, and the clusters whose host list changed are pushed
+// to subscribers. Clusters absent from the file are left unchanged. An invalid file is ignored, so that
+// a half written file won't clear the hosts.
+type fileDiscovery struct {
+	path     string
+	interval time.Duration
+	stop     chan struct{}
+
+	mux         sync.Mutex
+	content     []byte
+	hosts       map[string][]v2.Host
+	subscribers map[string][]*subscriber
+	closed      bool
+}
+
+type subscriber struct {
+	// holds the latest host list only, a stale list is replaced if not received yet
+	ch   chan []v2.Host
+	last []v2.Host
+}
+
+// NewFileDiscovery loads the hosts file and watches it every refresh interval
+func NewFileDiscovery(config v2.ServiceDiscovery) (types.ServiceDiscovery, error) {
+	if config.Path == "" {
+		return nil, errors.New("path is required in file service discovery")
+	}
+
+	interval := config.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+
+	fd := &fileDiscovery{
+		path:        config.Path,
+		interval:    interval,
+		stop:        make(chan struct{}),
+		subscribers: make(map[string][]*subscriber),
+	}
+
+	if err := fd.reload(); err != nil {
+		return nil, err
+	}
+
+	go fd.watch()
+
+	return fd, nil
+}
+
+func (fd *fileDiscovery) Subscribe(clusterName string) (<-chan []v2.Host, error) {
+	fd.mux.Lock()
+	defer fd.mux.Unlock()
+
+	if fd.closed {
+		return nil, ErrDiscoveryClosed
+	}
+
+	s := &subscriber{
+		ch: make(chan []v2.Host, 1),
+	}
+	fd.subscribers[clusterName] = append(fd.subscribers[clusterName], s)
+
+	if hosts, ok := fd.hosts[clusterName]; ok {
+		s.push(hosts)
+	}
+
+	return s.ch, nil
+}
+
+func (fd *fileDiscovery) Close() {
+	fd.mux.Lock()
+	defer fd.mux.Unlock()
+
+	if fd.closed {
+		return
+	}
+	fd.closed = true
+	close(fd.stop)
+
+	for _, subscribers := range fd.subscribers {
+		for _, s := range subscribers {
+			close(s.ch)
+		}
+	}
+}
+
+func (fd *fileDiscovery) watch() {
+	ticker := time.NewTicker(fd.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fd.stop:
+			return
+		case <-ticker.C:
+			if err := fd.reload(); err != nil {
+				log.DefaultLogger.Errorf("reload hosts file %s failed: %v", fd.path, err)
+			}
+		}
+	}
+}
+
+// reload reads the file and pushes the changed host lists, the previous hosts are kept on error
+func (fd *fileDiscovery) reload() error {
+	content, err := ioutil.ReadFile(fd.path)
+	if err != nil {
+		return err
+	}
+
+	fd.mux.Lock()
+	defer fd.mux.Unlock()
+
+	if fd.closed || (fd.content != nil && bytes.Equal(content, fd.content)) {
+		return nil
+	}
+
+	hosts := make(map[string][]v2.Host)
+	if err := json.Unmarshal(content, &hosts); err != nil {
+		return fmt.Errorf("invalid hosts file: %v", err)
+	}
+
+	fd.content = content
+	fd.hosts = hosts
+
+	for clusterName, subscribers := range fd.subscribers {
+		clusterHosts, ok := hosts[clusterName]
+		if !ok {
+			continue
+		}
+
+		for _, s := range subscribers {
+			if !reflect.DeepEqual(clusterHosts, s.last) {
+				s.push(clusterHosts)
+			}
+		}
+	}
+
+	return nil
+}
+
+// must be called with discovery's lock, so that there is only one sender
+func (s *subscriber) push(hosts []v2.Host) {
+	if hosts == nil {
+		hosts = []v2.Host{}
+	}
+
+	select {
+	case <-s.ch:
+	default:
+	}
+
+	s.ch <- hosts
+	s.last = hosts
+}
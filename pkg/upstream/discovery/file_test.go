@@ -0,0 +1,168 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+)
+
+func init() {
+	log.InitDefaultLogger("", log.INFO)
+}
+
+func newTestDiscovery(t *testing.T, content string) (types.ServiceDiscovery, string) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "hosts.json")
+	writeHostsFile(t, path, content)
+
+	sd, err := New(v2.ServiceDiscovery{
+		Type:            "file",
+		Path:            path,
+		RefreshInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sd, path
+}
+
+func writeHostsFile(t *testing.T, path string, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectHosts(t *testing.T, updates <-chan []v2.Host, expected ...string) {
+	select {
+	case hosts := <-updates:
+		if len(hosts) != len(expected) {
+			t.Fatalf("hosts expected %v, got %+v", expected, hosts)
+		}
+		for i, host := range hosts {
+			if host.Address != expected[i] {
+				t.Fatalf("hosts expected %v, got %+v", expected, hosts)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("hosts %v are not pushed", expected)
+	}
+}
+
+func expectNoUpdate(t *testing.T, updates <-chan []v2.Host) {
+	select {
+	case hosts := <-updates:
+		t.Fatalf("unexpected hosts pushed: %+v", hosts)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFileDiscoveryUpdateHosts(t *testing.T) {
+	sd, path := newTestDiscovery(t, `{"cluster1": [{"address": "127.0.0.1:8080"}], "cluster2": [{"address": "127.0.0.1:9090"}]}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer sd.Close()
+
+	updates, err := sd.Subscribe("cluster1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// current hosts are pushed on subscribe
+	expectHosts(t, updates, "127.0.0.1:8080")
+
+	// add host
+	writeHostsFile(t, path, `{"cluster1": [{"address": "127.0.0.1:8080"}, {"address": "127.0.0.2:8080"}], "cluster2": [{"address": "127.0.0.1:9090"}]}`)
+	expectHosts(t, updates, "127.0.0.1:8080", "127.0.0.2:8080")
+
+	// remove host
+	writeHostsFile(t, path, `{"cluster1": [{"address": "127.0.0.2:8080"}], "cluster2": [{"address": "127.0.0.1:9090"}]}`)
+	expectHosts(t, updates, "127.0.0.2:8080")
+
+	// other cluster changed only
+	writeHostsFile(t, path, `{"cluster1": [{"address": "127.0.0.2:8080"}], "cluster2": []}`)
+	expectNoUpdate(t, updates)
+
+	// remove all hosts
+	writeHostsFile(t, path, `{"cluster1": [], "cluster2": []}`)
+	expectHosts(t, updates)
+}
+
+func TestFileDiscoveryInvalidFile(t *testing.T) {
+	sd, path := newTestDiscovery(t, `{"cluster1": [{"address": "127.0.0.1:8080"}]}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer sd.Close()
+
+	updates, err := sd.Subscribe("cluster1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectHosts(t, updates, "127.0.0.1:8080")
+
+	// a half written file keeps the hosts
+	writeHostsFile(t, path, `{"cluster1": [{"address": "127.0`)
+	expectNoUpdate(t, updates)
+
+	// a cluster absent from the file is left unchanged
+	writeHostsFile(t, path, `{}`)
+	expectNoUpdate(t, updates)
+
+	writeHostsFile(t, path, `{"cluster1": [{"address": "127.0.0.3:8080"}]}`)
+	expectHosts(t, updates, "127.0.0.3:8080")
+}
+
+func TestFileDiscoveryClose(t *testing.T) {
+	sd, path := newTestDiscovery(t, `{}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	updates, err := sd.Subscribe("cluster1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd.Close()
+
+	if _, ok := <-updates; ok {
+		t.Error("channel should be closed after discovery closed")
+	}
+	if _, err := sd.Subscribe("cluster1"); err != ErrDiscoveryClosed {
+		t.Errorf("subscribe after closed expected error %v, got %v", ErrDiscoveryClosed, err)
+	}
+}
+
+func TestNewDiscoveryErrors(t *testing.T) {
+	if _, err := New(v2.ServiceDiscovery{Type: "unknown"}); err == nil {
+		t.Error("unknown service discovery type should fail")
+	}
+
+	if _, err := New(v2.ServiceDiscovery{Type: "file"}); err == nil {
+		t.Error("file service discovery without path should fail")
+	}
+
+	if _, err := New(v2.ServiceDiscovery{Type: "file", Path: "/nonexistent/hosts.json"}); err == nil {
+		t.Error("file service discovery with missing file should fail")
+	}
+}
@@ -35,6 +35,10 @@ func (nhc *healthCheckerFactory) New(config v2.HealthCheck) types.HealthChecker
 	case string(protocol.SofaRpc):
 		return newSofaRpcHealthChecker(config)
 	case string(protocol.Http2):
+		if config.Type == v2.GrpcHealthCheck {
+			return newGrpcHealthChecker(config)
+		}
+
 		return newHttpHealthCheck(config)
 		// todo: http1
 	default:
@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// grpcHealthChecker checks hosts by grpc.health.v1.Health/Check, hosts are healthy
+// if the service configured by ServiceName is SERVING
+type grpcHealthChecker struct {
+	healthChecker
+}
+
+func newGrpcHealthChecker(config v2.HealthCheck) types.HealthChecker {
+	hc := newHealthChecker(config)
+
+	ghc := &grpcHealthChecker{
+		healthChecker: *hc,
+	}
+
+	ghc.sessionFactory = ghc
+
+	return ghc
+}
+
+func (c *grpcHealthChecker) newSession(host types.Host) types.HealthCheckSession {
+	ghcs := &grpcHealthCheckSession{
+		healthChecker:      c,
+		healthCheckSession: *newHealthCheckSession(&c.healthChecker, host),
+	}
+
+	// the check is timed out by the deadline of the call, so no timeout timer is started
+	ghcs.intervalTimer = newTimer(ghcs.onInterval)
+	ghcs.timeoutTimer = newTimer(func() {})
+
+	return ghcs
+}
+
+type grpcHealthCheckSession struct {
+	healthCheckSession
+
+	healthChecker *grpcHealthChecker
+
+	mux     sync.Mutex
+	conn    *grpc.ClientConn
+	stopped int32
+}
+
+// overload healthCheckSession
+func (s *grpcHealthCheckSession) Start() {
+	s.onInterval()
+}
+
+func (s *grpcHealthCheckSession) Stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+	s.healthCheckSession.Stop()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *grpcHealthCheckSession) onInterval() {
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		return
+	}
+
+	s.healthChecker.stats.attempt.Inc(1)
+
+	// the result is handled out of the interval timer callback, so that the timer can be started again
+	go s.check()
+}
+
+func (s *grpcHealthCheckSession) check() {
+	client, err := s.client()
+	if err != nil {
+		log.DefaultLogger.Debugf("For grpc health check, connect to %s error: %v", s.host.AddressString(), err)
+		s.onCheckComplete(nil, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.healthChecker.getTimeoutDuration())
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: s.healthChecker.serviceName})
+	cancel()
+
+	s.onCheckComplete(resp, err)
+}
+
+func (s *grpcHealthCheckSession) client() (healthpb.HealthClient, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.conn == nil {
+		conn, err := grpc.Dial(s.host.AddressString(), grpc.WithInsecure())
+		if err != nil {
+			return nil, err
+		}
+
+		s.conn = conn
+	}
+
+	return healthpb.NewHealthClient(s.conn), nil
+}
+
+func (s *grpcHealthCheckSession) onCheckComplete(resp *healthpb.HealthCheckResponse, err error) {
+	// the call is cancelled by closing the connection on stop
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		return
+	}
+
+	if err != nil {
+		log.DefaultLogger.Debugf("Grpc health check for %s failed: %v", s.host.AddressString(), err)
+
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			s.handleFailure(types.FailureNetwork)
+		default:
+			s.handleFailure(types.FailureActive)
+		}
+
+		return
+	}
+
+	if resp.Status == healthpb.HealthCheckResponse_SERVING {
+		s.handleSuccess()
+	} else {
+		log.DefaultLogger.Debugf("Grpc health check for %s got status %s", s.host.AddressString(), resp.Status)
+		s.handleFailure(types.FailureActive)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package healthcheck
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/alipay/sofamosn/pkg/upstream/cluster"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const grpcHealthCheckService = "app.Service"
+
+// a grpc server serving the standard health service only
+type grpcHealthServer struct {
+	listener net.Listener
+	server   *grpc.Server
+	health   *health.Server
+}
+
+func newGrpcHealthServer(t *testing.T) *grpcHealthServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &grpcHealthServer{
+		listener: l,
+		server:   grpc.NewServer(),
+		health:   health.NewServer(),
+	}
+	s.health.SetServingStatus(grpcHealthCheckService, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s.server, s.health)
+
+	go s.server.Serve(l)
+
+	return s
+}
+
+func (s *grpcHealthServer) setServing(serving bool) {
+	if serving {
+		s.health.SetServingStatus(grpcHealthCheckService, healthpb.HealthCheckResponse_SERVING)
+	} else {
+		s.health.SetServingStatus(grpcHealthCheckService, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func (s *grpcHealthServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *grpcHealthServer) close() {
+	s.server.Stop()
+}
+
+func TestGrpcHealthCheck(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	flaky := newGrpcHealthServer(t)
+	defer flaky.close()
+	stable := newGrpcHealthServer(t)
+	defer stable.close()
+
+	c := cluster.NewCluster(v2.Cluster{
+		Name:        "grpc_health_check",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_ROUNDROBIN,
+		HealthCheck: v2.HealthCheck{
+			Protocol:           string(protocol.Http2),
+			Type:               v2.GrpcHealthCheck,
+			ServiceName:        grpcHealthCheckService,
+			Timeout:            100 * time.Millisecond,
+			Interval:           50 * time.Millisecond,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 2,
+		},
+	}, nil, false)
+
+	c.(types.SimpleCluster).UpdateHosts([]types.Host{
+		cluster.NewHost(v2.Host{Address: flaky.addr()}, c.Info()),
+		cluster.NewHost(v2.Host{Address: stable.addr()}, c.Info()),
+	})
+
+	if !waitHealthyHosts(c, 2, time.Second) {
+		t.Fatal("hosts should be healthy at start")
+	}
+
+	// service of the host is not serving
+	flaky.setServing(false)
+
+	if !waitHealthyHosts(c, 1, 3*time.Second) {
+		t.Fatal("host not serving should be unhealthy")
+	}
+
+	for i := 0; i < 10; i++ {
+		if host := c.Info().LBInstance().ChooseHost(nil); host == nil || host.AddressString() != stable.addr() {
+			t.Fatal("unhealthy host should not be chosen by load balancer")
+		}
+	}
+
+	// service of the host recovers
+	flaky.setServing(true)
+
+	if !waitHealthyHosts(c, 2, 3*time.Second) {
+		t.Fatal("host serving again should be healthy")
+	}
+
+	// host is gone
+	flaky.close()
+
+	if !waitHealthyHosts(c, 1, 3*time.Second) {
+		t.Fatal("host not reachable should be unhealthy")
+	}
+
+	c.HealthChecker().Stop()
+}
@@ -18,6 +18,8 @@ package healthcheck
 
 import (
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
@@ -26,6 +28,11 @@ import (
 	"github.com/alipay/sofamosn/pkg/types"
 )
 
+const (
+	DefaultHealthyThreshold   uint32 = 2
+	DefaultUnhealthyThreshold uint32 = 2
+)
+
 type sessionFactory interface {
 	newSession(host types.Host) types.HealthCheckSession
 }
@@ -36,6 +43,8 @@ type healthChecker struct {
 	healthCheckCbs      []types.HealthCheckCb
 	cluster             types.Cluster
 	healthCheckSessions map[types.Host]types.HealthCheckSession
+	// healthChecker is copied by value into concrete checkers, so hold a pointer
+	sessionsMux *sync.Mutex
 
 	timeout        time.Duration
 	interval       time.Duration
@@ -53,6 +62,7 @@ type healthChecker struct {
 func newHealthChecker(config v2.HealthCheck) *healthChecker {
 	hc := &healthChecker{
 		healthCheckSessions: make(map[types.Host]types.HealthCheckSession),
+		sessionsMux:         new(sync.Mutex),
 		timeout:             config.Timeout,
 		interval:            config.Interval,
 		intervalJitter:      config.IntervalJitter,
@@ -65,6 +75,15 @@ func newHealthChecker(config v2.HealthCheck) *healthChecker {
 		hc.serviceName = config.ServiceName
 	}
 
+	// threshold 0 means host state never changes
+	if hc.healthyThreshold == 0 {
+		hc.healthyThreshold = DefaultHealthyThreshold
+	}
+
+	if hc.unhealthyThreshold == 0 {
+		hc.unhealthyThreshold = DefaultUnhealthyThreshold
+	}
+
 	return hc
 }
 
@@ -79,7 +98,13 @@ func (c *healthChecker) Start() {
 }
 
 func (c *healthChecker) Stop() {
-	// todo
+	c.sessionsMux.Lock()
+	defer c.sessionsMux.Unlock()
+
+	for host, session := range c.healthCheckSessions {
+		session.Stop()
+		delete(c.healthCheckSessions, host)
+	}
 }
 
 func (c *healthChecker) AddHostCheckCompleteCb(cb types.HealthCheckCb) {
@@ -109,13 +134,30 @@ func (c *healthChecker) addHosts(hosts []types.Host) {
 				return
 			}
 
+			c.sessionsMux.Lock()
 			c.healthCheckSessions[h] = ns
-			c.healthCheckSessions[h].Start()
+			c.sessionsMux.Unlock()
+
+			if monitor, ok := ns.(types.HealthCheckHostMonitor); ok {
+				h.SetHealthChecker(monitor)
+			}
+
+			ns.Start()
 		}()
 	}
 }
 
-func (c *healthChecker) delHosts(hosts []types.Host) {}
+func (c *healthChecker) delHosts(hosts []types.Host) {
+	c.sessionsMux.Lock()
+	defer c.sessionsMux.Unlock()
+
+	for _, host := range hosts {
+		if session, ok := c.healthCheckSessions[host]; ok {
+			session.Stop()
+			delete(c.healthCheckSessions, host)
+		}
+	}
+}
 
 func (c *healthChecker) OnClusterMemberUpdate(hostsAdded []types.Host, hostDel []types.Host) {
 	c.addHosts(hostsAdded)
@@ -123,17 +165,17 @@ func (c *healthChecker) OnClusterMemberUpdate(hostsAdded []types.Host, hostDel [
 }
 
 func (c *healthChecker) decHealthy() {
-	c.localProcessHealthy--
+	atomic.AddUint64(&c.localProcessHealthy, ^uint64(0))
 	c.refreshHealthyStat()
 }
 
 func (c *healthChecker) incHealthy() {
-	c.localProcessHealthy++
+	atomic.AddUint64(&c.localProcessHealthy, 1)
 	c.refreshHealthyStat()
 }
 
 func (c *healthChecker) refreshHealthyStat() {
-	c.stats.healthy.Update(int64(c.localProcessHealthy))
+	c.stats.healthy.Update(int64(atomic.LoadUint64(&c.localProcessHealthy)))
 }
 
 func (c *healthChecker) getStats() *healthCheckStats {
@@ -193,6 +235,14 @@ type healthCheckSession struct {
 	numHealthy   uint32
 	numUnHealthy uint32
 	host         types.Host
+
+	// *healthCheckResult of the last check
+	lastResult atomic.Value
+}
+
+type healthCheckResult struct {
+	time    time.Time
+	healthy bool
 }
 
 func newHealthCheckSession(hc *healthChecker, host types.Host) *healthCheckSession {
@@ -202,7 +252,7 @@ func newHealthCheckSession(hc *healthChecker, host types.Host) *healthCheckSessi
 	}
 
 	if !host.ContainHealthFlag(types.FAILED_ACTIVE_HC) {
-		hcs.healthChecker.decHealthy()
+		hcs.healthChecker.incHealthy()
 	}
 
 	return hcs
@@ -212,9 +262,10 @@ func (s *healthCheckSession) Start() {
 	s.onInterval()
 }
 
-//// stop intervalTimer to stop sending health message
+//// stop timers to stop sending health message
 func (s *healthCheckSession) Stop() {
 	s.intervalTimer.stop()
+	s.timeoutTimer.stop()
 }
 
 func (s *healthCheckSession) handleSuccess() {
@@ -231,6 +282,7 @@ func (s *healthCheckSession) handleSuccess() {
 		}
 	}
 
+	s.lastResult.Store(&healthCheckResult{time: time.Now(), healthy: true})
 	s.healthChecker.stats.success.Inc(1)
 	s.healthChecker.runCallbacks(s.host, stateChanged)
 
@@ -254,6 +306,7 @@ func (s *healthCheckSession) SetUnhealthy(fType types.FailureType) {
 		}
 	}
 
+	s.lastResult.Store(&healthCheckResult{time: time.Now(), healthy: false})
 	s.healthChecker.stats.failure.Inc(1)
 
 	switch fType {
@@ -266,6 +319,15 @@ func (s *healthCheckSession) SetUnhealthy(fType types.FailureType) {
 	s.healthChecker.runCallbacks(s.host, stateChanged)
 }
 
+// types.HealthCheckHostMonitor
+func (s *healthCheckSession) LastCheckResult() (time.Time, bool) {
+	if result, ok := s.lastResult.Load().(*healthCheckResult); ok {
+		return result.time, result.healthy
+	}
+
+	return time.Time{}, false
+}
+
 func (s *healthCheckSession) handleFailure(fType types.FailureType) {
 	s.SetUnhealthy(fType)
 
@@ -17,6 +17,7 @@
 package healthcheck
 
 import (
+	"context"
 	"math/rand"
 	"reflect"
 	"strconv"
@@ -46,6 +47,8 @@ func newSofaRpcHealthChecker(config v2.HealthCheck) *sofarpcHealthChecker {
 	// use bolt v1 as default sofa health check protocol
 	if 0 == config.ProtocolCode {
 		shc.protocolCode = sofarpc.BOLT_V1
+	} else {
+		shc.protocolCode = sofarpc.ProtocolType(config.ProtocolCode)
 	}
 
 	shc.sessionFactory = shc
@@ -91,7 +94,7 @@ func (c *sofarpcHealthChecker) newSession(host types.Host) types.HealthCheckSess
 }
 
 func (c *sofarpcHealthChecker) createCodecClient(data types.CreateConnectionData) stream.CodecClient {
-	return stream.NewCodecClient(nil, protocol.SofaRpc, data.Connection, data.HostInfo)
+	return stream.NewCodecClient(context.Background(), protocol.SofaRpc, data.Connection, data.HostInfo)
 }
 
 // types.StreamReceiver
@@ -0,0 +1,240 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package healthcheck
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofamosn/pkg/api/v2"
+	"github.com/alipay/sofamosn/pkg/log"
+	"github.com/alipay/sofamosn/pkg/protocol"
+	"github.com/alipay/sofamosn/pkg/protocol/sofarpc"
+	_ "github.com/alipay/sofamosn/pkg/stream/sofarpc"
+	"github.com/alipay/sofamosn/pkg/types"
+	"github.com/alipay/sofamosn/pkg/upstream/cluster"
+)
+
+// a bolt v1 server which only answers heartbeat, acking can be switched off
+type heartbeatServer struct {
+	listener net.Listener
+	ack      int32
+}
+
+func newHeartbeatServer(t *testing.T) *heartbeatServer {
+	return listenHeartbeatServer(t, "tcp", "127.0.0.1:0")
+}
+
+func listenHeartbeatServer(t *testing.T, network, address string) *heartbeatServer {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &heartbeatServer{
+		listener: l,
+		ack:      1,
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *heartbeatServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	header := make([]byte, sofarpc.REQUEST_HEADER_LEN_V1)
+
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+
+		cmdCode := int16(binary.BigEndian.Uint16(header[2:4]))
+		reqID := binary.BigEndian.Uint32(header[5:9])
+		classLen := binary.BigEndian.Uint16(header[14:16])
+		headerLen := binary.BigEndian.Uint16(header[16:18])
+		contentLen := binary.BigEndian.Uint32(header[18:22])
+
+		body := make([]byte, int(classLen)+int(headerLen)+int(contentLen))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		if cmdCode != sofarpc.HEARTBEAT || atomic.LoadInt32(&s.ack) == 0 {
+			continue
+		}
+
+		resp := make([]byte, sofarpc.RESPONSE_HEADER_LEN_V1)
+		resp[0] = sofarpc.PROTOCOL_CODE_V1
+		resp[1] = sofarpc.RESPONSE
+		binary.BigEndian.PutUint16(resp[2:4], uint16(sofarpc.HEARTBEAT))
+		resp[4] = header[4]
+		binary.BigEndian.PutUint32(resp[5:9], reqID)
+		resp[9] = header[9]
+		binary.BigEndian.PutUint16(resp[10:12], uint16(sofarpc.RESPONSE_STATUS_SUCCESS))
+
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *heartbeatServer) setAck(ack bool) {
+	if ack {
+		atomic.StoreInt32(&s.ack, 1)
+	} else {
+		atomic.StoreInt32(&s.ack, 0)
+	}
+}
+
+func (s *heartbeatServer) addr() string {
+	if s.listener.Addr().Network() == "unix" {
+		return "unix://" + s.listener.Addr().String()
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *heartbeatServer) close() {
+	s.listener.Close()
+}
+
+func waitHealthyHosts(c types.Cluster, expected int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		if len(c.PrioritySet().GetOrCreateHostSet(0).HealthyHosts()) == expected {
+			return true
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestSofaRpcHealthCheckHostRecover(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	flaky := newHeartbeatServer(t)
+	defer flaky.close()
+	stable := newHeartbeatServer(t)
+	defer stable.close()
+
+	c := cluster.NewCluster(v2.Cluster{
+		Name:        "bolt_health_check",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_ROUNDROBIN,
+		HealthCheck: v2.HealthCheck{
+			Protocol:           string(protocol.SofaRpc),
+			Timeout:            100 * time.Millisecond,
+			Interval:           50 * time.Millisecond,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 2,
+		},
+	}, nil, false)
+
+	c.(types.SimpleCluster).UpdateHosts([]types.Host{
+		cluster.NewHost(v2.Host{Address: flaky.addr()}, c.Info()),
+		cluster.NewHost(v2.Host{Address: stable.addr()}, c.Info()),
+	})
+
+	if !waitHealthyHosts(c, 2, time.Second) {
+		t.Fatal("hosts should be healthy at start")
+	}
+
+	// host stops acking heartbeat
+	flaky.setAck(false)
+
+	if !waitHealthyHosts(c, 1, 3*time.Second) {
+		t.Fatal("host not acking heartbeat should be unhealthy")
+	}
+
+	for i := 0; i < 10; i++ {
+		if host := c.Info().LBInstance().ChooseHost(nil); host == nil || host.AddressString() != stable.addr() {
+			t.Fatal("unhealthy host should not be chosen by load balancer")
+		}
+	}
+
+	// host recovers
+	flaky.setAck(true)
+
+	if !waitHealthyHosts(c, 2, 3*time.Second) {
+		t.Fatal("host acking heartbeat again should be healthy")
+	}
+
+	c.HealthChecker().Stop()
+}
+
+func TestSofaRpcHealthCheckUnixHost(t *testing.T) {
+	log.InitDefaultLogger("", log.INFO)
+
+	dir, err := ioutil.TempDir("", "mosn_health_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := listenHeartbeatServer(t, "unix", filepath.Join(dir, "bolt.sock"))
+	defer server.close()
+
+	c := cluster.NewCluster(v2.Cluster{
+		Name:        "bolt_unix_health_check",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_ROUNDROBIN,
+		HealthCheck: v2.HealthCheck{
+			Protocol:           string(protocol.SofaRpc),
+			Timeout:            100 * time.Millisecond,
+			Interval:           50 * time.Millisecond,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 2,
+		},
+	}, nil, false)
+
+	c.(types.SimpleCluster).UpdateHosts([]types.Host{
+		cluster.NewHost(v2.Host{Address: server.addr()}, c.Info()),
+	})
+
+	if !waitHealthyHosts(c, 1, time.Second) {
+		t.Fatal("unix socket host should be healthy at start")
+	}
+
+	server.setAck(false)
+
+	if !waitHealthyHosts(c, 0, 3*time.Second) {
+		t.Fatal("unix socket host not acking heartbeat should be unhealthy")
+	}
+
+	c.HealthChecker().Stop()
+}
@@ -66,6 +66,11 @@ func (t *timer) start(interval time.Duration) {
 }
 
 func (t *timer) stop() {
+	// a stop signal left for a timer not started would cancel its next start
+	if atomic.LoadInt32(&t.started) == 0 {
+		return
+	}
+
 	if !atomic.CompareAndSwapInt32(&t.stopped, 0, 1) {
 		return
 	}